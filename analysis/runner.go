@@ -0,0 +1,229 @@
+// Package analysis runs the diagnostics of the open documents: a document changed is
+// analyzed once the user stops typing, an analysis of a version superseded by a newer edit
+// is cancelled, and the diagnostics are published tagged with the version they were
+// computed for. A server only implements the analysis itself:
+//
+//	runner := analysis.NewRunner(s, analysis.AnalyzerFunc(func(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error) {
+//		return lint(snapshot.Text), nil
+//	}))
+//	runner.Delay = 300 * time.Millisecond
+//	runner.AddStage("remote check", 2*time.Second, remoteChecker)
+package analysis
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// DefaultDelay is the delay of a new Runner.
+const DefaultDelay = 500 * time.Millisecond
+
+// Analyzer computes the diagnostics of a snapshot of a document. ctx is cancelled when the
+// document changed again or was closed meanwhile, the result is then dropped.
+type Analyzer interface {
+	Analyze(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error)
+}
+
+// AnalyzerFunc is a function implementing Analyzer.
+type AnalyzerFunc func(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error)
+
+// Analyze calls f.
+func (f AnalyzerFunc) Analyze(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error) {
+	return f(ctx, snapshot)
+}
+
+// Runner analyzes the documents of a server as they are opened and changed, and publishes
+// their diagnostics. It follows the document store of the server, the text synchronization
+// handlers are not needed. Closed documents have their diagnostics cleared. It is safe for
+// concurrent use.
+//
+// Expensive analyses (a remote API, a language model) are added as slower stages with
+// AddStage: each stage runs after its own delay and is cancelled by edits independently,
+// and the diagnostics of all the stages are merged as each stage finishes, so the cheap
+// ones show up without waiting for the others.
+type Runner struct {
+	// Analyzer computes the diagnostics of the first stage, it may be nil when stages are
+	// added with AddStage.
+	Analyzer Analyzer
+	// Delay is how long a change waits for the next one before it is analyzed by Analyzer,
+	// opened documents are analyzed right away. Set it before the server runs.
+	Delay time.Duration
+	// Filter, when set, selects the documents analyzed, e.g. by language.
+	Filter func(snapshot *textdocument.Snapshot) bool
+	// Logger logs the analyses and their failures. Defaults to discarding.
+	Logger *log.Logger
+
+	s          *server.Server
+	added      []*stage
+	stagesOnce sync.Once
+	stages     []*stage // Analyzer first, then the added stages, see init
+
+	mu   sync.Mutex // Held while publishing, merged diagnostics are sent in order
+	docs map[protocol.DocumentURI]*analyzed
+}
+
+// stage is an analysis pass of a Runner.
+type stage struct {
+	name     string
+	analyzer Analyzer
+	checks   *server.Debouncer[protocol.DocumentURI]
+	delay    time.Duration
+}
+
+// analyzed holds the diagnostics of each stage for an open document.
+type analyzed struct {
+	version     int // Latest version published
+	diagnostics [][]protocol.Diagnostic
+}
+
+// NewRunner creates a runner analyzing the documents of s with analyzer, waiting for
+// DefaultDelay after changes.
+func NewRunner(s *server.Server, analyzer Analyzer) *Runner {
+	r := &Runner{Analyzer: analyzer, Delay: DefaultDelay, s: s, docs: make(map[protocol.DocumentURI]*analyzed)}
+	s.OnDocumentChanged(r.documentChanged)
+	return r
+}
+
+// AddStage adds an analysis pass run after the Analyzer of the runner, waiting for delay
+// after changes, e.g. a slow check of a remote service with a longer delay than the
+// local one. name identifies it in the logs. Add stages before the server runs.
+func (r *Runner) AddStage(name string, delay time.Duration, analyzer Analyzer) {
+	r.added = append(r.added, &stage{name: name, analyzer: analyzer, delay: delay})
+}
+
+func (r *Runner) logf(format string, args ...any) {
+	if r.Logger != nil {
+		r.Logger.Printf(format, args...)
+	}
+}
+
+// init returns the stages, with their debouncers created on first use.
+func (r *Runner) init() []*stage {
+	r.stagesOnce.Do(func() {
+		if r.Analyzer != nil {
+			r.stages = append(r.stages, &stage{name: "analysis", analyzer: r.Analyzer, delay: r.Delay})
+		}
+		r.stages = append(r.stages, r.added...)
+		for _, st := range r.stages {
+			st.checks = server.NewDebouncer[protocol.DocumentURI](r.s.BackgroundContext(), st.delay)
+		}
+	})
+	return r.stages
+}
+
+// documentChanged schedules the analyses of a document, or clears its diagnostics once
+// closed. The clearing holds the publishing lock, no stage publishes after it.
+func (r *Runner) documentChanged(uri protocol.DocumentURI, snapshot *textdocument.Snapshot) {
+	stages := r.init()
+	if snapshot == nil {
+		for _, st := range stages {
+			st.checks.Cancel(uri)
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.docs[uri]; !ok {
+			return
+		}
+		delete(r.docs, uri)
+		if err := r.s.Diagnostics().Clear(r.s.BackgroundContext(), uri); err != nil {
+			r.logf("Failed to clear diagnostics of %s: %v", uri, err)
+		}
+		return
+	}
+	if r.Filter != nil && !r.Filter(snapshot) {
+		return
+	}
+
+	r.mu.Lock()
+	_, open := r.docs[uri]
+	if !open {
+		r.docs[uri] = &analyzed{version: snapshot.Version, diagnostics: make([][]protocol.Diagnostic, len(stages))}
+	}
+	r.mu.Unlock()
+	for i, st := range stages {
+		if open {
+			st.checks.Trigger(uri, r.analyze(i, snapshot))
+		} else {
+			st.checks.TriggerNow(uri, r.analyze(i, snapshot)) // No need to wait for the user to type
+		}
+	}
+}
+
+// Trigger analyzes the current snapshot of an open document right away with all the
+// stages, e.g. once a command changed the settings of the analysis. It does nothing when
+// the document is not open.
+func (r *Runner) Trigger(uri protocol.DocumentURI) {
+	snapshot, ok := r.s.Documents().Get(uri)
+	if !ok || (r.Filter != nil && !r.Filter(snapshot)) {
+		return
+	}
+	r.mu.Lock()
+	_, open := r.docs[uri]
+	r.mu.Unlock()
+	if !open {
+		return // Analyzed once the runner sees it opened
+	}
+	for i, st := range r.init() {
+		st.checks.TriggerNow(uri, r.analyze(i, snapshot))
+	}
+}
+
+// Refresh analyzes all the open documents again.
+func (r *Runner) Refresh() {
+	for _, snapshot := range r.s.Documents().Snapshots() {
+		r.Trigger(snapshot.URI)
+	}
+}
+
+// analyze returns the analysis of snapshot by a stage, run by the debouncer of the stage.
+func (r *Runner) analyze(i int, snapshot *textdocument.Snapshot) func(ctx context.Context) {
+	st := r.stages[i]
+	return func(ctx context.Context) {
+		start := time.Now()
+		diagnostics, err := st.analyzer.Analyze(ctx, snapshot)
+		if ctx.Err() != nil {
+			return // Superseded by a newer version, or closed
+		}
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				r.logf("Failed %s of %s (version %d): %v", st.name, snapshot.URI, snapshot.Version, err)
+			}
+			return // Keep the diagnostics published, they are the best known
+		}
+		r.logf("Finished %s of %s (version %d) in %v: %d diagnostics", st.name, snapshot.URI, snapshot.Version, time.Since(start), len(diagnostics))
+		r.publish(ctx, i, snapshot, diagnostics)
+	}
+}
+
+// publish merges the diagnostics of a stage with the latest ones of the other stages and
+// publishes them. The other stages may not have analyzed this version yet: their previous
+// diagnostics are kept until they did, rather than flickering away at each edit.
+func (r *Runner) publish(ctx context.Context, i int, snapshot *textdocument.Snapshot, diagnostics []protocol.Diagnostic) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	doc, ok := r.docs[snapshot.URI]
+	if !ok {
+		return // Closed meanwhile
+	}
+	if snapshot.Version < doc.version {
+		return // A stage already published a newer version, this one is stale
+	}
+	doc.version = snapshot.Version
+	doc.diagnostics[i] = diagnostics
+
+	var merged []protocol.Diagnostic
+	for _, d := range doc.diagnostics {
+		merged = append(merged, d...)
+	}
+	version := snapshot.Version
+	if err := r.s.Diagnostics().Publish(ctx, snapshot.URI, &version, merged); err != nil {
+		r.logf("Failed to publish diagnostics of %s: %v", snapshot.URI, err)
+	}
+}
@@ -0,0 +1,226 @@
+package analysis
+
+import (
+	"context"
+	"io"
+	"log"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/client"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+const testURI = protocol.DocumentURI("file:///tmp/a.txt")
+
+// startRunner runs a server analyzing its documents with the runner set up by setup, and
+// returns an initialized client connected to it.
+func startRunner(t *testing.T, setup func(s *server.Server) *Runner) *client.Client {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	s := server.NewServer(
+		server.WithStream(server.ReadWriter{Reader: serverR, Writer: serverW}),
+		server.WithLogger(log.New(io.Discard, "", 0)),
+	)
+	setup(s)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	c := client.New(client.Stdio{Reader: clientR, Writer: clientW}, client.WithCapabilityGuard(client.GuardOff))
+	t.Cleanup(func() {
+		c.Close()
+		cancel()
+		serverR.Close()
+		serverW.Close()
+		<-done
+	})
+	if _, err := c.Initialize(testContext(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// testContext returns a context bounding a test waiting on the server.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// diagnostic returns a diagnostic with message at the start of the document.
+func diagnostic(message string) protocol.Diagnostic {
+	return protocol.Diagnostic{Message: message}
+}
+
+// messages returns the messages of diagnostics.
+func messages(diagnostics []protocol.Diagnostic) []string {
+	var got []string
+	for _, d := range diagnostics {
+		got = append(got, d.Message)
+	}
+	return got
+}
+
+// replace returns the edit replacing the whole text of a one line document.
+func replace(old, text string) protocol.TextEdit {
+	return protocol.TextEdit{Range: protocol.Range{End: protocol.Position{Character: uint(len(old))}}, NewText: text}
+}
+
+// TestRunnerCancelsSupersededRun checks the analysis of a version is cancelled by a newer
+// edit, whose diagnostics are published instead.
+func TestRunnerCancelsSupersededRun(t *testing.T) {
+	started := make(chan struct{})
+	cancelled := make(chan struct{})
+	c := startRunner(t, func(s *server.Server) *Runner {
+		r := NewRunner(s, AnalyzerFunc(func(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error) {
+			if snapshot.Version == 1 {
+				close(started)
+				<-ctx.Done()
+				close(cancelled)
+				return []protocol.Diagnostic{diagnostic("stale")}, nil
+			}
+			return []protocol.Diagnostic{diagnostic(snapshot.Text)}, nil
+		}))
+		r.Delay = 10 * time.Millisecond
+		return r
+	})
+	ctx := testContext(t)
+	if err := c.Open(ctx, testURI, "plaintext", "one"); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := c.Edit(ctx, testURI, replace("one", "two")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-cancelled:
+	case <-ctx.Done():
+		t.Fatal("analysis of the superseded version not cancelled")
+	}
+	got, err := c.WaitForDiagnostics(testURI, 2, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := messages(got.Diagnostics); len(m) != 1 || m[0] != "two" {
+		t.Errorf("got %q, want the diagnostics of version 2", m)
+	}
+}
+
+// TestRunnerClearsClosedDocuments checks closing a document clears its diagnostics, and
+// that the analysis in progress when it was closed publishes nothing afterwards.
+func TestRunnerClearsClosedDocuments(t *testing.T) {
+	started := make(chan struct{}, 1)
+	c := startRunner(t, func(s *server.Server) *Runner {
+		return NewRunner(s, AnalyzerFunc(func(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error) {
+			if snapshot.Text == "slow" {
+				started <- struct{}{}
+				<-ctx.Done() // Cancelled by the close, the result must be dropped anyway
+			}
+			return []protocol.Diagnostic{diagnostic(snapshot.Text)}, nil
+		}))
+	})
+	published := make(chan []string, 10)
+	c.OnDiagnostics(testURI, func(d client.Diagnostics) { published <- messages(d.Diagnostics) })
+	ctx := testContext(t)
+	next := func() []string {
+		t.Helper()
+		select {
+		case m := <-published:
+			return m
+		case <-ctx.Done():
+			t.Fatal("no diagnostics published")
+			return nil
+		}
+	}
+
+	if err := c.Open(ctx, testURI, "plaintext", "fast"); err != nil {
+		t.Fatal(err)
+	}
+	if m := next(); len(m) != 1 || m[0] != "fast" {
+		t.Fatalf("got %q, want the diagnostics of the opened document", m)
+	}
+	if err := c.Edit(ctx, testURI, replace("fast", "slow")); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := c.CloseDocument(ctx, testURI); err != nil {
+		t.Fatal(err)
+	}
+	// Reopened, analyzed once the analysis in progress returned
+	if err := c.Open(ctx, testURI, "plaintext", "again"); err != nil {
+		t.Fatal(err)
+	}
+	if m := next(); len(m) != 0 {
+		t.Fatalf("got %q, want the diagnostics cleared", m)
+	}
+	if m := next(); len(m) != 1 || m[0] != "again" {
+		t.Fatalf("got %q, want the diagnostics of the reopened document", m)
+	}
+}
+
+// TestRunnerMergesStages checks the diagnostics of the stages are published merged, each
+// stage keeping its previous diagnostics until it analyzed the new version.
+func TestRunnerMergesStages(t *testing.T) {
+	c := startRunner(t, func(s *server.Server) *Runner {
+		r := NewRunner(s, AnalyzerFunc(func(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error) {
+			return []protocol.Diagnostic{diagnostic("fast " + snapshot.Text)}, nil
+		}))
+		r.Delay = 10 * time.Millisecond
+		r.AddStage("slow", 300*time.Millisecond, AnalyzerFunc(func(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error) {
+			return []protocol.Diagnostic{diagnostic("slow " + snapshot.Text)}, nil
+		}))
+		return r
+	})
+	published := make(chan []string, 10)
+	c.OnDiagnostics(testURI, func(d client.Diagnostics) { published <- messages(d.Diagnostics) })
+	ctx := testContext(t)
+	waitFor := func(want ...string) {
+		t.Helper()
+		for {
+			select {
+			case got := <-published:
+				if slices.Equal(got, want) {
+					return
+				}
+			case <-ctx.Done():
+				t.Fatalf("%q never published", want)
+			}
+		}
+	}
+
+	if err := c.Open(ctx, testURI, "plaintext", "one"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor("fast one", "slow one")
+	if err := c.Edit(ctx, testURI, replace("one", "two")); err != nil {
+		t.Fatal(err)
+	}
+	// The fast stage publishes first, with the diagnostics of the slow one so far
+	if got := <-published; !slices.Equal(got, []string{"fast two", "slow one"}) {
+		t.Errorf("got %q, want the fast stage merged with the previous slow diagnostics", got)
+	}
+	waitFor("fast two", "slow two")
+}
+
+// TestPublishDropsStaleVersion checks a stage finishing the analysis of a version older
+// than the one published by another stage publishes nothing.
+func TestPublishDropsStaleVersion(t *testing.T) {
+	s := server.NewServer(server.WithLogger(log.New(io.Discard, "", 0)))
+	r := NewRunner(s, nil)
+	r.docs[testURI] = &analyzed{version: 3, diagnostics: make([][]protocol.Diagnostic, 2)}
+
+	r.publish(context.Background(), 1, &textdocument.Snapshot{URI: testURI, Version: 2}, []protocol.Diagnostic{diagnostic("stale")})
+	if doc := r.docs[testURI]; doc.version != 3 || doc.diagnostics[1] != nil {
+		t.Errorf("stale diagnostics stored: version %d, %v", doc.version, doc.diagnostics)
+	}
+	if got := s.Diagnostics().Get(testURI); len(got) != 0 {
+		t.Errorf("stale diagnostics published: %v", got)
+	}
+}
@@ -0,0 +1,233 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// CapabilityGuard is what the client does with a request or notification the server did not
+// advertise support for, in its InitializeResult or with client/registerCapability.
+// Editors don't send them, guarding catches capability bugs of servers under test.
+type CapabilityGuard int
+
+const (
+	// GuardRefuse fails the call with ErrUnsupported without reaching the server (default).
+	GuardRefuse CapabilityGuard = iota
+	// GuardWarn logs the call and sends it anyway.
+	GuardWarn
+	// GuardOff sends everything.
+	GuardOff
+)
+
+// WithCapabilityGuard sets what the client does with the methods the server does not support.
+func WithCapabilityGuard(g CapabilityGuard) Option {
+	return func(c *Client) {
+		c.guard = g
+	}
+}
+
+// capabilities are the raw server capabilities, providers are either a boolean or options
+// and servers not built with lspgo send both.
+type capabilities map[string]json.RawMessage
+
+// provider reports whether the provider key is advertised, with options or true.
+func (caps capabilities) provider(key string) bool {
+	raw, ok := caps[key]
+	return ok && string(raw) != "false" && string(raw) != "null"
+}
+
+// option reports whether the boolean option of the provider key is true, e.g. resolveProvider.
+func (caps capabilities) option(key, option string) bool {
+	var options map[string]json.RawMessage
+	if err := json.Unmarshal(caps[key], &options); err != nil {
+		return false // Not advertised, or a boolean without options
+	}
+	return string(options[option]) == "true"
+}
+
+// sync returns the text document sync options, a bare TextDocumentSyncKind stands for
+// open/close and save notifications plus changes of that kind.
+func (caps capabilities) sync() (openClose bool, change protocol.TextDocumentSyncKind, save bool) {
+	raw, ok := caps["textDocumentSync"]
+	if !ok {
+		return false, protocol.SyncNone, false
+	}
+	var kind protocol.TextDocumentSyncKind
+	if err := json.Unmarshal(raw, &kind); err == nil {
+		return kind != protocol.SyncNone, kind, kind != protocol.SyncNone
+	}
+	var options struct {
+		OpenClose bool                          `json:"openClose"`
+		Change    protocol.TextDocumentSyncKind `json:"change"`
+		Save      json.RawMessage               `json:"save"`
+	}
+	if err := json.Unmarshal(raw, &options); err != nil {
+		return false, protocol.SyncNone, false
+	}
+	return options.OpenClose, options.Change, len(options.Save) > 0 && string(options.Save) != "false" && string(options.Save) != "null"
+}
+
+// methodCapabilities maps the methods sent by clients to the server capability they depend on.
+// Methods missing here (lifecycle, custom methods, ...) are always sent.
+var methodCapabilities = map[string]struct {
+	capability string
+	supported  func(capabilities) bool
+}{
+	protocol.MethodTextDocumentHover:      {"hoverProvider", func(c capabilities) bool { return c.provider("hoverProvider") }},
+	protocol.MethodTextDocumentCompletion: {"completionProvider", func(c capabilities) bool { return c.provider("completionProvider") }},
+	protocol.MethodCompletionItemResolve: {"completionProvider.resolveProvider", func(c capabilities) bool {
+		return c.option("completionProvider", "resolveProvider")
+	}},
+	protocol.MethodTextDocumentDefinition: {"definitionProvider", func(c capabilities) bool { return c.provider("definitionProvider") }},
+	protocol.MethodTextDocumentReferences: {"referencesProvider", func(c capabilities) bool { return c.provider("referencesProvider") }},
+	protocol.MethodTextDocumentCodeAction: {"codeActionProvider", func(c capabilities) bool { return c.provider("codeActionProvider") }},
+	protocol.MethodCodeActionResolve: {"codeActionProvider.resolveProvider", func(c capabilities) bool {
+		return c.option("codeActionProvider", "resolveProvider")
+	}},
+	protocol.MethodTextDocumentDeclaration: {"declarationProvider", func(c capabilities) bool {
+		return c.provider("declarationProvider")
+	}},
+	protocol.MethodTextDocumentTypeDefinition: {"typeDefinitionProvider", func(c capabilities) bool {
+		return c.provider("typeDefinitionProvider")
+	}},
+	protocol.MethodTextDocumentImplementation: {"implementationProvider", func(c capabilities) bool {
+		return c.provider("implementationProvider")
+	}},
+	protocol.MethodTextDocumentFormatting: {"documentFormattingProvider", func(c capabilities) bool {
+		return c.provider("documentFormattingProvider")
+	}},
+	protocol.MethodTextDocumentRangeFormatting: {"documentRangeFormattingProvider", func(c capabilities) bool {
+		return c.provider("documentRangeFormattingProvider")
+	}},
+	protocol.MethodTextDocumentRename: {"renameProvider", func(c capabilities) bool {
+		return c.provider("renameProvider")
+	}},
+	protocol.MethodTextDocumentPrepareRename: {"renameProvider.prepareProvider", func(c capabilities) bool {
+		return c.option("renameProvider", "prepareProvider")
+	}},
+	protocol.MethodWorkspaceSymbol: {"workspaceSymbolProvider", func(c capabilities) bool {
+		return c.provider("workspaceSymbolProvider")
+	}},
+	protocol.MethodWorkspaceSymbolResolve: {"workspaceSymbolProvider.resolveProvider", func(c capabilities) bool {
+		return c.option("workspaceSymbolProvider", "resolveProvider")
+	}},
+	protocol.MethodWorkspaceExecuteCommand: {"executeCommandProvider", func(c capabilities) bool {
+		return c.provider("executeCommandProvider")
+	}},
+	protocol.MethodTextDocumentDidOpen: {"textDocumentSync.openClose", func(c capabilities) bool {
+		openClose, _, _ := c.sync()
+		return openClose
+	}},
+	protocol.MethodTextDocumentDidClose: {"textDocumentSync.openClose", func(c capabilities) bool {
+		openClose, _, _ := c.sync()
+		return openClose
+	}},
+	protocol.MethodTextDocumentDidChange: {"textDocumentSync.change", func(c capabilities) bool {
+		_, change, _ := c.sync()
+		return change != protocol.SyncNone
+	}},
+	protocol.MethodTextDocumentDidSave: {"textDocumentSync.save", func(c capabilities) bool {
+		_, _, save := c.sync()
+		return save
+	}},
+	protocol.MethodTextDocumentWillSave: {"textDocumentSync.willSave", func(c capabilities) bool {
+		return c.option("textDocumentSync", "willSave")
+	}},
+	protocol.MethodTextDocumentWillSaveWaitUntil: {"textDocumentSync.willSaveWaitUntil", func(c capabilities) bool {
+		return c.option("textDocumentSync", "willSaveWaitUntil")
+	}},
+}
+
+// Supports reports whether the server advertised support for method, statically or with
+// client/registerCapability. Methods which don't depend on a capability are supported, and
+// all methods are before Initialize.
+func (c *Client) Supports(method string) bool {
+	return c.checkCapability(method, nil) == nil
+}
+
+// checkCapability returns an error wrapping ErrUnsupported if the server does not support
+// method, or for workspace/executeCommand the command of params.
+func (c *Client) checkCapability(method string, params any) error {
+	entry, guarded := methodCapabilities[method]
+	if !guarded {
+		return nil
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.capabilities == nil {
+		return nil
+	}
+	for _, registered := range c.registrations {
+		if registered == method {
+			return nil // Dynamic registrations have their own options, not checked
+		}
+	}
+	if !entry.supported(c.capabilities) {
+		return fmt.Errorf("%s (server capability %s): %w", method, entry.capability, ErrUnsupported)
+	}
+
+	if method == protocol.MethodWorkspaceExecuteCommand {
+		var command string
+		switch p := params.(type) {
+		case protocol.ExecuteCommandParams:
+			command = p.Command
+		case *protocol.ExecuteCommandParams:
+			command = p.Command
+		default:
+			return nil
+		}
+		var options protocol.ExecuteCommandOptions
+		if err := json.Unmarshal(c.capabilities["executeCommandProvider"], &options); err == nil &&
+			!slices.Contains(options.Commands, command) {
+			return fmt.Errorf("%s: command %q not in executeCommandProvider.commands %v: %w",
+				method, command, options.Commands, ErrUnsupported)
+		}
+	}
+	return nil
+}
+
+// guardCall applies the capability guard to an outgoing request or notification.
+func (c *Client) guardCall(method string, params any) error {
+	if c.guard == GuardOff {
+		return nil
+	}
+	err := c.checkCapability(method, params)
+	if err == nil {
+		return nil
+	}
+	if c.guard == GuardWarn {
+		c.logger.Printf("Warning: sending unsupported %v", err)
+		return nil
+	}
+	return err
+}
+
+// trackRegistration records the dynamic registrations of the server, so that the methods
+// registered after initialization pass the capability guard.
+func (c *Client) trackRegistration(method string, params json.RawMessage) {
+	switch method {
+	case protocol.MethodClientRegisterCapability:
+		var p protocol.RegistrationParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		c.mu.Lock()
+		for _, r := range p.Registrations {
+			c.registrations[r.ID] = r.Method
+		}
+		c.mu.Unlock()
+	case protocol.MethodClientUnregisterCapability:
+		var p protocol.UnregistrationParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return
+		}
+		c.mu.Lock()
+		for _, u := range p.Unregisterations {
+			delete(c.registrations, u.ID)
+		}
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,399 @@
+// Package client implements the client side of the protocol, to drive language servers
+// from tools and test programs.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrClosed is returned by calls pending when the connection to the server closes.
+var ErrClosed = errors.New("connection to the server closed")
+
+// RequestHandler answers a request sent by the server, e.g. workspace/applyEdit.
+type RequestHandler func(ctx context.Context, params json.RawMessage) (any, error)
+
+// NotificationHandler receives a notification sent by the server, e.g. textDocument/publishDiagnostics.
+type NotificationHandler func(ctx context.Context, params json.RawMessage)
+
+// Client is a connection to a language server.
+// Requests from the server without a handler are answered with a MethodNotFound error, but
+// for the ones the client handles itself: client/registerCapability,
+// client/unregisterCapability and window/workDoneProgress/create are answered with a null
+// result, so that servers waiting for them proceed.
+type Client struct {
+	conn   *jsonrpc2.Conn
+	logger *log.Logger
+
+	pendingMu sync.Mutex
+	pending   map[string]chan *jsonrpc2.ResponseMessage
+
+	mu                   sync.RWMutex
+	requestHandlers      map[string]RequestHandler
+	notificationHandlers map[string]NotificationHandler
+	initResult           *protocol.InitializeResult
+	capabilities         capabilities      // Raw capabilities of initResult, checked by the guard
+	registrations        map[string]string // Methods registered dynamically by the server, by ID
+
+	guard CapabilityGuard
+
+	docsMu sync.Mutex // Held while sending, so that changes are sent in version order
+	docs   map[protocol.DocumentURI]*document
+	// Last version sent of each document, read by the read loop which can't wait for docsMu
+	sentVersions sync.Map
+
+	diagnosticsMu   sync.Mutex
+	diagnostics     map[protocol.DocumentURI]Diagnostics // Last published for each document
+	diagnosticsSink sink[Diagnostics]
+	showMessageSink sink[protocol.ShowMessageParams]
+	logMessageSink  sink[protocol.LogMessageParams]
+	progressSink    sink[protocol.ProgressParams]
+
+	// Notifications waiting for their handler, run in order by dispatchNotifications
+	notifyMu    sync.Mutex
+	notifyQueue []*jsonrpc2.NotificationMessage
+	notifyWake  chan struct{} // Signaled when notifyQueue is appended to
+
+	done    chan struct{} // Closed when the read loop stops
+	readErr error         // Why the read loop stopped, set before done is closed
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithLogger sets the logger of the client, it logs nothing by default.
+func WithLogger(l *log.Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// WithIDGenerator sets the generator of the IDs of the requests sent to the server,
+// numbered by default. Clients sharing a server through a proxy use distinct prefixes, see
+// jsonrpc2.NewPrefixedIDs.
+func WithIDGenerator(g jsonrpc2.IDGenerator) Option {
+	return func(c *Client) {
+		c.conn.SetIDGenerator(g)
+	}
+}
+
+// New connects a client to a server reading and writing rw, e.g. the stdin and stdout of
+// the server process. It reads the messages of the server until Close.
+func New(rw io.ReadWriter, opts ...Option) *Client {
+	c := &Client{
+		conn:                 jsonrpc2.NewConn(jsonrpc2.NewStream(rw)),
+		logger:               log.New(io.Discard, "", 0),
+		pending:              make(map[string]chan *jsonrpc2.ResponseMessage),
+		requestHandlers:      make(map[string]RequestHandler),
+		notificationHandlers: make(map[string]NotificationHandler),
+		registrations:        make(map[string]string),
+		docs:                 make(map[protocol.DocumentURI]*document),
+		diagnostics:          make(map[protocol.DocumentURI]Diagnostics),
+		notifyWake:           make(chan struct{}, 1),
+		done:                 make(chan struct{}),
+	}
+	// Replaced by OnRequest if needed
+	c.requestHandlers[protocol.MethodResyncDocuments] = c.handleResyncDocuments
+	for _, method := range []string{
+		protocol.MethodClientRegisterCapability,   // Tracked by trackRegistration
+		protocol.MethodClientUnregisterCapability, // Same
+		protocol.MethodWorkDoneProgressCreate,     // Reported by OnProgress
+	} {
+		c.requestHandlers[method] = acceptRequest
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	go c.readLoop()
+	go c.dispatchNotifications()
+	return c
+}
+
+// Stdio is an io.ReadWriter reading the output and writing the input of a server process.
+type Stdio struct {
+	io.Reader // Stdout of the server
+	io.Writer // Stdin of the server
+}
+
+// Close closes both ends when they are closers.
+func (s Stdio) Close() error {
+	var errR, errW error
+	if c, ok := s.Reader.(io.Closer); ok {
+		errR = c.Close()
+	}
+	if c, ok := s.Writer.(io.Closer); ok {
+		errW = c.Close()
+	}
+	return errors.Join(errR, errW)
+}
+
+// OnRequest sets the handler of a request sent by the server.
+func (c *Client) OnRequest(method string, handler RequestHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requestHandlers[method] = handler
+}
+
+// OnNotification sets the handler of a notification sent by the server. The handlers run
+// one at a time, in the order of the notifications, outside the read loop: they can call
+// Call, the following notifications wait for them.
+func (c *Client) OnNotification(method string, handler NotificationHandler) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.notificationHandlers[method] = handler
+}
+
+// Initialize sends the initialize request then the initialized notification, and returns
+// the capabilities of the server. From then on, requests and notifications depending on a
+// capability the server did not advertise are refused, see WithCapabilityGuard.
+// When the server fails the initialization, protocol.InitializeRetry tells from the error
+// whether Initialize may be called again.
+func (c *Client) Initialize(ctx context.Context, params *protocol.InitializeParams) (*protocol.InitializeResult, error) {
+	if params == nil {
+		params = &protocol.InitializeParams{}
+	}
+	if params.ProcessID == nil {
+		pid := os.Getpid()
+		params.ProcessID = &pid
+	}
+	var raw json.RawMessage
+	if err := c.Call(ctx, protocol.MethodInitialize, params, &raw); err != nil {
+		return nil, fmt.Errorf("initialize failed: %w", err)
+	}
+	var result protocol.InitializeResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid initialize result: %w", err)
+	}
+	// Kept raw too, the guard accepts both forms of the providers
+	var rawResult struct {
+		Capabilities capabilities `json:"capabilities"`
+	}
+	if err := json.Unmarshal(raw, &rawResult); err != nil {
+		return nil, fmt.Errorf("invalid initialize result: %w", err)
+	}
+	if rawResult.Capabilities == nil {
+		rawResult.Capabilities = capabilities{}
+	}
+	c.mu.Lock()
+	c.initResult = &result
+	c.capabilities = rawResult.Capabilities
+	c.mu.Unlock()
+
+	if err := c.Notify(ctx, protocol.MethodInitialized, protocol.InitializedParams{}); err != nil {
+		return nil, fmt.Errorf("failed to send initialized: %w", err)
+	}
+	return &result, nil
+}
+
+// InitializeResult returns the result of Initialize, nil before.
+func (c *Client) InitializeResult() *protocol.InitializeResult {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.initResult
+}
+
+// Call sends a request and waits for its response, decoded into result when non-nil.
+// A JSON-RPC error returned by the server is returned as a *jsonrpc2.ErrorObject.
+// When ctx is done first, the request is cancelled with $/cancelRequest.
+func (c *Client) Call(ctx context.Context, method string, params any, result any) error {
+	if err := c.guardCall(method, params); err != nil {
+		return err
+	}
+	rawParams, err := marshalParams(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params of %s: %w", method, err)
+	}
+
+	id := c.conn.NextID()
+	respCh := make(chan *jsonrpc2.ResponseMessage, 1)
+	c.pendingMu.Lock()
+	c.pending[string(id)] = respCh
+	c.pendingMu.Unlock()
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, string(id))
+		c.pendingMu.Unlock()
+	}()
+
+	request := &jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: id, Method: method, Params: rawParams}
+	c.logger.Printf("--> Request: Method=%s, ID=%s", method, string(id))
+	if err := c.conn.Write(ctx, request); err != nil {
+		return fmt.Errorf("failed to write request %s: %w", method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		// Best effort, the server may have answered already
+		c.Notify(context.Background(), protocol.MethodCancelRequest, protocol.CancelParams{ID: id}) //nolint:errcheck
+		return ctx.Err()
+	case <-c.done:
+		return fmt.Errorf("%w: %v", ErrClosed, c.readErr)
+	case resp := <-respCh:
+		c.logger.Printf("<-- Response: ID=%s", string(id))
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 && string(resp.Result) != "null" {
+			if err := json.Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("failed to unmarshal result of %s: %w", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Notify sends a notification.
+func (c *Client) Notify(ctx context.Context, method string, params any) error {
+	if err := c.guardCall(method, params); err != nil {
+		return err
+	}
+	rawParams, err := marshalParams(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal params of %s: %w", method, err)
+	}
+	c.logger.Printf("--> Notification: Method=%s", method)
+	return c.conn.Write(ctx, &jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: method, Params: rawParams})
+}
+
+// Shutdown asks the server to shut down then to exit. The connection is left open, the
+// server closes it when exiting.
+func (c *Client) Shutdown(ctx context.Context) error {
+	if err := c.Call(ctx, protocol.MethodShutdown, nil, nil); err != nil {
+		return fmt.Errorf("shutdown failed: %w", err)
+	}
+	return c.Notify(ctx, protocol.MethodExit, nil)
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Done is closed when the connection to the server is closed.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+func marshalParams(params any) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
+
+// readLoop dispatches the messages of the server until the connection closes.
+func (c *Client) readLoop() {
+	ctx := context.Background()
+	for {
+		msg, err := c.conn.Read(ctx)
+		if err != nil {
+			var rpcErr *jsonrpc2.ErrorObject
+			if errors.As(err, &rpcErr) {
+				c.logger.Printf("Ignoring invalid message from the server: %v", err)
+				continue
+			}
+			c.readErr = err
+			close(c.done)
+			return
+		}
+
+		switch m := msg.(type) {
+		case *jsonrpc2.ResponseMessage:
+			// Removed before sending, a duplicate response can't fill the channel and block the loop
+			c.pendingMu.Lock()
+			respCh, found := c.pending[string(m.ID)]
+			delete(c.pending, string(m.ID))
+			c.pendingMu.Unlock()
+			if !found {
+				c.logger.Printf("Ignoring response to unknown ID=%s", string(m.ID))
+				continue
+			}
+			respCh <- m
+		case *jsonrpc2.RequestMessage:
+			go c.handleRequest(ctx, m)
+		case *jsonrpc2.NotificationMessage:
+			c.observe(m.Method, m.Params)
+			c.notifyMu.Lock()
+			c.notifyQueue = append(c.notifyQueue, m)
+			c.notifyMu.Unlock()
+			select {
+			case c.notifyWake <- struct{}{}:
+			default: // Already signaled
+			}
+		}
+	}
+}
+
+// dispatchNotifications runs the handlers of the queued notifications in order, diagnostics
+// of a document must not be reordered, until the read loop stops. The queue is unbounded so
+// that a handler waiting for a response doesn't stop the read loop which delivers it.
+func (c *Client) dispatchNotifications() {
+	ctx := context.Background()
+	for {
+		select {
+		case <-c.notifyWake:
+		case <-c.done:
+			return
+		}
+		c.notifyMu.Lock()
+		queue := c.notifyQueue
+		c.notifyQueue = nil
+		c.notifyMu.Unlock()
+		for _, m := range queue {
+			c.mu.RLock()
+			handler := c.notificationHandlers[m.Method]
+			c.mu.RUnlock()
+			if handler != nil {
+				handler(ctx, m.Params)
+			}
+		}
+	}
+}
+
+// acceptRequest answers null to a request the client handles without a handler.
+func acceptRequest(ctx context.Context, params json.RawMessage) (any, error) {
+	return nil, nil
+}
+
+// handleRequest answers a request of the server.
+func (c *Client) handleRequest(ctx context.Context, req *jsonrpc2.RequestMessage) {
+	c.logger.Printf("<-- Request (from server): Method=%s, ID=%s", req.Method, string(req.ID))
+	c.trackRegistration(req.Method, req.Params)
+	c.mu.RLock()
+	handler := c.requestHandlers[req.Method]
+	c.mu.RUnlock()
+
+	resp := &jsonrpc2.ResponseMessage{JSONRPC: jsonrpc2.Version, ID: req.ID, Result: json.RawMessage("null")}
+	if handler == nil {
+		resp.Result, resp.Error = nil, jsonrpc2.NewError(jsonrpc2.MethodNotFound, fmt.Sprintf("method not found: %s", req.Method))
+	} else {
+		result, err := handler(ctx, req.Params)
+		switch {
+		case err != nil:
+			var rpcErr *jsonrpc2.ErrorObject
+			if !errors.As(err, &rpcErr) {
+				rpcErr = jsonrpc2.NewError(jsonrpc2.InternalError, err.Error())
+			}
+			resp.Result, resp.Error = nil, rpcErr
+		case result != nil:
+			raw, err := json.Marshal(result)
+			if err != nil {
+				resp.Result, resp.Error = nil, jsonrpc2.NewError(jsonrpc2.InternalError, err.Error())
+				break
+			}
+			resp.Result = raw
+		}
+	}
+	if err := c.conn.Write(ctx, resp); err != nil {
+		c.logger.Printf("Error answering request %s ID=%s: %v", req.Method, string(req.ID), err)
+	}
+}
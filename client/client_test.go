@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// TestDuplicateResponse checks a response sent twice by the server, or once the call
+// returned, doesn't block the read loop.
+func TestDuplicateResponse(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	c := New(Stdio{Reader: clientR, Writer: clientW}, WithCapabilityGuard(GuardOff))
+	t.Cleanup(func() {
+		c.Close()
+		serverW.Close()
+		serverR.Close()
+	})
+	server := jsonrpc2.NewStream(Stdio{Reader: serverR, Writer: serverW})
+	notified := make(chan struct{})
+	c.OnNotification("test/done", func(ctx context.Context, params json.RawMessage) {
+		close(notified)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	called := make(chan error, 1)
+	go func() {
+		called <- c.Call(ctx, "test/call", nil, nil)
+	}()
+
+	data, err := server.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req jsonrpc2.RequestMessage
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		// Blocks when the read loop does, the test then times out below
+		for range 3 {
+			server.WriteMessage(&jsonrpc2.ResponseMessage{JSONRPC: jsonrpc2.Version, ID: req.ID, Result: json.RawMessage(`null`)}) //nolint:errcheck
+		}
+		server.WriteMessage(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: "test/done"}) //nolint:errcheck
+	}()
+
+	if err := <-called; err != nil {
+		t.Fatalf("call: %v", err)
+	}
+	select {
+	case <-notified:
+	case <-ctx.Done():
+		t.Fatal("read loop blocked by the duplicate responses")
+	}
+}
+
+// TestNotificationHandlerCalls checks a notification handler can wait for the response of
+// a request, its handler running outside the read loop.
+func TestNotificationHandlerCalls(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	c := New(Stdio{Reader: clientR, Writer: clientW}, WithCapabilityGuard(GuardOff))
+	t.Cleanup(func() {
+		c.Close()
+		serverW.Close()
+		serverR.Close()
+	})
+	server := jsonrpc2.NewStream(Stdio{Reader: serverR, Writer: serverW})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	refreshed := make(chan error, 1)
+	c.OnNotification("test/changed", func(ctx context.Context, params json.RawMessage) {
+		refreshed <- c.Call(ctx, "test/refresh", nil, nil)
+	})
+	if err := server.WriteMessage(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: "test/changed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := server.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req jsonrpc2.RequestMessage
+	if err := json.Unmarshal(data, &req); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WriteMessage(&jsonrpc2.ResponseMessage{JSONRPC: jsonrpc2.Version, ID: req.ID, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-refreshed:
+		if err != nil {
+			t.Fatalf("call from the handler: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("call from a notification handler blocked")
+	}
+}
+
+// TestRequestWithoutHandler checks the requests of the server without a handler fail with
+// MethodNotFound, but for the ones the client handles itself.
+func TestRequestWithoutHandler(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	c := New(Stdio{Reader: clientR, Writer: clientW}, WithCapabilityGuard(GuardOff))
+	t.Cleanup(func() {
+		c.Close()
+		serverW.Close()
+		serverR.Close()
+	})
+	server := jsonrpc2.NewStream(Stdio{Reader: serverR, Writer: serverW})
+
+	for i, tc := range []struct {
+		method string
+		code   int
+	}{
+		{protocol.MethodWorkspaceConfiguration, jsonrpc2.MethodNotFound},
+		{protocol.MethodWorkspaceApplyEdit, jsonrpc2.MethodNotFound},
+		{protocol.MethodClientRegisterCapability, 0},
+		{protocol.MethodClientUnregisterCapability, 0},
+		{protocol.MethodWorkDoneProgressCreate, 0},
+	} {
+		id := json.RawMessage(fmt.Sprint(i + 1))
+		if err := server.WriteMessage(&jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: id, Method: tc.method, Params: json.RawMessage(`{}`)}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := server.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp jsonrpc2.ResponseMessage
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case string(resp.ID) != string(id):
+			t.Errorf("%s: got the response of ID %s", tc.method, resp.ID)
+		case tc.code == 0 && (resp.Error != nil || string(resp.Result) != "null"):
+			t.Errorf("%s: got %s, want a null result", tc.method, data)
+		case tc.code != 0 && (resp.Error == nil || resp.Error.Code != tc.code):
+			t.Errorf("%s: got %s, want error %d", tc.method, data, tc.code)
+		}
+	}
+}
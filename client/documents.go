@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// document is a document opened with the managed document API.
+type document struct {
+	languageID protocol.LanguageID
+	version    int
+	text       string
+}
+
+// OpenFile reads a file and opens it with Open, its language identifier guessed from its
+// name with protocol.LanguageIDForPath. It returns the URI of the document.
+func (c *Client) OpenFile(ctx context.Context, path string) (protocol.DocumentURI, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("failed to open %s: not UTF-8 text", path)
+	}
+	uri := protocol.URIFromPath(path)
+	if err := c.Open(ctx, uri, protocol.LanguageIDForPath(path), string(data)); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// Open opens a document at version 1 and sends textDocument/didOpen. The client then tracks
+// the document: Edit sends its changes with the following versions.
+// Like editors, the client sends nothing to servers without openClose synchronization, the
+// document is still tracked.
+func (c *Client) Open(ctx context.Context, uri protocol.DocumentURI, languageID protocol.LanguageID, text string) error {
+	c.docsMu.Lock()
+	defer c.docsMu.Unlock()
+	if _, open := c.docs[uri]; open {
+		return fmt.Errorf("document %s already open", uri)
+	}
+	c.docs[uri] = &document{languageID: languageID, version: 1, text: text}
+
+	var err error
+	if c.Supports(protocol.MethodTextDocumentDidOpen) {
+		err = c.Notify(ctx, protocol.MethodTextDocumentDidOpen, protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: languageID, Version: 1, Text: text},
+		})
+	}
+	c.sentVersions.Store(uri, 1)
+	return err
+}
+
+// Edit applies edits to an open document and sends textDocument/didChange with the next
+// version. Like the edits of a TextEdit[], they refer to the text before the call and must
+// not overlap. The change is sent the way the server synchronizes documents: as ranges for
+// incremental synchronization, as the whole text for full synchronization.
+func (c *Client) Edit(ctx context.Context, uri protocol.DocumentURI, edits ...protocol.TextEdit) error {
+	c.docsMu.Lock()
+	defer c.docsMu.Unlock()
+	doc, open := c.docs[uri]
+	if !open {
+		return fmt.Errorf("document %s not open", uri)
+	}
+	text, err := textdocument.ApplyEdits(doc.text, edits)
+	if err != nil {
+		return fmt.Errorf("invalid edits for %s (version %d): %w", uri, doc.version, err)
+	}
+	doc.text = text
+	doc.version++
+
+	c.mu.RLock()
+	_, kind, _ := c.capabilities.sync()
+	c.mu.RUnlock()
+	var changes []protocol.TextDocumentContentChangeEvent
+	switch {
+	case !c.Supports(protocol.MethodTextDocumentDidChange):
+		c.sentVersions.Store(uri, doc.version)
+		return nil
+	case kind == protocol.SyncIncremental:
+		changes = incrementalChanges(edits)
+	default:
+		changes = []protocol.TextDocumentContentChangeEvent{{Text: text}}
+	}
+	err = c.Notify(ctx, protocol.MethodTextDocumentDidChange, protocol.DidChangeTextDocumentParams{
+		TextDocument: protocol.VersionedTextDocumentIdentifier{
+			TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
+			Version:                doc.version,
+		},
+		ContentChanges: changes,
+	})
+	// Once sent, diagnostics without version received from now on are for this version
+	c.sentVersions.Store(uri, doc.version)
+	return err
+}
+
+// incrementalChanges turns edits of the original text into content changes, which apply one
+// after the other: sent from the last one in the text, each change leaves the positions of
+// the following ones untouched. Inserts at the same position are reversed to keep their order.
+func incrementalChanges(edits []protocol.TextEdit) []protocol.TextDocumentContentChangeEvent {
+	sorted := make([]protocol.TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i].Range.Start, sorted[j].Range.Start
+		return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+	})
+	changes := make([]protocol.TextDocumentContentChangeEvent, len(sorted))
+	for i, edit := range sorted {
+		rng := edit.Range
+		changes[len(sorted)-1-i] = protocol.TextDocumentContentChangeEvent{Range: &rng, Text: edit.NewText}
+	}
+	return changes
+}
+
+// Text returns the text and version of an open document, as the client last sent them.
+func (c *Client) Text(uri protocol.DocumentURI) (text string, version int, ok bool) {
+	c.docsMu.Lock()
+	defer c.docsMu.Unlock()
+	doc, open := c.docs[uri]
+	if !open {
+		return "", 0, false
+	}
+	return doc.text, doc.version, true
+}
+
+// CloseDocument stops tracking a document and sends textDocument/didClose.
+func (c *Client) CloseDocument(ctx context.Context, uri protocol.DocumentURI) error {
+	c.docsMu.Lock()
+	defer c.docsMu.Unlock()
+	if _, open := c.docs[uri]; !open {
+		return fmt.Errorf("document %s not open", uri)
+	}
+	delete(c.docs, uri)
+	c.sentVersions.Delete(uri)
+
+	if !c.Supports(protocol.MethodTextDocumentDidClose) {
+		return nil
+	}
+	return c.Notify(ctx, protocol.MethodTextDocumentDidClose, protocol.DidCloseTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+}
+
+// handleResyncDocuments answers protocol.MethodResyncDocuments, sent by a server restarted
+// after a crash: the documents it lists which are still open are sent again with didOpen,
+// at their current version.
+func (c *Client) handleResyncDocuments(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params protocol.ResyncDocumentsParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, fmt.Errorf("invalid %s params: %w", protocol.MethodResyncDocuments, err)
+	}
+	c.docsMu.Lock()
+	defer c.docsMu.Unlock()
+	for _, id := range params.Documents {
+		doc, open := c.docs[id.URI]
+		if !open {
+			continue
+		}
+		c.logger.Printf("Resending %s (version %d, the server had %d)", id.URI, doc.version, id.Version)
+		if err := c.Notify(ctx, protocol.MethodTextDocumentDidOpen, protocol.DidOpenTextDocumentParams{
+			TextDocument: protocol.TextDocumentItem{URI: id.URI, LanguageID: doc.languageID, Version: doc.version, Text: doc.text},
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
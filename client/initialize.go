@@ -0,0 +1,226 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Profile is a set of client capabilities mimicking an editor, to exercise servers under
+// the capabilities they meet in practice.
+type Profile string
+
+const (
+	// ProfileMinimal announces no capability, like the most basic clients: code actions must
+	// be commands, edits plain changes, documentation plain text.
+	ProfileMinimal Profile = "minimal"
+	// ProfileVSCode mimics Visual Studio Code, which supports about everything.
+	ProfileVSCode Profile = "vscode"
+	// ProfileNeovim mimics the built-in client of Neovim 0.10, without change annotations,
+	// snippets or workspace symbol resolution.
+	ProfileNeovim Profile = "neovim"
+)
+
+// profiles are the capabilities of the profiles, as the editors send them. Fields the
+// protocol package does not model are left out.
+var profiles = map[Profile]struct {
+	info         protocol.ClientInfo
+	capabilities string
+}{
+	ProfileMinimal: {protocol.ClientInfo{Name: "lspgo-client"}, `{}`},
+	ProfileVSCode: {protocol.ClientInfo{Name: "Visual Studio Code", Version: "1.95.0"}, `{
+		"workspace": {
+			"applyEdit": true,
+			"workspaceEdit": {
+				"documentChanges": true,
+				"resourceOperations": ["create", "rename", "delete"],
+				"failureHandling": "textOnlyTransactional",
+				"changeAnnotationSupport": {"groupsOnLabel": true}
+			},
+			"didChangeConfiguration": {"dynamicRegistration": true},
+			"didChangeWatchedFiles": {"dynamicRegistration": true},
+			"symbol": {
+				"dynamicRegistration": true,
+				"symbolKind": {"valueSet": [1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25,26]},
+				"tagSupport": {"valueSet": [1]},
+				"resolveSupport": {"properties": ["location.range"]}
+			},
+			"configuration": true
+		},
+		"textDocument": {
+			"synchronization": {"didSave": true, "willSave": true, "willSaveWaitUntil": true},
+			"completion": {
+				"dynamicRegistration": true,
+				"completionItem": {"snippetSupport": true, "documentationFormat": ["markdown", "plaintext"]},
+				"completionItemKind": {"valueSet": [1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25]}
+			},
+			"hover": {"dynamicRegistration": true, "contentFormat": ["markdown", "plaintext"]},
+			"definition": {"dynamicRegistration": true, "linkSupport": true},
+			"declaration": {"dynamicRegistration": true, "linkSupport": true},
+			"typeDefinition": {"dynamicRegistration": true, "linkSupport": true},
+			"implementation": {"dynamicRegistration": true, "linkSupport": true},
+			"codeAction": {
+				"dynamicRegistration": true,
+				"codeActionLiteralSupport": {"codeActionKind": {"valueSet": ["", "quickfix", "refactor", "refactor.extract", "refactor.inline", "refactor.rewrite", "source", "source.organizeImports"]}},
+				"resolveSupport": {"properties": ["edit"]},
+				"isPreferredSupport": true,
+				"disabledSupport": true,
+				"honorsChangeAnnotations": true
+			},
+			"rename": {"dynamicRegistration": true, "prepareSupport": true, "prepareSupportDefaultBehavior": 1, "honorsChangeAnnotations": true},
+			"formatting": {"dynamicRegistration": true},
+			"rangeFormatting": {"dynamicRegistration": true},
+			"publishDiagnostics": {"versionSupport": true, "tagSupport": {"valueSet": [1, 2]}},
+			"documentSymbol": {
+				"dynamicRegistration": true,
+				"symbolKind": {"valueSet": [1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25,26]},
+				"tagSupport": {"valueSet": [1]}
+			}
+		},
+		"window": {
+			"workDoneProgress": true,
+			"showDocument": {"support": true},
+			"showMessage": {"messageActionItem": {"additionalPropertiesSupport": true}}
+		}
+	}`},
+	ProfileNeovim: {protocol.ClientInfo{Name: "Neovim", Version: "0.10.0"}, `{
+		"workspace": {
+			"applyEdit": true,
+			"workspaceEdit": {"documentChanges": true, "resourceOperations": ["rename", "create", "delete"]},
+			"didChangeConfiguration": {"dynamicRegistration": false},
+			"didChangeWatchedFiles": {"dynamicRegistration": true},
+			"symbol": {
+				"dynamicRegistration": false,
+				"symbolKind": {"valueSet": [1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25,26]}
+			},
+			"configuration": true
+		},
+		"textDocument": {
+			"synchronization": {"didSave": true, "willSave": true, "willSaveWaitUntil": true},
+			"completion": {
+				"completionItem": {"snippetSupport": false, "documentationFormat": ["markdown", "plaintext"]},
+				"completionItemKind": {"valueSet": [1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25]}
+			},
+			"hover": {"contentFormat": ["markdown", "plaintext"]},
+			"definition": {"linkSupport": true},
+			"declaration": {"linkSupport": true},
+			"typeDefinition": {"linkSupport": true},
+			"implementation": {"linkSupport": true},
+			"codeAction": {
+				"codeActionLiteralSupport": {"codeActionKind": {"valueSet": ["", "quickfix", "refactor", "refactor.extract", "refactor.inline", "refactor.rewrite", "source", "source.organizeImports"]}},
+				"resolveSupport": {"properties": ["edit"]},
+				"isPreferredSupport": true
+			},
+			"rename": {"prepareSupport": true},
+			"publishDiagnostics": {"tagSupport": {"valueSet": [1, 2]}},
+			"documentSymbol": {
+				"symbolKind": {"valueSet": [1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16,17,18,19,20,21,22,23,24,25,26]}
+			}
+		},
+		"window": {"workDoneProgress": true, "showDocument": {"support": true}}
+	}`},
+}
+
+// Capabilities returns the client capabilities of the profile.
+func (p Profile) Capabilities() (protocol.ClientCapabilities, error) {
+	profile, ok := profiles[p]
+	if !ok {
+		return protocol.ClientCapabilities{}, fmt.Errorf("unknown client profile %q", p)
+	}
+	var caps protocol.ClientCapabilities
+	if err := json.Unmarshal([]byte(profile.capabilities), &caps); err != nil {
+		return protocol.ClientCapabilities{}, fmt.Errorf("invalid capabilities of profile %s: %w", p, err)
+	}
+	return caps, nil
+}
+
+// InitializeBuilder builds the params of the initialize request, e.g.
+//
+//	params, err := client.NewInitializeBuilder().
+//		Profile(client.ProfileNeovim).
+//		WorkspaceFolder(dir).
+//		InitializationOptions(map[string]any{"lint": true}).
+//		Build()
+//	result, err := c.Initialize(ctx, params)
+//
+// Errors are reported by Build.
+type InitializeBuilder struct {
+	params protocol.InitializeParams
+	err    error
+}
+
+// NewInitializeBuilder creates a builder of a client with ProfileMinimal.
+func NewInitializeBuilder() *InitializeBuilder {
+	b := &InitializeBuilder{}
+	return b.Profile(ProfileMinimal)
+}
+
+// Profile replaces the capabilities and the client info with the ones of p.
+func (b *InitializeBuilder) Profile(p Profile) *InitializeBuilder {
+	caps, err := p.Capabilities()
+	if err != nil {
+		b.err = errors.Join(b.err, err)
+		return b
+	}
+	info := profiles[p].info
+	b.params.Capabilities = caps
+	b.params.ClientInfo = &info
+	return b
+}
+
+// Capabilities changes the capabilities in place, after the profile, e.g. to remove one.
+func (b *InitializeBuilder) Capabilities(fn func(caps *protocol.ClientCapabilities)) *InitializeBuilder {
+	fn(&b.params.Capabilities)
+	return b
+}
+
+// ClientInfo sets the name and version of the client.
+func (b *InitializeBuilder) ClientInfo(name, version string) *InitializeBuilder {
+	b.params.ClientInfo = &protocol.ClientInfo{Name: name, Version: version}
+	return b
+}
+
+// WorkspaceFolder adds a workspace folder at path, named after its base name. The first
+// folder is the root too, for servers reading rootUri.
+func (b *InitializeBuilder) WorkspaceFolder(path string) *InitializeBuilder {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		b.err = errors.Join(b.err, fmt.Errorf("invalid workspace folder %s: %w", path, err))
+		return b
+	}
+	uri := protocol.URIFromPath(abs)
+	b.params.WorkspaceFolders = append(b.params.WorkspaceFolders, protocol.WorkspaceFolder{URI: string(uri), Name: filepath.Base(abs)})
+	if b.params.RootURI == nil {
+		b.params.RootURI = &uri
+	}
+	return b
+}
+
+// InitializationOptions sets the initializationOptions, v is encoded to JSON.
+func (b *InitializeBuilder) InitializationOptions(v any) *InitializeBuilder {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.err = errors.Join(b.err, fmt.Errorf("invalid initialization options: %w", err))
+		return b
+	}
+	b.params.InitializationOptions = data
+	return b
+}
+
+// Trace sets the initial trace level.
+func (b *InitializeBuilder) Trace(level protocol.TraceValue) *InitializeBuilder {
+	b.params.Trace = level
+	return b
+}
+
+// Build returns the params, or the errors of the builder calls.
+func (b *InitializeBuilder) Build() (*protocol.InitializeParams, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	params := b.params
+	return &params, nil
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrUnsupported is returned for namespaces and methods the server did not advertise.
+var ErrUnsupported = errors.New("not supported by the server")
+
+// Namespace is a stub calling the custom methods of a namespace advertised by the server
+// (see server.DeclareNamespace). Its methods are those the server listed at initialization,
+// calls to others fail without reaching the server.
+type Namespace struct {
+	c      *Client
+	prefix string
+	info   protocol.NamespaceInfo
+}
+
+// Namespace returns the stub of the namespace prefix (e.g. "ollama/") advertised by the
+// server. It must be called after Initialize.
+func (c *Client) Namespace(prefix string) (*Namespace, error) {
+	result := c.InitializeResult()
+	if result == nil {
+		return nil, fmt.Errorf("namespace %s: client not initialized", prefix)
+	}
+	advertised, ok := result.Capabilities.Experimental[protocol.ExperimentalNamespaces]
+	if !ok {
+		return nil, fmt.Errorf("namespace %s: %w", prefix, ErrUnsupported)
+	}
+	// Experimental capabilities are decoded as generic values
+	raw, err := json.Marshal(advertised)
+	if err != nil {
+		return nil, fmt.Errorf("namespace %s: %w", prefix, err)
+	}
+	var namespaces map[string]protocol.NamespaceInfo
+	if err := json.Unmarshal(raw, &namespaces); err != nil {
+		return nil, fmt.Errorf("namespace %s: invalid %s capability: %w", prefix, protocol.ExperimentalNamespaces, err)
+	}
+	info, ok := namespaces[prefix]
+	if !ok {
+		return nil, fmt.Errorf("namespace %s: %w", prefix, ErrUnsupported)
+	}
+	// Methods outside the namespace are ignored, they can't be called through it
+	info.Methods = slices.DeleteFunc(info.Methods, func(method string) bool {
+		return !strings.HasPrefix(method, prefix)
+	})
+	return &Namespace{c: c, prefix: prefix, info: info}, nil
+}
+
+// Version returns the version of the namespace advertised by the server.
+func (n *Namespace) Version() string {
+	return n.info.Version
+}
+
+// Methods returns the methods of the namespace, without their prefix.
+func (n *Namespace) Methods() []string {
+	names := make([]string, 0, len(n.info.Methods))
+	for _, method := range n.info.Methods {
+		if name, ok := strings.CutPrefix(method, n.prefix); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// method returns the full name of a method, or an error if the server does not support it.
+func (n *Namespace) method(name string) (string, error) {
+	method := n.prefix + name
+	if !slices.Contains(n.info.Methods, method) {
+		return "", fmt.Errorf("method %s (namespace version %s): %w", method, n.info.Version, ErrUnsupported)
+	}
+	return method, nil
+}
+
+// Call sends the request name (without prefix) of the namespace, see Client.Call.
+func (n *Namespace) Call(ctx context.Context, name string, params any, result any) error {
+	method, err := n.method(name)
+	if err != nil {
+		return err
+	}
+	return n.c.Call(ctx, method, params, result)
+}
+
+// Notify sends the notification name (without prefix) of the namespace.
+func (n *Namespace) Notify(ctx context.Context, name string, params any) error {
+	method, err := n.method(name)
+	if err != nil {
+		return err
+	}
+	return n.c.Notify(ctx, method, params)
+}
@@ -0,0 +1,17 @@
+package client
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// TestNamespaceMethodsOutsidePrefix checks methods listed without the prefix of the
+// namespace, some shorter than it, are skipped instead of panicking.
+func TestNamespaceMethodsOutsidePrefix(t *testing.T) {
+	n := &Namespace{prefix: "ollama/", info: protocol.NamespaceInfo{Methods: []string{"x", "other/generate", "ollama/generate"}}}
+	if got, want := n.Methods(), []string{"generate"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// sink dispatches the notifications of one kind to its subscribers.
+type sink[T any] struct {
+	mu   sync.Mutex
+	next int
+	subs map[int]func(T)
+}
+
+// subscribe adds fn to the subscribers, until cancel is called.
+func (s *sink[T]) subscribe(fn func(T)) (cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.subs == nil {
+		s.subs = make(map[int]func(T))
+	}
+	id := s.next
+	s.next++
+	s.subs[id] = fn
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.subs, id)
+	}
+}
+
+func (s *sink[T]) publish(v T) {
+	s.mu.Lock()
+	subs := make([]func(T), 0, len(s.subs))
+	for _, fn := range s.subs {
+		subs = append(subs, fn)
+	}
+	s.mu.Unlock()
+	for _, fn := range subs {
+		fn(v)
+	}
+}
+
+// Diagnostics are the diagnostics published by the server for a document.
+type Diagnostics struct {
+	protocol.PublishDiagnosticsParams
+	// DocumentVersion is the version the diagnostics are for: the version published by the
+	// server, or for servers not publishing versions, the last version the client sent before
+	// receiving them. 0 for documents not opened with Open or OpenFile.
+	DocumentVersion int
+}
+
+// OnDiagnostics calls fn with the diagnostics the server publishes for uri, or for all
+// documents when uri is empty, until cancel is called.
+// Like the other sinks, fn is called by the read loop in the order the server sent the
+// notifications, it must not block nor wait for the server.
+func (c *Client) OnDiagnostics(uri protocol.DocumentURI, fn func(Diagnostics)) (cancel func()) {
+	return c.diagnosticsSink.subscribe(func(d Diagnostics) {
+		if uri == "" || d.URI == uri {
+			fn(d)
+		}
+	})
+}
+
+// OnShowMessage calls fn with the window/showMessage notifications, until cancel is called.
+func (c *Client) OnShowMessage(fn func(protocol.ShowMessageParams)) (cancel func()) {
+	return c.showMessageSink.subscribe(fn)
+}
+
+// OnLogMessage calls fn with the window/logMessage notifications, until cancel is called.
+func (c *Client) OnLogMessage(fn func(protocol.LogMessageParams)) (cancel func()) {
+	return c.logMessageSink.subscribe(fn)
+}
+
+// OnProgress calls fn with the $/progress notifications, until cancel is called.
+func (c *Client) OnProgress(fn func(protocol.ProgressParams)) (cancel func()) {
+	return c.progressSink.subscribe(fn)
+}
+
+// LastDiagnostics returns the last diagnostics published for uri.
+func (c *Client) LastDiagnostics(uri protocol.DocumentURI) (Diagnostics, bool) {
+	c.diagnosticsMu.Lock()
+	defer c.diagnosticsMu.Unlock()
+	d, ok := c.diagnostics[uri]
+	return d, ok
+}
+
+// WaitForDiagnostics returns the diagnostics of uri for version or a later one, waiting up
+// to timeout for the server to publish them. Diagnostics already received are returned
+// immediately, and when several are published before the wait returns, the latest. Use
+// the version returned by Text after an Edit to wait for the diagnostics of the edited text.
+func (c *Client) WaitForDiagnostics(uri protocol.DocumentURI, version int, timeout time.Duration) (Diagnostics, error) {
+	ch := make(chan Diagnostics, 1)
+	cancel := c.OnDiagnostics(uri, func(d Diagnostics) {
+		if d.DocumentVersion >= version {
+			replaceLatest(ch, d)
+		}
+	})
+	defer cancel()
+
+	// Subscribed first, diagnostics published meanwhile are not missed
+	if d, ok := c.LastDiagnostics(uri); ok && d.DocumentVersion >= version {
+		return d, nil
+	}
+	return wait(c, ch, timeout, fmt.Sprintf("diagnostics of %s (version %d)", uri, version))
+}
+
+// replaceLatest puts v in ch, a channel of capacity 1 sent to by the read loop only,
+// replacing the value still waiting there: the waiter gets the latest one.
+func replaceLatest[T any](ch chan T, v T) {
+	select {
+	case <-ch:
+	default:
+	}
+	ch <- v // Room was made above, and no one else sends
+}
+
+// WaitForShowMessage returns the next window/showMessage notification match accepts, nil
+// accepts all, waiting up to timeout.
+func (c *Client) WaitForShowMessage(match func(protocol.ShowMessageParams) bool, timeout time.Duration) (protocol.ShowMessageParams, error) {
+	ch := make(chan protocol.ShowMessageParams, 1)
+	cancel := c.OnShowMessage(func(p protocol.ShowMessageParams) {
+		if match != nil && !match(p) {
+			return
+		}
+		select {
+		case ch <- p:
+		default:
+		}
+	})
+	defer cancel()
+	return wait(c, ch, timeout, "window/showMessage")
+}
+
+// WaitForProgressEnd waits up to timeout for the end of the work done progress token, and
+// returns the message ending it.
+func (c *Client) WaitForProgressEnd(token protocol.ProgressToken, timeout time.Duration) (protocol.WorkDoneProgressEnd, error) {
+	ch := make(chan protocol.WorkDoneProgressEnd, 1)
+	cancel := c.OnProgress(func(p protocol.ProgressParams) {
+		if p.Token != token {
+			return
+		}
+		var end protocol.WorkDoneProgressEnd
+		if err := json.Unmarshal(p.Value, &end); err != nil || end.Kind != "end" {
+			return
+		}
+		select {
+		case ch <- end:
+		default:
+		}
+	})
+	defer cancel()
+	return wait(c, ch, timeout, fmt.Sprintf("end of progress %s", token))
+}
+
+// wait returns the first value received on ch, or an error when the timeout expires or the
+// connection closes first.
+func wait[T any](c *Client, ch <-chan T, timeout time.Duration, what string) (T, error) {
+	var zero T
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case v := <-ch:
+		return v, nil
+	case <-timer.C:
+		return zero, fmt.Errorf("waiting for %s: %w after %s", what, context.DeadlineExceeded, timeout)
+	case <-c.done:
+		return zero, fmt.Errorf("waiting for %s: %w: %v", what, ErrClosed, c.readErr)
+	}
+}
+
+// observe feeds the sinks with a notification of the server, before its handler is called.
+func (c *Client) observe(method string, params json.RawMessage) {
+	switch method {
+	case protocol.MethodTextDocumentPublishDiagnostics:
+		var p protocol.PublishDiagnosticsParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			c.logger.Printf("Invalid %s params: %v", method, err)
+			return
+		}
+		d := Diagnostics{PublishDiagnosticsParams: p}
+		if p.Version != nil {
+			d.DocumentVersion = *p.Version
+		} else if v, ok := c.sentVersions.Load(p.URI); ok {
+			d.DocumentVersion = v.(int)
+		}
+		c.diagnosticsMu.Lock()
+		c.diagnostics[p.URI] = d
+		c.diagnosticsMu.Unlock()
+		c.diagnosticsSink.publish(d)
+	case protocol.MethodWindowShowMessage:
+		var p protocol.ShowMessageParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			c.logger.Printf("<-- Message (%s): %s", p.Type, p.Message)
+			c.showMessageSink.publish(p)
+		}
+	case protocol.MethodWindowLogMessage:
+		var p protocol.LogMessageParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			c.logger.Printf("<-- Log (%s): %s", p.Type, p.Message)
+			c.logMessageSink.publish(p)
+		}
+	case protocol.MethodProgress:
+		var p protocol.ProgressParams
+		if err := json.Unmarshal(params, &p); err == nil {
+			c.progressSink.publish(p)
+		}
+	}
+}
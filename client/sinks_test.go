@@ -0,0 +1,23 @@
+package client
+
+import "testing"
+
+func TestReplaceLatest(t *testing.T) {
+	ch := make(chan Diagnostics, 1)
+	for version := 1; version <= 3; version++ {
+		replaceLatest(ch, Diagnostics{DocumentVersion: version})
+	}
+	if d := <-ch; d.DocumentVersion != 3 {
+		t.Errorf("got the diagnostics of version %d, want the latest, 3", d.DocumentVersion)
+	}
+	select {
+	case d := <-ch:
+		t.Errorf("older diagnostics of version %d still queued", d.DocumentVersion)
+	default:
+	}
+
+	replaceLatest(ch, Diagnostics{DocumentVersion: 4}) // Once taken, sent as is
+	if d := <-ch; d.DocumentVersion != 4 {
+		t.Errorf("got version %d, want 4", d.DocumentVersion)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// demoSettings is the shape of the settings of the demo:
+//
+//	{"demo": {"dynamicFeatures": false}}
+//
+// Turning dynamicFeatures off unregisters the file watchers and the formatting provider,
+// turning it back on registers them again.
+type demoSettings struct {
+	DynamicFeatures *bool `json:"dynamicFeatures,omitempty"`
+}
+
+// dynamicFeatures demonstrates the dynamic registration of capabilities: a watcher of the
+// *.mylang files and a formatting provider registered once the client is initialized,
+// and unregistered when the settings turn them off.
+type dynamicFeatures struct {
+	s *server.Server
+
+	mu            sync.Mutex // Serializes the registrations, they wait on the client
+	enabled       bool
+	registrations []protocol.Registration // Registered with the client, to unregister them
+}
+
+func newDynamicFeatures(s *server.Server) *dynamicFeatures {
+	return &dynamicFeatures{s: s, enabled: true}
+}
+
+// register enables the features with the client, the ones the client can't register
+// dynamically were advertised in the initialize result instead.
+func (f *dynamicFeatures) register(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.registrations) > 0 {
+		return // Already registered
+	}
+
+	watch, err := f.s.WatchFiles(ctx, protocol.FileSystemWatcher{GlobPattern: "**/*.mylang"})
+	switch {
+	case errors.Is(err, server.ErrDynamicRegistrationUnsupported):
+		log.Printf("Client can't watch files")
+	case err != nil:
+		log.Printf("Error watching files: %v", err)
+	default:
+		f.registrations = append(f.registrations, watch)
+	}
+
+	if f.s.ClientCapabilities().SupportsDynamicRegistration(protocol.MethodTextDocumentFormatting) {
+		registered, err := f.s.RegisterCapability(ctx, protocol.Registration{
+			Method: protocol.MethodTextDocumentFormatting,
+			RegisterOptions: protocol.DocumentFormattingRegistrationOptions{
+				TextDocumentRegistrationOptions: protocol.TextDocumentRegistrationOptions{
+					DocumentSelector: protocol.DocumentSelector{{Language: "mylang"}},
+				},
+			},
+		})
+		if err != nil {
+			log.Printf("Error registering formatting: %v", err)
+		} else {
+			f.registrations = append(f.registrations, registered...)
+		}
+	}
+	for _, r := range f.registrations {
+		log.Printf("Registered %s (%s)", r.Method, r.ID)
+	}
+}
+
+// unregister disables the features registered with the client.
+func (f *dynamicFeatures) unregister(ctx context.Context) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.registrations) == 0 {
+		return
+	}
+	if err := f.s.UnregisterCapability(ctx, f.registrations...); err != nil {
+		log.Printf("Error unregistering features: %v", err)
+		return // Still registered, try again on the next change
+	}
+	for _, r := range f.registrations {
+		log.Printf("Unregistered %s (%s)", r.Method, r.ID)
+	}
+	f.registrations = nil
+}
+
+// handleDidChangeConfiguration registers or unregisters the features when the
+// dynamicFeatures setting changed.
+func (f *dynamicFeatures) handleDidChangeConfiguration(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
+	var settings demoSettings
+	found, err := params.Section("demo", &settings)
+	if err != nil {
+		log.Printf("Ignoring the demo settings: %v", err)
+		return nil
+	}
+	if !found || settings.DynamicFeatures == nil {
+		return nil // Not for us
+	}
+
+	f.mu.Lock()
+	f.enabled = *settings.DynamicFeatures
+	f.mu.Unlock()
+	if *settings.DynamicFeatures {
+		f.register(ctx)
+	} else {
+		f.unregister(ctx)
+	}
+	return nil
+}
+
+// handleFormatting removes the trailing whitespace of the lines. Clients which got the
+// formatting capability statically can't have it unregistered, it does nothing once the
+// features are turned off.
+func (f *dynamicFeatures) handleFormatting(ctx context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+	f.mu.Lock()
+	enabled := f.enabled
+	f.mu.Unlock()
+	snapshot, ok := server.SnapshotFromContext(ctx)
+	if !enabled || !ok {
+		return nil, nil
+	}
+	lines := strings.Split(snapshot.Text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return textdocument.ComputeEdits(snapshot.Text, strings.Join(lines, "\n")), nil
+}
+
+// filesChanged logs the changes of the watched files.
+func (f *dynamicFeatures) filesChanged(ctx context.Context, changes []protocol.FileEvent) {
+	for _, change := range changes {
+		log.Printf("Watched file changed: %s (type %d)", change.URI, change.Type)
+	}
+}
@@ -15,7 +15,8 @@ func main() {
 	// defer cancel()
 
 	// Create server instance (defaults to stdin/stdout)
-	lspServer := server.NewServer()
+	// Formatting is registered dynamically by the clients supporting it, see dynamic.go
+	lspServer := server.NewServer(server.WithDynamicRegistration(protocol.MethodTextDocumentFormatting))
 
 	// Register handlers for the methods your server supports
 	// (beyond the built-in initialize, shutdown, exit)
@@ -31,6 +32,19 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to register hover handler: %v", err)
 	}
+
+	// Capabilities registered once initialized, and unregistered by the settings
+	features := newDynamicFeatures(lspServer)
+	err = lspServer.Register(protocol.MethodTextDocumentFormatting, features.handleFormatting)
+	if err != nil {
+		log.Fatalf("Failed to register formatting handler: %v", err)
+	}
+	err = lspServer.Register(protocol.MethodWorkspaceDidChangeConfiguration, features.handleDidChangeConfiguration)
+	if err != nil {
+		log.Fatalf("Failed to register didChangeConfiguration handler: %v", err)
+	}
+	lspServer.OnInitialized(features.register)
+	lspServer.OnFilesChanged(features.filesChanged)
 	// Add more handlers: completion, definition, diagnostics etc.
 
 	log.Println("Starting LSP server...")
@@ -76,31 +90,30 @@ func handleDidChange(ctx context.Context, params *protocol.DidChangeTextDocument
 func handleHover(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
 	log.Printf("Hover Request: %s at (%d, %d)", params.TextDocument.URI, params.Position.Line, params.Position.Character)
 
-	// --- Dummy Implementation ---
-	// TODO: Replace with actual logic:
-	// 1. Get document content for params.TextDocument.URI
-	// 2. Find the token/symbol at params.Position
-	// 3. Look up information about that symbol
-	// 4. Format the information as Markdown or PlainText
+	// The server keeps the open documents, the handler gets the snapshot of the hovered one
+	snapshot, ok := server.SnapshotFromContext(ctx)
+	if !ok {
+		return nil, nil // Document not open
+	}
+	// Find the token/symbol at params.Position, with the word characters of the language
+	word, hoverRange, ok := snapshot.WordAt(params.Position)
+	if !ok {
+		return nil, nil // Nothing to show between words
+	}
 
+	// TODO: Replace with actual logic: look up information about that symbol
 	// Example: Return fixed hover content
 	content := protocol.MarkupContent{
 		Kind: protocol.Markdown, // Or protocol.PlainText
-		Value: fmt.Sprintf("## Hover Info\n\nDocument: `%s`\nPosition: Line %d, Char %d\n\n*Provide real information here!*",
+		Value: fmt.Sprintf("## Hover Info\n\nSymbol: `%s`\nDocument: `%s`\nPosition: Line %d, Char %d\n\n*Provide real information here!*",
+			word,
 			params.TextDocument.URI,
 			params.Position.Line,
 			params.Position.Character),
 	}
 
-	// Determine the range of the symbol being hovered over (optional but good)
-	// Dummy range for example:
-	hoverRange := protocol.Range{
-		Start: params.Position,
-		End:   protocol.Position{Line: params.Position.Line, Character: params.Position.Character + 5}, // Example range
-	}
-
 	return &protocol.Hover{
 		Contents: content,
-		Range:    &hoverRange, // Optional: The range this hover applies to
+		Range:    &hoverRange, // Optional: The range this hover applies to, highlighted by clients
 	}, nil // No error
 }
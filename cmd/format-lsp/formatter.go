@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// commandFor returns the formatter command line for a language.
+func commandFor(languageID protocol.LanguageID) string {
+	key := "FORMAT_COMMAND_" + strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, string(languageID))
+	return getEnv(key, formatCommand)
+}
+
+// format runs the formatter of the document language on its text. The command is split
+// on spaces, without a shell, {file} is replaced with the document path, {tabSize} and
+// {insertSpaces} with the formatting options of the request.
+func format(ctx context.Context, doc *textdocument.Snapshot, options protocol.FormattingOptions) (string, error) {
+	args := strings.Fields(commandFor(doc.LanguageID))
+	if len(args) == 0 {
+		return "", errors.New("no formatter command configured")
+	}
+	path, err := doc.URI.Path()
+	if err != nil {
+		path = "" // Unsaved documents have no path
+	}
+	replacer := strings.NewReplacer(
+		"{file}", path,
+		"{tabSize}", strconv.FormatUint(uint64(options.TabSize), 10),
+		"{insertSpaces}", strconv.FormatBool(options.InsertSpaces),
+	)
+	for i := range args {
+		args[i] = replacer.Replace(args[i])
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, formatTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(doc.Text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("%s timed out after %s", args[0], formatTimeout)
+		}
+		// Formatters report syntax errors on stderr, it is the useful part
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("%s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
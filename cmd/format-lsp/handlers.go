@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// formatEdits runs the formatter on the document and returns the edits to apply.
+func formatEdits(ctx context.Context, uri protocol.DocumentURI, options protocol.FormattingOptions) ([]protocol.TextEdit, error) {
+	doc, ok := server.SnapshotFromContext(ctx)
+	if !ok {
+		return nil, jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf("document not open: %s", uri))
+	}
+
+	formatted, err := format(ctx, doc, options)
+	if err != nil {
+		log.Printf("Formatting %s failed: %v", uri, err)
+		return nil, jsonrpc2.NewError(jsonrpc2.RequestFailed, err.Error())
+	}
+	if formatted == "" && doc.Text != "" {
+		// Rather than erasing the document, assume the formatter misbehaved
+		return nil, jsonrpc2.NewError(jsonrpc2.RequestFailed, "formatter returned an empty document")
+	}
+
+	edits := textdocument.ComputeEdits(doc.Text, formatted)
+	log.Printf("Formatting %s (Version: %d): %d edits", uri, doc.Version, len(edits))
+	return edits, nil
+}
+
+// handleFormatting formats the whole document.
+func handleFormatting(ctx context.Context, params *protocol.DocumentFormattingParams) ([]protocol.TextEdit, error) {
+	return formatEdits(ctx, params.TextDocument.URI, params.Options)
+}
+
+// handleRangeFormatting formats the whole document, formatters rarely work on fragments,
+// and only keeps the edits touching the requested range.
+func handleRangeFormatting(ctx context.Context, params *protocol.DocumentRangeFormattingParams) ([]protocol.TextEdit, error) {
+	edits, err := formatEdits(ctx, params.TextDocument.URI, params.Options)
+	if err != nil {
+		return nil, err
+	}
+	inRange := []protocol.TextEdit{}
+	for _, edit := range edits {
+		if overlaps(edit.Range, params.Range) {
+			inRange = append(inRange, edit)
+		}
+	}
+	return inRange, nil
+}
+
+// overlaps reports whether two ranges share a position, ends included.
+func overlaps(a, b protocol.Range) bool {
+	return !before(a.End, b.Start) && !before(b.End, a.Start)
+}
+
+func before(a, b protocol.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
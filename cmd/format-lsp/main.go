@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+var (
+	// Formatter command reading the document on stdin and writing it formatted on stdout,
+	// FORMAT_COMMAND_<LANGUAGEID> overrides it for a language, e.g. FORMAT_COMMAND_JAVASCRIPT.
+	formatCommand = getEnv("FORMAT_COMMAND", "gofmt")
+	// A formatter running longer than this is killed
+	formatTimeout = getDurationEnv("FORMAT_TIMEOUT", 10*time.Second)
+)
+
+// The server tracks open documents, handlers get them with server.SnapshotFromContext
+var lspServer *server.Server
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s: %v", key, value, fallback, err)
+		return fallback
+	}
+	return d
+}
+
+func main() {
+	ctx := context.Background()
+	logger := log.New(os.Stderr, "[format-lsp] ", log.LstdFlags|log.Lshortfile)
+
+	lspServer = server.NewServer(server.WithLogger(logger))
+
+	// Typed handlers, called without reflection
+	mustRegister(server.HandleRequest(lspServer, protocol.MethodTextDocumentFormatting, handleFormatting))
+	mustRegister(server.HandleRequest(lspServer, protocol.MethodTextDocumentRangeFormatting, handleRangeFormatting))
+
+	log.Println("Starting format LSP server...")
+	log.Printf("Formatter: %q, timeout: %s", formatCommand, formatTimeout)
+
+	if err := lspServer.Run(ctx); err != nil {
+		logger.Fatalf("Server error: %v", err)
+	}
+	logger.Println("Server stopped.")
+}
+
+func mustRegister(err error) {
+	if err != nil {
+		log.Fatalf("Failed to register handler: %v", err)
+	}
+}
@@ -3,19 +3,32 @@ package main
 import (
 	"context"
 	"log"
-	"sync"
 	"time"
 
 	"github.com/akhenakh/lspgo/jsonrpc2"
 	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
 )
 
-// Debounce logic
-var (
-	debounceTimers = make(map[protocol.DocumentURI]*time.Timer)
-	debounceMu     sync.Mutex
-	debounceDelay  = 500 * time.Millisecond // Adjust as needed
-)
+// debounceDelay is how long checks wait for the user to stop typing.
+var debounceDelay = 500 * time.Millisecond // Adjust as needed
+
+// checks runs one check per document at a time, a newer version cancels the check in
+// progress, see server.Debouncer.
+var checks *server.Debouncer[protocol.DocumentURI]
+
+// checkLatest returns the check of the latest version of a document, run by checks.
+func checkLatest(conn *jsonrpc2.Conn, uri protocol.DocumentURI) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		docMu.RLock()
+		docItem, ok := documents[uri]
+		docMu.RUnlock()
+		if !ok {
+			return // Closed meanwhile
+		}
+		checkDocumentAndSendDiagnostics(ctx, conn, docItem)
+	}
+}
 
 // handleDidOpen stores the document and triggers an initial check.
 func handleDidOpen(ctx context.Context, conn *jsonrpc2.Conn, params *protocol.DidOpenTextDocumentParams) error {
@@ -25,8 +38,8 @@ func handleDidOpen(ctx context.Context, conn *jsonrpc2.Conn, params *protocol.Di
 	docMu.Unlock()
 	log.Printf("Document Opened: %s (Version: %d, LangID: %s)", docItem.URI, docItem.Version, docItem.LanguageID)
 
-	// Trigger initial check asynchronously
-	go checkDocumentAndSendDiagnostics(context.Background(), conn, docItem) // Use background context for async task
+	// Trigger initial check asynchronously, it outlives the notification, not the server
+	checks.TriggerNow(docItem.URI, checkLatest(conn, docItem.URI))
 	return nil
 }
 
@@ -55,38 +68,10 @@ func handleDidChange(ctx context.Context, conn *jsonrpc2.Conn, params *protocol.
 		log.Printf("Document Changed: %s (Version %d) - Updated existing", params.TextDocument.URI, params.TextDocument.Version)
 	}
 	documents[params.TextDocument.URI] = item
-	currentDocItem := item // Capture current state for debounce closure
 	docMu.Unlock()
 
-	// --- Debounce Logic ---
-	debounceMu.Lock()
-	uri := params.TextDocument.URI
-	if timer, exists := debounceTimers[uri]; exists {
-		timer.Stop() // Cancel previous timer
-	}
-	// Create a new timer
-	debounceTimers[uri] = time.AfterFunc(debounceDelay, func() {
-		log.Printf("Debounce timer fired for %s", uri)
-		// Remove timer from map *before* running check to avoid race if check is fast
-		debounceMu.Lock()
-		delete(debounceTimers, uri)
-		debounceMu.Unlock()
-
-		// Re-fetch the *latest* document state in case of rapid changes
-		// Although currentDocItem *might* be slightly stale, it's often good enough
-		// and avoids complex locking across the async call.
-		// For max accuracy, re-fetch:
-		// docMu.RLock()
-		// latestDocItem, latestOk := documents[uri]
-		// docMu.RUnlock()
-		// if latestOk { go checkDocumentAndSendDiagnostics(context.Background(), conn, latestDocItem) }
-
-		// Simpler: Use the state captured when the timer was set.
-		go checkDocumentAndSendDiagnostics(context.Background(), conn, currentDocItem)
-
-	})
-	debounceMu.Unlock()
-	// --- End Debounce Logic ---
+	// A check of the previous version is cancelled, the latest one runs once typing stops
+	checks.Trigger(params.TextDocument.URI, checkLatest(conn, params.TextDocument.URI))
 
 	return nil
 }
@@ -102,7 +87,7 @@ func handleDidChange(ctx context.Context, conn *jsonrpc2.Conn, params *protocol.
 // 	}
 //  log.Printf("Document Saved: %s", params.TextDocument.URI)
 // 	// Optionally trigger check on save
-// 	go checkDocumentAndSendDiagnostics(context.Background(), conn, docItem)
+// 	go checkDocumentAndSendDiagnostics(lspServer.BackgroundContext(), conn, docItem)
 // 	return nil
 // }
 
@@ -111,20 +96,26 @@ func handleDidClose(ctx context.Context, conn *jsonrpc2.Conn, params *protocol.D
 	uri := params.TextDocument.URI
 	docMu.Lock()
 	delete(documents, uri)
+	delete(languages, uri)
 	docMu.Unlock()
 
-	// Cancel any pending debounce timer for this document
-	debounceMu.Lock()
-	if timer, exists := debounceTimers[uri]; exists {
-		timer.Stop()
-		delete(debounceTimers, uri)
-	}
-	debounceMu.Unlock()
+	// Cancel the pending or running check of this document
+	checks.Cancel(uri)
 
 	log.Printf("Document Closed: %s", uri)
 
 	// Clear diagnostics for the closed file
-	go protocol.SendDiagnostics(context.Background(), conn, uri, []protocol.Diagnostic{})
+	go protocol.SendDiagnostics(lspServer.BackgroundContext(), conn, uri, []protocol.Diagnostic{})
 
 	return nil
 }
+
+// handleCodeAction offers to ignore the LanguageTool diagnostics of the request and to
+// rewrite the selected sentence.
+func handleCodeAction(ctx context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	var actions []protocol.CodeAction
+	if params.Context.Accepts(protocol.QuickFix) {
+		actions = ignoreActions(params.TextDocument.URI, params.Context.Diagnostics)
+	}
+	return append(actions, rewriteActions(ctx, params)...), nil
+}
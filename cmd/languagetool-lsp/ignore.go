@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// commandIgnore suppresses a match, once or for its whole rule in the file.
+const commandIgnore = "languagetool/ignore"
+
+// ignoreFileName is the file of the workspace saving the suppressions, with
+// LANGUAGETOOL_WORKSPACE_IGNORES set.
+const ignoreFileName = ".languagetool-ignore.json"
+
+// languageToolWorkspaceIgnores saves the suppressions in the workspace when "true", they are
+// only kept in memory otherwise.
+var languageToolWorkspaceIgnores = getEnv("LANGUAGETOOL_WORKSPACE_IGNORES", "") == "true"
+
+// matchData identifies a match in the data of its diagnostic. Offsets change as the document
+// is edited, an occurrence is identified by the matched text in its sentence instead.
+type matchData struct {
+	Rule     string `json:"rule"`
+	Text     string `json:"text"`
+	Sentence string `json:"sentence"`
+}
+
+// fileIgnores are the suppressions of a file.
+type fileIgnores struct {
+	Rules       []string    `json:"rules,omitempty"`
+	Occurrences []matchData `json:"occurrences,omitempty"`
+}
+
+// ignoreArgs is the argument of commandIgnore.
+type ignoreArgs struct {
+	URI   protocol.DocumentURI `json:"uri"`
+	Match matchData            `json:"match"`
+	// InFile ignores the rule in the whole file, not only this occurrence.
+	InFile bool `json:"inFile,omitempty"`
+}
+
+// ignores are the suppressions of all files, safe for concurrent use. Files are keyed by
+// their canonical URI, the client may encode it differently from URIFromPath.
+var ignores = struct {
+	sync.Mutex
+	files map[protocol.DocumentURI]*fileIgnores
+	path  string // ignoreFileName in the workspace, empty when not saved
+	root  string
+}{files: make(map[protocol.DocumentURI]*fileIgnores)}
+
+// isIgnored reports whether a match of a document was suppressed.
+func isIgnored(uri protocol.DocumentURI, match matchData) bool {
+	ignores.Lock()
+	defer ignores.Unlock()
+	f, ok := ignores.files[uri.Canonical()]
+	return ok && (slices.Contains(f.Rules, match.Rule) || slices.Contains(f.Occurrences, match))
+}
+
+// addIgnore records a suppression and saves it when the ignores are saved in the workspace.
+func addIgnore(args ignoreArgs) error {
+	ignores.Lock()
+	defer ignores.Unlock()
+	uri := args.URI.Canonical()
+	f, ok := ignores.files[uri]
+	if !ok {
+		f = &fileIgnores{}
+		ignores.files[uri] = f
+	}
+	switch {
+	case args.InFile && !slices.Contains(f.Rules, args.Match.Rule):
+		f.Rules = append(f.Rules, args.Match.Rule)
+	case !args.InFile && !slices.Contains(f.Occurrences, args.Match):
+		f.Occurrences = append(f.Occurrences, args.Match)
+	}
+	return saveIgnores()
+}
+
+// loadIgnores reads the ignore file of the workspace at root.
+func loadIgnores(root string) {
+	ignores.Lock()
+	defer ignores.Unlock()
+	ignores.root = root
+	ignores.path = filepath.Join(root, ignoreFileName)
+	data, err := os.ReadFile(ignores.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read %s: %v", ignores.path, err)
+		return
+	}
+	var saved struct {
+		Files map[string]*fileIgnores `json:"files"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("Ignoring invalid %s: %v", ignores.path, err)
+		return
+	}
+	for rel, f := range saved.Files {
+		ignores.files[protocol.URIFromPath(filepath.Join(root, filepath.FromSlash(rel))).Canonical()] = f
+	}
+	log.Printf("Loaded the suppressions of %d files from %s", len(saved.Files), ignores.path)
+}
+
+// saveIgnores writes the suppressions of the files in the workspace, ignores is locked.
+// Files outside the workspace are only ignored in memory.
+func saveIgnores() error {
+	if ignores.path == "" {
+		return nil
+	}
+	saved := struct {
+		Files map[string]*fileIgnores `json:"files"`
+	}{Files: make(map[string]*fileIgnores)}
+	for uri, f := range ignores.files {
+		path, err := uri.Path()
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(ignores.root, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		saved.Files[filepath.ToSlash(rel)] = f
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(ignores.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to save the suppressions: %w", err)
+	}
+	return nil
+}
+
+// ignoreActions returns the actions suppressing the LanguageTool diagnostics of the request.
+func ignoreActions(uri protocol.DocumentURI, diagnostics []protocol.Diagnostic) []protocol.CodeAction {
+	var actions []protocol.CodeAction
+	for _, d := range diagnostics {
+		var match matchData
+		if !strings.HasPrefix(d.Source, "languagetool") || json.Unmarshal(d.Data, &match) != nil || match.Rule == "" {
+			continue
+		}
+		for _, inFile := range []bool{false, true} {
+			title := fmt.Sprintf("Ignore %q here", match.Text)
+			if inFile {
+				title = fmt.Sprintf("Ignore rule %s in this file", match.Rule)
+			}
+			args, _ := json.Marshal(ignoreArgs{URI: uri, Match: match, InFile: inFile})
+			actions = append(actions, protocol.CodeAction{
+				Title:       title,
+				Kind:        protocol.QuickFix,
+				Diagnostics: []protocol.Diagnostic{d},
+				Command:     &protocol.Command{Title: title, Command: commandIgnore, Arguments: []json.RawMessage{args}},
+			})
+		}
+	}
+	return actions
+}
+
+// handleIgnoreCommand is the handler of commandIgnore, the document is checked again without
+// the suppressed matches.
+func handleIgnoreCommand(ctx context.Context, conn *jsonrpc2.Conn, args *ignoreArgs) (interface{}, error) {
+	if args == nil {
+		return nil, fmt.Errorf("missing arguments for command %s", commandIgnore)
+	}
+	if err := addIgnore(*args); err != nil {
+		log.Println(err)
+		protocol.ShowNotification(ctx, conn, protocol.Warning, fmt.Sprintf("The suppression only lasts until the server stops: %v", err))
+	}
+	checks.TriggerNow(args.URI, checkLatest(conn, args.URI))
+	return nil, nil
+}
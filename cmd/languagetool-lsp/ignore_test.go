@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// TestIgnoresMatchEncodedURIs checks the suppressions apply to a file whatever the encoding
+// of the URI the client sends, once saved and loaded again too.
+func TestIgnoresMatchEncodedURIs(t *testing.T) {
+	root := t.TempDir()
+	t.Cleanup(func() {
+		ignores.files = make(map[protocol.DocumentURI]*fileIgnores)
+		ignores.path, ignores.root = "", ""
+	})
+	reset := func() {
+		ignores.files = make(map[protocol.DocumentURI]*fileIgnores)
+		loadIgnores(root)
+	}
+	reset()
+
+	plain := protocol.URIFromPath(filepath.Join(root, "notes.txt"))
+	encoded := protocol.DocumentURI("file://" + filepath.ToSlash(root) + "/%6Eotes%2Etxt") // "notes.txt"
+	rule := matchData{Rule: "PASSIVE_VOICE", Text: "was written", Sentence: "It was written."}
+	if err := addIgnore(ignoreArgs{URI: encoded, Match: rule, InFile: true}); err != nil {
+		t.Fatal(err)
+	}
+	if !isIgnored(plain, rule) || !isIgnored(encoded, rule) {
+		t.Error("rule not ignored for both encodings of the URI")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, ignoreFileName)); err != nil {
+		t.Fatalf("suppressions not saved: %v", err)
+	}
+	reset()
+	if !isIgnored(encoded, rule) {
+		t.Error("loaded rule not ignored for the URI sent by the client")
+	}
+	if isIgnored(encoded, matchData{Rule: "OTHER"}) {
+		t.Error("other rule ignored")
+	}
+}
@@ -13,15 +13,32 @@ import (
 
 	"github.com/akhenakh/lspgo/jsonrpc2"
 	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
 )
 
 var (
 	languageToolURL     = getEnv("LANGUAGETOOL_URL", "http://localhost:8081/v2/check") // Default local URL
 	languageToolTimeout = 10 * time.Second
-	// TODO: Make language configurable (e.g., via init options or env var)
-	defaultLanguage = "en-US"
+	// defaultLanguage is the language the documents are checked in, "auto" lets LanguageTool
+	// detect it.
+	defaultLanguage = getEnv("LANGUAGETOOL_LANGUAGE", "en-US")
 )
 
+// languages are the languages the open documents were last checked in, as reported by
+// LanguageTool, so detected ones are known. Protected by docMu.
+var languages = make(map[protocol.DocumentURI]string)
+
+// documentLanguage returns the language of a document for LanguageTool: the one of its last
+// check, defaultLanguage before the first one.
+func documentLanguage(uri protocol.DocumentURI) string {
+	docMu.RLock()
+	defer docMu.RUnlock()
+	if lang, ok := languages[uri]; ok {
+		return lang
+	}
+	return defaultLanguage
+}
+
 // Structs for LanguageTool API Response
 // See: https://languagetool.org/http-api/swagger-ui/#!/default/post_check
 type LanguageToolResponse struct {
@@ -54,8 +71,8 @@ type Match struct {
 	Message      string        `json:"message"`
 	ShortMessage string        `json:"shortMessage"`
 	Replacements []Replacement `json:"replacements"`
-	Offset       int           `json:"offset"` // Byte offset
-	Length       int           `json:"length"` // Byte length
+	Offset       int           `json:"offset"` // UTF-16 offset, see matchOffsets
+	Length       int           `json:"length"` // UTF-16 length
 	Context      ContextInfo   `json:"context"`
 	Sentence     string        `json:"sentence"`
 	Type         TypeInfo      `json:"type"`
@@ -91,8 +108,9 @@ type CategoryInfo struct {
 	Name string `json:"name"`
 }
 
-// callLanguageTool sends text to the LT API and returns the parsed response.
-func callLanguageTool(ctx context.Context, text string, language string) (*LanguageToolResponse, error) {
+// callLanguageTool sends text to the LT API and returns the parsed response. The level is
+// "picky" to enable the additional style rules, empty for the default ones.
+func callLanguageTool(ctx context.Context, text string, language string, level string) (*LanguageToolResponse, error) {
 	if text == "" {
 		return &LanguageToolResponse{Matches: []Match{}}, nil // No errors for empty text
 	}
@@ -117,6 +135,9 @@ func callLanguageTool(ctx context.Context, text string, language string) (*Langu
 	formData := url.Values{}
 	formData.Set("text", text)
 	formData.Set("language", language)
+	if level != "" {
+		formData.Set("level", level)
+	}
 	// Add other parameters if needed (e.g., disabledRules, enabledRules)
 	// formData.Set("disabledRules", "...")
 
@@ -167,17 +188,43 @@ func callLanguageTool(ctx context.Context, text string, language string) (*Langu
 	return &ltResponse, nil
 }
 
-// convertMatchesToDiagnostics converts LanguageTool matches to LSP diagnostics.
-func convertMatchesToDiagnostics(content string, matches []Match) []protocol.Diagnostic {
+// matchOffsets returns the byte offsets of a match in the text. LanguageTool is written in
+// Java, its offsets and lengths count UTF-16 code units, like LSP characters but from the
+// start of the text.
+func matchOffsets(mapper *textdocument.Mapper, match Match) (start, end int, err error) {
+	start, err = mapper.FromUTF16Offset(match.Offset)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err = mapper.FromUTF16Offset(match.Offset + match.Length)
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+// convertMatchesToDiagnostics converts LanguageTool matches to LSP diagnostics, leaving out
+// the matches ignored in the document.
+func convertMatchesToDiagnostics(uri protocol.DocumentURI, content string, matches []Match) []protocol.Diagnostic {
 	diagnostics := make([]protocol.Diagnostic, 0, len(matches))
+	mapper := textdocument.NewMapper(content)
 
 	for _, match := range matches {
-		rng, err := offsetLengthToRange(content, match.Offset, match.Length)
+		start, end, err := matchOffsets(mapper, match)
+		var rng protocol.Range
+		if err == nil {
+			rng, err = mapper.Range(start, end)
+		}
 		if err != nil {
 			log.Printf("Error converting offset/length to range for match '%s': %v", match.Message, err)
 			// Skip this diagnostic if range calculation fails
 			continue
 		}
+		data := matchData{Rule: match.Rule.ID, Text: content[start:end], Sentence: match.Sentence}
+		if isIgnored(uri, data) {
+			continue
+		}
+		dataJSON, _ := json.Marshal(data)
 
 		// Determine severity (heuristic)
 		severity := protocol.SeverityWarning // Default to warning
@@ -206,6 +253,7 @@ func convertMatchesToDiagnostics(content string, matches []Match) []protocol.Dia
 			Code:    json.RawMessage(codeJSON), // <<< FIXED HERE
 			Source:  fmt.Sprintf("languagetool (%s)", match.Rule.Category.Name),
 			Message: match.Message,
+			Data:    dataJSON, // Sent back by the client, identifies the match to ignore
 			// RelatedInformation, Tags etc. could be added if desired
 		}
 		diagnostics = append(diagnostics, diagnostic)
@@ -226,11 +274,21 @@ func checkDocumentAndSendDiagnostics(ctx context.Context, conn *jsonrpc2.Conn, d
 	// if docItem.LanguageID != "" { lang = mapLanguageID(docItem.LanguageID) }
 
 	log.Printf("Checking document: %s (Version: %d, Lang: %s)", docItem.URI, docItem.Version, lang)
-
-	ltResponse, err := callLanguageTool(ctx, docItem.Text, lang)
+	checksRunning.Add(1)
+	sendStatus(docItem, statusChecking, 0, "")
+
+	ltResponse, err := callLanguageTool(ctx, docItem.Text, lang, "")
+	checksRunning.Add(-1)
+	if ctx.Err() != nil {
+		// A newer version arrived or the document was closed, these results are stale
+		log.Printf("Check of %s (Version: %d) cancelled", docItem.URI, docItem.Version)
+		sendStatus(docItem, statusCancelled, 0, "")
+		return
+	}
 	if err != nil {
 		errMsg := fmt.Sprintf("LanguageTool check failed for %s: %v", docItem.URI, err)
 		log.Println(errMsg)
+		sendStatus(docItem, statusError, 0, err.Error())
 		// Show error to user?
 		protocol.ShowNotification(ctx, conn, protocol.Error, errMsg)
 		// Send empty diagnostics to clear previous errors from this server? Or keep stale ones?
@@ -239,6 +297,15 @@ func checkDocumentAndSendDiagnostics(ctx context.Context, conn *jsonrpc2.Conn, d
 		return
 	}
 
-	diagnostics := convertMatchesToDiagnostics(docItem.Text, ltResponse.Matches)
+	if code := ltResponse.Language.Code; code != "" {
+		docMu.Lock()
+		if _, open := documents[docItem.URI]; open {
+			languages[docItem.URI] = code
+		}
+		docMu.Unlock()
+	}
+
+	diagnostics := convertMatchesToDiagnostics(docItem.URI, docItem.Text, ltResponse.Matches)
 	protocol.SendDiagnostics(ctx, conn, docItem.URI, diagnostics)
+	sendStatus(docItem, statusDone, len(diagnostics), "")
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/segment"
+	"github.com/akhenakh/lspgo/server"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// commandRewrite rewrites a sentence, for clients which can't resolve code actions.
+const commandRewrite = "languagetool/rewrite"
+
+// maxRewrites is the number of rewrites offered for a sentence, and maxMatchRewrites the
+// number of replacements of a single match among them.
+const (
+	maxRewrites      = 8
+	maxMatchRewrites = 3
+)
+
+// rewriteArgs are the payload of the data of a rewrite code action, and of the argument of
+// commandRewrite: the sentence and its rewrite. The data records the document state, stale
+// rewrites are rejected.
+type rewriteArgs struct {
+	Range protocol.Range `json:"range"`
+	Text  string         `json:"text"`
+}
+
+// rewriteData is the data of a rewrite code action, and the argument of commandRewrite.
+type rewriteData = protocol.ActionData[rewriteArgs]
+
+// sentenceRewrites returns the alternative phrasings of sentence LanguageTool suggests in
+// matches, each applying one replacement.
+func sentenceRewrites(sentence string, matches []Match) []string {
+	mapper := textdocument.NewMapper(sentence)
+	seen := map[string]bool{sentence: true}
+	var rewrites []string
+	for _, match := range matches {
+		start, end, err := matchOffsets(mapper, match)
+		if err != nil {
+			continue
+		}
+		for i, replacement := range match.Replacements {
+			if i == maxMatchRewrites || len(rewrites) == maxRewrites {
+				break
+			}
+			rewrite := sentence[:start] + replacement.Value + sentence[end:]
+			if !seen[rewrite] {
+				seen[rewrite] = true
+				rewrites = append(rewrites, rewrite)
+			}
+		}
+	}
+	return rewrites
+}
+
+// rewriteActions offers the rewrites of the selected sentence, one action per rewrite.
+// LanguageTool has no public rephrasing endpoint, the rewrites are the suggestions of a
+// picky check of the sentence, which includes the style rules. The edit of the action the
+// user picks is only built then.
+func rewriteActions(ctx context.Context, params *protocol.CodeActionParams) []protocol.CodeAction {
+	if params.Range.Start == params.Range.End || !params.Context.Accepts(protocol.RefactorRewrite) {
+		return nil
+	}
+	docMu.RLock()
+	docItem, ok := documents[params.TextDocument.URI]
+	docMu.RUnlock()
+	if !ok {
+		return nil
+	}
+	sentence, ok := selectedSentence(docItem, params.Range)
+	if !ok {
+		return nil
+	}
+	text, err := selectedText(docItem, sentence)
+	if err != nil {
+		return nil
+	}
+
+	resp, err := callLanguageTool(ctx, text, documentLanguage(docItem.URI), "picky")
+	if err != nil {
+		log.Printf("Failed to find the rewrites of a sentence of %s: %v", docItem.URI, err)
+		return nil
+	}
+
+	mode := lspServer.CodeActionMode(true)
+	var actions []protocol.CodeAction
+	for _, rewrite := range sentenceRewrites(text, resp.Matches) {
+		args, err := protocol.NewActionData(docItem, rewriteArgs{Range: sentence, Text: rewrite})
+		if err != nil {
+			log.Printf("Failed to offer the rewrites of %s: %v", docItem.URI, err)
+			return nil
+		}
+		title := fmt.Sprintf("Rewrite: %s", rewrite)
+		action := protocol.CodeAction{Title: title, Kind: protocol.RefactorRewrite}
+		if mode == server.CodeActionResolveEdit {
+			action.Data = args // Edit built by handleCodeActionResolve
+		} else {
+			action.Command = &protocol.Command{Title: title, Command: commandRewrite, Arguments: []json.RawMessage{args}}
+		}
+		actions = append(actions, action)
+	}
+	return actions
+}
+
+// handleCodeActionResolve builds the edit of the rewrite the user picked.
+func handleCodeActionResolve(ctx context.Context, action *protocol.CodeAction) (*protocol.CodeAction, error) {
+	args, err := protocol.DecodeActionData[rewriteArgs](action.Data)
+	if err != nil {
+		return nil, err
+	}
+	edit, err := rewriteEdit(args)
+	if err != nil {
+		return nil, err
+	}
+	action.Edit = edit
+	return action, nil
+}
+
+// handleRewriteCommand is the handler of commandRewrite.
+func handleRewriteCommand(ctx context.Context, args *rewriteData) (interface{}, error) {
+	if args == nil {
+		return nil, fmt.Errorf("missing arguments for command %s", commandRewrite)
+	}
+	edit, err := rewriteEdit(*args)
+	if err != nil {
+		return nil, err
+	}
+	return nil, lspServer.ApplyEdit(ctx, "Rewrite", *edit)
+}
+
+// rewriteEdit returns the edit replacing the sentence with its rewrite, if the document did
+// not change since it was offered.
+func rewriteEdit(args rewriteData) (*protocol.WorkspaceEdit, error) {
+	docMu.RLock()
+	docItem, ok := documents[args.URI]
+	docMu.RUnlock()
+	if !ok {
+		return nil, jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf("document not open: %s", args.URI))
+	}
+	if err := args.Verify(docItem); err != nil {
+		return nil, err
+	}
+
+	edit, err := protocol.NewWorkspaceEditBuilder().
+		SetVersion(args.URI, args.Version).
+		Replace(args.URI, args.Payload.Range, args.Payload.Text).
+		Build(lspServer.ClientCapabilities().SupportsDocumentChanges())
+	if err != nil {
+		return nil, err
+	}
+	return &edit, nil
+}
+
+// selectedSentence returns the range of the sentence the selection rng is in, without the
+// whitespace around it. A selection spanning several sentences has none.
+func selectedSentence(docItem protocol.TextDocumentItem, rng protocol.Range) (protocol.Range, bool) {
+	mapper := textdocument.NewMapper(docItem.Text)
+	start, end, err := mapper.Offsets(rng)
+	if err != nil || start == end {
+		return protocol.Range{}, false
+	}
+	var found []segment.Segment
+	for _, sentence := range segment.Sentences(docItem.Text) {
+		if sentence.Start < end && sentence.End > start {
+			found = append(found, sentence)
+		}
+	}
+	if len(found) != 1 {
+		return protocol.Range{}, false
+	}
+	sentence, err := mapper.Range(found[0].Start, found[0].End)
+	return sentence, err == nil
+}
+
+// selectedText returns the text of a document in rng.
+func selectedText(docItem protocol.TextDocumentItem, rng protocol.Range) (string, error) {
+	start, end, err := textdocument.NewMapper(docItem.Text).Offsets(rng)
+	if err != nil {
+		return "", err
+	}
+	return docItem.Text[start:end], nil
+}
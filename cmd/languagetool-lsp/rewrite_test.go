@@ -0,0 +1,56 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+func TestSentenceRewrites(t *testing.T) {
+	sentence := "In order to win, we must try 😀 very hard."
+	matches := []Match{
+		{Offset: 0, Length: 11, Replacements: []Replacement{{Value: "To"}, {Value: "So as to"}}},
+		// Offsets count UTF-16 code units, the emoji counts 2
+		{Offset: 32, Length: 9, Replacements: []Replacement{{Value: "hard"}, {Value: "very hard"}}},
+		{Offset: 100, Length: 2, Replacements: []Replacement{{Value: "out of range"}}},
+	}
+	want := []string{
+		"To win, we must try 😀 very hard.",
+		"So as to win, we must try 😀 very hard.",
+		"In order to win, we must try 😀 hard.",
+	}
+	if got := sentenceRewrites(sentence, matches); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestSelectedSentence(t *testing.T) {
+	doc := protocol.TextDocumentItem{Text: "First one. Second 日本 one.\nThird."}
+	rng := func(startLine, startChar, endLine, endChar uint) protocol.Range {
+		return protocol.Range{
+			Start: protocol.Position{Line: startLine, Character: startChar},
+			End:   protocol.Position{Line: endLine, Character: endChar},
+		}
+	}
+	tests := []struct {
+		name string
+		sel  protocol.Range
+		want protocol.Range
+		ok   bool
+	}{
+		{"inside", rng(0, 12, 0, 15), rng(0, 11, 0, 25), true},
+		{"with the spaces around", rng(0, 10, 0, 26), rng(0, 11, 0, 25), true},
+		{"across sentences", rng(0, 5, 0, 15), protocol.Range{}, false},
+		{"empty", rng(0, 12, 0, 12), protocol.Range{}, false},
+		{"next line", rng(1, 0, 1, 6), rng(1, 0, 1, 6), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := selectedSentence(doc, tt.sel)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// methodStatus is the custom notification sent when a check starts and ends, for editor
+// plugins showing a status bar indicator. Clients which don't know it ignore it, as any
+// notification starting with "$/".
+const methodStatus = "$/languagetool/status"
+
+// experimentalStatus is the experimental capability advertising methodStatus:
+//
+//	"experimental": {"languagetoolStatus": {"notification": "$/languagetool/status"}}
+const experimentalStatus = "languagetoolStatus"
+
+// States of a check reported by methodStatus.
+const (
+	statusChecking  = "checking"
+	statusDone      = "done"
+	statusError     = "error"
+	statusCancelled = "cancelled" // A newer version is checked instead, or the document was closed
+)
+
+// statusParams are the params of methodStatus.
+type statusParams struct {
+	URI     protocol.DocumentURI `json:"uri"`
+	Version int                  `json:"version"`
+	State   string               `json:"state"`
+	// Diagnostics is the number of problems found, set when the state is done.
+	Diagnostics int `json:"diagnostics"`
+	// Checking is the number of documents being checked, including this one while checking.
+	Checking int64 `json:"checking"`
+	// Message describes the error of the error state.
+	Message string `json:"message,omitempty"`
+}
+
+// checksRunning counts the checks in progress, reported by methodStatus.
+var checksRunning atomic.Int64
+
+// declareStatus advertises methodStatus in the experimental capabilities.
+func declareStatus() {
+	if err := lspServer.DeclareExperimental(experimentalStatus, map[string]string{"notification": methodStatus}); err != nil {
+		log.Fatalf("Failed to declare the status notification: %v", err)
+	}
+}
+
+// sendStatus notifies the client of the state of the check of a document. Check contexts
+// are cancelled with the check, the notification uses the server one to be sent anyway.
+func sendStatus(docItem protocol.TextDocumentItem, state string, diagnostics int, message string) {
+	params := statusParams{
+		URI:         docItem.URI,
+		Version:     docItem.Version,
+		State:       state,
+		Diagnostics: diagnostics,
+		Checking:    checksRunning.Load(),
+		Message:     message,
+	}
+	if err := lspServer.Notify(lspServer.BackgroundContext(), methodStatus, params); err != nil {
+		log.Printf("Failed to send the status of %s: %v", docItem.URI, err)
+	}
+}
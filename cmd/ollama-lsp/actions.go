@@ -8,10 +8,12 @@ import (
 
 	"github.com/akhenakh/lspgo/jsonrpc2"
 	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
 )
 
-// executeContinueAction handles the "continue" action.
-func executeContinueAction(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) error {
+// continueEdit asks Ollama to continue the code at the cursor and returns the edit inserting
+// the continuation, nil when there is nothing to insert. Failures are notified to the user.
+func continueEdit(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) *protocol.WorkspaceEdit {
 	content := docItem.Text
 	docVersion := docItem.Version
 
@@ -23,6 +25,7 @@ Code Snippet:
 %s`, textBeforeCursor)
 
 	ollamaResult, err := callOllama(ctx, prompt)
+	audit.recordPrompt(args, docVersion, prompt, ollamaResult, err)
 	if err != nil {
 		errMsg := fmt.Sprintf("Ollama 'continue' request failed: %v", err)
 		log.Println(errMsg)
@@ -31,14 +34,36 @@ Code Snippet:
 	}
 
 	log.Printf("Ollama response received for action 'continue'")
+	line, column := getLineAndColumn(content, args.Position)
+	textToInsert := postProcessing.run(ollamaResult, insertion{
+		Context: textdocument.LF.Normalize(textBeforeCursor), // Compared with the lines of the model
+		Line:    line,
+		Column:  column,
+	})
+	// The model answers with "\n", the document may use "\r\n"
+	textToInsert = textdocument.DetectLineEnding(content).Normalize(textToInsert)
+	return ollamaContinuationEdit(ctx, conn, args.URI, docVersion, args.Position, textToInsert)
+}
+
+// executeContinueAction handles the "continue" action.
+func executeContinueAction(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) error {
+	edit := continueEdit(ctx, conn, args, docItem)
+	if edit == nil {
+		return nil
+	}
+	annotate := lspServer.ClientCapabilities().SupportsChangeAnnotations()
+	if edit = confirmLargeEdit(ctx, conn, args, docItem.Version, *edit, annotate); edit == nil {
+		return nil
+	}
 
 	// Apply the continuation edit
-	err = applyOllamaContinuation(ctx, conn, args.URI, docVersion, args.Position, ollamaResult)
+	err := lspServer.ApplyEdit(ctx, "Ollama Continuation", *edit)
+	audit.recordEdit(args, docItem.Version, *edit, editOutcome(err), err)
 	if err != nil {
 		log.Printf("Error applying Ollama continuation edit: %v", err)
 		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Failed to apply edit: %v", err))
 	} else {
-		log.Printf("Successfully requested 'workspace/applyEdit' for continuation")
+		log.Printf("Client applied the continuation edit")
 		protocol.ShowNotification(ctx, conn, protocol.Info, "Ollama continuation applied.")
 	}
 	return nil // Edit application outcome handled via notification
@@ -91,6 +116,7 @@ Selected Code with Line Numbers:
 %s`, numberedSelectedText)
 
 	ollamaResult, err := callOllama(ctx, prompt)
+	audit.recordPrompt(args, docItem.Version, prompt, ollamaResult, err)
 	if err != nil {
 		errMsg := fmt.Sprintf("Ollama 'explain' request failed: %v", err)
 		log.Println(errMsg)
@@ -117,7 +143,7 @@ Selected Code with Line Numbers:
 
 	// Split the *original* selected text into lines for proper line length calculations
 	// This text was already retrieved successfully earlier.
-	selectedLines := strings.Split(selectedText, "\n")
+	selectedLines := strings.Split(textdocument.LF.Normalize(selectedText), "\n")
 
 	// Create diagnostics from explanations
 	diagnostics := []protocol.Diagnostic{}
@@ -149,8 +175,10 @@ Selected Code with Line Numbers:
 	return nil // Diagnostics published successfully
 }
 
-// executePromptAction handles the "prompt" action.
-func executePromptAction(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) error {
+// promptEdit asks Ollama to replace the current line, used as an instruction, and returns the
+// edit replacing it, nil when there is nothing to apply. Failures are notified to the user,
+// an error is only returned for internal failures.
+func promptEdit(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) (*protocol.WorkspaceEdit, error) {
 	content := docItem.Text
 	docVersion := docItem.Version
 	lineNum := args.Position.Line // Line containing the instruction
@@ -160,25 +188,21 @@ func executePromptAction(ctx context.Context, conn *jsonrpc2.Conn, args OllamaAc
 		errMsg := fmt.Sprintf("Failed to get current line %d: %v", lineNum, err)
 		log.Println(errMsg)
 		protocol.ShowNotification(ctx, conn, protocol.Error, errMsg)
-		return fmt.Errorf("failed to get current line %d: %w", lineNum, err) // Return internal error
+		return nil, fmt.Errorf("failed to get current line %d: %w", lineNum, err) // Return internal error
 	}
 
 	trimmedCurrentLine := strings.TrimSpace(currentLine)
 	if trimmedCurrentLine == "" {
 		protocol.ShowNotification(ctx, conn, protocol.Warning, "Current line is empty. Please type a prompt/instruction first.")
-		return nil // User action needed, not an error
+		return nil, nil // User action needed, not an error
 	}
 
 	// --- Get context *before* the instruction line ---
 	// Use Character: 0 to get everything before the start of the line
-	textBeforePromptLine := getTextBeforePosition(content, protocol.Position{Line: lineNum, Character: 0})
-	// Remove the trailing newline that getTextBeforePosition might include from the previous line
-	textBeforePromptLine = strings.TrimSuffix(textBeforePromptLine, "\n")
-	// Ensure the context we check against later doesn't have leading/trailing whitespace issues
-	trimmedContextForPrompt := strings.TrimSpace(textBeforePromptLine)
-	// Use the potentially whitespace-preserved version in the prompt itself if needed,
-	// but use the trimmed one for comparison later. Let's use the original in the prompt.
-	// Note: Sending a lot of whitespace context might confuse the model less than trimmed.
+	contextBeforePromptLine := getTextBeforePosition(content, protocol.Position{Line: lineNum, Character: 0})
+	// Remove the line terminator of the previous line, "\n" or "\r\n"
+	contextBeforePromptLine = textdocument.LF.Normalize(contextBeforePromptLine)
+	textBeforePromptLine := strings.TrimSuffix(contextBeforePromptLine, "\n")
 
 	// Explicitly tell the model to ONLY generate the replacement for the instruction line
 	// and NOT to repeat the context snippet.
@@ -199,71 +223,50 @@ CODE SNIPPET (Context only - DO NOT INCLUDE THIS IN YOUR RESPONSE):
 		trimmedCurrentLine[:min(30, len(trimmedCurrentLine))]))
 
 	ollamaResult, err := callOllama(ctx, prompt)
+	audit.recordPrompt(args, docVersion, prompt, ollamaResult, err)
 	if err != nil {
 		errMsg := fmt.Sprintf("Ollama 'prompt' request failed: %v", err)
 		log.Println(errMsg)
 		protocol.ShowNotification(ctx, conn, protocol.Error, errMsg)
-		return nil // Error handled via notification
+		return nil, nil // Error handled via notification
 	}
 
 	log.Printf("Ollama response received for action 'prompt'. Raw length: %d", len(ollamaResult))
 
-	// --- Clean the result and remove potential context prefix ---
-	cleanedResult := cleanOllamaCodeResult(ollamaResult) // Remove markdown, trim space
-	log.Printf("Ollama response after initial cleaning. Length: %d", len(cleanedResult))
-
-	finalReplacementText := cleanedResult // Start with the initially cleaned result
-
-	// Check if the cleaned result starts with the context we sent (use the trimmed context for comparison)
-	// Only attempt removal if the context isn't empty
-	if len(trimmedContextForPrompt) > 0 {
-		// Normalize the start of the cleaned result for comparison too
-		trimmedResultStart := strings.TrimSpace(cleanedResult)
-
-		if strings.HasPrefix(trimmedResultStart, trimmedContextForPrompt) {
-			log.Printf("Attempting to remove potential context prefix from Ollama response.")
-
-			// Find the *actual* text to remove from the *original* cleanedResult.
-			// This is tricky because of potential whitespace differences.
-			// Let's try removing the length of the matched trimmed context from the
-			// beginning of the cleanedResult, AFTER trimming leading whitespace from it.
-			// This assumes the generated code starts immediately after the context (possibly with whitespace).
-
-			tempTrimmedResult := strings.TrimSpace(cleanedResult)
-			if len(tempTrimmedResult) >= len(trimmedContextForPrompt) {
-				potentialCodeStart := tempTrimmedResult[len(trimmedContextForPrompt):]
-				// Now, find where this potential code start appears in the original cleanedResult
-				// to preserve leading whitespace before the *actual* generated code.
-				index := strings.Index(cleanedResult, potentialCodeStart)
-				if index != -1 {
-					finalReplacementText = cleanedResult[index:]
-					log.Printf("Removed suspected context prefix. Final text length: %d", len(finalReplacementText))
-				} else {
-					// Fallback or warning: Couldn't reliably find the start after context
-					log.Printf("Warning: Detected context prefix but couldn't reliably isolate generated code. Using potentially prefixed result.")
-					// Keep finalReplacementText as cleanedResult in this uncertain case
-				}
-			} else {
-				log.Printf("Warning: Result shorter than context after trimming, cannot remove prefix.")
-			}
-		} else {
-			log.Printf("No context prefix detected in Ollama response based on trimmed comparison.")
-		}
-	}
-
-	// Final trim space just in case the removal left some
-	finalReplacementText = strings.TrimSpace(finalReplacementText)
+	// Strip markdown, the repeated context and indent the result like the instruction line
+	finalReplacementText := postProcessing.run(ollamaResult, insertion{
+		Context: contextBeforePromptLine,
+		Line:    currentLine,
+		Replace: true,
+	})
+	finalReplacementText = textdocument.DetectLineEnding(content).Normalize(finalReplacementText)
+	log.Printf("Ollama response after post-processing. Length: %d", len(finalReplacementText))
 
 	// Pass the original line content (including whitespace, but without trailing newline) for replacement calculation
-	originalLineForReplacement, _ := getCurrentLine(content, lineNum) // We already checked for error above
+	originalLineForReplacement := currentLine
+
+	// The line replacement edit uses the potentially context-stripped result
+	return ollamaLineReplacementEdit(ctx, conn, args.URI, docVersion, lineNum, originalLineForReplacement, finalReplacementText), nil
+}
+
+// executePromptAction handles the "prompt" action.
+func executePromptAction(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) error {
+	edit, err := promptEdit(ctx, conn, args, docItem)
+	if err != nil || edit == nil {
+		return err
+	}
+	annotate := lspServer.ClientCapabilities().SupportsChangeAnnotations()
+	if edit = confirmLargeEdit(ctx, conn, args, docItem.Version, *edit, annotate); edit == nil {
+		return nil
+	}
 
-	// Apply the line replacement edit using the potentially context-stripped result
-	err = applyOllamaLineReplacement(ctx, conn, args.URI, docVersion, lineNum, originalLineForReplacement, finalReplacementText)
+	err = lspServer.ApplyEdit(ctx, "Ollama Prompt Response", *edit)
+	audit.recordEdit(args, docItem.Version, *edit, editOutcome(err), err)
 	if err != nil {
 		log.Printf("Error applying Ollama line replacement: %v", err)
 		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Failed to apply edit: %v", err))
 	} else {
-		log.Printf("Successfully requested 'workspace/applyEdit' for line replacement")
+		log.Printf("Client applied the line replacement edit")
 		protocol.ShowNotification(ctx, conn, protocol.Info, "Ollama prompt result applied.")
 	}
 	return nil // Edit application outcome handled via notification
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// commandOpenAuditLog opens the audit log in the editor, registered with OLLAMA_AUDIT_LOG.
+const commandOpenAuditLog = "ollama/openAuditLog"
+
+// Audit entry events.
+const (
+	auditPrompt = "prompt" // A prompt sent to Ollama, with its response
+	auditEdit   = "edit"   // An edit computed from a response, with its outcome
+)
+
+// Audit edit outcomes.
+const (
+	auditApplied  = "applied"
+	auditRejected = "rejected"
+	auditResolved = "resolved"
+	auditDeclined = "declined" // A large edit the user didn't confirm, see confirmLargeEdit
+	auditBlocked  = "blocked"  // Not sent, the server is read-only
+)
+
+// auditEntry is a line of the audit log, one JSON object per line.
+type auditEntry struct {
+	Time    time.Time            `json:"time"`
+	URI     protocol.DocumentURI `json:"uri"`
+	Version int                  `json:"version"`
+	Action  string               `json:"action"` // continue, explain or prompt
+	Event   string               `json:"event"`  // auditPrompt or auditEdit
+	Model   string               `json:"model"`
+
+	Prompt   string `json:"prompt,omitempty"`
+	Response string `json:"response,omitempty"` // Raw response, before post-processing
+
+	Edit *protocol.WorkspaceEdit `json:"edit,omitempty"`
+	// Outcome of the edit: applied, rejected, declined, or resolved, sent to the client
+	// resolving the code action, which applies it without telling the server
+	Outcome string `json:"outcome,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// auditLog appends the prompts sent to Ollama and the edits applied to a JSONL file, so users
+// can review what was changed and why. A nil *auditLog records nothing.
+type auditLog struct {
+	path string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// audit is the audit log, nil unless OLLAMA_AUDIT_LOG is set.
+var audit *auditLog
+
+// openAuditLog opens the log at path for appending, creating it if needed.
+func openAuditLog(path string) (*auditLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &auditLog{path: path, file: file}, nil
+}
+
+// record appends an entry. Failures are logged, auditing never fails an action.
+func (a *auditLog) record(entry auditEntry) {
+	if a == nil {
+		return
+	}
+	entry.Time = time.Now().UTC()
+	entry.Model = ollamaModel
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Failed to encode audit entry: %v", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(data, '\n')); err != nil {
+		log.Printf("Failed to write audit log %s: %v", a.path, err)
+	}
+}
+
+// recordPrompt records a prompt sent for an action on a document, and the response or error.
+func (a *auditLog) recordPrompt(args OllamaActionArgs, version int, prompt, response string, err error) {
+	entry := auditEntry{URI: args.URI, Version: version, Action: args.Action, Event: auditPrompt, Prompt: prompt, Response: response}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.record(entry)
+}
+
+// recordEdit records an edit and its outcome, err being the failure to apply it.
+func (a *auditLog) recordEdit(args OllamaActionArgs, version int, edit protocol.WorkspaceEdit, outcome string, err error) {
+	entry := auditEntry{URI: args.URI, Version: version, Action: args.Action, Event: auditEdit, Edit: &edit, Outcome: outcome}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	a.record(entry)
+}
+
+// editOutcome returns the outcome of an edit sent with ApplyEdit, failing with err.
+func editOutcome(err error) string {
+	if errors.Is(err, server.ErrReadOnly) {
+		return auditBlocked
+	}
+	if err != nil {
+		return auditRejected
+	}
+	return auditApplied
+}
+
+// openAuditLogAction returns the code action opening the audit log.
+func openAuditLogAction() protocol.CodeAction {
+	return protocol.CodeAction{
+		Title: "Ollama: Open audit log",
+		Kind:  protocol.Source,
+		Command: &protocol.Command{
+			Title:   "Ollama: Open audit log",
+			Command: commandOpenAuditLog,
+		},
+	}
+}
+
+// handleOpenAuditLog is the handler of the "ollama/openAuditLog" command, it asks the client
+// to show the log. Clients which can't are told where it is.
+func handleOpenAuditLog(ctx context.Context, conn *jsonrpc2.Conn) (interface{}, error) {
+	err := lspServer.ShowDocument(ctx, protocol.ShowDocumentParams{
+		URI:       protocol.URIFromPath(audit.path),
+		TakeFocus: true,
+	})
+	if errors.Is(err, server.ErrShowDocumentUnsupported) {
+		protocol.ShowNotification(ctx, conn, protocol.Info, fmt.Sprintf("Ollama audit log: %s", audit.path))
+		return nil, nil
+	}
+	if err != nil {
+		log.Printf("Failed to show the audit log: %v", err)
+		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Failed to open the audit log %s: %v", audit.path, err))
+	}
+	return nil, nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/segment"
+	"github.com/akhenakh/lspgo/server"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// commentSyntax describes the comments of a language.
+type commentSyntax struct {
+	line   []string    // Markers of the comments running to the end of the line
+	block  [][2]string // Start and end markers of the block comments
+	quotes string      // Quotes of the string literals, skipped so "//" in a string isn't a comment
+}
+
+var (
+	cStyleComments    = commentSyntax{line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: "\"'`"}
+	hashComments      = commentSyntax{line: []string{"#"}, quotes: "\"'"}
+	dashComments      = commentSyntax{line: []string{"--"}, quotes: "\"'"}
+	markupComments    = commentSyntax{block: [][2]string{{"<!--", "-->"}}}
+	percentComments   = commentSyntax{line: []string{"%"}}
+	semicolonComments = commentSyntax{line: []string{";"}, quotes: "\""}
+)
+
+// commentSyntaxes are the languages whose comments can be translated.
+var commentSyntaxes = map[protocol.LanguageID]commentSyntax{
+	protocol.LanguageC:               cStyleComments,
+	protocol.LanguageCPP:             cStyleComments,
+	protocol.LanguageCSharp:          cStyleComments,
+	protocol.LanguageDart:            cStyleComments,
+	protocol.LanguageGo:              cStyleComments,
+	protocol.LanguageGroovy:          cStyleComments,
+	protocol.LanguageJava:            cStyleComments,
+	protocol.LanguageJavaScript:      cStyleComments,
+	protocol.LanguageJavaScriptReact: cStyleComments,
+	protocol.LanguageObjectiveC:      cStyleComments,
+	protocol.LanguageScala:           cStyleComments,
+	protocol.LanguageSwift:           cStyleComments,
+	protocol.LanguageTypeScript:      cStyleComments,
+	protocol.LanguageTypeScriptReact: cStyleComments,
+	protocol.LanguageCSS:             {block: [][2]string{{"/*", "*/"}}, quotes: "\"'"},
+	protocol.LanguageLess:            cStyleComments,
+	protocol.LanguageSCSS:            cStyleComments,
+	protocol.LanguagePHP:             {line: []string{"//", "#"}, block: [][2]string{{"/*", "*/"}}, quotes: "\"'"},
+	protocol.LanguageRust:            {line: []string{"//"}, block: [][2]string{{"/*", "*/"}}, quotes: "\""}, // ' starts lifetimes
+	protocol.LanguageDockerfile:      hashComments,
+	protocol.LanguageElixir:          hashComments,
+	protocol.LanguageMakefile:        hashComments,
+	protocol.LanguagePerl:            hashComments,
+	protocol.LanguagePowerShell:      hashComments,
+	protocol.LanguagePython:          hashComments,
+	protocol.LanguageR:               hashComments,
+	protocol.LanguageRuby:            hashComments,
+	protocol.LanguageShellScript:     hashComments,
+	protocol.LanguageYAML:            hashComments,
+	protocol.LanguageLua:             dashComments,
+	protocol.LanguageSQL:             {line: []string{"--"}, block: [][2]string{{"/*", "*/"}}, quotes: "\"'"},
+	protocol.LanguageHTML:            markupComments,
+	protocol.LanguageMarkdown:        markupComments,
+	protocol.LanguageXML:             markupComments,
+	protocol.LanguageLaTeX:           percentComments,
+	protocol.LanguageTeX:             percentComments,
+	protocol.LanguageClojure:         semicolonComments,
+	protocol.LanguageIni:             {line: []string{";", "#"}},
+}
+
+// findComments returns the text of the comments of a document, without their markers and
+// surrounding whitespace. Block comments give a segment per line, without the "*" starting
+// the lines of the doc comments. Directives (//go:build, #!/bin/sh) and comments without
+// letters (separators, commented out punctuation) are left out.
+func findComments(text string, syntax commentSyntax) []segment.Segment {
+	var comments []segment.Segment
+	for i := 0; i < len(text); {
+		if strings.IndexByte(syntax.quotes, text[i]) >= 0 {
+			i = skipString(text, i)
+			continue
+		}
+		if marker, ok := lineCommentAt(text[i:], syntax); ok {
+			start := i + len(marker)
+			end := strings.IndexByte(text[start:], '\n')
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += start
+			}
+			if !isDirective(text[start:end]) {
+				comments = appendComment(comments, text, start, end)
+			}
+			i = end
+			continue
+		}
+		if block, ok := blockCommentAt(text[i:], syntax); ok {
+			start := i + len(block[0])
+			end, next := len(text), len(text) // Unterminated, runs to the end
+			if n := strings.Index(text[start:], block[1]); n >= 0 {
+				end, next = start+n, start+n+len(block[1])
+			}
+			for lineStart := start; lineStart < end; {
+				lineEnd := strings.IndexByte(text[lineStart:end], '\n')
+				if lineEnd < 0 {
+					lineEnd = end
+				} else {
+					lineEnd += lineStart
+				}
+				s := lineStart
+				for s < lineEnd && (text[s] == ' ' || text[s] == '\t' || text[s] == '*') {
+					s++
+				}
+				comments = appendComment(comments, text, s, lineEnd)
+				lineStart = lineEnd + 1
+			}
+			i = next
+			continue
+		}
+		i++
+	}
+	return comments
+}
+
+// lineCommentAt returns the line comment marker text starts with.
+func lineCommentAt(text string, syntax commentSyntax) (string, bool) {
+	for _, marker := range syntax.line {
+		if strings.HasPrefix(text, marker) {
+			return marker, true
+		}
+	}
+	return "", false
+}
+
+// blockCommentAt returns the block comment markers text starts with.
+func blockCommentAt(text string, syntax commentSyntax) ([2]string, bool) {
+	for _, block := range syntax.block {
+		if strings.HasPrefix(text, block[0]) {
+			return block, true
+		}
+	}
+	return [2]string{}, false
+}
+
+// skipString returns the offset after the string literal starting at the quote text[i].
+// Strings stop at the end of the line, but backquoted ones which are raw strings in Go and
+// template literals in JavaScript.
+func skipString(text string, i int) int {
+	quote := text[i]
+	for i++; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == quote:
+			return i + 1
+		case c == '\\' && quote != '`':
+			i++ // Escaped character
+		case c == '\n' && quote != '`':
+			return i
+		}
+	}
+	return len(text)
+}
+
+// isDirective reports whether the body of a line comment is a directive for a tool rather
+// than prose: //go:generate, //nolint:errcheck, #!/usr/bin/env...
+func isDirective(body string) bool {
+	if body == "" || unicode.IsSpace(rune(body[0])) {
+		return false
+	}
+	word, _, _ := strings.Cut(body, " ")
+	return strings.HasPrefix(body, "!") || strings.Contains(word, ":")
+}
+
+// appendComment appends text[start:end] trimmed of whitespace, if it has letters.
+func appendComment(comments []segment.Segment, text string, start, end int) []segment.Segment {
+	for start < end && unicode.IsSpace(rune(text[start])) {
+		start++
+	}
+	for end > start && unicode.IsSpace(rune(text[end-1])) {
+		end--
+	}
+	if strings.IndexFunc(text[start:end], unicode.IsLetter) < 0 {
+		return comments
+	}
+	return append(comments, segment.Segment{Text: text[start:end], Start: start, End: end})
+}
+
+// commentsAction returns the action translating the comments of the selection, ok is false
+// when the comments of the language aren't known.
+func commentsAction(docItem protocol.TextDocumentItem, rng protocol.Range, mode server.CodeActionMode) (protocol.CodeAction, bool) {
+	if _, ok := commentSyntaxes[documentLanguage(docItem)]; !ok {
+		return protocol.CodeAction{}, false
+	}
+	args := OllamaActionArgs{Action: "translate-comments", URI: docItem.URI, Range: &rng}
+	title := fmt.Sprintf("Ollama: Translate comments to %s", ollamaCommentLanguage)
+	return editAction(docItem, title, protocol.RefactorRewrite, args, mode), true
+}
+
+// documentLanguage returns the language of a document, from its extension when the client
+// didn't tell.
+func documentLanguage(docItem protocol.TextDocumentItem) protocol.LanguageID {
+	if docItem.LanguageID != "" {
+		return docItem.LanguageID
+	}
+	return protocol.LanguageIDForURI(docItem.URI)
+}
+
+// commentsEdit asks Ollama to translate the comments of the selection to
+// OLLAMA_COMMENT_LANGUAGE and returns the edit replacing their text, nil when there is
+// nothing to change. The code and the comment markers are kept as is, the edits only touch
+// the words which changed. Failures are notified to the user.
+func commentsEdit(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) *protocol.WorkspaceEdit {
+	if args.Range == nil {
+		log.Println("Error: Range is nil for 'translate-comments' action")
+		protocol.ShowNotification(ctx, conn, protocol.Error, "Internal error: Missing range for translate-comments action.")
+		return nil
+	}
+	syntax, ok := commentSyntaxes[documentLanguage(docItem)]
+	if !ok {
+		protocol.ShowNotification(ctx, conn, protocol.Warning, fmt.Sprintf("Comments of %s documents aren't supported.", documentLanguage(docItem)))
+		return nil
+	}
+	selStart, selEnd, err := textdocument.NewMapper(docItem.Text).Offsets(*args.Range)
+	if err != nil {
+		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Invalid selection: %v", err))
+		return nil
+	}
+
+	// The whole document is scanned, the selection may start inside a string or a comment
+	var comments []segment.Segment
+	for _, c := range findComments(docItem.Text, syntax) {
+		if c.Start < selEnd && c.End > selStart {
+			comments = append(comments, c)
+		}
+	}
+	if len(comments) == 0 {
+		protocol.ShowNotification(ctx, conn, protocol.Warning, "No comments in the selection.")
+		return nil
+	}
+
+	texts := make([]string, len(comments))
+	for i, c := range comments {
+		texts[i] = c.Text
+	}
+	input, _ := json.Marshal(map[string][]string{"comments": texts})
+	prompt := fmt.Sprintf(`You are an expert technical translator. Translate each of the following source code comments to %s.
+Keep identifiers, code, URLs and the technical terms used as is, and keep comments already in %s unchanged.
+Format your response strictly as a JSON object containing only a "comments" array of strings, with exactly one
+translation per comment, in the same order. Respond ONLY with the JSON object.
+
+Comments:
+%s`, ollamaCommentLanguage, ollamaCommentLanguage, input)
+
+	ollamaResult, err := callOllama(ctx, prompt)
+	audit.recordPrompt(args, docItem.Version, prompt, ollamaResult, err)
+	if err != nil {
+		errMsg := fmt.Sprintf("Ollama 'translate-comments' request failed: %v", err)
+		log.Println(errMsg)
+		protocol.ShowNotification(ctx, conn, protocol.Error, errMsg)
+		return nil
+	}
+	translations, err := parseCommentsResponse(ollamaResult, len(comments))
+	if err != nil {
+		log.Printf("Error parsing the translated comments: %v", err)
+		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Failed to parse the translated comments: %v", err))
+		return nil
+	}
+
+	// Replaced from the last, the offsets of the comments before stay valid
+	translated := docItem.Text
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		translated = translated[:c.Start] + translations[i] + translated[c.End:]
+	}
+	edits := textdocument.ComputeEdits(docItem.Text, translated)
+	if len(edits) == 0 {
+		protocol.ShowNotification(ctx, conn, protocol.Info, fmt.Sprintf("The comments are already in %s.", ollamaCommentLanguage))
+		return nil
+	}
+	edit := createWorkspaceEdit(args.URI, docItem.Version, edits)
+	return &edit
+}
+
+// parseCommentsResponse decodes the translations of count comments. A comment is a line in
+// the document, the line breaks of the translations are replaced with spaces.
+func parseCommentsResponse(response string, count int) ([]string, error) {
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("could not find a JSON object in the response")
+	}
+	var result struct {
+		Comments []string `json:"comments"`
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &result); err != nil {
+		return nil, fmt.Errorf("invalid JSON format: %w", err)
+	}
+	if len(result.Comments) != count {
+		return nil, fmt.Errorf("got %d translations for %d comments", len(result.Comments), count)
+	}
+	for i, text := range result.Comments {
+		text = strings.Join(strings.Fields(text), " ")
+		if text == "" {
+			return nil, fmt.Errorf("empty translation of comment %d", i)
+		}
+		result.Comments[i] = text
+	}
+	return result.Comments, nil
+}
+
+// executeCommentsAction handles the "translate-comments" action.
+func executeCommentsAction(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) error {
+	edit := commentsEdit(ctx, conn, args, docItem)
+	if edit == nil {
+		return nil
+	}
+	annotate := lspServer.ClientCapabilities().SupportsChangeAnnotations()
+	if edit = confirmLargeEdit(ctx, conn, args, docItem.Version, *edit, annotate); edit == nil {
+		return nil
+	}
+
+	err := lspServer.ApplyEdit(ctx, "Ollama Comment Translation", *edit)
+	audit.recordEdit(args, docItem.Version, *edit, editOutcome(err), err)
+	if err != nil {
+		log.Printf("Error applying the translated comments: %v", err)
+		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Failed to apply edit: %v", err))
+	} else {
+		log.Printf("Client applied the translated comments")
+		protocol.ShowNotification(ctx, conn, protocol.Info, "Ollama comment translation applied.")
+	}
+	return nil
+}
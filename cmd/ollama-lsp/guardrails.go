@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// largeEditAnnotation annotates the edits exceeding the limits, for the client to confirm.
+const largeEditAnnotation protocol.ChangeAnnotationIdentifier = "ollama/large-edit"
+
+// editScope is the size of a workspace edit.
+type editScope struct {
+	Lines int // Lines inserted or replaced, whichever is larger for each edit
+	Files int // Documents touched
+}
+
+func (s editScope) String() string {
+	return fmt.Sprintf("%d lines in %d files", s.Lines, s.Files)
+}
+
+// exceedsLimits reports whether the edit is larger than OLLAMA_MAX_EDIT_LINES or
+// OLLAMA_MAX_EDIT_FILES, a limit of 0 or less is disabled.
+func (s editScope) exceedsLimits() bool {
+	return (ollamaMaxEditLines > 0 && s.Lines > ollamaMaxEditLines) ||
+		(ollamaMaxEditFiles > 0 && s.Files > ollamaMaxEditFiles)
+}
+
+// measureEdit returns the size of edit.
+func measureEdit(edit protocol.WorkspaceEdit) editScope {
+	files := make(map[protocol.DocumentURI]bool)
+	var scope editScope
+	add := func(uri protocol.DocumentURI, edits []protocol.TextEdit) {
+		for _, e := range edits {
+			replaced := int(e.Range.End.Line - e.Range.Start.Line)
+			if e.Range.Start != e.Range.End {
+				replaced++
+			}
+			inserted := 0
+			if e.NewText != "" {
+				inserted = strings.Count(e.NewText, "\n") + 1
+			}
+			scope.Lines += max(replaced, inserted)
+		}
+		files[uri] = true
+	}
+	for uri, edits := range edit.Changes {
+		add(uri, edits)
+	}
+	for _, change := range edit.DocumentChanges {
+		if change.TextDocumentEdit != nil {
+			add(change.URI(), change.TextDocumentEdit.Edits)
+		} else {
+			files[change.URI()] = true // A file created, renamed or deleted
+		}
+	}
+	scope.Files = len(files)
+	return scope
+}
+
+// confirmLargeEdit checks the size of an edit generated by Ollama before it is sent to the
+// client. Edits within the limits are returned as is. Larger ones need the user to confirm
+// them: with a change annotation when annotate is set, the client supporting it, otherwise
+// with a message. It returns nil when the user declined, the edit must not be sent.
+func confirmLargeEdit(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, version int, edit protocol.WorkspaceEdit, annotate bool) *protocol.WorkspaceEdit {
+	scope := measureEdit(edit)
+	if !scope.exceedsLimits() || lspServer.ReadOnly() {
+		return &edit // Read-only servers block it anyway, no need to ask
+	}
+
+	// Annotated edits are only allowed in documentChanges
+	if annotate && len(edit.Changes) == 0 {
+		log.Printf("Ollama edit changes %s, asking the client to confirm it", scope)
+		annotated := edit
+		annotated.ChangeAnnotations = map[protocol.ChangeAnnotationIdentifier]protocol.ChangeAnnotation{
+			largeEditAnnotation: {
+				Label:             "Ollama: large edit",
+				NeedsConfirmation: true,
+				Description:       fmt.Sprintf("Generated code changing %s", scope),
+			},
+		}
+		annotated.DocumentChanges = make([]protocol.DocumentChange, len(edit.DocumentChanges))
+		for i, change := range edit.DocumentChanges {
+			annotated.DocumentChanges[i] = annotateChange(change, largeEditAnnotation)
+		}
+		return &annotated
+	}
+
+	const apply = "Apply"
+	picked, err := lspServer.ShowMessageRequest(ctx, protocol.Warning,
+		fmt.Sprintf("Ollama (%s) wants to change %s. Apply the edit?", args.Action, scope), apply, "Cancel")
+	if err != nil {
+		log.Printf("Failed to confirm the Ollama edit, not applying it: %v", err)
+	}
+	if picked != apply {
+		audit.recordEdit(args, version, edit, auditDeclined, err)
+		protocol.ShowNotification(ctx, conn, protocol.Info, "Ollama edit cancelled.")
+		return nil
+	}
+	return &edit
+}
+
+// annotateChange returns a copy of change with its edits, or its resource operation,
+// annotated with id.
+func annotateChange(change protocol.DocumentChange, id protocol.ChangeAnnotationIdentifier) protocol.DocumentChange {
+	switch {
+	case change.TextDocumentEdit != nil:
+		textEdit := *change.TextDocumentEdit
+		textEdit.Edits = append([]protocol.TextEdit(nil), textEdit.Edits...)
+		for j := range textEdit.Edits {
+			textEdit.Edits[j].AnnotationID = id
+		}
+		return protocol.DocumentChange{TextDocumentEdit: &textEdit}
+	case change.CreateFile != nil:
+		op := *change.CreateFile
+		op.AnnotationID = id
+		return protocol.DocumentChange{CreateFile: &op}
+	case change.RenameFile != nil:
+		op := *change.RenameFile
+		op.AnnotationID = id
+		return protocol.DocumentChange{RenameFile: &op}
+	case change.DeleteFile != nil:
+		op := *change.DeleteFile
+		op.AnnotationID = id
+		return protocol.DocumentChange{DeleteFile: &op}
+	}
+	return change
+}
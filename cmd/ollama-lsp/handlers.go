@@ -8,6 +8,7 @@ import (
 
 	"github.com/akhenakh/lspgo/jsonrpc2"
 	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
 )
 
 func handleDidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) error {
@@ -61,7 +62,7 @@ func handleCodeAction(ctx context.Context, conn *jsonrpc2.Conn, params *protocol
 	log.Printf("Code Action Request: %s Range: %v", uri, params.Range)
 
 	docMu.RLock()
-	_, ok := documents[uri]
+	docItem, ok := documents[uri]
 	docMu.RUnlock()
 	if !ok {
 		log.Printf("Code Action: Document not found %s", uri)
@@ -70,23 +71,17 @@ func handleCodeAction(ctx context.Context, conn *jsonrpc2.Conn, params *protocol
 
 	var actions []protocol.CodeAction
 
+	// Generating code is slow, edits are only computed for the action the user picks: lazily
+	// with codeAction/resolve when the client supports it, by the command otherwise
+	mode := lspServer.CodeActionMode(true)
+
 	// --- Action 1: Continue ---
 	continueArgs := OllamaActionArgs{
 		Action:   "continue",
 		URI:      uri,
 		Position: params.Range.Start,
 	}
-	continueCmdArgs, _ := json.Marshal(continueArgs)
-
-	actions = append(actions, protocol.CodeAction{
-		Title: "Ollama: Continue...",
-		Kind:  protocol.RefactorInline, // Suggests inline code generation
-		Command: &protocol.Command{
-			Title:     "Ollama: Continue...",
-			Command:   "ollama/executeAction",
-			Arguments: []json.RawMessage{continueCmdArgs},
-		},
-	})
+	actions = append(actions, editAction(docItem, "Ollama: Continue...", protocol.RefactorInline, continueArgs, mode)) // Suggests inline code generation
 
 	// --- Action 2: Explain Selection (if there is a selection) ---
 	if params.Range.Start != params.Range.End {
@@ -102,7 +97,7 @@ func handleCodeAction(ctx context.Context, conn *jsonrpc2.Conn, params *protocol
 			Kind:  protocol.Source, // Source actions are often for analysis/refactoring without direct code change
 			Command: &protocol.Command{
 				Title:     "Ollama: Explain selection with diagnostics...",
-				Command:   "ollama/executeAction",
+				Command:   commandExecuteAction,
 				Arguments: []json.RawMessage{explainCmdArgs},
 			},
 		})
@@ -114,67 +109,156 @@ func handleCodeAction(ctx context.Context, conn *jsonrpc2.Conn, params *protocol
 		URI:      uri,
 		Position: params.Range.Start, // Use start of selection/cursor position
 	}
-	promptCmdArgs, _ := json.Marshal(promptArgs)
+	actions = append(actions, editAction(docItem, "Ollama: Use current line as prompt...", protocol.Source, promptArgs, mode)) // Similar to explain, source-level action
+
+	// --- Action 4: Translate the selection into a new file ---
+	if params.Range.Start != params.Range.End && lspServer.ClientCapabilities().SupportsResourceOperation(protocol.ResourceOperationCreate) {
+		if action, ok := translateAction(docItem, params.Range); ok {
+			actions = append(actions, action)
+		}
+	}
 
-	actions = append(actions, protocol.CodeAction{
-		Title: "Ollama: Use current line as prompt...",
-		Kind:  protocol.Source, // Similar to explain, source-level action
-		Command: &protocol.Command{
-			Title:     "Ollama: Use current line as prompt...",
-			Command:   "ollama/executeAction",
-			Arguments: []json.RawMessage{promptCmdArgs},
-		},
-	})
+	// --- Action 5: Translate the comments of the selection ---
+	if params.Range.Start != params.Range.End {
+		if action, ok := commentsAction(docItem, params.Range, mode); ok {
+			actions = append(actions, action)
+		}
+	}
+
+	if audit != nil {
+		actions = append(actions, openAuditLogAction())
+	}
 
+	// Clients filter with Only, e.g. to run source actions on save
+	actions = params.Context.FilterCodeActions(actions)
 	log.Printf("Offering %d code actions for %s", len(actions), uri)
 	return actions, nil
 }
 
-// --- Execute Command Handling ---
+// editAction returns a code action editing docItem, resolved lazily or running the action
+// command depending on mode. Resolved actions record the document state, see
+// handleCodeActionResolve.
+func editAction(docItem protocol.TextDocumentItem, title string, kind protocol.CodeActionKind, args OllamaActionArgs, mode server.CodeActionMode) protocol.CodeAction {
+	action := protocol.CodeAction{Title: title, Kind: kind}
+	if mode == server.CodeActionResolveEdit {
+		// Edit computed by handleCodeActionResolve
+		action.Data, _ = protocol.NewActionData(docItem, args)
+		return action
+	}
+	rawArgs, _ := json.Marshal(args)
+	action.Command = &protocol.Command{
+		Title:     title,
+		Command:   commandExecuteAction,
+		Arguments: []json.RawMessage{rawArgs},
+	}
+	return action
+}
 
-// handleExecuteCommand main entry point for workspace/executeCommand
-func handleExecuteCommand(ctx context.Context, conn *jsonrpc2.Conn, params *protocol.ExecuteCommandParams) (interface{}, error) {
-	log.Printf("Execute Command Request: %s with %d args", params.Command, len(params.Arguments))
+// handleCodeActionResolve computes the edit of an action the user picked, for clients
+// resolving code action edits lazily. Actions listed before the last change of the document
+// fail with ContentModified, their position or selection no longer matches the text.
+func handleCodeActionResolve(ctx context.Context, conn *jsonrpc2.Conn, action *protocol.CodeAction) (*protocol.CodeAction, error) {
+	data, err := protocol.DecodeActionData[OllamaActionArgs](action.Data)
+	if err != nil {
+		return nil, err
+	}
+	args := data.Payload
 
-	if params.Command != "ollama/executeAction" {
-		return nil, fmt.Errorf("unknown command: %s", params.Command)
+	docMu.RLock()
+	docItem, ok := documents[data.URI]
+	docMu.RUnlock()
+	if !ok {
+		return nil, jsonrpc2.NewError(jsonrpc2.ContentModified, fmt.Sprintf("%s was closed since the action was offered", data.URI))
 	}
+	if err := data.Verify(docItem); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Resolving action '%s' for %s", args.Action, args.URI)
+	protocol.ShowNotification(ctx, conn, protocol.Info, fmt.Sprintf("Ollama (%s) is thinking...", args.Action))
 
-	if len(params.Arguments) != 1 {
-		return nil, fmt.Errorf("expected 1 argument for command %s, got %d", params.Command, len(params.Arguments))
+	switch args.Action {
+	case "continue":
+		action.Edit = continueEdit(ctx, conn, args, docItem)
+	case "prompt":
+		edit, err := promptEdit(ctx, conn, args, docItem)
+		if err != nil {
+			return nil, err
+		}
+		action.Edit = edit
+	case "translate-comments":
+		action.Edit = commentsEdit(ctx, conn, args, docItem)
+	default:
+		return nil, jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf("action '%s' has no edit to resolve", args.Action))
+	}
+	if action.Edit != nil {
+		caps := lspServer.ClientCapabilities()
+		annotate := caps.TextDocument != nil && caps.TextDocument.CodeAction != nil && caps.TextDocument.CodeAction.HonorsChangeAnnotations
+		action.Edit = confirmLargeEdit(ctx, conn, args, docItem.Version, *action.Edit, annotate)
+	}
+	if action.Edit != nil {
+		audit.recordEdit(args, docItem.Version, *action.Edit, auditResolved, nil)
 	}
+	// Without an edit, the user was notified why and the client has nothing to apply
+	return action, nil
+}
+
+// --- Execute Command Handling ---
 
-	var args OllamaActionArgs
-	if err := json.Unmarshal(params.Arguments[0], &args); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal command arguments: %w", err)
+// handleExecuteAction is the handler of the "ollama/executeAction" command.
+// The server decodes the command argument into OllamaActionArgs, and runs the action in the
+// background: cancelling its progress cancels the Ollama request.
+func handleExecuteAction(ctx context.Context, conn *jsonrpc2.Conn, args *OllamaActionArgs) (interface{}, error) {
+	if args == nil {
+		return nil, fmt.Errorf("missing arguments for command %s", commandExecuteAction)
 	}
 
 	log.Printf("Executing action '%s' for %s", args.Action, args.URI)
 
+	// Actions editing the document run one at a time per document, an edit computed while
+	// another is being applied would target a stale version
+	if args.Action == "continue" || args.Action == "prompt" || args.Action == "translate-comments" {
+		unlock, ok := lspServer.Documents().Locks().TryLock(args.URI)
+		if !ok {
+			protocol.ShowNotification(ctx, conn, protocol.Warning, "Ollama is already editing this document, wait for it to finish.")
+			return nil, nil
+		}
+		defer unlock()
+	}
+
 	// Get document item (includes content and version)
 	docMu.RLock()
 	docItem, ok := documents[args.URI]
 	docMu.RUnlock()
 	if !ok {
-		errMsg := fmt.Sprintf("Document %s not found for command %s", args.URI, params.Command)
+		errMsg := fmt.Sprintf("Document %s not found for command %s", args.URI, commandExecuteAction)
 		log.Println(errMsg)
 		protocol.ShowNotification(ctx, conn, protocol.Error, errMsg)
 		// Return nil error, user was notified
 		return nil, nil
 	}
 
-	// Show "Thinking..." message
-	protocol.ShowNotification(ctx, conn, protocol.Info, fmt.Sprintf("Ollama (%s) is thinking...", args.Action))
+	// Show "Thinking..." in the progress, or as a message for clients without one
+	thinking := fmt.Sprintf("Ollama (%s) is thinking...", args.Action)
+	if p, ok := server.ProgressFromContext(ctx); ok {
+		p.Report(ctx, thinking, nil) //nolint:errcheck
+	} else {
+		protocol.ShowNotification(ctx, conn, protocol.Info, thinking)
+	}
 
 	// Dispatch to action-specific handlers
 	var err error
 	switch args.Action {
 	case "continue":
-		err = executeContinueAction(ctx, conn, args, docItem)
+		err = executeContinueAction(ctx, conn, *args, docItem)
 	case "explain":
-		err = executeExplainAction(ctx, conn, args, docItem)
+		err = executeExplainAction(ctx, conn, *args, docItem)
 	case "prompt":
-		err = executePromptAction(ctx, conn, args, docItem)
+		err = executePromptAction(ctx, conn, *args, docItem)
+	case "translate":
+		err = executeTranslateAction(ctx, conn, *args, docItem)
+	case "translate-comments":
+		err = executeCommentsAction(ctx, conn, *args, docItem)
 	default:
 		errMsg := fmt.Sprintf("Unknown action '%s' in command arguments", args.Action)
 		log.Println(errMsg)
@@ -6,78 +6,51 @@ import (
 	"strings"
 
 	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
 )
 
+// getTextBeforePosition returns the text of content before pos, all of it when pos is past
+// the last line. Lines may end with "\n" or "\r\n".
 func getTextBeforePosition(content string, pos protocol.Position) string {
-	lines := strings.SplitAfter(content, "\n")
-	if int(pos.Line) >= len(lines) {
+	offset, err := textdocument.NewMapper(content).Offset(pos)
+	if err != nil {
 		return content
 	}
-	var builder strings.Builder
-	for i := 0; i < int(pos.Line); i++ {
-		builder.WriteString(lines[i])
-	}
-	lineContent := lines[pos.Line]
-	charPos := int(pos.Character)
-	if charPos > len(lineContent) {
-		charPos = len(lineContent)
-	}
-	builder.WriteString(lineContent[:charPos])
-	return builder.String()
+	return content[:offset]
 }
 
+// getTextInRange returns the text of content in rng, characters past the end of a line
+// are clamped to it.
 func getTextInRange(content string, rng protocol.Range) (string, error) {
-	lines := strings.Split(content, "\n")
-	startLine, startChar := int(rng.Start.Line), int(rng.Start.Character)
-	endLine, endChar := int(rng.End.Line), int(rng.End.Character)
-
-	if startLine < 0 || startLine >= len(lines) || endLine < 0 || endLine >= len(lines) {
-		return "", fmt.Errorf("invalid range: line numbers %d-%d out of bounds (0-%d)", startLine, endLine, len(lines)-1)
-	}
-	if startLine > endLine || (startLine == endLine && startChar > endChar) {
-		return "", fmt.Errorf("invalid range: start %v is after end %v", rng.Start, rng.End)
-	}
-	startLineContent := lines[startLine]
-	endLineContent := lines[endLine]
-	if startChar > len(startLineContent) {
-		startChar = len(startLineContent) // Clamp start char to end of line if needed
-		// return "", fmt.Errorf("invalid range: start character %d out of bounds on line %d (len %d)", startChar, startLine, len(startLineContent))
-	}
-	if endChar > len(endLineContent) {
-		endChar = len(endLineContent) // Clamp end char to end of line if needed
-		// return "", fmt.Errorf("invalid range: end character %d out of bounds on line %d (len %d)", endChar, endLine, len(endLineContent))
+	start, end, err := textdocument.NewMapper(content).Offsets(rng)
+	if err != nil {
+		return "", fmt.Errorf("invalid range: %w", err)
 	}
-	// Re-check validity after clamping characters potentially reversed order on same line
-	if startLine == endLine && startChar > endChar {
-		return "", fmt.Errorf("invalid range: start char %d is after end char %d on the same line %d after clamping", startChar, endChar, startLine)
-	}
-
-	var builder strings.Builder
-	if startLine == endLine {
-		builder.WriteString(lines[startLine][startChar:endChar])
-	} else {
-		builder.WriteString(lines[startLine][startChar:])
-		builder.WriteString("\n")
-		for i := startLine + 1; i < endLine; i++ {
-			builder.WriteString(lines[i])
-			builder.WriteString("\n")
-		}
-		builder.WriteString(lines[endLine][:endChar])
-	}
-	return builder.String(), nil
+	return content[start:end], nil
 }
 
+// getCurrentLine returns the text of a line, without its line terminator.
 func getCurrentLine(content string, lineNum uint) (string, error) {
-	lines := strings.Split(content, "\n")
-	if int(lineNum) >= len(lines) {
-		return "", fmt.Errorf("line number %d is out of bounds (0-%d)", lineNum, len(lines)-1)
+	return textdocument.NewMapper(content).Line(int(lineNum))
+}
+
+// getLineAndColumn returns the line of pos, without its line terminator, and the byte
+// offset of pos in it. The character of pos counts UTF-16 code units, past the end of the
+// line it is clamped to it; a line past the end of content is empty.
+func getLineAndColumn(content string, pos protocol.Position) (string, int) {
+	mapper := textdocument.NewMapper(content)
+	line, err := mapper.Line(int(pos.Line))
+	if err != nil {
+		return "", 0
 	}
-	return lines[lineNum], nil
+	start, _ := mapper.Offset(protocol.Position{Line: pos.Line})
+	cursor, _ := mapper.Offset(pos)
+	return line, cursor - start
 }
 
 // addLineNumbers takes a block of text and prefixes each line with its number.
 func addLineNumbers(text string) string {
-	lines := strings.Split(text, "\n")
+	lines := strings.Split(textdocument.LF.Normalize(text), "\n")
 	var builder strings.Builder
 	for i, line := range lines {
 		// Don't add newline for the very last line if it's empty (common after split)
@@ -103,14 +76,14 @@ func addLineNumbers(text string) string {
 // createWorkspaceEdit simplifies the creation of a WorkspaceEdit with DocumentChanges.
 func createWorkspaceEdit(uri protocol.DocumentURI, version int, edits []protocol.TextEdit) protocol.WorkspaceEdit {
 	return protocol.WorkspaceEdit{
-		DocumentChanges: []protocol.TextDocumentEdit{
-			{
-				TextDocument: protocol.VersionedTextDocumentIdentifier{
+		DocumentChanges: []protocol.DocumentChange{
+			{TextDocumentEdit: &protocol.TextDocumentEdit{
+				TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
 					TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri},
-					Version:                version,
+					Version:                &version,
 				},
 				Edits: edits,
-			},
+			}},
 		},
 	}
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+func TestGetLineAndColumn(t *testing.T) {
+	content := "ab\r\n\t// 日本 😀 x := \r\nlast"
+	tests := []struct {
+		pos    protocol.Position
+		line   string
+		column int
+	}{
+		{protocol.Position{Line: 0, Character: 1}, "ab", 1},
+		{protocol.Position{Line: 0, Character: 9}, "ab", 2}, // Clamped to the line
+		// The character counts UTF-16 code units: 日 and 本 are one each (3 bytes), 😀 two (4 bytes)
+		{protocol.Position{Line: 1, Character: 6}, "\t// 日本 😀 x := ", 10},
+		{protocol.Position{Line: 1, Character: 9}, "\t// 日本 😀 x := ", 15},
+		{protocol.Position{Line: 1, Character: 14}, "\t// 日本 😀 x := ", 20},
+		{protocol.Position{Line: 2, Character: 4}, "last", 4},
+		{protocol.Position{Line: 5, Character: 1}, "", 0},
+	}
+	for _, tt := range tests {
+		line, column := getLineAndColumn(content, tt.pos)
+		if line != tt.line || column != tt.column {
+			t.Errorf("%+v: got %q at %d, want %q at %d", tt.pos, line, column, tt.line, tt.column)
+		}
+	}
+}
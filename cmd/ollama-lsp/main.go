@@ -2,16 +2,12 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"sync"
-	"sync/atomic"
 	"time"
 
-	"github.com/akhenakh/lspgo/jsonrpc2"
 	"github.com/akhenakh/lspgo/protocol"
 	"github.com/akhenakh/lspgo/server"
 )
@@ -20,6 +16,22 @@ var (
 	ollamaBaseURL = getEnv("OLLAMA_HOST", "http://localhost:11434")
 	ollamaModel   = getEnv("OLLAMA_MODEL", "qwen2.5-coder:latest") // Make sure this model is pulled in Ollama
 	ollamaTimeout = 30 * time.Second
+	// "command" always runs the actions through ollama/executeAction, even when the client
+	// could apply their edits itself
+	ollamaCodeActions = getEnv("OLLAMA_CODE_ACTIONS", "edit")
+	// Steps cleaning the generated code, see postProcessSteps
+	ollamaPostProcess = getEnv("OLLAMA_POSTPROCESS", defaultPostProcessing)
+	// JSONL file recording the prompts and edits, disabled when empty
+	ollamaAuditLog = getEnv("OLLAMA_AUDIT_LOG", "")
+	// Edits larger than these limits must be confirmed by the user, 0 disables a limit
+	ollamaMaxEditLines = getEnvInt("OLLAMA_MAX_EDIT_LINES", 50)
+	ollamaMaxEditFiles = getEnvInt("OLLAMA_MAX_EDIT_FILES", 1)
+	// Languages the selection can be translated to, comma separated language identifiers
+	ollamaTranslateLanguages = getEnv("OLLAMA_TRANSLATE_LANGUAGES", "python,go,javascript,rust")
+	// Human language the comments are translated to
+	ollamaCommentLanguage = getEnv("OLLAMA_COMMENT_LANGUAGE", "English")
+	// "true" never edits the files, the generated code is only recorded in the audit log
+	ollamaReadOnly = getEnv("OLLAMA_READ_ONLY", "false") == "true"
 )
 
 func getEnv(key, fallback string) string {
@@ -29,10 +41,29 @@ func getEnv(key, fallback string) string {
 	return fallback
 }
 
+func getEnvInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid %s=%q, using %d: %v", key, value, fallback, err)
+		return fallback
+	}
+	return n
+}
+
+// commandExecuteAction is the command run by all Ollama code actions.
+const commandExecuteAction = "ollama/executeAction"
+
 var (
-	documents     = make(map[protocol.DocumentURI]protocol.TextDocumentItem)
-	nextRequestID atomic.Int64 // Counter for outgoing request IDs
-	docMu         sync.RWMutex
+	documents = make(map[protocol.DocumentURI]protocol.TextDocumentItem)
+	docMu     sync.RWMutex
+
+	lspServer *server.Server
+
+	postProcessing postProcessPipeline
 )
 
 func main() {
@@ -40,14 +71,41 @@ func main() {
 	// Example: Configure logger format
 	logger := log.New(os.Stderr, "[ollama-lsp] ", log.LstdFlags|log.Lshortfile)
 
-	lspServer := server.NewServer(server.WithLogger(logger))
+	var err error
+	if postProcessing, err = parsePostProcessPipeline(ollamaPostProcess); err != nil {
+		log.Fatalf("Invalid OLLAMA_POSTPROCESS: %v", err)
+	}
+
+	preference := server.PreferCodeActionEdits
+	if ollamaCodeActions == "command" || ollamaReadOnly {
+		// Read-only edits go through ApplyEdit, blocked and reported to the user
+		preference = server.PreferCodeActionCommands
+	}
+	opts := []server.Option{server.WithLogger(logger), server.WithCodeActionPreference(preference)}
+	if ollamaReadOnly {
+		opts = append(opts, server.WithReadOnly())
+		log.Printf("Read-only mode, edits are not applied")
+	}
+	lspServer = server.NewServer(opts...)
 
 	// Register handlers
 	mustRegister(lspServer, "textDocument/didOpen", handleDidOpen)
 	mustRegister(lspServer, "textDocument/didChange", handleDidChange)
 	mustRegister(lspServer, "textDocument/didClose", handleDidClose) // Good practice
 	mustRegister(lspServer, "textDocument/codeAction", handleCodeAction)
-	mustRegister(lspServer, "workspace/executeCommand", handleExecuteCommand)
+	mustRegister(lspServer, protocol.MethodCodeActionResolve, handleCodeActionResolve)
+	// Generating takes a while, the command runs in the background with progress
+	lspServer.MustRegisterBackgroundCommand(commandExecuteAction, "Ollama", handleExecuteAction)
+	if ollamaAuditLog != "" {
+		if audit, err = openAuditLog(ollamaAuditLog); err != nil {
+			log.Fatalf("Invalid OLLAMA_AUDIT_LOG: %v", err)
+		}
+		lspServer.MustRegisterCommand(commandOpenAuditLog, handleOpenAuditLog)
+		log.Printf("Recording prompts and edits in %s", ollamaAuditLog)
+	}
+	if err := lspServer.DeclareCodeActionKinds(protocol.RefactorInline, protocol.RefactorRewrite, protocol.Source); err != nil {
+		log.Fatalf("Failed to declare code action kinds: %v", err)
+	}
 
 	log.Println("Starting Ollama LSP server...")
 	log.Printf("Using Ollama URL: %s, Model: %s", ollamaBaseURL, ollamaModel)
@@ -64,13 +122,6 @@ func mustRegister(s *server.Server, method string, handler any) {
 	}
 }
 
-// Function to get next request ID
-func getNextRequestID() json.RawMessage {
-	id := nextRequestID.Add(1)
-	// JSON-RPC IDs can be numbers or strings. Let's use strings for safety.
-	return json.RawMessage(strconv.FormatInt(id, 10))
-}
-
 // Define a structure for parsing the JSON response from Ollama for explanations
 type ExplanationItem struct {
 	LineNumber  int    `json:"line"`
@@ -80,30 +131,3 @@ type ExplanationItem struct {
 type ExplanationResponse struct {
 	Explanations []ExplanationItem `json:"explanations"`
 }
-
-// sendApplyEditRequest sends the workspace/applyEdit request to the client.
-func sendApplyEditRequest(ctx context.Context, conn *jsonrpc2.Conn, label string, edit protocol.WorkspaceEdit) error {
-	applyParams := protocol.ApplyWorkspaceEditParams{
-		Label: label, // Undo label
-		Edit:  edit,
-	}
-
-	rawParams, err := json.Marshal(applyParams)
-	if err != nil {
-		return fmt.Errorf("failed to marshal applyEdit params: %w", err)
-	}
-
-	request := &jsonrpc2.RequestMessage{
-		JSONRPC: jsonrpc2.Version,
-		ID:      getNextRequestID(), // Generate a unique ID for the request
-		Method:  protocol.MethodWorkspaceApplyEdit,
-		Params:  rawParams,
-	}
-
-	log.Printf("<-- Request (to client): Method=%s, ID=%s, Label=%s", request.Method, string(request.ID), label)
-	if err := conn.Write(ctx, request); err != nil {
-		return fmt.Errorf("failed to send workspace/applyEdit request: %w", err)
-	}
-	// Note: We are *not* waiting for the client's response here.
-	return nil
-}
@@ -97,18 +97,18 @@ func callOllama(ctx context.Context, prompt string) (string, error) {
 
 // OllamaActionArgs defines the structure for arguments passed to our custom command
 type OllamaActionArgs struct {
-	Action   string               `json:"action"` // "continue", "explain", "prompt"
-	URI      protocol.DocumentURI `json:"uri"`
-	Position protocol.Position    `json:"position,omitempty"` // Used for "continue", "prompt" (cursor/line)
-	Range    *protocol.Range      `json:"range,omitempty"`    // Used for "explain" (selection)
+	Action   string               `json:"action" description:"one of continue, explain, prompt, translate, translate-comments"`
+	URI      protocol.DocumentURI `json:"uri" description:"document the action applies to"`
+	Position protocol.Position    `json:"position,omitempty" description:"cursor position, used by continue and prompt"`
+	Range    *protocol.Range      `json:"range,omitempty" description:"selection, used by explain, translate and translate-comments"`
+	Language string               `json:"language,omitempty" description:"target language of translate, asked when empty"`
 }
 
-// applyOllamaContinuation sends a workspace/applyEdit request to insert the text.
-func applyOllamaContinuation(ctx context.Context, conn *jsonrpc2.Conn, uri protocol.DocumentURI, version int, position protocol.Position, textToInsert string) error {
-	// Clean up the result - Ollama might add backticks or language hints
-	textToInsert = cleanOllamaCodeResult(textToInsert)
+// ollamaContinuationEdit returns the edit inserting the post-processed text at position, nil
+// when it is empty.
+func ollamaContinuationEdit(ctx context.Context, conn *jsonrpc2.Conn, uri protocol.DocumentURI, version int, position protocol.Position, textToInsert string) *protocol.WorkspaceEdit {
 	if textToInsert == "" {
-		log.Println("Ollama returned empty result after cleaning, not applying edit.")
+		log.Println("Ollama returned empty result after cleaning, no edit to apply.")
 		protocol.ShowNotification(ctx, conn, protocol.Warning, "Ollama returned empty result.")
 		return nil // Not an error, just nothing to apply
 	}
@@ -118,24 +118,24 @@ func applyOllamaContinuation(ctx context.Context, conn *jsonrpc2.Conn, uri proto
 		NewText: textToInsert,
 	}
 	workspaceEdit := createWorkspaceEdit(uri, version, []protocol.TextEdit{edit})
-	return sendApplyEditRequest(ctx, conn, "Ollama Continuation", workspaceEdit)
+	return &workspaceEdit
 }
 
-// applyOllamaLineReplacement sends a workspace/applyEdit request to replace a line with new text.
-func applyOllamaLineReplacement(ctx context.Context, conn *jsonrpc2.Conn, uri protocol.DocumentURI, version int,
-	lineNum uint, oldLine string, textToInsert string) error {
+// ollamaLineReplacementEdit returns the edit replacing a line with the post-processed text,
+// nil when it is empty.
+func ollamaLineReplacementEdit(ctx context.Context, conn *jsonrpc2.Conn, uri protocol.DocumentURI, version int,
+	lineNum uint, oldLine string, textToInsert string) *protocol.WorkspaceEdit {
 
-	textToInsert = cleanOllamaCodeResult(textToInsert)
 	if textToInsert == "" {
-		log.Println("Ollama returned empty result after cleaning, not applying edit.")
+		log.Println("Ollama returned empty result after cleaning, no edit to apply.")
 		protocol.ShowNotification(ctx, conn, protocol.Warning, "Ollama returned empty result.")
 		return nil // Not an error, just nothing to apply
 	}
 
 	// Calculate the range to replace the entire line content
-	// Use the length of the original line content *excluding* the newline character itself
+	// oldLine excludes the line terminator, "\n" or "\r\n", which is kept
 	// This ensures the replacement happens correctly whether the line had a newline or not (EOF case)
-	originalContentLength := uint(len(strings.TrimSuffix(oldLine, "\n")))
+	originalContentLength := uint(len(oldLine))
 	replaceRange := protocol.Range{
 		Start: protocol.Position{Line: lineNum, Character: 0},
 		End:   protocol.Position{Line: lineNum, Character: originalContentLength},
@@ -146,23 +146,7 @@ func applyOllamaLineReplacement(ctx context.Context, conn *jsonrpc2.Conn, uri pr
 		NewText: textToInsert,
 	}
 	workspaceEdit := createWorkspaceEdit(uri, version, []protocol.TextEdit{edit})
-	return sendApplyEditRequest(ctx, conn, "Ollama Prompt Response", workspaceEdit)
-}
-
-// cleanOllamaCodeResult removes common markdown artifacts from Ollama's code output.
-func cleanOllamaCodeResult(rawResult string) string {
-	trimmed := strings.TrimSpace(rawResult)
-	lines := strings.Split(trimmed, "\n")
-	if len(lines) > 0 && strings.HasPrefix(lines[0], "```") {
-		if len(lines) > 1 {
-			lines = lines[1:]
-		} else {
-			return ""
-		}
-		trimmed = strings.TrimSpace(strings.Join(lines, "\n"))
-	}
-	trimmed = strings.TrimSuffix(trimmed, "```")
-	return strings.TrimSpace(trimmed)
+	return &workspaceEdit
 }
 
 // Function to parse JSON explanation response from Ollama
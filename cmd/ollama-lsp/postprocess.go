@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// insertion describes where a generated text goes in the document, the post-processing
+// steps adapt the text to it.
+type insertion struct {
+	// Context is the text of the document before the insertion point, as sent in the prompt.
+	Context string
+	// Line is the line of the insertion point, without its line break.
+	Line string
+	// Column is the byte offset of the cursor in Line, 0 when Replace is set.
+	Column int
+	// Replace is set when the text replaces Line, instead of being inserted at Column.
+	Replace bool
+}
+
+// midLine reports whether the text is inserted after other text on the line, its first
+// line then continues the line.
+func (at insertion) midLine() bool {
+	return !at.Replace && strings.TrimSpace(at.Line[:min(at.Column, len(at.Line))]) != ""
+}
+
+// postProcessStep transforms the text generated by the model.
+type postProcessStep func(text string, at insertion) string
+
+// postProcessSteps are the steps available to OLLAMA_POSTPROCESS, by name.
+var postProcessSteps = map[string]postProcessStep{
+	"fences": stripMarkdownFences,
+	"echo":   removeContextEcho,
+	"indent": normalizeIndentation,
+}
+
+// defaultPostProcessing is the pipeline used when OLLAMA_POSTPROCESS is not set.
+const defaultPostProcessing = "fences,echo,indent"
+
+// postProcessPipeline is the list of steps applied in order to the generated code.
+type postProcessPipeline []postProcessStep
+
+// parsePostProcessPipeline parses a comma separated list of step names, e.g. "fences,indent".
+// An empty list disables post-processing, except for trimming blank lines.
+func parsePostProcessPipeline(names string) (postProcessPipeline, error) {
+	var pipeline postProcessPipeline
+	for name := range strings.SplitSeq(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		step, ok := postProcessSteps[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown post-processing step %q, expected fences, echo or indent", name)
+		}
+		pipeline = append(pipeline, step)
+	}
+	return pipeline, nil
+}
+
+// run applies the steps to the text generated for at. An empty result means there is
+// nothing to insert.
+func (p postProcessPipeline) run(text string, at insertion) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	for _, step := range p {
+		text = step(text, at)
+	}
+	return trimGenerated(text, at)
+}
+
+// trimGenerated removes the blank lines around the text and its trailing spaces. When
+// inserting in the middle of a line, a leading line break is kept: the model started a new
+// line after the cursor, e.g. after an opening brace.
+func trimGenerated(text string, at insertion) string {
+	lines := strings.Split(strings.TrimRight(text, " \t\n"), "\n")
+	first := 0
+	for first < len(lines)-1 && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+	text = strings.Join(lines[first:], "\n")
+	if first > 0 && at.midLine() && text != "" {
+		return "\n" + text
+	}
+	return text
+}
+
+// stripMarkdownFences keeps the content of the first fenced code block, dropping the fences
+// and the prose models add around it ("Here is the code:"). A block the model didn't close
+// runs to the end of the text. Text without fences is returned as is.
+func stripMarkdownFences(text string, _ insertion) string {
+	lines := strings.Split(text, "\n")
+	start, fence := -1, ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if start == -1 {
+			if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+				start, fence = i, trimmed[:3]
+			}
+			continue
+		}
+		if trimmed == fence || (strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "") {
+			return strings.Join(lines[start+1:i], "\n")
+		}
+	}
+	if start == -1 {
+		return text
+	}
+	return strings.Join(lines[start+1:], "\n")
+}
+
+// minPartialEcho is the length below which the text before the cursor is not considered
+// repeated when the generated text merely starts with it: "x" followed by "xs" is more
+// likely a continuation than an echo.
+const minPartialEcho = 4
+
+// removeContextEcho removes the end of the context the model repeated before its answer,
+// despite being told not to. The generated lines are compared with the context ones,
+// ignoring indentation: the longest run of context lines, ending at the insertion point,
+// the text starts with is the echo.
+func removeContextEcho(text string, at insertion) string {
+	lines := strings.Split(text, "\n")
+	for len(lines) > 1 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:] // Blank lines don't tell echoes apart, they are kept without one
+	}
+	contextLines := strings.Split(at.Context, "\n")
+	// The last context line is the text before the cursor on its line, empty at a line start
+	partial := strings.TrimSpace(contextLines[len(contextLines)-1])
+	full := contextLines[:len(contextLines)-1]
+
+	echoed := 0
+	for k := min(len(full), len(lines)); k > 0; k-- {
+		if !sameLines(lines[:k], full[len(full)-k:]) {
+			continue
+		}
+		// An echo goes on with the text before the cursor, when there is some
+		if partial != "" && k < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[k]), partial) {
+			continue
+		}
+		echoed = k
+		break
+	}
+	lines = lines[echoed:]
+	stripped := false
+	if len(lines) > 0 && partial != "" && (echoed > 0 || len(partial) >= minPartialEcho) {
+		var rest string
+		if rest, stripped = strings.CutPrefix(strings.TrimLeft(lines[0], " \t"), partial); stripped {
+			lines[0] = rest
+		}
+	}
+	if echoed == 0 && !stripped {
+		return text
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sameLines reports whether a and b have the same lines, ignoring indentation, and are not
+// all blank: repeating a blank line is no evidence of an echo.
+func sameLines(a, b []string) bool {
+	blank := true
+	for i := range a {
+		x, y := strings.TrimSpace(a[i]), strings.TrimSpace(b[i])
+		if x != y {
+			return false
+		}
+		blank = blank && x == ""
+	}
+	return !blank
+}
+
+// normalizeIndentation indents the text for the insertion point. A replaced line, or a line
+// with only indentation before the cursor, gives the indentation of the block: its least
+// indented line is moved to it and the other lines keep their relative indentation, in the
+// tabs or spaces style of the line. In the middle of a line, the first line continues it and
+// the other lines are left as generated, like at the start of an empty line where the model
+// indentation is the only information.
+func normalizeIndentation(text string, at insertion) string {
+	lines := strings.Split(text, "\n")
+	switch {
+	case at.midLine():
+		lines[0] = strings.TrimLeft(lines[0], " \t")
+		return strings.Join(lines, "\n")
+	case !at.Replace && at.Column == 0:
+		return text
+	}
+
+	target := leadingWhitespace(at.Line)
+	common := commonIndentation(lines)
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			lines[i] = ""
+			continue
+		}
+		lines[i] = target + convertIndentation(strings.TrimPrefix(line, common), target)
+	}
+	if !at.Replace {
+		// The cursor is after the indentation already typed on the line
+		lines[0] = strings.TrimPrefix(lines[0], at.Line[:min(at.Column, len(at.Line))])
+	}
+	return strings.Join(lines, "\n")
+}
+
+// leadingWhitespace returns the indentation of line.
+func leadingWhitespace(line string) string {
+	return line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+}
+
+// commonIndentation returns the longest indentation prefix of the non-blank lines.
+func commonIndentation(lines []string) string {
+	common, found := "", false
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		indent := leadingWhitespace(line)
+		if !found {
+			common, found = indent, true
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(indent) && common[n] == indent[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return common
+}
+
+// spacesPerTab is the width of a tab when converting the indentation of generated code.
+const spacesPerTab = 4
+
+// convertIndentation converts the leading indentation of line to the style of target: tabs
+// when it has tabs, spaces when it has spaces. An empty target gives no style.
+func convertIndentation(line, target string) string {
+	indent := leadingWhitespace(line)
+	rest := line[len(indent):]
+	switch {
+	case strings.Contains(target, "\t") && strings.Contains(indent, " "):
+		width := 0
+		for _, r := range indent {
+			if r == '\t' {
+				width += spacesPerTab
+			} else {
+				width++
+			}
+		}
+		return strings.Repeat("\t", width/spacesPerTab) + strings.Repeat(" ", width%spacesPerTab) + rest
+	case target != "" && !strings.Contains(target, "\t") && strings.Contains(indent, "\t"):
+		return strings.ReplaceAll(indent, "\t", strings.Repeat(" ", spacesPerTab)) + rest
+	}
+	return line
+}
@@ -0,0 +1,239 @@
+package main
+
+import "testing"
+
+// The texts below are shaped after answers captured from code models served by Ollama:
+// prose around a fenced block, an echo of the prompt before the completion, and code
+// indented with spaces for a file indented with tabs.
+
+func TestStripMarkdownFences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "prose around block",
+			text: "Here is the code:\n```go\nfunc f() {}\n```\nThis defines f.",
+			want: "func f() {}",
+		},
+		{
+			name: "unclosed block",
+			text: "```python\nx = 1\ny = 2",
+			want: "x = 1\ny = 2",
+		},
+		{
+			name: "tildes",
+			text: "~~~\na\n~~~",
+			want: "a",
+		},
+		{
+			name: "longer closing fence",
+			text: "```\na\n````",
+			want: "a",
+		},
+		{
+			name: "indented fences",
+			text: "  ```js\n  let a = 1;\n  ```",
+			want: "  let a = 1;",
+		},
+		{
+			name: "first block only",
+			text: "```\na\n```\nor\n```\nb\n```",
+			want: "a",
+		},
+		{
+			name: "no fences",
+			text: "return a + b",
+			want: "return a + b",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripMarkdownFences(tt.text, insertion{}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveContextEcho(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		context string
+		want    string
+	}{
+		{
+			name:    "repeated lines",
+			context: "func main() {\n\tx := 1\n\t",
+			text:    "func main() {\n    x := 1\n    y := 2",
+			want:    "    y := 2",
+		},
+		{
+			name:    "repeated lines and text before the cursor",
+			context: "func f() {\n\tret",
+			text:    "func f() {\n\treturn 1\n}",
+			want:    "urn 1\n}",
+		},
+		{
+			name:    "repeated text before the cursor",
+			context: "if err != nil {\n\treturn er",
+			text:    "return err\n}",
+			want:    "r\n}",
+		},
+		{
+			name:    "short text before the cursor",
+			context: "x",
+			text:    "xs := 2",
+			want:    "xs := 2",
+		},
+		{
+			name:    "line not ending at the cursor",
+			context: "a := 1\nb := 2\n",
+			text:    "a := 1\nc := 3",
+			want:    "a := 1\nc := 3",
+		},
+		{
+			name:    "repeated blank line",
+			context: "a\n\n",
+			text:    "\nb",
+			want:    "\nb",
+		},
+		{
+			name:    "no echo",
+			context: "a\nb\n",
+			text:    "c",
+			want:    "c",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removeContextEcho(tt.text, insertion{Context: tt.context}); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeIndentation(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		at   insertion
+		want string
+	}{
+		{
+			name: "spaces to tabs",
+			at:   insertion{Line: "\t\tfoo()", Replace: true},
+			text: "    bar()\n        baz()",
+			want: "\t\tbar()\n\t\t\tbaz()",
+		},
+		{
+			name: "tabs to spaces",
+			at:   insertion{Line: "    x", Replace: true},
+			text: "\tif a {\n\t\tb()\n\t}",
+			want: "    if a {\n        b()\n    }",
+		},
+		{
+			name: "blank lines",
+			at:   insertion{Line: "  z", Replace: true},
+			text: "a\n   \nb",
+			want: "  a\n\n  b",
+		},
+		{
+			name: "after typed indentation",
+			at:   insertion{Line: "\t", Column: 1},
+			text: "if x {\n    y()\n}",
+			want: "if x {\n\t\ty()\n\t}",
+		},
+		{
+			name: "mid line",
+			at:   insertion{Line: "x := ", Column: 5},
+			text: "  foo()\n  bar()",
+			want: "foo()\n  bar()",
+		},
+		{
+			name: "line start",
+			at:   insertion{Line: "", Column: 0},
+			text: "  foo()\n    bar()",
+			want: "  foo()\n    bar()",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeIndentation(tt.text, tt.at); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostProcessPipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps string
+		text  string
+		at    insertion
+		want  string
+	}{
+		{
+			name:  "fenced body with crlf",
+			steps: defaultPostProcessing,
+			text:  "Sure! Here is the completion:\r\n```go\r\n    return a + b\r\n```\r\n",
+			at:    insertion{Context: "func add(a, b int) int {\n\t", Line: "\t", Column: 1},
+			want:  "return a + b",
+		},
+		{
+			name:  "fenced echo",
+			steps: defaultPostProcessing,
+			text:  "```go\nfunc add(a, b int) int {\n    sum := a + b\n    return sum\n```",
+			at:    insertion{Context: "func add(a, b int) int {\n\t", Line: "\t", Column: 1},
+			want:  "sum := a + b\n\treturn sum",
+		},
+		{
+			name:  "replaced line",
+			steps: defaultPostProcessing,
+			text:  "```\n\n  for i := range n {\n    total += i\n  }\n\n```",
+			at:    insertion{Line: "\tfor i := 0; i < n; i++ { total += i }", Replace: true},
+			want:  "\tfor i := range n {\n\t  total += i\n\t}",
+		},
+		{
+			name:  "new line after the cursor",
+			steps: "",
+			text:  "\n\treturn\n",
+			at:    insertion{Line: "if x {", Column: 6},
+			want:  "\n\treturn",
+		},
+		{
+			name:  "disabled",
+			steps: "",
+			text:  "```\nx\n```",
+			want:  "```\nx\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline, err := parsePostProcessPipeline(tt.steps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pipeline.run(tt.text, tt.at); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePostProcessPipeline(t *testing.T) {
+	pipeline, err := parsePostProcessPipeline(" fences, ,indent ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pipeline) != 2 {
+		t.Errorf("got %d steps, want 2", len(pipeline))
+	}
+	if _, err := parsePostProcessPipeline("fences,trim"); err == nil {
+		t.Error("unknown step accepted")
+	}
+}
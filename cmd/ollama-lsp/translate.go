@@ -0,0 +1,155 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// translateLanguages returns the languages the selection can be translated to, from
+// OLLAMA_TRANSLATE_LANGUAGES, without the language of the document.
+func translateLanguages(from protocol.LanguageID) []string {
+	var languages []string
+	for _, l := range strings.Split(ollamaTranslateLanguages, ",") {
+		if l = strings.TrimSpace(l); l != "" && protocol.LanguageID(l) != from {
+			languages = append(languages, l)
+		}
+	}
+	return languages
+}
+
+// translateAction returns the action translating the selection of docItem into a new file,
+// the target language is asked when more than one is configured. ok is false when there is
+// no language to translate to.
+func translateAction(docItem protocol.TextDocumentItem, rng protocol.Range) (protocol.CodeAction, bool) {
+	uri := docItem.URI
+	languages := translateLanguages(protocol.LanguageIDForURI(uri))
+	if len(languages) == 0 {
+		return protocol.CodeAction{}, false
+	}
+	args := OllamaActionArgs{Action: "translate", URI: uri, Range: &rng}
+	title := "Ollama: Translate selection to another language..."
+	if len(languages) == 1 {
+		args.Language = languages[0]
+		title = fmt.Sprintf("Ollama: Translate selection to %s", languages[0])
+	}
+	// Always a command: it may ask for the language, and opens the new file once created
+	return editAction(docItem, title, protocol.RefactorRewrite, args, server.CodeActionCommand), true
+}
+
+// translationURI returns the URI of the file receiving a translation of the document at
+// uri, next to it with the extension of language, and numbered when the name is taken.
+func translationURI(uri protocol.DocumentURI, language string) (protocol.DocumentURI, error) {
+	path, err := uri.Path()
+	if err != nil {
+		return "", err
+	}
+	ext := "." + language // Languages without known extensions
+	if exts := protocol.LanguageExtensions(protocol.LanguageID(language)); len(exts) > 0 {
+		// The shortest, e.g. .js rather than .mjs
+		ext = slices.MinFunc(exts, func(a, b string) int { return cmp.Compare(len(a), len(b)) })
+	}
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	candidate := base + ext
+	for i := 2; ; i++ {
+		if _, err := os.Stat(candidate); errors.Is(err, os.ErrNotExist) {
+			return protocol.URIFromPath(candidate), nil
+		}
+		candidate = fmt.Sprintf("%s_%d%s", base, i, ext)
+	}
+}
+
+// executeTranslateAction handles the "translate" action: it asks Ollama for an equivalent of
+// the selection in another language, and creates a new file with it.
+func executeTranslateAction(ctx context.Context, conn *jsonrpc2.Conn, args OllamaActionArgs, docItem protocol.TextDocumentItem) error {
+	if args.Range == nil {
+		log.Println("Error: Range is nil for 'translate' action")
+		protocol.ShowNotification(ctx, conn, protocol.Error, "Internal error: Missing range for translate action.")
+		return fmt.Errorf("range is required for 'translate' action")
+	}
+	selectedText, err := getTextInRange(docItem.Text, *args.Range)
+	if err != nil {
+		return fmt.Errorf("failed to get text in range for 'translate': %w", err)
+	}
+	if strings.TrimSpace(selectedText) == "" {
+		protocol.ShowNotification(ctx, conn, protocol.Warning, "No text selected for 'translate'.")
+		return nil
+	}
+
+	from := documentLanguage(docItem)
+	if args.Language == "" {
+		picked, err := lspServer.ShowMessageRequest(ctx, protocol.Info, "Translate the selection to:", translateLanguages(from)...)
+		if err != nil {
+			log.Printf("Failed to ask for the target language: %v", err)
+		}
+		if picked == "" {
+			return nil // Dismissed
+		}
+		args.Language = picked
+	}
+
+	newURI, err := translationURI(args.URI, args.Language)
+	if err != nil {
+		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Can't create a file next to %s: %v", args.URI, err))
+		return nil
+	}
+
+	prompt := fmt.Sprintf(`You are an expert coding assistant. Translate the following %s code to %s.
+Keep the same behavior and names where the target language allows it, and follow its conventions.
+Respond ONLY with the %s code, without any preamble or explanation.
+
+Code:
+%s`, from, args.Language, args.Language, selectedText)
+
+	ollamaResult, err := callOllama(ctx, prompt)
+	audit.recordPrompt(args, docItem.Version, prompt, ollamaResult, err)
+	if err != nil {
+		errMsg := fmt.Sprintf("Ollama 'translate' request failed: %v", err)
+		log.Println(errMsg)
+		protocol.ShowNotification(ctx, conn, protocol.Error, errMsg)
+		return nil
+	}
+	code := postProcessing.run(ollamaResult, insertion{Replace: true})
+	if code == "" {
+		protocol.ShowNotification(ctx, conn, protocol.Warning, "Ollama returned no translation.")
+		return nil
+	}
+
+	// The file is created then filled in the same edit, it has no version yet
+	edit := &protocol.WorkspaceEdit{DocumentChanges: []protocol.DocumentChange{
+		{CreateFile: &protocol.CreateFile{URI: newURI}},
+		{TextDocumentEdit: &protocol.TextDocumentEdit{
+			TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: newURI},
+			},
+			Edits: []protocol.TextEdit{{NewText: code + "\n"}},
+		}},
+	}}
+	annotate := lspServer.ClientCapabilities().SupportsChangeAnnotations()
+	if edit = confirmLargeEdit(ctx, conn, args, docItem.Version, *edit, annotate); edit == nil {
+		return nil
+	}
+
+	err = lspServer.ApplyEdit(ctx, "Ollama Translation", *edit)
+	audit.recordEdit(args, docItem.Version, *edit, editOutcome(err), err)
+	if err != nil {
+		log.Printf("Error applying Ollama translation: %v", err)
+		protocol.ShowNotification(ctx, conn, protocol.Error, fmt.Sprintf("Failed to create the translation: %v", err))
+		return nil
+	}
+	log.Printf("Client created the translation %s", newURI)
+	if err := lspServer.ShowDocument(ctx, protocol.ShowDocumentParams{URI: newURI, TakeFocus: true}); err != nil {
+		protocol.ShowNotification(ctx, conn, protocol.Info, fmt.Sprintf("Ollama translation created in %s.", newURI))
+	}
+	return nil
+}
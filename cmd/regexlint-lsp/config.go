@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// Settings is the shape of workspace/didChangeConfiguration settings we understand:
+//
+//	{"regexlint": {"rulesFile": "/path/to/rules.json"}}
+//
+// Its schema is published with server.WithConfigurationSchema.
+type Settings struct {
+	RegexLint struct {
+		RulesFile string `json:"rulesFile,omitempty" description:"Rule file, relative to the workspace root. Defaults to REGEXLINT_RULES or .regexlint.json."`
+	} `json:"regexlint,omitempty"`
+}
+
+var (
+	// rulesWatch is the registration of the rule file watcher, nil when not watching.
+	rulesWatch *protocol.Registration
+	watchMu    sync.Mutex // Serializes watchRules, it waits on the client
+)
+
+// reloadRules loads the rule file and checks the open documents again.
+// A missing file means no rules, an invalid one keeps the previous rules.
+func reloadRules(ctx context.Context) {
+	rulesMu.RLock()
+	path := rulesPath
+	rulesMu.RUnlock()
+
+	loaded, err := LoadRules(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		log.Printf("No rule file at %s", path)
+		loaded = &RuleSet{}
+	case err != nil:
+		log.Printf("Error loading rules from %s: %v", path, err)
+		showMessage(ctx, protocol.Error, fmt.Sprintf("regexlint: %s: %v", path, err))
+		return
+	}
+
+	rulesMu.Lock()
+	rules = loaded
+	rulesMu.Unlock()
+	log.Printf("Loaded %d rules from %s", len(loaded.Rules), path)
+
+	docMu.RLock()
+	items := make([]protocol.TextDocumentItem, 0, len(documents))
+	for _, item := range documents {
+		items = append(items, item)
+	}
+	docMu.RUnlock()
+	for _, item := range items {
+		checkDocument(ctx, item)
+	}
+}
+
+// watchRules asks the client to notify us of changes to the rule file, replacing the
+// previous watcher. Clients without dynamic registration still reload on didSave
+// when the rule file is edited in the editor.
+func watchRules(ctx context.Context) {
+	rulesMu.RLock()
+	pattern := "**/" + filepath.Base(rulesPath)
+	rulesMu.RUnlock()
+
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	if rulesWatch != nil {
+		if err := lspServer.UnregisterCapability(ctx, *rulesWatch); err != nil {
+			log.Printf("Error removing rule file watcher: %v", err)
+		}
+		rulesWatch = nil
+	}
+	registration, err := lspServer.WatchFiles(ctx, protocol.FileSystemWatcher{GlobPattern: pattern})
+	if errors.Is(err, server.ErrDynamicRegistrationUnsupported) {
+		log.Printf("Client can't watch files, rules are reloaded when the rule file is saved in the editor")
+		return
+	}
+	if err != nil {
+		log.Printf("Error watching rule file: %v", err)
+		return
+	}
+	rulesWatch = &registration
+	log.Printf("Watching %s (registration %s)", pattern, registration.ID)
+}
+
+// isRulesFile reports whether uri is the rule file.
+func isRulesFile(uri protocol.DocumentURI) bool {
+	path, err := uri.Path()
+	if err != nil {
+		return false
+	}
+	rulesMu.RLock()
+	defer rulesMu.RUnlock()
+	return filepath.Clean(path) == filepath.Clean(rulesPath)
+}
+
+// handleDidChangeConfiguration switches to another rule file when the setting changed.
+func handleDidChangeConfiguration(ctx context.Context, params *protocol.DidChangeConfigurationParams) error {
+	var settings Settings
+	found, err := params.Section("regexlint", &settings.RegexLint)
+	if !found && err == nil && lspServer.ClientCapabilities().SupportsConfiguration() {
+		// Clients using the pull model only notify that the settings changed
+		found, err = lspServer.Configuration(ctx, nil, "regexlint", &settings.RegexLint)
+	}
+	if err != nil {
+		log.Printf("Ignoring the regexlint settings: %v", err)
+		return nil
+	}
+	if !found {
+		return nil // Not for us
+	}
+	path := settings.RegexLint.RulesFile
+	if path == "" {
+		return nil
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspaceRoot(), path)
+	}
+
+	rulesMu.Lock()
+	changed := path != rulesPath
+	rulesPath = path
+	rulesMu.Unlock()
+
+	log.Printf("Configuration changed, rule file: %s", path)
+	reloadRules(ctx)
+	if changed {
+		watchRules(ctx)
+	}
+	return nil
+}
+
+// handleDidChangeWatchedFiles reloads the rules when the rule file changed on disk.
+func handleDidChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	for _, event := range params.Changes {
+		if isRulesFile(event.URI) {
+			log.Printf("Rule file changed on disk (%d)", event.Type)
+			reloadRules(ctx)
+			return nil
+		}
+	}
+	return nil
+}
+
+func showMessage(ctx context.Context, msgType protocol.MessageType, message string) {
+	params := protocol.ShowMessageParams{Type: msgType, Message: message}
+	if err := lspServer.Notify(ctx, protocol.MethodWindowShowMessage, params); err != nil {
+		log.Printf("Error showing message: %v", err)
+	}
+}
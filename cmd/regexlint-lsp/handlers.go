@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"unicode/utf16"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// diagnosticSource identifies our diagnostics among those of other servers.
+const diagnosticSource = "regexlint"
+
+// fixData is attached to diagnostics having a fix, for code actions to build the edit.
+type fixData struct {
+	Rule    string `json:"rule"`
+	Fix     string `json:"fix"`
+	Title   string `json:"title"`
+	Version int    `json:"version"` // Document version the fix applies to
+}
+
+// handleDidOpen stores the document and checks it.
+func handleDidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) error {
+	docMu.Lock()
+	documents[params.TextDocument.URI] = params.TextDocument
+	docMu.Unlock()
+	log.Printf("Document Opened: %s (Version: %d)", params.TextDocument.URI, params.TextDocument.Version)
+
+	checkDocument(ctx, params.TextDocument)
+	return nil
+}
+
+// handleDidChange updates the document and checks it again.
+func handleDidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
+	if len(params.ContentChanges) == 0 {
+		return nil
+	}
+	// Full sync, the last change holds the whole text
+	text := params.ContentChanges[len(params.ContentChanges)-1].Text
+
+	docMu.Lock()
+	item := documents[params.TextDocument.URI]
+	item.URI = params.TextDocument.URI
+	item.Version = params.TextDocument.Version
+	item.Text = text
+	documents[item.URI] = item
+	docMu.Unlock()
+
+	checkDocument(ctx, item)
+	return nil
+}
+
+// handleDidSave reloads the rules when the rule file itself is saved,
+// for clients that can't watch files.
+func handleDidSave(ctx context.Context, params *protocol.DidSaveTextDocumentParams) error {
+	if isRulesFile(params.TextDocument.URI) {
+		log.Printf("Rule file saved")
+		reloadRules(ctx)
+	}
+	return nil
+}
+
+// handleDidClose forgets the document and clears its diagnostics.
+func handleDidClose(ctx context.Context, params *protocol.DidCloseTextDocumentParams) error {
+	uri := params.TextDocument.URI
+	docMu.Lock()
+	delete(documents, uri)
+	docMu.Unlock()
+	log.Printf("Document Closed: %s", uri)
+
+	if err := lspServer.Diagnostics().Clear(ctx, uri); err != nil {
+		log.Printf("Error clearing diagnostics for %s: %v", uri, err)
+	}
+	return nil
+}
+
+// checkDocument publishes a diagnostic for each rule match in the document.
+func checkDocument(ctx context.Context, item protocol.TextDocumentItem) {
+	rulesMu.RLock()
+	current := rules
+	rulesMu.RUnlock()
+
+	lines := newLineIndex(item.Text)
+	var diagnostics []protocol.Diagnostic
+	for _, m := range current.Check(item.Text) {
+		code, _ := json.Marshal(m.Rule.ID)
+		d := protocol.Diagnostic{
+			Range: protocol.Range{
+				Start: lines.position(m.Start),
+				End:   lines.position(m.End),
+			},
+			Severity: m.Rule.severity,
+			Tags:     m.Rule.tags,
+			Code:     code,
+			Source:   diagnosticSource,
+			Message:  m.Message,
+		}
+		if m.Fix != nil {
+			d.Data, _ = json.Marshal(fixData{Rule: m.Rule.ID, Fix: *m.Fix, Title: m.fixTitle(), Version: item.Version})
+		}
+		diagnostics = append(diagnostics, d)
+	}
+
+	version := item.Version
+	if err := lspServer.Diagnostics().Publish(ctx, item.URI, &version, diagnostics); err != nil {
+		log.Printf("Error publishing diagnostics for %s: %v", item.URI, err)
+	}
+}
+
+// handleCodeAction offers the fix of each rule match under the cursor, and a fix
+// for all the matches of the rule in the document when there are several.
+func handleCodeAction(ctx context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	if !params.Context.Accepts(protocol.QuickFix) {
+		return nil, nil
+	}
+	uri := params.TextDocument.URI
+	documentChanges := lspServer.ClientCapabilities().SupportsDocumentChanges()
+
+	all := fixesByRule(lspServer.Diagnostics().Get(uri))
+	var actions []protocol.CodeAction
+	offered := make(map[string]bool)
+	for _, diagnostic := range lspServer.Diagnostics().InRange(uri, params.Range) {
+		var fix fixData
+		if diagnostic.Source != diagnosticSource || json.Unmarshal(diagnostic.Data, &fix) != nil {
+			continue
+		}
+
+		b := protocol.NewWorkspaceEditBuilder().
+			SetVersion(uri, fix.Version).
+			Replace(uri, diagnostic.Range, fix.Fix)
+		edit, err := b.Build(documentChanges)
+		if err != nil {
+			log.Printf("Error building fix for %s: %v", fix.Rule, err)
+			continue
+		}
+		actions = append(actions, protocol.CodeAction{
+			Title:       fix.Title,
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diagnostic},
+			IsPreferred: true,
+			Edit:        &edit,
+		})
+
+		if offered[fix.Rule] || len(all[fix.Rule]) < 2 {
+			continue
+		}
+		offered[fix.Rule] = true
+		if action, ok := fixAllAction(uri, fix.Rule, all[fix.Rule], documentChanges); ok {
+			actions = append(actions, action)
+		}
+	}
+	log.Printf("Code Action Request: %s Range: %v, %d actions", uri, params.Range, len(actions))
+	return actions, nil
+}
+
+// fixesByRule groups the fixable diagnostics of a document by rule.
+func fixesByRule(diagnostics []protocol.Diagnostic) map[string][]protocol.Diagnostic {
+	byRule := make(map[string][]protocol.Diagnostic)
+	for _, d := range diagnostics {
+		var fix fixData
+		if d.Source != diagnosticSource || json.Unmarshal(d.Data, &fix) != nil {
+			continue
+		}
+		byRule[fix.Rule] = append(byRule[fix.Rule], d)
+	}
+	return byRule
+}
+
+// fixAllAction fixes every diagnostic of a rule in one edit. Matches of a rule may
+// overlap, the builder refuses them and no action is offered then.
+func fixAllAction(uri protocol.DocumentURI, rule string, diagnostics []protocol.Diagnostic, documentChanges bool) (protocol.CodeAction, bool) {
+	b := protocol.NewWorkspaceEditBuilder()
+	for _, d := range diagnostics {
+		var fix fixData
+		json.Unmarshal(d.Data, &fix) // Checked by fixesByRule
+		b.SetVersion(uri, fix.Version).Replace(uri, d.Range, fix.Fix)
+	}
+	edit, err := b.Build(documentChanges)
+	if err != nil {
+		log.Printf("Not offering to fix all %s: %v", rule, err)
+		return protocol.CodeAction{}, false
+	}
+	return protocol.CodeAction{
+		Title:       fmt.Sprintf("Fix all %s problems (%d)", rule, b.Len()),
+		Kind:        protocol.QuickFix,
+		Diagnostics: diagnostics,
+		Edit:        &edit,
+	}, true
+}
+
+// lineIndex converts byte offsets to LSP positions, counting characters in UTF-16 code units.
+type lineIndex struct {
+	text   string
+	starts []int // Byte offset of each line start
+}
+
+func newLineIndex(text string) *lineIndex {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &lineIndex{text: text, starts: starts}
+}
+
+func (l *lineIndex) position(offset int) protocol.Position {
+	line := sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > offset }) - 1
+	character := 0
+	for _, r := range l.text[l.starts[line]:offset] {
+		character += utf16.RuneLen(r)
+	}
+	return protocol.Position{Line: uint(line), Character: uint(character)}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/akhenakh/lspgo/jsonschema"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// defaultRulesFile is looked up in the workspace root when REGEXLINT_RULES is not set.
+const defaultRulesFile = ".regexlint.json"
+
+var (
+	// Store open documents in memory
+	documents = make(map[protocol.DocumentURI]protocol.TextDocumentItem)
+	docMu     sync.RWMutex // Protects access to the documents map
+
+	// Loaded rules and where they come from, see reloadRules
+	rules     = &RuleSet{}
+	rulesPath = os.Getenv("REGEXLINT_RULES")
+	rulesMu   sync.RWMutex
+
+	lspServer *server.Server
+)
+
+func main() {
+	ctx := context.Background()
+	logger := log.New(os.Stderr, "[regexlint-lsp] ", log.LstdFlags|log.Lshortfile)
+
+	lspServer = server.NewServer(
+		server.WithLogger(logger),
+		server.WithConfigurationSchema(nil, jsonschema.For[Settings]()),
+	)
+
+	mustRegister(lspServer, protocol.MethodTextDocumentDidOpen, handleDidOpen)
+	mustRegister(lspServer, protocol.MethodTextDocumentDidChange, handleDidChange)
+	mustRegister(lspServer, protocol.MethodTextDocumentDidSave, handleDidSave)
+	mustRegister(lspServer, protocol.MethodTextDocumentDidClose, handleDidClose)
+	mustRegister(lspServer, protocol.MethodTextDocumentCodeAction, handleCodeAction)
+	mustRegister(lspServer, protocol.MethodWorkspaceDidChangeConfiguration, handleDidChangeConfiguration)
+	mustRegister(lspServer, protocol.MethodWorkspaceDidChangeWatchedFiles, handleDidChangeWatchedFiles)
+	if err := lspServer.DeclareCodeActionKinds(protocol.QuickFix); err != nil {
+		log.Fatalf("Failed to declare code action kinds: %v", err)
+	}
+
+	// The workspace root is only known once initialized
+	lspServer.OnInitialized(func(ctx context.Context) {
+		rulesMu.Lock()
+		if rulesPath == "" {
+			rulesPath = filepath.Join(workspaceRoot(), defaultRulesFile)
+		}
+		rulesMu.Unlock()
+		reloadRules(ctx)
+		watchRules(ctx)
+	})
+
+	log.Println("Starting regexlint LSP server...")
+
+	if err := lspServer.Run(ctx); err != nil {
+		logger.Fatalf("Server error: %v", err)
+	}
+	logger.Println("Server stopped.")
+}
+
+// workspaceRoot returns the path of the first workspace folder, or the current directory.
+func workspaceRoot() string {
+	if folders := lspServer.WorkspaceFolders(); len(folders) > 0 {
+		if path, err := protocol.DocumentURI(folders[0].URI).Path(); err == nil {
+			return path
+		}
+	}
+	wd, _ := os.Getwd()
+	return wd
+}
+
+func mustRegister(s *server.Server, method string, handler any) {
+	if err := s.Register(method, handler); err != nil {
+		log.Fatalf("Failed to register handler for %s: %v", method, err)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Rule reports the matches of a regular expression.
+type Rule struct {
+	// ID identifies the rule, it is used as the diagnostic code.
+	ID string `json:"id"`
+	// Pattern is a Go regular expression (RE2 syntax), e.g. "(?i)\\btodo\\b".
+	Pattern string `json:"pattern"`
+	// Message is reported for each match, "$1" or "${name}" expand to the submatches.
+	Message string `json:"message"`
+	// Severity is one of "error", "warning" (default), "info" or "hint".
+	Severity string `json:"severity,omitempty"`
+	// Fix is the replacement of the match offered as a quick fix, expanded like Message.
+	// No fix is offered when it is missing, use "" to offer deleting the match.
+	Fix *string `json:"fix,omitempty"`
+	// FixTitle is the title of the quick fix, defaults to a description of the replacement.
+	FixTitle string `json:"fixTitle,omitempty"`
+	// Tags are "unnecessary" (rendered faded out) or "deprecated" (struck through).
+	Tags []string `json:"tags,omitempty"`
+
+	re       *regexp.Regexp
+	severity protocol.DiagnosticSeverity
+	tags     []protocol.DiagnosticTag
+}
+
+// RuleSet is the content of a rule file.
+type RuleSet struct {
+	Rules []*Rule `json:"rules"`
+}
+
+// Match is an occurrence of a rule in a text, offsets are in bytes.
+type Match struct {
+	Rule    *Rule
+	Start   int
+	End     int
+	Message string
+	Fix     *string // Expanded replacement, nil if the rule has no fix
+}
+
+var diagnosticTags = map[string]protocol.DiagnosticTag{
+	"unnecessary": protocol.DiagnosticTagUnnecessary,
+	"deprecated":  protocol.DiagnosticTagDeprecated,
+}
+
+// LoadRules reads and compiles a JSON rule file.
+func LoadRules(path string) (*RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// ParseRules parses and compiles JSON rules.
+func ParseRules(data []byte) (*RuleSet, error) {
+	var rs RuleSet
+	if err := json.Unmarshal(data, &rs); err != nil {
+		return nil, fmt.Errorf("invalid rule file: %w", err)
+	}
+	seen := make(map[string]bool)
+	for i, rule := range rs.Rules {
+		if rule.ID == "" {
+			return nil, fmt.Errorf("rule %d: missing id", i)
+		}
+		if seen[rule.ID] {
+			return nil, fmt.Errorf("rule %s: duplicate id", rule.ID)
+		}
+		seen[rule.ID] = true
+
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: invalid pattern: %w", rule.ID, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("rule %s: pattern matches the empty string", rule.ID)
+		}
+		rule.re = re
+
+		rule.severity = protocol.SeverityWarning
+		if rule.Severity != "" {
+			if rule.severity, err = protocol.ParseDiagnosticSeverity(rule.Severity); err != nil {
+				return nil, fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+		}
+		for _, name := range rule.Tags {
+			tag, ok := diagnosticTags[strings.ToLower(name)]
+			if !ok {
+				return nil, fmt.Errorf("rule %s: unknown tag %q", rule.ID, name)
+			}
+			rule.tags = append(rule.tags, tag)
+		}
+		if rule.Message == "" {
+			rule.Message = fmt.Sprintf("Matches rule %s", rule.ID)
+		}
+	}
+	return &rs, nil
+}
+
+// Check returns the matches of every rule in text.
+func (rs *RuleSet) Check(text string) []Match {
+	var matches []Match
+	for _, rule := range rs.Rules {
+		for _, loc := range rule.re.FindAllStringSubmatchIndex(text, -1) {
+			m := Match{
+				Rule:    rule,
+				Start:   loc[0],
+				End:     loc[1],
+				Message: string(rule.re.ExpandString(nil, rule.Message, text, loc)),
+			}
+			if rule.Fix != nil {
+				fix := string(rule.re.ExpandString(nil, *rule.Fix, text, loc))
+				m.Fix = &fix
+			}
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+// fixTitle returns the title of the quick fix of a match.
+func (m Match) fixTitle() string {
+	if m.Rule.FixTitle != "" {
+		return m.Rule.FixTitle
+	}
+	if *m.Fix == "" {
+		return "Remove match"
+	}
+	return fmt.Sprintf("Replace with %q", *m.Fix)
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Dictionary is a set of known words, matched case-insensitively.
+// Regular English inflections (plurals, -ed, -ing, -ly, -er, -est, possessives)
+// of a known word are accepted, so word lists only need base forms.
+type Dictionary struct {
+	mu    sync.RWMutex
+	words map[string]struct{}
+}
+
+// NewDictionary creates an empty dictionary.
+func NewDictionary() *Dictionary {
+	return &Dictionary{words: make(map[string]struct{})}
+}
+
+// Load adds the words read from r, one per line. Hunspell .dic files are supported:
+// the leading word count and the affix flags ("word/FLAGS") are skipped.
+// Affix rules are not applied, only the built-in inflections are.
+func (d *Dictionary) Load(r io.Reader) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	scanner := bufio.NewScanner(r)
+	first := true
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if first {
+			first = false
+			if isNumber(line) {
+				continue // Hunspell word count
+			}
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if i := strings.IndexByte(line, '/'); i != -1 {
+			line = line[:i]
+		}
+		if i := strings.IndexFunc(line, unicode.IsSpace); i != -1 {
+			line = line[:i] // Hunspell morphological fields
+		}
+		d.words[normalize(line)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// LoadFile adds the words of a word list file, see Load.
+func (d *Dictionary) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := d.Load(f); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// Add adds a word to the dictionary.
+func (d *Dictionary) Add(word string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.words[normalize(word)] = struct{}{}
+}
+
+// Len returns the number of words in the dictionary.
+func (d *Dictionary) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.words)
+}
+
+// Correct reports whether word is spelled correctly. Words the checker can't judge,
+// like numbers, single letters, acronyms and identifiers mixing cases, are accepted.
+func (d *Dictionary) Correct(word string) bool {
+	if skipWord(word) {
+		return true
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	// Hyphenated compounds are correct when every part is ("well-known")
+	for part := range strings.SplitSeq(normalize(word), "-") {
+		if part != "" && !d.known(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// known reports whether the lower-cased word or its base form is in the dictionary.
+// Caller must hold d.mu.
+func (d *Dictionary) known(word string) bool {
+	if _, ok := d.words[word]; ok {
+		return true
+	}
+	for _, base := range baseForms(word) {
+		if _, ok := d.words[base]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// inflections are suffix rules: a word ending with suffix may derive from stem+replacement.
+var inflections = []struct{ suffix, replacement string }{
+	{"'s", ""},
+	{"ies", "y"}, {"es", ""}, {"s", ""},
+	{"ied", "y"}, {"ed", ""}, {"ed", "e"}, {"d", ""},
+	{"ing", ""}, {"ing", "e"},
+	{"ily", "y"}, {"ly", ""}, {"ly", "le"},
+	{"ier", "y"}, {"er", ""}, {"er", "e"}, {"r", ""},
+	{"iest", "y"}, {"est", ""}, {"est", "e"}, {"st", ""},
+	{"ness", ""}, {"iness", "y"},
+}
+
+// baseForms returns the candidate base forms of an inflected word.
+func baseForms(word string) []string {
+	var bases []string
+	for _, rule := range inflections {
+		stem, ok := strings.CutSuffix(word, rule.suffix)
+		if !ok || len(stem) < 2 {
+			continue
+		}
+		bases = append(bases, stem+rule.replacement)
+		// Doubled final consonant: "stopped", "running", "bigger"
+		if n := len(stem); rule.replacement == "" && n >= 3 && stem[n-1] == stem[n-2] && !strings.ContainsRune("aeiou", rune(stem[n-1])) {
+			bases = append(bases, stem[:n-1])
+		}
+	}
+	// Possessive of an inflected word: "users'", "children's"
+	for _, possessive := range []string{"'s", "'"} {
+		if stem, ok := strings.CutSuffix(word, possessive); ok && len(stem) >= 2 {
+			bases = append(bases, stem)
+			bases = append(bases, baseForms(stem)...)
+		}
+	}
+	return bases
+}
+
+// Suggest returns up to max corrections for a misspelled word, closest first,
+// following the capitalization of word.
+func (d *Dictionary) Suggest(word string, max int) []string {
+	lower := normalize(word)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	type candidate struct {
+		distance int
+		exact    bool // In the dictionary as is, not through an inflection
+	}
+	candidates := make(map[string]candidate)
+	consider := func(s string, distance int) {
+		if _, seen := candidates[s]; seen || s == lower {
+			return
+		}
+		if _, ok := d.words[s]; ok {
+			candidates[s] = candidate{distance: distance, exact: true}
+		} else if d.inflectionOf(s, lower) {
+			candidates[s] = candidate{distance: distance}
+		}
+	}
+
+	edits := editsOf(lower)
+	for _, edit := range edits {
+		consider(edit, 1)
+	}
+	// Two edits away only when nothing is closer, it's a lot more candidates
+	if len(candidates) == 0 && utf8.RuneCountInString(lower) <= 12 {
+		for _, edit := range edits {
+			for _, edit2 := range editsOf(edit) {
+				consider(edit2, 2)
+			}
+		}
+	}
+
+	suggestions := make([]string, 0, len(candidates))
+	for s := range candidates {
+		suggestions = append(suggestions, s)
+	}
+	first, _ := utf8.DecodeRuneInString(lower)
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		ca, cb := candidates[a], candidates[b]
+		if ca.distance != cb.distance {
+			return ca.distance < cb.distance
+		}
+		if ca.exact != cb.exact {
+			return ca.exact
+		}
+		// Typos rarely affect the first letter
+		aFirst, _ := utf8.DecodeRuneInString(a)
+		bFirst, _ := utf8.DecodeRuneInString(b)
+		if (aFirst == first) != (bFirst == first) {
+			return aFirst == first
+		}
+		if len(a) != len(b) {
+			return len(a) == len(lower) // Prefer same length (substitutions, transpositions)
+		}
+		return a < b
+	})
+	if max > 0 && len(suggestions) > max {
+		suggestions = suggestions[:max]
+	}
+	for i, s := range suggestions {
+		suggestions[i] = matchCase(word, s)
+	}
+	return suggestions
+}
+
+// inflectionOf reports whether candidate is an inflection of a known word using
+// a suffix misspelled also ends with, so "recieved" suggests "received" but
+// "helo" doesn't suggest "helos". Caller must hold d.mu.
+func (d *Dictionary) inflectionOf(candidate, misspelled string) bool {
+	for _, rule := range inflections {
+		stem, ok := strings.CutSuffix(candidate, rule.suffix)
+		if !ok || len(stem) < 2 || !strings.HasSuffix(misspelled, rule.suffix) {
+			continue
+		}
+		if _, known := d.words[stem+rule.replacement]; known {
+			return true
+		}
+	}
+	return false
+}
+
+const alphabet = "abcdefghijklmnopqrstuvwxyz'"
+
+// editsOf returns the strings one deletion, transposition, substitution or insertion away from word.
+func editsOf(word string) []string {
+	runes := []rune(word)
+	edits := make([]string, 0, len(runes)*(2*len(alphabet)+2)+len(alphabet))
+	for i := range runes {
+		edits = append(edits, string(runes[:i])+string(runes[i+1:]))
+		if i+1 < len(runes) {
+			swapped := append([]rune(nil), runes...)
+			swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+			edits = append(edits, string(swapped))
+		}
+		for _, r := range alphabet {
+			if r != runes[i] {
+				edits = append(edits, string(runes[:i])+string(r)+string(runes[i+1:]))
+			}
+		}
+	}
+	for i := 0; i <= len(runes); i++ {
+		for _, r := range alphabet {
+			edits = append(edits, string(runes[:i])+string(r)+string(runes[i:]))
+		}
+	}
+	return edits
+}
+
+// normalize lower-cases word and uses ASCII apostrophes.
+func normalize(word string) string {
+	return strings.ToLower(strings.ReplaceAll(word, "’", "'"))
+}
+
+// matchCase applies the capitalization of model ("Word", "WORD") to word.
+func matchCase(model, word string) string {
+	if isUpper(model) && utf8.RuneCountInString(model) > 1 {
+		return strings.ToUpper(word)
+	}
+	first, _ := utf8.DecodeRuneInString(model)
+	if unicode.IsUpper(first) {
+		r, size := utf8.DecodeRuneInString(word)
+		return string(unicode.ToUpper(r)) + word[size:]
+	}
+	return word
+}
+
+// skipWord reports whether the checker should leave word alone.
+func skipWord(word string) bool {
+	if utf8.RuneCountInString(word) < 2 {
+		return true
+	}
+	upper := 0
+	for i, r := range word {
+		if unicode.IsDigit(r) || r == '_' {
+			return true
+		}
+		if unicode.IsUpper(r) {
+			upper++
+			if i > 0 && !isUpper(word) {
+				return true // camelCase or PascalCase identifier
+			}
+		}
+	}
+	return upper > 1 // Acronym, e.g. "LSP"
+}
+
+func isUpper(word string) bool {
+	for _, r := range word {
+		if unicode.IsLetter(r) && !unicode.IsUpper(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendWord adds word to the personal dictionary file at path, creating it if needed.
+func appendWord(path, word string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, word); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
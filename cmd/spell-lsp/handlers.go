@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/segment"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+const (
+	// diagnosticSource identifies our diagnostics among those of other servers.
+	diagnosticSource = "spell-lsp"
+	// commandAddToDictionary adds a word to the personal dictionary.
+	commandAddToDictionary = "spell/addToDictionary"
+	// maxSuggestions is the number of quick fixes offered per misspelling.
+	maxSuggestions = 5
+)
+
+// misspelling is attached to diagnostics as data, so code actions don't have to
+// extract the word from the document again.
+type misspelling struct {
+	Word string `json:"word"`
+}
+
+// AddWordArgs are the arguments of the add to dictionary command.
+type AddWordArgs struct {
+	Word string `json:"word" description:"Word to add to the personal dictionary."`
+}
+
+// analyzeDocument returns a diagnostic for each misspelled word of the document, run by
+// the analysis runner as documents are opened and changed.
+func analyzeDocument(ctx context.Context, snapshot *textdocument.Snapshot) ([]protocol.Diagnostic, error) {
+	return findMisspellings(snapshot.Mapper()), nil
+}
+
+// findMisspellings returns a diagnostic for each word of the text of mapper missing from
+// the dictionary.
+func findMisspellings(mapper *textdocument.Mapper) []protocol.Diagnostic {
+	var diagnostics []protocol.Diagnostic
+	for _, word := range segment.Words(mapper.Text()) {
+		if dictionary.Correct(word.Text) {
+			continue
+		}
+		rng, err := mapper.Range(word.Start, word.End)
+		if err != nil {
+			continue
+		}
+		data, _ := json.Marshal(misspelling{Word: word.Text})
+		diagnostics = append(diagnostics, protocol.Diagnostic{
+			Range:    rng,
+			Severity: protocol.SeverityInfo,
+			Code:     json.RawMessage(`"misspelling"`),
+			Source:   diagnosticSource,
+			Message:  fmt.Sprintf("Unknown word: %q", word.Text),
+			Data:     data,
+		})
+	}
+	return diagnostics
+}
+
+// handleCodeAction offers the corrections of the misspellings under the cursor,
+// and to add the word to the dictionary.
+func handleCodeAction(ctx context.Context, params *protocol.CodeActionParams) ([]protocol.CodeAction, error) {
+	if !params.Context.Accepts(protocol.QuickFix) {
+		return nil, nil
+	}
+	uri := params.TextDocument.URI
+
+	// The published diagnostics are the source of truth, the client may not send them all back
+	var actions []protocol.CodeAction
+	for _, diagnostic := range lspServer.Diagnostics().InRange(uri, params.Range) {
+		var m misspelling
+		if diagnostic.Source != diagnosticSource || json.Unmarshal(diagnostic.Data, &m) != nil {
+			continue
+		}
+
+		for i, suggestion := range dictionary.Suggest(m.Word, maxSuggestions) {
+			actions = append(actions, protocol.CodeAction{
+				Title:       fmt.Sprintf("Change to %q", suggestion),
+				Kind:        protocol.QuickFix,
+				Diagnostics: []protocol.Diagnostic{diagnostic},
+				IsPreferred: i == 0,
+				Edit: &protocol.WorkspaceEdit{
+					Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+						uri: {{Range: diagnostic.Range, NewText: suggestion}},
+					},
+				},
+			})
+		}
+
+		args, _ := json.Marshal(AddWordArgs{Word: m.Word})
+		title := fmt.Sprintf("Add %q to dictionary", m.Word)
+		actions = append(actions, protocol.CodeAction{
+			Title:       title,
+			Kind:        protocol.QuickFix,
+			Diagnostics: []protocol.Diagnostic{diagnostic},
+			Command: &protocol.Command{
+				Title:     title,
+				Command:   commandAddToDictionary,
+				Arguments: []json.RawMessage{args},
+			},
+		})
+	}
+	log.Printf("Code Action Request: %s Range: %v, %d actions", uri, params.Range, len(actions))
+	return actions, nil
+}
+
+// handleAddToDictionary adds a word to the dictionary, saves it in the personal
+// dictionary and checks the open documents again.
+func handleAddToDictionary(ctx context.Context, args *AddWordArgs) (any, error) {
+	word := strings.TrimSpace(args.Word)
+	if word == "" || strings.ContainsFunc(word, func(r rune) bool { return r == '\n' || r == ' ' }) {
+		return nil, jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf("invalid word: %q", args.Word))
+	}
+
+	dictionary.Add(word)
+	if personalDictionaryPath != "" {
+		if err := appendWord(personalDictionaryPath, word); err != nil {
+			// The word is still known until the server restarts
+			log.Printf("Error saving %q to %s: %v", word, personalDictionaryPath, err)
+		}
+	}
+	log.Printf("Added %q to dictionary", word)
+
+	analyses.Refresh()
+	return nil, nil
+}
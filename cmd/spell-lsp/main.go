@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akhenakh/lspgo/analysis"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// defaultWords is a small list of common English base forms, enough for a demo.
+// Point SPELL_DICTIONARY at a real word list for everyday use.
+//
+//go:embed words.txt
+var defaultWords string
+
+var (
+	// Colon separated word lists (plain or hunspell .dic) loaded on top of the embedded one,
+	// e.g. /usr/share/dict/words or /usr/share/hunspell/en_US.dic
+	dictionaryPaths = getEnv("SPELL_DICTIONARY", "")
+	// Words added with the add to dictionary command are saved there
+	personalDictionaryPath = getEnv("SPELL_PERSONAL_DICTIONARY", defaultPersonalDictionaryPath())
+)
+
+var (
+	dictionary = NewDictionary()
+	lspServer  *server.Server
+	// analyses checks the documents as they change, see analyzeDocument
+	analyses *analysis.Runner
+)
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func defaultPersonalDictionaryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "spell-lsp", "words.txt")
+}
+
+func main() {
+	ctx := context.Background()
+	logger := log.New(os.Stderr, "[spell-lsp] ", log.LstdFlags|log.Lshortfile)
+
+	if err := loadDictionaries(); err != nil {
+		logger.Fatalf("Failed to load dictionaries: %v", err)
+	}
+
+	lspServer = server.NewServer(server.WithLogger(logger))
+
+	analyses = analysis.NewRunner(lspServer, analysis.AnalyzerFunc(analyzeDocument))
+	analyses.Delay = 0 // Checking is local and fast, no need to debounce
+	analyses.Logger = logger
+	mustRegister(lspServer, protocol.MethodTextDocumentCodeAction, handleCodeAction)
+	lspServer.MustRegisterCommand(commandAddToDictionary, handleAddToDictionary)
+	if err := lspServer.DeclareCodeActionKinds(protocol.QuickFix); err != nil {
+		log.Fatalf("Failed to declare code action kinds: %v", err)
+	}
+
+	log.Println("Starting spell LSP server...")
+	log.Printf("Dictionary loaded: %d words, personal dictionary: %q", dictionary.Len(), personalDictionaryPath)
+
+	if err := lspServer.Run(ctx); err != nil {
+		logger.Fatalf("Server error: %v", err)
+	}
+	logger.Println("Server stopped.")
+}
+
+// loadDictionaries loads the embedded word list, then the configured and personal ones.
+func loadDictionaries() error {
+	if err := dictionary.Load(strings.NewReader(defaultWords)); err != nil {
+		return err
+	}
+	for _, path := range filepath.SplitList(dictionaryPaths) {
+		if err := dictionary.LoadFile(path); err != nil {
+			return err
+		}
+	}
+	if personalDictionaryPath == "" {
+		return nil
+	}
+	// The personal dictionary only exists once a word has been added
+	if err := dictionary.LoadFile(personalDictionaryPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func mustRegister(s *server.Server, method string, handler any) {
+	if err := s.Register(method, handler); err != nil {
+		log.Fatalf("Failed to register handler for %s: %v", method, err)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/segment"
+)
+
+// synonymData is attached to completion items, resolve uses it to add the documentation.
+type synonymData struct {
+	Synonym string `json:"synonym"`
+	Word    string `json:"word"` // The replaced word
+}
+
+// handleDidOpen stores the document.
+func handleDidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) error {
+	docMu.Lock()
+	documents[params.TextDocument.URI] = params.TextDocument
+	docMu.Unlock()
+	log.Printf("Document Opened: %s (Version: %d)", params.TextDocument.URI, params.TextDocument.Version)
+	return nil
+}
+
+// handleDidChange updates the stored document.
+func handleDidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
+	if len(params.ContentChanges) == 0 {
+		return nil
+	}
+	docMu.Lock()
+	defer docMu.Unlock()
+	item := documents[params.TextDocument.URI]
+	item.URI = params.TextDocument.URI
+	item.Version = params.TextDocument.Version
+	item.Text = params.ContentChanges[len(params.ContentChanges)-1].Text // Full sync
+	documents[item.URI] = item
+	return nil
+}
+
+// handleDidClose forgets the document.
+func handleDidClose(ctx context.Context, params *protocol.DidCloseTextDocumentParams) error {
+	docMu.Lock()
+	delete(documents, params.TextDocument.URI)
+	docMu.Unlock()
+	log.Printf("Document Closed: %s", params.TextDocument.URI)
+	return nil
+}
+
+// wordAt returns the word at pos in the document and its range.
+func wordAt(uri protocol.DocumentURI, pos protocol.Position) (string, protocol.Range, bool) {
+	docMu.RLock()
+	item, ok := documents[uri]
+	docMu.RUnlock()
+	if !ok {
+		return "", protocol.Range{}, false
+	}
+
+	lines := newLineIndex(item.Text)
+	offset := lines.offset(pos)
+	word, ok := segment.At(segment.Words(item.Text), offset)
+	if !ok {
+		return "", protocol.Range{}, false
+	}
+	return word.Text, protocol.Range{Start: lines.position(word.Start), End: lines.position(word.End)}, true
+}
+
+// handleHover shows the definitions and synonyms of the word under the cursor,
+// as markdown or plain text depending on what the client prefers.
+func handleHover(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
+	word, rng, ok := wordAt(params.TextDocument.URI, params.Position)
+	if !ok {
+		return nil, nil
+	}
+	senses := thesaurus.Lookup(word)
+	if len(senses) == 0 {
+		return nil, nil
+	}
+
+	kind := lspServer.ClientCapabilities().HoverContentFormat()
+	log.Printf("Hover Request: %q, %d senses (%s)", word, len(senses), kind)
+	return &protocol.Hover{
+		Contents: protocol.MarkupContent{Kind: kind, Value: formatSenses(strings.ToLower(word), senses, kind)},
+		Range:    &rng,
+	}, nil
+}
+
+// handleCompletion offers the synonyms of the word before the cursor as replacements.
+// Items are light, their documentation is added by completionItem/resolve.
+func handleCompletion(ctx context.Context, params *protocol.CompletionParams) (*protocol.CompletionList, error) {
+	list := &protocol.CompletionList{Items: []protocol.CompletionItem{}}
+	word, rng, ok := wordAt(params.TextDocument.URI, params.Position)
+	if !ok {
+		return list, nil
+	}
+	// Typing changes the word, hence the synonyms
+	list.IsIncomplete = true
+
+	synonyms, senses := thesaurus.Synonyms(word)
+	kind := protocol.Text
+	for i, synonym := range synonyms {
+		data, _ := json.Marshal(synonymData{Synonym: synonym, Word: word})
+		list.Items = append(list.Items, protocol.CompletionItem{
+			Label:  synonym,
+			Kind:   &kind,
+			Detail: fmt.Sprintf("%s, synonym of %s", senses[i].PartOfSpeech, strings.ToLower(word)),
+			// Clients filter items on the word being replaced, which synonyms don't look like
+			FilterText: word,
+			SortText:   fmt.Sprintf("%04d", i),
+			TextEdit:   &protocol.TextEdit{Range: rng, NewText: matchCase(word, synonym)},
+			Data:       data,
+		})
+	}
+	log.Printf("Completion Request: %q, %d synonyms", word, len(list.Items))
+	return list, nil
+}
+
+// handleCompletionResolve adds the documentation of a synonym: its own senses when the
+// thesaurus knows it, the sense it shares with the replaced word otherwise.
+func handleCompletionResolve(ctx context.Context, item *protocol.CompletionItem) (*protocol.CompletionItem, error) {
+	var data synonymData
+	if err := json.Unmarshal(item.Data, &data); err != nil {
+		return item, nil // Not one of ours, nothing to add
+	}
+
+	senses := thesaurus.Lookup(data.Synonym)
+	if len(senses) == 0 {
+		for _, sense := range thesaurus.Lookup(data.Word) {
+			for _, synonym := range sense.Synonyms {
+				if strings.EqualFold(synonym, data.Synonym) {
+					senses = append(senses, sense)
+				}
+			}
+		}
+	}
+	if len(senses) == 0 {
+		return item, nil
+	}
+
+	item.Documentation = lspServer.ClientCapabilities().CompletionDocumentation(func(kind protocol.MarkupKind) string {
+		return formatSenses(strings.ToLower(data.Synonym), senses, kind)
+	})
+	return item, nil
+}
+
+// formatSenses renders the senses of word.
+func formatSenses(word string, senses []Sense, kind protocol.MarkupKind) string {
+	var sb strings.Builder
+	if kind == protocol.Markdown {
+		fmt.Fprintf(&sb, "**%s**\n", word)
+		for i, sense := range senses {
+			fmt.Fprintf(&sb, "\n%d. *%s* %s", i+1, sense.PartOfSpeech, sense.Definition)
+			if sense.Example != "" {
+				fmt.Fprintf(&sb, "  \n   _\"%s\"_", sense.Example)
+			}
+			if synonyms := otherSynonyms(word, sense); len(synonyms) > 0 {
+				fmt.Fprintf(&sb, "  \n   Synonyms: %s", strings.Join(synonyms, ", "))
+			}
+		}
+		return sb.String()
+	}
+
+	sb.WriteString(word)
+	sb.WriteString("\n")
+	for i, sense := range senses {
+		fmt.Fprintf(&sb, "\n%d. (%s) %s", i+1, sense.PartOfSpeech, sense.Definition)
+		if sense.Example != "" {
+			fmt.Fprintf(&sb, "\n   \"%s\"", sense.Example)
+		}
+		if synonyms := otherSynonyms(word, sense); len(synonyms) > 0 {
+			fmt.Fprintf(&sb, "\n   Synonyms: %s", strings.Join(synonyms, ", "))
+		}
+	}
+	return sb.String()
+}
+
+// otherSynonyms returns the words of the sense other than word, including its lemma.
+func otherSynonyms(word string, sense Sense) []string {
+	var synonyms []string
+	for _, s := range append([]string{sense.Lemma}, sense.Synonyms...) {
+		if !strings.EqualFold(s, word) {
+			synonyms = append(synonyms, s)
+		}
+	}
+	return synonyms
+}
+
+// matchCase capitalizes word like model, e.g. at the start of a sentence.
+func matchCase(model, word string) string {
+	first, _ := utf8.DecodeRuneInString(model)
+	if !unicode.IsUpper(first) {
+		return word
+	}
+	r, size := utf8.DecodeRuneInString(word)
+	return string(unicode.ToUpper(r)) + word[size:]
+}
+
+// lineIndex converts between byte offsets and LSP positions, counting characters in UTF-16 code units.
+type lineIndex struct {
+	text   string
+	starts []int // Byte offset of each line start
+}
+
+func newLineIndex(text string) *lineIndex {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &lineIndex{text: text, starts: starts}
+}
+
+func (l *lineIndex) position(offset int) protocol.Position {
+	line := sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > offset }) - 1
+	character := 0
+	for _, r := range l.text[l.starts[line]:offset] {
+		character += utf16.RuneLen(r)
+	}
+	return protocol.Position{Line: uint(line), Character: uint(character)}
+}
+
+// offset returns the byte offset of pos, clamped to the line and text bounds.
+func (l *lineIndex) offset(pos protocol.Position) int {
+	if int(pos.Line) >= len(l.starts) {
+		return len(l.text)
+	}
+	offset := l.starts[pos.Line]
+	character := uint(0)
+	for i, r := range l.text[offset:] {
+		if r == '\n' || character >= pos.Character {
+			return offset + i
+		}
+		character += uint(utf16.RuneLen(r))
+	}
+	return len(l.text)
+}
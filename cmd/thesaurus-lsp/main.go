@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// defaultDatabase is a small sample, THESAURUS_DB can point to larger databases.
+//
+//go:embed thesaurus.tsv
+var defaultDatabase string
+
+// Colon separated thesaurus databases loaded on top of the embedded one
+var databasePaths = os.Getenv("THESAURUS_DB")
+
+var (
+	// Store open documents in memory
+	documents = make(map[protocol.DocumentURI]protocol.TextDocumentItem)
+	docMu     sync.RWMutex // Protects access to the documents map
+
+	thesaurus = NewThesaurus()
+	lspServer *server.Server
+)
+
+func main() {
+	ctx := context.Background()
+	logger := log.New(os.Stderr, "[thesaurus-lsp] ", log.LstdFlags|log.Lshortfile)
+
+	if err := thesaurus.Load(strings.NewReader(defaultDatabase)); err != nil {
+		logger.Fatalf("Failed to load embedded thesaurus: %v", err)
+	}
+	for _, path := range filepath.SplitList(databasePaths) {
+		if err := thesaurus.LoadFile(path); err != nil {
+			logger.Fatalf("Failed to load thesaurus: %v", err)
+		}
+	}
+
+	lspServer = server.NewServer(server.WithLogger(logger))
+
+	mustRegister(lspServer, protocol.MethodTextDocumentDidOpen, handleDidOpen)
+	mustRegister(lspServer, protocol.MethodTextDocumentDidChange, handleDidChange)
+	mustRegister(lspServer, protocol.MethodTextDocumentDidClose, handleDidClose)
+	mustRegister(lspServer, protocol.MethodTextDocumentHover, handleHover)
+	mustRegister(lspServer, protocol.MethodTextDocumentCompletion, handleCompletion)
+	mustRegister(lspServer, protocol.MethodCompletionItemResolve, handleCompletionResolve)
+
+	log.Println("Starting thesaurus LSP server...")
+	log.Printf("Thesaurus loaded: %d words", thesaurus.Len())
+
+	if err := lspServer.Run(ctx); err != nil {
+		logger.Fatalf("Server error: %v", err)
+	}
+	logger.Println("Server stopped.")
+}
+
+func mustRegister(s *server.Server, method string, handler any) {
+	if err := s.Register(method, handler); err != nil {
+		log.Fatalf("Failed to register handler for %s: %v", method, err)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Sense is one meaning of a word, like a WordNet synset seen from one of its words.
+type Sense struct {
+	Lemma        string
+	PartOfSpeech string
+	Synonyms     []string
+	Definition   string
+	Example      string
+}
+
+// Thesaurus maps lower-cased words to their senses.
+type Thesaurus struct {
+	mu     sync.RWMutex
+	senses map[string][]Sense
+}
+
+// NewThesaurus creates an empty thesaurus.
+func NewThesaurus() *Thesaurus {
+	return &Thesaurus{senses: make(map[string][]Sense)}
+}
+
+// Load reads a tab separated database, one sense per line:
+//
+//	lemma <TAB> part of speech <TAB> comma separated synonyms <TAB> definition [<TAB> example]
+//
+// Empty lines and lines starting with # are ignored.
+func (t *Thesaurus) Load(r io.Reader) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) < 4 {
+			return fmt.Errorf("line %d: expected at least 4 tab separated fields, got %d", lineNum, len(fields))
+		}
+		sense := Sense{
+			Lemma:        strings.TrimSpace(fields[0]),
+			PartOfSpeech: strings.TrimSpace(fields[1]),
+			Definition:   strings.TrimSpace(fields[3]),
+		}
+		for _, synonym := range strings.Split(fields[2], ",") {
+			if synonym = strings.TrimSpace(synonym); synonym != "" {
+				sense.Synonyms = append(sense.Synonyms, synonym)
+			}
+		}
+		if len(fields) > 4 {
+			sense.Example = strings.TrimSpace(fields[4])
+		}
+		key := strings.ToLower(sense.Lemma)
+		t.senses[key] = append(t.senses[key], sense)
+	}
+	return scanner.Err()
+}
+
+// LoadFile adds the senses of a database file, see Load.
+func (t *Thesaurus) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := t.Load(f); err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	return nil
+}
+
+// Lookup returns the senses of a word.
+func (t *Thesaurus) Lookup(word string) []Sense {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.senses[strings.ToLower(word)]
+}
+
+// Len returns the number of words having senses.
+func (t *Thesaurus) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.senses)
+}
+
+// Synonyms returns the synonyms of all the senses of a word without duplicates,
+// with the sense each one comes from.
+func (t *Thesaurus) Synonyms(word string) ([]string, []Sense) {
+	var synonyms []string
+	var senses []Sense
+	seen := make(map[string]bool)
+	for _, sense := range t.Lookup(word) {
+		for _, synonym := range sense.Synonyms {
+			key := strings.ToLower(synonym)
+			if seen[key] || strings.EqualFold(synonym, word) {
+				continue
+			}
+			seen[key] = true
+			synonyms = append(synonyms, synonym)
+			senses = append(senses, sense)
+		}
+	}
+	return synonyms, senses
+}
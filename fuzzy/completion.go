@@ -0,0 +1,39 @@
+package fuzzy
+
+import "github.com/akhenakh/lspgo/protocol"
+
+// FilterCompletionItems returns the items matching pattern, best matches first.
+// Items are matched on their FilterText, or their Label when FilterText is empty,
+// as clients do. Use it when answering with a complete list (isIncomplete: false)
+// would send too many items.
+func FilterCompletionItems(pattern string, items []protocol.CompletionItem) []protocol.CompletionItem {
+	candidates := make([]string, len(items))
+	for i, item := range items {
+		candidates[i] = item.FilterText
+		if candidates[i] == "" {
+			candidates[i] = item.Label
+		}
+	}
+
+	results := Filter(pattern, candidates)
+	filtered := make([]protocol.CompletionItem, 0, len(results))
+	for _, r := range results {
+		filtered = append(filtered, items[r.Index])
+	}
+	return filtered
+}
+
+// FilterSymbols returns the symbols whose name matches pattern, best matches first.
+func FilterSymbols(pattern string, symbols []protocol.SymbolInformation) []protocol.SymbolInformation {
+	candidates := make([]string, len(symbols))
+	for i, sym := range symbols {
+		candidates[i] = sym.Name
+	}
+
+	results := Filter(pattern, candidates)
+	filtered := make([]protocol.SymbolInformation, 0, len(results))
+	for _, r := range results {
+		filtered = append(filtered, symbols[r.Index])
+	}
+	return filtered
+}
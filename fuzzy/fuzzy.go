@@ -0,0 +1,194 @@
+// Package fuzzy implements the fuzzy matching used to filter completion items and
+// workspace symbols server-side, following the behaviour editors like VS Code expect:
+//
+//   - pattern characters must appear in order in the candidate (subsequence match),
+//   - the first pattern character must match at the start of the candidate or of a word,
+//   - matching is smart-case: lowercase pattern characters match both cases,
+//     uppercase ones only match uppercase,
+//   - prefix, word start (camelCase, snake_case, dotted, paths) and consecutive
+//     matches score higher.
+package fuzzy
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scoring weights.
+const (
+	scoreMatch       = 1
+	bonusStart       = 8 // Match on the first candidate character
+	bonusWordStart   = 5 // Match after a separator or on a camelCase hump
+	bonusConsecutive = 6 // Match right after the previous match, a contiguous match beats a scattered one
+	bonusExactCase   = 1 // Same case as the pattern character
+	bonusExact       = 2 // The pattern matches the whole candidate
+)
+
+// Match scores candidate against pattern. ok is false when candidate doesn't match.
+// An empty pattern matches everything with a score of 0.
+func Match(pattern, candidate string) (score int, ok bool) {
+	score, _, ok = MatchPositions(pattern, candidate)
+	return score, ok
+}
+
+// MatchPositions is like Match and also returns the indexes of the matched runes in
+// candidate, which clients can use to highlight the match.
+func MatchPositions(pattern, candidate string) (score int, positions []int, ok bool) {
+	if pattern == "" {
+		return 0, nil, true
+	}
+	p := []rune(pattern)
+	c := []rune(candidate)
+	if len(p) > len(c) {
+		return 0, nil, false
+	}
+
+	// best[i][j] is the best score matching p[:i+1] with p[i] on c[j], -1 if impossible.
+	// from[i][j] is the position of p[i-1] in that best alignment.
+	n, m := len(p), len(c)
+	best := make([][]int, n)
+	from := make([][]int, n)
+	for i := range best {
+		best[i] = make([]int, m)
+		from[i] = make([]int, m)
+		for j := range best[i] {
+			best[i][j] = -1
+		}
+	}
+
+	for j := 0; j < m; j++ {
+		if !runeMatches(p[0], c[j]) || !isWordStart(c, j) {
+			continue // First character must match a word start
+		}
+		best[0][j] = charScore(p[0], c, j)
+	}
+
+	for i := 1; i < n; i++ {
+		// Running max of best[i-1][k] for k < j
+		prevMax, prevMaxAt := -1, -1
+		for j := i; j < m; j++ {
+			if best[i-1][j-1] > prevMax {
+				prevMax, prevMaxAt = best[i-1][j-1], j-1
+			}
+			if !runeMatches(p[i], c[j]) || prevMax < 0 {
+				continue
+			}
+			base, at := prevMax, prevMaxAt
+			// A consecutive match may beat the best earlier alignment
+			if best[i-1][j-1] >= 0 && best[i-1][j-1]+bonusConsecutive > base {
+				base, at = best[i-1][j-1]+bonusConsecutive, j-1
+			}
+			best[i][j] = base + charScore(p[i], c, j)
+			from[i][j] = at
+		}
+	}
+
+	last, lastAt := -1, -1
+	for j := 0; j < m; j++ {
+		if best[n-1][j] > last {
+			last, lastAt = best[n-1][j], j
+		}
+	}
+	if last < 0 {
+		return 0, nil, false
+	}
+	if n == m {
+		last += bonusExact // Ranked above the longer candidates it is a prefix of
+	}
+
+	positions = make([]int, n)
+	for i, j := n-1, lastAt; i >= 0; i-- {
+		positions[i] = j
+		j = from[i][j]
+	}
+	return last, positions, true
+}
+
+// charScore scores the match of pattern rune r on c[j].
+func charScore(r rune, c []rune, j int) int {
+	score := scoreMatch
+	if j == 0 {
+		score += bonusStart
+	} else if isWordStart(c, j) {
+		score += bonusWordStart
+	}
+	if r == c[j] {
+		score += bonusExactCase
+	}
+	return score
+}
+
+// runeMatches implements smart-case comparison.
+func runeMatches(p, c rune) bool {
+	if unicode.IsUpper(p) {
+		return p == c
+	}
+	return p == unicode.ToLower(c)
+}
+
+// isWordStart reports whether c[j] starts a word.
+func isWordStart(c []rune, j int) bool {
+	if j == 0 {
+		return true
+	}
+	prev, cur := c[j-1], c[j]
+	switch prev {
+	case '_', '-', '.', '/', '\\', ':', ' ', '$', '#', '@', '(', '<', '[':
+		return !isSeparator(cur)
+	}
+	if unicode.IsUpper(cur) && !unicode.IsUpper(prev) {
+		return true // camelCase hump
+	}
+	if unicode.IsDigit(cur) && !unicode.IsDigit(prev) {
+		return true
+	}
+	return false
+}
+
+func isSeparator(r rune) bool {
+	return strings.ContainsRune("_-./\\: $#@(<[", r)
+}
+
+// HasPrefix reports whether candidate starts with prefix using smart-case comparison.
+// It is the cheap filter to use when the client only expects prefix matches.
+func HasPrefix(candidate, prefix string) bool {
+	c := []rune(candidate)
+	p := []rune(prefix)
+	if len(p) > len(c) {
+		return false
+	}
+	for i, r := range p {
+		if !runeMatches(r, c[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Result is a matching candidate returned by Filter.
+type Result struct {
+	// Index of the candidate in the filtered slice.
+	Index int
+	// Score of the match, higher is better.
+	Score int
+	// Positions of the matched runes in the candidate.
+	Positions []int
+}
+
+// Filter returns the candidates matching pattern, best matches first.
+// Candidates with equal scores keep their original order.
+func Filter(pattern string, candidates []string) []Result {
+	results := make([]Result, 0, len(candidates))
+	for i, candidate := range candidates {
+		score, positions, ok := MatchPositions(pattern, candidate)
+		if !ok {
+			continue
+		}
+		results = append(results, Result{Index: i, Score: score, Positions: positions})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	return results
+}
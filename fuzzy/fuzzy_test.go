@@ -0,0 +1,67 @@
+package fuzzy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatchSmartCase(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, candidate string
+		want               bool
+	}{
+		{"foo", "FooBar", true},
+		{"Foo", "FooBar", true},
+		{"Foo", "fooBar", false},
+		{"fB", "fooBar", true},
+		{"fB", "foobar", false},
+		{"", "anything", true},
+		{"abc", "ab", false},
+	} {
+		if _, ok := Match(tt.pattern, tt.candidate); ok != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.candidate, ok, tt.want)
+		}
+	}
+}
+
+func TestMatchWordStarts(t *testing.T) {
+	for _, tt := range []struct {
+		pattern, candidate string
+		want               bool
+		positions          []int
+	}{
+		{"gfb", "getFooBar", true, []int{0, 3, 6}},
+		{"sn", "snake_name", true, []int{0, 1}},
+		{"nm", "snake_name", true, []int{6, 8}},
+		{"bar", "foo.bar", true, []int{4, 5, 6}},
+		{"u", "pkg/util.go", true, []int{4}},
+		{"ake", "snake_name", false, nil}, // The first character must start a word
+	} {
+		_, positions, ok := MatchPositions(tt.pattern, tt.candidate)
+		if ok != tt.want || !slices.Equal(positions, tt.positions) {
+			t.Errorf("MatchPositions(%q, %q) = %v %v, want %v %v", tt.pattern, tt.candidate, positions, ok, tt.positions, tt.want)
+		}
+	}
+}
+
+func TestFilterRanking(t *testing.T) {
+	for _, tt := range []struct {
+		pattern    string
+		candidates []string
+		want       []string // Best first
+	}{
+		{"abc", []string{"a_b_c", "abc"}, []string{"abc", "a_b_c"}},
+		{"abc", []string{"xabc", "a_b_c", "abcdef", "abc"}, []string{"abc", "abcdef", "a_b_c"}},
+		{"fb", []string{"fxxxxb", "fooBar"}, []string{"fooBar", "fxxxxb"}},
+		{"Foo", []string{"foo", "Foo"}, []string{"Foo"}},
+		{"foo", []string{"FOO", "foo"}, []string{"foo", "FOO"}},
+	} {
+		var got []string
+		for _, r := range Filter(tt.pattern, tt.candidates) {
+			got = append(got, tt.candidates[r.Index])
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Filter(%q, %q) = %q, want %q", tt.pattern, tt.candidates, got, tt.want)
+		}
+	}
+}
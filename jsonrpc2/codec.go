@@ -0,0 +1,25 @@
+package jsonrpc2
+
+import "encoding/json"
+
+// Codec encodes and decodes the JSON of messages. Implementations must behave like
+// encoding/json for the types they are given, including json.RawMessage and types
+// implementing json.Marshaler or json.Unmarshaler, and be safe for concurrent use.
+// It lets high-throughput deployments plug a faster JSON library.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// StdCodec is the Codec of the encoding/json package, the default.
+type StdCodec struct{}
+
+// Marshal encodes v with json.Marshal.
+func (StdCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes data into v with json.Unmarshal.
+func (StdCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
@@ -1,31 +1,58 @@
 package jsonrpc2
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"runtime"
 	"sync"
+	"time"
 )
 
 // Conn manages reading/writing JSON-RPC messages via a Stream.
+//
+// Notifications are queued and written by a background flush, so that a burst of them
+// (e.g. diagnostics published for many files) goes out in a single write call, each
+// message still framed on its own. Requests and responses flush the queue and are
+// written before Write returns.
 type Conn struct {
 	stream *Stream
-	mu     sync.Mutex // Protects concurrent writes
+	mu     sync.Mutex // Protects the fields below
 	closed bool
+
+	pending   bytes.Buffer  // Framed messages waiting to be written
+	writing   int           // Size of the messages being written, see Buffered
+	drained   chan struct{} // Closed when a write completes, see WaitWritable
+	scheduled bool          // A background flush is scheduled
+	waited    bool          // pending holds a request or response, its writer waits for the flush
+	writeErr  error         // First write error, returned by the following writes
+	writeMu   sync.Mutex    // Serializes writes to the stream
+
+	stats          connStats
+	stallThreshold time.Duration    // See SetWriteStallHandler
+	onStall        func(WriteStall) // Optional
+	onFlushError   func(error)      // Optional, see SetFlushErrorHandler
+
+	ids IDGenerator // See SetIDGenerator
 }
 
 // NewConn creates a new connection manager.
 func NewConn(stream *Stream) *Conn {
 	return &Conn{
 		stream: stream,
+		ids:    &SequentialIDs{},
 	}
 }
 
 // Read decodes the next message from the stream.
 // It blocks until a message is received or an error occurs.
-// Handles context cancellation during the read operation if the underlying stream supports it implicitly (less likely)
-// or explicitly checks context before/after blocking read. The primary use here is to unblock Run loop.
+// When the stream supports deadlines, like a net.Conn, the read is interrupted when ctx is
+// cancelled or past its deadline and ctx.Err() is returned. The connection stays usable if
+// no byte of the next message was read yet, and is closed otherwise, its stream being left
+// in the middle of a message. Other streams only check ctx before blocking.
 func (c *Conn) Read(ctx context.Context) (interface{}, error) {
 	// Check context before blocking read
 	select {
@@ -35,78 +62,332 @@ func (c *Conn) Read(ctx context.Context) (interface{}, error) {
 	}
 
 	// Read raw bytes
-	jsonData, err := c.stream.ReadMessage()
+	buffered, read := c.stream.buffered(), c.stream.bytesRead.Load()
+	var jsonData []byte
+	err := c.stream.withDeadline(ctx, deadliner.SetReadDeadline, func() (err error) {
+		jsonData, err = c.stream.readMessage(false)
+		return err
+	})
 	if err != nil {
+		var msgErr *MessageError
+		if errors.As(err, &msgErr) {
+			return nil, err // The stream resynchronized on the next message
+		}
+		if interrupted(err) && buffered == 0 && c.stream.bytesRead.Load() == read {
+			return nil, err // Interrupted while waiting for the next message
+		}
 		c.mu.Lock()
 		c.closed = true // Assume fatal error or EOF closes connection
 		c.mu.Unlock()
 		return nil, err // e.g., io.EOF, format errors
 	}
 
-	// Determine message type (Request, Response, or Notification)
-	// We need to partially decode to find "method" and "id" fields.
-	var base struct {
-		JSONRPC string          `json:"jsonrpc"`
-		ID      json.RawMessage `json:"id"`
-		Method  string          `json:"method"`
+	msg, err := decodeMessage(c.stream.codec, jsonData)
+	if err != nil {
+		// The body may not match its Content-Length, the stream is resynchronized if so
+		framed, framingErr := c.stream.checkFraming(jsonData)
+		switch {
+		case framingErr != nil:
+			err = framingErr
+		case len(framed) < len(jsonData):
+			msg, err = decodeMessage(c.stream.codec, framed)
+		}
 	}
-	if err := json.Unmarshal(jsonData, &base); err != nil {
-		return nil, NewError(ParseError, fmt.Sprintf("failed to parse base message: %v", err))
+	if err == nil {
+		c.stats.count(&c.stats.received, messageMethod(msg))
 	}
+	return msg, err
+}
 
-	if base.Method != "" {
-		if len(base.ID) > 0 && string(base.ID) != "null" {
-			// It's a Request
-			var req RequestMessage
-			if err := json.Unmarshal(jsonData, &req); err != nil {
-				return nil, NewError(ParseError, fmt.Sprintf("failed to parse request message: %v", err))
-			}
-			return &req, nil
+// envelope has the fields of all message types, so that a message is decoded in a single pass
+// whatever its type. Params and results stay raw, handlers decode them into their own types.
+type envelope struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Result  json.RawMessage `json:"result"`
+	Error   *ErrorObject    `json:"error"`
+}
+
+// MessageError is returned by Read for a message which is not valid JSON, not a valid
+// JSON-RPC message, or doesn't match its Content-Length. The stream is still in sync, or
+// resynchronized on the next header, the next message can be read.
+type MessageError struct {
+	Err *ErrorObject // ParseError or InvalidRequest
+	// ID is the ID of the message when it could be recovered, so that it can be answered
+	// with Err. nil otherwise.
+	ID json.RawMessage
+}
+
+func (e *MessageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+// decodeMessage decodes a request, notification or response.
+func decodeMessage(codec Codec, data []byte) (any, error) {
+	var env envelope
+	if err := codec.Unmarshal(data, &env); err != nil {
+		code := ParseError
+		if json.Valid(data) {
+			code = InvalidRequest // Valid JSON with members of the wrong type
 		}
-		// It's a Notification
-		var ntf NotificationMessage
-		if err := json.Unmarshal(jsonData, &ntf); err != nil {
-			return nil, NewError(ParseError, fmt.Sprintf("failed to parse notification message: %v", err))
+		return nil, &MessageError{
+			Err: NewError(code, fmt.Sprintf("failed to parse message: %v", err)),
+			ID:  recoverID(data),
 		}
-		return &ntf, nil
 	}
+	hasID := len(env.ID) > 0 && string(env.ID) != "null"
 
-	// It must be a Response (we don't expect to *receive* responses in a server context,
-	// but a generic Conn should handle it). Could also be an error during parsing.
-	if len(base.ID) > 0 && string(base.ID) != "null" {
-		var resp ResponseMessage
-		if err := json.Unmarshal(jsonData, &resp); err != nil {
-			return nil, NewError(ParseError, fmt.Sprintf("failed to parse response message: %v", err))
-		}
-		return &resp, nil
+	switch {
+	case env.Method != "" && hasID:
+		return &RequestMessage{JSONRPC: env.JSONRPC, ID: env.ID, Method: env.Method, Params: env.Params}, nil
+	case env.Method != "":
+		return &NotificationMessage{JSONRPC: env.JSONRPC, Method: env.Method, Params: env.Params}, nil
+	case hasID:
+		// Responses answer the requests this side sent
+		return &ResponseMessage{JSONRPC: env.JSONRPC, ID: env.ID, Result: env.Result, Error: env.Error}, nil
 	}
 
 	// Invalid message structure
-	return nil, NewError(InvalidRequest, "message is not a valid request, notification, or response")
+	return nil, &MessageError{Err: NewError(InvalidRequest, "message is not a valid request, notification, or response")}
+}
 
+// recoverID looks for the ID of a message which failed to decode, scanning the members of
+// the top level object up to the syntax error. It returns nil if the ID is not found before.
+func recoverID(data []byte) json.RawMessage {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil
+		}
+		if key == "id" {
+			// Only numbers and strings are valid IDs
+			if len(value) > 0 && (value[0] == '"' || value[0] == '-' || (value[0] >= '0' && value[0] <= '9')) {
+				return value
+			}
+			return nil
+		}
+	}
+	return nil
 }
 
 // Write encodes and sends a message (Request, Response, Notification) to the stream.
-// It is safe for concurrent use. Handles context cancellation before writing.
+// It is safe for concurrent use and keeps the order of the calls. Handles context cancellation before writing,
+// and while writing requests and responses to a stream supporting deadlines (see Read): the
+// error of an interrupted write wraps ctx.Err(), the connection stays usable and the message,
+// if it was started, is still written in the background.
+// A notification is only queued: when the background write fails, it is dropped and the error
+// is passed to the handler set with SetFlushErrorHandler.
 func (c *Conn) Write(ctx context.Context, msg interface{}) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
 
+	// Encode outside the lock, concurrent writers don't wait for each other's encoding
+	data, err := c.stream.frame(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
 	if c.closed {
+		c.mu.Unlock()
 		return io.ErrClosedPipe
 	}
+	if c.writeErr != nil {
+		c.mu.Unlock()
+		return c.writeErr
+	}
+	c.pending.Write(data)
+	c.stats.count(&c.stats.sent, messageMethod(msg))
+	if _, ok := msg.(*NotificationMessage); ok {
+		if !c.scheduled {
+			c.scheduled = true
+			go func() {
+				// Let the goroutines producing the burst run before writing
+				runtime.Gosched()
+				c.flushQueued()
+			}()
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	c.waited = true
+	c.mu.Unlock()
+	return c.flush(ctx, false)
+}
+
+// SetFlushErrorHandler calls fn with the error of a background write of queued
+// notifications. Nobody waits for them, they are dropped and the connection stays usable
+// unless the stream was left in the middle of a message. Without a handler the error is
+// ignored. fn must not write to the connection. Call it before the connection is used.
+func (c *Conn) SetFlushErrorHandler(fn func(error)) {
+	c.onFlushError = fn
+}
+
+// Flush writes the queued messages.
+func (c *Conn) Flush() error {
+	return c.flush(context.Background(), false)
+}
+
+// flushQueued writes the queued messages in the background, see SetFlushErrorHandler.
+func (c *Conn) flushQueued() {
+	c.flush(context.Background(), true) //nolint:errcheck // Passed to onFlushError
+}
+
+// flush writes the queued messages, interrupted by ctx when the stream supports deadlines.
+// An interrupted write only fails for the caller: the bytes not written yet, which may be
+// the rest of a message, are queued again in front of the others so that no message is cut,
+// and written by a background flush. Other write errors fail the connection, but for those
+// of a background flush of notifications only, see SetFlushErrorHandler.
+func (c *Conn) flush(ctx context.Context, background bool) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.mu.Lock()
+	c.scheduled = false
+	if c.writeErr != nil || c.pending.Len() == 0 {
+		err := c.writeErr
+		c.mu.Unlock()
+		return err
+	}
+	data := bytes.Clone(c.pending.Bytes())
+	waited := c.waited
+	c.pending.Reset()
+	c.waited = false
+	c.writing = len(data)
+	c.mu.Unlock()
 
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+	start := time.Now()
+	stop := c.watchWrite(start)
+	var written int
+	err := c.stream.withDeadline(ctx, deadliner.SetWriteDeadline, func() (err error) {
+		written, err = c.stream.write(data)
+		return err
+	})
+	c.stats.recordWrite(time.Since(start), stop())
+	c.mu.Lock()
+	c.writing = 0
+	switch {
+	case interrupted(err) && c.closed:
+		// Close gave up on the flush, the rest is dropped
+	case interrupted(err):
+		rest := append(data[written:], c.pending.Bytes()...)
+		c.pending.Reset()
+		c.pending.Write(rest)
+		c.waited = c.waited || waited
+		if !c.scheduled {
+			c.scheduled = true
+			go c.flushQueued()
+		}
+		err = fmt.Errorf("write interrupted: %w", err)
+	case err != nil && background && written == 0 && !waited:
+		// The next write tries the stream again and gets its own error if it is broken
+	case err != nil:
+		c.writeErr = err
 	}
+	if c.drained != nil {
+		close(c.drained) // Wake up WaitWritable, also on errors
+		c.drained = nil
+	}
+	c.mu.Unlock()
+	if err != nil && background && c.onFlushError != nil {
+		c.onFlushError(err)
+	}
+	return err
+}
 
-	return c.stream.WriteMessage(msg)
+// Buffered returns the size in bytes of the messages written but not yet accepted by the
+// stream: queued notifications, and the messages a slow peer is still reading.
+func (c *Conn) Buffered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pending.Len() + c.writing
 }
 
-// Close closes the underlying stream.
+// WaitWritable blocks until at most limit bytes are Buffered, so that a producer of many
+// messages (e.g. partial results) paces itself to the peer instead of queuing them all in
+// memory. It returns the write error if the connection failed, or ctx.Err().
+func (c *Conn) WaitWritable(ctx context.Context, limit int) error {
+	for {
+		c.mu.Lock()
+		switch {
+		case c.writeErr != nil:
+			c.mu.Unlock()
+			return c.writeErr
+		case c.closed:
+			c.mu.Unlock()
+			return io.ErrClosedPipe
+		case c.pending.Len()+c.writing <= limit:
+			c.mu.Unlock()
+			return nil
+		}
+		if c.drained == nil {
+			c.drained = make(chan struct{})
+		}
+		drained := c.drained
+		if !c.scheduled && c.writing == 0 {
+			// Queued notifications with no flush on the way, e.g. after a failed one
+			c.scheduled = true
+			go c.flushQueued()
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Closed reports whether the connection is closed, by Close or after a read or write error.
+func (c *Conn) Closed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed || c.writeErr != nil
+}
+
+// Codec returns the codec of the messages, handlers can use it to decode params and encode results.
+func (c *Conn) Codec() Codec {
+	return c.stream.codec
+}
+
+// closeFlushTimeout bounds the flush of the queued messages by Close, see Close.
+const closeFlushTimeout = 100 * time.Millisecond
+
+// Close closes the underlying stream. The queued messages are flushed first, for at most
+// closeFlushTimeout: a peer which stopped reading doesn't block Close, what is left is
+// dropped and the stream closed, which also ends a write blocked on it.
 func (c *Conn) Close() error {
+	// Queued notifications are best effort once closing
+	ctx, cancel := context.WithTimeout(context.Background(), closeFlushTimeout)
+	defer cancel()
+	flushed := make(chan struct{})
+	go func() {
+		c.flush(ctx, false) //nolint:errcheck
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-ctx.Done(): // The stream has no deadlines, its write is ended by closing it
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -114,6 +395,12 @@ func (c *Conn) Close() error {
 		return nil // Already closed
 	}
 	c.closed = true
+	c.pending.Reset() // Not flushed in time
+	c.waited = false
+	if c.drained != nil {
+		close(c.drained) // WaitWritable returns io.ErrClosedPipe
+		c.drained = nil
+	}
 
 	// Use the Stream's Close method which handles the original source
 	return c.stream.Close()
@@ -0,0 +1,235 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestInterruptedWriteKeepsConn checks a write interrupted by its context, after part of the
+// message went out, fails for its caller only: the message reaches the peer whole, and the
+// following writes succeed.
+func TestInterruptedWriteKeepsConn(t *testing.T) {
+	local, peer := net.Pipe()
+	defer local.Close()
+	defer peer.Close()
+	conn := NewConn(NewStream(local))
+
+	// A few bytes of the first message are read, then the peer stalls
+	head := make(chan []byte)
+	go func() {
+		buf := make([]byte, 10)
+		n, _ := io.ReadFull(peer, buf)
+		head <- buf[:n]
+	}()
+
+	ctx := context.Background()
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err := conn.Write(timeoutCtx, &RequestMessage{JSONRPC: Version, ID: json.RawMessage(`1`), Method: "slow"})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a deadline error", err)
+	}
+	if conn.Closed() {
+		t.Fatal("connection failed by an interrupted write")
+	}
+
+	// The peer reads on: the rest is written by the background flush, without a deadline
+	stream := NewStream(struct {
+		io.Reader
+		io.Writer
+	}{io.MultiReader(bytes.NewReader(<-head), peer), io.Discard})
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.Write(ctx, &RequestMessage{JSONRPC: Version, ID: json.RawMessage(`2`), Method: "next"})
+	}()
+	for _, want := range []string{"slow", "next"} {
+		data, err := stream.ReadMessage()
+		if err != nil {
+			t.Fatalf("reading %s: %v", want, err)
+		}
+		var msg struct{ Method string }
+		if err := json.Unmarshal(data, &msg); err != nil || msg.Method != want {
+			t.Fatalf("got %s (%v), want the %s message", data, err, want)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Errorf("write after the interrupted one: %v", err)
+	}
+}
+
+// flakyWriter fails its first write after writing partial bytes of it, then writes to w.
+type flakyWriter struct {
+	partial int
+	failed  bool
+	w       bytes.Buffer
+}
+
+func (f *flakyWriter) Write(p []byte) (int, error) {
+	if !f.failed {
+		f.failed = true
+		return f.partial, errors.New("broken")
+	}
+	return f.w.Write(p)
+}
+
+func TestFailedNotificationFlush(t *testing.T) {
+	t.Run("dropped", func(t *testing.T) {
+		w := &flakyWriter{}
+		conn := NewConn(NewStream(struct {
+			io.Reader
+			io.Writer
+		}{bytes.NewReader(nil), w}))
+		flushErrs := make(chan error, 1)
+		conn.SetFlushErrorHandler(func(err error) { flushErrs <- err })
+
+		ctx := context.Background()
+		if err := conn.Write(ctx, &NotificationMessage{JSONRPC: Version, Method: "lost"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-flushErrs; err == nil {
+			t.Fatal("flush error handler called without an error")
+		}
+		// The next write doesn't get the error of the notification
+		if err := conn.Write(ctx, &RequestMessage{JSONRPC: Version, ID: json.RawMessage(`1`), Method: "next"}); err != nil {
+			t.Fatalf("write after the dropped notification: %v", err)
+		}
+		if conn.Closed() {
+			t.Error("connection failed by a dropped notification")
+		}
+		if got := w.w.String(); !bytes.Contains(w.w.Bytes(), []byte(`"next"`)) || bytes.Contains(w.w.Bytes(), []byte(`"lost"`)) {
+			t.Errorf("got %q, want only the request", got)
+		}
+	})
+
+	t.Run("torn", func(t *testing.T) {
+		w := &flakyWriter{partial: 5}
+		conn := NewConn(NewStream(struct {
+			io.Reader
+			io.Writer
+		}{bytes.NewReader(nil), w}))
+		flushErrs := make(chan error, 1)
+		conn.SetFlushErrorHandler(func(err error) { flushErrs <- err })
+
+		ctx := context.Background()
+		if err := conn.Write(ctx, &NotificationMessage{JSONRPC: Version, Method: "cut"}); err != nil {
+			t.Fatal(err)
+		}
+		<-flushErrs
+		// Nothing can be framed after part of a message
+		if err := conn.Write(ctx, &RequestMessage{JSONRPC: Version, ID: json.RawMessage(`1`), Method: "next"}); err == nil {
+			t.Error("write accepted after a torn notification")
+		}
+	})
+}
+
+// TestCloseStalledPeer checks Close returns when the peer stopped reading, with messages
+// still queued, whether the stream supports deadlines or not.
+func TestCloseStalledPeer(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		source func(net.Conn) io.ReadWriteCloser
+	}{
+		{"deadlines", func(c net.Conn) io.ReadWriteCloser { return c }},
+		{"no deadlines", func(c net.Conn) io.ReadWriteCloser { return struct{ io.ReadWriteCloser }{c} }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			local, peer := net.Pipe()
+			defer peer.Close() // Never read
+			conn := NewConn(NewStream(tt.source(local)))
+			if err := conn.Write(context.Background(), &NotificationMessage{JSONRPC: Version, Method: "queued"}); err != nil {
+				t.Fatal(err)
+			}
+
+			closed := make(chan error, 1)
+			go func() { closed <- conn.Close() }()
+			select {
+			case <-closed:
+			case <-time.After(3 * time.Second):
+				t.Fatal("Close blocked by a stalled peer")
+			}
+			if !conn.Closed() {
+				t.Error("connection not closed")
+			}
+		})
+	}
+}
+
+// repeatReader reads data over and over.
+type repeatReader struct {
+	data []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.off:])
+	r.off = (r.off + n) % len(r.data)
+	return n, nil
+}
+
+// didChangeMessage returns a framed didChange notification replacing a document of about
+// size bytes, the largest messages an editor sends.
+func didChangeMessage(size int) []byte {
+	line := "\tfmt.Println(\"the quick brown fox jumps over the lazy dog\") // \"quoted\" \\ é\n"
+	text := strings.Repeat(line, size/len(line)+1)
+	params, _ := json.Marshal(map[string]any{
+		"textDocument":   map[string]any{"uri": "file:///project/main.go", "version": 42},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+	body, _ := json.Marshal(&NotificationMessage{JSONRPC: Version, Method: "textDocument/didChange", Params: params})
+	return append([]byte(fmt.Sprintf("Content-Length: %d\r\n\r\n", len(body))), body...)
+}
+
+// BenchmarkRead measures Conn.Read on a 1MB didChange, against decoding the body twice,
+// probing its type then decoding it into that type, as Read did before.
+func BenchmarkRead(b *testing.B) {
+	message := didChangeMessage(1 << 20)
+	newStream := func() *Stream {
+		return NewStream(struct {
+			io.Reader
+			io.Writer
+		}{&repeatReader{data: message}, io.Discard})
+	}
+
+	b.Run("single pass", func(b *testing.B) {
+		conn := NewConn(newStream())
+		ctx := context.Background()
+		b.SetBytes(int64(len(message)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := conn.Read(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("two passes", func(b *testing.B) {
+		stream := newStream()
+		b.SetBytes(int64(len(message)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := stream.readMessage(false) // Without framing check, like Read
+			if err != nil {
+				b.Fatal(err)
+			}
+			var base struct {
+				ID     json.RawMessage `json:"id"`
+				Method string          `json:"method"`
+			}
+			if err := json.Unmarshal(data, &base); err != nil {
+				b.Fatal(err)
+			}
+			var ntf NotificationMessage
+			if err := json.Unmarshal(data, &ntf); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
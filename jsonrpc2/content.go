@@ -0,0 +1,96 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// ContentPolicy is what a Stream does with a message it did not expect, see ContentHandling.
+type ContentPolicy int
+
+const (
+	// RejectContent fails the read with a *ContentError. The server treats it like any read
+	// error and stops.
+	RejectContent ContentPolicy = iota
+	// SkipContent drops the message and reads the next one.
+	SkipContent
+	// PassContent hands the message to ContentHandling.Raw and reads the next one.
+	PassContent
+)
+
+// ContentHandling configures the checks a Stream makes on the messages it reads,
+// for interoperability with clients not following the base protocol.
+// Without it, the Content-Type header is ignored and any payload is decoded as JSON.
+type ContentHandling struct {
+	Policy ContentPolicy
+	// MaxContentLength is the size above which a message is unexpected, 0 means no limit.
+	// The content of an oversized message is discarded without being read into memory.
+	MaxContentLength int
+	// Raw receives the unexpected messages with the PassContent policy. It is called by the
+	// reading goroutine, before the next message is read. Messages are dropped when it is nil.
+	Raw func(content UnexpectedContent)
+}
+
+// UnexpectedContent is a message which failed the ContentHandling checks.
+type UnexpectedContent struct {
+	Reason        string // Why the message was unexpected
+	ContentType   string // Content-Type header, empty when absent
+	ContentLength int
+	// Body is the content of the message, nil when it is over MaxContentLength.
+	Body []byte
+}
+
+// ContentError is returned by ReadMessage for unexpected messages with the RejectContent policy.
+type ContentError struct {
+	Content UnexpectedContent
+}
+
+func (e *ContentError) Error() string {
+	if e.Content.ContentType != "" {
+		return fmt.Sprintf("unexpected message content (%d bytes, Content-Type %q): %s",
+			e.Content.ContentLength, e.Content.ContentType, e.Content.Reason)
+	}
+	return fmt.Sprintf("unexpected message content (%d bytes): %s", e.Content.ContentLength, e.Content.Reason)
+}
+
+// SetContentHandling enables the checks of h on the messages read after the call.
+// It must not be called concurrently with ReadMessage.
+func (s *Stream) SetContentHandling(h ContentHandling) {
+	s.content = &h
+}
+
+// checkContentType returns why a Content-Type is unexpected, empty when it is fine.
+// The spec default is application/vscode-jsonrpc; charset=utf-8, application/json is accepted,
+// so is "utf8" which the spec tolerates for backward compatibility.
+func checkContentType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Sprintf("invalid Content-Type: %v", err)
+	}
+	if mediaType != "application/vscode-jsonrpc" && mediaType != "application/json" {
+		return fmt.Sprintf("unsupported media type %s", mediaType)
+	}
+	if charset, ok := params["charset"]; ok {
+		if charset = strings.ToLower(charset); charset != "utf-8" && charset != "utf8" {
+			return fmt.Sprintf("unsupported charset %s", charset)
+		}
+	}
+	return ""
+}
+
+// checkBody returns why a message content is unexpected, empty when it looks like text.
+func checkBody(body []byte) string {
+	if i := bytes.IndexByte(body, 0); i >= 0 {
+		return fmt.Sprintf("binary content, NUL byte at offset %d", i)
+	}
+	if !utf8.Valid(body) {
+		return "binary content, invalid UTF-8"
+	}
+	return ""
+}
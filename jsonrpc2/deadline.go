@@ -0,0 +1,60 @@
+package jsonrpc2
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// deadliner is implemented by the streams whose blocking reads and writes can be
+// interrupted with deadlines: net.Conn, and os.File pipes.
+type deadliner interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+// withDeadline runs op, a blocking read or write of the stream, with the deadline set by set
+// following ctx: the deadline of ctx, and an expired one as soon as ctx is cancelled, so that
+// op returns instead of waiting for the peer. The error of an op interrupted this way is
+// ctx.Err(). Streams without deadlines (os.Stdin on a terminal or a file, io.Pipe...) run op
+// as is, ctx is then only checked before.
+func (s *Stream) withDeadline(ctx context.Context, set func(d deadliner, t time.Time) error, op func() error) error {
+	d, ok := s.source.(deadliner)
+	if !ok || ctx.Done() == nil {
+		return op()
+	}
+	deadline, _ := ctx.Deadline() // Zero without one, no deadline
+	if err := set(d, deadline); err != nil {
+		return op() // The source has the methods but not the support, e.g. os.ErrNoDeadline
+	}
+
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		set(d, time.Now()) //nolint:errcheck // Set successfully above
+		close(fired)
+	})
+	defer func() {
+		if !stop() {
+			<-fired // Don't let it expire the deadline reset below
+		}
+		set(d, time.Time{}) //nolint:errcheck // The next op starts without a deadline
+	}()
+	err := op()
+
+	if err != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if !deadline.IsZero() && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded // The socket deadline fired before the context timer
+		}
+	}
+	return err
+}
+
+// interrupted reports whether err is the error of an op interrupted by withDeadline, which
+// can be context.DeadlineExceeded before the context itself reports it.
+func interrupted(err error) bool {
+	return err == context.Canceled || err == context.DeadlineExceeded
+}
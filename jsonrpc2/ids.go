@@ -0,0 +1,91 @@
+package jsonrpc2
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// IDGenerator generates the IDs of the requests sent on a connection. IDs must be unique
+// among the pending requests of the connection, and NextID safe for concurrent use.
+//
+// The default, SequentialIDs, numbers the requests. A proxy forwarding the requests of
+// several peers on one connection uses distinct generators for each, e.g. PrefixedIDs, so
+// that their IDs don't collide and responses are routed back by ID alone.
+type IDGenerator interface {
+	// NextID returns the JSON encoded ID of the next request, a number or a string.
+	NextID() json.RawMessage
+}
+
+// SequentialIDs numbers the requests 1, 2, 3... The zero value is ready to use.
+type SequentialIDs struct {
+	last atomic.Int64
+}
+
+// NextID returns the number following the last ID.
+func (g *SequentialIDs) NextID() json.RawMessage {
+	return json.RawMessage(strconv.FormatInt(g.last.Add(1), 10))
+}
+
+// Issued reports whether id is a number generated so far.
+func (g *SequentialIDs) Issued(id json.RawMessage) bool {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	return err == nil && n >= 1 && n <= g.last.Load()
+}
+
+// UUIDIDs generates random (version 4) UUID strings, unique across connections and processes.
+type UUIDIDs struct{}
+
+// NextID returns a new random UUID.
+func (UUIDIDs) NextID() json.RawMessage {
+	var b [16]byte
+	_, _ = rand.Read(b[:])  // Never fails, see crypto/rand.Read
+	b[6] = b[6]&0x0f | 0x40 // Version 4
+	b[8] = b[8]&0x3f | 0x80 // RFC 4122 variant
+	return json.RawMessage(fmt.Sprintf(`"%x-%x-%x-%x-%x"`, b[0:4], b[4:6], b[6:8], b[8:10], b[10:]))
+}
+
+// PrefixedIDs generates string IDs made of a prefix naming a component and the IDs of
+// another generator, e.g. "editor-1", "editor-2". The generator defaults to SequentialIDs.
+type PrefixedIDs struct {
+	prefix string
+	next   IDGenerator
+}
+
+// NewPrefixedIDs returns a generator prefixing the IDs of next with prefix and a dash, next
+// may be nil for numbered IDs.
+func NewPrefixedIDs(prefix string, next IDGenerator) *PrefixedIDs {
+	if next == nil {
+		next = &SequentialIDs{}
+	}
+	return &PrefixedIDs{prefix: prefix, next: next}
+}
+
+// NextID returns the next ID of the generator, prefixed.
+func (g *PrefixedIDs) NextID() json.RawMessage {
+	id := g.next.NextID()
+	var s string
+	if err := json.Unmarshal(id, &s); err != nil {
+		s = string(id) // A number
+	}
+	prefixed, _ := json.Marshal(g.prefix + "-" + s)
+	return prefixed
+}
+
+// SetIDGenerator sets the generator of NextID, SequentialIDs by default. Call it before the
+// connection is used.
+func (c *Conn) SetIDGenerator(g IDGenerator) {
+	c.ids = g
+}
+
+// IDGenerator returns the generator of NextID.
+func (c *Conn) IDGenerator() IDGenerator {
+	return c.ids
+}
+
+// NextID returns the ID of the next request sent on the connection.
+func (c *Conn) NextID() json.RawMessage {
+	return c.ids.NextID()
+}
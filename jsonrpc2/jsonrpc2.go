@@ -2,6 +2,7 @@ package jsonrpc2
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
@@ -56,9 +57,28 @@ const (
 	ServerNotInitialized = -32002
 	RequestCancelled     = -32800
 	ContentModified      = -32801
+	ServerCancelled      = -32802 // The server cancelled the request, it may be retried (LSP 3.17)
+	RequestFailed        = -32803 // The request was valid but failed, e.g. a formatter error (LSP 3.17)
 	// ... other LSP specific codes
 )
 
+// IsRetryable reports whether err is a JSON-RPC error whose request may succeed if sent again
+// as is: the peer cancelled it itself (ServerCancelled), or the content it depended on was
+// modified, which is also how an overloaded server sheds requests (ContentModified). A request
+// cancelled by its sender, an internal error, and other errors such as a closed connection or
+// a done context, are not retryable.
+func IsRetryable(err error) bool {
+	var rpcErr *ErrorObject
+	if !errors.As(err, &rpcErr) {
+		return false
+	}
+	switch rpcErr.Code {
+	case ServerCancelled, ContentModified:
+		return true
+	}
+	return false
+}
+
 // NewError creates a new ErrorObject.
 func NewError(code int, message string) *ErrorObject {
 	return &ErrorObject{Code: code, Message: message}
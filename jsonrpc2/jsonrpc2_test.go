@@ -0,0 +1,33 @@
+package jsonrpc2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{NewError(ContentModified, "server overloaded, request dropped"), true},
+		{NewError(ServerCancelled, "cancelled"), true},
+		{fmt.Errorf("call: %w", NewError(ContentModified, "modified")), true},
+		{NewError(RequestCancelled, "cancelled by the client"), false},
+		{NewError(InternalError, "panic"), false},
+		{NewError(ServerNotInitialized, "not initialized"), false},
+		{NewError(RequestFailed, "failed"), false},
+		{NewError(InvalidParams, "invalid"), false},
+		{NewError(MethodNotFound, "unknown"), false},
+		{context.Canceled, false},
+		{io.ErrClosedPipe, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
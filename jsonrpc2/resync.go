@@ -0,0 +1,89 @@
+package jsonrpc2
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// checkFraming checks that a body read with the declared Content-Length is exactly one JSON
+// value. Conn.Read only calls it for the bodies failing to decode. When the length doesn't
+// match the JSON boundaries, it resynchronizes the stream on the next header block instead
+// of reading the following messages from the wrong offset:
+//   - Content-Length too large: the body holds a whole value followed by the beginning of
+//     the next message. The value is returned and the bytes from the next header are put back
+//     in the stream, garbage in between is dropped.
+//   - Content-Length too small: the body is a truncated value. A *MessageError is returned
+//     for it, the rest of the message is dropped by readHeaders, which skips everything up to
+//     the next Content-Length header.
+func (s *Stream) checkFraming(body []byte) ([]byte, error) {
+	if json.Valid(body) {
+		return body, nil // Exactly one value, as nearly all bodies are
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	var value json.RawMessage
+	if err := dec.Decode(&value); err == nil {
+		end := int(dec.InputOffset())
+		rest := body[end:]
+		if i := indexContentLength(string(rest)); i >= 0 {
+			s.unread(rest[i:])
+		}
+		return body[:end], nil
+	}
+
+	// Truncated or garbage body, it may still hold the header of the next message
+	broken := body
+	if i := indexContentLength(string(body)); i >= 0 {
+		s.unread(body[i:])
+		broken = body[:i]
+	}
+	return nil, &MessageError{
+		Err: NewError(ParseError, fmt.Sprintf("Content-Length %d doesn't match the message: truncated or malformed JSON", len(body))),
+		ID:  recoverID(broken),
+	}
+}
+
+// indexContentLength returns the index in s of the first Content-Length header, its name
+// matched case insensitively like header names are, or -1.
+func indexContentLength(s string) int {
+	name := headerContentLength + ":"
+	for i := 0; i+len(name) <= len(s); i++ {
+		if s[i]|0x20 == 'c' && strings.EqualFold(s[i:i+len(name)], name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// pushbackReader reads the bytes put back in the stream by unread, then those of r.
+type pushbackReader struct {
+	pending []byte
+	r       io.Reader
+}
+
+func (p *pushbackReader) Read(b []byte) (int, error) {
+	if len(p.pending) > 0 {
+		n := copy(b, p.pending)
+		p.pending = p.pending[n:]
+		return n, nil
+	}
+	return p.r.Read(b)
+}
+
+// unread puts data back in front of the bytes still to be read from the stream. The bytes
+// the bufio.Reader buffered follow it in the pushback buffer, the reader is kept.
+func (s *Stream) unread(data []byte) {
+	buffered, _ := s.reader.Peek(s.reader.Buffered())
+	pending := make([]byte, 0, len(data)+len(buffered)+len(s.pushback.pending))
+	pending = append(append(append(pending, data...), buffered...), s.pushback.pending...)
+	s.reader.Discard(len(buffered)) //nolint:errcheck
+	s.pushback.pending = pending
+}
+
+// buffered returns the number of bytes read from the source but not yet from the stream.
+func (s *Stream) buffered() int {
+	return s.reader.Buffered() + len(s.pushback.pending)
+}
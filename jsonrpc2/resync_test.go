@@ -0,0 +1,164 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// frame returns body with a Content-Length header declaring length, using the header name
+// as given.
+func frame(name string, length int, body string) string {
+	return fmt.Sprintf("%s: %d\r\n\r\n%s", name, length, body)
+}
+
+// readAll reads the messages of a stream until EOF, MessageErrors included as "error".
+func readAll(t *testing.T, input string) []string {
+	t.Helper()
+	s := NewStream(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(input), io.Discard})
+	var got []string
+	for {
+		msg, err := s.ReadMessage()
+		var msgErr *MessageError
+		switch {
+		case errors.Is(err, io.EOF):
+			return got
+		case errors.As(err, &msgErr):
+			got = append(got, "error")
+		case err != nil:
+			t.Fatalf("after %q: %v", got, err)
+		default:
+			got = append(got, string(msg))
+		}
+	}
+}
+
+func TestStreamResync(t *testing.T) {
+	m1 := `{"jsonrpc":"2.0","method":"a"}`
+	m2 := `{"jsonrpc":"2.0","method":"b"}`
+	m3 := `{"jsonrpc":"2.0","method":"c"}`
+	next := frame("Content-Length", len(m2), m2)
+	lowerNext := frame("content-length", len(m2), m2)
+	truncated := `{"jsonrpc":"2.0","id":1,"meth`
+
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "exact lengths",
+			input: frame("Content-Length", len(m1), m1) + next,
+			want:  []string{m1, m2},
+		},
+		{
+			// The body starts with { and ends with }, but holds two messages
+			name:  "length too large, next message included",
+			input: frame("Content-Length", len(m1)+len(next), m1+next) + frame("Content-Length", len(m3), m3),
+			want:  []string{m1, m2, m3},
+		},
+		{
+			name:  "length too large, lower case header",
+			input: frame("Content-Length", len(m1)+len(lowerNext), m1+lowerNext) + frame("Content-Length", len(m3), m3),
+			want:  []string{m1, m2, m3},
+		},
+		{
+			name:  "length too large, garbage before the header",
+			input: frame("Content-Length", len(m1)+5+len(next), m1+"\r\nxx\n"+next),
+			want:  []string{m1, m2},
+		},
+		{
+			name: "two oversized messages in a row",
+			input: frame("Content-Length", len(m1)+len(next), m1+next) +
+				frame("Content-Length", len(m3)+len(lowerNext), m3+lowerNext) +
+				frame("Content-Length", len(m1), m1),
+			want: []string{m1, m2, m3, m2, m1},
+		},
+		{
+			name:  "length too small",
+			input: frame("Content-Length", len(truncated), truncated) + `od":"x"}` + next,
+			want:  []string{"error", m2},
+		},
+		{
+			name:  "length too small, lower case header",
+			input: frame("Content-Length", len(truncated), truncated) + `od":"x"}` + lowerNext + frame("CONTENT-LENGTH", len(m3), m3),
+			want:  []string{"error", m2, m3},
+		},
+		{
+			name:  "header in a truncated body",
+			input: frame("Content-Length", len(truncated)+len(lowerNext), truncated+lowerNext),
+			want:  []string{"error", m2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := readAll(t, tt.input)
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("stream: got %q, want %q", got, tt.want)
+			}
+			// Conn checks the framing of the messages failing to decode only, with the
+			// same result
+			var want []string
+			for _, msg := range tt.want {
+				var n NotificationMessage
+				if json.Unmarshal([]byte(msg), &n) != nil {
+					want = append(want, msg)
+				} else {
+					want = append(want, n.Method)
+				}
+			}
+			if got := readAllConn(t, tt.input); strings.Join(got, "\n") != strings.Join(want, "\n") {
+				t.Errorf("conn: got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+// readAllConn reads the messages of input with a Conn until EOF, as their method, or as
+// "error" for MessageErrors.
+func readAllConn(t *testing.T, input string) []string {
+	t.Helper()
+	c := NewConn(NewStream(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(input), io.Discard}))
+	var got []string
+	for {
+		msg, err := c.Read(context.Background())
+		var msgErr *MessageError
+		switch {
+		case errors.Is(err, io.EOF):
+			return got
+		case errors.As(err, &msgErr):
+			got = append(got, "error")
+		case err != nil:
+			t.Fatalf("after %q: %v", got, err)
+		default:
+			got = append(got, msg.(*NotificationMessage).Method)
+		}
+	}
+}
+
+func TestIndexContentLength(t *testing.T) {
+	for s, want := range map[string]int{
+		"Content-Length: 3":    0,
+		"xx content-length: 3": 3,
+		"}CONTENT-LENGTH:3":    1,
+		"Content-Length 3":     -1,
+		"Content-Type: a":      -1,
+		"content-lengt":        -1,
+		"":                     -1,
+		"KContent-Length: 1":   3, // Not confused by the Kelvin sign, which folds to k
+	} {
+		if got := indexContentLength(s); got != want {
+			t.Errorf("indexContentLength(%q) = %d, want %d", s, got, want)
+		}
+	}
+}
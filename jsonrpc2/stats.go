@@ -0,0 +1,159 @@
+package jsonrpc2
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats is a snapshot of the traffic of a Conn.
+type ConnStats struct {
+	// BytesRead and BytesWritten count the bytes of the stream, headers included.
+	BytesRead    uint64 `json:"bytesRead"`
+	BytesWritten uint64 `json:"bytesWritten"`
+	// Received and Sent count the requests and notifications by method, and the responses
+	// under the empty method.
+	Received map[string]uint64 `json:"received"`
+	Sent     map[string]uint64 `json:"sent"`
+	// Writes is the number of writes to the stream, a write carries a burst of messages.
+	Writes uint64 `json:"writes"`
+	// WriteStalls is the number of writes blocked longer than the threshold of
+	// SetWriteStallHandler, MaxWriteDuration the longest write.
+	WriteStalls        uint64        `json:"writeStalls"`
+	TotalWriteDuration time.Duration `json:"totalWriteDuration"`
+	MaxWriteDuration   time.Duration `json:"maxWriteDuration"`
+}
+
+// WriteStall describes a write to the stream blocked because the peer stopped reading its
+// input, e.g. a frozen editor, see SetWriteStallHandler.
+type WriteStall struct {
+	Started  time.Time
+	Duration time.Duration // Blocked so far, or in total once Done
+	Buffered int           // Bytes waiting for the peer to read them, see Buffered
+	Done     bool          // The write completed, or failed
+}
+
+// connStats collects the statistics of a Conn.
+type connStats struct {
+	mu                 sync.Mutex
+	received           map[string]uint64
+	sent               map[string]uint64
+	writes             uint64
+	writeStalls        uint64
+	totalWriteDuration time.Duration
+	maxWriteDuration   time.Duration
+}
+
+// messageMethod returns the method a message is counted under.
+func messageMethod(msg any) string {
+	switch m := msg.(type) {
+	case *RequestMessage:
+		return m.Method
+	case *NotificationMessage:
+		return m.Method
+	case RequestMessage:
+		return m.Method
+	case NotificationMessage:
+		return m.Method
+	}
+	return "" // Responses
+}
+
+func (st *connStats) count(counts *map[string]uint64, method string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if *counts == nil {
+		*counts = make(map[string]uint64)
+	}
+	(*counts)[method]++
+}
+
+func (st *connStats) recordWrite(elapsed time.Duration, stalled bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.writes++
+	if stalled {
+		st.writeStalls++
+	}
+	st.totalWriteDuration += elapsed
+	st.maxWriteDuration = max(st.maxWriteDuration, elapsed)
+}
+
+// Stats returns a snapshot of the traffic of the connection.
+func (c *Conn) Stats() ConnStats {
+	st := &c.stats
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	stats := ConnStats{
+		BytesRead:          c.stream.bytesRead.Load(),
+		BytesWritten:       c.stream.bytesWritten.Load(),
+		Received:           make(map[string]uint64, len(st.received)),
+		Sent:               make(map[string]uint64, len(st.sent)),
+		Writes:             st.writes,
+		WriteStalls:        st.writeStalls,
+		TotalWriteDuration: st.totalWriteDuration,
+		MaxWriteDuration:   st.maxWriteDuration,
+	}
+	for method, n := range st.received {
+		stats.Received[method] = n
+	}
+	for method, n := range st.sent {
+		stats.Sent[method] = n
+	}
+	return stats
+}
+
+// SetWriteStallHandler calls fn when a write to the stream is blocked for longer than
+// threshold, while it is still blocked, and again with Done set once it completes. A
+// blocked write means the peer stopped reading, telling a frozen client apart from a
+// server bug. fn must not write to the connection. Call it before the connection is used.
+func (c *Conn) SetWriteStallHandler(threshold time.Duration, fn func(WriteStall)) {
+	c.stallThreshold = threshold
+	c.onStall = fn
+}
+
+// watchWrite times a write started at start, it calls the stall handler when the write
+// takes too long. The returned func is called once the write returned, it reports whether
+// the write stalled.
+func (c *Conn) watchWrite(start time.Time) (stop func() bool) {
+	if c.onStall == nil || c.stallThreshold <= 0 {
+		return func() bool { return false }
+	}
+	var (
+		mu          sync.Mutex
+		fired, done bool
+	)
+	timer := time.AfterFunc(c.stallThreshold, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if done {
+			return
+		}
+		fired = true
+		c.onStall(WriteStall{Started: start, Duration: time.Since(start), Buffered: c.Buffered()})
+	})
+	return func() bool {
+		timer.Stop()
+		mu.Lock()
+		done = true
+		stalled := fired
+		mu.Unlock() // A handler call in progress returned, Done is reported after it
+		if stalled {
+			c.onStall(WriteStall{Started: start, Duration: time.Since(start), Buffered: c.Buffered(), Done: true})
+		}
+		return stalled
+	}
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Uint64
+}
+
+func (cr countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n.Add(uint64(n))
+	return n, err
+}
@@ -3,11 +3,11 @@ package jsonrpc2
 import (
 	"bufio"
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
 	"strings"
+	"sync/atomic"
 )
 
 const (
@@ -18,18 +18,33 @@ const (
 
 // Stream handles reading and writing JSON-RPC messages over an io.ReadWriter.
 type Stream struct {
-	reader *bufio.Reader
-	writer io.Writer
-	source io.ReadWriter // Keep the original source
+	reader   *bufio.Reader
+	pushback pushbackReader // Bytes put back in front of the source, see unread
+	writer   io.Writer
+	source   io.ReadWriter // Keep the original source
+	codec    Codec
+
+	content *ContentHandling // Optional checks of the messages read, see SetContentHandling
+
+	bytesRead    atomic.Uint64 // See Conn.Stats
+	bytesWritten atomic.Uint64
 }
 
-// NewStream creates a new Stream.
+// NewStream creates a new Stream encoding messages with encoding/json.
 func NewStream(rw io.ReadWriter) *Stream {
-	return &Stream{
-		reader: bufio.NewReader(rw),
+	return NewStreamWithCodec(rw, StdCodec{})
+}
+
+// NewStreamWithCodec creates a new Stream encoding messages with codec.
+func NewStreamWithCodec(rw io.ReadWriter, codec Codec) *Stream {
+	s := &Stream{
 		writer: rw,
 		source: rw,
+		codec:  codec,
 	}
+	s.pushback.r = countingReader{rw, &s.bytesRead}
+	s.reader = bufio.NewReader(&s.pushback)
+	return s
 }
 
 // Close closes the underlying source if it implements io.Closer.
@@ -41,20 +56,97 @@ func (s *Stream) Close() error {
 }
 
 // ReadMessage reads a single JSON-RPC message from the stream.
+// With SetContentHandling, unexpected messages are rejected, skipped or passed to a raw handler.
 func (s *Stream) ReadMessage() ([]byte, error) {
-	contentLength := -1
-	// Read headers
+	return s.readMessage(true)
+}
+
+// readMessage is ReadMessage, checking the framing of the body only with framing set. Conn
+// checks it only when the message fails to decode: a body decoding fine is exactly one JSON
+// value, and is scanned once. With content handling, bodies are always checked.
+func (s *Stream) readMessage(framing bool) ([]byte, error) {
+	for {
+		contentLength, contentType, err := s.readHeaders()
+		if err != nil {
+			return nil, err
+		}
+		if s.content == nil {
+			jsonData, err := s.readContent(contentLength)
+			if err != nil {
+				return nil, err
+			}
+			if !framing {
+				return jsonData, nil
+			}
+			return s.checkFraming(jsonData)
+		}
+
+		unexpected := UnexpectedContent{ContentType: contentType, ContentLength: contentLength}
+		if limit := s.content.MaxContentLength; limit > 0 && contentLength > limit {
+			// Don't hold an oversized message in memory, whatever the policy
+			if _, err := io.CopyN(io.Discard, s.reader, int64(contentLength)); err != nil {
+				return nil, fmt.Errorf("failed to discard message content (%d bytes): %w", contentLength, err)
+			}
+			unexpected.Reason = fmt.Sprintf("content length over the %d bytes limit", limit)
+		} else {
+			jsonData, err := s.readContent(contentLength)
+			if err != nil {
+				return nil, err
+			}
+			unexpected.Reason = checkContentType(contentType)
+			if unexpected.Reason == "" {
+				// Only JSON content can be checked against the Content-Length
+				if jsonData, err = s.checkFraming(jsonData); err != nil {
+					return nil, err
+				}
+				unexpected.Reason = checkBody(jsonData)
+			}
+			if unexpected.Reason == "" {
+				return jsonData, nil
+			}
+			unexpected.Body = jsonData
+		}
+
+		switch s.content.Policy {
+		case SkipContent:
+			continue
+		case PassContent:
+			if s.content.Raw != nil {
+				s.content.Raw(unexpected)
+			}
+			continue
+		default:
+			return nil, &ContentError{Content: unexpected}
+		}
+	}
+}
+
+// readHeaders reads the headers of a message up to the empty line ending them.
+// Lines before the Content-Length header which are not headers, e.g. the end of a message
+// whose Content-Length was too small, are skipped to get back in sync with the stream.
+func (s *Stream) readHeaders() (contentLength int, contentType string, err error) {
+	contentLength = -1
 	for {
 		line, err := s.reader.ReadString('\n')
 		if err != nil {
 			// EOF or other read error during header read is critical
-			return nil, fmt.Errorf("failed to read header line: %w", err)
+			return 0, "", fmt.Errorf("failed to read header line: %w", err)
 		}
 
 		line = strings.TrimSuffix(line, "\r\n") // Handle CRLF line endings
 
+		// Garbage right before a header starts a new header block
+		if i := indexContentLength(line); i > 0 {
+			line = line[i:]
+			contentLength, contentType = -1, ""
+		}
+
 		// Empty line indicates end of headers
 		if line == "" {
+			if contentLength == -1 {
+				// A blank line in the garbage, keep scanning for the next header block
+				continue
+			}
 			break
 		}
 
@@ -63,67 +155,79 @@ func (s *Stream) ReadMessage() ([]byte, error) {
 			// Malformed header, but try to continue reading headers
 			// A robust server might log this and try to recover, but for simplicity,
 			// we'll require valid headers. Alternatively, return error here.
-			continue // Or: return nil, fmt.Errorf("malformed header line: %q", line)
+			continue // Or: return 0, "", fmt.Errorf("malformed header line: %q", line)
 		}
 
 		headerName := strings.TrimSpace(parts[0])
 		headerValue := strings.TrimSpace(parts[1])
 
-		if strings.EqualFold(headerName, headerContentLength) {
+		switch {
+		case strings.EqualFold(headerName, headerContentLength):
 			length, err := strconv.Atoi(headerValue)
 			if err != nil {
-				return nil, fmt.Errorf("invalid Content-Length: %q: %w", headerValue, err)
+				return 0, "", fmt.Errorf("invalid Content-Length: %q: %w", headerValue, err)
 			}
 			if length <= 0 {
-				return nil, fmt.Errorf("invalid Content-Length: %d", length)
+				return 0, "", fmt.Errorf("invalid Content-Length: %d", length)
 			}
 			contentLength = length
+		case strings.EqualFold(headerName, headerContentType):
+			// Only checked with SetContentHandling, otherwise assumed to be utf-8 json
+			contentType = headerValue
 		}
-		// We can ignore Content-Type for now, assuming utf-8 json
 	}
 
-	if contentLength == -1 {
-		return nil, fmt.Errorf("missing Content-Length header")
-	}
+	return contentLength, contentType, nil
+}
 
-	// Read the JSON content
+// readContent reads the JSON content of a message.
+func (s *Stream) readContent(contentLength int) ([]byte, error) {
 	jsonData := make([]byte, contentLength)
 	_, err := io.ReadFull(s.reader, jsonData)
 	if err != nil {
 		// EOF or error during content read
 		return nil, fmt.Errorf("failed to read message content (expected %d bytes): %w", contentLength, err)
 	}
-
 	return jsonData, nil
 }
 
 // WriteMessage writes a JSON-RPC message to the stream.
 // The msg parameter should be a struct marshallable to JSON (Request, Response, Notification).
 func (s *Stream) WriteMessage(msg interface{}) error {
-	jsonData, err := json.Marshal(msg)
+	data, err := s.frame(msg)
 	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return err
+	}
+	_, err = s.write(data)
+	return err
+}
+
+// frame encodes a message with its header.
+func (s *Stream) frame(msg any) ([]byte, error) {
+	jsonData, err := s.codec.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
 	}
 
 	header := fmt.Sprintf("%s: %d%s%s",
 		headerContentLength, len(jsonData), headerSeparator, headerSeparator) // Ends with \r\n\r\n
 
-	// Write header and body together for atomicity (less chance of partial writes)
 	var buf bytes.Buffer
+	buf.Grow(len(header) + len(jsonData))
 	buf.WriteString(header)
 	buf.Write(jsonData)
+	return buf.Bytes(), nil
+}
 
-	_, err = s.writer.Write(buf.Bytes())
+// write writes framed messages, header and body together for atomicity (less chance of partial writes).
+// It returns the number of bytes written, all of them unless err is set.
+func (s *Stream) write(data []byte) (int, error) {
+	n, err := s.writer.Write(data)
+	s.bytesWritten.Add(uint64(n))
 	if err != nil {
-		return fmt.Errorf("failed to write message: %w", err)
+		return n, fmt.Errorf("failed to write message: %w", err)
 	}
 	// Flushing might be necessary depending on the underlying writer,
 	// but typically Write handles it for os.Stdout, net.Conn etc.
-	// if f, ok := s.writer.(interface{ Flush() error }); ok {
-	//     if err := f.Flush(); err != nil {
-	//         // Log or handle flush error
-	//     }
-	// }
-
-	return nil
+	return n, nil
 }
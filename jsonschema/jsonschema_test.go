@@ -0,0 +1,98 @@
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the testdata/*.golden.json files")
+
+type Base struct {
+	ID   string `json:"id" description:"Identifies the value"`
+	Kind string `json:"kind,omitempty"`
+}
+
+type Extra struct {
+	Note string `json:"note"`
+}
+
+type hidden struct {
+	Flag bool `json:"flag"` // Promoted even though its struct is unexported
+}
+
+type Embedded struct {
+	Base
+	*Extra
+	hidden
+	Named Base `json:"named"` // Not flattened, it has a name
+	Name  string
+}
+
+type Optional struct {
+	Required  int            `json:"required"`
+	Empty     string         `json:"empty,omitempty"`
+	Zero      time.Time      `json:"zero,omitzero"`
+	Both      []string       `json:"both,omitempty,omitzero"`
+	Pointer   *int           `json:"pointer"`
+	Skipped   string         `json:"-"`
+	Dash      string         `json:"-,"` // Named "-"
+	Values    map[string]int `json:"values"`
+	Raw       json.RawMessage
+	Timeout   time.Duration `json:"timeout,omitempty"`
+	Data      []byte        `json:"data,omitempty"`
+	unexposed string
+}
+
+type Node struct {
+	Name     string  `json:"name"`
+	Children []*Node `json:"children,omitempty"`
+	Parent   *Node   `json:"parent"`
+	Left     Leaf    `json:"left"`
+	Right    Leaf    `json:"right"`
+}
+
+// Leaf is visited twice from Node without being recursive, it is not cut.
+type Leaf struct {
+	Value float64 `json:"value"`
+}
+
+// TestReflectGolden checks the schemas of types exercising the encoding/json rules against
+// the testdata/*.golden.json files, rewritten by go test -update.
+func TestReflectGolden(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		typ  reflect.Type
+	}{
+		{"embedded", reflect.TypeFor[Embedded]()},
+		{"optional", reflect.TypeFor[Optional]()},
+		{"recursive", reflect.TypeFor[*Node]()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := json.MarshalIndent(Reflect(tc.typ), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+			golden := filepath.Join("testdata", tc.name+".golden.json")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("schema of %s differs from %s:\n%s", tc.typ, golden, got)
+			}
+		})
+	}
+}
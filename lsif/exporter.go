@@ -0,0 +1,315 @@
+package lsif
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Providers bundles the handler functions queried during an export.
+// They have the same signatures as the handlers registered on a server.Server,
+// so a server can reuse its request handlers as is. Any provider may be nil.
+type Providers struct {
+	Hover      func(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error)
+	Definition func(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.Location, error)
+	References func(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error)
+}
+
+// SourceDocument is a document to index along with the ranges
+// (usually symbol occurrences) the providers should be queried for.
+type SourceDocument struct {
+	URI        protocol.DocumentURI
+	LanguageID protocol.LanguageID
+	Ranges     []protocol.Range
+}
+
+// Exporter writes an LSIF dump to an io.Writer.
+type Exporter struct {
+	w           *bufio.Writer
+	enc         *json.Encoder
+	providers   Providers
+	projectRoot protocol.DocumentURI
+	toolInfo    *ToolInfo
+	lastID      ID
+
+	documents  map[protocol.DocumentURI]ID
+	ranges     map[rangeKey]ID
+	resultSets map[rangeKey]ID // Keyed by the definition (or own) range of the symbol
+}
+
+// rangeKey identifies a range inside a document.
+type rangeKey struct {
+	uri protocol.DocumentURI
+	rng protocol.Range
+}
+
+// NewExporter creates an exporter writing to w.
+// projectRoot is written to the metaData vertex, toolInfo is optional.
+func NewExporter(w io.Writer, projectRoot protocol.DocumentURI, toolInfo *ToolInfo, providers Providers) *Exporter {
+	bw := bufio.NewWriter(w)
+	return &Exporter{
+		w:           bw,
+		enc:         json.NewEncoder(bw),
+		providers:   providers,
+		projectRoot: projectRoot,
+		toolInfo:    toolInfo,
+		documents:   make(map[protocol.DocumentURI]ID),
+		ranges:      make(map[rangeKey]ID),
+		resultSets:  make(map[rangeKey]ID),
+	}
+}
+
+// Export indexes docs and writes the complete dump.
+// Documents and ranges are emitted first so that results can point to
+// ranges in any document, then every range is resolved through the providers.
+func (e *Exporter) Export(ctx context.Context, docs []SourceDocument) error {
+	if err := e.emit(&MetaData{
+		Element:          e.element(TypeVertex, LabelMetaData),
+		Version:          Version,
+		ProjectRoot:      string(e.projectRoot),
+		PositionEncoding: "utf-16",
+		ToolInfo:         e.toolInfo,
+	}); err != nil {
+		return err
+	}
+
+	project := &Project{Element: e.element(TypeVertex, LabelProject), Kind: "lsp"}
+	if err := e.emit(project); err != nil {
+		return err
+	}
+
+	// Phase 1: documents and their ranges
+	docIDs := make([]ID, 0, len(docs))
+	for _, doc := range docs {
+		docID, err := e.emitDocument(doc.URI, doc.LanguageID)
+		if err != nil {
+			return err
+		}
+		docIDs = append(docIDs, docID)
+
+		if _, err := e.emitRanges(doc.URI, doc.Ranges); err != nil {
+			return err
+		}
+	}
+	if len(docIDs) > 0 {
+		if err := e.emitMultiEdge(LabelContains, project.ID, docIDs, 0, ""); err != nil {
+			return err
+		}
+	}
+
+	// Phase 2: results
+	for _, doc := range docs {
+		for _, rng := range doc.Ranges {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := e.resolveRange(ctx, doc.URI, rng); err != nil {
+				return fmt.Errorf("failed to index %s at %d:%d: %w", doc.URI, rng.Start.Line, rng.Start.Character, err)
+			}
+		}
+	}
+
+	return e.w.Flush()
+}
+
+// resolveRange queries the providers at the start of rng and links the range to a result set.
+func (e *Exporter) resolveRange(ctx context.Context, uri protocol.DocumentURI, rng protocol.Range) error {
+	rangeID := e.ranges[rangeKey{uri, rng}]
+	position := protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     rng.Start,
+	}
+
+	var definitions []protocol.Location
+	if e.providers.Definition != nil {
+		locs, err := e.providers.Definition(ctx, &protocol.DefinitionParams{TextDocumentPositionParams: position})
+		if err != nil {
+			return fmt.Errorf("definition provider: %w", err)
+		}
+		definitions = locs
+	}
+
+	// All occurrences of a symbol share the result set of its first definition
+	key := rangeKey{uri, rng}
+	if len(definitions) > 0 {
+		key = rangeKey{definitions[0].URI, definitions[0].Range}
+	}
+
+	resultSetID, exists := e.resultSets[key]
+	if !exists {
+		resultSetID = e.nextID()
+		if err := e.emit(&Element{ID: resultSetID, Type: TypeVertex, Label: LabelResultSet}); err != nil {
+			return err
+		}
+		e.resultSets[key] = resultSetID
+
+		if err := e.emitResults(ctx, resultSetID, position, definitions); err != nil {
+			return err
+		}
+	}
+
+	return e.emitEdge(LabelNext, rangeID, resultSetID)
+}
+
+// emitResults emits hover, definition and reference results attached to a result set.
+func (e *Exporter) emitResults(ctx context.Context, resultSetID ID, position protocol.TextDocumentPositionParams, definitions []protocol.Location) error {
+	if e.providers.Hover != nil {
+		hover, err := e.providers.Hover(ctx, &protocol.HoverParams{TextDocumentPositionParams: position})
+		if err != nil {
+			return fmt.Errorf("hover provider: %w", err)
+		}
+		if hover != nil {
+			hoverResult := &HoverResult{Element: e.element(TypeVertex, LabelHoverResult), Result: *hover}
+			hoverResult.Result.Range = nil // Ranges are carried by the range vertices
+			if err := e.emit(hoverResult); err != nil {
+				return err
+			}
+			if err := e.emitEdge(LabelHover, resultSetID, hoverResult.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(definitions) > 0 {
+		definitionResult := e.element(TypeVertex, LabelDefinitionResult)
+		if err := e.emit(&definitionResult); err != nil {
+			return err
+		}
+		if err := e.emitEdge(LabelDefinition, resultSetID, definitionResult.ID); err != nil {
+			return err
+		}
+		if err := e.emitItems(definitionResult.ID, definitions, ""); err != nil {
+			return err
+		}
+	}
+
+	if e.providers.References != nil {
+		references, err := e.providers.References(ctx, &protocol.ReferenceParams{
+			TextDocumentPositionParams: position,
+			Context:                    protocol.ReferenceContext{IncludeDeclaration: false},
+		})
+		if err != nil {
+			return fmt.Errorf("references provider: %w", err)
+		}
+		if len(references) > 0 || len(definitions) > 0 {
+			referenceResult := e.element(TypeVertex, LabelReferenceResult)
+			if err := e.emit(&referenceResult); err != nil {
+				return err
+			}
+			if err := e.emitEdge(LabelReferences, resultSetID, referenceResult.ID); err != nil {
+				return err
+			}
+			if err := e.emitItems(referenceResult.ID, definitions, PropertyDefinitions); err != nil {
+				return err
+			}
+			if err := e.emitItems(referenceResult.ID, references, PropertyReferences); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// emitItems emits one item edge per document for the given locations.
+// Locations in documents that are not part of the dump are skipped.
+func (e *Exporter) emitItems(outV ID, locations []protocol.Location, property string) error {
+	byDocument := make(map[protocol.DocumentURI][]protocol.Range)
+	var order []protocol.DocumentURI
+	for _, loc := range locations {
+		if _, ok := e.documents[loc.URI]; !ok {
+			continue
+		}
+		if _, seen := byDocument[loc.URI]; !seen {
+			order = append(order, loc.URI)
+		}
+		byDocument[loc.URI] = append(byDocument[loc.URI], loc.Range)
+	}
+
+	for _, uri := range order {
+		rangeIDs, err := e.emitRanges(uri, byDocument[uri])
+		if err != nil {
+			return err
+		}
+		if err := e.emitMultiEdge(LabelItem, outV, rangeIDs, e.documents[uri], property); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitDocument emits a document vertex.
+func (e *Exporter) emitDocument(uri protocol.DocumentURI, languageID protocol.LanguageID) (ID, error) {
+	if id, ok := e.documents[uri]; ok {
+		return id, nil
+	}
+	doc := &Document{Element: e.element(TypeVertex, LabelDocument), URI: uri, LanguageID: languageID}
+	if err := e.emit(doc); err != nil {
+		return 0, err
+	}
+	e.documents[uri] = doc.ID
+	return doc.ID, nil
+}
+
+// emitRanges returns the IDs of the given ranges, emitting the ones not seen yet
+// along with the contains edge linking them to their document.
+func (e *Exporter) emitRanges(uri protocol.DocumentURI, ranges []protocol.Range) ([]ID, error) {
+	ids := make([]ID, 0, len(ranges))
+	var created []ID
+	for _, rng := range ranges {
+		key := rangeKey{uri, rng}
+		if id, ok := e.ranges[key]; ok {
+			ids = append(ids, id)
+			continue
+		}
+		v := &Range{Element: e.element(TypeVertex, LabelRange), Start: rng.Start, End: rng.End}
+		if err := e.emit(v); err != nil {
+			return nil, err
+		}
+		e.ranges[key] = v.ID
+		ids = append(ids, v.ID)
+		created = append(created, v.ID)
+	}
+	if len(created) > 0 {
+		if err := e.emitMultiEdge(LabelContains, e.documents[uri], created, 0, ""); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+func (e *Exporter) emitEdge(label string, outV, inV ID) error {
+	return e.emit(&Edge{Element: e.element(TypeEdge, label), OutV: outV, InV: inV})
+}
+
+func (e *Exporter) emitMultiEdge(label string, outV ID, inVs []ID, document ID, property string) error {
+	return e.emit(&MultiEdge{
+		Element:  e.element(TypeEdge, label),
+		OutV:     outV,
+		InVs:     inVs,
+		Document: document,
+		Property: property,
+	})
+}
+
+// element allocates a new element header.
+func (e *Exporter) element(typ, label string) Element {
+	return Element{ID: e.nextID(), Type: typ, Label: label}
+}
+
+func (e *Exporter) nextID() ID {
+	e.lastID++
+	return e.lastID
+}
+
+// emit writes a single element as one JSON line.
+func (e *Exporter) emit(v any) error {
+	if err := e.enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write lsif element: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package lsif
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// line is an element of the dump, with the fields of all vertices and edges checked.
+type line struct {
+	ID       ID
+	Type     string
+	Label    string
+	OutV     ID
+	InV      ID
+	InVs     []ID
+	Document ID
+	Property string
+	URI      protocol.DocumentURI
+}
+
+func TestExport(t *testing.T) {
+	const a, b = protocol.DocumentURI("file:///p/a.go"), protocol.DocumentURI("file:///p/b.go")
+	decl := protocol.Range{Start: protocol.Position{Line: 0, Character: 5}, End: protocol.Position{Line: 0, Character: 8}}
+	use := protocol.Range{Start: protocol.Position{Line: 2, Character: 1}, End: protocol.Position{Line: 2, Character: 4}}
+
+	providers := Providers{
+		Hover: func(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
+			return &protocol.Hover{Contents: protocol.MarkupContent{Kind: protocol.PlainText, Value: "func foo()"}}, nil
+		},
+		Definition: func(ctx context.Context, params *protocol.DefinitionParams) ([]protocol.Location, error) {
+			return []protocol.Location{{URI: a, Range: decl}}, nil
+		},
+		References: func(ctx context.Context, params *protocol.ReferenceParams) ([]protocol.Location, error) {
+			return []protocol.Location{{URI: b, Range: use}}, nil
+		},
+	}
+	var out bytes.Buffer
+	e := NewExporter(&out, "file:///p", &ToolInfo{Name: "test"}, providers)
+	err := e.Export(context.Background(), []SourceDocument{
+		{URI: a, LanguageID: "go", Ranges: []protocol.Range{decl}},
+		{URI: b, LanguageID: "go", Ranges: []protocol.Range{use}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []line
+	byID := make(map[ID]line)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var l line
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			t.Fatalf("invalid line %s: %v", scanner.Bytes(), err)
+		}
+		if _, dup := byID[l.ID]; dup {
+			t.Fatalf("duplicate id %d", l.ID)
+		}
+		lines = append(lines, l)
+		byID[l.ID] = l
+	}
+	if len(lines) == 0 || lines[0].Label != LabelMetaData {
+		t.Fatal("dump doesn't start with the metaData vertex")
+	}
+	labelled := func(typ, label string) []line {
+		var found []line
+		for _, l := range lines {
+			if l.Type == typ && l.Label == label {
+				found = append(found, l)
+			}
+		}
+		return found
+	}
+
+	// The document of each range, from the contains edges
+	documents := make(map[protocol.DocumentURI]ID)
+	for _, doc := range labelled(TypeVertex, LabelDocument) {
+		documents[doc.URI] = doc.ID
+	}
+	if len(documents) != 2 {
+		t.Fatalf("got %d documents, want 2", len(documents))
+	}
+	rangeDocument := make(map[ID]ID)
+	for _, edge := range labelled(TypeEdge, LabelContains) {
+		if byID[edge.OutV].Label != LabelDocument {
+			continue // Project to documents
+		}
+		for _, inV := range edge.InVs {
+			rangeDocument[inV] = edge.OutV
+		}
+	}
+	if ranges := labelled(TypeVertex, LabelRange); len(ranges) != 2 {
+		t.Fatalf("got %d ranges, want the declaration and the use", len(ranges))
+	}
+
+	// Both occurrences share the result set of the declaration
+	resultSets := labelled(TypeVertex, LabelResultSet)
+	if len(resultSets) != 1 {
+		t.Fatalf("got %d result sets, want 1", len(resultSets))
+	}
+	next := labelled(TypeEdge, LabelNext)
+	if len(next) != 2 {
+		t.Fatalf("got %d next edges, want 2", len(next))
+	}
+	for _, edge := range next {
+		if edge.InV != resultSets[0].ID || byID[edge.OutV].Label != LabelRange {
+			t.Errorf("next edge %d links %d to %d, want a range to the result set %d", edge.ID, edge.OutV, edge.InV, resultSets[0].ID)
+		}
+	}
+
+	for _, label := range []string{LabelHover, LabelDefinition, LabelReferences} {
+		edges := labelled(TypeEdge, label)
+		if len(edges) != 1 || edges[0].OutV != resultSets[0].ID {
+			t.Errorf("want one %s edge from the result set, got %+v", label, edges)
+		}
+	}
+
+	// Item edges carry the document of their ranges, and the property for references
+	properties := make(map[ID][]string) // By out vertex
+	for _, edge := range labelled(TypeEdge, LabelItem) {
+		if edge.Document == 0 {
+			t.Errorf("item edge %d has no document", edge.ID)
+		}
+		for _, inV := range edge.InVs {
+			if rangeDocument[inV] != edge.Document {
+				t.Errorf("item edge %d: range %d is in document %d, the edge says %d", edge.ID, inV, rangeDocument[inV], edge.Document)
+			}
+		}
+		switch byID[edge.OutV].Label {
+		case LabelDefinitionResult:
+			if edge.Property != "" || edge.Document != documents[a] {
+				t.Errorf("definition item edge %+v, want no property and document %d", edge, documents[a])
+			}
+		case LabelReferenceResult:
+			properties[edge.OutV] = append(properties[edge.OutV], edge.Property)
+		default:
+			t.Errorf("item edge %d from a %s", edge.ID, byID[edge.OutV].Label)
+		}
+	}
+	if len(properties) != 1 {
+		t.Fatalf("got item edges from %d reference results, want 1", len(properties))
+	}
+	for _, got := range properties {
+		if want := []string{PropertyDefinitions, PropertyReferences}; !slices.Equal(got, want) {
+			t.Errorf("got reference item properties %q, want %q", got, want)
+		}
+	}
+}
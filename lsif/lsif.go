@@ -0,0 +1,115 @@
+// Package lsif dumps the index data of a language server (definitions,
+// references, hovers) into the Language Server Index Format, so editors and
+// code hosts can offer navigation without running the server.
+//
+// The output is the line-delimited JSON flavour of LSIF 0.6: one vertex or
+// edge per line.
+package lsif
+
+import (
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Version is the LSIF format version written in the metaData vertex.
+const Version = "0.6.0"
+
+// ID identifies a vertex or an edge in the dump.
+type ID int
+
+// Element types.
+const (
+	TypeVertex = "vertex"
+	TypeEdge   = "edge"
+)
+
+// Vertex labels.
+const (
+	LabelMetaData         = "metaData"
+	LabelProject          = "project"
+	LabelDocument         = "document"
+	LabelRange            = "range"
+	LabelResultSet        = "resultSet"
+	LabelHoverResult      = "hoverResult"
+	LabelDefinitionResult = "definitionResult"
+	LabelReferenceResult  = "referenceResult"
+)
+
+// Edge labels.
+const (
+	LabelContains   = "contains"
+	LabelNext       = "next"
+	LabelItem       = "item"
+	LabelHover      = "textDocument/hover"
+	LabelDefinition = "textDocument/definition"
+	LabelReferences = "textDocument/references"
+)
+
+// Item edge properties used for reference results.
+const (
+	PropertyDefinitions = "definitions"
+	PropertyReferences  = "references"
+)
+
+// Element is the common header of every vertex and edge.
+type Element struct {
+	ID    ID     `json:"id"`
+	Type  string `json:"type"`
+	Label string `json:"label"`
+}
+
+// ToolInfo describes the tool that produced the dump.
+type ToolInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// MetaData is the first vertex of every dump.
+type MetaData struct {
+	Element
+	Version          string    `json:"version"`
+	ProjectRoot      string    `json:"projectRoot"`
+	PositionEncoding string    `json:"positionEncoding"` // always utf-16
+	ToolInfo         *ToolInfo `json:"toolInfo,omitempty"`
+}
+
+// Project groups the documents of the dump.
+type Project struct {
+	Element
+	Kind string `json:"kind"`
+}
+
+// Document is a text document vertex.
+type Document struct {
+	Element
+	URI        protocol.DocumentURI `json:"uri"`
+	LanguageID protocol.LanguageID  `json:"languageId"`
+}
+
+// Range is a range vertex inside a document.
+type Range struct {
+	Element
+	Start protocol.Position `json:"start"`
+	End   protocol.Position `json:"end"`
+}
+
+// HoverResult holds the hover content of a result set.
+type HoverResult struct {
+	Element
+	Result protocol.Hover `json:"result"`
+}
+
+// Edge connects a single out vertex to a single in vertex.
+type Edge struct {
+	Element
+	OutV ID `json:"outV"`
+	InV  ID `json:"inV"`
+}
+
+// MultiEdge connects a single out vertex to many in vertices.
+type MultiEdge struct {
+	Element
+	OutV     ID     `json:"outV"`
+	InVs     []ID   `json:"inVs"`
+	Document ID     `json:"document,omitempty"` // Only set on item edges
+	Property string `json:"property,omitempty"` // Only set on item edges of reference results
+}
@@ -0,0 +1,301 @@
+// Package lsptest runs the same scenario against a language server under several client
+// capability sets, to check that the server adapts what it sends to each client: markdown
+// or plain text, snippets or plain insert text, documentChanges or changes.
+//
+//	func TestHover(t *testing.T) {
+//		start := lsptest.InProcess(newServer)
+//		lsptest.Run(t, start, lsptest.MarkupPresets, func(t *testing.T, s *lsptest.Session) {
+//			uri := s.OpenText(t, "a.txt", "hello")
+//			var hover protocol.Hover
+//			s.MustCall(t, protocol.MethodTextDocumentHover, hoverAt(uri), &hover)
+//			s.AssertMarkup(t, hover.Contents)
+//		})
+//	}
+//
+// Workspace edits are checked by their effect on the files of the session:
+//
+//	var edit protocol.WorkspaceEdit
+//	s.MustCall(t, protocol.MethodTextDocumentRename, renameAt(uri), &edit)
+//	s.ApplyEdit(t, edit)
+//	s.Workspace.AssertGolden(t, uri, "testdata/rename.golden")
+package lsptest
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/client"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// Timeout bounds each call of a Session helper.
+var Timeout = 10 * time.Second
+
+// Preset is a client capability set a scenario runs under: the capabilities of a profile,
+// changed by Tweak.
+type Preset struct {
+	Name    string
+	Profile client.Profile // ProfileMinimal when empty
+	Tweak   func(caps *protocol.ClientCapabilities)
+}
+
+// Presets differing by one capability from the VS Code profile.
+var (
+	Markdown = Preset{Name: "markdown", Profile: client.ProfileVSCode}
+	// PlainText only renders plain text, in hovers and completion documentation.
+	PlainText = Preset{Name: "plaintext", Profile: client.ProfileVSCode, Tweak: func(caps *protocol.ClientCapabilities) {
+		caps.TextDocument.Hover.ContentFormat = []protocol.MarkupKind{protocol.PlainText}
+		caps.TextDocument.Completion.CompletionItem.DocumentationFormat = []protocol.MarkupKind{protocol.PlainText}
+	}}
+	Snippets   = Preset{Name: "snippets", Profile: client.ProfileVSCode}
+	NoSnippets = Preset{Name: "no-snippets", Profile: client.ProfileVSCode, Tweak: func(caps *protocol.ClientCapabilities) {
+		caps.TextDocument.Completion.CompletionItem.SnippetSupport = false
+	}}
+	DocumentChanges = Preset{Name: "documentChanges", Profile: client.ProfileVSCode}
+	// Changes only applies plain changes, not versioned documentChanges.
+	Changes = Preset{Name: "changes", Profile: client.ProfileVSCode, Tweak: func(caps *protocol.ClientCapabilities) {
+		caps.Workspace.WorkspaceEdit.DocumentChanges = false
+		caps.Workspace.WorkspaceEdit.ChangeAnnotationSupport = nil
+	}}
+)
+
+// Preset matrices, for the scenarios checking one kind of adaptation.
+var (
+	MarkupPresets        = []Preset{Markdown, PlainText}
+	SnippetPresets       = []Preset{Snippets, NoSnippets}
+	WorkspaceEditPresets = []Preset{DocumentChanges, Changes}
+	// ProfilePresets are the editor profiles as they are.
+	ProfilePresets = []Preset{
+		{Name: "minimal", Profile: client.ProfileMinimal},
+		{Name: "vscode", Profile: client.ProfileVSCode},
+		{Name: "neovim", Profile: client.ProfileNeovim},
+	}
+)
+
+// Starter starts a server for a test and returns the stream to talk to it. The server is
+// stopped when the test ends.
+type Starter func(t testing.TB) io.ReadWriter
+
+// InProcess starts servers created by newServer with the given stream, e.g.
+//
+//	func(stream io.ReadWriter) *server.Server {
+//		s := server.NewServer(server.WithStream(stream))
+//		s.Register(protocol.MethodTextDocumentHover, handleHover)
+//		return s
+//	}
+//
+// The exit notification ends the process, in-process servers are only shut down.
+func InProcess(newServer func(stream io.ReadWriter) *server.Server) Starter {
+	return func(t testing.TB) io.ReadWriter {
+		clientR, serverW := io.Pipe()
+		serverR, clientW := io.Pipe()
+		s := newServer(server.ReadWriter{Reader: serverR, Writer: serverW})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.Run(ctx)
+		}()
+		t.Cleanup(func() {
+			cancel()
+			serverR.Close()
+			serverW.Close()
+			<-done
+		})
+		return inProcessStream{client.Stdio{Reader: clientR, Writer: clientW}}
+	}
+}
+
+// inProcessStream is the stream of a server started by InProcess, which is only shut down
+// when the test ends.
+type inProcessStream struct{ client.Stdio }
+
+// Command starts the server binary name with args, its stderr going to the test log.
+func Command(name string, args ...string) Starter {
+	return func(t testing.TB) io.ReadWriter {
+		cmd := exec.Command(name, args...)
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			t.Fatalf("failed to start %s: %v", name, err)
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatalf("failed to start %s: %v", name, err)
+		}
+		cmd.Stderr = logWriter{t}
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("failed to start %s: %v", name, err)
+		}
+		t.Cleanup(func() {
+			stdin.Close()
+			exited := make(chan struct{})
+			go func() {
+				cmd.Wait()
+				close(exited)
+			}()
+			select {
+			case <-exited:
+			case <-time.After(Timeout):
+				cmd.Process.Kill()
+				<-exited
+			}
+		})
+		return client.Stdio{Reader: stdout, Writer: stdin}
+	}
+}
+
+// logWriter writes the output of a server process to the test log.
+type logWriter struct{ t testing.TB }
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.t.Logf("%s", p)
+	return len(p), nil
+}
+
+// Session is a client initialized with the capabilities of a preset.
+type Session struct {
+	*client.Client
+	Preset       Preset
+	Capabilities protocol.ClientCapabilities
+	Result       *protocol.InitializeResult
+	Dir          string // Workspace folder, empty and removed when the test ends
+
+	// Workspace holds the files of Dir as the edits of the server leave them: the ones it
+	// sends with workspace/applyEdit are applied and answered, the ones it returns are
+	// applied with ApplyEdit.
+	Workspace *Workspace
+}
+
+// Run runs scenario as a subtest for each preset, each against a new server.
+func Run(t *testing.T, start Starter, presets []Preset, scenario func(t *testing.T, s *Session)) {
+	t.Helper()
+	for _, preset := range presets {
+		t.Run(preset.Name, func(t *testing.T) {
+			s := Start(t, start, preset)
+			scenario(t, s)
+		})
+	}
+}
+
+// Start starts a server and initializes a client with the capabilities of preset.
+func Start(t testing.TB, start Starter, preset Preset) *Session {
+	t.Helper()
+	profile := preset.Profile
+	if profile == "" {
+		profile = client.ProfileMinimal
+	}
+	s := &Session{Preset: preset, Dir: t.TempDir()}
+	b := client.NewInitializeBuilder().Profile(profile).WorkspaceFolder(s.Dir)
+	if preset.Tweak != nil {
+		b.Capabilities(preset.Tweak)
+	}
+	params, err := b.Build()
+	if err != nil {
+		t.Fatalf("invalid preset %s: %v", preset.Name, err)
+	}
+	s.Capabilities = params.Capabilities
+
+	rw := start(t)
+	s.Client = client.New(rw)
+	s.Workspace = NewWorkspace()
+	s.Workspace.Root = s.Dir
+	s.Workspace.Versions = func(uri protocol.DocumentURI) (int, bool) {
+		_, version, open := s.Text(uri)
+		return version, open
+	}
+	s.OnRequest(protocol.MethodWorkspaceApplyEdit, s.handleApplyEdit)
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if s.Result, err = s.Initialize(ctx, params); err != nil {
+		t.Fatalf("%s: %v", preset.Name, err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+		defer cancel()
+		if _, inProcess := rw.(inProcessStream); inProcess {
+			s.Call(ctx, protocol.MethodShutdown, nil, nil)
+		} else {
+			s.Shutdown(ctx)
+		}
+		s.Close()
+	})
+	return s
+}
+
+// OpenText writes text to the file name of the workspace folder and opens it.
+func (s *Session) OpenText(t testing.TB, name, text string) protocol.DocumentURI {
+	t.Helper()
+	path := filepath.Join(s.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	uri, err := s.OpenFile(ctx, path)
+	if err != nil {
+		t.Fatalf("failed to open %s: %v", name, err)
+	}
+	return uri
+}
+
+// MustCall sends a request and fails the test when it fails.
+func (s *Session) MustCall(t testing.TB, method string, params, result any) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := s.Call(ctx, method, params, result); err != nil {
+		t.Fatalf("%s failed under %s: %v", method, s.Preset.Name, err)
+	}
+}
+
+// AssertMarkup checks content is in the format the client prefers for hovers.
+func (s *Session) AssertMarkup(t testing.TB, content protocol.MarkupContent) {
+	t.Helper()
+	if want := s.Capabilities.HoverContentFormat(); content.Kind != want {
+		t.Errorf("%s: got %s content, the client prefers %s", s.Preset.Name, content.Kind, want)
+	}
+}
+
+// AssertCompletionItems checks the items only use snippets and markdown documentation when
+// the client supports them.
+func (s *Session) AssertCompletionItems(t testing.TB, items []protocol.CompletionItem) {
+	t.Helper()
+	snippets := s.Capabilities.SupportsSnippets()
+	documentation := s.Capabilities.CompletionDocumentationFormat()
+	for _, item := range items {
+		if !snippets && item.InsertTextFormat != nil && *item.InsertTextFormat == protocol.SnippetFormat {
+			t.Errorf("%s: item %q is a snippet, the client doesn't support them", s.Preset.Name, item.Label)
+		}
+		if item.Documentation != nil && item.Documentation.Kind == protocol.Markdown && documentation != protocol.Markdown {
+			t.Errorf("%s: item %q has markdown documentation, the client prefers %s", s.Preset.Name, item.Label, documentation)
+		}
+	}
+}
+
+// AssertWorkspaceEdit checks the edit uses documentChanges when the client supports them,
+// plain changes otherwise.
+func (s *Session) AssertWorkspaceEdit(t testing.TB, edit protocol.WorkspaceEdit) {
+	t.Helper()
+	if s.Capabilities.SupportsDocumentChanges() {
+		if len(edit.Changes) > 0 {
+			t.Errorf("%s: edit has changes, the client supports documentChanges", s.Preset.Name)
+		}
+		return
+	}
+	if len(edit.DocumentChanges) > 0 {
+		t.Errorf("%s: edit has documentChanges, the client doesn't support them", s.Preset.Name)
+	}
+	if len(edit.ChangeAnnotations) > 0 {
+		t.Errorf("%s: edit has change annotations, the client doesn't support them", s.Preset.Name)
+	}
+}
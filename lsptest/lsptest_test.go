@@ -0,0 +1,125 @@
+package lsptest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+// newAdaptingServer returns a server whose hover, completion and rename follow the
+// capabilities of the client.
+func newAdaptingServer(stream io.ReadWriter) *server.Server {
+	s := server.NewServer(server.WithStream(stream), server.WithLogger(log.New(io.Discard, "", 0)))
+	s.Register(protocol.MethodTextDocumentHover, func(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
+		kind := s.ClientCapabilities().HoverContentFormat()
+		return &protocol.Hover{Contents: protocol.MarkupContent{Kind: kind, Value: "hello"}}, nil
+	})
+	s.Register(protocol.MethodTextDocumentCompletion, func(ctx context.Context, params *protocol.CompletionParams) ([]protocol.CompletionItem, error) {
+		caps := s.ClientCapabilities()
+		item := protocol.CompletionItem{
+			Label:         "greet",
+			InsertText:    "greet()",
+			Documentation: caps.CompletionDocumentation(func(protocol.MarkupKind) string { return "Greets." }),
+		}
+		if caps.SupportsSnippets() {
+			format := protocol.SnippetFormat
+			item.InsertText, item.InsertTextFormat = "greet($1)", &format
+		}
+		return []protocol.CompletionItem{item}, nil
+	})
+	s.Register(protocol.MethodTextDocumentRename, func(ctx context.Context, params *protocol.RenameParams) (*protocol.WorkspaceEdit, error) {
+		snapshot, _ := server.SnapshotFromContext(ctx)
+		b := protocol.NewWorkspaceEditBuilder().SetVersion(snapshot.URI, snapshot.Version)
+		b.Replace(snapshot.URI, protocol.Range{End: protocol.Position{Character: 5}}, params.NewName)
+		edit, err := b.Build(s.ClientCapabilities().SupportsDocumentChanges())
+		return &edit, err
+	})
+	return s
+}
+
+func TestRunInProcess(t *testing.T) {
+	start := InProcess(newAdaptingServer)
+	position := func(uri protocol.DocumentURI) protocol.TextDocumentPositionParams {
+		return protocol.TextDocumentPositionParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}}
+	}
+
+	t.Run("markup", func(t *testing.T) {
+		Run(t, start, MarkupPresets, func(t *testing.T, s *Session) {
+			uri := s.OpenText(t, "a.txt", "hello world")
+			var hover protocol.Hover
+			s.MustCall(t, protocol.MethodTextDocumentHover, protocol.HoverParams{TextDocumentPositionParams: position(uri)}, &hover)
+			s.AssertMarkup(t, hover.Contents)
+		})
+	})
+
+	t.Run("snippets", func(t *testing.T) {
+		Run(t, start, SnippetPresets, func(t *testing.T, s *Session) {
+			uri := s.OpenText(t, "a.txt", "hello world")
+			var items []protocol.CompletionItem
+			s.MustCall(t, protocol.MethodTextDocumentCompletion, protocol.CompletionParams{TextDocumentPositionParams: position(uri)}, &items)
+			if len(items) != 1 {
+				t.Fatalf("got %d items, want 1", len(items))
+			}
+			s.AssertCompletionItems(t, items)
+		})
+	})
+
+	t.Run("workspace edits", func(t *testing.T) {
+		Run(t, start, WorkspaceEditPresets, func(t *testing.T, s *Session) {
+			uri := s.OpenText(t, "a.txt", "hello world")
+			var edit protocol.WorkspaceEdit
+			s.MustCall(t, protocol.MethodTextDocumentRename, protocol.RenameParams{TextDocumentPositionParams: position(uri), NewName: "goodbye"}, &edit)
+			s.AssertWorkspaceEdit(t, edit)
+			s.ApplyEdit(t, edit)
+			s.Workspace.AssertFile(t, uri, "goodbye world")
+		})
+	})
+}
+
+// TestStartCustomStarter checks a starter returning its own stream type is shut down
+// without assumptions on the type.
+func TestStartCustomStarter(t *testing.T) {
+	exited := make(chan struct{})
+	start := func(t testing.TB) io.ReadWriter {
+		local, peer := net.Pipe()
+		// A peer answering every request with an empty result, until exit
+		go func() {
+			defer close(exited)
+			defer peer.Close()
+			stream := jsonrpc2.NewStream(peer)
+			for {
+				data, err := stream.ReadMessage()
+				if err != nil {
+					return
+				}
+				var msg struct {
+					ID     json.RawMessage
+					Method string
+				}
+				if err := json.Unmarshal(data, &msg); err != nil || msg.Method == protocol.MethodExit {
+					return
+				}
+				if msg.ID != nil {
+					stream.WriteMessage(&jsonrpc2.ResponseMessage{JSONRPC: jsonrpc2.Version, ID: msg.ID, Result: json.RawMessage(`{"capabilities":{}}`)}) //nolint:errcheck
+				}
+			}
+		}()
+		return local
+	}
+	t.Run("session", func(t *testing.T) {
+		Start(t, start, Markdown)
+	})
+	select {
+	case <-exited:
+	case <-time.After(Timeout):
+		t.Fatal("server not shut down")
+	}
+}
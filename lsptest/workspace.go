@@ -0,0 +1,436 @@
+package lsptest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// update rewrites the golden files of AssertGolden instead of comparing them:
+//
+//	go test ./... -lsptest.update
+var update = flag.Bool("lsptest.update", false, "rewrite the golden files of lsptest.AssertGolden")
+
+// Workspace is an in-memory copy of the files of a test, changed by the workspace edits the
+// server returns or sends. Tests assert on the resulting files rather than on the edits, so
+// that a scenario passes whether the server encodes them as changes or documentChanges.
+//
+// The workspace only knows the files set with SetFile or created by edits, unless Root is
+// set: the files under Root are then read from disk the first time an edit or an assertion
+// needs them, and only change in memory. The files on disk are never written.
+type Workspace struct {
+	// Versions returns the version of an open document, to reject the versioned text
+	// document edits of a stale version as editors do. Nil skips the check.
+	Versions func(uri protocol.DocumentURI) (version int, open bool)
+	// Root is the folder whose files are read from disk. Empty, the test results don't
+	// depend on the files on disk.
+	Root string
+
+	mu    sync.Mutex
+	files map[protocol.DocumentURI]*file // By canonical URI, nil for the deleted ones
+}
+
+// file is a file of a Workspace.
+type file struct {
+	uri  protocol.DocumentURI // As last named by the server or the test
+	text string
+}
+
+// NewWorkspace returns an empty workspace.
+func NewWorkspace() *Workspace {
+	return &Workspace{files: make(map[protocol.DocumentURI]*file)}
+}
+
+// SetFile sets the text of a file, e.g. an unsaved document the edits apply to.
+func (w *Workspace) SetFile(uri protocol.DocumentURI, text string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.files[uri.Canonical()] = &file{uri: uri, text: text}
+}
+
+// File returns the text of a file. ok is false when the file doesn't exist, or was deleted
+// by an edit.
+func (w *Workspace) File(uri protocol.DocumentURI) (text string, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f := w.fileSet(w.files).lookup(uri)
+	if f == nil {
+		return "", false
+	}
+	return f.text, true
+}
+
+// URIs returns the files of the workspace known so far, sorted: the ones set, edited or
+// read from disk under Root, not the deleted ones.
+func (w *Workspace) URIs() []protocol.DocumentURI {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var uris []protocol.DocumentURI
+	for _, f := range w.files {
+		if f != nil {
+			uris = append(uris, f.uri)
+		}
+	}
+	sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+	return uris
+}
+
+// Apply applies a workspace edit: its documentChanges in order when it has some, its
+// changes otherwise, as the protocol requires of clients. It is all or nothing: when a
+// change fails (invalid edits, stale version, resource operation refused by its options),
+// the error names it and the workspace is left as it was.
+func (w *Workspace) Apply(edit protocol.WorkspaceEdit) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	files := w.fileSet(maps.Clone(w.files))
+
+	if len(edit.DocumentChanges) == 0 {
+		uris := make([]protocol.DocumentURI, 0, len(edit.Changes))
+		for uri := range edit.Changes {
+			uris = append(uris, uri)
+		}
+		sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+		for _, uri := range uris {
+			if err := files.edit(uri, edit.Changes[uri]); err != nil {
+				return err
+			}
+		}
+		w.files = files.files
+		return nil
+	}
+
+	for i, change := range edit.DocumentChanges {
+		var err error
+		switch {
+		case change.TextDocumentEdit != nil:
+			err = w.checkVersion(change.TextDocumentEdit.TextDocument)
+			if err == nil {
+				err = files.edit(change.URI(), change.TextDocumentEdit.Edits)
+			}
+		case change.CreateFile != nil:
+			err = files.create(change.CreateFile)
+		case change.RenameFile != nil:
+			err = files.rename(change.RenameFile)
+		case change.DeleteFile != nil:
+			err = files.delete(change.DeleteFile)
+		default:
+			err = errors.New("empty document change")
+		}
+		if err != nil {
+			return fmt.Errorf("document change %d: %w", i, err)
+		}
+	}
+	w.files = files.files
+	return nil
+}
+
+// checkVersion fails for a versioned edit of an open document at another version.
+func (w *Workspace) checkVersion(doc protocol.OptionalVersionedTextDocumentIdentifier) error {
+	if doc.Version == nil || w.Versions == nil {
+		return nil
+	}
+	if version, open := w.Versions(doc.URI); open && version != *doc.Version {
+		return fmt.Errorf("edit of %s is for version %d, the document is at version %d", doc.URI, *doc.Version, version)
+	}
+	return nil
+}
+
+// fileSet is the files of a workspace an edit is applied to, with the folder they are read
+// from.
+type fileSet struct {
+	files map[protocol.DocumentURI]*file
+	root  string
+}
+
+// fileSet returns the files of w read from files and from Root.
+func (w *Workspace) fileSet(files map[protocol.DocumentURI]*file) fileSet {
+	return fileSet{files: files, root: w.Root}
+}
+
+// onDisk returns the path of uri when it is under the root, false otherwise.
+func (s fileSet) onDisk(uri protocol.DocumentURI) (string, bool) {
+	if s.root == "" {
+		return "", false
+	}
+	path, err := uri.Path()
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return path, true
+}
+
+// lookup returns a file, reading it from disk the first time when it is under the root. It
+// returns nil for the files which don't exist.
+func (s fileSet) lookup(uri protocol.DocumentURI) *file {
+	key := uri.Canonical()
+	if f, known := s.files[key]; known {
+		return f
+	}
+	path, ok := s.onDisk(uri)
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	f := &file{uri: uri, text: string(data)}
+	s.files[key] = f
+	return f
+}
+
+// edit applies the text edits of a file.
+func (s fileSet) edit(uri protocol.DocumentURI, edits []protocol.TextEdit) error {
+	f := s.lookup(uri)
+	if f == nil {
+		return fmt.Errorf("edit of %s: no such file", uri)
+	}
+	text, err := textdocument.ApplyEdits(f.text, edits)
+	if err != nil {
+		return fmt.Errorf("edit of %s: %w", uri, err)
+	}
+	s.files[uri.Canonical()] = &file{uri: f.uri, text: text}
+	return nil
+}
+
+// create applies a create operation, an existing file is kept or emptied by its options.
+func (s fileSet) create(op *protocol.CreateFile) error {
+	var options protocol.CreateFileOptions
+	if op.Options != nil {
+		options = *op.Options
+	}
+	if s.lookup(op.URI) != nil {
+		switch {
+		case options.Overwrite:
+		case options.IgnoreIfExists:
+			return nil
+		default:
+			return fmt.Errorf("create %s: file exists", op.URI)
+		}
+	}
+	s.files[op.URI.Canonical()] = &file{uri: op.URI}
+	return nil
+}
+
+// rename applies a rename operation, of a file or of a folder and the files under it.
+func (s fileSet) rename(op *protocol.RenameFile) error {
+	var options protocol.RenameFileOptions
+	if op.Options != nil {
+		options = *op.Options
+	}
+	if target := s.lookup(op.NewURI); target != nil || len(s.under(op.NewURI)) > 0 {
+		switch {
+		case options.Overwrite:
+		case options.IgnoreIfExists:
+			return nil
+		default:
+			return fmt.Errorf("rename %s to %s: target exists", op.OldURI, op.NewURI)
+		}
+	}
+
+	if f := s.lookup(op.OldURI); f != nil {
+		s.files[op.OldURI.Canonical()] = nil
+		s.files[op.NewURI.Canonical()] = &file{uri: op.NewURI, text: f.text}
+		return nil
+	}
+	children := s.under(op.OldURI)
+	if len(children) == 0 {
+		return fmt.Errorf("rename %s: no such file", op.OldURI)
+	}
+	oldPrefix := strings.TrimSuffix(string(op.OldURI.Canonical()), "/")
+	newPrefix := strings.TrimSuffix(string(op.NewURI), "/")
+	for _, f := range children {
+		uri := protocol.DocumentURI(newPrefix + strings.TrimPrefix(string(f.uri.Canonical()), oldPrefix))
+		s.files[f.uri.Canonical()] = nil
+		s.files[uri.Canonical()] = &file{uri: uri, text: f.text}
+	}
+	return nil
+}
+
+// delete applies a delete operation, of a file or of a folder when recursive.
+func (s fileSet) delete(op *protocol.DeleteFile) error {
+	var options protocol.DeleteFileOptions
+	if op.Options != nil {
+		options = *op.Options
+	}
+	if s.lookup(op.URI) != nil {
+		s.files[op.URI.Canonical()] = nil
+		return nil
+	}
+	children := s.under(op.URI)
+	switch {
+	case len(children) == 0 && options.IgnoreIfNotExists:
+		return nil
+	case len(children) == 0:
+		return fmt.Errorf("delete %s: no such file", op.URI)
+	case !options.Recursive:
+		return fmt.Errorf("delete %s: folder not empty, the operation is not recursive", op.URI)
+	}
+	for _, f := range children {
+		s.files[f.uri.Canonical()] = nil
+	}
+	return nil
+}
+
+// under returns the files of a folder, the ones in memory and the ones on disk when the
+// folder is under the root.
+func (s fileSet) under(folder protocol.DocumentURI) []*file {
+	if path, ok := s.onDisk(folder); ok {
+		filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				s.lookup(protocol.URIFromPath(p))
+			}
+			return nil
+		})
+	}
+	prefix := strings.TrimSuffix(string(folder.Canonical()), "/") + "/"
+	var children []*file
+	for key, f := range s.files {
+		if f != nil && strings.HasPrefix(string(key), prefix) {
+			children = append(children, f)
+		}
+	}
+	return children
+}
+
+// AssertFile checks a file has the text want.
+func (w *Workspace) AssertFile(t testing.TB, uri protocol.DocumentURI, want string) {
+	t.Helper()
+	got, ok := w.File(uri)
+	if !ok {
+		t.Errorf("%s: no such file, want:\n%s", uri, want)
+		return
+	}
+	if got != want {
+		t.Errorf("%s: %s\ngot:\n%s\nwant:\n%s", uri, firstDifference(got, want), got, want)
+	}
+}
+
+// AssertNoFile checks a file doesn't exist, e.g. once an edit deleted or renamed it.
+func (w *Workspace) AssertNoFile(t testing.TB, uri protocol.DocumentURI) {
+	t.Helper()
+	if _, ok := w.File(uri); ok {
+		t.Errorf("%s: file exists, want none", uri)
+	}
+}
+
+// AssertGolden checks the text of a file is the content of the golden file, a path relative
+// to the package of the test such as "testdata/rename.golden". Run the tests with
+// -lsptest.update to write the golden files from the files of the workspace.
+func (w *Workspace) AssertGolden(t testing.TB, uri protocol.DocumentURI, golden string) {
+	t.Helper()
+	got, ok := w.File(uri)
+	if !ok {
+		t.Errorf("%s: no such file, want the content of %s", uri, golden)
+		return
+	}
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(golden), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	data, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("%v (run with -lsptest.update to create it)", err)
+	}
+	if want := string(data); got != want {
+		t.Errorf("%s: %s, unlike %s\ngot:\n%s", uri, firstDifference(got, want), golden, got)
+	}
+}
+
+// firstDifference describes the first line where got and want differ.
+func firstDifference(got, want string) string {
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(want, "\n")
+	for i := 0; ; i++ {
+		switch {
+		case i >= len(gotLines):
+			return fmt.Sprintf("line %d: missing %q", i+1, wantLines[i])
+		case i >= len(wantLines):
+			return fmt.Sprintf("line %d: unexpected %q", i+1, gotLines[i])
+		case gotLines[i] != wantLines[i]:
+			return fmt.Sprintf("line %d: got %q, want %q", i+1, gotLines[i], wantLines[i])
+		}
+	}
+}
+
+// URI returns the URI of the file name of the workspace folder.
+func (s *Session) URI(name string) protocol.DocumentURI {
+	return protocol.URIFromPath(filepath.Join(s.Dir, name))
+}
+
+// ApplyEdit applies an edit the server returned, e.g. by textDocument/rename or a resolved
+// code action, to the workspace of the session, and sends the changes of its open documents
+// as an editor would. It fails the test when the edit doesn't apply.
+func (s *Session) ApplyEdit(t testing.TB, edit protocol.WorkspaceEdit) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	if err := s.applyEdit(ctx, edit); err != nil {
+		t.Fatalf("%s: %v", s.Preset.Name, err)
+	}
+}
+
+// applyEdit applies an edit to the workspace, then to the open documents of the client.
+func (s *Session) applyEdit(ctx context.Context, edit protocol.WorkspaceEdit) error {
+	if err := s.Workspace.Apply(edit); err != nil {
+		return err
+	}
+	syncDocument := func(uri protocol.DocumentURI, edits []protocol.TextEdit) error {
+		if _, _, open := s.Text(uri); !open {
+			return nil
+		}
+		return s.Edit(ctx, uri, edits...)
+	}
+	if len(edit.DocumentChanges) == 0 {
+		for uri, edits := range edit.Changes {
+			if err := syncDocument(uri, edits); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, change := range edit.DocumentChanges {
+		if change.TextDocumentEdit == nil {
+			continue
+		}
+		if err := syncDocument(change.URI(), change.TextDocumentEdit.Edits); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleApplyEdit answers the workspace/applyEdit requests of the server, applying their
+// edit with applyEdit. A refused edit is answered with applied false and the reason.
+func (s *Session) handleApplyEdit(ctx context.Context, raw json.RawMessage) (any, error) {
+	var params protocol.ApplyWorkspaceEditParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+	if err := s.applyEdit(ctx, params.Edit); err != nil {
+		return protocol.ApplyWorkspaceEditResponse{FailureReason: err.Error()}, nil
+	}
+	return protocol.ApplyWorkspaceEditResponse{Applied: true}, nil
+}
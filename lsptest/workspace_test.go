@@ -0,0 +1,77 @@
+package lsptest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// writeFiles writes the files of a folder, by name relative to it.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, text := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWorkspaceInMemory(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "on disk", "sub/b.txt": "on disk"})
+	uri := protocol.URIFromPath(filepath.Join(dir, "a.txt"))
+
+	w := NewWorkspace()
+	w.AssertNoFile(t, uri)
+	edit := protocol.WorkspaceEdit{Changes: map[protocol.DocumentURI][]protocol.TextEdit{
+		uri: {{NewText: "edited "}},
+	}}
+	if err := w.Apply(edit); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("edit of a file only on disk: got %v, want no such file", err)
+	}
+	del := protocol.WorkspaceEdit{DocumentChanges: []protocol.DocumentChange{
+		{DeleteFile: &protocol.DeleteFile{URI: protocol.URIFromPath(filepath.Join(dir, "sub"))}},
+	}}
+	if err := w.Apply(del); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("delete of a folder only on disk: got %v, want no such file", err)
+	}
+
+	w.SetFile(uri, "in memory")
+	if err := w.Apply(edit); err != nil {
+		t.Fatal(err)
+	}
+	w.AssertFile(t, uri, "edited in memory")
+}
+
+func TestWorkspaceRoot(t *testing.T) {
+	parent := t.TempDir()
+	root := filepath.Join(parent, "root")
+	writeFiles(t, parent, map[string]string{"root/a.txt": "on disk", "root/sub/b.txt": "b", "outside.txt": "outside"})
+
+	w := NewWorkspace()
+	w.Root = root
+	w.AssertFile(t, protocol.URIFromPath(filepath.Join(root, "a.txt")), "on disk")
+	w.AssertNoFile(t, protocol.URIFromPath(filepath.Join(parent, "outside.txt")))
+	w.AssertNoFile(t, protocol.URIFromPath(filepath.Join(root, "..", "outside.txt")))
+
+	del := protocol.WorkspaceEdit{DocumentChanges: []protocol.DocumentChange{
+		{DeleteFile: &protocol.DeleteFile{
+			URI:     protocol.URIFromPath(filepath.Join(root, "sub")),
+			Options: &protocol.DeleteFileOptions{Recursive: true},
+		}},
+	}}
+	if err := w.Apply(del); err != nil {
+		t.Fatal(err)
+	}
+	w.AssertNoFile(t, protocol.URIFromPath(filepath.Join(root, "sub", "b.txt")))
+	if _, err := os.Stat(filepath.Join(root, "sub", "b.txt")); err != nil {
+		t.Errorf("file on disk changed: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package protocol
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// ActionData is the data of a code action, sent back by the client in codeAction/resolve
+// (CodeAction.Data) or workspace/executeCommand (a command argument). Besides the payload of
+// the server, it records the document content the action was computed for: an action listed
+// before an edit must not apply its change to text which moved since.
+type ActionData[T any] struct {
+	URI     DocumentURI `json:"uri"`
+	Version int         `json:"version"`
+	// Hash is the ContentHash of the document text, it tells documents reopened or reverted
+	// to a known version apart.
+	Hash    string `json:"hash"`
+	Payload T      `json:"payload"`
+}
+
+// ContentHash returns the hash of a document text recorded by ActionData.
+func ContentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewActionData encodes payload with the state of doc, for CodeAction.Data or the arguments
+// of its command.
+func NewActionData[T any](doc TextDocumentItem, payload T) (json.RawMessage, error) {
+	data, err := json.Marshal(ActionData[T]{
+		URI:     doc.URI,
+		Version: doc.Version,
+		Hash:    ContentHash(doc.Text),
+		Payload: payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal code action data: %w", err)
+	}
+	return data, nil
+}
+
+// DecodeActionData decodes data encoded by NewActionData, the error is an InvalidParams
+// jsonrpc2 error to return as is from the handler.
+func DecodeActionData[T any](data json.RawMessage) (ActionData[T], error) {
+	var d ActionData[T]
+	if err := json.Unmarshal(data, &d); err != nil {
+		return d, jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf("invalid code action data: %v", err))
+	}
+	if d.URI == "" || d.Hash == "" {
+		return d, jsonrpc2.NewError(jsonrpc2.InvalidParams, "invalid code action data: missing document state")
+	}
+	return d, nil
+}
+
+// Verify checks doc, the current state of the document, is the one the action was computed
+// for. It returns a ContentModified jsonrpc2 error when the document changed since, clients
+// drop the action without showing an error.
+func (d ActionData[T]) Verify(doc TextDocumentItem) error {
+	if doc.URI != d.URI {
+		return jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf("code action data is for %s, not %s", d.URI, doc.URI))
+	}
+	if doc.Version != d.Version {
+		return jsonrpc2.NewError(jsonrpc2.ContentModified, fmt.Sprintf("%s changed since the action was offered (version %d, now %d)", d.URI, d.Version, doc.Version))
+	}
+	if ContentHash(doc.Text) != d.Hash {
+		return jsonrpc2.NewError(jsonrpc2.ContentModified, fmt.Sprintf("%s changed since the action was offered (same version %d, different content)", d.URI, d.Version))
+	}
+	return nil
+}
@@ -10,8 +10,8 @@ type CodeActionParams struct {
 	Range Range `json:"range"`
 	// Context carrying additional information.
 	Context CodeActionContext `json:"context"`
-	// WorkDoneProgressParams // Optional for progress reporting
-	// PartialResultParams // Optional for partial results
+	WorkDoneProgressParams
+	PartialResultParams
 }
 
 // CodeActionContext contains additional diagnostic information about the context in which
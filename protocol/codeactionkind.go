@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// IsKindOf reports whether k is base or one of its sub-kinds: "refactor.extract.function"
+// is a kind of "refactor.extract" and of "refactor", not of "ref". Every kind is a kind of Empty.
+func (k CodeActionKind) IsKindOf(base CodeActionKind) bool {
+	if base == Empty {
+		return true
+	}
+	return k == base || strings.HasPrefix(string(k), string(base)+".")
+}
+
+// MostSpecificCommonKind returns the most specific kind all kinds are a kind of, e.g.
+// "refactor" for "refactor.extract" and "refactor.inline". It returns Empty when the kinds
+// have no common base, or when no kinds are given.
+func MostSpecificCommonKind(kinds ...CodeActionKind) CodeActionKind {
+	if len(kinds) == 0 {
+		return Empty
+	}
+	common := strings.Split(string(kinds[0]), ".")
+	for _, kind := range kinds[1:] {
+		segments := strings.Split(string(kind), ".")
+		n := 0
+		for n < len(common) && n < len(segments) && common[n] == segments[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	return CodeActionKind(strings.Join(common, "."))
+}
+
+// Validate checks the dotted syntax of a kind: segments of letters, digits, '_' or '-',
+// separated by single dots, e.g. "quickfix.spelling" or "source.organizeImports".
+func (k CodeActionKind) Validate() error {
+	if k == Empty {
+		return fmt.Errorf("empty code action kind")
+	}
+	for i, segment := range strings.Split(string(k), ".") {
+		if segment == "" {
+			return fmt.Errorf("code action kind %q: empty segment %d", k, i)
+		}
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+				return fmt.Errorf("code action kind %q: invalid character %q in segment %q", k, r, segment)
+			}
+		}
+	}
+	return nil
+}
+
+// Accepts reports whether the Only filter of the request accepts actions of kind, so that
+// servers skip computing the others. An empty filter accepts all kinds.
+func (c CodeActionContext) Accepts(kind CodeActionKind) bool {
+	if len(c.Only) == 0 {
+		return true
+	}
+	for _, only := range c.Only {
+		if kind.IsKindOf(only) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterCodeActions returns the actions the Only filter of the request accepts, actions
+// without a kind are dropped by a non empty filter.
+func (c CodeActionContext) FilterCodeActions(actions []CodeAction) []CodeAction {
+	if len(c.Only) == 0 {
+		return actions
+	}
+	filtered := make([]CodeAction, 0, len(actions))
+	for _, action := range actions {
+		if action.Kind != Empty && c.Accepts(action.Kind) {
+			filtered = append(filtered, action)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,27 @@
+package protocol
+
+import (
+	"encoding/json"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// MethodCommandResult is the custom notification delivering the outcome of a command run in
+// the background: the workspace/executeCommand request was answered null as soon as the
+// command started. Clients which don't know it ignore it, the progress of the command and
+// the error messages are shown anyway.
+const MethodCommandResult = "$/lspgo/commandResult"
+
+// CommandResultParams are the params of MethodCommandResult.
+type CommandResultParams struct {
+	Command string `json:"command"`
+	// Token is the work done token the progress of the command was reported against, unset
+	// when the client can't display progress.
+	Token *ProgressToken `json:"token,omitempty"`
+	// Result is the result of the command, set when it succeeded.
+	Result json.RawMessage `json:"result,omitempty"`
+	// Error is set when the command failed.
+	Error *jsonrpc2.ErrorObject `json:"error,omitempty"`
+	// Cancelled is true when the user cancelled the command, or the server shut down.
+	Cancelled bool `json:"cancelled,omitempty"`
+}
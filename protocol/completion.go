@@ -6,8 +6,8 @@ import "encoding/json"
 type CompletionParams struct {
 	TextDocumentPositionParams
 	// Context CompletionContext `json:"context,omitempty"` // Add if needed for trigger kind etc.
-	// WorkDoneProgressParams
-	// PartialResultParams
+	WorkDoneProgressParams
+	PartialResultParams
 }
 
 // CompletionList represents a list of completion items.
@@ -32,7 +32,13 @@ type CompletionItem struct {
 	// about this item, like type or symbol information.
 	Detail string `json:"detail,omitempty"`
 	// A human-readable string that represents a doc-comment.
-	Documentation json.RawMessage `json:"documentation,omitempty"` // MarkupContent | string
+	Documentation *Documentation `json:"documentation,omitempty"` // MarkupContent | string
+	// A string that should be used when comparing this item
+	// with other items. When `falsy` the label is used.
+	SortText string `json:"sortText,omitempty"`
+	// A string that should be used when filtering a set of
+	// completion items. When `falsy` the label is used.
+	FilterText string `json:"filterText,omitempty"`
 	// A string that should be inserted into a document when selecting
 	// this completion. When `falsy` the label is used.
 	InsertText string `json:"insertText,omitempty"`
@@ -48,7 +54,11 @@ type CompletionItem struct {
 
 	// Additional text edits that are applied when selecting this completion.
 	// Edits must not overlap with the main edit nor with themselves.
-	// AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
+	AdditionalTextEdits []TextEdit `json:"additionalTextEdits,omitempty"`
+
+	// A data entry field that is preserved on a completion item between a
+	// completion and a completion resolve request.
+	Data json.RawMessage `json:"data,omitempty"`
 
 	// ... other fields like preselect, sortText, filterText, commitCharacters, command etc.
 }
@@ -0,0 +1,89 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ConfigurationParams parameters for the workspace/configuration request, sent by the
+// server to pull settings.
+type ConfigurationParams struct {
+	Items []ConfigurationItem `json:"items"`
+}
+
+// ConfigurationItem is a settings section to pull, the result has one value per item.
+type ConfigurationItem struct {
+	// The scope to get the configuration section for, e.g. a document or workspace folder.
+	ScopeURI *DocumentURI `json:"scopeUri,omitempty"`
+	// The configuration section asked for, dotted (e.g. "regexlint.rulesFile").
+	Section string `json:"section,omitempty"`
+}
+
+// Section decodes the settings section (dotted, e.g. "regexlint" or "regexlint.rulesFile")
+// of the pushed settings into v, see DecodeSettingsSection.
+func (p DidChangeConfigurationParams) Section(section string, v any) (bool, error) {
+	return DecodeSettingsSection(p.Settings, section, v)
+}
+
+// DecodeSettingsSection decodes the section of settings into v, returning false when it is
+// absent. section is a dotted path, each part being an object key: clients push the whole
+// settings, nested ({"regexlint": {"rulesFile": ...}}) or with dotted keys
+// ({"regexlint.rulesFile": ...}), both are found. An empty section decodes all the settings,
+// it is the shape of the values answered to workspace/configuration, which are the section
+// asked for.
+func DecodeSettingsSection(settings json.RawMessage, section string, v any) (bool, error) {
+	value, ok := lookupSection(settings, section)
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(value, v); err != nil {
+		return true, fmt.Errorf("invalid settings %q: %w", section, err)
+	}
+	return true, nil
+}
+
+// lookupSection returns the value at the dotted path in settings.
+func lookupSection(settings json.RawMessage, section string) (json.RawMessage, bool) {
+	settings = bytes.TrimSpace(settings)
+	if len(settings) == 0 || string(settings) == "null" {
+		return nil, false
+	}
+	if section == "" {
+		return settings, true
+	}
+	var object map[string]json.RawMessage
+	if json.Unmarshal(settings, &object) != nil {
+		return nil, false // Not an object, no section in there
+	}
+	// The longest dotted key matching the start of the path wins, e.g. "regexlint.rulesFile"
+	// before "regexlint" then "rulesFile"
+	parts := strings.Split(section, ".")
+	for i := len(parts); i > 0; i-- {
+		value, ok := object[strings.Join(parts[:i], ".")]
+		if !ok {
+			continue
+		}
+		if value, ok := lookupSection(value, strings.Join(parts[i:], ".")); ok {
+			return value, true
+		}
+	}
+	// The section may only exist as the prefix of dotted keys, e.g. "regexlint.rulesFile"
+	// for "regexlint": they are gathered in an object
+	prefix := section + "."
+	gathered := make(map[string]json.RawMessage)
+	for key, value := range object {
+		if rest, ok := strings.CutPrefix(key, prefix); ok && rest != "" {
+			gathered[rest] = value
+		}
+	}
+	if len(gathered) == 0 {
+		return nil, false
+	}
+	data, err := json.Marshal(gathered)
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,164 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// DefinitionParams parameters for textDocument/definition request.
+type DefinitionParams struct {
+	TextDocumentPositionParams
+	WorkDoneProgressParams
+	PartialResultParams
+}
+
+// ReferenceParams parameters for textDocument/references request.
+type ReferenceParams struct {
+	TextDocumentPositionParams
+	// Context carrying additional information.
+	Context ReferenceContext `json:"context"`
+	WorkDoneProgressParams
+	PartialResultParams
+}
+
+// ReferenceContext additional information for a references request.
+type ReferenceContext struct {
+	// Include the declaration of the current symbol.
+	IncludeDeclaration bool `json:"includeDeclaration"`
+}
+
+// ReferenceOptions server options for references requests.
+type ReferenceOptions struct {
+	WorkDoneProgressOptions
+}
+
+// DeclarationParams parameters for textDocument/declaration request.
+type DeclarationParams struct {
+	TextDocumentPositionParams
+	WorkDoneProgressParams
+	PartialResultParams
+}
+
+// TypeDefinitionParams parameters for textDocument/typeDefinition request.
+type TypeDefinitionParams struct {
+	TextDocumentPositionParams
+	WorkDoneProgressParams
+	PartialResultParams
+}
+
+// ImplementationParams parameters for textDocument/implementation request.
+type ImplementationParams struct {
+	TextDocumentPositionParams
+	WorkDoneProgressParams
+	PartialResultParams
+}
+
+// DeclarationOptions server options for declaration requests.
+type DeclarationOptions struct {
+	WorkDoneProgressOptions
+}
+
+// TypeDefinitionOptions server options for type definition requests.
+type TypeDefinitionOptions struct {
+	WorkDoneProgressOptions
+}
+
+// ImplementationOptions server options for implementation requests.
+type ImplementationOptions struct {
+	WorkDoneProgressOptions
+}
+
+// DefinitionClientCapabilities capabilities specific to the definition, declaration, type
+// definition and implementation requests.
+type DefinitionClientCapabilities struct {
+	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	// The client supports LocationLink results.
+	LinkSupport bool `json:"linkSupport,omitempty"`
+}
+
+// LocationLink is the target of a goto request along with the range it was requested from,
+// letting the client underline the origin and reveal the whole target.
+type LocationLink struct {
+	// The span of the origin of the link, e.g. the word under the cursor. Defaults to the
+	// word range at the position of the request.
+	OriginSelectionRange *Range `json:"originSelectionRange,omitempty"`
+	// The target document.
+	TargetURI DocumentURI `json:"targetUri"`
+	// The full range of the target, e.g. a function with its body and comments.
+	TargetRange Range `json:"targetRange"`
+	// The range to select and reveal, e.g. the name of the function. It must be contained
+	// in TargetRange.
+	TargetSelectionRange Range `json:"targetSelectionRange"`
+}
+
+// Location returns the location of the link for clients without link support, its
+// selection range.
+func (l LocationLink) Location() Location {
+	return Location{URI: l.TargetURI, Range: l.TargetSelectionRange}
+}
+
+// SupportsLocationLinks reports whether the client accepts LocationLink results for a goto
+// method: MethodTextDocumentDefinition, MethodTextDocumentDeclaration,
+// MethodTextDocumentTypeDefinition or MethodTextDocumentImplementation.
+func (c ClientCapabilities) SupportsLocationLinks(method string) bool {
+	if c.TextDocument == nil {
+		return false
+	}
+	var caps *DefinitionClientCapabilities
+	switch method {
+	case MethodTextDocumentDefinition:
+		caps = c.TextDocument.Definition
+	case MethodTextDocumentDeclaration:
+		caps = c.TextDocument.Declaration
+	case MethodTextDocumentTypeDefinition:
+		caps = c.TextDocument.TypeDefinition
+	case MethodTextDocumentImplementation:
+		caps = c.TextDocument.Implementation
+	}
+	return caps != nil && caps.LinkSupport
+}
+
+// Locations returns the result of a goto method in the shape the client supports: the
+// links as is, or converted to Location.
+func (c ClientCapabilities) Locations(method string, links []LocationLink) any {
+	if c.SupportsLocationLinks(method) {
+		if links == nil {
+			return []LocationLink{}
+		}
+		return links
+	}
+	locations := make([]Location, len(links))
+	for i, link := range links {
+		locations[i] = link.Location()
+	}
+	return locations
+}
+
+// DecodeLocations decodes the `Location | Location[] | LocationLink[] | null` result of the
+// goto methods. Locations are returned as links without origin, targeting their range.
+func DecodeLocations(raw json.RawMessage) ([]LocationLink, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	if raw[0] == '{' {
+		raw = append(append([]byte{'['}, raw...), ']') // A single Location
+	}
+	var items []struct {
+		Location
+		LocationLink
+	}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode locations: %w", err)
+	}
+	links := make([]LocationLink, len(items))
+	for i, item := range items {
+		if item.TargetURI == "" {
+			links[i] = LocationLink{TargetURI: item.URI, TargetRange: item.Range, TargetSelectionRange: item.Range}
+			continue
+		}
+		links[i] = item.LocationLink
+	}
+	return links, nil
+}
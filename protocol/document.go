@@ -28,7 +28,27 @@ type TextDocumentContentChangeEvent struct {
 // DidSaveTextDocumentParams parameters for textDocument/didSave notification.
 type DidSaveTextDocumentParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
-	Text         *string                `json:"text,omitempty"` // Optional text content if included by client capability
+	Text         *string                `json:"text,omitempty"` // Optional text content, sent when the server asked for it with SaveOptions.IncludeText
+}
+
+// TextDocumentSaveReason represents reasons why a text document is saved.
+type TextDocumentSaveReason int
+
+const (
+	// SaveReasonManual is a save triggered by the user, e.g. pressing save or starting debugging.
+	SaveReasonManual TextDocumentSaveReason = 1
+	// SaveReasonAfterDelay is an automatic save after a delay.
+	SaveReasonAfterDelay TextDocumentSaveReason = 2
+	// SaveReasonFocusOut is a save when the editor lost focus.
+	SaveReasonFocusOut TextDocumentSaveReason = 3
+)
+
+// WillSaveTextDocumentParams parameters for the textDocument/willSave notification and the
+// textDocument/willSaveWaitUntil request.
+type WillSaveTextDocumentParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	// The reason why the document is saved.
+	Reason TextDocumentSaveReason `json:"reason"`
 }
 
 // DidCloseTextDocumentParams parameters for textDocument/didClose notification.
@@ -50,9 +70,25 @@ type Diagnostic struct {
 	Code     json.RawMessage    `json:"code,omitempty"` // int | string
 	Source   string             `json:"source,omitempty"`
 	Message  string             `json:"message"`
-	// RelatedInformation, Tags etc.
+	// Data is preserved by the client and sent back in the code action context.
+	// Since LSP 3.16.0
+	Data json.RawMessage `json:"data,omitempty"`
+	// Additional metadata about the diagnostic, rendered by clients supporting them.
+	// Since LSP 3.15.0
+	Tags []DiagnosticTag `json:"tags,omitempty"`
+	// RelatedInformation etc.
 }
 
+// DiagnosticTag is additional metadata about a diagnostic.
+type DiagnosticTag int
+
+const (
+	// DiagnosticTagUnnecessary marks unused or unnecessary code, clients render it faded out.
+	DiagnosticTagUnnecessary DiagnosticTag = 1
+	// DiagnosticTagDeprecated marks deprecated or obsolete code, clients render it struck through.
+	DiagnosticTagDeprecated DiagnosticTag = 2
+)
+
 // DiagnosticSeverity severity level of a diagnostic.
 type DiagnosticSeverity int
 
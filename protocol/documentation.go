@@ -0,0 +1,64 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Documentation is the `string | MarkupContent` union of the documentation of completion
+// items. Its Kind is empty for a plain string.
+type Documentation struct {
+	Kind  MarkupKind
+	Value string
+}
+
+// StringDocumentation returns documentation sent as a plain string, which all clients support.
+func StringDocumentation(value string) *Documentation {
+	return &Documentation{Value: value}
+}
+
+// MarkupDocumentation returns documentation sent as MarkupContent of kind.
+func MarkupDocumentation(kind MarkupKind, value string) *Documentation {
+	return &Documentation{Kind: kind, Value: value}
+}
+
+// CompletionDocumentation renders documentation in the format the client prefers for
+// completion items: render is called with Markdown or PlainText.
+func (c ClientCapabilities) CompletionDocumentation(render func(kind MarkupKind) string) *Documentation {
+	kind := c.CompletionDocumentationFormat()
+	return MarkupDocumentation(kind, render(kind))
+}
+
+// MarkupContent returns the documentation as MarkupContent, a plain string being plain text.
+func (d Documentation) MarkupContent() MarkupContent {
+	if d.Kind == "" {
+		return MarkupContent{Kind: PlainText, Value: d.Value}
+	}
+	return MarkupContent{Kind: d.Kind, Value: d.Value}
+}
+
+// MarshalJSON encodes a string, or a MarkupContent when Kind is set.
+func (d Documentation) MarshalJSON() ([]byte, error) {
+	if d.Kind == "" {
+		return json.Marshal(d.Value)
+	}
+	return json.Marshal(MarkupContent{Kind: d.Kind, Value: d.Value})
+}
+
+// UnmarshalJSON decodes a string or a MarkupContent.
+func (d *Documentation) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err == nil {
+		*d = Documentation{Value: value}
+		return nil
+	}
+	var content MarkupContent
+	if err := json.Unmarshal(data, &content); err != nil {
+		return fmt.Errorf("documentation is neither a string nor MarkupContent: %w", err)
+	}
+	if content.Kind == "" {
+		return fmt.Errorf("documentation MarkupContent without kind")
+	}
+	*d = Documentation{Kind: content.Kind, Value: content.Value}
+	return nil
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import "slices"
+
+// PositionEncodingKind is how the characters of positions are counted, negotiated in
+// initialize. Since LSP 3.17.0
+type PositionEncodingKind string
+
+const (
+	// PositionEncodingUTF8 counts bytes.
+	PositionEncodingUTF8 PositionEncodingKind = "utf-8"
+	// PositionEncodingUTF16 counts UTF-16 code units, the default which clients must support.
+	PositionEncodingUTF16 PositionEncodingKind = "utf-16"
+	// PositionEncodingUTF32 counts Unicode code points.
+	PositionEncodingUTF32 PositionEncodingKind = "utf-32"
+)
+
+// GeneralClientCapabilities are the capabilities of the client not specific to a feature.
+type GeneralClientCapabilities struct {
+	// The position encodings supported by the client, in decreasing order of preference.
+	// UTF-16 is assumed when omitted.
+	PositionEncodings []PositionEncodingKind `json:"positionEncodings,omitempty"`
+}
+
+// PositionEncodings returns the position encodings offered by the client, by preference,
+// utf-16 when it sent none.
+func (c ClientCapabilities) PositionEncodings() []PositionEncodingKind {
+	if c.General == nil || len(c.General.PositionEncodings) == 0 {
+		return []PositionEncodingKind{PositionEncodingUTF16}
+	}
+	return c.General.PositionEncodings
+}
+
+// SupportsPositionEncoding reports whether the client offered the position encoding.
+func (c ClientCapabilities) SupportsPositionEncoding(encoding PositionEncodingKind) bool {
+	return slices.Contains(c.PositionEncodings(), encoding)
+}
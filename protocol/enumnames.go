@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// enumName returns the name of an enum value numbered from 1, as listed in names, or
+// "Type(value)" for the values the protocol doesn't define.
+func enumName(typ string, names []string, value int) string {
+	if value >= 1 && value <= len(names) {
+		return names[value-1]
+	}
+	return typ + "(" + strconv.Itoa(value) + ")"
+}
+
+// parseEnum returns the value of a name listed in names, compared case insensitively, or of
+// a defined value written as a number, e.g. in a trace.
+func parseEnum(typ string, names []string, s string) (int, error) {
+	s = strings.TrimSpace(s)
+	for i, name := range names {
+		if strings.EqualFold(s, name) {
+			return i + 1, nil
+		}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 1 && n <= len(names) {
+		return n, nil
+	}
+	return 0, fmt.Errorf("unknown %s %q", typ, s)
+}
+
+// completionItemKindNames are the names of the CompletionItemKind values, as in the
+// specification.
+var completionItemKindNames = []string{
+	"Text", "Method", "Function", "Constructor", "Field", "Variable", "Class", "Interface",
+	"Module", "Property", "Unit", "Value", "Enum", "Keyword", "Snippet", "Color", "File",
+	"Reference", "Folder", "EnumMember", "Constant", "Struct", "Event", "Operator",
+	"TypeParameter",
+}
+
+// String returns the name of the kind, e.g. "Function".
+func (k CompletionItemKind) String() string {
+	return enumName("CompletionItemKind", completionItemKindNames, int(k))
+}
+
+// ParseCompletionItemKind returns the kind named s ("function", "Function" or "3").
+func ParseCompletionItemKind(s string) (CompletionItemKind, error) {
+	v, err := parseEnum("completion item kind", completionItemKindNames, s)
+	return CompletionItemKind(v), err
+}
+
+// symbolKindNames are the names of the SymbolKind values, as in the specification.
+var symbolKindNames = []string{
+	"File", "Module", "Namespace", "Package", "Class", "Method", "Property", "Field",
+	"Constructor", "Enum", "Interface", "Function", "Variable", "Constant", "String",
+	"Number", "Boolean", "Array", "Object", "Key", "Null", "EnumMember", "Struct", "Event",
+	"Operator", "TypeParameter",
+}
+
+// String returns the name of the kind, e.g. "Struct".
+func (k SymbolKind) String() string {
+	return enumName("SymbolKind", symbolKindNames, int(k))
+}
+
+// ParseSymbolKind returns the kind named s ("struct", "Struct" or "23").
+func ParseSymbolKind(s string) (SymbolKind, error) {
+	v, err := parseEnum("symbol kind", symbolKindNames, s)
+	return SymbolKind(v), err
+}
+
+// diagnosticSeverityNames are the names of the DiagnosticSeverity values, as in the
+// specification.
+var diagnosticSeverityNames = []string{"Error", "Warning", "Information", "Hint"}
+
+// String returns the name of the severity, e.g. "Warning".
+func (s DiagnosticSeverity) String() string {
+	return enumName("DiagnosticSeverity", diagnosticSeverityNames, int(s))
+}
+
+// ParseDiagnosticSeverity returns the severity named s ("warning", "Warning" or "2"),
+// "info" being accepted for Information.
+func ParseDiagnosticSeverity(s string) (DiagnosticSeverity, error) {
+	if strings.EqualFold(strings.TrimSpace(s), "info") {
+		return SeverityInfo, nil
+	}
+	v, err := parseEnum("diagnostic severity", diagnosticSeverityNames, s)
+	return DiagnosticSeverity(v), err
+}
+
+// messageTypeNames are the names of the MessageType values, as in the specification.
+var messageTypeNames = []string{"Error", "Warning", "Info", "Log"}
+
+// String returns the name of the message type, e.g. "Info".
+func (t MessageType) String() string {
+	return enumName("MessageType", messageTypeNames, int(t))
+}
+
+// ParseMessageType returns the message type named s ("info", "Info" or "3").
+func ParseMessageType(s string) (MessageType, error) {
+	v, err := parseEnum("message type", messageTypeNames, s)
+	return MessageType(v), err
+}
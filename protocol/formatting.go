@@ -0,0 +1,52 @@
+package protocol
+
+// FormattingOptions value-object describing what options formatting should use.
+type FormattingOptions struct {
+	// Size of a tab in spaces.
+	TabSize uint `json:"tabSize"`
+	// Prefer spaces over tabs.
+	InsertSpaces bool `json:"insertSpaces"`
+	// Trim trailing whitespace on a line (LSP 3.15).
+	TrimTrailingWhitespace bool `json:"trimTrailingWhitespace,omitempty"`
+	// Insert a newline character at the end of the file if one does not exist (LSP 3.15).
+	InsertFinalNewline bool `json:"insertFinalNewline,omitempty"`
+	// Trim all newlines after the final newline at the end of the file (LSP 3.15).
+	TrimFinalNewlines bool `json:"trimFinalNewlines,omitempty"`
+	// The spec allows further properties of type boolean, integer or string, they are dropped.
+}
+
+// DocumentFormattingParams parameters for textDocument/formatting request.
+type DocumentFormattingParams struct {
+	// The document to format.
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	// The format options.
+	Options FormattingOptions `json:"options"`
+	WorkDoneProgressParams
+}
+
+// DocumentRangeFormattingParams parameters for textDocument/rangeFormatting request.
+type DocumentRangeFormattingParams struct {
+	// The document to format.
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	// The range to format.
+	Range Range `json:"range"`
+	// The format options.
+	Options FormattingOptions `json:"options"`
+	WorkDoneProgressParams
+}
+
+// DocumentFormattingOptions server options for formatting requests.
+type DocumentFormattingOptions struct {
+	WorkDoneProgressOptions
+}
+
+// DocumentFormattingRegistrationOptions options for dynamically registering formatting support.
+type DocumentFormattingRegistrationOptions struct {
+	TextDocumentRegistrationOptions
+	DocumentFormattingOptions
+}
+
+// DocumentRangeFormattingOptions server options for range formatting requests.
+type DocumentRangeFormattingOptions struct {
+	WorkDoneProgressOptions
+}
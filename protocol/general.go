@@ -1,6 +1,9 @@
 package protocol
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"slices"
+)
 
 // ClientInfo information about the client.
 type ClientInfo struct {
@@ -15,8 +18,9 @@ type InitializeParams struct {
 	RootURI               *DocumentURI       `json:"rootUri,omitempty"` // Can be null
 	InitializationOptions json.RawMessage    `json:"initializationOptions,omitempty"`
 	Capabilities          ClientCapabilities `json:"capabilities"`
-	Trace                 string             `json:"trace,omitempty"` // off, messages, verbose
+	Trace                 TraceValue         `json:"trace,omitempty"` // off, messages, verbose
 	WorkspaceFolders      []WorkspaceFolder  `json:"workspaceFolders,omitempty"`
+	WorkDoneProgressParams
 }
 
 // WorkspaceFolder information.
@@ -31,15 +35,133 @@ type WorkspaceFolder struct {
 type ClientCapabilities struct {
 	Workspace    *WorkspaceClientCapabilities    `json:"workspace,omitempty"`
 	TextDocument *TextDocumentClientCapabilities `json:"textDocument,omitempty"`
-	// Window       *WindowClientCapabilities       `json:"window,omitempty"` // Added window capabilities
+	Window       *WindowClientCapabilities       `json:"window,omitempty"`
+	General      *GeneralClientCapabilities      `json:"general,omitempty"`
 	// Experimental features can be added here using json.RawMessage or specific structs
 }
 
 // WorkspaceClientCapabilities workspace specific client capabilities.
 type WorkspaceClientCapabilities struct {
-	ApplyEdit bool `json:"applyEdit,omitempty"`
-	// WorkspaceEdit *WorkspaceEditClientCapabilities `json:"workspaceEdit,omitempty"` // Added workspace edit capabilities
-	// ... many more fields (didChangeConfiguration, workspaceFolders, etc.)
+	ApplyEdit     bool                             `json:"applyEdit,omitempty"`
+	WorkspaceEdit *WorkspaceEditClientCapabilities `json:"workspaceEdit,omitempty"`
+	// Capabilities specific to the `workspace/didChangeConfiguration` notification.
+	DidChangeConfiguration *DynamicRegistrationCapabilities `json:"didChangeConfiguration,omitempty"`
+	// Capabilities specific to the `workspace/didChangeWatchedFiles` notification.
+	DidChangeWatchedFiles *DynamicRegistrationCapabilities `json:"didChangeWatchedFiles,omitempty"`
+	// Capabilities specific to the `workspace/symbol` request.
+	Symbol *SymbolClientCapabilities `json:"symbol,omitempty"`
+	// Capabilities specific to the `workspace/executeCommand` request.
+	ExecuteCommand *DynamicRegistrationCapabilities `json:"executeCommand,omitempty"`
+	// The client supports the `workspace/configuration` request.
+	// Since LSP 3.6.0
+	Configuration bool `json:"configuration,omitempty"`
+	// The client supports workspace folders, and sends their changes when the server asks
+	// for them. Since LSP 3.6.0
+	WorkspaceFolders bool `json:"workspaceFolders,omitempty"`
+	// ... many more fields
+}
+
+// WorkspaceEditClientCapabilities capabilities of the client applying workspace edits.
+type WorkspaceEditClientCapabilities struct {
+	// The client supports versioned document changes in `WorkspaceEdit`s.
+	DocumentChanges bool `json:"documentChanges,omitempty"`
+	// The resource operations the client supports ("create", "rename", "delete").
+	ResourceOperations []string `json:"resourceOperations,omitempty"`
+	// The failure handling strategy of a client if applying the workspace edit fails.
+	FailureHandling string `json:"failureHandling,omitempty"`
+	// Whether the client supports change annotations in workspace edits.
+	// Since LSP 3.16.0
+	ChangeAnnotationSupport *ChangeAnnotationSupport `json:"changeAnnotationSupport,omitempty"`
+}
+
+// ChangeAnnotationSupport describes the support of change annotations in workspace edits.
+type ChangeAnnotationSupport struct {
+	// Whether the client groups edits with equal labels into tree nodes, e.g. in a refactoring preview.
+	GroupsOnLabel bool `json:"groupsOnLabel,omitempty"`
+}
+
+// DynamicRegistrationCapabilities is shared by the capabilities only telling whether
+// the client supports registering them dynamically with client/registerCapability.
+type DynamicRegistrationCapabilities struct {
+	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+}
+
+// SupportsDocumentChanges reports whether the client accepts `documentChanges` in workspace edits.
+func (c ClientCapabilities) SupportsDocumentChanges() bool {
+	return c.Workspace != nil && c.Workspace.WorkspaceEdit != nil && c.Workspace.WorkspaceEdit.DocumentChanges
+}
+
+// SupportsConfiguration reports whether the client answers workspace/configuration requests.
+func (c ClientCapabilities) SupportsConfiguration() bool {
+	return c.Workspace != nil && c.Workspace.Configuration
+}
+
+// SupportsChangeAnnotations reports whether the client accepts change annotations in the
+// workspace edits sent with workspace/applyEdit, e.g. to confirm them with the user.
+func (c ClientCapabilities) SupportsChangeAnnotations() bool {
+	return c.Workspace != nil && c.Workspace.WorkspaceEdit != nil && c.Workspace.WorkspaceEdit.ChangeAnnotationSupport != nil
+}
+
+// SupportsCodeActionLiterals reports whether the client accepts CodeAction objects, and not only
+// Commands, in the result of textDocument/codeAction.
+func (c ClientCapabilities) SupportsCodeActionLiterals() bool {
+	return c.TextDocument != nil && c.TextDocument.CodeAction != nil && c.TextDocument.CodeAction.CodeActionLiteralSupport != nil
+}
+
+// ResolvesCodeActionProperty reports whether the client can resolve the property (e.g. "edit")
+// of code actions lazily with codeAction/resolve.
+func (c ClientCapabilities) ResolvesCodeActionProperty(property string) bool {
+	if c.TextDocument == nil || c.TextDocument.CodeAction == nil || c.TextDocument.CodeAction.ResolveSupport == nil {
+		return false
+	}
+	for _, p := range c.TextDocument.CodeAction.ResolveSupport.Properties {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
+// WindowClientCapabilities window specific client capabilities.
+type WindowClientCapabilities struct {
+	// Whether the client supports server initiated progress using the
+	// `window/workDoneProgress/create` request.
+	// Since LSP 3.15.0
+	WorkDoneProgress bool `json:"workDoneProgress,omitempty"`
+	// Capabilities specific to the `window/showDocument` request.
+	// Since LSP 3.16.0
+	ShowDocument *ShowDocumentClientCapabilities `json:"showDocument,omitempty"`
+	// Capabilities specific to the `window/showMessageRequest` request.
+	// Since LSP 3.16.0
+	ShowMessage *ShowMessageRequestClientCapabilities `json:"showMessage,omitempty"`
+}
+
+// ShowMessageRequestClientCapabilities are the capabilities of the window/showMessageRequest
+// request.
+type ShowMessageRequestClientCapabilities struct {
+	// Capabilities specific to the `MessageActionItem` type.
+	MessageActionItem *struct {
+		// Whether the client supports additional attributes which are preserved and sent
+		// back to the server in the request's response.
+		AdditionalPropertiesSupport bool `json:"additionalPropertiesSupport,omitempty"`
+	} `json:"messageActionItem,omitempty"`
+}
+
+// SupportsMessageActionProperties reports whether the client sends back the Properties of the
+// MessageActionItem picked in window/showMessageRequest.
+func (c ClientCapabilities) SupportsMessageActionProperties() bool {
+	return c.Window != nil && c.Window.ShowMessage != nil && c.Window.ShowMessage.MessageActionItem != nil &&
+		c.Window.ShowMessage.MessageActionItem.AdditionalPropertiesSupport
+}
+
+// ShowDocumentClientCapabilities tells whether the client supports window/showDocument.
+type ShowDocumentClientCapabilities struct {
+	Support bool `json:"support"`
+}
+
+// SupportsShowDocument reports whether the client accepts window/showDocument requests.
+func (c ClientCapabilities) SupportsShowDocument() bool {
+	return c.Window != nil && c.Window.ShowDocument != nil && c.Window.ShowDocument.Support
 }
 
 // TextDocumentClientCapabilities text document specific client capabilities.
@@ -48,14 +170,33 @@ type TextDocumentClientCapabilities struct {
 	Synchronization *TextDocumentSyncClientCapabilities `json:"synchronization,omitempty"`
 	Completion      *CompletionClientCapabilities       `json:"completion,omitempty"`
 	Hover           *HoverClientCapabilities            `json:"hover,omitempty"`
-	// Definition      *DefinitionClientCapabilities     `json:"definition,omitempty"` // Added definition capabilities placeholder
+	// Capabilities specific to the goto requests, which may answer LocationLink results.
+	Definition     *DefinitionClientCapabilities `json:"definition,omitempty"`
+	Declaration    *DefinitionClientCapabilities `json:"declaration,omitempty"`
+	TypeDefinition *DefinitionClientCapabilities `json:"typeDefinition,omitempty"`
+	Implementation *DefinitionClientCapabilities `json:"implementation,omitempty"`
+	// Capabilities specific to the `textDocument/codeAction` request.
 	CodeAction *CodeActionClientCapabilities `json:"codeAction,omitempty"` // <<< ADDED
+	// Capabilities specific to the `textDocument/rename` and `textDocument/prepareRename` requests.
+	Rename *RenameClientCapabilities `json:"rename,omitempty"`
+	// Capabilities specific to the `textDocument/formatting` and `textDocument/rangeFormatting` requests.
+	Formatting      *DynamicRegistrationCapabilities `json:"formatting,omitempty"`
+	RangeFormatting *DynamicRegistrationCapabilities `json:"rangeFormatting,omitempty"`
+	// Capabilities specific to the `textDocument/publishDiagnostics` notification.
+	PublishDiagnostics *PublishDiagnosticsClientCapabilities `json:"publishDiagnostics,omitempty"`
+	// Capabilities specific to the `textDocument/documentSymbol` request.
+	DocumentSymbol *SymbolClientCapabilities `json:"documentSymbol,omitempty"`
 	// ... many more fields (references, formatting, etc.)
 }
 
 // TextDocumentSyncClientCapabilities capabilities for text document synchronization.
 type TextDocumentSyncClientCapabilities struct {
 	DidSave bool `json:"didSave,omitempty"` // Notify on save
+	// The client sends textDocument/willSave notifications.
+	WillSave bool `json:"willSave,omitempty"`
+	// The client sends textDocument/willSaveWaitUntil requests and waits for the
+	// edits before saving.
+	WillSaveWaitUntil bool `json:"willSaveWaitUntil,omitempty"`
 }
 
 // CompletionClientCapabilities capabilities specific to completion requests.
@@ -63,10 +204,57 @@ type CompletionClientCapabilities struct {
 	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
 	CompletionItem      *struct {
 		SnippetSupport bool `json:"snippetSupport,omitempty"`
+		// Client supports the following content formats for the documentation
+		// property. The order describes the preferred format of the client.
+		DocumentationFormat []MarkupKind `json:"documentationFormat,omitempty"`
 	} `json:"completionItem,omitempty"`
+	// The completion item kinds the client supports, see ClampCompletionItemKind.
+	CompletionItemKind *struct {
+		ValueSet []CompletionItemKind `json:"valueSet,omitempty"`
+	} `json:"completionItemKind,omitempty"`
 	// ... many more fields
 }
 
+// PublishDiagnosticsClientCapabilities capabilities specific to diagnostics.
+type PublishDiagnosticsClientCapabilities struct {
+	// Whether the client interprets the version property of published diagnostics.
+	VersionSupport bool `json:"versionSupport,omitempty"`
+	// The tags the client supports, clients without it don't support any.
+	// Since LSP 3.15.0
+	TagSupport *struct {
+		ValueSet []DiagnosticTag `json:"valueSet"`
+	} `json:"tagSupport,omitempty"`
+}
+
+// SupportsDiagnosticTag reports whether the client renders tag on diagnostics.
+func (c ClientCapabilities) SupportsDiagnosticTag(tag DiagnosticTag) bool {
+	if c.TextDocument == nil || c.TextDocument.PublishDiagnostics == nil || c.TextDocument.PublishDiagnostics.TagSupport == nil {
+		return false
+	}
+	return slices.Contains(c.TextDocument.PublishDiagnostics.TagSupport.ValueSet, tag)
+}
+
+// SymbolClientCapabilities capabilities specific to the workspace/symbol and
+// textDocument/documentSymbol requests.
+type SymbolClientCapabilities struct {
+	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	// The symbol kinds the client supports, see ClampDocumentSymbolKind.
+	SymbolKind *struct {
+		ValueSet []SymbolKind `json:"valueSet,omitempty"`
+	} `json:"symbolKind,omitempty"`
+	// The tags the client supports, workspace/symbol and documentSymbol.
+	// Since LSP 3.16.0
+	TagSupport *struct {
+		ValueSet []SymbolTag `json:"valueSet"`
+	} `json:"tagSupport,omitempty"`
+	// The properties the client can resolve lazily with workspaceSymbol/resolve,
+	// workspace/symbol only. See SupportsWorkspaceSymbols.
+	// Since LSP 3.17.0
+	ResolveSupport *struct {
+		Properties []string `json:"properties"`
+	} `json:"resolveSupport,omitempty"`
+}
+
 // HoverClientCapabilities capabilities specific to hover requests.
 type HoverClientCapabilities struct {
 	DynamicRegistration bool         `json:"dynamicRegistration,omitempty"`
@@ -105,7 +293,7 @@ type CodeActionClientCapabilities struct {
 	// Whether the client honors the change annotations in text edits and resource operations
 	// returned via the `CodeAction#edit` property by the server.
 	// Since LSP 3.16.0
-	// HonorsChangeAnnotations bool `json:"honorsChangeAnnotations,omitempty"` // Could add if needed
+	HonorsChangeAnnotations bool `json:"honorsChangeAnnotations,omitempty"`
 }
 
 // CodeActionLiteralSupport defines the code action kinds that the client supports for literals.
@@ -141,6 +329,41 @@ const (
 	Markdown  MarkupKind = "markdown"
 )
 
+// preferredMarkupKind returns the first format of the client preference list we know,
+// clients not telling only support plain text.
+func preferredMarkupKind(formats []MarkupKind) MarkupKind {
+	for _, kind := range formats {
+		if kind == Markdown || kind == PlainText {
+			return kind
+		}
+	}
+	return PlainText
+}
+
+// HoverContentFormat returns the format the client prefers for hover contents.
+func (c ClientCapabilities) HoverContentFormat() MarkupKind {
+	if c.TextDocument == nil || c.TextDocument.Hover == nil {
+		return PlainText
+	}
+	return preferredMarkupKind(c.TextDocument.Hover.ContentFormat)
+}
+
+// CompletionDocumentationFormat returns the format the client prefers for the
+// documentation of completion items.
+func (c ClientCapabilities) CompletionDocumentationFormat() MarkupKind {
+	if c.TextDocument == nil || c.TextDocument.Completion == nil || c.TextDocument.Completion.CompletionItem == nil {
+		return PlainText
+	}
+	return preferredMarkupKind(c.TextDocument.Completion.CompletionItem.DocumentationFormat)
+}
+
+// SupportsSnippets reports whether the client accepts completion items with snippet
+// insert text, otherwise InsertTextFormat must be PlainTextFormat.
+func (c ClientCapabilities) SupportsSnippets() bool {
+	return c.TextDocument != nil && c.TextDocument.Completion != nil &&
+		c.TextDocument.Completion.CompletionItem != nil && c.TextDocument.Completion.CompletionItem.SnippetSupport
+}
+
 // InitializeResult result of the initialize request.
 type InitializeResult struct {
 	Capabilities ServerCapabilities `json:"capabilities"`
@@ -159,9 +382,31 @@ type ServerCapabilities struct {
 	CompletionProvider     *CompletionOptions       `json:"completionProvider,omitempty"`
 	HoverProvider          *HoverOptions            `json:"hoverProvider,omitempty"`          // Can be bool or options
 	DefinitionProvider     *DefinitionOptions       `json:"definitionProvider,omitempty"`     // Can be bool or options
+	ReferencesProvider     *ReferenceOptions        `json:"referencesProvider,omitempty"`     // Can be bool or options
 	CodeActionProvider     *CodeActionOptions       `json:"codeActionProvider,omitempty"`     // Can be bool | CodeActionOptions
 	ExecuteCommandProvider *ExecuteCommandOptions   `json:"executeCommandProvider,omitempty"` // Added this field
+
+	DocumentFormattingProvider      *DocumentFormattingOptions      `json:"documentFormattingProvider,omitempty"`      // Can be bool or options
+	DocumentRangeFormattingProvider *DocumentRangeFormattingOptions `json:"documentRangeFormattingProvider,omitempty"` // Can be bool or options
+
+	WorkspaceSymbolProvider *WorkspaceSymbolOptions `json:"workspaceSymbolProvider,omitempty"` // Can be bool or options
+
+	DeclarationProvider    *DeclarationOptions    `json:"declarationProvider,omitempty"`    // Can be bool or options
+	TypeDefinitionProvider *TypeDefinitionOptions `json:"typeDefinitionProvider,omitempty"` // Can be bool or options
+	ImplementationProvider *ImplementationOptions `json:"implementationProvider,omitempty"` // Can be bool or options
+
+	RenameProvider *RenameOptions `json:"renameProvider,omitempty"` // Can be bool or options
+
+	// Workspace specific server capabilities.
+	Workspace *WorkspaceServerCapabilities `json:"workspace,omitempty"`
+
+	// The position encoding the server picked from the client positionEncodings, utf-16 when
+	// omitted. Since LSP 3.17.0
+	PositionEncoding PositionEncodingKind `json:"positionEncoding,omitempty"`
 	// ... many more capabilities (references, formatting, codeAction, etc.)
+
+	// Experimental server capabilities, keyed by feature name.
+	Experimental map[string]any `json:"experimental,omitempty"`
 }
 
 // TextDocumentSyncOptions defines how text documents are synced.
@@ -169,6 +414,10 @@ type TextDocumentSyncOptions struct {
 	OpenClose bool                 `json:"openClose,omitempty"` // DidOpen/DidClose notifications
 	Change    TextDocumentSyncKind `json:"change,omitempty"`    // Kind of change notifications
 	Save      *SaveOptions         `json:"save,omitempty"`      // Added this field
+	// WillSave notifications are sent to the server, textDocument/willSave.
+	WillSave bool `json:"willSave,omitempty"`
+	// WillSaveWaitUntil requests are sent to the server, textDocument/willSaveWaitUntil.
+	WillSaveWaitUntil bool `json:"willSaveWaitUntil,omitempty"`
 }
 
 // TextDocumentSyncKind defines the type of sync notifications.
@@ -199,6 +448,7 @@ type DefinitionOptions struct {
 	WorkDoneProgressOptions
 }
 
+// SaveOptions server options for textDocument/didSave notifications.
 type SaveOptions struct {
 	IncludeText bool `json:"includeText,omitempty"` // The client should include the document text in save notifications
 }
@@ -245,6 +495,46 @@ type ShowMessageRequestParams struct {
 // MessageActionItem used in ShowMessageRequestParams.
 type MessageActionItem struct {
 	Title string `json:"title"`
+	// Properties are the fields of the item other than its title, e.g. an identifier of the
+	// action. Clients with the additionalPropertiesSupport capability send them back in
+	// the response, see SupportsMessageActionProperties.
+	Properties map[string]json.RawMessage `json:"-"`
+}
+
+// MarshalJSON encodes the item with its Properties.
+func (a MessageActionItem) MarshalJSON() ([]byte, error) {
+	type plain MessageActionItem // Without the methods
+	return json.Marshal(Extensible[plain]{Value: plain(a), Unknown: a.Properties})
+}
+
+// UnmarshalJSON decodes the item, the fields other than title are kept in Properties.
+func (a *MessageActionItem) UnmarshalJSON(data []byte) error {
+	type plain MessageActionItem
+	var item Extensible[plain]
+	if err := json.Unmarshal(data, &item); err != nil {
+		return err
+	}
+	*a = MessageActionItem(item.Value)
+	a.Properties = item.Unknown
+	return nil
+}
+
+// ShowDocumentParams parameters for the window/showDocument request.
+type ShowDocumentParams struct {
+	// The uri to show, a document or an external resource (e.g. a web page).
+	URI DocumentURI `json:"uri"`
+	// Whether to show the resource in an external program, e.g. a browser.
+	External bool `json:"external,omitempty"`
+	// Whether the editor showing the document should take the focus.
+	TakeFocus bool `json:"takeFocus,omitempty"`
+	// Range to select in the document, when it is a text document.
+	Selection *Range `json:"selection,omitempty"`
+}
+
+// ShowDocumentResult the result of the window/showDocument request.
+type ShowDocumentResult struct {
+	// Whether the client showed the document.
+	Success bool `json:"success"`
 }
 
 // ShutdownParams parameters for the shutdown request. Empty struct.
@@ -259,7 +549,7 @@ type ExecuteCommandParams struct {
 	Command string `json:"command"`
 	// Arguments that the command handler should be invoked with.
 	Arguments []json.RawMessage `json:"arguments,omitempty"` // Use RawMessage for flexibility
-	// WorkDoneProgressParams // Optional for progress reporting
+	WorkDoneProgressParams
 }
 
 // --- ExecuteCommandOptions placeholder ---
@@ -283,9 +573,6 @@ type ProgressParams struct {
 	Value json.RawMessage `json:"value"` // Type depends on the progress reporting kind
 }
 
-// ProgressToken is either a string or int.
-type ProgressToken interface{} // Can use interface{} or define specific types if needed
-
 // WorkDoneProgressBegin defines the start of a work done progress.
 type WorkDoneProgressBegin struct {
 	Kind string `json:"kind"` // always 'begin'
@@ -4,7 +4,7 @@ package protocol
 // It embeds TextDocumentPositionParams for the standard text document and position fields.
 type HoverParams struct {
 	TextDocumentPositionParams
-	// WorkDoneProgressParams // Optional for progress reporting - can be added if needed
+	WorkDoneProgressParams
 }
 
 // TextDocumentPositionParams parameters for requests identifying a text document and position.
@@ -0,0 +1,44 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// InitializeErrorUnknownProtocolVersion is the error code of an initialize request whose
+// protocol version the server doesn't support. Deprecated by the spec, it is kept for
+// older clients.
+const InitializeErrorUnknownProtocolVersion = 1
+
+// InitializeError is the data of the error answering a failed initialize request.
+type InitializeError struct {
+	// Retry tells the client to show the error message to the user and let them retry the
+	// initialization, sending initialize again. Without it the client gives up on the server.
+	Retry bool `json:"retry"`
+}
+
+// NewInitializeError returns the error failing an initialize request, with the InitializeError
+// data telling the client whether to retry.
+func NewInitializeError(code int, message string, retry bool) *jsonrpc2.ErrorObject {
+	errObj := jsonrpc2.NewError(code, message)
+	errObj.Data, _ = json.Marshal(InitializeError{Retry: retry})
+	return errObj
+}
+
+// InitializeRetry reports whether err, as returned by an initialize request, lets the
+// client retry. ok is false when err carries no InitializeError data.
+func InitializeRetry(err error) (retry, ok bool) {
+	var errObj *jsonrpc2.ErrorObject
+	if !errors.As(err, &errObj) || len(errObj.Data) == 0 {
+		return false, false
+	}
+	var data struct {
+		Retry *bool `json:"retry"`
+	}
+	if json.Unmarshal(errObj.Data, &data) != nil || data.Retry == nil {
+		return false, false
+	}
+	return *data.Retry, true
+}
@@ -0,0 +1,104 @@
+package protocol
+
+import "slices"
+
+// Kinds added after LSP 3.0 are unknown to older clients, which reject or misrender them.
+// Clients tell the kinds they support with a valueSet, and support the initial kinds
+// (File to Array for symbols, Text to Reference for completion items) when they don't.
+
+// symbolKindFallbacks maps the symbol kinds added later to the closest earlier kind.
+var symbolKindFallbacks = map[SymbolKind]SymbolKind{
+	SymbolKindObject:        SymbolKindClass,
+	SymbolKindKey:           SymbolKindProperty,
+	SymbolKindNull:          SymbolKindVariable,
+	SymbolKindEnumMember:    SymbolKindConstant,
+	SymbolKindStruct:        SymbolKindClass,
+	SymbolKindEvent:         SymbolKindField,
+	SymbolKindOperator:      SymbolKindFunction,
+	SymbolKindTypeParameter: SymbolKindVariable,
+}
+
+// completionItemKindFallbacks maps the completion item kinds added later to the closest
+// earlier kind.
+var completionItemKindFallbacks = map[CompletionItemKind]CompletionItemKind{
+	Folder:        File,
+	EnumMember:    Value,
+	Constant:      Value,
+	Struct:        Class,
+	Event:         Field,
+	Operator:      Text,
+	TypeParameter: Variable,
+}
+
+// ClampSymbolKind returns kind if valueSet contains it, the closest supported kind otherwise,
+// Variable as a last resort. An empty valueSet stands for the initial kinds.
+func ClampSymbolKind(kind SymbolKind, valueSet []SymbolKind) SymbolKind {
+	supported := func(k SymbolKind) bool {
+		if len(valueSet) == 0 {
+			return k >= SymbolKindFile && k <= SymbolKindArray
+		}
+		return slices.Contains(valueSet, k)
+	}
+	for k, ok := kind, true; ok; k, ok = symbolKindFallbacks[k] {
+		if supported(k) {
+			return k
+		}
+	}
+	return SymbolKindVariable
+}
+
+// ClampCompletionItemKind returns kind if valueSet contains it, the closest supported kind
+// otherwise, Text as a last resort. An empty valueSet stands for the initial kinds.
+func ClampCompletionItemKind(kind CompletionItemKind, valueSet []CompletionItemKind) CompletionItemKind {
+	supported := func(k CompletionItemKind) bool {
+		if len(valueSet) == 0 {
+			return k >= Text && k <= Reference
+		}
+		return slices.Contains(valueSet, k)
+	}
+	for k, ok := kind, true; ok; k, ok = completionItemKindFallbacks[k] {
+		if supported(k) {
+			return k
+		}
+	}
+	return Text
+}
+
+// ClampDocumentSymbolKind clamps kind to the symbol kinds the client supports in
+// textDocument/documentSymbol results.
+func (c ClientCapabilities) ClampDocumentSymbolKind(kind SymbolKind) SymbolKind {
+	var valueSet []SymbolKind
+	if c.TextDocument != nil && c.TextDocument.DocumentSymbol != nil && c.TextDocument.DocumentSymbol.SymbolKind != nil {
+		valueSet = c.TextDocument.DocumentSymbol.SymbolKind.ValueSet
+	}
+	return ClampSymbolKind(kind, valueSet)
+}
+
+// ClampWorkspaceSymbolKind clamps kind to the symbol kinds the client supports in
+// workspace/symbol results.
+func (c ClientCapabilities) ClampWorkspaceSymbolKind(kind SymbolKind) SymbolKind {
+	var valueSet []SymbolKind
+	if c.Workspace != nil && c.Workspace.Symbol != nil && c.Workspace.Symbol.SymbolKind != nil {
+		valueSet = c.Workspace.Symbol.SymbolKind.ValueSet
+	}
+	return ClampSymbolKind(kind, valueSet)
+}
+
+// ClampCompletionItemKind clamps kind to the completion item kinds the client supports.
+func (c ClientCapabilities) ClampCompletionItemKind(kind CompletionItemKind) CompletionItemKind {
+	var valueSet []CompletionItemKind
+	if c.TextDocument != nil && c.TextDocument.Completion != nil && c.TextDocument.Completion.CompletionItemKind != nil {
+		valueSet = c.TextDocument.Completion.CompletionItemKind.ValueSet
+	}
+	return ClampCompletionItemKind(kind, valueSet)
+}
+
+// ClampCompletionItems clamps the kinds of items, in place, before they are sent.
+func (c ClientCapabilities) ClampCompletionItems(items []CompletionItem) {
+	for i := range items {
+		if items[i].Kind != nil {
+			kind := c.ClampCompletionItemKind(*items[i].Kind)
+			items[i].Kind = &kind
+		}
+	}
+}
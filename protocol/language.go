@@ -0,0 +1,205 @@
+package protocol
+
+import (
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// LanguageID identifies the language of a text document, as sent in TextDocumentItem.
+// Editors use the identifiers below for the common languages, the others are free form.
+type LanguageID string
+
+// Language identifiers of the spec.
+const (
+	LanguageBat             LanguageID = "bat"
+	LanguageBibTeX          LanguageID = "bibtex"
+	LanguageC               LanguageID = "c"
+	LanguageClojure         LanguageID = "clojure"
+	LanguageCoffeeScript    LanguageID = "coffeescript"
+	LanguageCPP             LanguageID = "cpp"
+	LanguageCSharp          LanguageID = "csharp"
+	LanguageCSS             LanguageID = "css"
+	LanguageDart            LanguageID = "dart"
+	LanguageDiff            LanguageID = "diff"
+	LanguageDockerfile      LanguageID = "dockerfile"
+	LanguageElixir          LanguageID = "elixir"
+	LanguageErlang          LanguageID = "erlang"
+	LanguageFSharp          LanguageID = "fsharp"
+	LanguageGitCommit       LanguageID = "git-commit"
+	LanguageGo              LanguageID = "go"
+	LanguageGroovy          LanguageID = "groovy"
+	LanguageHTML            LanguageID = "html"
+	LanguageIni             LanguageID = "ini"
+	LanguageJava            LanguageID = "java"
+	LanguageJavaScript      LanguageID = "javascript"
+	LanguageJavaScriptReact LanguageID = "javascriptreact"
+	LanguageJSON            LanguageID = "json"
+	LanguageLaTeX           LanguageID = "latex"
+	LanguageLess            LanguageID = "less"
+	LanguageLua             LanguageID = "lua"
+	LanguageMakefile        LanguageID = "makefile"
+	LanguageMarkdown        LanguageID = "markdown"
+	LanguageObjectiveC      LanguageID = "objective-c"
+	LanguagePerl            LanguageID = "perl"
+	LanguagePHP             LanguageID = "php"
+	LanguagePlainText       LanguageID = "plaintext"
+	LanguagePowerShell      LanguageID = "powershell"
+	LanguagePython          LanguageID = "python"
+	LanguageR               LanguageID = "r"
+	LanguageRuby            LanguageID = "ruby"
+	LanguageRust            LanguageID = "rust"
+	LanguageSCSS            LanguageID = "scss"
+	LanguageSass            LanguageID = "sass"
+	LanguageScala           LanguageID = "scala"
+	LanguageShellScript     LanguageID = "shellscript"
+	LanguageSQL             LanguageID = "sql"
+	LanguageSwift           LanguageID = "swift"
+	LanguageTeX             LanguageID = "tex"
+	LanguageTypeScript      LanguageID = "typescript"
+	LanguageTypeScriptReact LanguageID = "typescriptreact"
+	LanguageXML             LanguageID = "xml"
+	LanguageYAML            LanguageID = "yaml"
+)
+
+var (
+	languagesMu sync.RWMutex
+	// languageExtensions maps lower case file extensions to their language.
+	languageExtensions = map[string]LanguageID{
+		".bat":      LanguageBat,
+		".cmd":      LanguageBat,
+		".bib":      LanguageBibTeX,
+		".c":        LanguageC,
+		".h":        LanguageC,
+		".clj":      LanguageClojure,
+		".cljs":     LanguageClojure,
+		".edn":      LanguageClojure,
+		".coffee":   LanguageCoffeeScript,
+		".cpp":      LanguageCPP,
+		".cc":       LanguageCPP,
+		".cxx":      LanguageCPP,
+		".hpp":      LanguageCPP,
+		".hh":       LanguageCPP,
+		".cs":       LanguageCSharp,
+		".css":      LanguageCSS,
+		".dart":     LanguageDart,
+		".diff":     LanguageDiff,
+		".patch":    LanguageDiff,
+		".ex":       LanguageElixir,
+		".exs":      LanguageElixir,
+		".erl":      LanguageErlang,
+		".hrl":      LanguageErlang,
+		".fs":       LanguageFSharp,
+		".fsx":      LanguageFSharp,
+		".go":       LanguageGo,
+		".groovy":   LanguageGroovy,
+		".gradle":   LanguageGroovy,
+		".html":     LanguageHTML,
+		".htm":      LanguageHTML,
+		".ini":      LanguageIni,
+		".java":     LanguageJava,
+		".js":       LanguageJavaScript,
+		".mjs":      LanguageJavaScript,
+		".cjs":      LanguageJavaScript,
+		".jsx":      LanguageJavaScriptReact,
+		".json":     LanguageJSON,
+		".tex":      LanguageLaTeX,
+		".ltx":      LanguageLaTeX,
+		".sty":      LanguageLaTeX,
+		".cls":      LanguageLaTeX,
+		".less":     LanguageLess,
+		".lua":      LanguageLua,
+		".mk":       LanguageMakefile,
+		".md":       LanguageMarkdown,
+		".markdown": LanguageMarkdown,
+		".m":        LanguageObjectiveC,
+		".pl":       LanguagePerl,
+		".pm":       LanguagePerl,
+		".php":      LanguagePHP,
+		".txt":      LanguagePlainText,
+		".ps1":      LanguagePowerShell,
+		".psm1":     LanguagePowerShell,
+		".py":       LanguagePython,
+		".pyi":      LanguagePython,
+		".r":        LanguageR,
+		".rb":       LanguageRuby,
+		".rs":       LanguageRust,
+		".scss":     LanguageSCSS,
+		".sass":     LanguageSass,
+		".scala":    LanguageScala,
+		".sc":       LanguageScala,
+		".sh":       LanguageShellScript,
+		".bash":     LanguageShellScript,
+		".zsh":      LanguageShellScript,
+		".sql":      LanguageSQL,
+		".swift":    LanguageSwift,
+		".ts":       LanguageTypeScript,
+		".mts":      LanguageTypeScript,
+		".cts":      LanguageTypeScript,
+		".tsx":      LanguageTypeScriptReact,
+		".xml":      LanguageXML,
+		".xsd":      LanguageXML,
+		".svg":      LanguageXML,
+		".yaml":     LanguageYAML,
+		".yml":      LanguageYAML,
+	}
+	// languageFileNames maps the names of files without a telling extension to their language.
+	languageFileNames = map[string]LanguageID{
+		"Dockerfile":     LanguageDockerfile,
+		"Makefile":       LanguageMakefile,
+		"GNUmakefile":    LanguageMakefile,
+		"COMMIT_EDITMSG": LanguageGitCommit,
+	}
+)
+
+// RegisterLanguageExtension maps a file extension, e.g. ".tmpl", to a language for
+// LanguageIDForPath. It replaces the default mapping of the extension.
+func RegisterLanguageExtension(ext string, id LanguageID) {
+	languagesMu.Lock()
+	defer languagesMu.Unlock()
+	languageExtensions[strings.ToLower(ext)] = id
+}
+
+// LanguageIDForPath guesses the language of a file from its name, then its extension.
+// Unknown extensions are used as is ("file.foo" is "foo"), files without one are plain text.
+func LanguageIDForPath(p string) LanguageID {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	base := filepath.Base(p)
+	if id, ok := languageFileNames[base]; ok {
+		return id
+	}
+	ext := strings.ToLower(filepath.Ext(base))
+	if id, ok := languageExtensions[ext]; ok {
+		return id
+	}
+	if ext == "" || ext == base {
+		return LanguagePlainText // No extension, or a dot file like .bashrc
+	}
+	return LanguageID(ext[1:])
+}
+
+// LanguageIDForURI is LanguageIDForPath for the path of a URI, of any scheme, e.g.
+// "untitled:Untitled-1" is plain text.
+func LanguageIDForURI(uri DocumentURI) LanguageID {
+	if _, err := url.Parse(string(uri)); err != nil {
+		return LanguagePlainText
+	}
+	return LanguageIDForPath(uri.Name())
+}
+
+// LanguageExtensions returns the extensions mapped to a language, sorted.
+func LanguageExtensions(id LanguageID) []string {
+	languagesMu.RLock()
+	defer languagesMu.RUnlock()
+	var exts []string
+	for ext, lang := range languageExtensions {
+		if lang == id {
+			exts = append(exts, ext)
+		}
+	}
+	slices.Sort(exts)
+	return exts
+}
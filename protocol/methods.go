@@ -9,25 +9,62 @@ const (
 	MethodTextDocumentDidSave   = "textDocument/didSave"
 	MethodTextDocumentDidClose  = "textDocument/didClose"
 
+	MethodTextDocumentWillSave          = "textDocument/willSave"
+	MethodTextDocumentWillSaveWaitUntil = "textDocument/willSaveWaitUntil" // Edits applied before saving
+
 	// Language Features
 	MethodTextDocumentHover      = "textDocument/hover"
 	MethodTextDocumentCompletion = "textDocument/completion"
 	MethodCompletionItemResolve  = "completionItem/resolve"
 	MethodTextDocumentDefinition = "textDocument/definition"
+	MethodTextDocumentReferences = "textDocument/references"
 	MethodTextDocumentCodeAction = "textDocument/codeAction"
 	MethodCodeActionResolve      = "codeAction/resolve"
-	// Add other language features as needed... (e.g., references, rename, formatting)
+
+	MethodTextDocumentDocumentHighlight = "textDocument/documentHighlight"
+
+	// Goto requests besides definition, answering Location | Location[] | LocationLink[]
+	MethodTextDocumentDeclaration    = "textDocument/declaration"
+	MethodTextDocumentTypeDefinition = "textDocument/typeDefinition"
+	MethodTextDocumentImplementation = "textDocument/implementation"
+
+	MethodTextDocumentFormatting      = "textDocument/formatting"
+	MethodTextDocumentRangeFormatting = "textDocument/rangeFormatting"
+
+	MethodTextDocumentRename        = "textDocument/rename"
+	MethodTextDocumentPrepareRename = "textDocument/prepareRename"
+	// Add other language features as needed... (e.g., references, formatting)
 
 	// Workspace Features
 	MethodWorkspaceExecuteCommand = "workspace/executeCommand"
 	MethodWorkspaceApplyEdit      = "workspace/applyEdit"
+	MethodWorkspaceSymbol         = "workspace/symbol"
+	MethodWorkspaceSymbolResolve  = "workspaceSymbol/resolve"
+
+	MethodWorkspaceDidChangeConfiguration = "workspace/didChangeConfiguration"
+	MethodWorkspaceDidChangeWatchedFiles  = "workspace/didChangeWatchedFiles"
+	MethodWorkspaceConfiguration          = "workspace/configuration" // Sent by the server to pull settings
+
+	MethodWorkspaceDidChangeWorkspaceFolders = "workspace/didChangeWorkspaceFolders"
+
+	// File operations requested before the client applies them, answering WorkspaceEdit | null
+	MethodWorkspaceWillCreateFiles = "workspace/willCreateFiles"
+	MethodWorkspaceWillRenameFiles = "workspace/willRenameFiles"
+	MethodWorkspaceWillDeleteFiles = "workspace/willDeleteFiles"
+
+	// Add other workspace features as needed...
 
-	// Add other workspace features as needed... (e.g., didChangeConfiguration, workspaceFolders)
+	// Client Capabilities registration
+	MethodClientRegisterCapability   = "client/registerCapability"
+	MethodClientUnregisterCapability = "client/unregisterCapability"
 
 	// Window Features
 	MethodWindowShowMessage        = "window/showMessage"
 	MethodWindowShowMessageRequest = "window/showMessageRequest"
 	MethodWindowLogMessage         = "window/logMessage"
+	MethodWindowShowDocument       = "window/showDocument"
+	MethodWorkDoneProgressCreate   = "window/workDoneProgress/create"
+	MethodWorkDoneProgressCancel   = "window/workDoneProgress/cancel"
 
 	// Diagnostics
 	MethodTextDocumentPublishDiagnostics = "textDocument/publishDiagnostics"
@@ -39,4 +76,6 @@ const (
 	MethodExit          = "exit"
 	MethodCancelRequest = "$/cancelRequest" // Notification to cancel a request
 	MethodProgress      = "$/progress"      // Notification for progress updates
+	MethodSetTrace      = "$/setTrace"      // Notification changing the trace level
+	MethodLogTrace      = "$/logTrace"      // Notification logging the server execution, per the trace level
 )
@@ -0,0 +1,13 @@
+package protocol
+
+// ExperimentalNamespaces is the experimental server capability key under which the custom
+// method namespaces of a server are advertised, keyed by prefix (e.g. "ollama/").
+const ExperimentalNamespaces = "namespaces"
+
+// NamespaceInfo describes a namespace of custom methods. It is advertised in the experimental
+// capabilities, and sent as the data of MethodNotFound errors for unknown methods of the namespace.
+type NamespaceInfo struct {
+	Version string `json:"version"`
+	// Methods are the full method names, sorted.
+	Methods []string `json:"methods"`
+}
@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// MaxUInteger is the largest uinteger of the protocol, line and character numbers above it
+// are invalid.
+const MaxUInteger = 1<<31 - 1
+
+// UnmarshalJSON decodes a position, rejecting the line and character numbers which are
+// negative, fractional, beyond MaxUInteger or not numbers at all, as sent by buggy or
+// hostile clients. The error reaches the client as InvalidParams, rather than a position
+// wrapped around to a huge line a handler would loop or allocate for.
+func (p *Position) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Line      json.RawMessage `json:"line"`
+		Character json.RawMessage `json:"character"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("invalid position: %w", err)
+	}
+	line, err := decodeUInteger("line", raw.Line)
+	if err != nil {
+		return err
+	}
+	character, err := decodeUInteger("character", raw.Character)
+	if err != nil {
+		return err
+	}
+	*p = Position{Line: line, Character: character}
+	return nil
+}
+
+// decodeUInteger decodes the uinteger field name of a position, missing or null is 0.
+func decodeUInteger(name string, raw json.RawMessage) (uint, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, nil
+	}
+	if c := raw[0]; c != '-' && (c < '0' || c > '9') {
+		return 0, fmt.Errorf("invalid position: %s %s is not a number", name, raw)
+	}
+	n, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		// Integral values may be written as 1e3 or 2.0, anything else is rejected
+		f, ferr := strconv.ParseFloat(string(raw), 64)
+		if (ferr != nil && !errors.Is(ferr, strconv.ErrRange)) || f != math.Trunc(f) {
+			return 0, fmt.Errorf("invalid position: %s %s is not an integer", name, raw)
+		}
+		if f < 0 {
+			return 0, fmt.Errorf("invalid position: %s %s is negative", name, raw)
+		}
+		if f > MaxUInteger {
+			return 0, fmt.Errorf("invalid position: %s %s is out of range", name, raw)
+		}
+		n = int64(f)
+	}
+	switch {
+	case n < 0:
+		return 0, fmt.Errorf("invalid position: %s %s is negative", name, raw)
+	case n > MaxUInteger:
+		return 0, fmt.Errorf("invalid position: %s %s is out of range", name, raw)
+	}
+	return uint(n), nil
+}
@@ -0,0 +1,121 @@
+package protocol_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/client"
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/server"
+)
+
+func TestPositionUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    protocol.Position
+		wantErr string // Substring of the error, empty when valid
+	}{
+		{name: "valid", in: `{"line":3,"character":7}`, want: protocol.Position{Line: 3, Character: 7}},
+		{name: "zero", in: `{"line":0,"character":0}`},
+		{name: "max", in: `{"line":2147483647,"character":0}`, want: protocol.Position{Line: protocol.MaxUInteger}},
+		{name: "exponent", in: `{"line":1e3,"character":0}`, want: protocol.Position{Line: 1000}},
+		{name: "integral float", in: `{"line":2.0,"character":1}`, want: protocol.Position{Line: 2, Character: 1}},
+		{name: "missing", in: `{}`},
+		{name: "null fields", in: `{"line":null,"character":null}`},
+		{name: "whitespace", in: `{"line": 4 ,"character": 5 }`, want: protocol.Position{Line: 4, Character: 5}},
+
+		{name: "negative", in: `{"line":-1,"character":0}`, wantErr: "line -1 is negative"},
+		{name: "negative character", in: `{"line":0,"character":-1}`, wantErr: "character -1 is negative"},
+		{name: "negative float", in: `{"line":-1e3,"character":0}`, wantErr: "is negative"},
+		{name: "fractional", in: `{"line":1.5,"character":0}`, wantErr: "line 1.5 is not an integer"},
+		{name: "huge float", in: `{"line":1e999,"character":0}`, wantErr: "line 1e999 is out of range"},
+		{name: "2^64", in: `{"line":18446744073709551616,"character":0}`, wantErr: "is out of range"},
+		{name: "above max", in: `{"line":2147483648,"character":0}`, wantErr: "line 2147483648 is out of range"},
+		{name: "string", in: `{"line":"3","character":0}`, wantErr: `line "3" is not a number`},
+		{name: "bool", in: `{"line":0,"character":true}`, wantErr: "character true is not a number"},
+		{name: "object", in: `{"line":{},"character":0}`, wantErr: "is not a number"},
+		{name: "null position", in: `null`},
+		{name: "array", in: `[1,2]`, wantErr: "invalid position"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got protocol.Position
+			err := json.Unmarshal([]byte(tt.in), &got)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Fatalf("got %+v, want an error containing %q", got, tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Fatalf("got error %q, want it to contain %q", err, tt.wantErr)
+			case tt.wantErr == "" && got != tt.want:
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRangeRejectsInvalidPositions(t *testing.T) {
+	var r protocol.Range
+	err := json.Unmarshal([]byte(`{"start":{"line":0,"character":0},"end":{"line":-1,"character":0}}`), &r)
+	if err == nil || !strings.Contains(err.Error(), "negative") {
+		t.Fatalf("got %v, want a negative line error", err)
+	}
+}
+
+// TestInvalidPositionIsInvalidParams checks the dispatcher answers a request with an
+// invalid position with InvalidParams, without calling the handler.
+func TestInvalidPositionIsInvalidParams(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	s := server.NewServer(
+		server.WithStream(server.ReadWriter{Reader: serverR, Writer: serverW}),
+		server.WithLogger(log.New(io.Discard, "", 0)),
+	)
+	called := make(chan struct{}, 1)
+	s.Register(protocol.MethodTextDocumentHover, func(ctx context.Context, p *protocol.HoverParams) (*protocol.Hover, error) {
+		called <- struct{}{}
+		return nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	c := client.New(client.Stdio{Reader: clientR, Writer: clientW}, client.WithCapabilityGuard(client.GuardOff))
+	t.Cleanup(func() {
+		c.Close()
+		cancel()
+		serverR.Close()
+		serverW.Close()
+		<-done
+	})
+
+	callCtx, cancelCall := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelCall()
+	if _, err := c.Initialize(callCtx, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, position := range []string{`{"line":-1,"character":0}`, `{"line":1.5,"character":0}`, `{"line":1e999,"character":0}`, `{"line":"3","character":0}`} {
+		params := json.RawMessage(`{"textDocument":{"uri":"file:///a.txt"},"position":` + position + `}`)
+		err := c.Call(callCtx, protocol.MethodTextDocumentHover, params, nil)
+		var rpcErr *jsonrpc2.ErrorObject
+		if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.InvalidParams {
+			t.Errorf("position %s: got %v, want an InvalidParams error", position, err)
+		}
+	}
+	select {
+	case <-called:
+		t.Error("handler called with an invalid position")
+	default:
+	}
+}
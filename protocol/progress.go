@@ -0,0 +1,120 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// ProgressToken is either a string or an integer, as chosen by the side creating it.
+// The zero value is the integer token 0. ProgressToken is comparable and can be used as a map key.
+type ProgressToken struct {
+	name     string
+	number   int32
+	isString bool
+}
+
+// NewStringProgressToken returns a string progress token.
+func NewStringProgressToken(name string) ProgressToken {
+	return ProgressToken{name: name, isString: true}
+}
+
+// NewNumberProgressToken returns an integer progress token.
+func NewNumberProgressToken(number int32) ProgressToken {
+	return ProgressToken{number: number}
+}
+
+// IsString reports whether the token is a string token.
+func (t ProgressToken) IsString() bool {
+	return t.isString
+}
+
+// String returns the token value as text, for logging or display.
+func (t ProgressToken) String() string {
+	if t.isString {
+		return t.name
+	}
+	return strconv.FormatInt(int64(t.number), 10)
+}
+
+// MarshalJSON encodes the token as a JSON string or number.
+func (t ProgressToken) MarshalJSON() ([]byte, error) {
+	if t.isString {
+		return json.Marshal(t.name)
+	}
+	return json.Marshal(t.number)
+}
+
+// UnmarshalJSON decodes a JSON string or number token. null leaves the token unchanged, as
+// encoding/json does for other types: it is not the string token "".
+func (t *ProgressToken) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = NewStringProgressToken(name)
+		return nil
+	}
+	var number int32
+	if err := json.Unmarshal(data, &number); err != nil {
+		return fmt.Errorf("progress token must be a string or an integer: %s", string(data))
+	}
+	*t = NewNumberProgressToken(number)
+	return nil
+}
+
+// ProgressTokenGenerator creates string tokens unique to the process.
+// Tokens carry a random component so they can't collide with tokens created by
+// the client or by another generator, even across server restarts.
+type ProgressTokenGenerator struct {
+	prefix string
+	next   atomic.Uint64
+}
+
+// NewProgressTokenGenerator returns a generator producing tokens like "<prefix>-<random>-<n>".
+func NewProgressTokenGenerator(prefix string) *ProgressTokenGenerator {
+	random := make([]byte, 6)
+	if _, err := rand.Read(random); err != nil {
+		// crypto/rand never fails on supported platforms, keep going with the prefix only
+		return &ProgressTokenGenerator{prefix: prefix}
+	}
+	return &ProgressTokenGenerator{prefix: prefix + "-" + hex.EncodeToString(random)}
+}
+
+// Next returns a new token.
+func (g *ProgressTokenGenerator) Next() ProgressToken {
+	return NewStringProgressToken(g.prefix + "-" + strconv.FormatUint(g.next.Add(1), 10))
+}
+
+// WorkDoneProgressParams is embedded in the params of requests supporting
+// client initiated progress reporting.
+type WorkDoneProgressParams struct {
+	// An optional token that a server can use to report work done progress.
+	WorkDoneToken *ProgressToken `json:"workDoneToken,omitempty"`
+}
+
+// PartialResultParams is embedded in the params of requests supporting partial results:
+// the server may stream the result in `$/progress` notifications with the token, then
+// answers an empty result.
+type PartialResultParams struct {
+	// An optional token that a server can use to report partial results.
+	PartialResultToken *ProgressToken `json:"partialResultToken,omitempty"`
+}
+
+// WorkDoneProgressCreateParams parameters for the window/workDoneProgress/create request.
+type WorkDoneProgressCreateParams struct {
+	// The token to be used to report progress.
+	Token ProgressToken `json:"token"`
+}
+
+// WorkDoneProgressCancelParams parameters for the window/workDoneProgress/cancel notification,
+// sent when the user cancels a cancellable progress.
+type WorkDoneProgressCancelParams struct {
+	// The token of the progress to cancel.
+	Token ProgressToken `json:"token"`
+}
@@ -0,0 +1,55 @@
+package protocol_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+func TestProgressTokenUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    protocol.ProgressToken
+		wantErr bool
+	}{
+		{in: `"abc"`, want: protocol.NewStringProgressToken("abc")},
+		{in: `""`, want: protocol.NewStringProgressToken("")},
+		{in: `42`, want: protocol.NewNumberProgressToken(42)},
+		{in: `-1`, want: protocol.NewNumberProgressToken(-1)},
+		{in: `null`, want: protocol.NewNumberProgressToken(7)}, // Left unchanged
+		{in: `1.5`, wantErr: true},
+		{in: `true`, wantErr: true},
+		{in: `{}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		token := protocol.NewNumberProgressToken(7)
+		err := json.Unmarshal([]byte(tt.in), &token)
+		switch {
+		case tt.wantErr && err == nil:
+			t.Errorf("%s: got %v, want an error", tt.in, token)
+		case !tt.wantErr && err != nil:
+			t.Errorf("%s: %v", tt.in, err)
+		case !tt.wantErr && token != tt.want:
+			t.Errorf("%s: got %#v, want %#v", tt.in, token, tt.want)
+		}
+	}
+}
+
+func TestNullProgressTokens(t *testing.T) {
+	var params protocol.ProgressParams
+	if err := json.Unmarshal([]byte(`{"token":null,"value":{}}`), &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Token.IsString() {
+		t.Errorf("null token decoded as the string token %q", params.Token)
+	}
+
+	var hover protocol.HoverParams
+	if err := json.Unmarshal([]byte(`{"textDocument":{"uri":"file:///a"},"position":{"line":0,"character":0},"workDoneToken":null}`), &hover); err != nil {
+		t.Fatal(err)
+	}
+	if hover.WorkDoneToken != nil {
+		t.Errorf("null workDoneToken decoded as %v", *hover.WorkDoneToken)
+	}
+}
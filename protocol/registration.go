@@ -0,0 +1,141 @@
+package protocol
+
+import "encoding/json"
+
+// Registration general parameters to register for a capability.
+type Registration struct {
+	// The id used to register the request. The id can be used to deregister
+	// the request again.
+	ID string `json:"id"`
+	// The method / capability to register for.
+	Method string `json:"method"`
+	// Options necessary for the registration.
+	RegisterOptions any `json:"registerOptions,omitempty"`
+}
+
+// RegistrationParams parameters for the client/registerCapability request.
+type RegistrationParams struct {
+	Registrations []Registration `json:"registrations"`
+}
+
+// Unregistration general parameters to unregister a capability.
+type Unregistration struct {
+	// The id used to unregister the request or notification. Usually an id
+	// provided during the register request.
+	ID string `json:"id"`
+	// The method / capability to unregister for.
+	Method string `json:"method"`
+}
+
+// UnregistrationParams parameters for the client/unregisterCapability request.
+type UnregistrationParams struct {
+	// This should correctly be named `unregistrations`. However changing this
+	// is a breaking change and needs to wait until we deliver a 4.x version
+	// of the specification.
+	Unregisterations []Unregistration `json:"unregisterations"`
+}
+
+// DidChangeConfigurationParams parameters for workspace/didChangeConfiguration notification.
+type DidChangeConfigurationParams struct {
+	// The actual changed settings, their shape depends on the client.
+	Settings json.RawMessage `json:"settings"`
+}
+
+// DidChangeWatchedFilesParams parameters for workspace/didChangeWatchedFiles notification.
+type DidChangeWatchedFilesParams struct {
+	// The actual file events.
+	Changes []FileEvent `json:"changes"`
+}
+
+// FileEvent an event describing a file change.
+type FileEvent struct {
+	// The file's URI.
+	URI DocumentURI `json:"uri"`
+	// The change type.
+	Type FileChangeType `json:"type"`
+}
+
+// FileChangeType the file event type.
+type FileChangeType int
+
+const (
+	// The file got created.
+	FileChangeTypeCreated FileChangeType = 1
+	// The file got changed.
+	FileChangeTypeChanged FileChangeType = 2
+	// The file got deleted.
+	FileChangeTypeDeleted FileChangeType = 3
+)
+
+// DidChangeWatchedFilesRegistrationOptions describe options to be used when
+// registering for file system change events.
+type DidChangeWatchedFilesRegistrationOptions struct {
+	// The watchers to register.
+	Watchers []FileSystemWatcher `json:"watchers"`
+}
+
+// FileSystemWatcher watches files matching a glob pattern.
+type FileSystemWatcher struct {
+	// The glob pattern to watch, e.g. "**/*.json".
+	// Relative patterns (LSP 3.17) are not supported.
+	GlobPattern string `json:"globPattern"`
+	// The kind of events of interest. If omitted it defaults
+	// to WatchKind.Create | WatchKind.Change | WatchKind.Delete.
+	Kind *WatchKind `json:"kind,omitempty"`
+}
+
+// WatchKind is a bit set of the file events of interest.
+type WatchKind uint
+
+const (
+	// Interested in create events.
+	WatchKindCreate WatchKind = 1
+	// Interested in change events.
+	WatchKindChange WatchKind = 2
+	// Interested in delete events.
+	WatchKindDelete WatchKind = 4
+)
+
+// SupportsDynamicRegistration reports whether the client accepts registrations of method
+// with client/registerCapability. Methods registered together share the capability of
+// their feature, e.g. textDocument/prepareRename the one of textDocument/rename.
+func (c ClientCapabilities) SupportsDynamicRegistration(method string) bool {
+	var dynamic bool
+	if w := c.Workspace; w != nil {
+		switch {
+		case method == MethodWorkspaceDidChangeConfiguration && w.DidChangeConfiguration != nil:
+			dynamic = w.DidChangeConfiguration.DynamicRegistration
+		case method == MethodWorkspaceDidChangeWatchedFiles && w.DidChangeWatchedFiles != nil:
+			dynamic = w.DidChangeWatchedFiles.DynamicRegistration
+		case (method == MethodWorkspaceSymbol || method == MethodWorkspaceSymbolResolve) && w.Symbol != nil:
+			dynamic = w.Symbol.DynamicRegistration
+		case method == MethodWorkspaceExecuteCommand && w.ExecuteCommand != nil:
+			dynamic = w.ExecuteCommand.DynamicRegistration
+		}
+	}
+	if td := c.TextDocument; td != nil {
+		switch {
+		case method == MethodTextDocumentHover && td.Hover != nil:
+			dynamic = td.Hover.DynamicRegistration
+		case (method == MethodTextDocumentCompletion || method == MethodCompletionItemResolve) && td.Completion != nil:
+			dynamic = td.Completion.DynamicRegistration
+		case method == MethodTextDocumentDefinition && td.Definition != nil:
+			dynamic = td.Definition.DynamicRegistration
+		case method == MethodTextDocumentDeclaration && td.Declaration != nil:
+			dynamic = td.Declaration.DynamicRegistration
+		case method == MethodTextDocumentTypeDefinition && td.TypeDefinition != nil:
+			dynamic = td.TypeDefinition.DynamicRegistration
+		case method == MethodTextDocumentImplementation && td.Implementation != nil:
+			dynamic = td.Implementation.DynamicRegistration
+		case (method == MethodTextDocumentCodeAction || method == MethodCodeActionResolve) && td.CodeAction != nil:
+			dynamic = td.CodeAction.DynamicRegistration
+		case (method == MethodTextDocumentRename || method == MethodTextDocumentPrepareRename) && td.Rename != nil:
+			dynamic = td.Rename.DynamicRegistration
+		case method == MethodTextDocumentFormatting && td.Formatting != nil:
+			dynamic = td.Formatting.DynamicRegistration
+		case method == MethodTextDocumentRangeFormatting && td.RangeFormatting != nil:
+			dynamic = td.RangeFormatting.DynamicRegistration
+		}
+	}
+	return dynamic
+}
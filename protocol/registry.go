@@ -0,0 +1,187 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// ErrUnknownMethod is returned when decoding a message for a method without registered types.
+var ErrUnknownMethod = errors.New("unknown method")
+
+// MethodType describes the Go types of the messages of a method.
+type MethodType struct {
+	Method       string
+	Notification bool
+	// Params is the type of the params, nil when the method has none.
+	Params reflect.Type
+	// Result is the type of the result of a request, nil for notifications and requests
+	// answering null. Results the spec defines as unions (e.g. `Location | Location[]`)
+	// are json.RawMessage.
+	Result reflect.Type
+}
+
+// NewParams returns a pointer to a new zero value of the params type, nil when the method has no params.
+func (t MethodType) NewParams() any {
+	if t.Params == nil {
+		return nil
+	}
+	return reflect.New(t.Params).Interface()
+}
+
+// NewResult returns a pointer to a new zero value of the result type, nil when the method has no result.
+func (t MethodType) NewResult() any {
+	if t.Result == nil {
+		return nil
+	}
+	return reflect.New(t.Result).Interface()
+}
+
+var (
+	methodTypesMu sync.RWMutex
+	methodTypes   = make(map[string]MethodType)
+)
+
+// none marks a method without params or result.
+type none struct{}
+
+// typeOf returns the type of T, nil for none.
+func typeOf[T any]() reflect.Type {
+	t := reflect.TypeFor[T]()
+	if t == reflect.TypeFor[none]() {
+		return nil
+	}
+	return t
+}
+
+// RegisterRequest registers the params and result types of a request, replacing any previous
+// registration. Use it for custom methods so tooling based on TypeFor decodes them too.
+func RegisterRequest[P, R any](method string) {
+	methodTypesMu.Lock()
+	defer methodTypesMu.Unlock()
+	methodTypes[method] = MethodType{Method: method, Params: typeOf[P](), Result: typeOf[R]()}
+}
+
+// RegisterNotification registers the params type of a notification, replacing any previous registration.
+func RegisterNotification[P any](method string) {
+	methodTypesMu.Lock()
+	defer methodTypesMu.Unlock()
+	methodTypes[method] = MethodType{Method: method, Notification: true, Params: typeOf[P]()}
+}
+
+// TypeFor returns the types of the messages of a method.
+func TypeFor(method string) (MethodType, bool) {
+	methodTypesMu.RLock()
+	defer methodTypesMu.RUnlock()
+	t, ok := methodTypes[method]
+	return t, ok
+}
+
+// Methods returns the sorted names of the methods with registered types.
+func Methods() []string {
+	methodTypesMu.RLock()
+	methods := make([]string, 0, len(methodTypes))
+	for method := range methodTypes {
+		methods = append(methods, method)
+	}
+	methodTypesMu.RUnlock()
+	sort.Strings(methods)
+	return methods
+}
+
+// DecodeParams decodes the params of a message into a pointer to the registered params type.
+// It returns nil for methods without params, and an error wrapping ErrUnknownMethod for
+// methods without registered types.
+func DecodeParams(method string, raw json.RawMessage) (any, error) {
+	t, ok := TypeFor(method)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+	return decodeInto(t.NewParams(), method, "params", raw)
+}
+
+// DecodeResult decodes the result of a response to a request into a pointer to the registered
+// result type. It returns nil for requests without result, and an error wrapping ErrUnknownMethod
+// for methods without registered types.
+func DecodeResult(method string, raw json.RawMessage) (any, error) {
+	t, ok := TypeFor(method)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownMethod, method)
+	}
+	return decodeInto(t.NewResult(), method, "result", raw)
+}
+
+func decodeInto(v any, method, what string, raw json.RawMessage) (any, error) {
+	if v == nil || len(raw) == 0 || string(raw) == "null" {
+		return v, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return nil, fmt.Errorf("failed to decode %s of %s: %w", what, method, err)
+	}
+	return v, nil
+}
+
+func init() {
+	// General Lifecycle
+	RegisterRequest[InitializeParams, InitializeResult](MethodInitialize)
+	RegisterNotification[InitializedParams](MethodInitialized)
+	RegisterRequest[none, none](MethodShutdown)
+	RegisterNotification[none](MethodExit)
+	RegisterNotification[CancelParams](MethodCancelRequest)
+	RegisterNotification[ProgressParams](MethodProgress)
+	RegisterNotification[SetTraceParams](MethodSetTrace)
+	RegisterNotification[LogTraceParams](MethodLogTrace)
+
+	// Text Document Synchronization
+	RegisterNotification[DidOpenTextDocumentParams](MethodTextDocumentDidOpen)
+	RegisterNotification[DidChangeTextDocumentParams](MethodTextDocumentDidChange)
+	RegisterNotification[DidSaveTextDocumentParams](MethodTextDocumentDidSave)
+	RegisterNotification[DidCloseTextDocumentParams](MethodTextDocumentDidClose)
+	RegisterNotification[WillSaveTextDocumentParams](MethodTextDocumentWillSave)
+	RegisterRequest[WillSaveTextDocumentParams, []TextEdit](MethodTextDocumentWillSaveWaitUntil)
+
+	// Language Features
+	RegisterRequest[HoverParams, Hover](MethodTextDocumentHover)
+	RegisterRequest[CompletionParams, json.RawMessage](MethodTextDocumentCompletion) // CompletionItem[] | CompletionList
+	RegisterRequest[CompletionItem, CompletionItem](MethodCompletionItemResolve)
+	RegisterRequest[DefinitionParams, json.RawMessage](MethodTextDocumentDefinition) // Location | Location[] | LocationLink[]
+	RegisterRequest[DeclarationParams, json.RawMessage](MethodTextDocumentDeclaration)
+	RegisterRequest[TypeDefinitionParams, json.RawMessage](MethodTextDocumentTypeDefinition)
+	RegisterRequest[ImplementationParams, json.RawMessage](MethodTextDocumentImplementation)
+	RegisterRequest[ReferenceParams, []Location](MethodTextDocumentReferences)
+	RegisterRequest[CodeActionParams, json.RawMessage](MethodTextDocumentCodeAction) // (Command | CodeAction)[]
+	RegisterRequest[CodeAction, CodeAction](MethodCodeActionResolve)
+	RegisterRequest[DocumentFormattingParams, []TextEdit](MethodTextDocumentFormatting)
+	RegisterRequest[DocumentRangeFormattingParams, []TextEdit](MethodTextDocumentRangeFormatting)
+	RegisterRequest[RenameParams, *WorkspaceEdit](MethodTextDocumentRename)
+	RegisterRequest[PrepareRenameParams, *PrepareRenameResult](MethodTextDocumentPrepareRename) // Range | {range, placeholder} | {defaultBehavior} | null
+
+	// Workspace Features
+	RegisterRequest[ExecuteCommandParams, json.RawMessage](MethodWorkspaceExecuteCommand) // Any value
+	RegisterRequest[ApplyWorkspaceEditParams, ApplyWorkspaceEditResponse](MethodWorkspaceApplyEdit)
+	RegisterRequest[WorkspaceSymbolParams, json.RawMessage](MethodWorkspaceSymbol) // SymbolInformation[] | WorkspaceSymbol[]
+	RegisterRequest[WorkspaceSymbol, WorkspaceSymbol](MethodWorkspaceSymbolResolve)
+	RegisterNotification[DidChangeConfigurationParams](MethodWorkspaceDidChangeConfiguration)
+	RegisterRequest[ConfigurationParams, []json.RawMessage](MethodWorkspaceConfiguration) // One value per item
+	RegisterNotification[DidChangeWatchedFilesParams](MethodWorkspaceDidChangeWatchedFiles)
+	RegisterNotification[DidChangeWorkspaceFoldersParams](MethodWorkspaceDidChangeWorkspaceFolders)
+	RegisterRequest[RegistrationParams, none](MethodClientRegisterCapability)
+	RegisterRequest[UnregistrationParams, none](MethodClientUnregisterCapability)
+
+	// Window Features
+	RegisterNotification[ShowMessageParams](MethodWindowShowMessage)
+	RegisterRequest[ShowMessageRequestParams, MessageActionItem](MethodWindowShowMessageRequest)
+	RegisterNotification[LogMessageParams](MethodWindowLogMessage)
+	RegisterRequest[ShowDocumentParams, ShowDocumentResult](MethodWindowShowDocument)
+	RegisterRequest[WorkDoneProgressCreateParams, none](MethodWorkDoneProgressCreate)
+	RegisterNotification[WorkDoneProgressCancelParams](MethodWorkDoneProgressCancel)
+
+	// Diagnostics
+	RegisterNotification[PublishDiagnosticsParams](MethodTextDocumentPublishDiagnostics)
+
+	// lspgo extensions
+	RegisterRequest[ResyncDocumentsParams, none](MethodResyncDocuments)
+}
@@ -0,0 +1,136 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// RenameParams parameters for textDocument/rename request.
+type RenameParams struct {
+	TextDocumentPositionParams
+	// The new name of the symbol. If the given name is not valid the request must return
+	// an error with an appropriate message.
+	NewName string `json:"newName"`
+	WorkDoneProgressParams
+}
+
+// PrepareRenameParams parameters for textDocument/prepareRename request, asking whether a
+// rename is valid at a position before the user types the new name.
+type PrepareRenameParams struct {
+	TextDocumentPositionParams
+	WorkDoneProgressParams
+}
+
+// RenameOptions server options for rename requests.
+type RenameOptions struct {
+	// Renames should be checked and tested before being executed, with
+	// textDocument/prepareRename.
+	PrepareProvider bool `json:"prepareProvider,omitempty"`
+	WorkDoneProgressOptions
+}
+
+// PrepareSupportDefaultBehavior is the default behavior of prepareRename the client
+// implements, see PrepareRenameDefault.
+type PrepareSupportDefaultBehavior int
+
+const (
+	// PrepareSupportIdentifier selects the identifier at the position, according to the
+	// syntax rules of the language.
+	PrepareSupportIdentifier PrepareSupportDefaultBehavior = 1
+)
+
+// RenameClientCapabilities capabilities specific to rename requests.
+type RenameClientCapabilities struct {
+	DynamicRegistration bool `json:"dynamicRegistration,omitempty"`
+	// The client supports testing the validity of renames with textDocument/prepareRename.
+	PrepareSupport bool `json:"prepareSupport,omitempty"`
+	// The client computes the range to rename itself when the server answers
+	// {defaultBehavior: true}. Since LSP 3.16.0
+	PrepareSupportDefaultBehavior *PrepareSupportDefaultBehavior `json:"prepareSupportDefaultBehavior,omitempty"`
+	// The client honors the change annotations of the edits of a rename, e.g. asking the
+	// user to confirm them. Since LSP 3.16.0
+	HonorsChangeAnnotations bool `json:"honorsChangeAnnotations,omitempty"`
+}
+
+// SupportsPrepareRename reports whether the client sends textDocument/prepareRename
+// requests before renaming.
+func (c ClientCapabilities) SupportsPrepareRename() bool {
+	return c.TextDocument != nil && c.TextDocument.Rename != nil && c.TextDocument.Rename.PrepareSupport
+}
+
+// SupportsPrepareRenameDefaultBehavior reports whether the client accepts the
+// {defaultBehavior: true} result of textDocument/prepareRename.
+func (c ClientCapabilities) SupportsPrepareRenameDefaultBehavior() bool {
+	return c.SupportsPrepareRename() && c.TextDocument.Rename.PrepareSupportDefaultBehavior != nil
+}
+
+// PrepareRenameResult is the result of textDocument/prepareRename, one of
+// `Range | {range, placeholder} | {defaultBehavior: true}`. A nil result (null) tells a
+// rename is not valid at the position. Create it with PrepareRenameRange,
+// PrepareRenamePlaceholder or PrepareRenameDefault.
+type PrepareRenameResult struct {
+	// The range of the symbol to rename.
+	Range Range
+	// The text the new name input is filled with, the text of Range when empty.
+	Placeholder string
+	// The client renames the identifier at the position, computing its range itself. Only
+	// valid when SupportsPrepareRenameDefaultBehavior.
+	DefaultBehavior bool
+}
+
+// PrepareRenameRange returns a result renaming the text of rng.
+func PrepareRenameRange(rng Range) *PrepareRenameResult {
+	return &PrepareRenameResult{Range: rng}
+}
+
+// PrepareRenamePlaceholder returns a result renaming rng, with the input prefilled with
+// placeholder, e.g. a name without its prefix.
+func PrepareRenamePlaceholder(rng Range, placeholder string) *PrepareRenameResult {
+	return &PrepareRenameResult{Range: rng, Placeholder: placeholder}
+}
+
+// PrepareRenameDefault returns a result leaving the range to the client.
+func PrepareRenameDefault() *PrepareRenameResult {
+	return &PrepareRenameResult{DefaultBehavior: true}
+}
+
+// MarshalJSON encodes the result in the shape of its variant.
+func (r PrepareRenameResult) MarshalJSON() ([]byte, error) {
+	switch {
+	case r.DefaultBehavior:
+		return []byte(`{"defaultBehavior":true}`), nil
+	case r.Placeholder != "":
+		return json.Marshal(struct {
+			Range       Range  `json:"range"`
+			Placeholder string `json:"placeholder"`
+		}{r.Range, r.Placeholder})
+	default:
+		return json.Marshal(r.Range)
+	}
+}
+
+// UnmarshalJSON decodes any variant of the result.
+func (r *PrepareRenameResult) UnmarshalJSON(data []byte) error {
+	var v struct {
+		Range           *Range   `json:"range"`
+		Placeholder     string   `json:"placeholder"`
+		DefaultBehavior bool     `json:"defaultBehavior"`
+		Start           Position `json:"start"`
+		End             Position `json:"end"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid prepareRename result: %w", err)
+	}
+	switch {
+	case v.DefaultBehavior:
+		*r = PrepareRenameResult{DefaultBehavior: true}
+	case v.Range != nil:
+		*r = PrepareRenameResult{Range: *v.Range, Placeholder: v.Placeholder}
+	case bytes.Contains(data, []byte(`"start"`)):
+		*r = PrepareRenameResult{Range: Range{Start: v.Start, End: v.End}}
+	default:
+		return fmt.Errorf("invalid prepareRename result: %s", data)
+	}
+	return nil
+}
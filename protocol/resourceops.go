@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Kinds of the resource operations of a workspace edit, as listed by the client in
+// `workspace.workspaceEdit.resourceOperations`.
+const (
+	ResourceOperationCreate = "create"
+	ResourceOperationRename = "rename"
+	ResourceOperationDelete = "delete"
+)
+
+// CreateFile is a resource operation creating a file.
+type CreateFile struct {
+	// The resource to create.
+	URI DocumentURI `json:"uri"`
+	// Additional options.
+	Options *CreateFileOptions `json:"options,omitempty"`
+	// An optional annotation identifier describing the operation.
+	AnnotationID ChangeAnnotationIdentifier `json:"annotationId,omitempty"`
+}
+
+// CreateFileOptions options to create a file.
+type CreateFileOptions struct {
+	// Overwrite existing file. Overwrite wins over `ignoreIfExists`.
+	Overwrite bool `json:"overwrite,omitempty"`
+	// Ignore if exists.
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+// RenameFile is a resource operation renaming a file.
+type RenameFile struct {
+	// The old (existing) location.
+	OldURI DocumentURI `json:"oldUri"`
+	// The new location.
+	NewURI DocumentURI `json:"newUri"`
+	// Rename options.
+	Options *RenameFileOptions `json:"options,omitempty"`
+	// An optional annotation identifier describing the operation.
+	AnnotationID ChangeAnnotationIdentifier `json:"annotationId,omitempty"`
+}
+
+// RenameFileOptions options to rename a file.
+type RenameFileOptions struct {
+	// Overwrite target if existing. Overwrite wins over `ignoreIfExists`.
+	Overwrite bool `json:"overwrite,omitempty"`
+	// Ignores if target exists.
+	IgnoreIfExists bool `json:"ignoreIfExists,omitempty"`
+}
+
+// DeleteFile is a resource operation deleting a file or folder.
+type DeleteFile struct {
+	// The file to delete.
+	URI DocumentURI `json:"uri"`
+	// Delete options.
+	Options *DeleteFileOptions `json:"options,omitempty"`
+	// An optional annotation identifier describing the operation.
+	AnnotationID ChangeAnnotationIdentifier `json:"annotationId,omitempty"`
+}
+
+// DeleteFileOptions options to delete a file.
+type DeleteFileOptions struct {
+	// Delete the content recursively if a folder is denoted.
+	Recursive bool `json:"recursive,omitempty"`
+	// Ignore the operation if the file doesn't exist.
+	IgnoreIfNotExists bool `json:"ignoreIfNotExists,omitempty"`
+}
+
+// DocumentChange is an entry of WorkspaceEdit.DocumentChanges, exactly one of its fields is
+// set: the edits of a text document, or a resource operation.
+type DocumentChange struct {
+	TextDocumentEdit *TextDocumentEdit
+	CreateFile       *CreateFile
+	RenameFile       *RenameFile
+	DeleteFile       *DeleteFile
+}
+
+// URI returns the document the change applies to, the new location of a rename.
+func (c DocumentChange) URI() DocumentURI {
+	switch {
+	case c.TextDocumentEdit != nil:
+		return c.TextDocumentEdit.TextDocument.URI
+	case c.CreateFile != nil:
+		return c.CreateFile.URI
+	case c.RenameFile != nil:
+		return c.RenameFile.NewURI
+	case c.DeleteFile != nil:
+		return c.DeleteFile.URI
+	}
+	return ""
+}
+
+// MarshalJSON encodes the change set, resource operations with their `kind`.
+func (c DocumentChange) MarshalJSON() ([]byte, error) {
+	switch {
+	case c.TextDocumentEdit != nil:
+		return json.Marshal(c.TextDocumentEdit)
+	case c.CreateFile != nil:
+		return json.Marshal(struct {
+			Kind string `json:"kind"`
+			*CreateFile
+		}{ResourceOperationCreate, c.CreateFile})
+	case c.RenameFile != nil:
+		return json.Marshal(struct {
+			Kind string `json:"kind"`
+			*RenameFile
+		}{ResourceOperationRename, c.RenameFile})
+	case c.DeleteFile != nil:
+		return json.Marshal(struct {
+			Kind string `json:"kind"`
+			*DeleteFile
+		}{ResourceOperationDelete, c.DeleteFile})
+	}
+	return nil, fmt.Errorf("empty document change")
+}
+
+// UnmarshalJSON decodes a text document edit, or a resource operation by its `kind`.
+func (c *DocumentChange) UnmarshalJSON(data []byte) error {
+	var head struct {
+		Kind string `json:"kind"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return fmt.Errorf("invalid document change: %w", err)
+	}
+	*c = DocumentChange{}
+	var v any
+	switch head.Kind {
+	case "":
+		c.TextDocumentEdit = &TextDocumentEdit{}
+		v = c.TextDocumentEdit
+	case ResourceOperationCreate:
+		c.CreateFile = &CreateFile{}
+		v = c.CreateFile
+	case ResourceOperationRename:
+		c.RenameFile = &RenameFile{}
+		v = c.RenameFile
+	case ResourceOperationDelete:
+		c.DeleteFile = &DeleteFile{}
+		v = c.DeleteFile
+	default:
+		return fmt.Errorf("invalid document change: unknown kind %q", head.Kind)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SupportsResourceOperation reports whether the client applies the resource operations of
+// kind (ResourceOperationCreate, ...) in the documentChanges of workspace edits.
+func (c ClientCapabilities) SupportsResourceOperation(kind string) bool {
+	return c.SupportsDocumentChanges() && slices.Contains(c.Workspace.WorkspaceEdit.ResourceOperations, kind)
+}
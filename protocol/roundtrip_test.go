@@ -0,0 +1,113 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The testdata/initialize-*.json files are initialize requests as VS Code, Neovim and Helix
+// send them, abridged. They carry fields the protocol package does not model, at the top
+// level (locale, rootPath) and in the capabilities.
+
+func TestInitializeRoundTrip(t *testing.T) {
+	files, err := filepath.Glob("testdata/initialize-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no initialize payloads in testdata")
+	}
+	for _, file := range files {
+		t.Run(strings.TrimSuffix(filepath.Base(file), ".json"), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var msg struct {
+				Params json.RawMessage `json:"params"`
+			}
+			mustDecode(t, data, &msg)
+			var want bytes.Buffer
+			if err := json.Compact(&want, msg.Params); err != nil {
+				t.Fatal(err)
+			}
+
+			// The JSON written back is the one sent, nested unknown fields included
+			var params Extensible[InitializeParams]
+			mustDecode(t, msg.Params, &params)
+			out := mustEncode(t, params)
+			if !bytes.Equal(out, want.Bytes()) {
+				t.Errorf("round trip changed the JSON\ngot:  %s\nwant: %s", out, want.Bytes())
+			}
+
+			// Decoding did fill the typed value
+			if params.Value.ClientInfo == nil || params.Value.ClientInfo.Name == "" {
+				t.Errorf("clientInfo not decoded: %+v", params.Value.ClientInfo)
+			}
+			if params.Value.Capabilities.TextDocument == nil {
+				t.Error("textDocument capabilities not decoded")
+			}
+
+			// The structs alone write back only members the client sent, with their value
+			var original, encoded any
+			mustDecode(t, msg.Params, &original)
+			mustDecode(t, mustEncode(t, params.Value), &encoded)
+			if path, ok := contained(encoded, original, ""); !ok {
+				t.Errorf("the structs changed %s", path)
+			}
+		})
+	}
+}
+
+// contained reports whether the decoded JSON got is part of want: the objects of got only
+// have members of want, the other values are equal. Otherwise the path of the first
+// difference is returned.
+func contained(got, want any, path string) (string, bool) {
+	switch got := got.(type) {
+	case map[string]any:
+		want, ok := want.(map[string]any)
+		if !ok {
+			return path, false
+		}
+		for name, value := range got {
+			if p, ok := contained(value, want[name], path+"."+name); !ok {
+				return p, false
+			}
+		}
+		return "", true
+	case []any:
+		want, ok := want.([]any)
+		if !ok || len(want) != len(got) {
+			return path, false
+		}
+		for i := range got {
+			if p, ok := contained(got[i], want[i], fmt.Sprintf("%s[%d]", path, i)); !ok {
+				return p, false
+			}
+		}
+		return "", true
+	}
+	return path, reflect.DeepEqual(got, want)
+}
+
+func mustDecode(t *testing.T, data []byte, v any) {
+	t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatalf("decode %s: %v", data, err)
+	}
+}
+
+func mustEncode(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
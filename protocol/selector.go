@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DocumentFilter denotes documents by language, URI scheme and path pattern, the fields
+// set must all match.
+type DocumentFilter struct {
+	// A language id, like `go`.
+	Language LanguageID `json:"language,omitempty"`
+	// A URI scheme, like `file` or `untitled`.
+	Scheme string `json:"scheme,omitempty"`
+	// A glob pattern, like `**/*.{ts,js}`, see MatchGlob.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// DocumentSelector is a combination of filters, a document matching one of them is selected.
+type DocumentSelector []DocumentFilter
+
+// TextDocumentRegistrationOptions are the registration options of the text document features
+// registered with client/registerCapability.
+type TextDocumentRegistrationOptions struct {
+	// The documents the registration applies to, null selects the documents of the client side selector.
+	DocumentSelector DocumentSelector `json:"documentSelector"`
+}
+
+// Matches reports whether the filter selects a document. An empty language is guessed from
+// the URI with LanguageIDForURI, invalid patterns select nothing.
+func (f DocumentFilter) Matches(uri DocumentURI, language LanguageID) bool {
+	parsed, err := url.Parse(string(uri))
+	if err != nil {
+		return false
+	}
+	if f.Scheme != "" && f.Scheme != parsed.Scheme {
+		return false
+	}
+	if f.Language != "" {
+		if language == "" {
+			language = LanguageIDForURI(uri)
+		}
+		if f.Language != language {
+			return false
+		}
+	}
+	if f.Pattern != "" {
+		if ok, err := MatchGlob(f.Pattern, uriPath(parsed)); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Matches reports whether a filter of the selector selects a document.
+func (s DocumentSelector) Matches(uri DocumentURI, language LanguageID) bool {
+	for _, f := range s {
+		if f.Matches(uri, language) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	globsMu sync.Mutex
+	globs   = make(map[string]*regexp.Regexp) // Compiled patterns, they come from a few registrations
+)
+
+// MatchGlob reports whether a slash separated path matches a glob pattern of the protocol:
+// `*` matches within a path segment, `?` one character, `**` any number of segments,
+// `{a,b}` one of the alternatives and `[a-z]` (`[!a-z]` negated) a character range.
+// Patterns not starting with `/` or `**` match the end of the path, like "*.go".
+func MatchGlob(pattern, path string) (bool, error) {
+	globsMu.Lock()
+	re, ok := globs[pattern]
+	globsMu.Unlock()
+	if !ok {
+		var err error
+		if re, err = compileGlob(pattern); err != nil {
+			return false, err
+		}
+		globsMu.Lock()
+		globs[pattern] = re
+		globsMu.Unlock()
+	}
+	return re.MatchString(path), nil
+}
+
+// compileGlob translates a glob pattern to an anchored regular expression.
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "**") {
+		sb.WriteString("(?:.*/)?")
+	}
+	depth := 0 // Nesting of {} groups
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				sb.WriteString("(?:.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '{':
+			depth++
+			sb.WriteString("(?:")
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("invalid glob pattern %q: unbalanced }", pattern)
+			}
+			depth--
+			sb.WriteString(")")
+		case ',':
+			if depth > 0 {
+				sb.WriteString("|")
+			} else {
+				sb.WriteString(",")
+			}
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid glob pattern %q: unclosed [", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("invalid glob pattern %q: unbalanced {", pattern)
+	}
+	sb.WriteString("$")
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("invalid glob pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
@@ -0,0 +1,13 @@
+package protocol
+
+// MethodResyncDocuments is the custom request a server restarted after a crash sends to the
+// client, asking it to send textDocument/didOpen again for the documents it had open.
+// Clients not implementing it answer MethodNotFound, the server then only clears the
+// diagnostics the crashed process published for those documents.
+const MethodResyncDocuments = "$/lspgo/resyncDocuments"
+
+// ResyncDocumentsParams are the params of MethodResyncDocuments.
+type ResyncDocumentsParams struct {
+	// Documents are the documents open in the crashed process, with the last version it had.
+	Documents []VersionedTextDocumentIdentifier `json:"documents"`
+}
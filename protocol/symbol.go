@@ -0,0 +1,163 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// SymbolKind specifies the kind of a symbol.
+type SymbolKind int
+
+// Defined symbol kinds.
+const (
+	SymbolKindFile          SymbolKind = 1
+	SymbolKindModule        SymbolKind = 2
+	SymbolKindNamespace     SymbolKind = 3
+	SymbolKindPackage       SymbolKind = 4
+	SymbolKindClass         SymbolKind = 5
+	SymbolKindMethod        SymbolKind = 6
+	SymbolKindProperty      SymbolKind = 7
+	SymbolKindField         SymbolKind = 8
+	SymbolKindConstructor   SymbolKind = 9
+	SymbolKindEnum          SymbolKind = 10
+	SymbolKindInterface     SymbolKind = 11
+	SymbolKindFunction      SymbolKind = 12
+	SymbolKindVariable      SymbolKind = 13
+	SymbolKindConstant      SymbolKind = 14
+	SymbolKindString        SymbolKind = 15
+	SymbolKindNumber        SymbolKind = 16
+	SymbolKindBoolean       SymbolKind = 17
+	SymbolKindArray         SymbolKind = 18
+	SymbolKindObject        SymbolKind = 19
+	SymbolKindKey           SymbolKind = 20
+	SymbolKindNull          SymbolKind = 21
+	SymbolKindEnumMember    SymbolKind = 22
+	SymbolKindStruct        SymbolKind = 23
+	SymbolKindEvent         SymbolKind = 24
+	SymbolKindOperator      SymbolKind = 25
+	SymbolKindTypeParameter SymbolKind = 26
+)
+
+// SymbolInformation represents information about programming constructs like
+// variables, classes, interfaces etc.
+type SymbolInformation struct {
+	// The name of this symbol.
+	Name string `json:"name"`
+	// The kind of this symbol.
+	Kind SymbolKind `json:"kind"`
+	// Tags for this symbol.
+	// Since LSP 3.16.0
+	Tags []SymbolTag `json:"tags,omitempty"`
+	// The location of this symbol.
+	Location Location `json:"location"`
+	// The name of the symbol containing this symbol. This information is for
+	// user interface purposes (e.g. to render a qualifier in the user interface
+	// if necessary). It can't be used to re-infer a hierarchy for the document
+	// symbols.
+	ContainerName string `json:"containerName,omitempty"`
+}
+
+// SymbolTag is extra annotation of a symbol, rendered by clients supporting it.
+// Since LSP 3.16.0
+type SymbolTag int
+
+// SymbolTagDeprecated renders a symbol as obsolete, usually struck through.
+const SymbolTagDeprecated SymbolTag = 1
+
+// WorkspaceSymbolParams parameters for the workspace/symbol request.
+type WorkspaceSymbolParams struct {
+	// A query string to filter symbols by. Clients may send an empty string to request
+	// all symbols.
+	Query string `json:"query"`
+	WorkDoneProgressParams
+	PartialResultParams
+}
+
+// WorkspaceSymbol is a symbol found in the workspace. Unlike SymbolInformation its
+// location may have no range, computed with workspaceSymbol/resolve when the client
+// supports it, see ResolvesWorkspaceSymbolProperty.
+// Since LSP 3.17.0
+type WorkspaceSymbol struct {
+	Name          string                  `json:"name"`
+	Kind          SymbolKind              `json:"kind"`
+	Tags          []SymbolTag             `json:"tags,omitempty"`
+	ContainerName string                  `json:"containerName,omitempty"`
+	Location      WorkspaceSymbolLocation `json:"location"`
+	// Data is preserved by the client between workspace/symbol and workspaceSymbol/resolve.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// WorkspaceSymbolLocation is the `Location | { uri: DocumentUri }` location of a
+// WorkspaceSymbol, the range being nil when it is left to resolve.
+type WorkspaceSymbolLocation struct {
+	URI   DocumentURI `json:"uri"`
+	Range *Range      `json:"range,omitempty"`
+}
+
+// SymbolInformation converts the symbol for clients not supporting WorkspaceSymbol, a
+// missing range is the start of the document.
+func (w WorkspaceSymbol) SymbolInformation() SymbolInformation {
+	info := SymbolInformation{
+		Name:          w.Name,
+		Kind:          w.Kind,
+		Tags:          w.Tags,
+		Location:      Location{URI: w.Location.URI},
+		ContainerName: w.ContainerName,
+	}
+	if w.Location.Range != nil {
+		info.Location.Range = *w.Location.Range
+	}
+	return info
+}
+
+// WorkspaceSymbolOptions server options for workspace/symbol requests.
+type WorkspaceSymbolOptions struct {
+	WorkDoneProgressOptions
+	// The server provides support to resolve additional information for a workspace symbol.
+	// Since LSP 3.17.0
+	ResolveProvider bool `json:"resolveProvider,omitempty"`
+}
+
+// SupportsWorkspaceSymbols reports whether the client accepts WorkspaceSymbol results from
+// workspace/symbol, rather than SymbolInformation. The spec has no dedicated capability, the
+// clients announcing resolveSupport implement LSP 3.17 workspace symbols.
+func (c ClientCapabilities) SupportsWorkspaceSymbols() bool {
+	return c.Workspace != nil && c.Workspace.Symbol != nil && c.Workspace.Symbol.ResolveSupport != nil
+}
+
+// ResolvesWorkspaceSymbolProperty reports whether the client can resolve the property
+// (e.g. "location.range") of workspace symbols lazily with workspaceSymbol/resolve.
+func (c ClientCapabilities) ResolvesWorkspaceSymbolProperty(property string) bool {
+	return c.SupportsWorkspaceSymbols() && slices.Contains(c.Workspace.Symbol.ResolveSupport.Properties, property)
+}
+
+// WorkspaceSymbols returns the result of workspace/symbol in the shape the client supports:
+// the symbols as is, or converted to SymbolInformation.
+func (c ClientCapabilities) WorkspaceSymbols(symbols []WorkspaceSymbol) any {
+	if c.SupportsWorkspaceSymbols() {
+		if symbols == nil {
+			return []WorkspaceSymbol{}
+		}
+		return symbols
+	}
+	infos := make([]SymbolInformation, len(symbols))
+	for i, symbol := range symbols {
+		infos[i] = symbol.SymbolInformation()
+	}
+	return infos
+}
+
+// DecodeWorkspaceSymbols decodes the `SymbolInformation[] | WorkspaceSymbol[]` result of
+// workspace/symbol. Both decode as WorkspaceSymbol, the fields of SymbolInformation being
+// a subset of its fields.
+func DecodeWorkspaceSymbols(raw json.RawMessage) ([]WorkspaceSymbol, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	var symbols []WorkspaceSymbol
+	if err := json.Unmarshal(raw, &symbols); err != nil {
+		return nil, fmt.Errorf("failed to decode workspace symbols: %w", err)
+	}
+	return symbols, nil
+}
@@ -0,0 +1,30 @@
+package protocol
+
+// TraceValue is the level of the execution traces the server sends with $/logTrace.
+type TraceValue string
+
+const (
+	TraceOff      TraceValue = "off"
+	TraceMessages TraceValue = "messages"
+	TraceVerbose  TraceValue = "verbose"
+)
+
+// Valid reports whether t is one of the trace values of the spec. Servers treat the others,
+// like "compact" sent by some clients, as off rather than failing initialize.
+func (t TraceValue) Valid() bool {
+	return t == TraceOff || t == TraceMessages || t == TraceVerbose
+}
+
+// SetTraceParams parameters for the $/setTrace notification.
+type SetTraceParams struct {
+	// The new value that should be assigned to the trace setting.
+	Value TraceValue `json:"value"`
+}
+
+// LogTraceParams parameters for the $/logTrace notification.
+type LogTraceParams struct {
+	// The message to be logged.
+	Message string `json:"message"`
+	// Additional information, only sent when the trace is verbose.
+	Verbose string `json:"verbose,omitempty"`
+}
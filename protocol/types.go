@@ -33,10 +33,17 @@ type VersionedTextDocumentIdentifier struct {
 	Version int `json:"version"` // Use int; null version is not typical in requests needing it
 }
 
+// OptionalVersionedTextDocumentIdentifier identifies a text document, at a specific version
+// unless Version is nil, e.g. a file created by the same workspace edit.
+type OptionalVersionedTextDocumentIdentifier struct {
+	TextDocumentIdentifier
+	Version *int `json:"version"`
+}
+
 // TextDocumentItem represents a text document. Used in didOpen.
 type TextDocumentItem struct {
 	URI        DocumentURI `json:"uri"`
-	LanguageID string      `json:"languageId"`
+	LanguageID LanguageID  `json:"languageId"`
 	Version    int         `json:"version"`
 	Text       string      `json:"text"`
 }
@@ -45,22 +52,40 @@ type TextDocumentItem struct {
 type TextEdit struct {
 	Range   Range  `json:"range"`
 	NewText string `json:"newText"`
+	// AnnotationID makes the edit an AnnotatedTextEdit, only allowed in the edits of a
+	// TextDocumentEdit. It refers to an entry of WorkspaceEdit.ChangeAnnotations.
+	// Since LSP 3.16.0
+	AnnotationID ChangeAnnotationIdentifier `json:"annotationId,omitempty"`
+}
+
+// ChangeAnnotationIdentifier refers to a ChangeAnnotation of a WorkspaceEdit.
+type ChangeAnnotationIdentifier string
+
+// ChangeAnnotation describes a group of changes of a workspace edit, clients may show it
+// and ask the user to confirm the changes.
+// Since LSP 3.16.0
+type ChangeAnnotation struct {
+	// A human-readable string describing the change, rendered prominently in the UI.
+	Label string `json:"label"`
+	// Whether the user should confirm the change before it is applied.
+	NeedsConfirmation bool `json:"needsConfirmation,omitempty"`
+	// A human-readable string rendered less prominently in the UI.
+	Description string `json:"description,omitempty"`
 }
 
 // TextDocumentEdit describes textual changes on a single text document.
-// The text document is referred to by a VersionedTextDocumentIdentifier to allow clients
+// The text document is referred to by an OptionalVersionedTextDocumentIdentifier to allow clients
 // to check the text document version before an edit is applied. An array of TextDocumentEdit
 // can be part of a WorkspaceEdit's `documentChanges` field.
 type TextDocumentEdit struct {
-	TextDocument VersionedTextDocumentIdentifier `json:"textDocument"`
+	TextDocument OptionalVersionedTextDocumentIdentifier `json:"textDocument"`
 	// The edits to be applied.
 	Edits []TextEdit `json:"edits"`
 }
 
 // WorkspaceEdit represents changes to many resources managed in the workspace.
 // A workspace edit consists primarily of textual changes (`changes` or `documentChanges`),
-// but can also include resource operations like creating, renaming, or deleting files
-// (which are not fully defined in this basic example).
+// but can also include resource operations like creating, renaming, or deleting files.
 //
 // Note: A server should prefer `documentChanges` over `changes` if the client supports
 // versioned document edits (`workspace.workspaceEdit.documentChanges` capability).
@@ -72,45 +97,12 @@ type WorkspaceEdit struct {
 	// Deprecated: Clients support `documentChanges` field should ignore this field.
 	Changes map[DocumentURI][]TextEdit `json:"changes,omitempty"`
 
-	// An array of `TextDocumentEdit`s or resource operations (like create, rename, delete file).
-	// Resource operations require the client capability `workspace.workspaceEdit.resourceOperations`
-	// and are typically represented using different structs within this slice (e.g., CreateFile, RenameFile, DeleteFile).
-	// For simplicity here, we only explicitly include `TextDocumentEdit`, which is the most common case.
-	// A more complete implementation might use `[]interface{}` or custom marshalling.
-	DocumentChanges []TextDocumentEdit `json:"documentChanges,omitempty"` // Simplified to focus on text edits
+	// An array of `TextDocumentEdit`s or resource operations (create, rename, delete file),
+	// applied in order. Resource operations require the client capability
+	// `workspace.workspaceEdit.resourceOperations`, see SupportsResourceOperation.
+	DocumentChanges []DocumentChange `json:"documentChanges,omitempty"`
 
-	// Optional metadata about the changes. Requires client capability
-	// `workspace.workspaceEdit.changeAnnotationSupport`.
-	// ChangeAnnotations map[string]ChangeAnnotation `json:"changeAnnotations,omitempty"` // Add if needed later
+	// Optional metadata about the changes, referred to by the annotated edits. Requires client
+	// capability `workspace.workspaceEdit.changeAnnotationSupport`.
+	ChangeAnnotations map[ChangeAnnotationIdentifier]ChangeAnnotation `json:"changeAnnotations,omitempty"`
 }
-
-// // --- Placeholder definitions for completeness (if you need resource operations later) ---
-//
-// // CreateFile operation defined by LSP spec.
-// type CreateFile struct {
-// 	Kind string `json:"kind"` // always 'create'
-// 	URI DocumentURI `json:"uri"`
-// 	Options *CreateFileOptions `json:"options,omitempty"`
-// 	AnnotationID *ChangeAnnotationIdentifier `json:"annotationId,omitempty"`
-// }
-// // RenameFile operation defined by LSP spec.
-// type RenameFile struct {
-// 	Kind string `json:"kind"` // always 'rename'
-// 	OldURI DocumentURI `json:"oldUri"`
-// 	NewURI DocumentURI `json:"newUri"`
-// 	Options *RenameFileOptions `json:"options,omitempty"`
-// 	AnnotationID *ChangeAnnotationIdentifier `json:"annotationId,omitempty"`
-// }
-// // DeleteFile operation defined by LSP spec.
-// type DeleteFile struct {
-// 	Kind string `json:"kind"` // always 'delete'
-// 	URI DocumentURI `json:"uri"`
-// 	Options *DeleteFileOptions `json:"options,omitempty"`
-// 	AnnotationID *ChangeAnnotationIdentifier `json:"annotationId,omitempty"`
-// }
-// // Options for file operations (can be extended based on spec)
-// type CreateFileOptions struct { Overwrite bool `json:"overwrite,omitempty"`; IgnoreIfExists bool `json:"ignoreIfExists,omitempty"` }
-// type RenameFileOptions struct { Overwrite bool `json:"overwrite,omitempty"`; IgnoreIfExists bool `json:"ignoreIfExists,omitempty"` }
-// type DeleteFileOptions struct { Recursive bool `json:"recursive,omitempty"`; IgnoreIfNotExists bool `json:"ignoreIfNotExists,omitempty"` }
-// type ChangeAnnotationIdentifier string
-// type ChangeAnnotation struct { // ... definition ... }
@@ -0,0 +1,415 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Extensible wraps a protocol value and keeps the JSON fields its Go type does not model.
+// Decoding a message into Extensible[T] and encoding it again produces the same fields,
+// which matters for code forwarding messages (proxies, clients) where lspgo's structs
+// are only a subset of the spec or of a client's extensions.
+//
+//	var params protocol.Extensible[protocol.InitializeParams]
+//	json.Unmarshal(raw, &params)
+//	params.Value.ClientInfo = ... // Work with the typed value
+//	json.Marshal(params)          // Unknown fields are written back
+//
+// The fields are kept at every level: a capability a client added to
+// textDocument.completion is written back in textDocument.completion, as long as Value
+// still encodes that object. Values left unchanged are written as they were decoded.
+type Extensible[T any] struct {
+	// Value is the decoded typed value.
+	Value T
+	// Unknown holds the top level fields that T has no field for. Removing one removes it
+	// from the encoded JSON, the ones added are written after the fields of Value.
+	Unknown map[string]json.RawMessage
+
+	// raw is the JSON decoded into Value, the unknown fields of the nested objects are
+	// taken from it.
+	raw json.RawMessage
+}
+
+// UnmarshalJSON decodes data into Value and collects the remaining fields in Unknown.
+// Field names are matched the way encoding/json does, case-insensitively.
+func (e *Extensible[T]) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &e.Value); err != nil {
+		return err
+	}
+
+	e.Unknown = nil
+	e.raw = bytes.Clone(data)
+	members, ok, err := objectMembers(data)
+	if err != nil || !ok {
+		return err // Only objects can carry extra fields
+	}
+	fields := structFields(reflect.TypeOf(e.Value))
+	for _, m := range members {
+		if fields.lookup(m.name) != nil {
+			continue
+		}
+		if e.Unknown == nil {
+			e.Unknown = make(map[string]json.RawMessage)
+		}
+		e.Unknown[m.name] = m.value
+	}
+	return nil
+}
+
+// MarshalJSON encodes Value and merges the unknown fields back in.
+// Fields set on Value take precedence over unknown fields with the same name.
+func (e Extensible[T]) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(e.Value)
+	if err != nil || (len(e.Unknown) == 0 && len(e.raw) == 0) {
+		return data, err
+	}
+
+	t := reflect.TypeOf(e.Value)
+	var buf bytes.Buffer
+	if _, isObject, _ := objectMembers(data); !isObject {
+		if len(e.Unknown) > 0 {
+			return nil, fmt.Errorf("cannot merge unknown fields into %T: not encoded as a JSON object", e.Value)
+		}
+		err = mergeJSON(&buf, e.raw, data, t)
+	} else {
+		err = mergeObject(&buf, e.raw, data, t, e.Unknown, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeJSON writes enc, the encoding of a value of type t, with the members the JSON orig
+// decoded into that value has and t does not model. Parts of enc equal to orig are written
+// as orig has them.
+func mergeJSON(buf *bytes.Buffer, orig, enc json.RawMessage, t reflect.Type) error {
+	if len(orig) == 0 {
+		buf.Write(enc)
+		return nil
+	}
+	if t != nil {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	if opaque(t) {
+		writeSame(buf, orig, enc)
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		if _, isObject, _ := objectMembers(orig); isObject {
+			if _, isObject, _ := objectMembers(enc); isObject {
+				return mergeObject(buf, orig, enc, t, nil, false)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		origElems, origOK, err := arrayElements(orig)
+		if err != nil {
+			return err
+		}
+		encElems, encOK, err := arrayElements(enc)
+		if err != nil {
+			return err
+		}
+		// Elements are matched by index, when the array kept its length
+		if origOK && encOK && len(origElems) == len(encElems) {
+			buf.WriteByte('[')
+			for i := range encElems {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := mergeJSON(buf, origElems[i], encElems[i], t.Elem()); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+			return nil
+		}
+	}
+	writeSame(buf, orig, enc)
+	return nil
+}
+
+// mergeObject merges the objects orig and enc, see mergeJSON. At the top level of an
+// Extensible, the unknown members of orig are the ones still in unknown, which may add
+// members too.
+func mergeObject(buf *bytes.Buffer, orig, enc json.RawMessage, t reflect.Type, unknown map[string]json.RawMessage, top bool) error {
+	origMembers, _, err := objectMembers(orig)
+	if err != nil {
+		return err
+	}
+	encMembers, _, err := objectMembers(enc)
+	if err != nil {
+		return err
+	}
+	if t != nil {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	fields := structFields(t)
+
+	used := make([]bool, len(encMembers))
+	written := make(map[string]bool)
+	writeKey := func(name string) {
+		if len(written) > 0 {
+			buf.WriteByte(',')
+		}
+		written[name] = true
+		key, _ := json.Marshal(name)
+		buf.Write(key)
+		buf.WriteByte(':')
+	}
+
+	buf.WriteByte('{')
+	for _, m := range origMembers {
+		var encoded string
+		var ft reflect.Type
+		switch f := fields.lookup(m.name); {
+		case t != nil && t.Kind() == reflect.Map:
+			encoded, ft = m.name, t.Elem()
+		case f != nil:
+			encoded, ft = f.name, f.typ
+		case !top:
+			writeKey(m.name)
+			buf.Write(m.value)
+			continue
+		default:
+			if value, kept := unknown[m.name]; kept {
+				writeKey(m.name)
+				writeSame(buf, m.value, value)
+			}
+			continue
+		}
+
+		if i := unusedMember(encMembers, used, encoded); i >= 0 {
+			used[i] = true
+			writeKey(m.name)
+			if err := mergeJSON(buf, m.value, encMembers[i].value, ft); err != nil {
+				return err
+			}
+		} else if t.Kind() == reflect.Struct && isEmptyJSON(m.value) {
+			writeKey(m.name) // Left out by omitempty, as sent
+			buf.Write(m.value)
+		}
+	}
+
+	for i, m := range encMembers {
+		if !used[i] && !written[m.name] {
+			writeKey(m.name)
+			buf.Write(m.value)
+		}
+	}
+
+	names := make([]string, 0, len(unknown))
+	for name := range unknown {
+		if !written[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		writeKey(name)
+		buf.Write(unknown[name])
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// unusedMember returns the index of the member named name not used yet, -1 if there is
+// none.
+func unusedMember(members []member, used []bool, name string) int {
+	for i, m := range members {
+		if !used[i] && m.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// writeSame writes orig when it holds the same value as enc, enc otherwise.
+func writeSame(buf *bytes.Buffer, orig, enc json.RawMessage) {
+	var a, b any
+	if json.Unmarshal(orig, &a) == nil && json.Unmarshal(enc, &b) == nil && reflect.DeepEqual(a, b) {
+		buf.Write(orig)
+		return
+	}
+	buf.Write(enc)
+}
+
+// isEmptyJSON reports whether raw is a value omitempty leaves out: false, 0, "", null or an
+// empty array or object.
+func isEmptyJSON(raw json.RawMessage) bool {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return false
+	}
+	switch v := v.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case map[string]any:
+		return len(v) == 0
+	case []any:
+		return len(v) == 0
+	}
+	return false
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// opaque reports whether the fields of values of type t are unknown: interfaces and types
+// with their own JSON encoding.
+func opaque(t reflect.Type) bool {
+	return t == nil || t.Kind() == reflect.Interface ||
+		t.Implements(marshalerType) || reflect.PointerTo(t).Implements(unmarshalerType)
+}
+
+// member is a member of a JSON object.
+type member struct {
+	name  string
+	value json.RawMessage
+}
+
+// objectMembers returns the members of the JSON object data in order, false if data is
+// not an object.
+func objectMembers(data []byte) ([]member, bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false, nil
+	}
+	var members []member
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false, err
+		}
+		members = append(members, member{name: tok.(string), value: value})
+	}
+	return members, true, nil
+}
+
+// arrayElements returns the elements of the JSON array data, false if data is not an array.
+func arrayElements(data []byte) ([]json.RawMessage, bool, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, false, nil
+	}
+	var elems []json.RawMessage
+	for dec.More() {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false, err
+		}
+		elems = append(elems, value)
+	}
+	return elems, true, nil
+}
+
+// field is a field of a struct as encoding/json sees it.
+type field struct {
+	name string // JSON name
+	typ  reflect.Type
+}
+
+// fieldSet holds the JSON fields of a struct, the ones of embedded structs included.
+type fieldSet struct {
+	fields []field
+	byName map[string]*field
+}
+
+// lookup returns the field a JSON member name is decoded into: the field with that exact
+// name, otherwise one whose name matches case-insensitively, like encoding/json. Nil if
+// there is none.
+func (s *fieldSet) lookup(name string) *field {
+	if s == nil {
+		return nil
+	}
+	if f, ok := s.byName[name]; ok {
+		return f
+	}
+	for i := range s.fields {
+		if strings.EqualFold(s.fields[i].name, name) {
+			return &s.fields[i]
+		}
+	}
+	return nil
+}
+
+// fieldSetCache caches the fields per struct type.
+var fieldSetCache sync.Map // map[reflect.Type]*fieldSet
+
+// structFields returns the JSON fields encoding/json maps onto type t, nil if t is not a
+// struct.
+func structFields(t reflect.Type) *fieldSet {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	if cached, ok := fieldSetCache.Load(t); ok {
+		return cached.(*fieldSet)
+	}
+
+	s := &fieldSet{byName: make(map[string]*field)}
+	collectFields(t, s)
+	for i := range s.fields {
+		s.byName[s.fields[i].name] = &s.fields[i]
+	}
+	fieldSetCache.Store(t, s)
+	return s
+}
+
+func collectFields(t reflect.Type, s *fieldSet) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name have their fields promoted
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(ft, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.fields = append(s.fields, field{name: name, typ: f.Type})
+	}
+}
@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExtensibleRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		edit func(*Extensible[InitializeParams])
+		want string
+	}{
+		{
+			name: "top level",
+			in:   `{"processId":1,"locale":"fr","capabilities":{}}`,
+			want: `{"processId":1,"locale":"fr","capabilities":{}}`,
+		},
+		{
+			name: "nested",
+			in:   `{"capabilities":{"textDocument":{"hover":{"contentFormat":["markdown"],"x-hover":{"a":1}},"x-caps":true},"experimental":{"b":2}}}`,
+			want: `{"capabilities":{"textDocument":{"hover":{"contentFormat":["markdown"],"x-hover":{"a":1}},"x-caps":true},"experimental":{"b":2}}}`,
+		},
+		{
+			name: "in array elements",
+			in:   `{"capabilities":{},"workspaceFolders":[{"uri":"file:///a","name":"a","x-pinned":true}]}`,
+			want: `{"capabilities":{},"workspaceFolders":[{"uri":"file:///a","name":"a","x-pinned":true}]}`,
+		},
+		{
+			name: "zero values omitempty leaves out",
+			in:   `{"capabilities":{"textDocument":{"hover":{"dynamicRegistration":false}}},"trace":""}`,
+			want: `{"capabilities":{"textDocument":{"hover":{"dynamicRegistration":false}}},"trace":""}`,
+		},
+		{
+			name: "names in another case",
+			in:   `{"ProcessID":7,"capabilities":{"textdocument":{"Hover":{"contentformat":["plaintext"]}}}}`,
+			want: `{"ProcessID":7,"capabilities":{"textdocument":{"Hover":{"contentformat":["plaintext"]}}}}`,
+		},
+		{
+			name: "edited value",
+			in:   `{"processId":1,"capabilities":{"textDocument":{"hover":{"contentFormat":["markdown"],"x-hover":1}}}}`,
+			edit: func(e *Extensible[InitializeParams]) {
+				*e.Value.ProcessID = 2
+				e.Value.Capabilities.TextDocument.Hover.ContentFormat = []MarkupKind{PlainText}
+			},
+			want: `{"processId":2,"capabilities":{"textDocument":{"hover":{"contentFormat":["plaintext"],"x-hover":1}}}}`,
+		},
+		{
+			name: "removed object",
+			in:   `{"capabilities":{"textDocument":{"hover":{"x-hover":1}},"workspace":{"applyEdit":true}}}`,
+			edit: func(e *Extensible[InitializeParams]) {
+				e.Value.Capabilities.TextDocument = nil
+				e.Value.Capabilities.Workspace.ApplyEdit = false
+			},
+			want: `{"capabilities":{"workspace":{}}}`,
+		},
+		{
+			name: "unknown fields edited",
+			in:   `{"capabilities":{},"locale":"fr","rootPath":"/a"}`,
+			edit: func(e *Extensible[InitializeParams]) {
+				delete(e.Unknown, "rootPath")
+				e.Unknown["locale"] = json.RawMessage(`"de"`)
+				e.Unknown["added"] = json.RawMessage(`1`)
+			},
+			want: `{"capabilities":{},"locale":"de","added":1}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var params Extensible[InitializeParams]
+			if err := json.Unmarshal([]byte(tt.in), &params); err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit != nil {
+				tt.edit(&params)
+			}
+			out, err := json.Marshal(params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.want {
+				t.Errorf("got  %s\nwant %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtensibleUnknownCaseInsensitive(t *testing.T) {
+	var params Extensible[InitializeParams]
+	in := `{"processid":3,"ROOTURI":"file:///a","capabilities":{},"locale":"fr"}`
+	if err := json.Unmarshal([]byte(in), &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Value.ProcessID == nil || *params.Value.ProcessID != 3 {
+		t.Errorf("processid not decoded: %v", params.Value.ProcessID)
+	}
+	if len(params.Unknown) != 1 || params.Unknown["locale"] == nil {
+		t.Errorf("unknown: got %v, want only locale", params.Unknown)
+	}
+}
+
+func TestExtensibleWithoutDecoding(t *testing.T) {
+	folder := Extensible[WorkspaceFolder]{
+		Value:   WorkspaceFolder{URI: "file:///a", Name: "a"},
+		Unknown: map[string]json.RawMessage{"order": json.RawMessage(`3`)},
+	}
+	out, err := json.Marshal(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"uri":"file:///a","name":"a","order":3}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+}
@@ -0,0 +1,162 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// URI schemes of the documents editors commonly open. Documents are not all files: the
+// store, selectors and language detection handle any scheme, only Path needs a local file.
+const (
+	// FileScheme is the URI scheme of documents stored on disk.
+	FileScheme = "file"
+	// UntitledScheme is the scheme of new documents not saved yet, e.g. "untitled:Untitled-1".
+	UntitledScheme = "untitled"
+	// NotebookCellScheme is the scheme of the cells of a notebook in VS Code: the path is the
+	// one of the notebook and the fragment identifies the cell.
+	NotebookCellScheme = "vscode-notebook-cell"
+)
+
+// ErrNoLocalPath is returned by DocumentURI.Path for documents which are not local files,
+// e.g. untitled ones.
+var ErrNoLocalPath = errors.New("document has no local path")
+
+// URIScheme handles the URIs of a scheme, see RegisterURIScheme.
+type URIScheme struct {
+	// Path returns the local path of a document, e.g. a remote path mapped to a mount. nil
+	// for schemes whose documents have no local path.
+	Path func(u *url.URL) (string, error)
+	// Canonical returns the form of a URI used to compare documents, equal for the URIs of
+	// a document however the client encodes them. nil compares the URIs as sent, with a
+	// lowercase scheme.
+	Canonical func(u *url.URL) string
+}
+
+var (
+	uriSchemesMu sync.RWMutex
+	uriSchemes   = map[string]URIScheme{
+		FileScheme: {Path: filePath, Canonical: canonicalFileURI},
+	}
+)
+
+// RegisterURIScheme sets the handling of the URIs of a scheme, replacing the previous one,
+// e.g. to map the documents of a remote scheme to local paths. Schemes are case insensitive.
+func RegisterURIScheme(scheme string, handler URIScheme) {
+	uriSchemesMu.Lock()
+	defer uriSchemesMu.Unlock()
+	uriSchemes[strings.ToLower(scheme)] = handler
+}
+
+// uriScheme returns the handler of the scheme of a parsed URI.
+func uriScheme(u *url.URL) (URIScheme, bool) {
+	uriSchemesMu.RLock()
+	defer uriSchemesMu.RUnlock()
+	handler, ok := uriSchemes[u.Scheme] // url.Parse lowercases the scheme
+	return handler, ok
+}
+
+// URIFromPath returns the file:// URI of a local path, made absolute if needed.
+func URIFromPath(path string) DocumentURI {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	path = filepath.ToSlash(path)
+	if runtime.GOOS == "windows" {
+		path = "/" + path // file:///C:/dir
+	}
+	u := url.URL{Scheme: FileScheme, Path: path}
+	return DocumentURI(u.String())
+}
+
+// Scheme returns the scheme of the URI in lowercase, "" when it is invalid.
+func (u DocumentURI) Scheme() string {
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		return ""
+	}
+	return parsed.Scheme
+}
+
+// Path returns the local path of a document, for file:// URIs and the schemes registered
+// with a path. The error wraps ErrNoLocalPath for the other schemes.
+func (u DocumentURI) Path() (string, error) {
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		return "", fmt.Errorf("invalid document URI %q: %w", u, err)
+	}
+	handler, _ := uriScheme(parsed)
+	if handler.Path == nil {
+		return "", fmt.Errorf("document URI %q: %w", u, ErrNoLocalPath)
+	}
+	return handler.Path(parsed)
+}
+
+// filePath is the Path of file:// URIs.
+func filePath(u *url.URL) (string, error) {
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		path = strings.TrimPrefix(path, "/")
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// Name returns the last element of the path of a document, of any scheme, e.g. "main.go"
+// for "file:///src/main.go" and "Untitled-1" for "untitled:Untitled-1". It returns the URI
+// itself when it is invalid.
+func (u DocumentURI) Name() string {
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		return string(u)
+	}
+	return path.Base(uriPath(parsed))
+}
+
+// uriPath returns the path of a parsed URI, the opaque part of those without one such as
+// "untitled:Untitled-1".
+func uriPath(u *url.URL) string {
+	if u.Path == "" {
+		return u.Opaque
+	}
+	return u.Path
+}
+
+// Canonical returns the form of the URI used to compare documents, so that the URIs a
+// client encodes differently (e.g. "file:///C%3A/a.go" and "file:///c:/a.go") name the
+// same document. The store and the locks of the textdocument package are keyed by it,
+// the URIs sent to the client stay the ones it used.
+func (u DocumentURI) Canonical() DocumentURI {
+	parsed, err := url.Parse(string(u))
+	if err != nil {
+		return u
+	}
+	if handler, _ := uriScheme(parsed); handler.Canonical != nil {
+		return DocumentURI(handler.Canonical(parsed))
+	}
+	if parsed.Scheme == "" {
+		return u
+	}
+	// Only the scheme is case insensitive for unknown schemes
+	return DocumentURI(parsed.Scheme + string(u)[len(parsed.Scheme):])
+}
+
+// canonicalFileURI is the Canonical of file:// URIs: the path is decoded and encoded again,
+// with a lowercase drive letter as VS Code sends them.
+func canonicalFileURI(u *url.URL) string {
+	p := u.Path
+	if len(p) >= 3 && p[0] == '/' && p[2] == ':' && isASCIILetter(p[1]) {
+		p = "/" + strings.ToLower(p[1:2]) + p[2:]
+	}
+	canonical := url.URL{Scheme: FileScheme, Host: u.Host, Path: p}
+	return canonical.String()
+}
+
+// isASCIILetter reports whether c is an ASCII letter, e.g. a Windows drive.
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
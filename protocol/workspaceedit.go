@@ -0,0 +1,140 @@
+package protocol
+
+import (
+	"fmt"
+	"sort"
+)
+
+// WorkspaceEditBuilder accumulates text edits over several documents and builds
+// the WorkspaceEdit in the form the client supports.
+//
+//	b := protocol.NewWorkspaceEditBuilder()
+//	b.SetVersion(uri, doc.Version)
+//	b.Replace(uri, rng, "fixed")
+//	edit, err := b.Build(caps.SupportsDocumentChanges())
+type WorkspaceEditBuilder struct {
+	uris     []DocumentURI // In order of first edit, for a deterministic output
+	edits    map[DocumentURI][]TextEdit
+	versions map[DocumentURI]int
+}
+
+// NewWorkspaceEditBuilder creates an empty builder.
+func NewWorkspaceEditBuilder() *WorkspaceEditBuilder {
+	return &WorkspaceEditBuilder{
+		edits:    make(map[DocumentURI][]TextEdit),
+		versions: make(map[DocumentURI]int),
+	}
+}
+
+// SetVersion records the document version the edits of uri were computed for,
+// so the client can reject them if the document changed in the meantime.
+func (b *WorkspaceEditBuilder) SetVersion(uri DocumentURI, version int) *WorkspaceEditBuilder {
+	b.versions[uri] = version
+	return b
+}
+
+// Versions returns the versions recorded with SetVersion, by document. Build drops them
+// from plain changes, callers can still check them against the open documents.
+func (b *WorkspaceEditBuilder) Versions() map[DocumentURI]int {
+	versions := make(map[DocumentURI]int, len(b.versions))
+	for uri, version := range b.versions {
+		versions[uri] = version
+	}
+	return versions
+}
+
+// Replace replaces the text of rng with newText.
+func (b *WorkspaceEditBuilder) Replace(uri DocumentURI, rng Range, newText string) *WorkspaceEditBuilder {
+	if _, ok := b.edits[uri]; !ok {
+		b.uris = append(b.uris, uri)
+	}
+	b.edits[uri] = append(b.edits[uri], TextEdit{Range: rng, NewText: newText})
+	return b
+}
+
+// Insert inserts text at pos. Several inserts at the same position are applied in order.
+func (b *WorkspaceEditBuilder) Insert(uri DocumentURI, pos Position, text string) *WorkspaceEditBuilder {
+	return b.Replace(uri, Range{Start: pos, End: pos}, text)
+}
+
+// Delete deletes the text of rng.
+func (b *WorkspaceEditBuilder) Delete(uri DocumentURI, rng Range) *WorkspaceEditBuilder {
+	return b.Replace(uri, rng, "")
+}
+
+// Len returns the number of edits added.
+func (b *WorkspaceEditBuilder) Len() int {
+	n := 0
+	for _, edits := range b.edits {
+		n += len(edits)
+	}
+	return n
+}
+
+// Build returns the workspace edit. Edits are returned as versioned documentChanges when
+// documentChanges is true (the client supports them, see ClientCapabilities.SupportsDocumentChanges)
+// and the version of every document is known, as plain changes otherwise.
+// It fails if edits of a document overlap, the client would reject the whole edit.
+func (b *WorkspaceEditBuilder) Build(documentChanges bool) (WorkspaceEdit, error) {
+	for _, uri := range b.uris {
+		if err := checkOverlaps(b.edits[uri]); err != nil {
+			return WorkspaceEdit{}, fmt.Errorf("invalid edits for %s: %w", uri, err)
+		}
+		if _, ok := b.versions[uri]; !ok {
+			documentChanges = false
+		}
+	}
+
+	var edit WorkspaceEdit
+	if documentChanges {
+		for _, uri := range b.uris {
+			version := b.versions[uri]
+			edit.DocumentChanges = append(edit.DocumentChanges, DocumentChange{TextDocumentEdit: &TextDocumentEdit{
+				TextDocument: OptionalVersionedTextDocumentIdentifier{
+					TextDocumentIdentifier: TextDocumentIdentifier{URI: uri},
+					Version:                &version,
+				},
+				Edits: b.edits[uri],
+			}})
+		}
+		return edit, nil
+	}
+	edit.Changes = make(map[DocumentURI][]TextEdit, len(b.uris))
+	for _, uri := range b.uris {
+		edit.Changes[uri] = b.edits[uri]
+	}
+	return edit, nil
+}
+
+// checkOverlaps returns an error if two edits overlap. Edits touching at their bounds,
+// and inserts at the same position, are fine.
+func checkOverlaps(edits []TextEdit) error {
+	sorted := make([]TextEdit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return comparePositions(sorted[i].Range.Start, sorted[j].Range.Start) < 0
+	})
+	for i := 1; i < len(sorted); i++ {
+		prev, cur := sorted[i-1].Range, sorted[i].Range
+		if comparePositions(cur.Start, prev.End) < 0 {
+			return fmt.Errorf("edit at %d:%d overlaps edit at %d:%d",
+				cur.Start.Line, cur.Start.Character, prev.Start.Line, prev.Start.Character)
+		}
+	}
+	return nil
+}
+
+// comparePositions returns -1, 0 or 1 when a is before, equal to or after b.
+func comparePositions(a, b Position) int {
+	switch {
+	case a.Line < b.Line:
+		return -1
+	case a.Line > b.Line:
+		return 1
+	case a.Character < b.Character:
+		return -1
+	case a.Character > b.Character:
+		return 1
+	}
+	return 0
+}
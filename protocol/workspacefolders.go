@@ -0,0 +1,49 @@
+package protocol
+
+import (
+	"net/url"
+	"strings"
+)
+
+// WorkspaceServerCapabilities are the workspace specific server capabilities.
+type WorkspaceServerCapabilities struct {
+	// The server supports workspace folders. Since LSP 3.6.0
+	WorkspaceFolders *WorkspaceFoldersServerCapabilities `json:"workspaceFolders,omitempty"`
+}
+
+// WorkspaceFoldersServerCapabilities tells the client the server handles multi-root
+// workspaces.
+type WorkspaceFoldersServerCapabilities struct {
+	// The server has support for workspace folders.
+	Supported bool `json:"supported,omitempty"`
+	// The server wants workspace/didChangeWorkspaceFolders notifications. The spec also
+	// allows a registration ID string, the server then registers the notification itself.
+	ChangeNotifications bool `json:"changeNotifications,omitempty"`
+}
+
+// DidChangeWorkspaceFoldersParams parameters for the workspace/didChangeWorkspaceFolders
+// notification.
+type DidChangeWorkspaceFoldersParams struct {
+	Event WorkspaceFoldersChangeEvent `json:"event"`
+}
+
+// WorkspaceFoldersChangeEvent lists the folders added to and removed from the workspace.
+type WorkspaceFoldersChangeEvent struct {
+	Added   []WorkspaceFolder `json:"added"`
+	Removed []WorkspaceFolder `json:"removed"`
+}
+
+// Contains reports whether a document is in the folder, its URI being the one of the
+// folder or below it. URIs are compared in canonical form, see DocumentURI.Canonical.
+func (f WorkspaceFolder) Contains(uri DocumentURI) bool {
+	folder, err := url.Parse(string(DocumentURI(f.URI).Canonical()))
+	if err != nil {
+		return false
+	}
+	doc, err := url.Parse(string(uri.Canonical()))
+	if err != nil || doc.Scheme != folder.Scheme || doc.Host != folder.Host {
+		return false
+	}
+	root := strings.TrimSuffix(folder.Path, "/")
+	return doc.Path == root || strings.HasPrefix(doc.Path, root+"/")
+}
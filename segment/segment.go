@@ -0,0 +1,249 @@
+// Package segment splits prose into paragraphs, sentences and words, keeping the
+// byte offsets of each piece in the original text, so prose oriented servers
+// (grammar and spell checkers, AI rewriting) can map results back to the document.
+//
+// Segments never include their leading or trailing whitespace.
+package segment
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Segment is a piece of text, Start and End are byte offsets in the original text
+// such that Text == original[Start:End].
+type Segment struct {
+	Text  string
+	Start int
+	End   int
+}
+
+// Contains reports whether the byte offset falls inside the segment (end inclusive,
+// so a cursor placed right after the last character is inside).
+func (s Segment) Contains(offset int) bool {
+	return offset >= s.Start && offset <= s.End
+}
+
+// At returns the segment containing the byte offset.
+func At(segments []Segment, offset int) (Segment, bool) {
+	for _, seg := range segments {
+		if seg.Contains(offset) {
+			return seg, true
+		}
+	}
+	return Segment{}, false
+}
+
+// newSegment returns text[start:end] trimmed of surrounding whitespace, ok is false if it's empty.
+func newSegment(text string, start, end int) (Segment, bool) {
+	for start < end {
+		r, size := utf8.DecodeRuneInString(text[start:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		start += size
+	}
+	for end > start {
+		r, size := utf8.DecodeLastRuneInString(text[start:end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		end -= size
+	}
+	if start == end {
+		return Segment{}, false
+	}
+	return Segment{Text: text[start:end], Start: start, End: end}, true
+}
+
+// Paragraphs splits text on blank lines.
+func Paragraphs(text string) []Segment {
+	var paragraphs []Segment
+	start := 0
+	lineStart := 0
+	for lineStart < len(text) {
+		lineEnd := strings.IndexByte(text[lineStart:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(text)
+		} else {
+			lineEnd += lineStart + 1 // Include the newline
+		}
+		if strings.TrimSpace(text[lineStart:lineEnd]) == "" {
+			if seg, ok := newSegment(text, start, lineStart); ok {
+				paragraphs = append(paragraphs, seg)
+			}
+			start = lineEnd
+		}
+		lineStart = lineEnd
+	}
+	if seg, ok := newSegment(text, start, len(text)); ok {
+		paragraphs = append(paragraphs, seg)
+	}
+	return paragraphs
+}
+
+// abbreviations are not considered sentence ends, compared lower-cased without the final dot.
+var abbreviations = map[string]bool{
+	"e.g": true, "i.e": true, "etc": true, "vs": true, "cf": true, "al": true,
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"fig": true, "no": true, "vol": true, "approx": true, "inc": true, "ltd": true,
+}
+
+// Sentences splits text into sentences. A sentence ends with '.', '!' or '?'
+// (optionally followed by closing quotes or brackets) before whitespace, or at a
+// paragraph break. Common abbreviations and initials don't end a sentence.
+func Sentences(text string) []Segment {
+	var sentences []Segment
+	for _, para := range Paragraphs(text) {
+		start := para.Start
+		i := para.Start
+		for i < para.End {
+			r, size := utf8.DecodeRuneInString(text[i:])
+			i += size
+			if r != '.' && r != '!' && r != '?' {
+				continue
+			}
+			// Consume repeated terminators and closing punctuation: "?!", ".)", '."'
+			for i < para.End {
+				next, nextSize := utf8.DecodeRuneInString(text[i:])
+				if !strings.ContainsRune(".!?\"')]’”»", next) {
+					break
+				}
+				i += nextSize
+			}
+			if i < para.End {
+				next, _ := utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsSpace(next) {
+					continue // e.g. "3.14", "example.com"
+				}
+			}
+			if r == '.' && isAbbreviation(text[start:i]) {
+				continue
+			}
+			if seg, ok := newSegment(text, start, i); ok {
+				sentences = append(sentences, seg)
+			}
+			start = i
+		}
+		if seg, ok := newSegment(text, start, para.End); ok {
+			sentences = append(sentences, seg)
+		}
+	}
+	return sentences
+}
+
+// isAbbreviation reports whether the sentence candidate ends with an abbreviation or an initial.
+func isAbbreviation(candidate string) bool {
+	candidate = strings.TrimRight(candidate, ".")
+	lastSpace := strings.LastIndexFunc(candidate, unicode.IsSpace)
+	word := candidate[lastSpace+1:]
+	word = strings.TrimLeft(word, "(\"'“‘")
+	if utf8.RuneCountInString(word) == 1 {
+		r, _ := utf8.DecodeRuneInString(word)
+		return unicode.IsUpper(r) // Initial, e.g. "J. Smith"
+	}
+	return abbreviations[strings.ToLower(word)]
+}
+
+// Words returns the words of text: runs of letters, digits and marks, including
+// inner apostrophes and hyphens ("don't", "well-known").
+func Words(text string) []Segment {
+	var words []Segment
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start == -1 {
+				start = i
+			}
+			continue
+		}
+		if start != -1 && isJoiner(r) && i+utf8.RuneLen(r) < len(text) {
+			next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+			if isWordRune(next) {
+				continue // Joiner inside a word
+			}
+		}
+		if start != -1 {
+			words = append(words, Segment{Text: text[start:i], Start: start, End: i})
+			start = -1
+		}
+	}
+	if start != -1 {
+		words = append(words, Segment{Text: text[start:], Start: start, End: len(text)})
+	}
+	return words
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
+
+func isJoiner(r rune) bool {
+	return r == '\'' || r == '’' || r == '-'
+}
+
+// Chunks groups text into contiguous chunks of at most maxBytes, for backends limiting
+// the size of a single request. Chunks break on paragraph boundaries when possible,
+// then on sentence boundaries, and as a last resort inside a sentence on a rune boundary.
+// Chunk offsets let results be mapped back: offsetInText = chunk.Start + offsetInChunk.
+func Chunks(text string, maxBytes int) []Segment {
+	if maxBytes <= 0 || len(text) <= maxBytes {
+		if seg, ok := newSegment(text, 0, len(text)); ok {
+			return []Segment{seg}
+		}
+		return nil
+	}
+
+	var pieces []Segment
+	for _, para := range Paragraphs(text) {
+		if para.End-para.Start <= maxBytes {
+			pieces = append(pieces, para)
+			continue
+		}
+		for _, sentence := range Sentences(para.Text) {
+			sentence.Start += para.Start
+			sentence.End += para.Start
+			pieces = append(pieces, splitBytes(text, sentence, maxBytes)...)
+		}
+	}
+
+	// Merge consecutive pieces while they fit
+	var chunks []Segment
+	for _, piece := range pieces {
+		if n := len(chunks); n > 0 && piece.End-chunks[n-1].Start <= maxBytes {
+			chunks[n-1].End = piece.End
+			chunks[n-1].Text = text[chunks[n-1].Start:piece.End]
+			continue
+		}
+		chunks = append(chunks, piece)
+	}
+	return chunks
+}
+
+// splitBytes cuts seg in pieces of at most maxBytes, preferring to cut after whitespace.
+func splitBytes(text string, seg Segment, maxBytes int) []Segment {
+	var pieces []Segment
+	start := seg.Start
+	for seg.End-start > maxBytes {
+		end := start + maxBytes
+		for end > start && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		if end == start {
+			_, size := utf8.DecodeRuneInString(text[start:])
+			end = start + size // maxBytes is smaller than a rune, keep going
+		}
+		if cut := strings.LastIndexFunc(text[start:end], unicode.IsSpace); cut > 0 {
+			end = start + cut
+		}
+		if piece, ok := newSegment(text, start, end); ok {
+			pieces = append(pieces, piece)
+		}
+		start = end
+	}
+	if piece, ok := newSegment(text, start, seg.End); ok {
+		pieces = append(pieces, piece)
+	}
+	return pieces
+}
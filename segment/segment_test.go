@@ -0,0 +1,192 @@
+package segment
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// texts returns the text of the segments, checking their offsets.
+func texts(t *testing.T, text string, segments []Segment) []string {
+	t.Helper()
+	var out []string
+	for _, seg := range segments {
+		if seg.Start < 0 || seg.End > len(text) || text[seg.Start:seg.End] != seg.Text {
+			t.Fatalf("segment %q at [%d:%d] does not match the text", seg.Text, seg.Start, seg.End)
+		}
+		out = append(out, seg.Text)
+	}
+	return out
+}
+
+func TestParagraphs(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"blank", " \n\t\n", nil},
+		{"single", "One line.\nSecond line.", []string{"One line.\nSecond line."}},
+		{"blank lines", "First.\n\n\nSecond.\n \nThird.\n", []string{"First.", "Second.", "Third."}},
+		{"crlf", "First.\r\n\r\nSecond.", []string{"First.", "Second."}},
+		{"indented", "  First.\n\n  Second.  ", []string{"First.", "Second."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := texts(t, tt.text, Paragraphs(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"terminators", "One. Two! Three? Four", []string{"One.", "Two!", "Three?", "Four"}},
+		{"repeated and closing", `Really?! (Yes.) He said "no." Done.`, []string{"Really?!", "(Yes.)", `He said "no."`, "Done."}},
+		{"abbreviations", "See e.g. the docs. Dr. Smith etc. agree. Next.", []string{"See e.g. the docs.", "Dr. Smith etc. agree.", "Next."}},
+		{"abbreviation case", "Cf. the first. Then.", []string{"Cf. the first.", "Then."}},
+		{"initials", "J. R. Tolkien wrote it. Then.", []string{"J. R. Tolkien wrote it.", "Then."}},
+		{"decimals", "Pi is 3.14 roughly. It costs $2.50.", []string{"Pi is 3.14 roughly.", "It costs $2.50."}},
+		{"urls", "Visit example.com today. Bye.", []string{"Visit example.com today.", "Bye."}},
+		{"paragraph break", "No terminator\n\nNext one.", []string{"No terminator", "Next one."}},
+		{"line break", "First.\nSecond.", []string{"First.", "Second."}},
+		{"multibyte", "Café crème. Über alles! Ça va?", []string{"Café crème.", "Über alles!", "Ça va?"}},
+		{"curly quotes", "Il a dit “oui.” Puis ‘non.’ Fin.", []string{"Il a dit “oui.”", "Puis ‘non.’", "Fin."}},
+		{"emoji", "Nice 👍. Great 🎉!", []string{"Nice 👍.", "Great 🎉!"}},
+		// Full width terminators are not sentence ends, only whitespace separated ones are
+		{"cjk", "你好。世界。 Hello.", []string{"你好。世界。 Hello."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := texts(t, tt.text, Sentences(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"punctuation", "Hello, world!", []string{"Hello", "world"}},
+		{"joiners", "Don't use well-known 'quotes' - or -dashes.", []string{"Don't", "use", "well-known", "quotes", "or", "dashes"}},
+		{"curly apostrophe", "l’école", []string{"l’école"}},
+		{"digits", "v2 has 10 items", []string{"v2", "has", "10", "items"}},
+		{"combining marks", "café ok", []string{"café", "ok"}},
+		{"cjk", "日本語 テスト", []string{"日本語", "テスト"}},
+		{"trailing joiner", "rock'", []string{"rock"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := texts(t, tt.text, Words(tt.text)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestUTF16Offsets checks the byte offsets of segments map to the LSP positions, which count
+// UTF-16 code units, of the text they were found in.
+func TestUTF16Offsets(t *testing.T) {
+	text := "Émoji 👍 first.\nSecond 日本 line. Third."
+	mapper := textdocument.NewMapper(text)
+	want := []protocol.Range{
+		{Start: protocol.Position{Line: 0, Character: 0}, End: protocol.Position{Line: 0, Character: 15}},
+		{Start: protocol.Position{Line: 1, Character: 0}, End: protocol.Position{Line: 1, Character: 15}},
+		{Start: protocol.Position{Line: 1, Character: 16}, End: protocol.Position{Line: 1, Character: 22}},
+	}
+	sentences := Sentences(text)
+	if len(sentences) != len(want) {
+		t.Fatalf("got %d sentences, want %d", len(sentences), len(want))
+	}
+	for i, seg := range sentences {
+		got, err := mapper.Range(seg.Start, seg.End)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want[i] {
+			t.Errorf("sentence %q: got %v, want %v", seg.Text, got, want[i])
+		}
+		// And back to the same byte offsets
+		start, end, err := mapper.Offsets(got)
+		if err != nil || start != seg.Start || end != seg.End {
+			t.Errorf("sentence %q: offsets [%d:%d] %v, want [%d:%d]", seg.Text, start, end, err, seg.Start, seg.End)
+		}
+	}
+
+	if word, ok := At(Words(text), strings.Index(text, "日本")); !ok || word.Text != "日本" {
+		t.Errorf("got %q, want 日本", word.Text)
+	}
+}
+
+func TestAt(t *testing.T) {
+	text := "One two."
+	words := Words(text)
+	tests := []struct {
+		offset int
+		want   string
+		ok     bool
+	}{
+		{0, "One", true},
+		{3, "One", true}, // Right after the word
+		{4, "two", true},
+		{7, "two", true},
+		{8, "", false},
+	}
+	for _, tt := range tests {
+		got, ok := At(words, tt.offset)
+		if ok != tt.ok || got.Text != tt.want {
+			t.Errorf("At(%d): got %q %v, want %q %v", tt.offset, got.Text, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestChunks(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		maxBytes int
+		want     []string
+	}{
+		{"fits", "  Short text.  ", 100, []string{"Short text."}},
+		{"no limit", "A.\n\nB.", 0, []string{"A.\n\nB."}},
+		{"empty", "   ", 10, nil},
+		{"paragraphs merged while they fit", "One.\n\nTwo.\n\nThree.", 12, []string{"One.\n\nTwo.", "Three."}},
+		{"long paragraph on sentences", "First one. Second one. Third.", 12, []string{"First one.", "Second one.", "Third."}},
+		{"long sentence on spaces", "aaaa bbbb cccc", 9, []string{"aaaa bbbb", "cccc"}},
+		{"word longer than the limit", "abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"multibyte never cut", "ééééé", 3, []string{"é", "é", "é", "é", "é"}},
+		{"cjk", "日本語のテキスト", 7, []string{"日本", "語の", "テキ", "スト"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Chunks(tt.text, tt.maxBytes)
+			got := texts(t, tt.text, chunks)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			for i, chunk := range chunks {
+				if tt.maxBytes > 0 && len(chunk.Text) > tt.maxBytes && len([]rune(chunk.Text)) > 1 {
+					t.Errorf("chunk %q longer than %d bytes", chunk.Text, tt.maxBytes)
+				}
+				if i > 0 && chunk.Start < chunks[i-1].End {
+					t.Errorf("chunk %q overlaps the previous one", chunk.Text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrUnauthorized is wrapped by the error Run returns when the Authorizer refused the
+// connection or the initialize request.
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Peer is the other end of the connection of the server, as known to the Authorizer.
+type Peer struct {
+	// Addr is the address of the peer when the stream has one, e.g. a net.Conn (or a
+	// ReadWriter reading one), nil for stdio.
+	Addr net.Addr
+	// Initialize is the initialize request the Authorizer accepted, nil before.
+	Initialize *protocol.InitializeParams
+}
+
+// Authorizer decides who may use a server reachable over the network, e.g. a Run per
+// connection accepted on a TCP listener, with the connection as stream. Its checks run in
+// the read loop, before the message is dispatched: no handler, hook or document update
+// runs for a message it refuses. Each check is optional.
+type Authorizer struct {
+	// Connection is called when Run starts, before reading any message. An error closes
+	// the connection, Run returns it wrapping ErrUnauthorized.
+	Connection func(ctx context.Context, peer Peer) error
+	// Initialize checks the initialize request, e.g. a token in its initialization
+	// options. An error fails the request (without retry, see protocol.InitializeError)
+	// and closes the connection.
+	Initialize func(ctx context.Context, peer Peer, params *protocol.InitializeParams) error
+	// Message is called for the other requests and notifications of the client, including
+	// exit. A refused request is answered with a RequestFailed error, a refused
+	// notification is dropped; the connection stays open. MethodHealth and
+	// MethodConfigurationSchema, which are otherwise answered in any state, are refused with
+	// ServerNotInitialized until the initialize request completed.
+	Message func(ctx context.Context, peer Peer, method string) error
+}
+
+// WithAuthorizer checks the connection and the messages of the client with a, for servers
+// reachable over the network. See Authorizer.
+func WithAuthorizer(a Authorizer) Option {
+	return func(o *options) {
+		o.authorizer = &a
+	}
+}
+
+// streamAddr returns the address of the peer of a stream, nil when it has none.
+func streamAddr(stream io.ReadWriter) net.Addr {
+	type remote interface{ RemoteAddr() net.Addr }
+	if r, ok := stream.(remote); ok {
+		return r.RemoteAddr()
+	}
+	if rw, ok := stream.(ReadWriter); ok {
+		if r, ok := rw.Reader.(remote); ok {
+			return r.RemoteAddr()
+		}
+	}
+	return nil
+}
+
+// peer returns the peer as known so far.
+func (s *Server) peer() Peer {
+	return Peer{Addr: s.peerAddr, Initialize: s.authorizedInit.Load()}
+}
+
+// authorizeConnection runs the Connection check when Run starts.
+func (s *Server) authorizeConnection(ctx context.Context) error {
+	if s.authorizer == nil || s.authorizer.Connection == nil {
+		return nil
+	}
+	if err := s.authorizer.Connection(ctx, s.peer()); err != nil {
+		s.logger.Printf("Connection from %v refused: %v", s.peerAddr, err)
+		return fmt.Errorf("%w: connection refused: %v", ErrUnauthorized, err)
+	}
+	return nil
+}
+
+// authorizeMessage runs the Initialize or Message check of a message read from the client.
+// It returns false when the message was refused, and a fatal error wrapping ErrUnauthorized
+// when the connection must be closed.
+func (s *Server) authorizeMessage(ctx context.Context, msg any) (bool, error) {
+	if s.authorizer == nil {
+		return true, nil
+	}
+	var id json.RawMessage
+	var method string
+	var params json.RawMessage
+	switch m := msg.(type) {
+	case *jsonrpc2.RequestMessage:
+		id, method, params = m.ID, m.Method, m.Params
+	case *jsonrpc2.NotificationMessage:
+		method = m.Method
+	default:
+		return true, nil // Responses answer the requests of the server
+	}
+
+	if method == protocol.MethodInitialize && id != nil {
+		if s.authorizer.Initialize == nil {
+			return true, nil
+		}
+		var initParams protocol.InitializeParams
+		if err := s.conn.Codec().Unmarshal(params, &initParams); err != nil {
+			return true, nil // Answered with InvalidParams by the handler
+		}
+		if err := s.authorizer.Initialize(ctx, s.peer(), &initParams); err != nil {
+			s.logger.Printf("Initialize from %v refused: %v", s.peerAddr, err)
+			s.sendResponse(ctx, id, nil, protocol.NewInitializeError(jsonrpc2.RequestFailed, "unauthorized: "+err.Error(), false))
+			return false, fmt.Errorf("%w: initialize refused: %v", ErrUnauthorized, err)
+		}
+		s.authorizedInit.Store(&initParams)
+		return true, nil
+	}
+
+	if s.authorizer.Message == nil {
+		return true, nil
+	}
+	err := s.authorizer.Message(ctx, s.peer(), method)
+	if err == nil {
+		return true, nil
+	}
+	s.logger.Printf("Message %s from %v refused: %v", method, s.peerAddr, err)
+	if id != nil {
+		s.sendResponse(ctx, id, nil, jsonrpc2.NewError(jsonrpc2.RequestFailed, "unauthorized: "+err.Error()))
+	}
+	return false, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+func TestProbesWithoutAuthorizer(t *testing.T) {
+	_, c := startServer(t, nil, WithHealthRequest(), WithConfigurationSchema(nil, nil))
+	ctx := testContext(t)
+	for _, method := range []string{MethodHealth, MethodConfigurationSchema} {
+		if err := c.Call(ctx, method, nil, nil); err != nil {
+			t.Errorf("%s before initialize: %v", method, err)
+		}
+	}
+}
+
+func TestProbesNeedAuthorizedInitialize(t *testing.T) {
+	var mu sync.Mutex
+	var checked []string
+	authorizer := Authorizer{
+		Initialize: func(ctx context.Context, peer Peer, params *protocol.InitializeParams) error {
+			return nil
+		},
+		Message: func(ctx context.Context, peer Peer, method string) error {
+			mu.Lock()
+			defer mu.Unlock()
+			checked = append(checked, method)
+			return nil
+		},
+	}
+	_, c := startServer(t, nil, WithHealthRequest(), WithConfigurationSchema(nil, nil), WithAuthorizer(authorizer))
+	ctx := testContext(t)
+
+	for _, method := range []string{MethodHealth, MethodConfigurationSchema} {
+		err := c.Call(ctx, method, nil, nil)
+		var rpcErr *jsonrpc2.ErrorObject
+		if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.ServerNotInitialized {
+			t.Errorf("%s before initialize: got %v, want ServerNotInitialized", method, err)
+		}
+	}
+
+	if _, err := c.Initialize(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{MethodHealth, MethodConfigurationSchema} {
+		if err := c.Call(ctx, method, nil, nil); err != nil {
+			t.Errorf("%s after initialize: %v", method, err)
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(checked) < 4 {
+		t.Errorf("Message check ran for %v, want the probes included", checked)
+	}
+}
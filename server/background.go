@@ -0,0 +1,19 @@
+package server
+
+import "context"
+
+// BackgroundContext returns a context for work the server starts outside of a request,
+// such as debounced checks, asynchronous diagnostics or progress reporting.
+// Unlike context.Background, it is cancelled when the client asks the server to shut down,
+// when it exits, or when Run returns, so that such work does not outlive the connection.
+func (s *Server) BackgroundContext() context.Context {
+	return s.bgCtx
+}
+
+// stopBackground cancels the BackgroundContext, it is safe to call several times.
+func (s *Server) stopBackground(reason string) {
+	if s.bgCtx.Err() == nil {
+		s.logger.Printf("Cancelling background tasks: %s.", reason)
+	}
+	s.bgCancel()
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// progressKey is the context key of the Progress of a background command.
+type progressKey struct{}
+
+// ProgressFromContext returns the progress of the background command being run, see
+// RegisterBackgroundCommand. ok is false outside of one, and when the client can't display
+// progress: the command should then tell the user what it does some other way.
+func ProgressFromContext(ctx context.Context) (*Progress, bool) {
+	p, ok := ctx.Value(progressKey{}).(*Progress)
+	if !ok || p.noop {
+		return nil, false
+	}
+	return p, true
+}
+
+// RegisterBackgroundCommand registers a long running `workspace/executeCommand` command.
+// The request is answered null as soon as the command starts, so that the client doesn't
+// time out, and handlerFunc runs in the background under a cancellable work done progress
+// titled title. The progress uses a token created by the server: clients end the progress
+// of the workDoneToken of a request once it is answered.
+//
+// handlerFunc follows the signature rules of RegisterCommand. Its context is cancelled when
+// the user cancels the progress (with ErrProgressCancelled as cause) and when the server
+// shuts down, and the handler reports through ProgressFromContext. The outcome is sent with
+// the protocol.MethodCommandResult notification, and failures are also shown to the user.
+func (s *Server) RegisterBackgroundCommand(command, title string, handlerFunc any) error {
+	paramType, takesConn, takesParams, err := validateHandlerFunc(handlerFunc)
+	if err != nil {
+		return fmt.Errorf("invalid handler for command %s: %w", command, err)
+	}
+	handler := &typedHandler{
+		h:           handlerFunc,
+		paramType:   paramType,
+		takesConn:   takesConn,
+		takesParams: takesParams,
+	}
+	// Answers at once, the argument type is kept for the schema of the command
+	return s.addCommand(command, &typedHandler{
+		h:           handlerFunc,
+		paramType:   paramType,
+		takesParams: takesParams,
+		direct: func(ctx context.Context, _ jsonrpc2.Codec, args json.RawMessage) (any, error) {
+			s.pendingReqs.Add(1) // Waited for on exit like the requests
+			go func() {
+				defer s.pendingReqs.Done()
+				s.runBackgroundCommand(ctx, command, title, handler, args)
+			}()
+			return nil, nil
+		},
+	})
+}
+
+// MustRegisterBackgroundCommand is like RegisterBackgroundCommand but exits on error.
+func (s *Server) MustRegisterBackgroundCommand(command, title string, handlerFunc any) {
+	if err := s.RegisterBackgroundCommand(command, title, handlerFunc); err != nil {
+		s.logger.Fatalf("Failed to register handler for command %s: %v", command, err)
+	}
+}
+
+// runBackgroundCommand runs a command registered with RegisterBackgroundCommand, once its
+// request was answered, and sends its outcome.
+func (s *Server) runBackgroundCommand(reqCtx context.Context, command, title string, handler *typedHandler, args json.RawMessage) {
+	// The values of the request are kept (e.g. the snapshot), its lifetime and token aren't
+	ctx, cancel := context.WithCancel(context.WithoutCancel(reqCtx))
+	ctx = context.WithValue(ctx, workDoneTokenKey{}, nil)
+	defer cancel()
+	stop := context.AfterFunc(s.bgCtx, cancel)
+	defer stop()
+
+	p, err := s.StartProgress(ctx, nil, title, true)
+	if err != nil {
+		s.logger.Printf("Running command %s without progress: %v", command, err)
+		p = &Progress{s: s, noop: true, cancelled: make(chan struct{})}
+		p.ctx, p.cancel = context.WithCancelCause(ctx)
+	}
+	outcome := protocol.CommandResultParams{Command: command}
+	if !p.noop {
+		token := p.Token()
+		outcome.Token = &token
+	}
+
+	s.logger.Printf("Running command %s in the background", command)
+	result, err := handler.invoke(context.WithValue(p.Context(), progressKey{}, p), s.conn, args)
+
+	var endMessage string
+	switch {
+	case errors.Is(context.Cause(p.Context()), ErrProgressCancelled), err != nil && s.bgCtx.Err() != nil:
+		outcome.Cancelled = true
+		endMessage = "Cancelled"
+	case err != nil:
+		errObj, internal := s.toErrorObject(err)
+		if internal {
+			s.logger.Printf("Internal error in command %s: %v", command, err)
+		}
+		outcome.Error = errObj
+		endMessage = "Failed: " + errObj.Message
+	default:
+		if result != nil {
+			if outcome.Result, err = s.conn.Codec().Marshal(result); err != nil {
+				outcome.Error = jsonrpc2.NewError(jsonrpc2.InternalError, fmt.Sprintf("failed to marshal result: %v", err))
+				endMessage = "Failed: " + outcome.Error.Message
+			}
+		}
+	}
+	s.logger.Printf("Command %s finished (cancelled: %v, error: %v)", command, outcome.Cancelled, outcome.Error)
+
+	// The task context is over, the outcome is still sent unless the server stopped
+	sendCtx := s.bgCtx
+	if err := p.End(sendCtx, endMessage); err != nil {
+		s.logger.Printf("Failed to end the progress of command %s: %v", command, err)
+	}
+	if outcome.Error != nil {
+		if err := s.ShowMessage(sendCtx, protocol.Error, fmt.Sprintf("%s failed: %s", title, outcome.Error.Message)); err != nil {
+			s.logger.Printf("Failed to show the error of command %s: %v", command, err)
+		}
+	}
+	if err := s.Notify(sendCtx, protocol.MethodCommandResult, outcome); err != nil {
+		s.logger.Printf("Failed to send the result of command %s: %v", command, err)
+	}
+}
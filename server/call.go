@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+const (
+	// abandonedCallTTL is how long a call abandoned by its caller is remembered, its response
+	// arriving later is reported as late instead of unknown.
+	abandonedCallTTL = 5 * time.Minute
+	// maxAbandonedCalls bounds the abandoned calls remembered, the oldest are forgotten first.
+	maxAbandonedCalls = 1024
+)
+
+// LateResponse is a response from the client to a Call which returned before it arrived,
+// its context being done. It is dropped after being passed to the WithLateResponseHandler
+// handler, if any.
+type LateResponse struct {
+	Method   string
+	Response *jsonrpc2.ResponseMessage
+	// Elapsed is the time between the request and its response.
+	Elapsed time.Duration
+	// Cause is why the Call returned first: context.DeadlineExceeded when it timed out,
+	// context.Canceled when its caller gave up.
+	Cause error
+}
+
+// abandonedCall is a request whose Call returned without a response.
+type abandonedCall struct {
+	method string
+	sentAt time.Time
+	cause  error
+}
+
+// Call sends a request to the client and blocks until its response arrives or ctx is done.
+// The response result is decoded into result when result is non-nil.
+// A JSON-RPC error returned by the client is returned as a *jsonrpc2.ErrorObject.
+// When ctx is done first, e.g. its deadline or the WithCallTimeout one expired, the client
+// is sent $/cancelRequest and the error wraps ctx.Err(), its response is dropped.
+func (s *Server) Call(ctx context.Context, method string, params any, result any) error {
+	currentState := s.currentState()
+	if currentState != stateRunning {
+		return fmt.Errorf("cannot send request %s while server state is %d", method, currentState)
+	}
+	if s.readOnly && method == protocol.MethodWorkspaceApplyEdit {
+		return s.blockApplyEdit(method)
+	}
+	if _, ok := ctx.Deadline(); !ok && s.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.callTimeout)
+		defer cancel()
+	}
+
+	var rawParams json.RawMessage
+	if params != nil {
+		var err error
+		rawParams, err = s.conn.Codec().Marshal(params)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request params for %s: %w", method, err)
+		}
+	}
+
+	id := s.conn.NextID()
+	respCh := make(chan *jsonrpc2.ResponseMessage, 1)
+
+	s.pendingMu.Lock()
+	s.pendingCalls[string(id)] = respCh
+	s.pendingMu.Unlock()
+	defer func() {
+		s.pendingMu.Lock()
+		delete(s.pendingCalls, string(id))
+		s.pendingMu.Unlock()
+	}()
+
+	request := &jsonrpc2.RequestMessage{
+		JSONRPC: jsonrpc2.Version,
+		ID:      id,
+		Method:  method,
+		Params:  rawParams,
+	}
+	s.logger.Printf("<-- Request (to client): Method=%s, ID=%s", method, string(id))
+	sentAt := time.Now()
+	if err := s.conn.Write(ctx, request); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			// The write was interrupted, the rest of the request is still sent in the
+			// background: the client may answer it
+			cause := context.Canceled
+			if errors.Is(err, context.DeadlineExceeded) {
+				cause = context.DeadlineExceeded
+			}
+			s.abandonCall(id, method, sentAt, cause)
+		}
+		return fmt.Errorf("failed to write request %s: %w", method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		s.abandonCall(id, method, sentAt, ctx.Err())
+		return fmt.Errorf("request %s ID=%s to the client: %w after %s", method, string(id), ctx.Err(),
+			time.Since(sentAt).Round(time.Millisecond))
+	case resp := <-respCh:
+		s.logger.Printf("--> Response (from client): ID=%s", string(id))
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 && string(resp.Result) != "null" {
+			if err := s.conn.Codec().Unmarshal(resp.Result, result); err != nil {
+				return fmt.Errorf("failed to unmarshal result of %s: %w", method, err)
+			}
+		}
+		return nil
+	}
+}
+
+// handleResponse delivers a response from the client to the pending Call waiting for it.
+func (s *Server) handleResponse(resp *jsonrpc2.ResponseMessage) {
+	s.pendingMu.Lock()
+	respCh, found := s.pendingCalls[string(resp.ID)]
+	s.pendingMu.Unlock()
+
+	if !found {
+		if call, late := s.lateCall(resp.ID); late {
+			s.handleLateResponse(call, resp)
+			return
+		}
+		s.logger.Printf("Ignoring Response to unknown ID=%s: %s", string(resp.ID), s.unknownResponseReason(resp.ID))
+		return
+	}
+	select {
+	case respCh <- resp:
+	default:
+		// The channel holds a single response, anything else is a duplicate
+		s.logger.Printf("Received duplicate Response: ID=%s", string(resp.ID))
+	}
+}
+
+// unknownResponseReason explains why no Call waits for a response: either the request
+// was sent but its Call already returned, or the client answered an ID never sent. The
+// latter is only told apart when the ID generator knows the IDs it issued.
+func (s *Server) unknownResponseReason(id json.RawMessage) string {
+	issuer, ok := s.conn.IDGenerator().(interface{ Issued(json.RawMessage) bool })
+	if !ok {
+		return "no request is pending with this ID"
+	}
+	if !issuer.Issued(id) {
+		return "no request was sent with this ID"
+	}
+	return "the request was already answered, or its caller stopped waiting too long ago"
+}
+
+// abandonCall remembers a request whose caller stopped waiting, and asks the client to
+// cancel it. Its entry in pendingCalls is removed by Call as usual, so abandoned calls
+// don't grow the map: they are kept apart, bounded in number and age.
+func (s *Server) abandonCall(id json.RawMessage, method string, sentAt time.Time, cause error) {
+	s.pendingMu.Lock()
+	now := time.Now()
+	oldest := ""
+	for key, call := range s.abandonedCalls {
+		if now.Sub(call.sentAt) > abandonedCallTTL {
+			delete(s.abandonedCalls, key)
+		} else if oldest == "" || call.sentAt.Before(s.abandonedCalls[oldest].sentAt) {
+			oldest = key
+		}
+	}
+	if len(s.abandonedCalls) >= maxAbandonedCalls {
+		delete(s.abandonedCalls, oldest)
+	}
+	s.abandonedCalls[string(id)] = abandonedCall{method: method, sentAt: sentAt, cause: cause}
+	s.pendingMu.Unlock()
+
+	// Best effort, the client may have answered already. The caller's ctx is done.
+	if err := s.Notify(s.BackgroundContext(), protocol.MethodCancelRequest, protocol.CancelParams{ID: id}); err != nil {
+		s.logger.Printf("Failed to cancel request %s ID=%s: %v", method, string(id), err)
+	}
+}
+
+// lateCall returns and forgets the abandoned call a response answers, if any.
+func (s *Server) lateCall(id json.RawMessage) (abandonedCall, bool) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	call, ok := s.abandonedCalls[string(id)]
+	if ok {
+		delete(s.abandonedCalls, string(id))
+	}
+	return call, ok
+}
+
+// handleLateResponse counts and drops a response to an abandoned call, after passing it to
+// the late response handler.
+func (s *Server) handleLateResponse(call abandonedCall, resp *jsonrpc2.ResponseMessage) {
+	late := LateResponse{Method: call.method, Response: resp, Elapsed: time.Since(call.sentAt), Cause: call.cause}
+	s.stats.lateResponses.Add(1)
+	s.logger.Printf("Dropping late Response to %s ID=%s, received after %s", late.Method, string(resp.ID), late.Elapsed.Round(time.Millisecond))
+	if s.lateResponseHandler != nil {
+		s.lateResponseHandler(late)
+	}
+}
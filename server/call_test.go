@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// TestInterruptedCallWriteIsAbandoned checks a Call whose request write times out, the
+// request being still written in the background, treats the response of the client as
+// a late one.
+func TestInterruptedCallWriteIsAbandoned(t *testing.T) {
+	local, peer := net.Pipe()
+	late := make(chan LateResponse, 1)
+	s := NewServer(
+		WithStream(local),
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithLateResponseHandler(func(r LateResponse) { late <- r }),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		peer.Close()
+		local.Close()
+		<-done
+	})
+
+	stream := jsonrpc2.NewStream(peer)
+	if err := stream.WriteMessage(&jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: json.RawMessage(`1`), Method: "initialize", Params: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WriteMessage(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: "initialized", Params: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); s.currentState() != stateRunning; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server not running")
+		}
+	}
+
+	// The client reads nothing: the write of the request times out
+	callCtx, cancelCall := context.WithTimeout(testContext(t), 50*time.Millisecond)
+	defer cancelCall()
+	err := s.Call(callCtx, "test/slow", nil, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a deadline error", err)
+	}
+
+	// The request and its cancellation arrive, the client answers anyway
+	peer.SetReadDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+	var id json.RawMessage
+	for cancelled := false; id == nil || !cancelled; {
+		data, err := stream.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg struct {
+			ID     json.RawMessage
+			Method string
+		}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		switch msg.Method {
+		case "test/slow":
+			id = msg.ID
+		case "$/cancelRequest":
+			cancelled = true
+		}
+	}
+	if err := stream.WriteMessage(&jsonrpc2.ResponseMessage{JSONRPC: jsonrpc2.Version, ID: id, Result: json.RawMessage(`null`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case r := <-late:
+		if r.Method != "test/slow" || !errors.Is(r.Cause, context.DeadlineExceeded) {
+			t.Errorf("got a late response to %s caused by %v", r.Method, r.Cause)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the response was not handled as a late one")
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// dynamicProviders are the capabilities kept in sync with the handlers once the client is
+// initialized, see syncCapabilities: the method registering them dynamically and their
+// options in the server capabilities.
+var dynamicProviders = []struct {
+	method   string
+	document bool // Registered for the documents of the client side selector
+	options  func(caps *protocol.ServerCapabilities) (any, bool)
+}{
+	{protocol.MethodTextDocumentHover, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.HoverProvider, c.HoverProvider != nil
+	}},
+	{protocol.MethodTextDocumentCompletion, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.CompletionProvider, c.CompletionProvider != nil
+	}},
+	{protocol.MethodTextDocumentDefinition, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.DefinitionProvider, c.DefinitionProvider != nil
+	}},
+	{protocol.MethodTextDocumentDeclaration, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.DeclarationProvider, c.DeclarationProvider != nil
+	}},
+	{protocol.MethodTextDocumentTypeDefinition, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.TypeDefinitionProvider, c.TypeDefinitionProvider != nil
+	}},
+	{protocol.MethodTextDocumentImplementation, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.ImplementationProvider, c.ImplementationProvider != nil
+	}},
+	{protocol.MethodTextDocumentCodeAction, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.CodeActionProvider, c.CodeActionProvider != nil
+	}},
+	{protocol.MethodTextDocumentRename, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.RenameProvider, c.RenameProvider != nil
+	}},
+	{protocol.MethodTextDocumentFormatting, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.DocumentFormattingProvider, c.DocumentFormattingProvider != nil
+	}},
+	{protocol.MethodTextDocumentRangeFormatting, true, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.DocumentRangeFormattingProvider, c.DocumentRangeFormattingProvider != nil
+	}},
+	{protocol.MethodWorkspaceSymbol, false, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.WorkspaceSymbolProvider, c.WorkspaceSymbolProvider != nil
+	}},
+	{protocol.MethodWorkspaceExecuteCommand, false, func(c *protocol.ServerCapabilities) (any, bool) {
+		return c.ExecuteCommandProvider, c.ExecuteCommandProvider != nil
+	}},
+}
+
+// capabilitySync is the state of syncCapabilities.
+type capabilitySync struct {
+	mu         sync.Mutex // Serializes the syncs, they wait on the client
+	started    bool
+	advertised protocol.ServerCapabilities      // Sent in the initialize result
+	registered map[string]protocol.Registration // By method, registered by the sync
+	options    map[string]json.RawMessage       // Registration options, by method
+	warned     map[string]bool                  // Methods the client can't follow, logged once
+}
+
+// Unregister removes the handler of a method. Once the client is initialized, the
+// capability of the method is unregistered if the server registered it dynamically, see
+// syncCapabilities.
+func (s *Server) Unregister(method string) error {
+	s.mu.Lock()
+	if _, exists := s.handlers[method]; !exists {
+		s.mu.Unlock()
+		return fmt.Errorf("no handler registered for method: %s", method)
+	}
+	delete(s.handlers, method)
+	s.mu.Unlock()
+	s.logger.Printf("Unregistered handler for method: %s", method)
+	s.capabilitiesChanged()
+	return nil
+}
+
+// capabilitiesChanged syncs the capabilities in the background once the client is
+// initialized, the initialize result advertises the handlers registered before.
+func (s *Server) capabilitiesChanged() {
+	if s.currentState() != stateRunning {
+		return
+	}
+	go s.syncCapabilities(s.BackgroundContext())
+}
+
+// syncCapabilities keeps the client in sync with the handlers registered or unregistered
+// after initialization: it compares the capabilities the handlers now provide with the ones
+// advertised and registered so far, and registers or unregisters the difference with
+// client/registerCapability and client/unregisterCapability.
+//
+// Only the capabilities the client can register dynamically are synced. The ones
+// advertised in the initialize result can't be withdrawn, and the methods of
+// WithDynamicRegistration are left to the server.
+func (s *Server) syncCapabilities(ctx context.Context) {
+	cs := &s.capSync
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if !cs.started {
+		cs.started = true
+		if s.initResult != nil {
+			cs.advertised = s.initResult.Capabilities
+		}
+		cs.registered = make(map[string]protocol.Registration)
+		cs.options = make(map[string]json.RawMessage)
+		cs.warned = make(map[string]bool)
+	}
+
+	current := s.determineServerCapabilities()
+	clientCaps := s.ClientCapabilities()
+	var register []protocol.Registration
+	var unregister []protocol.Registration
+	for _, p := range dynamicProviders {
+		if slices.Contains(s.dynamicMethods, p.method) {
+			continue
+		}
+		options, provided := p.options(&current)
+		_, advertised := p.options(&cs.advertised)
+		previous, registered := cs.registered[p.method]
+
+		switch {
+		case advertised:
+			if !provided && !cs.warned[p.method] {
+				cs.warned[p.method] = true
+				s.logger.Printf("Capability of %s was advertised in the initialize result, it can't be withdrawn", p.method)
+			}
+			continue
+		case !provided:
+			if registered {
+				unregister = append(unregister, previous)
+			}
+			continue
+		}
+
+		raw, err := registrationOptions(options, p.document)
+		if err != nil {
+			s.logger.Printf("Can't register %s: %v", p.method, err)
+			continue
+		}
+		if registered && string(raw) == string(cs.options[p.method]) {
+			continue // Unchanged
+		}
+		if !clientCaps.SupportsDynamicRegistration(p.method) {
+			if !cs.warned[p.method] {
+				cs.warned[p.method] = true
+				s.logger.Printf("Client can't register %s dynamically, it is available after a restart", p.method)
+			}
+			continue
+		}
+		if registered {
+			unregister = append(unregister, previous) // Registered again with the new options
+		}
+		register = append(register, protocol.Registration{Method: p.method, RegisterOptions: raw})
+	}
+
+	if len(unregister) > 0 {
+		if err := s.UnregisterCapability(ctx, unregister...); err != nil {
+			s.logger.Printf("Failed to sync capabilities: %v", err)
+			return // Still registered, synced again on the next change
+		}
+		for _, r := range unregister {
+			delete(cs.registered, r.Method)
+			delete(cs.options, r.Method)
+		}
+	}
+	if len(register) > 0 {
+		registered, err := s.RegisterCapability(ctx, register...)
+		if err != nil {
+			s.logger.Printf("Failed to sync capabilities: %v", err)
+			return
+		}
+		for _, r := range registered {
+			cs.registered[r.Method] = r
+			cs.options[r.Method] = r.RegisterOptions.(json.RawMessage)
+		}
+	}
+	if len(register)+len(unregister) > 0 {
+		s.logger.Printf("Synced capabilities: %d registered, %d unregistered", len(register), len(unregister))
+	}
+}
+
+// registrationOptions returns the registration options of a capability, from its options in
+// the server capabilities. Those of a document capability apply to the documents of the
+// client side selector, the protocol requires the selector to be set to null for it.
+func registrationOptions(options any, document bool) (json.RawMessage, error) {
+	raw, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+	if !document {
+		return raw, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		fields = make(map[string]json.RawMessage)
+	}
+	fields["documentSelector"] = json.RawMessage("null")
+	return json.Marshal(fields)
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// CodeActionMode is how a code action carries the change it makes.
+type CodeActionMode int
+
+const (
+	// CodeActionInlineEdit returns the action with its Edit, the client applies it directly.
+	CodeActionInlineEdit CodeActionMode = iota
+	// CodeActionResolveEdit returns the action with Data but no Edit, the codeAction/resolve
+	// handler computes the Edit once the user picks the action.
+	CodeActionResolveEdit
+	// CodeActionCommand returns the action with a Command, the command handler computes the
+	// edit and sends it with workspace/applyEdit (see ApplyEdit).
+	CodeActionCommand
+)
+
+// CodeActionPreference is the server side choice between edits and commands, see WithCodeActionPreference.
+type CodeActionPreference int
+
+const (
+	// PreferCodeActionEdits returns edits when the client supports them, saving the
+	// executeCommand and applyEdit round trips.
+	PreferCodeActionEdits CodeActionPreference = iota
+	// PreferCodeActionCommands always returns commands, e.g. for servers which need to
+	// run code after the edit is applied.
+	PreferCodeActionCommands
+)
+
+// CodeActionMode chooses how code actions should carry their edits for the client, per the
+// server preference. expensive is true when computing the edit is costly (e.g. a model or
+// network call): such edits are only computed for the action the user picks, with
+// codeAction/resolve if the client and the server support it, with a command otherwise.
+func (s *Server) CodeActionMode(expensive bool) CodeActionMode {
+	caps := s.ClientCapabilities()
+	if s.codeActionPreference == PreferCodeActionCommands || !caps.SupportsCodeActionLiterals() {
+		return CodeActionCommand
+	}
+	if !expensive {
+		return CodeActionInlineEdit
+	}
+
+	s.mu.RLock()
+	_, resolver := s.handlers[protocol.MethodCodeActionResolve]
+	s.mu.RUnlock()
+	if resolver && caps.ResolvesCodeActionProperty("edit") {
+		return CodeActionResolveEdit
+	}
+	return CodeActionCommand
+}
+
+// DeclareCodeActionKinds declares the kinds of the code actions the server produces,
+// advertised in the codeActionProvider capability. Clients use them to group actions and to
+// only request the ones they show, e.g. "source.organizeImports" on save. Kinds are validated
+// and may be custom sub-kinds like "quickfix.spelling". It must be called before initialize.
+func (s *Server) DeclareCodeActionKinds(kinds ...protocol.CodeActionKind) error {
+	for _, kind := range kinds {
+		if err := kind.Validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, kind := range kinds {
+		if !slices.Contains(s.codeActionKinds, kind) {
+			s.codeActionKinds = append(s.codeActionKinds, kind)
+		}
+	}
+	slices.Sort(s.codeActionKinds)
+	return nil
+}
+
+// VerifyActionData decodes the data of a code action encoded with protocol.NewActionData,
+// at resolve or execute time, and checks it against the document store. It returns the
+// current snapshot of the document, or a ContentModified error when the document changed or
+// was closed since the action was listed.
+func VerifyActionData[T any](s *Server, data json.RawMessage) (protocol.ActionData[T], *textdocument.Snapshot, error) {
+	d, err := protocol.DecodeActionData[T](data)
+	if err != nil {
+		return d, nil, err
+	}
+	snapshot, ok := s.documents.Get(d.URI)
+	if !ok {
+		return d, nil, jsonrpc2.NewError(jsonrpc2.ContentModified, fmt.Sprintf("%s was closed since the action was offered", d.URI))
+	}
+	doc := protocol.TextDocumentItem{URI: snapshot.URI, LanguageID: snapshot.LanguageID, Version: snapshot.Version, Text: snapshot.Text}
+	if err := d.Verify(doc); err != nil {
+		return d, nil, err
+	}
+	return d, snapshot, nil
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/jsonschema"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ExperimentalCommandSchemas is the experimental capability key under which
+// the JSON schemas of registered command arguments are advertised.
+const ExperimentalCommandSchemas = "commandSchemas"
+
+// RegisterCommand associates a handler with a `workspace/executeCommand` command identifier.
+// The handler follows the same signature rules as Register: the params argument receives
+// the first element of the command arguments, decoded into the handler's param type.
+// Example: func(ctx context.Context, conn *jsonrpc2.Conn, args *MyArgs) (any, error)
+//
+// Registered commands are listed in the executeCommand capability, and the JSON schema
+// of their argument type is published under the experimental "commandSchemas" capability.
+func (s *Server) RegisterCommand(command string, handlerFunc any) error {
+	paramType, takesConn, takesParams, err := validateHandlerFunc(handlerFunc)
+	if err != nil {
+		return fmt.Errorf("invalid handler for command %s: %w", command, err)
+	}
+	return s.addCommand(command, &typedHandler{
+		h:           handlerFunc,
+		paramType:   paramType,
+		takesConn:   takesConn,
+		takesParams: takesParams,
+	})
+}
+
+// addCommand adds the handler of a command to the registry.
+func (s *Server) addCommand(command string, handler *typedHandler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.commands[command]; exists {
+		return fmt.Errorf("handler already registered for command: %s", command)
+	}
+
+	// The first command routes workspace/executeCommand through the registry
+	if len(s.commands) == 0 {
+		if _, exists := s.handlers[protocol.MethodWorkspaceExecuteCommand]; exists {
+			return fmt.Errorf("cannot register command %s: a handler is already registered for %s",
+				command, protocol.MethodWorkspaceExecuteCommand)
+		}
+		paramType, takesConn, takesParams, _ := validateHandlerFunc(s.handleExecuteCommand)
+		s.handlers[protocol.MethodWorkspaceExecuteCommand] = &typedHandler{
+			h:           s.handleExecuteCommand,
+			paramType:   paramType,
+			takesConn:   takesConn,
+			takesParams: takesParams,
+		}
+	}
+
+	s.commands[command] = handler
+	s.logger.Printf("Registered handler for command: %s (takesConn: %v, takesParams: %v, paramType: %v)",
+		command, handler.takesConn, handler.takesParams, handler.paramType)
+	s.capabilitiesChanged() // The executeCommand capability lists the command, synced once s.mu is released
+	return nil
+}
+
+// MustRegisterCommand is like RegisterCommand but exits on error.
+func (s *Server) MustRegisterCommand(command string, handlerFunc any) {
+	if err := s.RegisterCommand(command, handlerFunc); err != nil {
+		s.logger.Fatalf("Failed to register handler for command %s: %v", command, err)
+	}
+}
+
+// handleExecuteCommand dispatches workspace/executeCommand to the registered command handler.
+func (s *Server) handleExecuteCommand(ctx context.Context, conn *jsonrpc2.Conn, params *protocol.ExecuteCommandParams) (any, error) {
+	s.mu.RLock()
+	handler, found := s.commands[params.Command]
+	s.mu.RUnlock()
+
+	if !found {
+		return nil, jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf("unknown command: %s", params.Command))
+	}
+	if len(params.Arguments) > 1 {
+		return nil, jsonrpc2.NewError(jsonrpc2.InvalidParams,
+			fmt.Sprintf("expected at most 1 argument for command %s, got %d", params.Command, len(params.Arguments)))
+	}
+
+	var args json.RawMessage
+	if len(params.Arguments) == 1 {
+		args = params.Arguments[0]
+	}
+	// Command handlers only see their arguments, the client token is in ctx, see withProgressTokens
+	return handler.invoke(ctx, conn, args)
+}
+
+// commandNames returns the sorted list of registered commands.
+// Caller must hold s.mu.
+func (s *Server) commandNames() []string {
+	names := make([]string, 0, len(s.commands))
+	for name := range s.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commandSchemas returns the argument schemas of the registered commands taking arguments.
+// Caller must hold s.mu.
+func (s *Server) commandSchemas() map[string]*jsonschema.Schema {
+	schemas := make(map[string]*jsonschema.Schema)
+	for name, handler := range s.commands {
+		if !handler.takesParams || handler.paramType == nil {
+			continue
+		}
+		schema := jsonschema.Reflect(handler.paramType)
+		schema.Title = name
+		schemas[name] = schema
+	}
+	return schemas
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// TestCommandsRegisteredAfterInitialize checks the commands registered once the client is
+// initialized are registered with it, like the handlers of other methods.
+func TestCommandsRegisteredAfterInitialize(t *testing.T) {
+	s, c := startServer(t, nil)
+	registrations := make(chan protocol.Registration, 10)
+	c.OnRequest(protocol.MethodClientRegisterCapability, func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p protocol.RegistrationParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		for _, r := range p.Registrations {
+			registrations <- r
+		}
+		return nil, nil
+	})
+	ctx := testContext(t)
+	_, err := c.Initialize(ctx, &protocol.InitializeParams{
+		Capabilities: protocol.ClientCapabilities{
+			Workspace: &protocol.WorkspaceClientCapabilities{
+				ExecuteCommand: &protocol.DynamicRegistrationCapabilities{DynamicRegistration: true},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Running once initialized is handled
+	for deadline := time.Now().Add(5 * time.Second); s.currentState() != stateRunning; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("server not running")
+		}
+	}
+
+	command := func(ctx context.Context) (any, error) { return nil, nil }
+	for _, name := range []string{"a.first", "a.second"} {
+		if err := s.RegisterCommand(name, command); err != nil {
+			t.Fatal(err)
+		}
+		// Each command syncs the capability, the last registration lists all commands so far
+		var got []string
+		for !slices.Contains(got, name) {
+			select {
+			case r := <-registrations:
+				if r.Method != protocol.MethodWorkspaceExecuteCommand {
+					t.Fatalf("got a registration of %s", r.Method)
+				}
+				raw, _ := json.Marshal(r.RegisterOptions)
+				var options protocol.ExecuteCommandOptions
+				if err := json.Unmarshal(raw, &options); err != nil {
+					t.Fatal(err)
+				}
+				got = options.Commands
+			case <-ctx.Done():
+				t.Fatalf("%s not registered with the client", name)
+			}
+		}
+	}
+}
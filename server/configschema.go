@@ -0,0 +1,35 @@
+package server
+
+import (
+	"context"
+
+	"github.com/akhenakh/lspgo/jsonschema"
+)
+
+// MethodConfigurationSchema is the custom request answered with the ConfigurationSchema of
+// the server, set with WithConfigurationSchema.
+const MethodConfigurationSchema = "$/lspgo/configurationSchema"
+
+// ExperimentalConfigurationSchema is the experimental capability key under which the
+// ConfigurationSchema of the server is advertised.
+const ExperimentalConfigurationSchema = "configurationSchema"
+
+// ConfigurationSchema describes what a server can be configured with, so that editor plugins
+// can generate their settings UI and validate the user settings.
+type ConfigurationSchema struct {
+	// InitializationOptions is the schema of the initializationOptions of initialize.
+	InitializationOptions *jsonschema.Schema `json:"initializationOptions,omitempty"`
+	// Settings is the schema of the settings sent with workspace/didChangeConfiguration,
+	// and of the workspace/configuration items.
+	Settings *jsonschema.Schema `json:"settings,omitempty"`
+}
+
+// ConfigurationSchema returns the schema set with WithConfigurationSchema, nil without one.
+func (s *Server) ConfigurationSchema() *ConfigurationSchema {
+	return s.configSchema
+}
+
+// handleConfigurationSchema answers MethodConfigurationSchema.
+func (s *Server) handleConfigurationSchema(ctx context.Context) (*ConfigurationSchema, error) {
+	return s.configSchema, nil
+}
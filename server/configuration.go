@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrConfigurationUnsupported is returned by Configuration when the client can't be asked
+// for settings, the server only gets the ones pushed with workspace/didChangeConfiguration.
+var ErrConfigurationUnsupported = errors.New("client does not support workspace/configuration")
+
+// Configuration pulls the settings section (dotted, e.g. "regexlint") for scope, which may
+// be nil, with workspace/configuration and decodes it into v. It returns false when the
+// client has no such settings. The section is decoded like the pushed one with
+// protocol.DidChangeConfigurationParams.Section, so both can share the settings type.
+func (s *Server) Configuration(ctx context.Context, scope *protocol.DocumentURI, section string, v any) (bool, error) {
+	if !s.ClientCapabilities().SupportsConfiguration() {
+		return false, ErrConfigurationUnsupported
+	}
+	params := protocol.ConfigurationParams{Items: []protocol.ConfigurationItem{{ScopeURI: scope, Section: section}}}
+	var values []json.RawMessage
+	if err := s.Call(ctx, protocol.MethodWorkspaceConfiguration, params, &values); err != nil {
+		return false, err
+	}
+	if len(values) != 1 {
+		return false, fmt.Errorf("expected 1 configuration value for %q, got %d", section, len(values))
+	}
+	// The value is the section itself
+	return protocol.DecodeSettingsSection(values[0], "", v)
+}
+
+// FolderSettings are the settings of a section for each workspace folder, in multi-root
+// workspaces where each folder has its own (e.g. .vscode/settings.json). They are pulled
+// with workspace/configuration scoped to the folder (scopeUri) on first use, and cached
+// until the settings change or the folder is removed.
+type FolderSettings[T any] struct {
+	s        *Server
+	section  string
+	defaults T
+
+	mu     sync.Mutex
+	values map[protocol.DocumentURI]T // By canonical folder URI, "" outside of the folders
+	// generation is incremented when cached values are dropped, settings pulled meanwhile
+	// may be the old ones and are not cached
+	generation uint64
+}
+
+// NewFolderSettings creates the per folder settings of section. defaults is the value the
+// pulled settings are decoded over: missing fields keep their default, and it is the
+// value of the folders when the client has no settings or can't be asked.
+func NewFolderSettings[T any](s *Server, section string, defaults T) *FolderSettings[T] {
+	f := &FolderSettings[T]{s: s, section: section, defaults: defaults, values: make(map[protocol.DocumentURI]T)}
+	s.OnConfigurationChanged(func(context.Context, *protocol.DidChangeConfigurationParams) {
+		f.Invalidate()
+	})
+	s.OnWorkspaceFoldersChanged(func(_ context.Context, event protocol.WorkspaceFoldersChangeEvent) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, folder := range event.Removed {
+			delete(f.values, protocol.DocumentURI(folder.URI).Canonical())
+		}
+		f.generation++
+	})
+	return f
+}
+
+// For returns the settings of the folder of a document, see Server.FolderOf. Documents
+// outside of the workspace folders get the settings scoped to nothing, the user ones.
+// On error the defaults are returned with it, and the settings are pulled again next time.
+func (f *FolderSettings[T]) For(ctx context.Context, uri protocol.DocumentURI) (T, error) {
+	var scope *protocol.DocumentURI
+	var key protocol.DocumentURI
+	if folder, ok := f.s.FolderOf(uri); ok {
+		folderURI := protocol.DocumentURI(folder.URI)
+		scope, key = &folderURI, folderURI.Canonical()
+	}
+
+	f.mu.Lock()
+	value, cached := f.values[key]
+	generation := f.generation
+	f.mu.Unlock()
+	if cached {
+		return value, nil
+	}
+
+	// Decoded over a copy of the defaults, pointers and maps are shared with them
+	value = f.defaults
+	if _, err := f.s.Configuration(ctx, scope, f.section, &value); err != nil {
+		if !errors.Is(err, ErrConfigurationUnsupported) {
+			return f.defaults, err
+		}
+	}
+	f.mu.Lock()
+	if f.generation == generation {
+		f.values[key] = value
+	}
+	f.mu.Unlock()
+	return value, nil
+}
+
+// Invalidate drops the cached settings, they are pulled again on next use. It is called
+// when the client pushes new settings.
+func (f *FolderSettings[T]) Invalidate() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clear(f.values)
+	f.generation++
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Debouncer runs work per key once triggers stop for a delay, e.g. checking a document once
+// the user stops typing. Runs are latest-wins and never overlap for a key: a trigger
+// cancels the context of the run in progress, which is stale, and the next run starts once
+// it returned. It is safe for concurrent use.
+type Debouncer[K comparable] struct {
+	ctx   context.Context
+	delay time.Duration
+
+	mu   sync.Mutex
+	keys map[K]*debounced
+}
+
+// debounced is the state of a key of a Debouncer.
+type debounced struct {
+	gen     uint64                    // Incremented by each trigger, older timers are ignored
+	fn      func(ctx context.Context) // Latest function triggered, nil once started
+	due     bool                      // The delay expired while a run was in progress
+	running bool
+	cancel  context.CancelFunc // Cancels the run in progress
+	timer   *time.Timer
+}
+
+// NewDebouncer creates a debouncer waiting for delay. Runs get a context derived from ctx,
+// typically the server BackgroundContext so that they stop on shutdown.
+func NewDebouncer[K comparable](ctx context.Context, delay time.Duration) *Debouncer[K] {
+	return &Debouncer[K]{ctx: ctx, delay: delay, keys: make(map[K]*debounced)}
+}
+
+// Trigger runs fn for key after the delay, unless triggered again meanwhile: only the
+// latest fn runs. The run in progress for key, if any, is cancelled now.
+func (d *Debouncer[K]) Trigger(key K, fn func(ctx context.Context)) {
+	d.trigger(key, fn, d.delay)
+}
+
+// TriggerNow is Trigger without delay, e.g. to check a document as soon as it is opened.
+// It still waits for the cancelled run of key to return.
+func (d *Debouncer[K]) TriggerNow(key K, fn func(ctx context.Context)) {
+	d.trigger(key, fn, 0)
+}
+
+func (d *Debouncer[K]) trigger(key K, fn func(ctx context.Context), delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k, ok := d.keys[key]
+	if !ok {
+		k = &debounced{}
+		d.keys[key] = k
+	}
+	k.gen++
+	k.fn = fn
+	k.due = false
+	if k.cancel != nil {
+		k.cancel()
+	}
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+	gen := k.gen
+	k.timer = time.AfterFunc(delay, func() { d.fire(key, k, gen) })
+}
+
+// Cancel drops the pending run of key and cancels the one in progress, e.g. when the
+// document is closed.
+func (d *Debouncer[K]) Cancel(key K) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	k, ok := d.keys[key]
+	if !ok {
+		return
+	}
+	k.gen++
+	k.fn = nil
+	k.due = false
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+	if k.cancel != nil {
+		k.cancel()
+	}
+	if !k.running {
+		delete(d.keys, key)
+	}
+}
+
+// fire starts the run of key when its delay expired, or marks it due when the previous run
+// has not returned yet.
+func (d *Debouncer[K]) fire(key K, k *debounced, gen uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if k.gen != gen || k.fn == nil || d.keys[key] != k {
+		return // Triggered again or cancelled meanwhile
+	}
+	if k.running {
+		k.due = true
+		return
+	}
+	d.start(key, k)
+}
+
+// start runs the latest function of key, d.mu is held.
+func (d *Debouncer[K]) start(key K, k *debounced) {
+	if d.ctx.Err() != nil {
+		delete(d.keys, key) // Shutting down, don't start anything
+		return
+	}
+	fn := k.fn
+	k.fn = nil
+	k.running = true
+	ctx, cancel := context.WithCancel(d.ctx)
+	k.cancel = cancel
+	go func() {
+		defer cancel()
+		fn(ctx)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		k.running = false
+		k.cancel = nil
+		switch {
+		case k.due && k.fn != nil:
+			k.due = false
+			d.start(key, k)
+		case k.fn == nil && d.keys[key] == k:
+			delete(d.keys, key) // Nothing pending
+		}
+	}()
+}
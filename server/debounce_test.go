@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitKeys waits for the debouncer to forget all its keys, once nothing is pending.
+func waitKeys[K comparable](t *testing.T, d *Debouncer[K]) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		d.mu.Lock()
+		n := len(d.keys)
+		d.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d keys left", n)
+		}
+	}
+}
+
+func TestDebouncerLatestWins(t *testing.T) {
+	d := NewDebouncer[string](context.Background(), 20*time.Millisecond)
+	ran := make(chan int, 3)
+	for i := range 3 {
+		d.Trigger("a", func(ctx context.Context) { ran <- i })
+	}
+	if got := <-ran; got != 2 {
+		t.Errorf("run %d, want only the latest trigger", got)
+	}
+	waitKeys(t, d)
+	if len(ran) != 0 {
+		t.Errorf("%d more runs", len(ran))
+	}
+}
+
+// TestDebouncerRunsDontOverlap checks a trigger cancels the run in progress, and the next
+// run starts once it returned, even when it ignores the cancellation for a while.
+func TestDebouncerRunsDontOverlap(t *testing.T) {
+	d := NewDebouncer[string](context.Background(), 0)
+	var running, overlaps atomic.Int32
+	release := make(chan struct{})
+	cancelled := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan struct{})
+	d.TriggerNow("a", func(ctx context.Context) {
+		defer running.Add(-1)
+		running.Add(1)
+		close(started)
+		<-ctx.Done()
+		close(cancelled)
+		<-release
+	})
+	<-started
+	d.TriggerNow("a", func(ctx context.Context) {
+		if running.Add(1) > 1 {
+			overlaps.Add(1)
+		}
+		running.Add(-1)
+		close(done)
+	})
+	<-cancelled
+	select {
+	case <-done:
+		t.Fatal("second run started before the cancelled one returned")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	if overlaps.Load() != 0 {
+		t.Error("runs overlapped")
+	}
+	waitKeys(t, d)
+}
+
+// TestDebouncerDueRestarts checks a run whose delay expired while the previous one was in
+// progress starts as soon as it returned.
+func TestDebouncerDueRestarts(t *testing.T) {
+	d := NewDebouncer[string](context.Background(), 5*time.Millisecond)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.TriggerNow("a", func(ctx context.Context) {
+		close(started)
+		<-release // Ignoring the cancellation
+	})
+	<-started
+	ran := make(chan struct{})
+	d.Trigger("a", func(ctx context.Context) { close(ran) })
+
+	// Wait for the delay to expire, the run is then due
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		d.mu.Lock()
+		due := d.keys["a"].due
+		d.mu.Unlock()
+		if due {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("run never due")
+		}
+	}
+	select {
+	case <-ran:
+		t.Fatal("due run started before the previous one returned")
+	default:
+	}
+	close(release)
+	select {
+	case <-ran:
+	case <-time.After(5 * time.Second):
+		t.Fatal("due run not started once the previous one returned")
+	}
+	waitKeys(t, d)
+}
+
+func TestDebouncerCancelInProgress(t *testing.T) {
+	d := NewDebouncer[string](context.Background(), 0)
+	started := make(chan struct{})
+	returned := make(chan struct{})
+	d.TriggerNow("a", func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		close(returned)
+	})
+	<-started
+	ran := make(chan struct{}, 1)
+	d.Trigger("a", func(ctx context.Context) { ran <- struct{}{} }) // Pending, dropped by Cancel
+	d.Cancel("a")
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run in progress not cancelled")
+	}
+	waitKeys(t, d)
+	if len(ran) != 0 {
+		t.Error("pending run started after Cancel")
+	}
+}
+
+// TestDebouncerStopsWithContext checks nothing starts once the context of the debouncer is
+// done, e.g. after the server shut down.
+func TestDebouncerStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := NewDebouncer[string](ctx, 5*time.Millisecond)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	d.TriggerNow("a", func(ctx context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+	ran := make(chan struct{}, 2)
+	d.Trigger("a", func(ctx context.Context) { ran <- struct{}{} }) // Due once its delay expired
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	close(release)
+	d.TriggerNow("b", func(ctx context.Context) { ran <- struct{}{} })
+	waitKeys(t, d)
+	time.Sleep(20 * time.Millisecond) // Let a wrongly started run report
+	if len(ran) != 0 {
+		t.Errorf("%d runs started after the context was done", len(ran))
+	}
+}
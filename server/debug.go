@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// expvarStatsName is the variable holding the Stats of the server in its /debug/vars.
+const expvarStatsName = "lspgo"
+
+// debugMux returns the handler served by the debug listener:
+//
+//	/debug/pprof/        runtime profiles
+//	/debug/vars          expvar counters, with the Stats of this server as "lspgo"
+//	/debug/lspgo/stats   the Stats snapshot of this server
+//	/debug/lspgo/health  the Health of this server
+func (s *Server) debugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/vars", s.serveVars)
+	mux.HandleFunc("/debug/lspgo/stats", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Stats()); err != nil {
+			s.logger.Printf("Error writing debug stats: %v", err)
+		}
+	})
+	mux.HandleFunc("/debug/lspgo/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(s.Health()); err != nil {
+			s.logger.Printf("Error writing debug health: %v", err)
+		}
+	})
+	return mux
+}
+
+// startDebugListener serves the debug endpoints on addr until ctx is done.
+func (s *Server) startDebugListener(ctx context.Context, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Handler:           s.debugMux(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx) //nolint:errcheck
+	}()
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Printf("Debug listener stopped: %v", err)
+		}
+	}()
+
+	s.logger.Printf("Debug listener serving on http://%s/debug/", ln.Addr())
+	return nil
+}
+
+// serveVars serves the expvar variables of the process like expvar.Handler, adding the Stats
+// of this server. They are not published in the process wide expvar registry, where each
+// server of the process would need its own name and would never be released.
+func (s *Server) serveVars(w http.ResponseWriter, r *http.Request) {
+	stats, err := json.Marshal(s.Stats())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, "{\n%q: %s", expvarStatsName, stats)
+	expvar.Do(func(kv expvar.KeyValue) {
+		if kv.Key != expvarStatsName {
+			fmt.Fprintf(w, ",\n%q: %s", kv.Key, kv.Value)
+		}
+	})
+	fmt.Fprintf(w, "\n}\n")
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestDebugVarsPerServer checks each server serves its own Stats in /debug/vars, next to the
+// process wide expvar variables.
+func TestDebugVarsPerServer(t *testing.T) {
+	busy, c := startServer(t, nil)
+	if _, err := c.Initialize(testContext(t), nil); err != nil {
+		t.Fatal(err)
+	}
+	idle, _ := startServer(t, nil)
+
+	vars := func(s *Server) map[string]json.RawMessage {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		s.debugMux().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+		var got map[string]json.RawMessage
+		if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+			t.Fatalf("invalid /debug/vars: %v\n%s", err, rec.Body)
+		}
+		return got
+	}
+	for _, tt := range []struct {
+		name        string
+		server      *Server
+		initialized bool
+	}{{"busy", busy, true}, {"idle", idle, false}} {
+		got := vars(tt.server)
+		if got["memstats"] == nil {
+			t.Errorf("%s: process variables missing", tt.name)
+		}
+		var stats Stats
+		if err := json.Unmarshal(got[expvarStatsName], &stats); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if _, ok := stats.Requests["initialize"]; ok != tt.initialized {
+			t.Errorf("%s: initialize counted %v, want %v", tt.name, ok, tt.initialized)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// DiagnosticsManager keeps track of the diagnostics published for each document.
+// Publishing always replaces the whole set of a document, as the protocol expects,
+// and the last published set can be queried back, e.g. to build quick fixes
+// in a textDocument/codeAction handler without recomputing anything.
+// It is safe for concurrent use.
+type DiagnosticsManager struct {
+	s *Server
+
+	mu        sync.Mutex
+	published map[protocol.DocumentURI]publishedDiagnostics
+}
+
+type publishedDiagnostics struct {
+	version     *int
+	diagnostics []protocol.Diagnostic
+}
+
+func newDiagnosticsManager(s *Server) *DiagnosticsManager {
+	return &DiagnosticsManager{
+		s:         s,
+		published: make(map[protocol.DocumentURI]publishedDiagnostics),
+	}
+}
+
+// Diagnostics returns the diagnostics manager of the server.
+func (s *Server) Diagnostics() *DiagnosticsManager {
+	return s.diagnostics
+}
+
+// Publish replaces the diagnostics of a document and sends them to the client.
+// version is the document version the diagnostics were computed for, it may be nil.
+// Results computed for an older version than the last published one are stale
+// (an analysis finished after a newer one) and are dropped.
+func (m *DiagnosticsManager) Publish(ctx context.Context, uri protocol.DocumentURI, version *int, diagnostics []protocol.Diagnostic) error {
+	if diagnostics == nil {
+		diagnostics = []protocol.Diagnostic{} // Must be sent as an empty array, not null
+	}
+
+	// Notify under the lock so concurrent publications reach the client in the stored order
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if prev, ok := m.published[uri]; ok && version != nil && prev.version != nil && *version < *prev.version {
+		m.s.logger.Printf("Dropping stale diagnostics for %s (version %d, published %d)", uri, *version, *prev.version)
+		return nil
+	}
+	m.published[uri] = publishedDiagnostics{version: version, diagnostics: slices.Clone(diagnostics)}
+
+	return m.s.Notify(ctx, protocol.MethodTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+		URI:         uri,
+		Version:     version,
+		Diagnostics: m.normalize(diagnostics),
+	})
+}
+
+// normalize adapts diagnostics to the client capabilities before they are sent: the tags
+// the client does not support are stripped. The diagnostics kept for Get and InRange are
+// left untouched.
+func (m *DiagnosticsManager) normalize(diagnostics []protocol.Diagnostic) []protocol.Diagnostic {
+	caps := m.s.ClientCapabilities()
+	normalized, copied := diagnostics, false
+	for i, d := range diagnostics {
+		if len(d.Tags) == 0 {
+			continue
+		}
+		tags := slices.DeleteFunc(slices.Clone(d.Tags), func(tag protocol.DiagnosticTag) bool {
+			return !caps.SupportsDiagnosticTag(tag)
+		})
+		if len(tags) == len(d.Tags) {
+			continue
+		}
+		if !copied {
+			normalized, copied = slices.Clone(diagnostics), true // The caller owns diagnostics
+		}
+		normalized[i].Tags = tags
+	}
+	return normalized
+}
+
+// Clear removes the diagnostics of a document from the client and forgets them,
+// typically when the document is closed.
+func (m *DiagnosticsManager) Clear(ctx context.Context, uri protocol.DocumentURI) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.published[uri]; !ok {
+		return nil // Nothing was published, nothing to clear
+	}
+	delete(m.published, uri)
+
+	return m.s.Notify(ctx, protocol.MethodTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: []protocol.Diagnostic{},
+	})
+}
+
+// Get returns the diagnostics last published for a document.
+func (m *DiagnosticsManager) Get(uri protocol.DocumentURI) []protocol.Diagnostic {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.published[uri].diagnostics)
+}
+
+// InRange returns the diagnostics last published for a document overlapping rng,
+// an empty rng selects the diagnostics containing that position.
+func (m *DiagnosticsManager) InRange(uri protocol.DocumentURI, rng protocol.Range) []protocol.Diagnostic {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []protocol.Diagnostic
+	for _, d := range m.published[uri].diagnostics {
+		if rangesOverlap(d.Range, rng) {
+			found = append(found, d)
+		}
+	}
+	return found
+}
+
+// URIs returns the documents having published diagnostics.
+func (m *DiagnosticsManager) URIs() []protocol.DocumentURI {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	uris := make([]protocol.DocumentURI, 0, len(m.published))
+	for uri := range m.published {
+		uris = append(uris, uri)
+	}
+	slices.Sort(uris)
+	return uris
+}
+
+// rangesOverlap reports whether a and b share at least one position, ends included
+// so a cursor touching the end of a diagnostic still selects it.
+func rangesOverlap(a, b protocol.Range) bool {
+	return !positionLess(a.End, b.Start) && !positionLess(b.End, a.Start)
+}
+
+func positionLess(a, b protocol.Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Character < b.Character
+}
@@ -0,0 +1,188 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// Documents returns the store of the documents opened by the client.
+// The server keeps it up to date, whether or not handlers are registered for
+// the text synchronization notifications.
+func (s *Server) Documents() *textdocument.Store {
+	return s.documents
+}
+
+// trackDocument updates the document store from a text synchronization notification and
+// returns the URI of its document, empty for other messages. It runs in the read loop,
+// before messages are dispatched concurrently, so that changes are applied in the order the
+// client sent them.
+func (s *Server) trackDocument(msg any) protocol.DocumentURI {
+	n, ok := msg.(*jsonrpc2.NotificationMessage)
+	if !ok || s.currentState() == stateShutdown {
+		return ""
+	}
+
+	switch n.Method {
+	case protocol.MethodTextDocumentDidOpen:
+		var params protocol.DidOpenTextDocumentParams
+		if err := s.conn.Codec().Unmarshal(n.Params, &params); err != nil {
+			s.logger.Printf("Document store: invalid %s params: %v", n.Method, err)
+			return ""
+		}
+		s.documentChanged(params.TextDocument.URI, s.documents.Open(params.TextDocument))
+		return params.TextDocument.URI
+	case protocol.MethodTextDocumentDidChange:
+		var params protocol.DidChangeTextDocumentParams
+		if err := s.conn.Codec().Unmarshal(n.Params, &params); err != nil {
+			s.logger.Printf("Document store: invalid %s params: %v", n.Method, err)
+			return ""
+		}
+		snapshot, err := s.documents.Change(&params)
+		if err != nil {
+			s.logger.Printf("Document store: %v", err)
+		} else {
+			s.documentChanged(params.TextDocument.URI, snapshot)
+		}
+		return params.TextDocument.URI
+	case protocol.MethodTextDocumentDidSave:
+		var params protocol.DidSaveTextDocumentParams
+		if err := s.conn.Codec().Unmarshal(n.Params, &params); err != nil {
+			s.logger.Printf("Document store: invalid %s params: %v", n.Method, err)
+			return ""
+		}
+		snapshot, changed, err := s.documents.Save(&params)
+		if err != nil {
+			s.logger.Printf("Document store: %v", err)
+		} else if changed {
+			s.logger.Printf("Document store: %s differed from the saved text, resynced", params.TextDocument.URI)
+			s.documentChanged(params.TextDocument.URI, snapshot)
+		}
+		return params.TextDocument.URI
+	case protocol.MethodTextDocumentDidClose:
+		var params protocol.DidCloseTextDocumentParams
+		if err := s.conn.Codec().Unmarshal(n.Params, &params); err != nil {
+			s.logger.Printf("Document store: invalid %s params: %v", n.Method, err)
+			return ""
+		}
+		s.documents.Close(params.TextDocument.URI)
+		s.documentChanged(params.TextDocument.URI, nil)
+		return params.TextDocument.URI
+	}
+	return ""
+}
+
+// DocumentHook is called with the new snapshot of a document opened, changed, or saved with
+// a text differing from the store, and with a nil snapshot once it is closed. Hooks run in
+// the read loop, in the order of the notifications: they must return quickly, starting the
+// work they trigger in the background.
+type DocumentHook func(uri protocol.DocumentURI, snapshot *textdocument.Snapshot)
+
+// OnDocumentChanged adds a hook called for each change of the document store, before the
+// handler registered for the notification, if any, e.g. to analyze documents without
+// registering the text synchronization handlers (see the analysis package).
+func (s *Server) OnDocumentChanged(hook DocumentHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.documentHooks = append(s.documentHooks, hook)
+}
+
+// documentChanged runs the document hooks.
+func (s *Server) documentChanged(uri protocol.DocumentURI, snapshot *textdocument.Snapshot) {
+	s.mu.RLock()
+	hooks := s.documentHooks
+	s.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(uri, snapshot)
+	}
+}
+
+// snapshotKey is the context key of the snapshot of the document targeted by a message.
+type snapshotKey struct{}
+
+// SnapshotFromContext returns the snapshot of the document targeted by the request or
+// notification being handled, for methods whose params have a `textDocument` identifier.
+// The snapshot is the state of the document when the message arrived, the document may
+// have changed since. ok is false when the document is not open.
+func SnapshotFromContext(ctx context.Context) (*textdocument.Snapshot, bool) {
+	snapshot, ok := ctx.Value(snapshotKey{}).(*textdocument.Snapshot)
+	return snapshot, ok
+}
+
+// withSnapshot attaches to ctx the snapshot of the document targeted by msg, if any.
+// Like trackDocument it runs in the read loop, to resolve the snapshot in message order.
+func (s *Server) withSnapshot(ctx context.Context, msg any) context.Context {
+	var params json.RawMessage
+	switch m := msg.(type) {
+	case *jsonrpc2.RequestMessage:
+		params = m.Params
+	case *jsonrpc2.NotificationMessage:
+		params = m.Params
+	}
+	if len(params) == 0 {
+		return ctx
+	}
+
+	var target struct {
+		TextDocument *protocol.TextDocumentIdentifier `json:"textDocument"`
+	}
+	if err := s.conn.Codec().Unmarshal(params, &target); err != nil || target.TextDocument == nil {
+		return ctx // Invalid params are reported when the handler decodes them
+	}
+	snapshot, ok := s.documents.Get(target.TextDocument.URI)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, snapshotKey{}, snapshot)
+}
+
+// ApplyEdit asks the client to apply a workspace edit with workspace/applyEdit and waits
+// for its answer. The edit is first validated against the document store, an edit computed
+// for a version the user has since changed fails with textdocument.ErrStaleVersion instead
+// of being sent. An *ApplyEditError is returned when the client does not apply the edit,
+// ErrReadOnly when the server runs with WithReadOnly.
+func (s *Server) ApplyEdit(ctx context.Context, label string, edit protocol.WorkspaceEdit) error {
+	if s.readOnly {
+		return s.blockApplyEdit(label)
+	}
+	if err := s.documents.ValidateWorkspaceEdit(edit); err != nil {
+		s.logger.Printf("Not sending workspace edit %q: %v", label, err)
+		return err
+	}
+
+	params := protocol.ApplyWorkspaceEditParams{Label: label, Edit: edit}
+	var result protocol.ApplyWorkspaceEditResponse
+	if err := s.Call(ctx, protocol.MethodWorkspaceApplyEdit, params, &result); err != nil {
+		return err
+	}
+	if !result.Applied {
+		err := newApplyEditError(label, edit, result)
+		s.logger.Printf("Workspace edit not applied: %v", err)
+		return err
+	}
+	return nil
+}
+
+// ErrShowDocumentUnsupported is returned by ShowDocument when the client can't show documents.
+var ErrShowDocumentUnsupported = errors.New("client does not support window/showDocument")
+
+// ShowDocument asks the client to show a document, or an external resource with External.
+// It returns an error when the client doesn't support it, or reports it failed to.
+func (s *Server) ShowDocument(ctx context.Context, params protocol.ShowDocumentParams) error {
+	if !s.ClientCapabilities().SupportsShowDocument() {
+		return ErrShowDocumentUnsupported
+	}
+	var result protocol.ShowDocumentResult
+	if err := s.Call(ctx, protocol.MethodWindowShowDocument, params, &result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("client failed to show %s", params.URI)
+	}
+	return nil
+}
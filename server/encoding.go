@@ -0,0 +1,37 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// PositionEncodingPolicy is what the server does with a client which doesn't offer the
+// utf-16 position encoding, the only one the document utilities (textdocument.Mapper)
+// count characters in. See WithPositionEncodingPolicy.
+type PositionEncodingPolicy int
+
+const (
+	// PositionEncodingFallback answers with utf-16 anyway, as the spec requires all the
+	// clients to support it, and logs a warning.
+	PositionEncodingFallback PositionEncodingPolicy = iota
+	// PositionEncodingReject fails the initialize request with an error naming the encodings,
+	// rather than exchanging ranges the client counts differently for the whole session.
+	PositionEncodingReject
+)
+
+// negotiatePositionEncoding returns the position encoding to answer the client with, or the
+// error failing initialize under PositionEncodingReject.
+func (s *Server) negotiatePositionEncoding(caps protocol.ClientCapabilities) (protocol.PositionEncodingKind, error) {
+	if caps.SupportsPositionEncoding(protocol.PositionEncodingUTF16) {
+		return protocol.PositionEncodingUTF16, nil
+	}
+	if s.positionEncodingPolicy == PositionEncodingReject {
+		return "", jsonrpc2.NewError(jsonrpc2.InvalidParams, fmt.Sprintf(
+			"unsupported position encodings %v: the server only supports %s", caps.PositionEncodings(), protocol.PositionEncodingUTF16))
+	}
+	s.logger.Printf("Warning: client offers the position encodings %v, falling back to %s: ranges may be wrong for non-ASCII text",
+		caps.PositionEncodings(), protocol.PositionEncodingUTF16)
+	return protocol.PositionEncodingUTF16, nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// ErrorTranslator converts an error returned by a request handler to the JSON-RPC error sent
+// to the client. It returns nil for the errors it does not know about.
+type ErrorTranslator func(err error) *jsonrpc2.ErrorObject
+
+// RegisterErrorTranslator adds a translator for the errors returned by request handlers.
+// Translators are tried in registration order, the first non-nil result is sent. Errors no
+// translator handles are sent as is when they wrap a *jsonrpc2.ErrorObject, and as
+// InternalError otherwise.
+func (s *Server) RegisterErrorTranslator(t ErrorTranslator) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errTranslators = append(s.errTranslators, t)
+}
+
+// MapError translates the handler errors matching target (see errors.Is) to code, with
+// the error text as message and, when not nil, data as the error data.
+// e.g. s.MapError(ErrDocumentNotFound, jsonrpc2.InvalidParams, nil)
+func (s *Server) MapError(target error, code int, data any) error {
+	var rawData []byte
+	if data != nil {
+		var err error
+		rawData, err = s.conn.Codec().Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to marshal data of error code %d: %w", code, err)
+		}
+	}
+	s.RegisterErrorTranslator(func(err error) *jsonrpc2.ErrorObject {
+		if !errors.Is(err, target) {
+			return nil
+		}
+		return &jsonrpc2.ErrorObject{Code: code, Message: err.Error(), Data: rawData}
+	})
+	return nil
+}
+
+// toErrorObject converts a handler error to the JSON-RPC error sent to the client.
+func (s *Server) toErrorObject(err error) (errObj *jsonrpc2.ErrorObject, internal bool) {
+	// A jsonrpc2 error returned as is was chosen by the handler
+	if jsonErr, ok := err.(*jsonrpc2.ErrorObject); ok {
+		return jsonErr, false
+	}
+
+	s.mu.RLock()
+	translators := s.errTranslators
+	s.mu.RUnlock()
+	for _, translate := range translators {
+		if errObj := translate(err); errObj != nil {
+			return errObj, false
+		}
+	}
+
+	if errors.As(err, &errObj) {
+		return errObj, false
+	}
+	return jsonrpc2.NewError(jsonrpc2.InternalError, err.Error()), true
+}
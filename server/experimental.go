@@ -0,0 +1,36 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// reservedExperimental are the experimental capabilities the server fills itself.
+var reservedExperimental = []string{ExperimentalCommandSchemas, ExperimentalConfigurationSchema, protocol.ExperimentalNamespaces}
+
+// DeclareExperimental advertises a custom feature of the server under key in the
+// experimental capabilities of the initialize result, e.g. the custom notifications it
+// sends, so editor plugins can tell whether to expect them. value must marshal to JSON.
+// It must be called before initialize.
+func (s *Server) DeclareExperimental(key string, value any) error {
+	if key == "" {
+		return fmt.Errorf("empty experimental capability key")
+	}
+	for _, reserved := range reservedExperimental {
+		if key == reserved {
+			return fmt.Errorf("experimental capability %q is reserved by the server", key)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.experimental[key]; exists {
+		return fmt.Errorf("experimental capability already declared: %s", key)
+	}
+	if s.experimental == nil {
+		s.experimental = make(map[string]any)
+	}
+	s.experimental[key] = value
+	return nil
+}
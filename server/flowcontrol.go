@@ -0,0 +1,53 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// DefaultWriteHighWater is the default size in bytes of the messages buffered for the
+// client above which WaitWritable blocks.
+const DefaultWriteHighWater = 1 << 20
+
+// DefaultWriteStallThreshold is how long a message to the client stays unread before the
+// write is reported as stalled, see WithWriteStallHandler.
+const DefaultWriteStallThreshold = 5 * time.Second
+
+// logWriteStall is the default write stall handler.
+func (s *Server) logWriteStall(stall jsonrpc2.WriteStall) {
+	if stall.Done {
+		s.logger.Printf("Client read its input again after %v", stall.Duration.Round(time.Millisecond))
+		return
+	}
+	s.logger.Printf("Warning: client stopped reading its input %v ago, %d bytes buffered: it may be frozen",
+		stall.Duration.Round(time.Millisecond), stall.Buffered)
+}
+
+// Buffered returns the size in bytes of the messages sent to the client but not yet read by
+// it, e.g. notifications queued behind a slow client.
+func (s *Server) Buffered() int {
+	return s.conn.Buffered()
+}
+
+// WaitWritable blocks until the messages buffered for the client are below the high water
+// mark set with WithWriteHighWater. Handlers sending many messages, e.g. thousands of
+// partial results or progress reports, call it between them to pace their output to the
+// client instead of buffering it all in memory:
+//
+//	for _, batch := range batches {
+//		if err := s.WaitWritable(ctx); err != nil {
+//			return nil, err
+//		}
+//		s.Notify(ctx, protocol.MethodProgress, ...)
+//	}
+//
+// It returns ctx.Err() when ctx is done first, or the error of the connection.
+func (s *Server) WaitWritable(ctx context.Context) error {
+	if err := s.conn.WaitWritable(ctx, s.writeHighWater); err != nil {
+		return fmt.Errorf("waiting for the client to read %d buffered bytes: %w", s.conn.Buffered(), err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// FolderChangeHook is called with the folders added to and removed from the workspace, as
+// reported by workspace/didChangeWorkspaceFolders. WorkspaceFolders already returns the
+// new folders.
+type FolderChangeHook func(ctx context.Context, event protocol.WorkspaceFoldersChangeEvent)
+
+// ConfigurationHook is called with the settings pushed by workspace/didChangeConfiguration.
+type ConfigurationHook func(ctx context.Context, params *protocol.DidChangeConfigurationParams)
+
+// workspaceFolders are the folders of the workspace, see WorkspaceFolders.
+type workspaceFolders struct {
+	mu      sync.RWMutex
+	folders []protocol.WorkspaceFolder
+
+	hooks       []FolderChangeHook  // See OnWorkspaceFoldersChanged
+	configHooks []ConfigurationHook // See OnConfigurationChanged
+}
+
+// WorkspaceFolders returns the folders of the workspace: the ones of the initialize request,
+// or its root URI for clients without workspace folders, kept up to date with the
+// workspace/didChangeWorkspaceFolders notifications. It is empty when the client opened no
+// folder, e.g. a single file.
+func (s *Server) WorkspaceFolders() []protocol.WorkspaceFolder {
+	s.folders.mu.RLock()
+	defer s.folders.mu.RUnlock()
+	return slices.Clone(s.folders.folders)
+}
+
+// FolderOf returns the workspace folder of a document, the innermost one for nested
+// folders. ok is false for documents outside of the workspace folders.
+func (s *Server) FolderOf(uri protocol.DocumentURI) (folder protocol.WorkspaceFolder, ok bool) {
+	s.folders.mu.RLock()
+	defer s.folders.mu.RUnlock()
+	for _, f := range s.folders.folders {
+		if f.Contains(uri) && (!ok || len(f.URI) > len(folder.URI)) {
+			folder, ok = f, true
+		}
+	}
+	return folder, ok
+}
+
+// OnWorkspaceFoldersChanged adds a hook called for each workspace/didChangeWorkspaceFolders
+// notification, before the handler registered for the method, if any, e.g. the
+// FoldersChanged method of a workspace.Indexer.
+func (s *Server) OnWorkspaceFoldersChanged(hook FolderChangeHook) {
+	s.folders.mu.Lock()
+	defer s.folders.mu.Unlock()
+	s.folders.hooks = append(s.folders.hooks, hook)
+}
+
+// OnConfigurationChanged adds a hook called for each workspace/didChangeConfiguration
+// notification, before the handler registered for the method, if any. The settings pulled
+// with Configuration or FolderSettings are stale from then on.
+func (s *Server) OnConfigurationChanged(hook ConfigurationHook) {
+	s.folders.mu.Lock()
+	defer s.folders.mu.Unlock()
+	s.folders.configHooks = append(s.folders.configHooks, hook)
+}
+
+// initFolders records the folders of the initialize request.
+func (s *Server) initFolders(params *protocol.InitializeParams) {
+	folders := slices.Clone(params.WorkspaceFolders)
+	if len(folders) == 0 && params.RootURI != nil && *params.RootURI != "" {
+		root := *params.RootURI
+		folders = []protocol.WorkspaceFolder{{URI: string(root), Name: root.Name()}}
+	}
+	s.folders.mu.Lock()
+	s.folders.folders = folders
+	s.folders.mu.Unlock()
+}
+
+// trackFolders applies a workspace/didChangeWorkspaceFolders notification to the folders.
+// Like trackDocument it runs in the read loop, the messages following it see the new
+// folders.
+func (s *Server) trackFolders(msg any) {
+	n, ok := msg.(*jsonrpc2.NotificationMessage)
+	if !ok || n.Method != protocol.MethodWorkspaceDidChangeWorkspaceFolders {
+		return
+	}
+	var params protocol.DidChangeWorkspaceFoldersParams
+	if err := s.conn.Codec().Unmarshal(n.Params, &params); err != nil {
+		return // Reported by foldersChanged
+	}
+	s.folders.mu.Lock()
+	defer s.folders.mu.Unlock()
+	s.folders.folders = slices.DeleteFunc(s.folders.folders, func(f protocol.WorkspaceFolder) bool {
+		return slices.ContainsFunc(params.Event.Removed, func(removed protocol.WorkspaceFolder) bool {
+			return sameFolder(f, removed)
+		})
+	})
+	for _, added := range params.Event.Added {
+		if !slices.ContainsFunc(s.folders.folders, func(f protocol.WorkspaceFolder) bool { return sameFolder(f, added) }) {
+			s.folders.folders = append(s.folders.folders, added)
+		}
+	}
+}
+
+// sameFolder reports whether two folders have the same URI, however it is encoded.
+func sameFolder(a, b protocol.WorkspaceFolder) bool {
+	return protocol.DocumentURI(a.URI).Canonical() == protocol.DocumentURI(b.URI).Canonical()
+}
+
+// foldersChanged clears the diagnostics of the documents of the removed folders which are
+// not open, nothing updates them anymore, then runs the hooks.
+func (s *Server) foldersChanged(ctx context.Context, raw json.RawMessage) {
+	var params protocol.DidChangeWorkspaceFoldersParams
+	if err := s.conn.Codec().Unmarshal(raw, &params); err != nil {
+		s.logger.Printf("Invalid %s params: %v", protocol.MethodWorkspaceDidChangeWorkspaceFolders, err)
+		return
+	}
+	s.logger.Printf("Workspace folders changed: %d added, %d removed", len(params.Event.Added), len(params.Event.Removed))
+
+	for _, uri := range s.diagnostics.URIs() {
+		if _, open := s.documents.Get(uri); open {
+			continue
+		}
+		if _, kept := s.FolderOf(uri); kept {
+			continue // Also in a remaining folder
+		}
+		if !slices.ContainsFunc(params.Event.Removed, func(f protocol.WorkspaceFolder) bool { return f.Contains(uri) }) {
+			continue
+		}
+		if err := s.diagnostics.Clear(ctx, uri); err != nil {
+			s.logger.Printf("Failed to clear diagnostics of %s: %v", uri, err)
+		}
+	}
+
+	s.folders.mu.RLock()
+	hooks := s.folders.hooks
+	s.folders.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, params.Event)
+	}
+}
+
+// configurationChanged runs the hooks of a workspace/didChangeConfiguration notification.
+func (s *Server) configurationChanged(ctx context.Context, raw json.RawMessage) {
+	s.folders.mu.RLock()
+	hooks := s.folders.configHooks
+	s.folders.mu.RUnlock()
+	if len(hooks) == 0 {
+		return
+	}
+	var params protocol.DidChangeConfigurationParams
+	if err := s.conn.Codec().Unmarshal(raw, &params); err != nil {
+		s.logger.Printf("Invalid %s params: %v", protocol.MethodWorkspaceDidChangeConfiguration, err)
+		return
+	}
+	for _, hook := range hooks {
+		hook(ctx, &params)
+	}
+}
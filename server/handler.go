@@ -22,11 +22,24 @@ type typedHandler struct {
 	// Add flags to indicate expected arguments like conn
 	takesConn   bool
 	takesParams bool
+
+	// direct, when set, decodes the params and calls the handler without reflection,
+	// see HandleRequest and HandleNotification.
+	direct func(ctx context.Context, codec jsonrpc2.Codec, params json.RawMessage) (any, error)
 }
 
 // invoke calls the underlying user handler after decoding params.
 // It now accepts conn *jsonrpc2.Conn and params json.RawMessage.
 func (h *typedHandler) invoke(ctx context.Context, conn *jsonrpc2.Conn, params json.RawMessage) (result any, err error) {
+	// Params are decoded with the codec of the connection, there is none for exit
+	var codec jsonrpc2.Codec = jsonrpc2.StdCodec{}
+	if conn != nil {
+		codec = conn.Codec()
+	}
+	if h.direct != nil {
+		return h.direct(ctx, codec, params)
+	}
+
 	var paramsPtr any // Pointer to the params struct
 
 	if h.takesParams && h.paramType != nil { // Check if parameters are defined and expected for this handler
@@ -35,7 +48,7 @@ func (h *typedHandler) invoke(ctx context.Context, conn *jsonrpc2.Conn, params j
 
 		// Try to unmarshal ONLY if params are present
 		if len(params) > 0 && string(params) != "null" {
-			if err := json.Unmarshal(params, paramsPtr); err != nil {
+			if err := codec.Unmarshal(params, paramsPtr); err != nil {
 				// Use specific JSON-RPC error code
 				return nil, &jsonrpc2.ErrorObject{
 					Code:    jsonrpc2.InvalidParams,
@@ -125,7 +138,13 @@ func (h *typedHandler) invoke(ctx context.Context, conn *jsonrpc2.Conn, params j
 		}
 	} else if len(results) == 2 {
 		// Two return values: assume (result, error)
-		if !results[0].IsNil() {
+		// Results can be values (e.g. a struct), only nillable kinds can be nil
+		switch results[0].Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+			if !results[0].IsNil() {
+				resVal = results[0].Interface()
+			}
+		default:
 			resVal = results[0].Interface()
 		}
 		if !results[1].IsNil() {
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MethodHealth is the custom request answered with the Health of the server
+// when the WithHealthRequest option is set.
+const MethodHealth = "$/lspgo/health"
+
+// Health is a snapshot of the state of a server, for supervisors managing servers.
+type Health struct {
+	// State is the lifecycle state: uninitialized, initializing, running or shutdown.
+	State string `json:"state"`
+	// Connected is false once the connection is closed or failed.
+	Connected bool `json:"connected"`
+	// InFlight is the number of messages from the client currently being handled.
+	InFlight int64 `json:"inFlight"`
+	// PendingCalls is the number of requests sent to the client waiting for a response.
+	PendingCalls int `json:"pendingCalls"`
+	// BufferedBytes is the size of the messages written but not yet read by the client,
+	// growing when the client is slow. See WaitWritable.
+	BufferedBytes int `json:"bufferedBytes"`
+	// LastError is the last fatal error of the server, e.g. the one Run returned.
+	LastError string `json:"lastError,omitempty"`
+	// LastErrorTime is when LastError happened.
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+	// StartTime is when the server was created.
+	StartTime time.Time `json:"startTime"`
+}
+
+// String returns the name of the state.
+func (st serverState) String() string {
+	switch st {
+	case stateUninitialized:
+		return "uninitialized"
+	case stateInitializing:
+		return "initializing"
+	case stateRunning:
+		return "running"
+	case stateShutdown:
+		return "shutdown"
+	}
+	return "unknown"
+}
+
+// lastError records the last fatal error of a server.
+type lastError struct {
+	mu   sync.Mutex
+	err  error
+	time time.Time
+}
+
+func (l *lastError) set(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+	l.time = time.Now()
+}
+
+// Health returns a snapshot of the state of the server.
+func (s *Server) Health() Health {
+	s.pendingMu.Lock()
+	pendingCalls := len(s.pendingCalls)
+	s.pendingMu.Unlock()
+
+	h := Health{
+		State:         s.currentState().String(),
+		Connected:     !s.conn.Closed(),
+		InFlight:      s.stats.inFlight.Load(),
+		PendingCalls:  pendingCalls,
+		BufferedBytes: s.conn.Buffered(),
+		StartTime:     s.stats.startTime,
+	}
+	s.lastErr.mu.Lock()
+	if s.lastErr.err != nil {
+		h.LastError = s.lastErr.err.Error()
+		t := s.lastErr.time
+		h.LastErrorTime = &t
+	}
+	s.lastErr.mu.Unlock()
+	return h
+}
+
+// handleHealth answers MethodHealth.
+func (s *Server) handleHealth(ctx context.Context) (Health, error) {
+	return s.Health(), nil
+}
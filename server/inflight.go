@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// beginRequest records the ID of a request from the client as in flight. It returns false
+// when a request with the same ID is still being handled, the spec requires IDs to be
+// unique among the requests in flight.
+func (s *Server) beginRequest(id string) bool {
+	s.inflightMu.Lock()
+	defer s.inflightMu.Unlock()
+	if _, found := s.inflight[id]; found {
+		return false
+	}
+	s.inflight[id] = nil // Cancelled once dispatched, see withInflightRequest
+	return true
+}
+
+// endRequest releases the ID of a handled request, the client may reuse it.
+func (s *Server) endRequest(id string) {
+	s.inflightMu.Lock()
+	delete(s.inflight, id)
+	s.inflightMu.Unlock()
+}
+
+// cancelRequest cancels the context of the request id, see handleCancel. It returns false
+// when the request is not in flight.
+func (s *Server) cancelRequest(id string) bool {
+	s.inflightMu.Lock()
+	cancel, found := s.inflight[id]
+	s.inflightMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	return found
+}
+
+// errRequestCancelled is the cause of the context of a request cancelled by the client.
+var errRequestCancelled = errors.New("request cancelled by the client")
+
+// inflightKey is the context key of the release of the ID of the request being handled.
+type inflightKey struct{}
+
+// withInflightRequest returns ctx carrying the release of the request ID, sendResponse
+// calls it before writing the response: a client may reuse the ID as soon as it reads it.
+// The context is cancelled with errRequestCancelled by $/cancelRequest until the release.
+// The release is also returned, for the requests answered without sendResponse, and the
+// cancellation of the context, to call once the request is handled.
+func (s *Server) withInflightRequest(ctx context.Context, id string) (context.Context, func(), func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	s.inflightMu.Lock()
+	s.inflight[id] = func() { cancel(errRequestCancelled) }
+	s.inflightMu.Unlock()
+	var once sync.Once
+	release := func() {
+		once.Do(func() { s.endRequest(id) })
+	}
+	return context.WithValue(ctx, inflightKey{}, release), release, func() { cancel(nil) }
+}
+
+// releaseRequest releases the ID of the request handled with ctx, if it is still in flight.
+func releaseRequest(ctx context.Context) {
+	if release, ok := ctx.Value(inflightKey{}).(func()); ok {
+		release()
+	}
+}
+
+// rejectDuplicateRequest answers a request reusing the ID of a request in flight with an
+// InvalidRequest error. The original request is still answered when its handler returns.
+func (s *Server) rejectDuplicateRequest(ctx context.Context, req *jsonrpc2.RequestMessage) {
+	s.logger.Printf("Rejecting request %s: ID=%s is already in use by a request in flight.", req.Method, string(req.ID))
+	errResp := jsonrpc2.NewError(jsonrpc2.InvalidRequest, fmt.Sprintf("duplicate request ID %s", string(req.ID)))
+	s.sendResponse(ctx, req.ID, nil, errResp)
+}
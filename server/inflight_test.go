@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// TestRequestIDReusableOnResponse checks a client may reuse the ID of a request as soon as
+// it read its response, without the server taking it for a duplicate.
+func TestRequestIDReusableOnResponse(t *testing.T) {
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	s := NewServer(
+		WithStream(ReadWriter{Reader: serverR, Writer: serverW}),
+		WithLogger(log.New(io.Discard, "", 0)),
+	)
+	if err := s.Register("test/echo", func(ctx context.Context, params *string) (string, error) {
+		return *params, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		clientW.Close()
+		serverW.Close()
+		<-done
+	})
+
+	stream := jsonrpc2.NewStream(ReadWriter{Reader: clientR, Writer: clientW})
+	call := func(method string, params any) jsonrpc2.ResponseMessage {
+		t.Helper()
+		raw, _ := json.Marshal(params)
+		if err := stream.WriteMessage(&jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: json.RawMessage(`7`), Method: method, Params: raw}); err != nil {
+			t.Fatal(err)
+		}
+		data, err := stream.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp jsonrpc2.ResponseMessage
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := call("initialize", map[string]any{}); resp.Error != nil {
+		t.Fatalf("initialize: %v", resp.Error)
+	}
+	if err := stream.WriteMessage(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: "initialized", Params: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 200 {
+		if resp := call("test/echo", "x"); resp.Error != nil {
+			t.Fatalf("request %d reusing ID 7: %v", i, resp.Error)
+		}
+	}
+}
+
+// TestCancelRequest checks $/cancelRequest cancels the context of the request in flight,
+// which is then answered with RequestCancelled.
+func TestCancelRequest(t *testing.T) {
+	local, peer := net.Pipe()
+	s := NewServer(WithStream(local), WithLogger(log.New(io.Discard, "", 0)))
+	started := make(chan struct{})
+	cancelled := make(chan error, 1)
+	if err := s.Register("test/block", func(ctx context.Context) (any, error) {
+		close(started)
+		select {
+		case <-ctx.Done():
+			cancelled <- context.Cause(ctx)
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Second):
+			return "not cancelled", nil
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		peer.Close()
+		local.Close()
+		<-done
+	})
+	peer.SetDeadline(time.Now().Add(5 * time.Second)) //nolint:errcheck
+
+	stream := jsonrpc2.NewStream(peer)
+	write := func(msg any) {
+		t.Helper()
+		if err := stream.WriteMessage(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func() jsonrpc2.ResponseMessage {
+		t.Helper()
+		data, err := stream.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resp jsonrpc2.ResponseMessage
+		if err := json.Unmarshal(data, &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	write(&jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: json.RawMessage(`1`), Method: "initialize", Params: json.RawMessage(`{}`)})
+	read()
+	write(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: "initialized", Params: json.RawMessage(`{}`)})
+
+	write(&jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: json.RawMessage(`"blocked"`), Method: "test/block"})
+	<-started
+	write(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: protocol.MethodCancelRequest, Params: json.RawMessage(`{"id":"blocked"}`)})
+	resp := read()
+	if string(resp.ID) != `"blocked"` || resp.Error == nil || resp.Error.Code != jsonrpc2.RequestCancelled {
+		t.Fatalf("got %s %+v, want a RequestCancelled error", resp.ID, resp.Error)
+	}
+	if cause := <-cancelled; !errors.Is(cause, errRequestCancelled) {
+		t.Errorf("handler context cancelled by %v, want %v", cause, errRequestCancelled)
+	}
+
+	// A cancellation of a request answered already is ignored, the ID is free
+	write(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: protocol.MethodCancelRequest, Params: json.RawMessage(`{"id":"blocked"}`)})
+	write(&jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: json.RawMessage(`"blocked"`), Method: "shutdown"})
+	if resp := read(); resp.Error != nil {
+		t.Errorf("request reusing the ID of the cancelled one: %v", resp.Error)
+	}
+}
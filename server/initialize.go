@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// InitializeHook checks the initialize request before it is answered, see OnInitialize.
+type InitializeHook func(ctx context.Context, params *protocol.InitializeParams) error
+
+// OnInitialize adds a hook checking the initialize request, e.g. for initialization
+// options the server requires. An error fails the initialization: the client is answered
+// with it, and may send initialize again. The error tells the client whether to retry, see
+// WithInitializeRetry; a hook returning protocol.NewInitializeError decides on its own.
+func (s *Server) OnInitialize(hook InitializeHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initializeHooks = append(s.initializeHooks, hook)
+}
+
+// runInitializeHooks runs the OnInitialize hooks, stopping at the first error.
+func (s *Server) runInitializeHooks(ctx context.Context, params *protocol.InitializeParams) error {
+	s.mu.RLock()
+	hooks := s.initializeHooks
+	s.mu.RUnlock()
+	for _, hook := range hooks {
+		if err := hook(ctx, params); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initializeFailed returns the error answering a failed initialize request, carrying the
+// protocol.InitializeError data the client expects. The server is left uninitialized, as
+// before the request: the trace level and workspace folders it set are reset too.
+func (s *Server) initializeFailed(err error) *jsonrpc2.ErrorObject {
+	s.logger.Printf("Initialize failed: %v", err)
+	s.initParams = nil
+	s.trace.Store(protocol.TraceOff)
+	s.folders.mu.Lock()
+	s.folders.folders = nil
+	s.folders.mu.Unlock()
+	s.state.Store(stateUninitialized) // The client may initialize again, e.g. with other capabilities
+
+	errObj, internal := s.toErrorObject(err)
+	if internal {
+		s.logger.Printf("Internal error in initialize: %v", err)
+	}
+	if _, ok := protocol.InitializeRetry(errObj); ok {
+		return errObj
+	}
+	return protocol.NewInitializeError(errObj.Code, errObj.Message, s.initializeRetry)
+}
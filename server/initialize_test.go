@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+func TestInitializeFailureResetsState(t *testing.T) {
+	var attempts atomic.Int32
+	s, c := startServer(t, func(s *Server) {
+		s.OnInitialize(func(ctx context.Context, params *protocol.InitializeParams) error {
+			if attempts.Add(1) == 1 {
+				return errors.New("backend down")
+			}
+			return nil
+		})
+	}, WithInitializeRetry(true))
+	ctx := testContext(t)
+
+	params := &protocol.InitializeParams{
+		Trace:            protocol.TraceVerbose,
+		WorkspaceFolders: []protocol.WorkspaceFolder{{URI: "file:///ws", Name: "ws"}},
+	}
+	_, err := c.Initialize(ctx, params)
+	if retry, ok := protocol.InitializeRetry(err); !ok || !retry {
+		t.Fatalf("first initialize: got %v, want an InitializeError letting the client retry", err)
+	}
+	if trace := s.Trace(); trace != protocol.TraceOff {
+		t.Errorf("trace %q after the failed initialize, want off", trace)
+	}
+	if folders := s.WorkspaceFolders(); len(folders) != 0 {
+		t.Errorf("folders %v after the failed initialize, want none", folders)
+	}
+
+	if _, err := c.Initialize(ctx, &protocol.InitializeParams{}); err != nil {
+		t.Fatalf("second initialize: %v", err)
+	}
+	if trace := s.Trace(); trace != protocol.TraceOff {
+		t.Errorf("trace %q, want off as sent by the second initialize", trace)
+	}
+
+	_, err = c.Initialize(ctx, params)
+	if retry, ok := protocol.InitializeRetry(err); !ok || retry {
+		t.Fatalf("initialize once initialized: got %v, want an InitializeError without retry", err)
+	}
+}
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Namespace is a group of custom methods sharing a prefix, e.g. "ollama/", see DeclareNamespace.
+type Namespace struct {
+	s       *Server
+	prefix  string
+	version string
+}
+
+// reservedPrefixes are the prefixes of the methods defined by the spec.
+var reservedPrefixes = []string{"$/", "textDocument/", "workspace/", "window/", "client/",
+	"notebookDocument/", "callHierarchy/", "typeHierarchy/", "codeAction/", "codeLens/",
+	"completionItem/", "documentLink/", "inlayHint/", "telemetry/", "workspaceSymbol/"}
+
+// DeclareNamespace declares a namespace of custom methods, advertised with its version and
+// methods under the experimental "namespaces" capability. Requests for unknown methods of the
+// namespace get a MethodNotFound error listing the supported ones. prefix must end with "/"
+// and not be one of the spec prefixes.
+func (s *Server) DeclareNamespace(prefix, version string) (*Namespace, error) {
+	if !strings.HasSuffix(prefix, "/") || len(prefix) < 2 {
+		return nil, fmt.Errorf("invalid namespace prefix %q: must end with /", prefix)
+	}
+	for _, reserved := range reservedPrefixes {
+		if prefix == reserved {
+			return nil, fmt.Errorf("namespace prefix %q is reserved by the protocol", prefix)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.namespaces[prefix]; exists {
+		return nil, fmt.Errorf("namespace already declared: %s", prefix)
+	}
+	ns := &Namespace{s: s, prefix: prefix, version: version}
+	s.namespaces[prefix] = ns
+	return ns, nil
+}
+
+// Method returns the full name of a method of the namespace.
+func (n *Namespace) Method(name string) string {
+	return n.prefix + name
+}
+
+// Register registers a handler for a method of the namespace, see Server.Register.
+// name is the method name without the prefix.
+func (n *Namespace) Register(name string, handlerFunc any) error {
+	return n.s.Register(n.Method(name), handlerFunc)
+}
+
+// info returns the description of the namespace, s.mu must be held.
+func (n *Namespace) info() protocol.NamespaceInfo {
+	info := protocol.NamespaceInfo{Version: n.version, Methods: []string{}}
+	for method := range n.s.handlers {
+		if strings.HasPrefix(method, n.prefix) {
+			info.Methods = append(info.Methods, method)
+		}
+	}
+	sort.Strings(info.Methods)
+	return info
+}
+
+// namespaceInfos returns the descriptions of the declared namespaces, s.mu must be held.
+func (s *Server) namespaceInfos() map[string]protocol.NamespaceInfo {
+	if len(s.namespaces) == 0 {
+		return nil
+	}
+	infos := make(map[string]protocol.NamespaceInfo, len(s.namespaces))
+	for prefix, ns := range s.namespaces {
+		infos[prefix] = ns.info()
+	}
+	return infos
+}
+
+// namespaceOf returns the description of the declared namespace of method.
+func (s *Server) namespaceOf(method string) (protocol.NamespaceInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for prefix, ns := range s.namespaces {
+		if strings.HasPrefix(method, prefix) {
+			return ns.info(), true
+		}
+	}
+	return protocol.NamespaceInfo{}, false
+}
@@ -4,6 +4,11 @@ import (
 	"io"
 	"log"
 	"os"
+	"reflect"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/jsonschema"
 )
 
 // Option defines a function signature for configuring the Server.
@@ -13,6 +18,52 @@ type Option func(*options)
 type options struct {
 	stream io.ReadWriter // Default: os.Stdin/os.Stdout
 	logger *log.Logger   // Default: log to os.Stderr
+
+	debugAddr string         // Default: no debug listener
+	codec     jsonrpc2.Codec // Default: encoding/json
+
+	healthRequest bool // Default: MethodHealth is not answered
+
+	initTimeout       time.Duration // Default: 0, wait for the initialization forever
+	initTimeoutNotify bool
+
+	initializeRetry bool // Default: the client is told not to retry a failed initialization
+
+	contentHandling *jsonrpc2.ContentHandling // Default: any message is decoded as JSON
+
+	codeActionPreference CodeActionPreference // Default: PreferCodeActionEdits
+
+	sessionFile string // Default: the session is not saved
+
+	validateResults bool // Default: results are sent as returned
+
+	stateInits map[reflect.Type]func(s *Server) any // Default: StateOf returns zero values
+
+	lateResponseHandler func(LateResponse) // Default: late responses are only logged and counted
+	callTimeout         time.Duration      // Default: 0, Call waits as long as its ctx allows
+
+	idGenerator jsonrpc2.IDGenerator // Default: jsonrpc2.SequentialIDs
+
+	writeHighWater int // Default: DefaultWriteHighWater
+
+	writeStallThreshold time.Duration             // Default: DefaultWriteStallThreshold
+	writeStallHandler   func(jsonrpc2.WriteStall) // Default: stalls are logged
+
+	configSchema *ConfigurationSchema // Default: no schema is published
+
+	includeTextOnSave bool // Default: didSave carries no text
+
+	overload *OverloadPolicy // Default: no request is shed
+
+	dynamicMethods []string // Default: the capabilities of all the handlers are advertised
+
+	readOnly bool // Default: edits are sent to the client
+
+	positionEncodingPolicy PositionEncodingPolicy // Default: PositionEncodingFallback
+
+	shutdownReport func(ShutdownReport) // Default: the report is only logged
+
+	authorizer *Authorizer // Default: every connection and message is accepted
 }
 
 // defaultOptions returns the default server configuration.
@@ -20,6 +71,7 @@ func defaultOptions() *options {
 	return &options{
 		stream: ReadWriter{os.Stdin, os.Stdout}, // Combine stdin/stdout
 		logger: log.New(os.Stderr, "lsp: ", log.LstdFlags|log.Lshortfile),
+		codec:  jsonrpc2.StdCodec{},
 	}
 }
 
@@ -37,6 +89,199 @@ func WithLogger(l *log.Logger) Option {
 	}
 }
 
+// WithDebugAddr starts an HTTP listener on addr (e.g. "localhost:6060") while the server runs,
+// exposing pprof profiles, expvar counters and the server Stats under /debug/.
+// Intended for socket-served deployments, do not expose it publicly.
+func WithDebugAddr(addr string) Option {
+	return func(o *options) {
+		o.debugAddr = addr
+	}
+}
+
+// WithCodec sets the JSON codec of the messages, params and results exchanged with the client,
+// e.g. to plug a faster JSON library than encoding/json.
+func WithCodec(codec jsonrpc2.Codec) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithHealthRequest makes the server answer the MethodHealth ("$/lspgo/health") request
+// with its Health, in any lifecycle state, so supervisors can probe it over the connection.
+// With WithAuthorizer, the request is answered like the others only after initialize.
+func WithHealthRequest() Option {
+	return func(o *options) {
+		o.healthRequest = true
+	}
+}
+
+// WithInitTimeout shuts the server down when the client sends no initialize request within
+// timeout of the start of Run, or no initialized notification within timeout of the initialize
+// response, instead of sitting idle forever. Run then returns an error wrapping ErrInitTimeout.
+// With notify, the client is sent a window/showMessage error before the connection is closed.
+func WithInitTimeout(timeout time.Duration, notify bool) Option {
+	return func(o *options) {
+		o.initTimeout = timeout
+		o.initTimeoutNotify = notify
+	}
+}
+
+// WithInitializeRetry sets whether a client whose initialize request failed should let the
+// user retry, e.g. when the failure comes from the environment (a backend down, a missing
+// tool) rather than from the client. It is the retry of the protocol.InitializeError data of
+// the failure, unless an OnInitialize hook returned its own.
+func WithInitializeRetry(retry bool) Option {
+	return func(o *options) {
+		o.initializeRetry = retry
+	}
+}
+
+// WithContentHandling checks the Content-Type, encoding and size of the messages from the
+// client, and rejects, skips or passes to a raw handler those which fail, per h.Policy.
+// A rejected message stops the server like any read error.
+func WithContentHandling(h jsonrpc2.ContentHandling) Option {
+	return func(o *options) {
+		o.contentHandling = &h
+	}
+}
+
+// WithCodeActionPreference sets whether CodeActionMode favors edits or commands.
+func WithCodeActionPreference(p CodeActionPreference) Option {
+	return func(o *options) {
+		o.codeActionPreference = p
+	}
+}
+
+// WithResultValidation checks the results of the handlers against the rules of the spec
+// clients rely on without reporting violations, e.g. the textEdit ranges of completion items.
+// Invalid results are logged and answered with an InternalError instead. Meant for
+// development and tests, it costs a pass over every checked result.
+func WithResultValidation() Option {
+	return func(o *options) {
+		o.validateResults = true
+	}
+}
+
+// WithLateResponseHandler calls fn with the responses of the client arriving after their Call
+// returned, e.g. to log slow clients or reuse an expensive result. fn runs on the goroutine
+// handling the response and must not block. Late responses are counted in Stats either way.
+func WithLateResponseHandler(fn func(LateResponse)) Option {
+	return func(o *options) {
+		o.lateResponseHandler = fn
+	}
+}
+
+// WithCallTimeout sets the deadline of the requests sent to the client with Call, ApplyEdit,
+// etc. when their ctx has none, so that a client never answering doesn't block a handler
+// forever. Timed out requests are cancelled on the client side with $/cancelRequest.
+func WithCallTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.callTimeout = timeout
+	}
+}
+
+// WithIDGenerator sets the generator of the IDs of the requests sent to the client, e.g.
+// jsonrpc2.NewPrefixedIDs when the server runs behind a proxy sending requests of its own.
+func WithIDGenerator(g jsonrpc2.IDGenerator) Option {
+	return func(o *options) {
+		o.idGenerator = g
+	}
+}
+
+// WithWriteHighWater sets the size in bytes of the messages buffered for the client above
+// which WaitWritable blocks. See DefaultWriteHighWater.
+func WithWriteHighWater(bytes int) Option {
+	return func(o *options) {
+		o.writeHighWater = bytes
+	}
+}
+
+// WithWriteStallHandler calls fn when a message to the client has not been read for longer
+// than threshold (see DefaultWriteStallThreshold), and again once the client read it: the
+// client stopped reading its input, it is frozen or overloaded. fn runs while the write is
+// blocked and must not send messages. Stalls are counted in Stats.Connection either way.
+func WithWriteStallHandler(threshold time.Duration, fn func(jsonrpc2.WriteStall)) Option {
+	return func(o *options) {
+		o.writeStallThreshold = threshold
+		o.writeStallHandler = fn
+	}
+}
+
+// WithOverloadShedding sheds the low value requests listed by policy while the server is
+// overloaded, see OverloadPolicy.
+func WithOverloadShedding(policy OverloadPolicy) Option {
+	return func(o *options) {
+		o.overload = &policy
+	}
+}
+
+// WithDynamicRegistration keeps the capabilities of the handlers of methods (e.g.
+// textDocument/formatting) out of the initialize result when the client can register them
+// dynamically: the server enables them with RegisterCapability once initialized, and may
+// disable them later, e.g. depending on settings. Clients without dynamic registration of a
+// method get its capability in the initialize result as usual.
+func WithDynamicRegistration(methods ...string) Option {
+	return func(o *options) {
+		o.dynamicMethods = append(o.dynamicMethods, methods...)
+	}
+}
+
+// WithReadOnly runs the server in read-only, advisory mode: it never edits the client
+// files. workspace/applyEdit requests fail with ErrReadOnly without being sent, and the
+// edits of the code actions answered are removed, the actions only carrying an edit are
+// dropped. The workspace edits answered to textDocument/rename and to the
+// workspace/will*Files file operations, and the edits of textDocument/willSaveWaitUntil,
+// are answered null. Blocked edits are logged and counted in Stats, e.g. to deploy a model
+// backed server where automatic edits are not allowed.
+//
+// Formatting edits and the additional edits of completion items, applied by the user, are
+// still answered. Handlers writing to the *jsonrpc2.Conn they are given directly bypass
+// the mode, send requests to the client with Server.Call or Server.ApplyEdit instead.
+func WithReadOnly() Option {
+	return func(o *options) {
+		o.readOnly = true
+	}
+}
+
+// WithShutdownReport calls fn with the report of how the server stopped: when Run returns,
+// or before the process exits on the exit notification. It is also available from
+// Server.ShutdownReport.
+func WithShutdownReport(fn func(ShutdownReport)) Option {
+	return func(o *options) {
+		o.shutdownReport = fn
+	}
+}
+
+// WithPositionEncodingPolicy sets what the server does when the client doesn't offer the
+// utf-16 position encoding in its general.positionEncodings capability: fall back to utf-16
+// (the default) or fail initialize.
+func WithPositionEncodingPolicy(p PositionEncodingPolicy) Option {
+	return func(o *options) {
+		o.positionEncodingPolicy = p
+	}
+}
+
+// WithConfigurationSchema publishes the schemas of the initializationOptions and of the
+// settings of the server, either may be nil, e.g. jsonschema.For[Settings](). They are
+// advertised under the experimental "configurationSchema" capability and answered to the
+// MethodConfigurationSchema ("$/lspgo/configurationSchema") request, in any lifecycle state
+// so that tools can query a server without initializing it. With WithAuthorizer, the schema
+// is only answered once the client completed an authorized initialize.
+func WithConfigurationSchema(initializationOptions, settings *jsonschema.Schema) Option {
+	return func(o *options) {
+		o.configSchema = &ConfigurationSchema{InitializationOptions: initializationOptions, Settings: settings}
+	}
+}
+
+// WithIncludeTextOnSave asks the client to send the text of the documents it saves. The
+// document store takes it as the current text, resyncing a store which drifted from the
+// client, and handlers of textDocument/didSave read it in the params.
+func WithIncludeTextOnSave() Option {
+	return func(o *options) {
+		o.includeTextOnSave = true
+	}
+}
+
 // ReadWriter combines an io.Reader and io.Writer into an io.ReadWriter.
 // Useful for using os.Stdin and os.Stdout together.
 type ReadWriter struct {
@@ -44,6 +289,23 @@ type ReadWriter struct {
 	io.Writer
 }
 
+// SetReadDeadline sets the read deadline of the reader if it supports deadlines, like a
+// net.Conn, so that reads are interrupted when the context of the server is cancelled.
+func (rw ReadWriter) SetReadDeadline(t time.Time) error {
+	if d, ok := rw.Reader.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return d.SetReadDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
+// SetWriteDeadline sets the write deadline of the writer if it supports deadlines.
+func (rw ReadWriter) SetWriteDeadline(t time.Time) error {
+	if d, ok := rw.Writer.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return os.ErrNoDeadline
+}
+
 // Close attempts to close the underlying streams if they support it.
 // Primarily useful if the stream is something like a net.Conn.
 // os.Stdin/Stdout don't typically need closing in this context.
@@ -67,3 +329,14 @@ func (rw ReadWriter) Close() error {
 	}
 	return errW // Return writer error if reader error was nil
 }
+
+// WithSessionFile saves the open documents (URI, language and version) and the last
+// configuration to path while the server runs, for supervised servers restarted after a
+// crash. The file is removed on shutdown. When the previous process crashed, the restarted
+// server asks the client to resend its documents once initialized, with the custom
+// protocol.MethodResyncDocuments request, and exposes the saved state with RecoveredSession.
+func WithSessionFile(path string) Option {
+	return func(o *options) {
+		o.sessionFile = path
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// documentOrder chains the handlers of the text synchronization notifications of each
+// document: they run one after the other, in the order the client sent them, while the
+// other messages are still handled concurrently. Without it a server keeping its own copy
+// of the documents could apply a didChange before the previous one and keep a stale text.
+type documentOrder struct {
+	mu   sync.Mutex
+	last map[protocol.DocumentURI]chan struct{} // Closed once the last queued handler returned
+}
+
+// enqueue queues a handler of the notification of uri. wait blocks until the handlers
+// queued before returned, done must be called once this one returned.
+func (o *documentOrder) enqueue(uri protocol.DocumentURI) (wait, done func()) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.last == nil {
+		o.last = make(map[protocol.DocumentURI]chan struct{})
+	}
+	prev, next := o.last[uri], make(chan struct{})
+	o.last[uri] = next
+
+	wait = func() {
+		if prev != nil {
+			<-prev
+		}
+	}
+	done = func() {
+		close(next)
+		o.mu.Lock()
+		if o.last[uri] == next {
+			delete(o.last, uri) // Nothing queued after it
+		}
+		o.mu.Unlock()
+	}
+	return wait, done
+}
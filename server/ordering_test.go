@@ -0,0 +1,309 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/client"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// jitter yields or sleeps for a random short time, so that the goroutines of the
+// dispatcher interleave differently on each run. The seeds are logged to replay a failure.
+type jitter struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newJitter(t *testing.T, seed int64) *jitter {
+	t.Logf("seed %d", seed)
+	return &jitter{rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (j *jitter) intn(n int) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.rnd.Intn(n)
+}
+
+func (j *jitter) pause() {
+	switch n := j.intn(4); n {
+	case 0:
+	case 1:
+		time.Sleep(time.Duration(j.intn(50)) * time.Microsecond)
+	default:
+		for range n {
+			runtime.Gosched()
+		}
+	}
+}
+
+func TestDocumentOrderChainsHandlers(t *testing.T) {
+	j := newJitter(t, time.Now().UnixNano())
+	var order documentOrder
+	const n = 200
+	uris := []protocol.DocumentURI{"file:///a", "file:///b", "file:///c"}
+
+	var mu sync.Mutex
+	got := make(map[protocol.DocumentURI][]int)
+	var wg sync.WaitGroup
+	for i := range n {
+		uri := uris[i%len(uris)]
+		wait, done := order.enqueue(uri) // In message order, like the read loop
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer done()
+			j.pause() // Started in any order
+			wait()
+			j.pause()
+			mu.Lock()
+			got[uri] = append(got[uri], i)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, uri := range uris {
+		for k := 1; k < len(got[uri]); k++ {
+			if got[uri][k] < got[uri][k-1] {
+				t.Fatalf("%s: handler %d ran after %d", uri, got[uri][k-1], got[uri][k])
+			}
+		}
+	}
+	if len(order.last) != 0 {
+		t.Errorf("%d documents still queued once all handlers returned", len(order.last))
+	}
+}
+
+// orderingServer records the versions its didOpen and didChange handlers see per document,
+// each handler pausing at random.
+type orderingServer struct {
+	*Server
+	j *jitter
+
+	mu        sync.Mutex
+	versions  map[protocol.DocumentURI][]int
+	closed    map[protocol.DocumentURI]bool
+	cancelled []error // Causes of the hovers which saw their context cancelled
+}
+
+func startOrderingServer(t *testing.T, j *jitter) (*orderingServer, *client.Client) {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	s := &orderingServer{
+		Server: NewServer(
+			WithStream(ReadWriter{Reader: serverR, Writer: serverW}),
+			WithLogger(log.New(io.Discard, "", 0)),
+		),
+		j:        j,
+		versions: make(map[protocol.DocumentURI][]int),
+		closed:   make(map[protocol.DocumentURI]bool),
+	}
+	s.Register(protocol.MethodTextDocumentDidOpen, func(ctx context.Context, p *protocol.DidOpenTextDocumentParams) error {
+		s.record(p.TextDocument.URI, p.TextDocument.Version)
+		return nil
+	})
+	s.Register(protocol.MethodTextDocumentDidChange, func(ctx context.Context, p *protocol.DidChangeTextDocumentParams) error {
+		s.record(p.TextDocument.URI, p.TextDocument.Version)
+		return nil
+	})
+	s.Register(protocol.MethodTextDocumentDidClose, func(ctx context.Context, p *protocol.DidCloseTextDocumentParams) error {
+		j.pause()
+		s.mu.Lock()
+		s.closed[p.TextDocument.URI] = true
+		s.mu.Unlock()
+		return nil
+	})
+	// Hovers answer the version of the snapshot they got, and are slow enough to be
+	// cancelled now and then
+	s.Register(protocol.MethodTextDocumentHover, func(ctx context.Context, p *protocol.HoverParams) (*protocol.Hover, error) {
+		j.pause()
+		snapshot, ok := SnapshotFromContext(ctx)
+		if !ok {
+			return nil, fmt.Errorf("no snapshot of %s", p.TextDocument.URI)
+		}
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			s.cancelled = append(s.cancelled, context.Cause(ctx))
+			s.mu.Unlock()
+			return nil, ctx.Err()
+		case <-time.After(time.Duration(j.intn(200)) * time.Microsecond):
+		}
+		return &protocol.Hover{Contents: protocol.MarkupContent{Kind: protocol.PlainText, Value: strconv.Itoa(snapshot.Version)}}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	c := client.New(client.Stdio{Reader: clientR, Writer: clientW}, client.WithCapabilityGuard(client.GuardOff))
+	t.Cleanup(func() {
+		c.Close()
+		cancel()
+		serverR.Close()
+		serverW.Close()
+		<-done
+	})
+
+	initCtx, cancelInit := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelInit()
+	if _, err := c.Initialize(initCtx, nil); err != nil {
+		t.Fatalf("initialize: %v", err)
+	}
+	return s, c
+}
+
+// record appends the version a handler saw, pausing before and after.
+func (s *orderingServer) record(uri protocol.DocumentURI, version int) {
+	s.j.pause()
+	s.mu.Lock()
+	s.versions[uri] = append(s.versions[uri], version)
+	s.mu.Unlock()
+	s.j.pause()
+}
+
+// TestDispatcherOrderUnderStorms sends, for several documents at once, didOpen and storms
+// of didChange interleaved with hovers, some of them cancelled, then didClose. The handlers
+// of each document must see all its versions in order, and each hover the snapshot of the
+// last change sent before it. Run it with -race.
+func TestDispatcherOrderUnderStorms(t *testing.T) {
+	const (
+		documents = 6
+		changes   = 150
+		runs      = 3
+	)
+	for run := range runs {
+		t.Run(fmt.Sprintf("run%d", run), func(t *testing.T) {
+			j := newJitter(t, time.Now().UnixNano()+int64(run))
+			s, c := startOrderingServer(t, j)
+
+			var wg sync.WaitGroup
+			var clientCancelled atomic.Int64
+			errs := make(chan error, documents*changes)
+			for d := range documents {
+				uri := protocol.DocumentURI(fmt.Sprintf("file:///storm/doc%d.txt", d))
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					errs <- stormDocument(c, j, uri, changes, &clientCancelled)
+				}()
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Error(err)
+				}
+			}
+
+			// didClose is the last notification of each document, once handled all are
+			deadline := time.Now().Add(10 * time.Second)
+			for {
+				s.mu.Lock()
+				closed := len(s.closed)
+				s.mu.Unlock()
+				if closed == documents {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("%d of %d documents closed", closed, documents)
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			// Only the $/cancelRequest of the client cancel a hover, some arrive after it returned
+			for _, cause := range s.cancelled {
+				if !errors.Is(cause, errRequestCancelled) {
+					t.Errorf("hover cancelled by %v, want %v", cause, errRequestCancelled)
+				}
+			}
+			if n := int64(len(s.cancelled)); n > clientCancelled.Load() {
+				t.Errorf("%d hovers cancelled on the server, the client cancelled %d", n, clientCancelled.Load())
+			}
+			t.Logf("%d hovers cancelled by the client, %d while handled", clientCancelled.Load(), len(s.cancelled))
+			for uri, versions := range s.versions {
+				if len(versions) != changes+1 {
+					t.Errorf("%s: %d handlers ran, want %d", uri, len(versions), changes+1)
+				}
+				for i, v := range versions {
+					if v != i+1 {
+						t.Errorf("%s: handler %d saw version %d, want %d: %v", uri, i, v, i+1, versions)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+// stormDocument opens a document, changes it, hovering between the changes, and closes it.
+// cancelled counts the hovers cancelled by the client.
+func stormDocument(c *client.Client, j *jitter, uri protocol.DocumentURI, changes int, cancelled *atomic.Int64) error {
+	ctx := context.Background()
+	err := c.Notify(ctx, protocol.MethodTextDocumentDidOpen, protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "plaintext", Version: 1, Text: "v1"},
+	})
+	if err != nil {
+		return err
+	}
+	for version := 2; version <= changes+1; version++ {
+		err := c.Notify(ctx, protocol.MethodTextDocumentDidChange, protocol.DidChangeTextDocumentParams{
+			TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: version},
+			ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "v" + strconv.Itoa(version)}},
+		})
+		if err != nil {
+			return err
+		}
+		if j.intn(5) != 0 {
+			continue
+		}
+		if err := hover(c, j, uri, version, cancelled); err != nil {
+			return err
+		}
+	}
+	return c.Notify(ctx, protocol.MethodTextDocumentDidClose, protocol.DidCloseTextDocumentParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+	})
+}
+
+// hover checks a hover sees version, unless it is cancelled by its timeout first: the
+// client then sends $/cancelRequest, and cancelled is incremented.
+func hover(c *client.Client, j *jitter, uri protocol.DocumentURI, version int, cancelled *atomic.Int64) error {
+	timeout := 5 * time.Second
+	if j.intn(3) == 0 {
+		timeout = time.Duration(j.intn(100)) * time.Microsecond
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var result protocol.Hover
+	err := c.Call(ctx, protocol.MethodTextDocumentHover, protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}},
+	}, &result)
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) && timeout < time.Second:
+		cancelled.Add(1)
+		return nil
+	case err != nil:
+		return fmt.Errorf("hover of %s at version %d: %w", uri, version, err)
+	case result.Contents.Value != strconv.Itoa(version):
+		return fmt.Errorf("hover of %s sent after version %d saw version %s", uri, version, result.Contents.Value)
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// DefaultSheddableMethods are the requests shed by an OverloadPolicy without Methods: their
+// result is only a hint to the user, the editor asks again as the cursor moves.
+var DefaultSheddableMethods = []string{
+	protocol.MethodTextDocumentHover,
+	protocol.MethodTextDocumentDocumentHighlight,
+}
+
+// ShedResponse is how a shed request is answered.
+type ShedResponse int
+
+const (
+	// ShedWithContentModified fails the request with ContentModified, editors drop the
+	// result silently and ask again later.
+	ShedWithContentModified ShedResponse = iota
+	// ShedWithNull answers an empty result, e.g. no hover.
+	ShedWithNull
+)
+
+// OverloadPolicy keeps the editor responsive when requests pile up faster than they are
+// handled, e.g. behind a slow analysis: the requests of Methods arriving while more than
+// MaxQueued messages wait to be handled are answered at once instead of queuing behind
+// them. Notifications are never shed, document synchronization and diagnostics keep
+// flowing, and neither are the other requests.
+type OverloadPolicy struct {
+	// MaxQueued is the number of messages dispatched and not handled yet above which
+	// requests are shed.
+	MaxQueued int
+	// Methods are the requests which may be shed, DefaultSheddableMethods when nil.
+	Methods []string
+	// Response is how shed requests are answered.
+	Response ShedResponse
+}
+
+// shed answers a request of the overload policy without handling it when depth messages
+// were queued when it arrived, and reports whether it did.
+func (s *Server) shed(ctx context.Context, msg any, depth int64) bool {
+	policy := s.overload
+	req, ok := msg.(*jsonrpc2.RequestMessage)
+	if policy == nil || !ok || depth <= int64(policy.MaxQueued) {
+		return false
+	}
+	methods := policy.Methods
+	if methods == nil {
+		methods = DefaultSheddableMethods
+	}
+	if !slices.Contains(methods, req.Method) {
+		return false
+	}
+
+	s.stats.shedRequests.Add(1)
+	s.logger.Printf("Shedding request %s ID=%s: %d messages queued", req.Method, string(req.ID), depth)
+	if policy.Response == ShedWithNull {
+		s.sendResponse(ctx, req.ID, nil, nil)
+		return true
+	}
+	s.sendResponse(ctx, req.ID, nil, jsonrpc2.NewError(jsonrpc2.ContentModified, "server overloaded, request dropped"))
+	return true
+}
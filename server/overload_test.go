@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// TestOverloadShedding checks the hover and documentHighlight requests arriving while more
+// than MaxQueued messages wait are answered at once, the notifications and the other
+// requests being still handled.
+func TestOverloadShedding(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		response ShedResponse
+	}{
+		{"content modified", ShedWithContentModified},
+		{"null", ShedWithNull},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			notified := make(chan struct{}, 1)
+			s, c := startServer(t, func(s *Server) {
+				s.Register("test/block", func(ctx context.Context) (any, error) {
+					<-release
+					return nil, nil
+				})
+				s.Register("test/other", func(ctx context.Context) (string, error) {
+					return "other", nil
+				})
+				s.Register("test/notify", func(ctx context.Context) error {
+					notified <- struct{}{}
+					return nil
+				})
+				answer := func(ctx context.Context) (string, error) { return "handled", nil }
+				s.Register(protocol.MethodTextDocumentHover, answer)
+				s.Register(protocol.MethodTextDocumentDocumentHighlight, answer)
+			}, WithOverloadShedding(OverloadPolicy{MaxQueued: 2, Response: tc.response}))
+			ctx := testContext(t)
+			if _, err := c.Initialize(ctx, &protocol.InitializeParams{}); err != nil {
+				t.Fatal(err)
+			}
+
+			for s.queued.Load() > 0 { // E.g. initialized
+				time.Sleep(time.Millisecond)
+			}
+
+			// Not shed while the server is not overloaded
+			var result string
+			if err := c.Call(ctx, protocol.MethodTextDocumentHover, nil, &result); err != nil || result != "handled" {
+				t.Fatalf("hover before the overload: %q, %v", result, err)
+			}
+
+			blocked := make(chan error, 3)
+			for range 3 {
+				go func() { blocked <- c.Call(ctx, "test/block", nil, nil) }()
+			}
+			for s.queued.Load() < 3 {
+				time.Sleep(time.Millisecond)
+			}
+
+			for _, method := range DefaultSheddableMethods {
+				result = ""
+				err := c.Call(ctx, method, nil, &result)
+				var rpcErr *jsonrpc2.ErrorObject
+				switch tc.response {
+				case ShedWithContentModified:
+					if !errors.As(err, &rpcErr) || rpcErr.Code != jsonrpc2.ContentModified {
+						t.Errorf("shed %s returned %q, %v, want ContentModified", method, result, err)
+					}
+				case ShedWithNull:
+					if err != nil || result != "" {
+						t.Errorf("shed %s returned %q, %v, want null", method, result, err)
+					}
+				}
+			}
+
+			// The others go through
+			if err := c.Call(ctx, "test/other", nil, &result); err != nil || result != "other" {
+				t.Errorf("other request while overloaded: %q, %v", result, err)
+			}
+			if err := c.Notify(ctx, "test/notify", json.RawMessage(`null`)); err != nil {
+				t.Fatal(err)
+			}
+			select {
+			case <-notified:
+			case <-ctx.Done():
+				t.Fatal("notification not handled while overloaded")
+			}
+
+			close(release)
+			for range 3 {
+				if err := <-blocked; err != nil {
+					t.Fatal(err)
+				}
+			}
+			for s.queued.Load() > 0 {
+				time.Sleep(time.Millisecond)
+			}
+			if err := c.Call(ctx, protocol.MethodTextDocumentDocumentHighlight, nil, &result); err != nil || result != "handled" {
+				t.Errorf("documentHighlight after the overload: %q, %v", result, err)
+			}
+			if got := s.Stats().ShedRequests; got != 2 {
+				t.Errorf("counted %d shed requests, want 2", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Progress reports the progress of a long running task to the client using `$/progress`.
+// A Progress is created by StartProgress and must be ended with End.
+// When the client can't display progress, all methods are no-ops.
+type Progress struct {
+	s     *Server
+	token protocol.ProgressToken
+	noop  bool
+
+	mu    sync.Mutex
+	ended bool
+
+	cancelled  chan struct{} // Closed when the user cancels the progress
+	cancelOnce sync.Once
+
+	ctx    context.Context // See Context
+	cancel context.CancelCauseFunc
+}
+
+// ErrProgressCancelled is the cause of the cancellation of the context of a progress the
+// user cancelled, see Progress.Context.
+var ErrProgressCancelled = errors.New("progress cancelled by the user")
+
+// workDoneTokenKey is the context key of the client provided work done token.
+type workDoneTokenKey struct{}
+
+// WorkDoneTokenFromContext returns the `workDoneToken` of the request being handled, nil
+// when the client did not send one.
+func WorkDoneTokenFromContext(ctx context.Context) *protocol.ProgressToken {
+	if token, ok := ctx.Value(workDoneTokenKey{}).(protocol.ProgressToken); ok {
+		return &token
+	}
+	return nil
+}
+
+// partialResultsKey is the context key of the PartialResultSender of a request.
+type partialResultsKey struct{}
+
+// withProgressTokens attaches to ctx the work done and partial result tokens of a request,
+// so that handlers use them without decoding them (see WorkDoneTokenFromContext and
+// PartialResultsFromContext).
+func (s *Server) withProgressTokens(ctx context.Context, msg any) context.Context {
+	req, ok := msg.(*jsonrpc2.RequestMessage)
+	if !ok || len(req.Params) == 0 {
+		return ctx
+	}
+	var tokens struct {
+		protocol.WorkDoneProgressParams
+		protocol.PartialResultParams
+	}
+	if err := s.conn.Codec().Unmarshal(req.Params, &tokens); err != nil {
+		return ctx // Not an object, or invalid tokens the handler reports
+	}
+	if tokens.WorkDoneToken != nil {
+		ctx = context.WithValue(ctx, workDoneTokenKey{}, *tokens.WorkDoneToken)
+	}
+	if tokens.PartialResultToken != nil {
+		ctx = context.WithValue(ctx, partialResultsKey{}, &PartialResultSender{s: s, token: *tokens.PartialResultToken})
+	}
+	return ctx
+}
+
+// StartProgress begins a work done progress titled title.
+//
+// When the request being handled carried a client provided `workDoneToken`, pass it as token:
+// progress is then reported against it as the spec requires. When token is nil, the token
+// found in ctx (see WorkDoneTokenFromContext) is used. Otherwise a new token is generated
+// and created on the client with `window/workDoneProgress/create`, provided the client
+// advertised the `window.workDoneProgress` capability.
+func (s *Server) StartProgress(ctx context.Context, token *protocol.ProgressToken, title string, cancellable bool) (*Progress, error) {
+	p := &Progress{s: s, cancelled: make(chan struct{})}
+	p.ctx, p.cancel = context.WithCancelCause(ctx)
+
+	if token == nil {
+		token = WorkDoneTokenFromContext(ctx)
+	}
+
+	if token != nil {
+		p.token = *token
+	} else {
+		if !s.clientSupportsWorkDoneProgress() {
+			s.logger.Printf("Client does not support server initiated progress, not reporting %q", title)
+			p.noop = true
+			return p, nil
+		}
+		p.token = s.progressTokens.Next()
+		params := &protocol.WorkDoneProgressCreateParams{Token: p.token}
+		if err := s.Call(ctx, protocol.MethodWorkDoneProgressCreate, params, nil); err != nil {
+			return nil, fmt.Errorf("failed to create progress token %s: %w", p.token, err)
+		}
+	}
+
+	s.progressMu.Lock()
+	s.progress[p.token] = p
+	s.progressMu.Unlock()
+
+	begin := protocol.WorkDoneProgressBegin{
+		Kind:        "begin",
+		Title:       title,
+		Cancellable: cancellable,
+	}
+	if err := p.notify(ctx, begin); err != nil {
+		p.forget()
+		p.cancel(err)
+		return nil, err
+	}
+	return p, nil
+}
+
+// Token returns the token progress is reported against.
+func (p *Progress) Token() protocol.ProgressToken {
+	return p.token
+}
+
+// Cancelled is closed when the user cancels the progress, started as cancellable, in the
+// client UI. The task should then stop and End the progress. Tasks using contexts rather
+// select on Context.
+func (p *Progress) Cancelled() <-chan struct{} {
+	return p.cancelled
+}
+
+// Context returns the context of the task reporting the progress, derived from the one
+// given to StartProgress. It is cancelled when the user cancels the progress, with
+// ErrProgressCancelled as cause, and once the progress ended, e.g.
+//
+//	p, err := s.StartProgress(s.BackgroundContext(), nil, "Indexing", true)
+//	...
+//	err = index(p.Context(), p)
+//	if errors.Is(context.Cause(p.Context()), server.ErrProgressCancelled) {
+//		p.End(ctx, "Cancelled")
+//	}
+func (p *Progress) Context() context.Context {
+	return p.ctx
+}
+
+// handleProgressCancel handles window/workDoneProgress/cancel notifications, cancelling
+// the context of the progress.
+func (s *Server) handleProgressCancel(ctx context.Context, params *protocol.WorkDoneProgressCancelParams) {
+	s.progressMu.Lock()
+	p, ok := s.progress[params.Token]
+	s.progressMu.Unlock()
+	if !ok {
+		s.logger.Printf("Ignoring cancellation of unknown progress %s", params.Token)
+		return
+	}
+	s.logger.Printf("Progress %s cancelled by the client", params.Token)
+	p.cancelOnce.Do(func() { close(p.cancelled) })
+	p.cancel(ErrProgressCancelled)
+}
+
+// Report sends a progress update. message and percentage are optional.
+func (p *Progress) Report(ctx context.Context, message string, percentage *uint) error {
+	report := protocol.WorkDoneProgressReport{
+		Kind:       "report",
+		Percentage: percentage,
+	}
+	if message != "" {
+		report.Message = &message
+	}
+	return p.notify(ctx, report)
+}
+
+// End terminates the progress with an optional final message.
+// Calling End more than once is a no-op.
+func (p *Progress) End(ctx context.Context, message string) error {
+	defer p.cancel(context.Canceled) // The task is over
+	if p.noop {
+		return nil
+	}
+	p.mu.Lock()
+	if p.ended {
+		p.mu.Unlock()
+		return nil
+	}
+	p.ended = true
+	p.mu.Unlock()
+	defer p.forget()
+
+	end := protocol.WorkDoneProgressEnd{Kind: "end"}
+	if message != "" {
+		end.Message = &message
+	}
+	return p.s.sendProgress(ctx, p.token, end)
+}
+
+// notify sends a progress value unless the progress was ended.
+func (p *Progress) notify(ctx context.Context, value any) error {
+	if p.noop {
+		return nil
+	}
+	p.mu.Lock()
+	ended := p.ended
+	p.mu.Unlock()
+	if ended {
+		return fmt.Errorf("progress %s already ended", p.token)
+	}
+	return p.s.sendProgress(ctx, p.token, value)
+}
+
+// forget removes the progress from the active set.
+func (p *Progress) forget() {
+	if p.noop {
+		return
+	}
+	p.s.progressMu.Lock()
+	delete(p.s.progress, p.token)
+	p.s.progressMu.Unlock()
+}
+
+// sendProgress sends a `$/progress` notification.
+func (s *Server) sendProgress(ctx context.Context, token protocol.ProgressToken, value any) error {
+	return s.Notify(ctx, protocol.MethodProgress, struct {
+		Token protocol.ProgressToken `json:"token"`
+		Value any                    `json:"value"`
+	}{token, value})
+}
+
+// SendPartialResult streams a part of the result of a request whose params carried a
+// partialResultToken (see protocol.PartialResultParams). Once all the parts are sent, the
+// request answers an empty result, e.g. an empty array for workspace/symbol.
+func (s *Server) SendPartialResult(ctx context.Context, token protocol.ProgressToken, value any) error {
+	return s.sendProgress(ctx, token, value)
+}
+
+// PartialResultSender streams the result of the request being handled in parts, when the
+// client asked for it with a partialResultToken. Each part is a value of the result type,
+// e.g. a slice of locations. Once a part was sent, the handler answers an empty result.
+type PartialResultSender struct {
+	s     *Server
+	token protocol.ProgressToken
+	sent  atomic.Bool
+}
+
+// PartialResultsFromContext returns the sender of the partial results of the request being
+// handled, ok is false when the client did not ask for partial results:
+//
+//	if results, ok := server.PartialResultsFromContext(ctx); ok {
+//		for batch := range search(ctx, params) {
+//			if err := results.Send(ctx, batch); err != nil {
+//				return nil, err
+//			}
+//		}
+//		return []protocol.Location{}, nil
+//	}
+func PartialResultsFromContext(ctx context.Context) (*PartialResultSender, bool) {
+	sender, ok := ctx.Value(partialResultsKey{}).(*PartialResultSender)
+	return sender, ok
+}
+
+// Token returns the partialResultToken of the request.
+func (p *PartialResultSender) Token() protocol.ProgressToken {
+	return p.token
+}
+
+// Send sends a part of the result.
+func (p *PartialResultSender) Send(ctx context.Context, value any) error {
+	p.sent.Store(true)
+	return p.s.SendPartialResult(ctx, p.token, value)
+}
+
+// Sent reports whether a part was sent, the final result must then be empty.
+func (p *PartialResultSender) Sent() bool {
+	return p.sent.Load()
+}
+
+// clientSupportsWorkDoneProgress reports whether the client accepts window/workDoneProgress/create.
+func (s *Server) clientSupportsWorkDoneProgress() bool {
+	return s.initParams != nil &&
+		s.initParams.Capabilities.Window != nil &&
+		s.initParams.Capabilities.Window.WorkDoneProgress
+}
+
+// Default throttling of ThrottledProgress.
+const (
+	DefaultProgressInterval = 100 * time.Millisecond // At most 10 reports per second
+	DefaultProgressMinDelta = 1                      // At least 1% between two reports
+)
+
+// ThrottledProgress wraps a Progress and rate-limits its reports, so that reporting
+// from a tight loop (e.g. for each indexed file) doesn't flood the client.
+// A report is sent when at least interval elapsed since the previous one, and when
+// its percentage moved by at least minDelta points or its message changed.
+type ThrottledProgress struct {
+	*Progress
+	interval time.Duration
+	minDelta uint
+
+	mu          sync.Mutex
+	lastSent    time.Time
+	lastPercent *uint
+	lastMessage string
+}
+
+// NewThrottledProgress wraps p, use DefaultProgressInterval and DefaultProgressMinDelta
+// for the recommended limits.
+func NewThrottledProgress(p *Progress, interval time.Duration, minDelta uint) *ThrottledProgress {
+	return &ThrottledProgress{
+		Progress: p,
+		interval: interval,
+		minDelta: minDelta,
+	}
+}
+
+// Report sends a progress update unless it is throttled.
+// Throttled reports are dropped, the next accepted report carries the latest state.
+func (t *ThrottledProgress) Report(ctx context.Context, message string, percentage *uint) error {
+	t.mu.Lock()
+	now := time.Now()
+	if !t.lastSent.IsZero() && now.Sub(t.lastSent) < t.interval {
+		t.mu.Unlock()
+		return nil
+	}
+	if message == t.lastMessage && !t.percentageMoved(percentage) {
+		t.mu.Unlock()
+		return nil
+	}
+	t.lastSent = now
+	t.lastMessage = message
+	if percentage != nil {
+		pct := *percentage
+		t.lastPercent = &pct
+	}
+	t.mu.Unlock()
+
+	return t.Progress.Report(ctx, message, percentage)
+}
+
+// percentageMoved reports whether percentage differs enough from the last sent one.
+// Caller must hold t.mu.
+func (t *ThrottledProgress) percentageMoved(percentage *uint) bool {
+	if percentage == nil {
+		return false
+	}
+	if t.lastPercent == nil {
+		return true
+	}
+	last, current := *t.lastPercent, *percentage
+	if current >= last {
+		return current-last >= t.minDelta
+	}
+	return last-current >= t.minDelta
+}
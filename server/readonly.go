@@ -0,0 +1,128 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrReadOnly is returned by ApplyEdit, and by Call of workspace/applyEdit, when the server
+// runs with WithReadOnly.
+var ErrReadOnly = errors.New("server is read-only, edits are not sent to the client")
+
+// ReadOnly reports whether the server runs in read-only mode, see WithReadOnly.
+func (s *Server) ReadOnly() bool {
+	return s.readOnly
+}
+
+// blockApplyEdit logs a workspace/applyEdit request blocked by the read-only mode.
+func (s *Server) blockApplyEdit(label string) error {
+	s.stats.blockedEdits.Add(1)
+	s.logger.Printf("Read-only: blocked workspace edit %q", label)
+	return ErrReadOnly
+}
+
+// stripEdits removes the edits from the results answered in read-only mode, the client
+// would apply them without asking the server:
+//   - the workspace edits of textDocument/rename and workspace/will{Create,Rename,Delete}Files,
+//     resource operations included, and the edits of textDocument/willSaveWaitUntil are
+//     answered null;
+//   - the edits of the code actions are removed, actions left without a command to run are
+//     dropped from textDocument/codeAction results.
+//
+// Results of other methods are returned unchanged, e.g. the formatting edits or the
+// additional edits of completion items, which the user applies explicitly.
+func (s *Server) stripEdits(method string, result any) (any, error) {
+	switch method {
+	case protocol.MethodTextDocumentRename, protocol.MethodTextDocumentWillSaveWaitUntil,
+		protocol.MethodWorkspaceWillCreateFiles, protocol.MethodWorkspaceWillRenameFiles,
+		protocol.MethodWorkspaceWillDeleteFiles:
+		if isNull(result) {
+			return result, nil
+		}
+		s.stats.blockedEdits.Add(1)
+		s.logger.Printf("Read-only: blocked the edits answered to %s", method)
+		return nil, nil
+	case protocol.MethodTextDocumentCodeAction, protocol.MethodCodeActionResolve:
+	default:
+		return result, nil
+	}
+	raw, err := s.conn.Codec().Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s result: %w", method, err)
+	}
+
+	if method == protocol.MethodCodeActionResolve {
+		action, stripped, _, err := s.stripActionEdit(raw)
+		if err != nil || !stripped {
+			return result, err
+		}
+		s.stats.blockedEdits.Add(1)
+		s.logger.Printf("Read-only: removed the edit of the resolved code action")
+		return action, nil // The client still expects the action
+	}
+
+	var actions []json.RawMessage // (Command | CodeAction)[] | null
+	if err := s.conn.Codec().Unmarshal(raw, &actions); err != nil {
+		return nil, fmt.Errorf("invalid %s result: %w", method, err)
+	}
+	if actions == nil {
+		return result, nil
+	}
+	kept := make([]json.RawMessage, 0, len(actions))
+	var removed, dropped int
+	for _, a := range actions {
+		action, stripped, hasCommand, err := s.stripActionEdit(a)
+		if err != nil {
+			return nil, err
+		}
+		if stripped {
+			removed++
+			if !hasCommand {
+				dropped++
+				continue
+			}
+		}
+		kept = append(kept, action)
+	}
+	if removed == 0 {
+		return result, nil
+	}
+	s.stats.blockedEdits.Add(uint64(removed))
+	s.logger.Printf("Read-only: removed the edits of %d code actions, dropped %d without a command", removed, dropped)
+	return kept, nil
+}
+
+// stripActionEdit removes the edit of a code action (or leaves a command as is), stripped
+// tells whether it had one and hasCommand whether the action still runs a command.
+func (s *Server) stripActionEdit(raw json.RawMessage) (action json.RawMessage, stripped, hasCommand bool, err error) {
+	var fields map[string]json.RawMessage
+	if err := s.conn.Codec().Unmarshal(raw, &fields); err != nil {
+		return nil, false, false, fmt.Errorf("invalid code action: %w", err)
+	}
+	_, hasCommand = fields["command"]
+	if _, ok := fields["edit"]; !ok {
+		return raw, false, hasCommand, nil
+	}
+	delete(fields, "edit")
+	if action, err = s.conn.Codec().Marshal(fields); err != nil {
+		return nil, true, hasCommand, fmt.Errorf("failed to marshal code action: %w", err)
+	}
+	return action, true, hasCommand, nil
+}
+
+// isNull reports whether result is answered as null.
+func isNull(result any) bool {
+	if result == nil {
+		return true
+	}
+	v := reflect.ValueOf(result)
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
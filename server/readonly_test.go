@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// TestReadOnlyBlocksEdits checks a read-only server sends no edit to the client: the
+// workspace edits answered are null, the code actions lose theirs and applyEdit fails.
+func TestReadOnlyBlocksEdits(t *testing.T) {
+	uri := protocol.DocumentURI("file:///a.go")
+	edit := &protocol.WorkspaceEdit{
+		Changes: map[protocol.DocumentURI][]protocol.TextEdit{uri: {{NewText: "b"}}},
+	}
+	command := &protocol.Command{Title: "run", Command: "a.run"}
+	s, c := startServer(t, func(s *Server) {
+		answerEdit := func(ctx context.Context) (*protocol.WorkspaceEdit, error) { return edit, nil }
+		for _, method := range []string{
+			protocol.MethodTextDocumentRename,
+			protocol.MethodWorkspaceWillCreateFiles,
+			protocol.MethodWorkspaceWillRenameFiles,
+			protocol.MethodWorkspaceWillDeleteFiles,
+		} {
+			if err := s.Register(method, answerEdit); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := s.Register(protocol.MethodTextDocumentWillSaveWaitUntil, func(ctx context.Context) ([]protocol.TextEdit, error) {
+			return edit.Changes[uri], nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Register(protocol.MethodTextDocumentCodeAction, func(ctx context.Context) ([]protocol.CodeAction, error) {
+			return []protocol.CodeAction{
+				{Title: "edit", Edit: edit},
+				{Title: "edit and run", Edit: edit, Command: command},
+				{Title: "run", Command: command},
+			}, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Register(protocol.MethodCodeActionResolve, func(ctx context.Context) (*protocol.CodeAction, error) {
+			return &protocol.CodeAction{Title: "edit", Edit: edit}, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}, WithReadOnly())
+	ctx := testContext(t)
+	if _, err := c.Initialize(ctx, &protocol.InitializeParams{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, method := range []string{
+		protocol.MethodTextDocumentRename,
+		protocol.MethodWorkspaceWillCreateFiles,
+		protocol.MethodWorkspaceWillRenameFiles,
+		protocol.MethodWorkspaceWillDeleteFiles,
+		protocol.MethodTextDocumentWillSaveWaitUntil,
+	} {
+		var result json.RawMessage
+		if err := c.Call(ctx, method, nil, &result); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if len(result) != 0 { // The client only decodes non-null results
+			t.Errorf("%s answered %s, want null", method, result)
+		}
+	}
+
+	var actions []protocol.CodeAction
+	if err := c.Call(ctx, protocol.MethodTextDocumentCodeAction, nil, &actions); err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 {
+		t.Fatalf("got %d code actions, want the 2 running a command", len(actions))
+	}
+	for _, a := range actions {
+		if a.Edit != nil || a.Command == nil {
+			t.Errorf("code action %q kept its edit or lost its command", a.Title)
+		}
+	}
+	var resolved protocol.CodeAction
+	if err := c.Call(ctx, protocol.MethodCodeActionResolve, nil, &resolved); err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Title != "edit" || resolved.Edit != nil {
+		t.Errorf("resolved code action %+v, want its edit removed", resolved)
+	}
+
+	if err := s.ApplyEdit(ctx, "edit", *edit); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("ApplyEdit returned %v, want ErrReadOnly", err)
+	}
+	if err := s.Call(ctx, protocol.MethodWorkspaceApplyEdit, protocol.ApplyWorkspaceEditParams{Edit: *edit}, nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Call of applyEdit returned %v, want ErrReadOnly", err)
+	}
+
+	// 5 answers, 2 code actions, 1 resolved and 2 applyEdit
+	if got := s.Stats().BlockedEdits; got != 10 {
+		t.Errorf("counted %d blocked edits, want 10", got)
+	}
+}
+
+// TestReadOnlyKeepsNullAnswers checks a null result is not counted as a blocked edit.
+func TestReadOnlyKeepsNullAnswers(t *testing.T) {
+	s, c := startServer(t, func(s *Server) {
+		if err := s.Register(protocol.MethodTextDocumentRename, func(ctx context.Context) (*protocol.WorkspaceEdit, error) {
+			return nil, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}, WithReadOnly())
+	ctx := testContext(t)
+	if _, err := c.Initialize(ctx, &protocol.InitializeParams{}); err != nil {
+		t.Fatal(err)
+	}
+	var result json.RawMessage
+	if err := c.Call(ctx, protocol.MethodTextDocumentRename, nil, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 0 {
+		t.Errorf("rename answered %s, want null", result)
+	}
+	if got := s.Stats().BlockedEdits; got != 0 {
+		t.Errorf("counted %d blocked edits, want 0", got)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrDynamicRegistrationUnsupported is returned when the client can't register a capability dynamically.
+var ErrDynamicRegistrationUnsupported = errors.New("client does not support dynamic registration")
+
+// RegisterCapability asks the client to enable capabilities dynamically (client/registerCapability).
+// Registration IDs are generated when empty. The client must be initialized, see OnInitialized.
+// The request is retried with DefaultRetryPolicy when the client answers with a retryable error.
+func (s *Server) RegisterCapability(ctx context.Context, registrations ...protocol.Registration) ([]protocol.Registration, error) {
+	for i := range registrations {
+		if registrations[i].ID == "" {
+			registrations[i].ID = registrations[i].Method + "-" + strconv.FormatInt(s.nextRegistrationID.Add(1), 10)
+		}
+	}
+	params := &protocol.RegistrationParams{Registrations: registrations}
+	if err := s.CallWithRetry(ctx, DefaultRetryPolicy, protocol.MethodClientRegisterCapability, params, nil); err != nil {
+		return nil, fmt.Errorf("failed to register capabilities: %w", err)
+	}
+	return registrations, nil
+}
+
+// UnregisterCapability disables capabilities previously enabled with RegisterCapability.
+func (s *Server) UnregisterCapability(ctx context.Context, registrations ...protocol.Registration) error {
+	params := &protocol.UnregistrationParams{}
+	for _, r := range registrations {
+		params.Unregisterations = append(params.Unregisterations, protocol.Unregistration{ID: r.ID, Method: r.Method})
+	}
+	if err := s.CallWithRetry(ctx, DefaultRetryPolicy, protocol.MethodClientUnregisterCapability, params, nil); err != nil {
+		return fmt.Errorf("failed to unregister capabilities: %w", err)
+	}
+	return nil
+}
+
+// WatchFiles asks the client to send workspace/didChangeWatchedFiles notifications for
+// the files matching the watchers, handled by the hooks added with OnFilesChanged and the
+// handler registered for that method.
+// It returns ErrDynamicRegistrationUnsupported when the client can't watch files for us.
+func (s *Server) WatchFiles(ctx context.Context, watchers ...protocol.FileSystemWatcher) (protocol.Registration, error) {
+	caps := s.ClientCapabilities()
+	if caps.Workspace == nil || caps.Workspace.DidChangeWatchedFiles == nil ||
+		!caps.Workspace.DidChangeWatchedFiles.DynamicRegistration {
+		return protocol.Registration{}, ErrDynamicRegistrationUnsupported
+	}
+	registrations, err := s.RegisterCapability(ctx, protocol.Registration{
+		Method:          protocol.MethodWorkspaceDidChangeWatchedFiles,
+		RegisterOptions: protocol.DidChangeWatchedFilesRegistrationOptions{Watchers: watchers},
+	})
+	if err != nil {
+		return protocol.Registration{}, err
+	}
+	return registrations[0], nil
+}
+
+// OnInitialized adds a function called once the client sent the initialized notification.
+// This is the earliest point the server can send requests to the client,
+// e.g. to register capabilities dynamically.
+func (s *Server) OnInitialized(fn func(ctx context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initializedHooks = append(s.initializedHooks, fn)
+}
+
+// omitDynamicCapabilities removes from caps the capabilities of the methods of
+// WithDynamicRegistration the client can register dynamically, the server registers them.
+func (s *Server) omitDynamicCapabilities(caps *protocol.ServerCapabilities) {
+	clientCaps := s.ClientCapabilities()
+	for _, method := range s.dynamicMethods {
+		if !clientCaps.SupportsDynamicRegistration(method) {
+			continue
+		}
+		switch method {
+		case protocol.MethodTextDocumentHover:
+			caps.HoverProvider = nil
+		case protocol.MethodTextDocumentCompletion:
+			caps.CompletionProvider = nil
+		case protocol.MethodTextDocumentDefinition:
+			caps.DefinitionProvider = nil
+		case protocol.MethodTextDocumentDeclaration:
+			caps.DeclarationProvider = nil
+		case protocol.MethodTextDocumentTypeDefinition:
+			caps.TypeDefinitionProvider = nil
+		case protocol.MethodTextDocumentImplementation:
+			caps.ImplementationProvider = nil
+		case protocol.MethodTextDocumentCodeAction:
+			caps.CodeActionProvider = nil
+		case protocol.MethodTextDocumentRename:
+			caps.RenameProvider = nil
+		case protocol.MethodTextDocumentFormatting:
+			caps.DocumentFormattingProvider = nil
+		case protocol.MethodTextDocumentRangeFormatting:
+			caps.DocumentRangeFormattingProvider = nil
+		case protocol.MethodWorkspaceSymbol:
+			caps.WorkspaceSymbolProvider = nil
+		default:
+			s.logger.Printf("No static capability to omit for %s, registered dynamically", method)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// PrepareRenameDefault answers a textDocument/prepareRename request renaming the word at the
+// position, for servers without a smarter notion of symbols. It returns
+// {defaultBehavior: true} to clients computing the identifier themselves, and the range of
+// the word to the others, computed from the document store. It returns nil (null, no
+// rename possible) when the document is not open or the position is not on a word.
+func (s *Server) PrepareRenameDefault(params *protocol.PrepareRenameParams) *protocol.PrepareRenameResult {
+	if s.ClientCapabilities().SupportsPrepareRenameDefaultBehavior() {
+		return protocol.PrepareRenameDefault()
+	}
+	snapshot, ok := s.documents.Get(params.TextDocument.URI)
+	if !ok {
+		return nil
+	}
+	_, rng, ok := snapshot.WordAt(params.Position)
+	if !ok {
+		return nil
+	}
+	return protocol.PrepareRenameRange(rng)
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ShutdownReason is why the server stopped, see ShutdownReport.
+type ShutdownReason string
+
+const (
+	// ShutdownExit is the exit notification of the client, which ends the process.
+	ShutdownExit ShutdownReason = "exit"
+	// ShutdownEOF is the client closing the connection.
+	ShutdownEOF ShutdownReason = "eof"
+	// ShutdownCanceled is the context of Run cancelled by the program.
+	ShutdownCanceled ShutdownReason = "canceled"
+	// ShutdownInitTimeout is the client not initializing in time, see WithInitTimeout.
+	ShutdownInitTimeout ShutdownReason = "initTimeout"
+	// ShutdownFatal is an error of the connection, e.g. a malformed header.
+	ShutdownFatal ShutdownReason = "fatal"
+	// ShutdownUnauthorized is the connection refused by the Authorizer, see WithAuthorizer.
+	ShutdownUnauthorized ShutdownReason = "unauthorized"
+)
+
+// ShutdownReport describes how the server stopped, so that supervisors and tests can tell a
+// clean termination from a dirty one, see WithShutdownReport.
+type ShutdownReport struct {
+	Reason ShutdownReason `json:"reason"`
+	// Clean is true when the client requested the shutdown before the server stopped, as the
+	// spec requires.
+	Clean bool `json:"clean"`
+	// Err is the error returned by Run, nil after an exit notification.
+	Err error `json:"-"`
+	// InFlight is the number of requests from the client still being handled when the
+	// server stopped, they were never answered.
+	InFlight int `json:"inFlight"`
+	// Dropped is the number of requests answered without being handled because the server
+	// was overloaded, see WithOverloadShedding.
+	Dropped uint64 `json:"dropped"`
+	// Duration is how long the server ran, from the start of Run.
+	Duration time.Duration `json:"duration"`
+	// ShutdownDuration is the time from the shutdown request to the stop, 0 without one.
+	ShutdownDuration time.Duration `json:"shutdownDuration"`
+}
+
+// shutdownReporter builds the report of the server once it stopped.
+type shutdownReporter struct {
+	fn         func(ShutdownReport) // Optional, see WithShutdownReport
+	runAt      atomic.Int64         // Unix nanoseconds of the start of Run
+	shutdownAt atomic.Int64         // Unix nanoseconds of the shutdown request
+
+	once   sync.Once
+	mu     sync.Mutex
+	report *ShutdownReport
+}
+
+// ShutdownReport returns the report of the server once it stopped, ok is false while it runs.
+func (s *Server) ShutdownReport() (report ShutdownReport, ok bool) {
+	s.reporter.mu.Lock()
+	defer s.reporter.mu.Unlock()
+	if s.reporter.report == nil {
+		return ShutdownReport{}, false
+	}
+	return *s.reporter.report, true
+}
+
+// reportShutdown records the report of the stop, and calls the WithShutdownReport callback.
+// Only the first stop is reported: the connection closed by exit also ends Run.
+func (s *Server) reportShutdown(reason ShutdownReason, err error) {
+	s.reporter.once.Do(func() {
+		now := time.Now()
+		report := ShutdownReport{
+			Reason:  reason,
+			Clean:   s.currentState() == stateShutdown,
+			Err:     err,
+			Dropped: s.stats.shedRequests.Load(),
+		}
+		s.inflightMu.Lock()
+		report.InFlight = len(s.inflight)
+		s.inflightMu.Unlock()
+		if at := s.reporter.runAt.Load(); at != 0 {
+			report.Duration = now.Sub(time.Unix(0, at))
+		}
+		if at := s.reporter.shutdownAt.Load(); at != 0 {
+			report.ShutdownDuration = now.Sub(time.Unix(0, at))
+		}
+
+		s.reporter.mu.Lock()
+		s.reporter.report = &report
+		s.reporter.mu.Unlock()
+		s.logger.Printf("Server stopped: %s (clean: %v, in flight: %d, dropped: %d, ran %s)",
+			report.Reason, report.Clean, report.InFlight, report.Dropped, report.Duration.Round(time.Millisecond))
+		if s.reporter.fn != nil {
+			s.reporter.fn(report)
+		}
+	})
+}
+
+// shutdownReason returns the reason of a stop ending Run with err.
+func shutdownReason(err error) ShutdownReason {
+	switch {
+	case err == nil, errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.ErrClosedPipe):
+		return ShutdownEOF
+	case errors.Is(err, ErrInitTimeout):
+		return ShutdownInitTimeout
+	case errors.Is(err, ErrUnauthorized):
+		return ShutdownUnauthorized
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ShutdownCanceled
+	}
+	return ShutdownFatal
+}
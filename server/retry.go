@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// RetryPolicy controls how CallWithRetry sends a request again after a retryable error.
+// The delay before each retry doubles from InitialDelay up to MaxDelay, and is jittered
+// so that several servers don't retry in lockstep.
+type RetryPolicy struct {
+	MaxAttempts  int           // Including the first one, 0 or 1 disables retries
+	InitialDelay time.Duration // Delay before the first retry
+	MaxDelay     time.Duration // Cap of the delay between attempts, 0 means no cap
+	// Jitter is the fraction of the delay drawn at random, between 0 and 1. A delay of 1s with
+	// a jitter of 0.5 is between 500ms and 1s.
+	Jitter float64
+}
+
+// DefaultRetryPolicy makes up to 4 attempts over about 2 seconds.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  4,
+	InitialDelay: 250 * time.Millisecond,
+	MaxDelay:     2 * time.Second,
+	Jitter:       0.5,
+}
+
+// delay returns the delay before the retry following the attempt (0 based).
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	d := p.InitialDelay
+	for i := 0; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if jitter := min(max(p.Jitter, 0), 1); jitter > 0 && d > 0 {
+		d -= time.Duration(rand.Float64() * jitter * float64(d))
+	}
+	return d
+}
+
+// retrySafeMethods are the requests to the client which can be sent again without side
+// effects. Edits, user prompts or progress creation must not be repeated.
+var retrySafeMethods = map[string]bool{
+	protocol.MethodClientRegisterCapability:   true, // Registrations keep their ID, a retry re-registers the same
+	protocol.MethodClientUnregisterCapability: true,
+	protocol.MethodWorkspaceConfiguration:     true,
+}
+
+// CallWithRetry is Call, sending the request again per policy while the client answers with
+// an error jsonrpc2.IsRetryable classifies as such. Only requests which are safe to repeat,
+// such as client/registerCapability or workspace/configuration, are retried, others are
+// sent once. The error of the last attempt is returned.
+func (s *Server) CallWithRetry(ctx context.Context, policy RetryPolicy, method string, params any, result any) error {
+	attempts := policy.MaxAttempts
+	if !retrySafeMethods[method] || attempts < 1 {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			delay := policy.delay(attempt - 1)
+			s.logger.Printf("Retrying request %s in %s (attempt %d/%d): %v", method, delay, attempt+1, attempts, err)
+			timer := time.NewTimer(delay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+		err = s.Call(ctx, method, params, result)
+		if err == nil || !jsonrpc2.IsRetryable(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -3,29 +3,110 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic" // For atomic state checks
 	"time"
 
 	"github.com/akhenakh/lspgo/jsonrpc2"
 	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
 )
 
 // Server represents an LSP server.
 type Server struct {
 	conn         *jsonrpc2.Conn
 	handlers     map[string]*typedHandler // Value is now pointer
+	commands     map[string]*typedHandler // workspace/executeCommand handlers keyed by command
 	mu           sync.RWMutex
 	state        atomic.Value // Stores serverState (uninitialized, initializing, running, shutdown)
+	trace        atomic.Value // Stores the protocol.TraceValue, see Trace
 	shutdownOnce sync.Once
 	pendingReqs  sync.WaitGroup
 	logger       *log.Logger
 	initParams   *protocol.InitializeParams // Store params from client
 	initResult   *protocol.InitializeResult // Store result we sent
+	stats        *statsRecorder
+	diagnostics  *DiagnosticsManager
+	documents    *textdocument.Store // Open documents, see Documents
+
+	// Requests sent to the client, see Call
+	pendingMu    sync.Mutex
+	pendingCalls map[string]chan *jsonrpc2.ResponseMessage
+	// Calls whose caller stopped waiting, see abandonCall
+	abandonedCalls      map[string]abandonedCall
+	lateResponseHandler func(LateResponse) // See WithLateResponseHandler
+	callTimeout         time.Duration      // See WithCallTimeout
+	writeHighWater      int                // See WaitWritable
+	configSchema        *ConfigurationSchema
+	includeTextOnSave   bool // See WithIncludeTextOnSave
+
+	nextRegistrationID atomic.Int64                // See RegisterCapability
+	initializedHooks   []func(ctx context.Context) // See OnInitialized
+	initializedPending atomic.Bool                 // Running, the hooks were not run yet, see beginRunning
+	errTranslators     []ErrorTranslator           // See RegisterErrorTranslator
+	fileChangeHooks    []FileChangeHook            // See OnFilesChanged
+	documentHooks      []DocumentHook              // See OnDocumentChanged
+
+	codeActionPreference CodeActionPreference      // See CodeActionMode
+	codeActionKinds      []protocol.CodeActionKind // See DeclareCodeActionKinds
+	namespaces           map[string]*Namespace     // Custom method namespaces by prefix, see DeclareNamespace
+	experimental         map[string]any            // See DeclareExperimental
+
+	noMessageRequests atomic.Bool    // The client answered window/showMessageRequest with MethodNotFound
+	capSync           capabilitySync // Capabilities of the handlers registered later, see syncCapabilities
+
+	folders workspaceFolders // See WorkspaceFolders
+
+	progressTokens *protocol.ProgressTokenGenerator
+	progressMu     sync.Mutex
+	progress       map[protocol.ProgressToken]*Progress // Active progress, see StartProgress
+	debugAddr      string                               // Optional address of the debug HTTP listener
+	lastErr        lastError                            // See Health
+
+	bgCtx    context.Context // See BackgroundContext
+	bgCancel context.CancelFunc
+
+	// Requests from the client being handled by ID, with the cancellation of their context
+	// once dispatched, see beginRequest
+	inflightMu sync.Mutex
+	inflight   map[string]func()
+	queued     atomic.Int64    // Messages dispatched and not handled yet, see shed
+	overload   *OverloadPolicy // See WithOverloadShedding
+
+	dynamicMethods []string // See WithDynamicRegistration
+	readOnly       bool     // See WithReadOnly
+
+	positionEncodingPolicy PositionEncodingPolicy // See WithPositionEncodingPolicy
+
+	docOrder documentOrder // Order of the text synchronization handlers, see trackDocument
+
+	// Initialization watchdog, see WithInitTimeout
+	initTimeout       time.Duration
+	initTimeoutNotify bool
+	initializeAt      atomic.Int64 // Unix nanoseconds of the initialize response
+
+	initializeHooks []InitializeHook // See OnInitialize
+	initializeRetry bool             // See WithInitializeRetry
+
+	session *sessionStore // Saved session, nil without WithSessionFile
+
+	validateResults bool // See WithResultValidation
+
+	states stateBag // Per-connection state, see StateOf
+
+	reporter shutdownReporter // See ShutdownReport
+
+	authorizer     *Authorizer                               // See WithAuthorizer
+	peerAddr       net.Addr                                  // Address of the stream, see Peer
+	authorizedInit atomic.Pointer[protocol.InitializeParams] // Accepted by the Authorizer
 }
 
 // serverState represents the lifecycle state of the server.
@@ -42,9 +123,21 @@ const (
 // It typically communicates over stdin/stdout.
 func NewServer(opts ...Option) *Server {
 	s := &Server{
-		handlers: make(map[string]*typedHandler), // Store pointers
-		logger:   log.New(os.Stderr, "lsp: ", log.LstdFlags),
+		handlers:  make(map[string]*typedHandler), // Store pointers
+		commands:  make(map[string]*typedHandler),
+		stats:     newStatsRecorder(),
+		documents: textdocument.NewStore(),
+
+		pendingCalls:   make(map[string]chan *jsonrpc2.ResponseMessage),
+		abandonedCalls: make(map[string]abandonedCall),
+		inflight:       make(map[string]func()),
+		namespaces:     make(map[string]*Namespace),
+		progressTokens: protocol.NewProgressTokenGenerator("lspgo"),
+		progress:       make(map[protocol.ProgressToken]*Progress),
+		logger:         log.New(os.Stderr, "lsp: ", log.LstdFlags),
 	}
+	s.diagnostics = newDiagnosticsManager(s)
+	s.bgCtx, s.bgCancel = context.WithCancel(context.Background())
 	s.state.Store(stateUninitialized)
 
 	// Apply options
@@ -53,13 +146,62 @@ func NewServer(opts ...Option) *Server {
 		opt(options)
 	}
 	s.logger = options.logger
+	s.debugAddr = options.debugAddr
+	s.initTimeout = options.initTimeout
+	s.validateResults = options.validateResults
+	s.lateResponseHandler = options.lateResponseHandler
+	s.callTimeout = options.callTimeout
+	s.writeHighWater = options.writeHighWater
+	if s.writeHighWater <= 0 {
+		s.writeHighWater = DefaultWriteHighWater
+	}
+	s.states.values = make(map[reflect.Type]any)
+	s.states.inits = options.stateInits
+	s.initTimeoutNotify = options.initTimeoutNotify
+	s.initializeRetry = options.initializeRetry
+	s.configSchema = options.configSchema
+	s.includeTextOnSave = options.includeTextOnSave
+	s.overload = options.overload
+	s.dynamicMethods = options.dynamicMethods
+	s.readOnly = options.readOnly
+	s.reporter.fn = options.shutdownReport
+	s.authorizer = options.authorizer
+	s.peerAddr = streamAddr(options.stream)
+	s.positionEncodingPolicy = options.positionEncodingPolicy
+	s.codeActionPreference = options.codeActionPreference
+	if options.sessionFile != "" {
+		s.session = newSessionStore(options.sessionFile, s)
+	}
 
 	// Setup connection using the configured stream
-	stream := jsonrpc2.NewStream(options.stream)
+	stream := jsonrpc2.NewStreamWithCodec(options.stream, options.codec)
+	if options.contentHandling != nil {
+		stream.SetContentHandling(*options.contentHandling)
+	}
 	s.conn = jsonrpc2.NewConn(stream)
+	stallThreshold, onStall := options.writeStallThreshold, options.writeStallHandler
+	if stallThreshold <= 0 {
+		stallThreshold = DefaultWriteStallThreshold
+	}
+	if onStall == nil {
+		onStall = s.logWriteStall
+	}
+	s.conn.SetWriteStallHandler(stallThreshold, onStall)
+	s.conn.SetFlushErrorHandler(func(err error) {
+		s.logger.Printf("Error writing queued notifications, dropped: %v", err)
+	})
+	if options.idGenerator != nil {
+		s.conn.SetIDGenerator(options.idGenerator)
+	}
 
 	// Register standard handlers
 	s.registerDefaultHandlers()
+	if options.healthRequest {
+		s.Register(MethodHealth, s.handleHealth)
+	}
+	if s.configSchema != nil {
+		s.Register(MethodConfigurationSchema, s.handleConfigurationSchema)
+	}
 
 	return s
 }
@@ -74,18 +216,14 @@ func (s *Server) registerDefaultHandlers() {
 	s.Register(protocol.MethodExit, s.handleExit)               // func(ctx)
 	s.Register(protocol.MethodCancelRequest, s.handleCancel)    // Example: func(ctx, params)
 	s.Register(protocol.MethodProgress, s.handleProgress)       // Example: func(ctx, params)
+	s.Register(protocol.MethodWorkDoneProgressCancel, s.handleProgressCancel)
+	s.Register(protocol.MethodSetTrace, s.handleSetTrace)
 }
 
 // Register associates a handler function with an LSP method name.
 // The handler func must match the expected signature patterns (see handler.go).
+// Handlers are called through reflection, HandleRequest and HandleNotification avoid it.
 func (s *Server) Register(method string, handlerFunc any) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	if _, exists := s.handlers[method]; exists {
-		return fmt.Errorf("handler already registered for method: %s", method)
-	}
-
 	// Validate and get metadata about the handler signature
 	paramType, takesConn, takesParams, err := validateHandlerFunc(handlerFunc)
 	if err != nil {
@@ -93,27 +231,81 @@ func (s *Server) Register(method string, handlerFunc any) error {
 	}
 
 	// Store the handler along with its metadata
-	s.handlers[method] = &typedHandler{
+	return s.addHandler(method, &typedHandler{
 		h:           handlerFunc,
 		paramType:   paramType,
 		takesConn:   takesConn,
 		takesParams: takesParams,
+	})
+}
+
+// addHandler stores the handler of a method, which must not have one yet.
+func (s *Server) addHandler(method string, handler *typedHandler) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.handlers[method]; exists {
+		return fmt.Errorf("handler already registered for method: %s", method)
 	}
-	s.logger.Printf("Registered handler for method: %s (takesConn: %v, takesParams: %v, paramType: %v)",
-		method, takesConn, takesParams, paramType)
+	s.handlers[method] = handler
+	s.logger.Printf("Registered handler for method: %s (takesConn: %v, takesParams: %v, paramType: %v, direct: %v)",
+		method, handler.takesConn, handler.takesParams, handler.paramType, handler.direct != nil)
+	s.capabilitiesChanged() // Synced once s.mu is released
 	return nil
 }
 
 // Run starts the server's main loop, reading and processing messages.
 // It blocks until the connection is closed or the server exits.
-func (s *Server) Run(ctx context.Context) error {
+func (s *Server) Run(ctx context.Context) (err error) {
 	s.logger.Println("Server starting listener loop...")
+	s.reporter.runAt.Store(time.Now().UnixNano())
+	runCtx := ctx // ctx is replaced below, the report needs the one of the caller
 	defer s.logger.Println("Server listener loop stopped.")
+	defer s.stopBackground("server stopped")
+	defer func() {
+		// Cancellation is how callers stop the server, not a failure
+		if err != nil && !errors.Is(err, context.Canceled) {
+			s.lastErr.set(err)
+		}
+		reason := shutdownReason(err)
+		if reason != ShutdownInitTimeout && runCtx.Err() != nil {
+			// The read error depends on how the closed connection failed
+			reason = ShutdownCanceled
+		}
+		s.reportShutdown(reason, err)
+	}()
+
+	if s.initTimeout > 0 {
+		var stop context.CancelCauseFunc
+		ctx, stop = context.WithCancelCause(ctx)
+		defer stop(nil)
+		defer func() {
+			// Whatever the read loop saw of the closed connection, report why it was closed
+			if cause := context.Cause(ctx); errors.Is(cause, ErrInitTimeout) {
+				err = cause
+			}
+		}()
+		go s.watchInitialization(ctx, s.initTimeout, stop)
+	}
 
 	// Create a done channel to signal when we're exiting
 	done := make(chan struct{})
 	defer close(done)
 
+	if s.debugAddr != "" {
+		debugCtx, cancelDebug := context.WithCancel(ctx)
+		defer cancelDebug()
+		if err := s.startDebugListener(debugCtx, s.debugAddr); err != nil {
+			// The debug listener is optional, don't prevent the server from running
+			s.logger.Printf("Failed to start debug listener on %s: %v", s.debugAddr, err)
+		}
+	}
+
+	if err := s.authorizeConnection(ctx); err != nil {
+		s.conn.Close() //nolint:errcheck
+		return err
+	}
+
 	// Set up a goroutine to handle clean context cancellation
 	go func() {
 		select {
@@ -140,7 +332,8 @@ func (s *Server) Run(ctx context.Context) error {
 		msg, err := s.conn.Read(ctx) // Pass context for cancellation during read
 		if err != nil {
 			// Determine if the error is fatal or recoverable
-			if err == io.EOF || err == io.ErrClosedPipe || err == context.Canceled || err == context.DeadlineExceeded {
+			// Stream errors wrap the read failure, e.g. "failed to read header line: EOF"
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 				// Expected closure or cancellation
 				s.logger.Printf("Connection closed or context cancelled, exiting run loop: %v", err)
 
@@ -152,33 +345,84 @@ func (s *Server) Run(ctx context.Context) error {
 				// Check state: if not shutdown gracefully, maybe log an error?
 				s.logger.Println("Client closed connection unexpectedly or context cancelled before shutdown.")
 				// Consider specific error types? For now, just return the original error.
-				if err == io.EOF {
+				if errors.Is(err, io.EOF) {
 					return io.ErrUnexpectedEOF // Indicate unclean shutdown
 				}
 				return err
 			}
 
-			// Log other read errors (e.g., JSON parsing errors within Read)
+			// A message which can't be decoded doesn't desync the stream, skip it
+			var msgErr *jsonrpc2.MessageError
+			if errors.As(err, &msgErr) {
+				s.logger.Printf("Skipping invalid message: %v", err)
+				if msgErr.ID != nil {
+					s.sendResponse(ctx, msgErr.ID, nil, msgErr.Err)
+				}
+				continue
+			}
+
+			// Log other read errors (e.g., invalid headers or a truncated message)
 			s.logger.Printf("Error reading message: %v", err)
+			// The stream position is unknown after them (network, framing, etc.), assume fatal.
+			return fmt.Errorf("fatal error reading message: %w", err)
+		}
 
-			// Try to send error response if possible (e.g., if it was a jsonrpc2 format error)
-			if jsonErr, ok := err.(*jsonrpc2.ErrorObject); ok {
-				// We don't have an ID here. Cannot send a proper response.
-				// Log and continue? Or is it fatal? Likely fatal.
-				s.logger.Printf("Fatal JSON-RPC format error: %v", jsonErr)
+		// Before anything depends on the message
+		if ok, err := s.authorizeMessage(ctx, msg); err != nil {
+			s.conn.Close() //nolint:errcheck
+			return err
+		} else if !ok {
+			continue
+		}
+
+		// Duplicates are detected here, the goroutines of the original requests may not have started yet
+		var requestID string
+		if req, ok := msg.(*jsonrpc2.RequestMessage); ok {
+			requestID = string(req.ID)
+			if !s.beginRequest(requestID) {
+				s.rejectDuplicateRequest(ctx, req)
+				continue
 			}
-			// For other errors (network, etc.), assume fatal.
-			return fmt.Errorf("fatal error reading message: %w", err)
+		}
+
+		// Document changes must be applied in order, don't wait for the goroutines
+		s.beginRunning(msg)
+		var waitDocument, doneDocument func()
+		if uri := s.trackDocument(msg); uri != "" {
+			// The handlers of the notifications of a document run in order too
+			waitDocument, doneDocument = s.docOrder.enqueue(uri)
+		}
+		s.trackSession(msg)
+		s.trackFolders(msg)
+		msgCtx := s.withSnapshot(ctx, msg)
+		msgCtx = s.withProgressTokens(msgCtx, msg)
+		var releaseID func()
+		cancelRequest := func() {}
+		if requestID != "" {
+			msgCtx, releaseID, cancelRequest = s.withInflightRequest(msgCtx, requestID)
 		}
 
 		// Process the message in a separate goroutine for concurrency
 		s.pendingReqs.Add(1)
+		depth := s.queued.Add(1)
 		go func(m any) {
 			defer s.pendingReqs.Done()
+			defer s.queued.Add(-1)
+			defer cancelRequest()
+			if releaseID != nil {
+				defer releaseID() // Unless sendResponse did
+			}
+			if doneDocument != nil {
+				defer doneDocument()
+				waitDocument()
+			}
+			if s.shed(msgCtx, m, depth) {
+				return
+			}
 			// Create a per-message context if needed, inheriting from the main one
-			// msgCtx, cancel := context.WithTimeout(ctx, 30*time.Second) // Example timeout
+			// msgCtx, cancel := context.WithTimeout(msgCtx, 30*time.Second) // Example timeout
 			// defer cancel()
-			s.handleMessage(ctx, m) // Pass original context for now
+			s.handleMessage(msgCtx, m)
 		}(msg)
 	}
 }
@@ -197,9 +441,8 @@ func (s *Server) handleMessage(ctx context.Context, msg interface{}) {
 	case *jsonrpc2.NotificationMessage:
 		s.handleNotification(ctx, m)
 	case *jsonrpc2.ResponseMessage:
-		// LSP servers typically don't receive responses (they send them)
-		// unless they are also acting as a client for some reason.
-		s.logger.Printf("Received unexpected Response: ID=%s", string(m.ID))
+		// Responses answer the requests we sent to the client with Call
+		s.handleResponse(m)
 	default:
 		// Should not happen if jsonrpc2.Conn.Read works correctly
 		s.logger.Printf("Received unknown message type: %T", msg)
@@ -212,8 +455,12 @@ func (s *Server) handleRequest(ctx context.Context, req *jsonrpc2.RequestMessage
 	// Use a shorter log format for less noise
 	s.logger.Printf("--> Request: Method=%s, ID=%s", method, string(req.ID))
 
-	// State checks
+	// State checks, health probes and schema queries are answered in any state, but behind
+	// an Authorizer only once the client completed an initialize it accepted
 	currentState := s.currentState()
+	if (method == MethodHealth || method == MethodConfigurationSchema) && s.authorizer == nil {
+		currentState = stateRunning
+	}
 	if currentState == stateShutdown {
 		s.logger.Printf("Rejecting request %s ID=%s during shutdown.", method, string(req.ID))
 		errResp := jsonrpc2.NewError(jsonrpc2.InvalidRequest, "server is shutting down")
@@ -241,23 +488,44 @@ func (s *Server) handleRequest(ctx context.Context, req *jsonrpc2.RequestMessage
 	if !found {
 		s.logger.Printf("No handler found for request method: %s ID=%s", method, string(req.ID))
 		errResp := jsonrpc2.NewError(jsonrpc2.MethodNotFound, fmt.Sprintf("method not found: %s", method))
+		if info, ok := s.namespaceOf(method); ok {
+			// Tell the client what the namespace supports instead
+			errResp.Message = fmt.Sprintf("method not found: %s, namespace version %s supports %s",
+				method, info.Version, strings.Join(info.Methods, ", "))
+			errResp.Data, _ = s.conn.Codec().Marshal(info)
+		}
 		s.sendResponse(ctx, req.ID, nil, errResp)
 		return
 	}
 
 	// Invoke the handler - Pass conn and the params RawMessage directly
 	// The invoke method now correctly takes *jsonrpc2.Conn and json.RawMessage
+	recordStats := s.stats.begin(method, true)
+	start := time.Now()
 	result, err := handler.invoke(ctx, s.conn, req.Params)
+	recordStats(err)
+	if err == nil && s.validateResults {
+		err = s.validateResult(ctx, method, req.Params, result)
+	}
+	if err == nil && s.readOnly {
+		result, err = s.stripEdits(method, result)
+	}
+	s.traceMessage(ctx, "request", method, req.ID, req.Params, time.Since(start), err)
 
 	// Send the response
 	var errResp *jsonrpc2.ErrorObject
+	if errors.Is(context.Cause(ctx), errRequestCancelled) {
+		// The client still expects a response, see handleCancel
+		ctx = context.WithoutCancel(ctx)
+		if err != nil {
+			errResp, err = jsonrpc2.NewError(jsonrpc2.RequestCancelled, "request cancelled"), nil
+		}
+	}
 	if err != nil {
-		// Check if it's already a jsonrpc2 error
-		if jsonErr, ok := err.(*jsonrpc2.ErrorObject); ok {
-			errResp = jsonErr
-		} else {
-			// Wrap other errors as internal server errors
-			errResp = jsonrpc2.NewError(jsonrpc2.InternalError, err.Error())
+		// jsonrpc2 errors and errors with a translator keep their code, see RegisterErrorTranslator
+		var internal bool
+		errResp, internal = s.toErrorObject(err)
+		if internal {
 			// Log the Go error details for internal debugging
 			s.logger.Printf("Internal handler error for method %s ID=%s: %v", method, string(req.ID), err)
 		}
@@ -311,6 +579,16 @@ func (s *Server) handleNotification(ctx context.Context, n *jsonrpc2.Notificatio
 		return // Exit handler terminates, don't continue
 	}
 
+	if method == protocol.MethodWorkspaceDidChangeWatchedFiles {
+		s.filesChanged(ctx, n.Params) // With or without handler
+	}
+	if method == protocol.MethodWorkspaceDidChangeWorkspaceFolders {
+		s.foldersChanged(ctx, n.Params)
+	}
+	if method == protocol.MethodWorkspaceDidChangeConfiguration {
+		s.configurationChanged(ctx, n.Params)
+	}
+
 	s.mu.RLock()
 	handler, found := s.handlers[method]
 	s.mu.RUnlock()
@@ -323,11 +601,17 @@ func (s *Server) handleNotification(ctx context.Context, n *jsonrpc2.Notificatio
 
 	// Invoke the handler, ignore result/error (notifications don't have responses)
 	// The invoke method now correctly takes *jsonrpc2.Conn and json.RawMessage
+	recordStats := s.stats.begin(method, false)
+	start := time.Now()
 	_, err := handler.invoke(ctx, s.conn, n.Params)
+	recordStats(err)
 	if err != nil {
 		// Log handler errors for notifications, but don't send response
 		s.logger.Printf("Handler error processing notification %s: %v", method, err)
 	}
+	if method != protocol.MethodSetTrace && method != protocol.MethodProgress {
+		s.traceMessage(ctx, "notification", method, nil, n.Params, time.Since(start), err)
+	}
 }
 
 // sendResponse marshals and sends a JSON-RPC response.
@@ -349,7 +633,7 @@ func (s *Server) sendResponse(ctx context.Context, id json.RawMessage, result in
 		// Don't log the full error here if it was already logged by the caller
 	} else if result != nil {
 		// Marshal result if non-nil and no error
-		rawResult, err := json.Marshal(result)
+		rawResult, err := s.conn.Codec().Marshal(result)
 		if err != nil {
 			s.logger.Printf("Error marshalling result for ID %s: %v. Sending InternalError instead.", string(id), err)
 			response.Error = jsonrpc2.NewError(jsonrpc2.InternalError, fmt.Sprintf("failed to marshal result: %v", err))
@@ -370,6 +654,9 @@ func (s *Server) sendResponse(ctx context.Context, id json.RawMessage, result in
 	}
 	s.logger.Print(logMsg)
 
+	// The ID is free once the client reads the response, release it before
+	releaseRequest(ctx)
+
 	// Send the response
 	if err := s.conn.Write(ctx, response); err != nil {
 		s.logger.Printf("Error writing response for ID %s: %v", string(id), err)
@@ -384,20 +671,33 @@ func (s *Server) handleInitialize(ctx context.Context, params *protocol.Initiali
 		currentState := s.currentState()
 		errMsg := "server already initialized or is shutting down"
 		s.logger.Printf("Initialize failed: %s (current state: %d)", errMsg, currentState)
-		return nil, jsonrpc2.NewError(jsonrpc2.InvalidRequest, errMsg)
+		return nil, protocol.NewInitializeError(jsonrpc2.InvalidRequest, errMsg, false)
 	}
 	s.logger.Println("Handling initialize request...")
 	s.initParams = params // Store client capabilities etc.
+	s.setTrace(params.Trace)
+	s.initFolders(params)
 
 	// Log client info if available
 	if params.ClientInfo != nil {
 		s.logger.Printf("Client: %s %s", params.ClientInfo.Name, params.ClientInfo.Version)
 	}
 
+	encoding, err := s.negotiatePositionEncoding(params.Capabilities)
+	if err != nil {
+		return nil, s.initializeFailed(err)
+	}
+	if err := s.runInitializeHooks(ctx, params); err != nil {
+		return nil, s.initializeFailed(err)
+	}
+
 	// --- Server Capabilities ---
 	// Determine capabilities based on registered handlers AND specific configurations.
 	// This should ideally inspect the `s.handlers` map.
 	serverCapabilities := s.determineServerCapabilities() // Extract to helper method
+	if params.Capabilities.General != nil && len(params.Capabilities.General.PositionEncodings) > 0 {
+		serverCapabilities.PositionEncoding = encoding // Only clients which negotiate expect it
+	}
 
 	result := &protocol.InitializeResult{
 		Capabilities: serverCapabilities,
@@ -409,10 +709,26 @@ func (s *Server) handleInitialize(ctx context.Context, params *protocol.Initiali
 	s.initResult = result // Store server capabilities etc.
 
 	// DO NOT transition to stateRunning yet. Wait for 'initialized' notification.
+	s.initializeAt.Store(time.Now().UnixNano()) // The watchdog waits for it from now
 	s.logger.Println("Initialize successful, sending capabilities and waiting for 'initialized' notification.")
 	return result, nil
 }
 
+// InitializeParams returns the parameters of the initialize request, nil before initialization.
+// The returned value must not be modified.
+func (s *Server) InitializeParams() *protocol.InitializeParams {
+	return s.initParams
+}
+
+// ClientCapabilities returns the capabilities sent by the client in the initialize request,
+// they are empty before initialization.
+func (s *Server) ClientCapabilities() protocol.ClientCapabilities {
+	if s.initParams == nil {
+		return protocol.ClientCapabilities{}
+	}
+	return s.initParams.Capabilities
+}
+
 // determineServerCapabilities inspects registered handlers to build the capabilities struct.
 func (s *Server) determineServerCapabilities() protocol.ServerCapabilities {
 	s.mu.RLock()
@@ -420,28 +736,21 @@ func (s *Server) determineServerCapabilities() protocol.ServerCapabilities {
 
 	caps := protocol.ServerCapabilities{}
 
-	// Text Document Sync: Check for didOpen, didChange, didClose handlers
-	// Assuming full sync if didChange is registered. Needs more nuance for incremental.
-	_, hasOpen := s.handlers[protocol.MethodTextDocumentDidOpen]
-	_, hasChange := s.handlers[protocol.MethodTextDocumentDidChange]
-	_, hasClose := s.handlers[protocol.MethodTextDocumentDidClose]
-	_, hasSave := s.handlers[protocol.MethodTextDocumentDidSave] // Add if implementing save
-
-	if hasOpen || hasChange || hasClose || hasSave {
-		// Default to Full sync if Change is handled. This might need configuration.
-		syncKind := protocol.SyncFull
-		// TODO: Add config option or check handler signature for incremental support?
-		caps.TextDocumentSync = &protocol.TextDocumentSyncOptions{
-			OpenClose: hasOpen || hasClose,
-			Change:    syncKind,
-			// WillSave: ..., WillSaveWaitUntil: ..., Save: ... // Add based on registered handlers
-		}
-		// If textDocument/didSave is handled, advertise Save capability
-		if hasSave {
-			// Simple true for now, could be SaveOptions
-			// caps.TextDocumentSync.Save = true // This field doesn't exist, need SaveOptions
-			caps.TextDocumentSync.Save = &protocol.SaveOptions{IncludeText: false} // Or true if needed
-		}
+	// Text Document Sync: always requested, the server keeps the document store up to date.
+	// Full sync for the handlers expecting the whole text in didChange.
+	_, hasSave := s.handlers[protocol.MethodTextDocumentDidSave]
+	_, hasWillSave := s.handlers[protocol.MethodTextDocumentWillSave]
+	_, hasWillSaveWaitUntil := s.handlers[protocol.MethodTextDocumentWillSaveWaitUntil]
+	caps.TextDocumentSync = &protocol.TextDocumentSyncOptions{
+		OpenClose:         true,
+		Change:            protocol.SyncFull,
+		WillSave:          hasWillSave,
+		WillSaveWaitUntil: hasWillSaveWaitUntil,
+	}
+	// If textDocument/didSave is handled, advertise Save capability. With WithIncludeTextOnSave
+	// it is always advertised, the document store needs the saved text.
+	if hasSave || s.includeTextOnSave {
+		caps.TextDocumentSync.Save = &protocol.SaveOptions{IncludeText: s.includeTextOnSave}
 	}
 
 	// Hover: Check for textDocument/hover
@@ -468,16 +777,44 @@ func (s *Server) determineServerCapabilities() protocol.ServerCapabilities {
 		caps.DefinitionProvider = &protocol.DefinitionOptions{} // Can be bool or options
 	}
 
+	// The other goto requests
+	if _, ok := s.handlers[protocol.MethodTextDocumentDeclaration]; ok {
+		caps.DeclarationProvider = &protocol.DeclarationOptions{}
+	}
+	if _, ok := s.handlers[protocol.MethodTextDocumentTypeDefinition]; ok {
+		caps.TypeDefinitionProvider = &protocol.TypeDefinitionOptions{}
+	}
+	if _, ok := s.handlers[protocol.MethodTextDocumentImplementation]; ok {
+		caps.ImplementationProvider = &protocol.ImplementationOptions{}
+	}
+
+	// Rename, checked beforehand with textDocument/prepareRename when implemented
+	if _, ok := s.handlers[protocol.MethodTextDocumentRename]; ok {
+		caps.RenameProvider = &protocol.RenameOptions{}
+		if _, ok := s.handlers[protocol.MethodTextDocumentPrepareRename]; ok {
+			caps.RenameProvider.PrepareProvider = true
+		}
+	}
+
+	// References: Check for textDocument/references
+	if _, ok := s.handlers[protocol.MethodTextDocumentReferences]; ok {
+		caps.ReferencesProvider = &protocol.ReferenceOptions{}
+	}
+
+	// Workspace Symbol: Check for workspace/symbol and workspaceSymbol/resolve
+	if _, ok := s.handlers[protocol.MethodWorkspaceSymbol]; ok {
+		opts := &protocol.WorkspaceSymbolOptions{}
+		if _, okResolve := s.handlers[protocol.MethodWorkspaceSymbolResolve]; okResolve {
+			opts.ResolveProvider = true
+		}
+		caps.WorkspaceSymbolProvider = opts
+	}
+
 	// Code Action: Check for textDocument/codeAction
 	if _, ok := s.handlers[protocol.MethodTextDocumentCodeAction]; ok {
 		// Advertise CodeActionOptions. Can be bool or options.
-		opts := &protocol.CodeActionOptions{
-			// Define specific kinds supported, if known
-			// CodeActionKinds: []protocol.CodeActionKind{
-			// 	protocol.QuickFix,
-			// 	protocol.RefactorInline,
-			// },
-		}
+		// The kinds the server produces, if declared, so clients can hide the others
+		opts := &protocol.CodeActionOptions{CodeActionKinds: s.codeActionKinds}
 		// Check if codeAction/resolve is implemented
 		if _, okResolve := s.handlers[protocol.MethodCodeActionResolve]; okResolve {
 			opts.ResolveProvider = true
@@ -485,38 +822,94 @@ func (s *Server) determineServerCapabilities() protocol.ServerCapabilities {
 		caps.CodeActionProvider = opts
 	}
 
+	// Formatting: Check for textDocument/formatting and textDocument/rangeFormatting
+	if _, ok := s.handlers[protocol.MethodTextDocumentFormatting]; ok {
+		caps.DocumentFormattingProvider = &protocol.DocumentFormattingOptions{}
+	}
+	if _, ok := s.handlers[protocol.MethodTextDocumentRangeFormatting]; ok {
+		caps.DocumentRangeFormattingProvider = &protocol.DocumentRangeFormattingOptions{}
+	}
+
 	// Execute Command: Check for workspace/executeCommand
 	if _, ok := s.handlers[protocol.MethodWorkspaceExecuteCommand]; ok {
-		// Need to list the *commands* the server supports. This requires
-		// knowing the command IDs used in handleExecuteCommand.
-		// This info isn't easily available just from registration map keys.
-		// The server implementation needs to provide this list.
-		// For now, advertise basic support. A better way is needed.
+		// Commands are only known when registered through RegisterCommand.
+		// A handler registered directly for workspace/executeCommand advertises none.
 		caps.ExecuteCommandProvider = &protocol.ExecuteCommandOptions{
-			Commands: []string{
-				// TODO: Dynamically discover or explicitly list commands
-				"ollama/executeAction", // Hardcoding from main.go for now
-			},
+			Commands: s.commandNames(),
+		}
+		if schemas := s.commandSchemas(); len(schemas) > 0 {
+			if caps.Experimental == nil {
+				caps.Experimental = make(map[string]any)
+			}
+			caps.Experimental[ExperimentalCommandSchemas] = schemas
+		}
+	}
+
+	for key, value := range s.experimental {
+		if caps.Experimental == nil {
+			caps.Experimental = make(map[string]any)
+		}
+		caps.Experimental[key] = value
+	}
+
+	if s.configSchema != nil {
+		if caps.Experimental == nil {
+			caps.Experimental = make(map[string]any)
+		}
+		caps.Experimental[ExperimentalConfigurationSchema] = s.configSchema
+	}
+
+	if namespaces := s.namespaceInfos(); namespaces != nil {
+		if caps.Experimental == nil {
+			caps.Experimental = make(map[string]any)
 		}
+		caps.Experimental[protocol.ExperimentalNamespaces] = namespaces
+	}
+
+	// Workspace folders: always tracked, see WorkspaceFolders
+	caps.Workspace = &protocol.WorkspaceServerCapabilities{
+		WorkspaceFolders: &protocol.WorkspaceFoldersServerCapabilities{Supported: true, ChangeNotifications: true},
 	}
 
 	// Add other capabilities based on registered handlers...
-	// e.g., formatting, references, rename, diagnostics (pull model), etc.
+	// e.g., references, diagnostics (pull model), etc.
+
+	s.omitDynamicCapabilities(&caps)
 
 	s.logger.Printf("Determined Server Capabilities: %+v", caps) // Log determined caps
 	return caps
 }
 
+// beginRunning switches to the running state when msg is the initialized notification.
+// It runs in the read loop because clients send requests right after initialized, and
+// those are dispatched concurrently with it: they must not see the initializing state.
+// The OnInitialized hooks are run by handleInitialized, they may call the client.
+func (s *Server) beginRunning(msg any) {
+	n, ok := msg.(*jsonrpc2.NotificationMessage)
+	if ok && n.Method == protocol.MethodInitialized && s.state.CompareAndSwap(stateInitializing, stateRunning) {
+		s.initializedPending.Store(true)
+	}
+}
+
 // handleInitialized: func(ctx context.Context, params *protocol.InitializedParams) error
 // Note: LSP spec says params can be null. Our generator made it a struct.
 // Let's accept json.RawMessage and ignore content, or use a pointer *protocol.InitializedParams
 // Changing the handler signature to use pointer.
 func (s *Server) handleInitialized(ctx context.Context, params *protocol.InitializedParams) error {
 	// Received 'initialized' from client. Now we can consider the server fully running.
-	if s.state.CompareAndSwap(stateInitializing, stateRunning) {
+	// The state was switched by beginRunning, in the read loop
+	if s.initializedPending.CompareAndSwap(true, false) {
 		s.logger.Println("Server transitioned to running state.")
-		// Start any background analysis tasks here if needed
-		// s.startBackgroundTasks()
+		s.mu.RLock()
+		hooks := s.initializedHooks
+		s.mu.RUnlock()
+		for _, hook := range hooks {
+			hook(ctx)
+		}
+		// Waits for the client, which may send requests meanwhile
+		go s.recoverSession(s.BackgroundContext())
+		// Handlers registered since the initialize result
+		go s.syncCapabilities(s.BackgroundContext())
 	} else {
 		// Log if received in wrong state, but don't error out client
 		s.logger.Printf("Received 'initialized' notification in unexpected state: %d", s.currentState())
@@ -536,7 +929,9 @@ func (s *Server) handleShutdown(ctx context.Context) error {
 			s.state.CompareAndSwap(stateInitializing, stateShutdown) ||
 			s.state.CompareAndSwap(stateUninitialized, stateShutdown) {
 			s.logger.Println("Server transitioning to shutdown state.")
-			// Cancel any long-running background tasks here using a cancel func derived from main context
+			s.reporter.shutdownAt.Store(time.Now().UnixNano())
+			s.stopBackground("shutdown requested")
+			s.discardSession()
 		} else {
 			s.logger.Printf("Shutdown requested but already in state: %d", s.currentState())
 		}
@@ -561,6 +956,8 @@ func (s *Server) handleExit(ctx context.Context) {
 		s.logger.Println("Exit called without prior successful shutdown. Waiting briefly for pending tasks before error exit.")
 	}
 
+	s.stopBackground("exit requested")
+
 	// Wait for any remaining pending requests (that were started before shutdown completed)
 	// Use a reasonable timeout to prevent hanging indefinitely.
 	waitCh := make(chan struct{})
@@ -576,6 +973,8 @@ func (s *Server) handleExit(ctx context.Context) {
 		s.logger.Println("Timed out waiting for pending tasks during exit - proceeding with exit anyway")
 	}
 
+	s.reportShutdown(ShutdownExit, nil)
+
 	// Close connection before exiting
 	s.logger.Printf("Closing connection and terminating process with code %d.", exitCode)
 	if err := s.conn.Close(); err != nil {
@@ -587,25 +986,16 @@ func (s *Server) handleExit(ctx context.Context) {
 	os.Exit(exitCode)
 }
 
-// handleCancel handles "$/cancelRequest" notifications.
-// func(ctx context.Context, params *protocol.CancelParams)
-// Note: protocol.CancelParams is just `{ id: number | string }`
-// Need to add CancelParams to protocol package. For now, use RawMessage.
-func (s *Server) handleCancel(ctx context.Context, params *json.RawMessage) {
-	// TODO: Implement request cancellation logic.
-	// This requires tracking ongoing requests and having a way to signal cancellation.
-	// For now, just log it.
-	var cancelParams struct {
-		ID json.RawMessage `json:"id"`
+// handleCancel handles "$/cancelRequest" notifications: the context of the request is
+// cancelled, its handler is expected to return early, and the request is answered with a
+// RequestCancelled error when it fails. Requests already answered are ignored.
+func (s *Server) handleCancel(ctx context.Context, params *protocol.CancelParams) {
+	if params == nil || len(params.ID) == 0 {
+		s.logger.Printf("Received cancellation request without ID")
+		return
 	}
-	if params != nil {
-		if err := json.Unmarshal(*params, &cancelParams); err == nil {
-			s.logger.Printf("Received cancellation request for ID: %s (Cancellation not implemented)", string(cancelParams.ID))
-		} else {
-			s.logger.Printf("Received malformed cancellation request: %v", err)
-		}
-	} else {
-		s.logger.Printf("Received cancellation request with nil params")
+	if !s.cancelRequest(string(params.ID)) {
+		s.logger.Printf("Received cancellation request for ID: %s, not in flight", string(params.ID))
 	}
 }
 
@@ -626,7 +1016,7 @@ func (s *Server) handleProgress(ctx context.Context, params *json.RawMessage) {
 		Value json.RawMessage `json:"value"`
 	}
 
-	if err := json.Unmarshal(*params, &progressParams); err != nil {
+	if err := s.conn.Codec().Unmarshal(*params, &progressParams); err != nil {
 		s.logger.Printf("Received malformed progress notification: %v", err)
 		return
 	}
@@ -651,7 +1041,7 @@ func (s *Server) Notify(ctx context.Context, method string, params interface{})
 	var rawParams json.RawMessage
 	var err error
 	if params != nil {
-		rawParams, err = json.Marshal(params)
+		rawParams, err = s.conn.Codec().Marshal(params)
 		if err != nil {
 			return fmt.Errorf("failed to marshal notification params for %s: %w", method, err)
 		}
@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// startServer runs a server with opts over pipes, registering its handlers with register
+// before Run, and returns a client connected to it, not initialized yet.
+func startServer(t *testing.T, register func(s *Server), opts ...Option) (*Server, *testClient) {
+	t.Helper()
+	clientR, serverW := io.Pipe()
+	serverR, clientW := io.Pipe()
+	opts = append([]Option{
+		WithStream(ReadWriter{Reader: serverR, Writer: serverW}),
+		WithLogger(log.New(io.Discard, "", 0)),
+	}, opts...)
+	s := NewServer(opts...)
+	if register != nil {
+		register(s)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Run(ctx)
+	}()
+	c := newTestClient(ReadWriter{Reader: clientR, Writer: clientW})
+	t.Cleanup(func() {
+		c.Close()
+		cancel()
+		serverR.Close()
+		serverW.Close()
+		<-done
+	})
+	return s, c
+}
+
+// testContext returns a context bounding a test waiting on the server.
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// testMessage is any message read by a testClient.
+type testMessage struct {
+	ID     json.RawMessage       `json:"id,omitempty"`
+	Method string                `json:"method,omitempty"`
+	Params json.RawMessage       `json:"params,omitempty"`
+	Result json.RawMessage       `json:"result,omitempty"`
+	Error  *jsonrpc2.ErrorObject `json:"error,omitempty"`
+}
+
+// testClient is the client end of startServer. It answers the requests of the server
+// with the handlers set with OnRequest, or with a null result.
+type testClient struct {
+	stream  *jsonrpc2.Stream
+	writeMu sync.Mutex
+
+	mu       sync.Mutex
+	nextID   int
+	pending  map[string]chan *testMessage
+	handlers map[string]func(ctx context.Context, params json.RawMessage) (any, error)
+	done     chan struct{} // Closed when the read loop stops
+}
+
+func newTestClient(rw ReadWriter) *testClient {
+	c := &testClient{
+		stream:   jsonrpc2.NewStream(rw),
+		pending:  make(map[string]chan *testMessage),
+		handlers: make(map[string]func(ctx context.Context, params json.RawMessage) (any, error)),
+		done:     make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Close stops the client, the calls in progress fail.
+func (c *testClient) Close() error {
+	return c.stream.Close()
+}
+
+// OnRequest sets the handler of a request sent by the server.
+func (c *testClient) OnRequest(method string, handler func(ctx context.Context, params json.RawMessage) (any, error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.handlers[method] = handler
+}
+
+// Initialize sends the initialize request, then the initialized notification when it succeeds.
+func (c *testClient) Initialize(ctx context.Context, params *protocol.InitializeParams) (*protocol.InitializeResult, error) {
+	if params == nil {
+		params = &protocol.InitializeParams{}
+	}
+	var result protocol.InitializeResult
+	if err := c.Call(ctx, protocol.MethodInitialize, params, &result); err != nil {
+		return nil, fmt.Errorf("initialize failed: %w", err)
+	}
+	return &result, c.Notify(ctx, protocol.MethodInitialized, protocol.InitializedParams{})
+}
+
+// Call sends a request and waits for its response, decoded into result when non-nil and
+// not null. An error answered by the server is returned as a *jsonrpc2.ErrorObject.
+func (c *testClient) Call(ctx context.Context, method string, params any, result any) error {
+	rawParams, err := marshalTestParams(params)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	respCh := make(chan *testMessage, 1)
+	c.pending[id] = respCh
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(&jsonrpc2.RequestMessage{JSONRPC: jsonrpc2.Version, ID: json.RawMessage(id), Method: method, Params: rawParams}); err != nil {
+		return err
+	}
+	select {
+	case resp := <-respCh:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil || len(resp.Result) == 0 || string(resp.Result) == "null" {
+			return nil
+		}
+		return json.Unmarshal(resp.Result, result)
+	case <-c.done:
+		return errors.New("connection closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify sends a notification.
+func (c *testClient) Notify(ctx context.Context, method string, params any) error {
+	rawParams, err := marshalTestParams(params)
+	if err != nil {
+		return err
+	}
+	return c.write(&jsonrpc2.NotificationMessage{JSONRPC: jsonrpc2.Version, Method: method, Params: rawParams})
+}
+
+func (c *testClient) write(msg any) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.stream.WriteMessage(msg)
+}
+
+func (c *testClient) readLoop() {
+	defer close(c.done)
+	for {
+		data, err := c.stream.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg testMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		switch {
+		case msg.Method == "": // Response
+			c.mu.Lock()
+			respCh := c.pending[string(msg.ID)]
+			c.mu.Unlock()
+			if respCh != nil {
+				respCh <- &msg
+			}
+		case msg.ID != nil: // Request, answered off the read loop, the handler may call the server
+			go c.answer(&msg)
+		}
+	}
+}
+
+// answer answers a request of the server.
+func (c *testClient) answer(req *testMessage) {
+	c.mu.Lock()
+	handler := c.handlers[req.Method]
+	c.mu.Unlock()
+	resp := &jsonrpc2.ResponseMessage{JSONRPC: jsonrpc2.Version, ID: req.ID, Result: json.RawMessage("null")}
+	if handler != nil {
+		result, err := handler(context.Background(), req.Params)
+		var rpcErr *jsonrpc2.ErrorObject
+		switch {
+		case errors.As(err, &rpcErr):
+			resp.Result, resp.Error = nil, rpcErr
+		case err != nil:
+			resp.Result, resp.Error = nil, jsonrpc2.NewError(jsonrpc2.InternalError, err.Error())
+		case result != nil:
+			resp.Result, _ = json.Marshal(result)
+		}
+	}
+	c.write(resp) //nolint:errcheck
+}
+
+func marshalTestParams(params any) (json.RawMessage, error) {
+	if params == nil {
+		return nil, nil
+	}
+	return json.Marshal(params)
+}
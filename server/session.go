@@ -0,0 +1,195 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// sessionSaveDelay groups the changes saved together, e.g. while typing.
+const sessionSaveDelay = 500 * time.Millisecond
+
+// Session is the state saved to disk with WithSessionFile, to recover from a crash.
+type Session struct {
+	Documents []SessionDocument `json:"documents"`
+	// Configuration is the settings of the last workspace/didChangeConfiguration, as sent.
+	Configuration json.RawMessage `json:"configuration,omitempty"`
+	SavedAt       time.Time       `json:"savedAt"`
+}
+
+// SessionDocument is a document open when the session was saved.
+type SessionDocument struct {
+	URI        protocol.DocumentURI `json:"uri"`
+	LanguageID protocol.LanguageID  `json:"languageId"`
+	Version    int                  `json:"version"`
+}
+
+// sessionStore saves the session of the server to a file, removed on a clean shutdown.
+// A file left behind means the previous process crashed.
+type sessionStore struct {
+	path      string
+	recovered *Session // Session of the crashed process, nil if it shut down cleanly
+
+	mu      sync.Mutex
+	config  json.RawMessage
+	timer   *time.Timer
+	pending bool // A save is scheduled
+	closed  bool // Shutdown, nothing is saved anymore
+}
+
+// newSessionStore loads the session left by a crashed process, if any.
+func newSessionStore(path string, s *Server) *sessionStore {
+	store := &sessionStore{path: path}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		s.logger.Printf("Failed to read session file %s: %v", path, err)
+	default:
+		var session Session
+		if err := json.Unmarshal(data, &session); err != nil {
+			s.logger.Printf("Ignoring invalid session file %s: %v", path, err)
+			break
+		}
+		s.logger.Printf("Recovering session saved at %s with %d open documents", session.SavedAt.Format(time.RFC3339), len(session.Documents))
+		store.recovered = &session
+		store.config = session.Configuration
+	}
+	return store
+}
+
+// RecoveredSession returns the session of the previous process when it crashed, with the
+// WithSessionFile option. Servers read its Configuration until the client sends settings.
+func (s *Server) RecoveredSession() (*Session, bool) {
+	if s.session == nil || s.session.recovered == nil {
+		return nil, false
+	}
+	return s.session.recovered, true
+}
+
+// trackSession records the configuration and schedules a save of the session after the
+// messages changing it. Like trackDocument it runs in the read loop.
+func (s *Server) trackSession(msg any) {
+	n, ok := msg.(*jsonrpc2.NotificationMessage)
+	if !ok || s.session == nil {
+		return
+	}
+	switch n.Method {
+	case protocol.MethodWorkspaceDidChangeConfiguration:
+		var params protocol.DidChangeConfigurationParams
+		if err := s.conn.Codec().Unmarshal(n.Params, &params); err != nil {
+			return // Reported by the handler, if any
+		}
+		s.session.mu.Lock()
+		s.session.config = params.Settings
+		s.session.mu.Unlock()
+	case protocol.MethodTextDocumentDidOpen, protocol.MethodTextDocumentDidChange, protocol.MethodTextDocumentDidClose:
+	default:
+		return
+	}
+	s.scheduleSessionSave()
+}
+
+// scheduleSessionSave saves the session sessionSaveDelay after a change, the changes
+// happening meanwhile are saved with it.
+func (s *Server) scheduleSessionSave() {
+	s.session.mu.Lock()
+	defer s.session.mu.Unlock()
+	if s.session.closed || s.session.pending {
+		return
+	}
+	s.session.pending = true
+	s.session.timer = time.AfterFunc(sessionSaveDelay, func() {
+		if err := s.saveSession(); err != nil {
+			s.logger.Printf("Failed to save session: %v", err)
+		}
+	})
+}
+
+// saveSession writes the session file, through a temporary file so that a crash while
+// writing leaves the previous session.
+func (s *Server) saveSession() error {
+	session := Session{Documents: []SessionDocument{}, SavedAt: time.Now()}
+	for _, snapshot := range s.documents.Snapshots() {
+		session.Documents = append(session.Documents, SessionDocument{
+			URI: snapshot.URI, LanguageID: snapshot.LanguageID, Version: snapshot.Version,
+		})
+	}
+
+	s.session.mu.Lock()
+	defer s.session.mu.Unlock()
+	s.session.pending = false
+	if s.session.closed {
+		return nil
+	}
+	session.Configuration = s.session.config
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.session.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.session.path)
+}
+
+// discardSession removes the session file on a clean shutdown, there is nothing to recover.
+func (s *Server) discardSession() {
+	if s.session == nil {
+		return
+	}
+	s.session.mu.Lock()
+	defer s.session.mu.Unlock()
+	s.session.closed = true
+	if s.session.timer != nil {
+		s.session.timer.Stop()
+	}
+	if err := os.Remove(s.session.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		s.logger.Printf("Failed to remove session file: %v", err)
+	}
+}
+
+// recoverSession asks the client to send again the documents of the crashed session the
+// client did not reopen, with MethodResyncDocuments. When the client doesn't implement it,
+// the diagnostics published by the crashed process are cleared, they would stay stale.
+func (s *Server) recoverSession(ctx context.Context) {
+	session, ok := s.RecoveredSession()
+	if !ok {
+		return
+	}
+	var missing []protocol.VersionedTextDocumentIdentifier
+	for _, doc := range session.Documents {
+		if _, open := s.documents.Get(doc.URI); !open {
+			missing = append(missing, protocol.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: doc.URI},
+				Version:                doc.Version,
+			})
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+
+	err := s.Call(ctx, protocol.MethodResyncDocuments, protocol.ResyncDocumentsParams{Documents: missing}, nil)
+	if err == nil {
+		s.logger.Printf("Client resent %d documents of the recovered session", len(missing))
+		return
+	}
+	s.logger.Printf("Client can't resend the documents of the recovered session (%v), clearing their diagnostics", err)
+	for _, doc := range missing {
+		if err := s.Notify(ctx, protocol.MethodTextDocumentPublishDiagnostics, protocol.PublishDiagnosticsParams{
+			URI:         doc.URI,
+			Diagnostics: []protocol.Diagnostic{},
+		}); err != nil {
+			s.logger.Printf("Failed to clear diagnostics of %s: %v", doc.URI, err)
+			return
+		}
+	}
+}
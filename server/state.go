@@ -0,0 +1,59 @@
+package server
+
+import (
+	"reflect"
+	"sync"
+)
+
+// stateBag holds the per-connection state of a server, one value per type, see StateOf.
+type stateBag struct {
+	mu     sync.Mutex
+	values map[reflect.Type]any
+	inits  map[reflect.Type]func(s *Server) any
+}
+
+// WithState sets the constructor of the state of type T returned by StateOf, called on first
+// use. Servers built per connection by a factory get their own caches and stores this way,
+// instead of sharing package level variables across clients.
+func WithState[T any](newState func(s *Server) *T) Option {
+	return func(o *options) {
+		if o.stateInits == nil {
+			o.stateInits = make(map[reflect.Type]func(s *Server) any)
+		}
+		o.stateInits[reflect.TypeFor[T]()] = func(s *Server) any { return newState(s) }
+	}
+}
+
+// StateOf returns the state of type T of the server, created on first use with the
+// constructor set with WithState, or as a zero T without one. It is safe for concurrent use,
+// the state itself is not synchronized.
+//
+//	type cache struct{ mu sync.Mutex; results map[protocol.DocumentURI]result }
+//
+//	c := server.StateOf[cache](s)
+func StateOf[T any](s *Server) *T {
+	t := reflect.TypeFor[T]()
+	s.states.mu.Lock()
+	if v, ok := s.states.values[t]; ok {
+		s.states.mu.Unlock()
+		return v.(*T)
+	}
+	init := s.states.inits[t]
+	s.states.mu.Unlock()
+
+	// Constructed unlocked, it may use the state of other types
+	var v *T
+	if init != nil {
+		v = init(s).(*T)
+	} else {
+		v = new(T)
+	}
+
+	s.states.mu.Lock()
+	defer s.states.mu.Unlock()
+	if existing, ok := s.states.values[t]; ok {
+		return existing.(*T) // Created concurrently, the first one wins
+	}
+	s.states.values[t] = v
+	return v
+}
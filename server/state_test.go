@@ -0,0 +1,60 @@
+package server
+
+import (
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+type counterState struct{ n atomic.Int64 }
+
+type namedState struct {
+	name    string
+	counter *counterState
+}
+
+// TestStateOf checks the state of a type is created once per server, with its constructor
+// or as a zero value, and is never shared between servers built with the same options.
+func TestStateOf(t *testing.T) {
+	var built atomic.Int64
+	opts := []Option{
+		WithLogger(log.New(io.Discard, "", 0)),
+		WithState(func(s *Server) *namedState {
+			built.Add(1)
+			// Constructors may use the state of other types
+			return &namedState{name: "built", counter: StateOf[counterState](s)}
+		}),
+	}
+	// As a connection factory would, one server per client
+	first, second := NewServer(opts...), NewServer(opts...)
+
+	var wg sync.WaitGroup
+	states := make([]*namedState, 10)
+	for i := range states {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			states[i] = StateOf[namedState](first)
+		}()
+	}
+	wg.Wait()
+	for _, state := range states {
+		if state != states[0] {
+			t.Fatal("concurrent StateOf returned different states")
+		}
+	}
+	if states[0].name != "built" || states[0].counter != StateOf[counterState](first) {
+		t.Errorf("state not built by its constructor: %+v", states[0])
+	}
+
+	StateOf[counterState](first).n.Add(1)
+	if other := StateOf[namedState](second); other == states[0] || other.counter.n.Load() != 0 {
+		t.Error("state shared between servers")
+	}
+	// Each server built its own, racing calls may build extra ones which are dropped
+	if n := built.Load(); n < 2 {
+		t.Errorf("constructor called %d times, want one per server at least", n)
+	}
+}
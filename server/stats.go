@@ -0,0 +1,119 @@
+package server
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// Stats is a snapshot of the message statistics of a server.
+type Stats struct {
+	// StartTime is when the server was created.
+	StartTime time.Time `json:"startTime"`
+	// InFlight is the number of messages currently being handled.
+	InFlight int64 `json:"inFlight"`
+	// Requests holds per method statistics for requests received from the client.
+	Requests map[string]MethodStats `json:"requests"`
+	// Notifications holds per method statistics for notifications received from the client.
+	Notifications map[string]MethodStats `json:"notifications"`
+	// LateResponses is the number of responses from the client dropped because they arrived
+	// after their Call returned, see WithLateResponseHandler.
+	LateResponses uint64 `json:"lateResponses"`
+	// ShedRequests is the number of requests answered without being handled because the
+	// server was overloaded, see WithOverloadShedding.
+	ShedRequests uint64 `json:"shedRequests"`
+	// BlockedEdits is the number of workspace edits not sent to the client, see WithReadOnly.
+	BlockedEdits uint64 `json:"blockedEdits"`
+	// Connection is the traffic with the client: bytes and messages by method each way, and
+	// the writes stalled by a client not reading.
+	Connection jsonrpc2.ConnStats `json:"connection"`
+}
+
+// MethodStats aggregates the handling of a single method.
+type MethodStats struct {
+	Count         uint64        `json:"count"`
+	Errors        uint64        `json:"errors"`
+	TotalDuration time.Duration `json:"totalDuration"`
+	MaxDuration   time.Duration `json:"maxDuration"`
+}
+
+// statsRecorder collects the statistics exposed by Server.Stats.
+type statsRecorder struct {
+	startTime     time.Time
+	inFlight      atomic.Int64
+	lateResponses atomic.Uint64
+	shedRequests  atomic.Uint64
+	blockedEdits  atomic.Uint64
+	mu            sync.Mutex
+	requests      map[string]*MethodStats
+	notifications map[string]*MethodStats
+}
+
+func newStatsRecorder() *statsRecorder {
+	return &statsRecorder{
+		startTime:     time.Now(),
+		requests:      make(map[string]*MethodStats),
+		notifications: make(map[string]*MethodStats),
+	}
+}
+
+// begin marks the start of a message handling, the returned func records its outcome.
+func (r *statsRecorder) begin(method string, isRequest bool) func(err error) {
+	r.inFlight.Add(1)
+	start := time.Now()
+	return func(err error) {
+		elapsed := time.Since(start)
+		r.inFlight.Add(-1)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		byMethod := r.notifications
+		if isRequest {
+			byMethod = r.requests
+		}
+		ms, ok := byMethod[method]
+		if !ok {
+			ms = &MethodStats{}
+			byMethod[method] = ms
+		}
+		ms.Count++
+		if err != nil {
+			ms.Errors++
+		}
+		ms.TotalDuration += elapsed
+		if elapsed > ms.MaxDuration {
+			ms.MaxDuration = elapsed
+		}
+	}
+}
+
+func (r *statsRecorder) snapshot() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stats := Stats{
+		StartTime:     r.startTime,
+		InFlight:      r.inFlight.Load(),
+		LateResponses: r.lateResponses.Load(),
+		ShedRequests:  r.shedRequests.Load(),
+		BlockedEdits:  r.blockedEdits.Load(),
+		Requests:      make(map[string]MethodStats, len(r.requests)),
+		Notifications: make(map[string]MethodStats, len(r.notifications)),
+	}
+	for method, ms := range r.requests {
+		stats.Requests[method] = *ms
+	}
+	for method, ms := range r.notifications {
+		stats.Notifications[method] = *ms
+	}
+	return stats
+}
+
+// Stats returns a snapshot of the message statistics of the server.
+func (s *Server) Stats() Stats {
+	stats := s.stats.snapshot()
+	stats.Connection = s.conn.Stats()
+	return stats
+}
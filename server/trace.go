@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// setTrace sets the trace level, invalid values turn tracing off.
+func (s *Server) setTrace(value protocol.TraceValue) {
+	if value != "" && !value.Valid() {
+		s.logger.Printf("Unknown trace value %q, tracing is off", value)
+		value = protocol.TraceOff
+	}
+	if value == "" {
+		value = protocol.TraceOff
+	}
+	s.trace.Store(value)
+}
+
+// Trace returns the trace level set by the client in initialize or with $/setTrace.
+func (s *Server) Trace() protocol.TraceValue {
+	if v, ok := s.trace.Load().(protocol.TraceValue); ok {
+		return v
+	}
+	return protocol.TraceOff
+}
+
+// handleSetTrace handles the $/setTrace notification.
+func (s *Server) handleSetTrace(ctx context.Context, params *protocol.SetTraceParams) error {
+	s.setTrace(params.Value)
+	s.logger.Printf("Trace level set to %s", s.Trace())
+	return nil
+}
+
+// LogTrace sends an execution trace to the client with $/logTrace, when the trace level
+// is not off. verbose is only sent with the verbose level, it may be expensive to build
+// so check Trace first. Traces are best effort, send errors are only logged.
+func (s *Server) LogTrace(ctx context.Context, message, verbose string) {
+	level := s.Trace()
+	if level == protocol.TraceOff || s.currentState() != stateRunning {
+		return
+	}
+	params := protocol.LogTraceParams{Message: message}
+	if level == protocol.TraceVerbose {
+		params.Verbose = verbose
+	}
+	if err := s.Notify(ctx, protocol.MethodLogTrace, params); err != nil {
+		s.logger.Printf("Failed to send trace: %v", err)
+	}
+}
+
+// traceMessage traces the handling of a message from the client, with its params
+// when verbose.
+func (s *Server) traceMessage(ctx context.Context, kind, method string, id, params json.RawMessage, elapsed time.Duration, err error) {
+	level := s.Trace()
+	if level == protocol.TraceOff {
+		return
+	}
+	message := fmt.Sprintf("Handled %s '%s' in %s", kind, method, elapsed.Round(time.Microsecond))
+	if id != nil {
+		message = fmt.Sprintf("Handled %s '%s - (%s)' in %s", kind, method, string(id), elapsed.Round(time.Microsecond))
+	}
+	if err != nil {
+		message += fmt.Sprintf(", failed: %v", err)
+	}
+	var verbose string
+	if level == protocol.TraceVerbose && len(params) > 0 {
+		verbose = "Params: " + string(params)
+	}
+	s.LogTrace(ctx, message, verbose)
+}
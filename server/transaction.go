@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// ApplyEditError is returned by ApplyEdit and EditTransaction.Commit when the client did not
+// apply a workspace edit.
+type ApplyEditError struct {
+	Label  string
+	Reason string // Failure reason given by the client, may be empty
+	// FailedChange is the index of the change the client failed to apply, -1 when unknown.
+	// Clients only report it depending on their workspace.workspaceEdit.failureHandling.
+	FailedChange int
+	// URI is the document of the failed change, empty when unknown.
+	URI protocol.DocumentURI
+}
+
+func (e *ApplyEditError) Error() string {
+	msg := fmt.Sprintf("client did not apply edit %q", e.Label)
+	if e.URI != "" {
+		msg += fmt.Sprintf(", change %d for %s failed", e.FailedChange, e.URI)
+	} else if e.FailedChange >= 0 {
+		msg += fmt.Sprintf(", change %d failed", e.FailedChange)
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// newApplyEditError interprets the response of a client which did not apply edit.
+func newApplyEditError(label string, edit protocol.WorkspaceEdit, result protocol.ApplyWorkspaceEditResponse) *ApplyEditError {
+	err := &ApplyEditError{Label: label, Reason: result.FailureReason, FailedChange: -1}
+	if result.FailedChange != nil {
+		err.FailedChange = int(*result.FailedChange)
+		// The index is only meaningful for the ordered document changes, not the changes map
+		if err.FailedChange < len(edit.DocumentChanges) {
+			err.URI = edit.DocumentChanges[err.FailedChange].URI()
+		}
+	}
+	return err
+}
+
+// EditTransaction groups edits over several documents into a single workspace/applyEdit,
+// e.g. a rename touching a declaration and its uses.
+//
+//	tx := s.BeginEdit("Rename")
+//	tx.Edit(declDoc, declEdits...).Edit(useDoc, useEdits...)
+//	if err := tx.Commit(ctx); err != nil { ... }
+//
+// Whether the client applies all the edits or none depends on its failure handling
+// (workspace.workspaceEdit.failureHandling, "transactional" is all or nothing).
+type EditTransaction struct {
+	s       *Server
+	label   string
+	builder *protocol.WorkspaceEditBuilder
+}
+
+// BeginEdit starts a transaction, label is shown by the client (e.g. in its undo stack).
+func (s *Server) BeginEdit(label string) *EditTransaction {
+	return &EditTransaction{s: s, label: label, builder: protocol.NewWorkspaceEditBuilder()}
+}
+
+// Edit adds edits computed on snapshot, they target its version.
+func (t *EditTransaction) Edit(snapshot *textdocument.Snapshot, edits ...protocol.TextEdit) *EditTransaction {
+	return t.EditVersion(snapshot.URI, snapshot.Version, edits...)
+}
+
+// EditVersion adds edits of the document uri at version.
+func (t *EditTransaction) EditVersion(uri protocol.DocumentURI, version int, edits ...protocol.TextEdit) *EditTransaction {
+	t.builder.SetVersion(uri, version)
+	for _, edit := range edits {
+		t.builder.Replace(uri, edit.Range, edit.NewText)
+	}
+	return t
+}
+
+// Commit validates the versions and ranges of all the edits against the document store and
+// sends them in one workspace/applyEdit. It returns textdocument.ErrStaleVersion, without
+// sending anything, if any document changed since its edits were computed, and an
+// *ApplyEditError telling which document failed if the client did not apply the edit.
+func (t *EditTransaction) Commit(ctx context.Context) error {
+	if t.builder.Len() == 0 {
+		return nil
+	}
+	// Checked here, Build drops the versions when the client lacks documentChanges
+	if err := t.checkVersions(); err != nil {
+		t.s.logger.Printf("Not sending workspace edit %q: %v", t.label, err)
+		return err
+	}
+	edit, err := t.builder.Build(t.s.ClientCapabilities().SupportsDocumentChanges())
+	if err != nil {
+		return fmt.Errorf("invalid edit %q: %w", t.label, err)
+	}
+	return t.s.ApplyEdit(ctx, t.label, edit)
+}
+
+// checkVersions returns textdocument.ErrStaleVersion if an open document is not at the
+// version its edits were computed for.
+func (t *EditTransaction) checkVersions() error {
+	versions := t.builder.Versions()
+	// Sorted for a deterministic error
+	uris := make([]protocol.DocumentURI, 0, len(versions))
+	for uri := range versions {
+		uris = append(uris, uri)
+	}
+	sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+	for _, uri := range uris {
+		snapshot, ok := t.s.documents.Get(uri)
+		if ok && snapshot.Version != versions[uri] {
+			return fmt.Errorf("%w: edit for %s targets version %d, the document is at version %d",
+				textdocument.ErrStaleVersion, uri, versions[uri], snapshot.Version)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// TestCommitStaleVersionWithoutDocumentChanges checks a transaction computed on an older
+// version is not sent to a client without documentChanges, whose edit has no versions.
+func TestCommitStaleVersionWithoutDocumentChanges(t *testing.T) {
+	s, c := startServer(t, nil)
+	applied := make(chan protocol.ApplyWorkspaceEditParams, 1)
+	c.OnRequest(protocol.MethodWorkspaceApplyEdit, func(ctx context.Context, params json.RawMessage) (any, error) {
+		var p protocol.ApplyWorkspaceEditParams
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, err
+		}
+		applied <- p
+		return protocol.ApplyWorkspaceEditResponse{Applied: true}, nil
+	})
+	ctx := testContext(t)
+	if _, err := c.Initialize(ctx, &protocol.InitializeParams{}); err != nil {
+		t.Fatal(err)
+	}
+
+	const uri = protocol.DocumentURI("file:///tmp/doc.txt")
+	if err := c.Notify(ctx, protocol.MethodTextDocumentDidOpen, protocol.DidOpenTextDocumentParams{
+		TextDocument: protocol.TextDocumentItem{URI: uri, LanguageID: "plaintext", Version: 1, Text: "hello world"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := waitForVersion(t, s, uri, 1)
+	if err := c.Notify(ctx, protocol.MethodTextDocumentDidChange, protocol.DidChangeTextDocumentParams{
+		TextDocument:   protocol.VersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: uri}, Version: 2},
+		ContentChanges: []protocol.TextDocumentContentChangeEvent{{Text: "hi world"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	waitForVersion(t, s, uri, 2)
+
+	// Computed on version 1, its range is still inside the text of version 2
+	stale := protocol.TextEdit{Range: protocol.Range{Start: protocol.Position{Character: 3}, End: protocol.Position{Character: 8}}, NewText: "x"}
+	err := s.BeginEdit("Stale").Edit(snapshot, stale).Commit(ctx)
+	if !errors.Is(err, textdocument.ErrStaleVersion) {
+		t.Fatalf("got %v, want %v", err, textdocument.ErrStaleVersion)
+	}
+	select {
+	case p := <-applied:
+		t.Fatalf("stale edit sent: %+v", p.Edit)
+	default:
+	}
+
+	current, _ := s.documents.Get(uri)
+	if err := s.BeginEdit("Current").Edit(current, stale).Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p := <-applied; len(p.Edit.Changes[uri]) != 1 || p.Edit.DocumentChanges != nil {
+		t.Errorf("got %+v, want the edit as plain changes", p.Edit)
+	}
+}
+
+// waitForVersion waits for the server to store version of uri, and returns its snapshot.
+func waitForVersion(t *testing.T, s *Server, uri protocol.DocumentURI, version int) *textdocument.Snapshot {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(time.Millisecond) {
+		if snapshot, ok := s.documents.Get(uri); ok && snapshot.Version == version {
+			return snapshot
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("version %d of %s not stored", version, uri)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+)
+
+// HandleRequest registers a typed handler for a request method. Unlike Register, the
+// signature is checked at compile time and the handler is called without reflection.
+// The params are decoded into a new P, a nil error with a nil result answers null.
+//
+//	server.HandleRequest(s, protocol.MethodTextDocumentHover,
+//		func(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) { ... })
+func HandleRequest[P, R any](s *Server, method string, fn func(ctx context.Context, params *P) (R, error)) error {
+	return s.addHandler(method, &typedHandler{
+		h:           fn,
+		paramType:   reflect.TypeFor[P](),
+		takesParams: true,
+		direct: func(ctx context.Context, codec jsonrpc2.Codec, raw json.RawMessage) (any, error) {
+			params, err := decodeParams[P](codec, raw)
+			if err != nil {
+				return nil, err
+			}
+			result, err := fn(ctx, params)
+			if err != nil {
+				return nil, err
+			}
+			return result, nil
+		},
+	})
+}
+
+// HandleNotification registers a typed handler for a notification method, called without
+// reflection like the handlers of HandleRequest.
+func HandleNotification[P any](s *Server, method string, fn func(ctx context.Context, params *P) error) error {
+	return s.addHandler(method, &typedHandler{
+		h:           fn,
+		paramType:   reflect.TypeFor[P](),
+		takesParams: true,
+		direct: func(ctx context.Context, codec jsonrpc2.Codec, raw json.RawMessage) (any, error) {
+			params, err := decodeParams[P](codec, raw)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fn(ctx, params)
+		},
+	})
+}
+
+// decodeParams decodes raw into a new P, missing or null params give the zero value
+// as they do for handlers registered with Register.
+func decodeParams[P any](codec jsonrpc2.Codec, raw json.RawMessage) (*P, error) {
+	params := new(P)
+	if len(raw) == 0 || string(raw) == "null" {
+		return params, nil
+	}
+	if err := codec.Unmarshal(raw, params); err != nil {
+		return nil, &jsonrpc2.ErrorObject{
+			Code:    jsonrpc2.InvalidParams,
+			Message: fmt.Sprintf("failed to unmarshal params: %v", err),
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"reflect"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+var hoverParams = json.RawMessage(`{"textDocument":{"uri":"file:///a.go"},"position":{"line":12,"character":4}}`)
+
+func hoverHandler(ctx context.Context, params *protocol.HoverParams) (*protocol.Hover, error) {
+	return &protocol.Hover{Contents: protocol.MarkupContent{Kind: protocol.PlainText, Value: string(params.TextDocument.URI)}}, nil
+}
+
+// hoverHandlers returns the handler of a hover registered with HandleRequest, and with
+// Register.
+func hoverHandlers(tb testing.TB) (typed, reflected *typedHandler) {
+	tb.Helper()
+	s := NewServer(WithLogger(log.New(io.Discard, "", 0)))
+	if err := HandleRequest(s, protocol.MethodTextDocumentHover, hoverHandler); err != nil {
+		tb.Fatal(err)
+	}
+	if err := s.Register(protocol.MethodTextDocumentDefinition, hoverHandler); err != nil {
+		tb.Fatal(err)
+	}
+	typed, reflected = s.handlers[protocol.MethodTextDocumentHover], s.handlers[protocol.MethodTextDocumentDefinition]
+	if typed.direct == nil || reflected.direct != nil {
+		tb.Fatal("HandleRequest must register a direct handler, Register a reflected one")
+	}
+	return typed, reflected
+}
+
+func TestInvokeTypedMatchesReflect(t *testing.T) {
+	typed, reflected := hoverHandlers(t)
+	for _, params := range []json.RawMessage{hoverParams, nil, json.RawMessage("null")} {
+		got, err := typed.invoke(context.Background(), nil, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := reflected.invoke(context.Background(), nil, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("params %s: typed handler returned %+v, reflected one %+v", params, got, want)
+		}
+	}
+	if _, err := typed.invoke(context.Background(), nil, json.RawMessage(`{"position":1}`)); err == nil {
+		t.Error("typed handler accepted invalid params")
+	}
+}
+
+func BenchmarkInvokeTyped(b *testing.B) {
+	typed, _ := hoverHandlers(b)
+	benchmarkInvoke(b, typed)
+}
+
+func BenchmarkInvokeReflect(b *testing.B) {
+	_, reflected := hoverHandlers(b)
+	benchmarkInvoke(b, reflected)
+}
+
+func benchmarkInvoke(b *testing.B, h *typedHandler) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := h.invoke(ctx, nil, hoverParams); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
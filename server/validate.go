@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// validateResult checks the result of a request handler, with WithResultValidation.
+// Results of other methods than the checked ones are accepted.
+func (s *Server) validateResult(ctx context.Context, method string, params json.RawMessage, result any) error {
+	var err error
+	switch method {
+	case protocol.MethodTextDocumentCompletion:
+		err = s.validateCompletion(ctx, params, result)
+	}
+	if err != nil {
+		// Logged as an internal error by handleRequest
+		return fmt.Errorf("invalid %s result: %w", method, err)
+	}
+	return nil
+}
+
+// validateCompletion checks the edits of the completion items against the document the
+// completion was requested for.
+func (s *Server) validateCompletion(ctx context.Context, params json.RawMessage, result any) error {
+	var items []protocol.CompletionItem
+	switch r := result.(type) {
+	case *protocol.CompletionList:
+		if r != nil {
+			items = r.Items
+		}
+	case protocol.CompletionList:
+		items = r.Items
+	case []protocol.CompletionItem:
+		items = r
+	default:
+		return nil // nil, or a type the handler marshals itself
+	}
+	snapshot, ok := SnapshotFromContext(ctx)
+	if !ok {
+		return nil // The document is not open, ranges can't be checked
+	}
+	var p protocol.CompletionParams
+	if err := s.conn.Codec().Unmarshal(params, &p); err != nil {
+		return nil // The handler decoded them, this can't fail
+	}
+	return textdocument.ValidateCompletionItems(snapshot.Mapper(), p.Position, items)
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrInitTimeout is returned by Run when the client did not complete the initialization
+// in the time set with WithInitTimeout.
+var ErrInitTimeout = errors.New("initialization timeout")
+
+// watchInitialization stops the server with ErrInitTimeout through stop when the client
+// sends no initialize request within the timeout of the start of Run, or no initialized
+// notification within the timeout of the initialize response.
+func (s *Server) watchInitialization(ctx context.Context, timeout time.Duration, stop context.CancelCauseFunc) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		var reason string
+		switch s.currentState() {
+		case stateUninitialized:
+			reason = fmt.Sprintf("no initialize request received within %s", timeout)
+		case stateInitializing:
+			at := s.initializeAt.Load()
+			if at == 0 {
+				timer.Reset(timeout) // The initialize request is still being handled
+				continue
+			}
+			deadline := time.Unix(0, at).Add(timeout)
+			if wait := time.Until(deadline); wait > 0 {
+				timer.Reset(wait) // The initialize response was sent late, wait for initialized from there
+				continue
+			}
+			reason = fmt.Sprintf("no initialized notification received within %s of the initialize response", timeout)
+		default:
+			return // Running or already shutting down
+		}
+
+		s.logger.Printf("Initialization watchdog: %s, shutting down.", reason)
+		if s.initTimeoutNotify {
+			s.notifyInitTimeout(ctx, reason)
+		}
+		s.state.Store(stateShutdown)
+		s.stopBackground("initialization timeout")
+		stop(fmt.Errorf("%w: %s", ErrInitTimeout, reason))
+		return
+	}
+}
+
+// notifyInitTimeout tells the user why the server stops, flushing the notification before
+// the connection is closed.
+func (s *Server) notifyInitTimeout(ctx context.Context, reason string) {
+	protocol.ShowNotification(ctx, s.conn, protocol.Error, "Language server stopped: "+reason)
+	if err := s.conn.Flush(); err != nil {
+		s.logger.Printf("Error notifying the initialization timeout: %v", err)
+	}
+}
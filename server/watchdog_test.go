@@ -0,0 +1,43 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+// TestWatchdogWaitsForSlowInitialize checks the watchdog does not stop a server whose
+// initialize request is handled longer than the timeout: the initialized notification is
+// waited for from the response.
+func TestWatchdogWaitsForSlowInitialize(t *testing.T) {
+	const timeout = 50 * time.Millisecond
+	s := NewServer(WithLogger(log.New(io.Discard, "", 0)))
+	s.state.Store(stateInitializing) // The initialize handler is running
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.watchInitialization(ctx, timeout, cancel)
+	}()
+
+	time.Sleep(4 * timeout)
+	if err := context.Cause(ctx); err != nil {
+		t.Fatalf("stopped while initialize was handled: %v", err)
+	}
+
+	// Responded, the client never sends initialized
+	s.initializeAt.Store(time.Now().UnixNano())
+	select {
+	case <-done:
+	case <-time.After(10 * timeout):
+		t.Fatal("not stopped without the initialized notification")
+	}
+	if err := context.Cause(ctx); !errors.Is(err, ErrInitTimeout) {
+		t.Errorf("stopped with %v, want %v", err, ErrInitTimeout)
+	}
+}
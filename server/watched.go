@@ -0,0 +1,52 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// FileChangeHook is called with the files created, changed or deleted on disk, as reported
+// by workspace/didChangeWatchedFiles (see WatchFiles). Events include the documents open in
+// the editor, whose text in the document store stays the one of the editor.
+type FileChangeHook func(ctx context.Context, changes []protocol.FileEvent)
+
+// OnFilesChanged adds a hook called for each workspace/didChangeWatchedFiles notification,
+// before the handler registered for the method, if any. Unlike the handler, any number of
+// components (caches, a workspace.Indexer with its FilesChanged method, ...) can add one.
+func (s *Server) OnFilesChanged(hook FileChangeHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fileChangeHooks = append(s.fileChangeHooks, hook)
+}
+
+// filesChanged invalidates the state of the server depending on files changed on disk, then
+// runs the hooks. The diagnostics of deleted files which are not open are cleared, nothing
+// will update them anymore.
+func (s *Server) filesChanged(ctx context.Context, raw json.RawMessage) {
+	var params protocol.DidChangeWatchedFilesParams
+	if err := s.conn.Codec().Unmarshal(raw, &params); err != nil {
+		s.logger.Printf("Invalid %s params: %v", protocol.MethodWorkspaceDidChangeWatchedFiles, err)
+		return
+	}
+
+	for _, change := range params.Changes {
+		if change.Type != protocol.FileChangeTypeDeleted {
+			continue
+		}
+		if _, open := s.documents.Get(change.URI); open {
+			continue
+		}
+		if err := s.diagnostics.Clear(ctx, change.URI); err != nil {
+			s.logger.Printf("Failed to clear diagnostics of deleted %s: %v", change.URI, err)
+		}
+	}
+
+	s.mu.RLock()
+	hooks := s.fileChangeHooks
+	s.mu.RUnlock()
+	for _, hook := range hooks {
+		hook(ctx, params.Changes)
+	}
+}
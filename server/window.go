@@ -0,0 +1,100 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/akhenakh/lspgo/jsonrpc2"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ShowMessage shows a message to the user (window/showMessage). Types the protocol doesn't
+// define are sent as Info, clients may otherwise drop the message.
+func (s *Server) ShowMessage(ctx context.Context, typ protocol.MessageType, message string) error {
+	if typ < protocol.Error || typ > protocol.Log {
+		typ = protocol.Info
+	}
+	return s.Notify(ctx, protocol.MethodWindowShowMessage, protocol.ShowMessageParams{Type: typ, Message: message})
+}
+
+// LogMessage writes a message to the log of the client (window/logMessage), without
+// showing it to the user. Types the protocol doesn't define are sent as Log.
+func (s *Server) LogMessage(ctx context.Context, typ protocol.MessageType, message string) error {
+	if typ < protocol.Error || typ > protocol.Log {
+		typ = protocol.Log
+	}
+	return s.Notify(ctx, protocol.MethodWindowLogMessage, protocol.LogMessageParams{Type: typ, Message: message})
+}
+
+// ShowMessageRequest shows a message with action buttons (window/showMessageRequest) and
+// returns the title of the action the user picked, empty when the message was dismissed.
+func (s *Server) ShowMessageRequest(ctx context.Context, typ protocol.MessageType, message string, actions ...string) (string, error) {
+	items := make([]protocol.MessageActionItem, 0, len(actions))
+	for _, title := range actions {
+		items = append(items, protocol.MessageActionItem{Title: title})
+	}
+	picked, err := s.ShowMessageRequestItems(ctx, typ, message, items...)
+	if err != nil || picked == nil {
+		return "", err
+	}
+	return picked.Title, nil
+}
+
+// ShowMessageRequestItems is ShowMessageRequest with action items carrying Properties, e.g.
+// the identifier of the action, and returns the item picked, nil when the message was
+// dismissed. The properties are only sent to the clients supporting them, the picked item
+// is matched by title for the others, so that it always comes back with its properties.
+//
+// Without actions, and for the clients answering window/showMessageRequest with
+// MethodNotFound, the message is shown with window/showMessage and nil is returned as if
+// it was dismissed: callers handle the dismissal already.
+func (s *Server) ShowMessageRequestItems(ctx context.Context, typ protocol.MessageType, message string, actions ...protocol.MessageActionItem) (*protocol.MessageActionItem, error) {
+	if len(actions) == 0 || s.noMessageRequests.Load() {
+		return nil, s.ShowMessage(ctx, typ, messageWithActions(message, actions))
+	}
+	params := protocol.ShowMessageRequestParams{Type: typ, Message: message, Actions: actions}
+	echoed := s.ClientCapabilities().SupportsMessageActionProperties()
+	if !echoed {
+		params.Actions = make([]protocol.MessageActionItem, len(actions))
+		for i, action := range actions {
+			params.Actions[i] = protocol.MessageActionItem{Title: action.Title}
+		}
+	}
+
+	var picked *protocol.MessageActionItem
+	if err := s.Call(ctx, protocol.MethodWindowShowMessageRequest, params, &picked); err != nil {
+		var rpcErr *jsonrpc2.ErrorObject
+		if errors.As(err, &rpcErr) && rpcErr.Code == jsonrpc2.MethodNotFound {
+			s.logger.Printf("Client does not support %s, showing messages without actions", protocol.MethodWindowShowMessageRequest)
+			s.noMessageRequests.Store(true)
+			return nil, s.ShowMessage(ctx, typ, messageWithActions(message, actions))
+		}
+		return nil, err
+	}
+	if picked == nil {
+		return nil, nil
+	}
+	if echoed && picked.Properties != nil {
+		return picked, nil
+	}
+	for i := range actions {
+		if actions[i].Title == picked.Title {
+			return &actions[i], nil
+		}
+	}
+	return picked, nil // Not one of the actions, returned as sent by the client
+}
+
+// messageWithActions returns message listing the titles of the actions the user can't pick,
+// so that the message still tells what the server asked.
+func messageWithActions(message string, actions []protocol.MessageActionItem) string {
+	if len(actions) == 0 {
+		return message
+	}
+	titles := make([]string, len(actions))
+	for i, action := range actions {
+		titles[i] = action.Title
+	}
+	return message + " (" + strings.Join(titles, ", ") + ")"
+}
@@ -0,0 +1,203 @@
+package textdocument
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// maxDiffCost bounds the work of the line diff: past that many line insertions
+// and deletions, the differing middle is replaced at once.
+const maxDiffCost = 2000
+
+// ComputeEdits returns the edits turning before into after. Lines are diffed with
+// the Myers algorithm, then each changed block is trimmed of its common prefix and
+// suffix, so a change inside a line only edits the changed characters. Small edits
+// keep the cursor, selections and markers of the client in place, which a whole
+// document replacement, e.g. by a formatter output, would reset.
+func ComputeEdits(before, after string) []protocol.TextEdit {
+	if before == after {
+		return nil
+	}
+	m := NewMapper(before)
+	a, b := splitLines(before), splitLines(after)
+
+	// lineOffset[i] is the byte offset of line i of before
+	lineOffset := make([]int, len(a)+1)
+	for i, line := range a {
+		lineOffset[i+1] = lineOffset[i] + len(line)
+	}
+
+	var edits []protocol.TextEdit
+	for _, h := range diffLines(a, b) {
+		start, end := lineOffset[h.aStart], lineOffset[h.aEnd]
+		oldText := before[start:end]
+		newText := strings.Join(b[h.bStart:h.bEnd], "")
+
+		prefix := commonPrefix(oldText, newText)
+		suffix := commonSuffix(oldText[prefix:], newText[prefix:])
+		// Positions can't point between "\r" and "\n", keep the pair in the edit
+		if prefix > 0 && oldText[prefix-1] == '\r' {
+			prefix--
+		}
+		if suffix > 0 && suffix < len(oldText)-prefix && oldText[len(oldText)-suffix-1] == '\r' {
+			suffix--
+		}
+		start, end = start+prefix, end-suffix
+		newText = newText[prefix : len(newText)-suffix]
+
+		rng, err := m.Range(start, end)
+		if err != nil {
+			continue // Offsets come from before, can't happen
+		}
+		edits = append(edits, protocol.TextEdit{Range: rng, NewText: newText})
+	}
+	return edits
+}
+
+// splitLines splits text after each "\n", the last line may not have one.
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// commonPrefix returns the length in bytes of the common prefix of a and b,
+// without splitting a rune.
+func commonPrefix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[n] == b[n] {
+		n++
+	}
+	for n > 0 && ((n < len(a) && !utf8.RuneStart(a[n])) || (n < len(b) && !utf8.RuneStart(b[n]))) {
+		n--
+	}
+	return n
+}
+
+// commonSuffix returns the length in bytes of the common suffix of a and b,
+// without splitting a rune.
+func commonSuffix(a, b string) int {
+	n := 0
+	for n < len(a) && n < len(b) && a[len(a)-1-n] == b[len(b)-1-n] {
+		n++
+	}
+	for n > 0 && !utf8.RuneStart(a[len(a)-n]) {
+		n--
+	}
+	return n
+}
+
+// hunk replaces the lines a[aStart:aEnd] with b[bStart:bEnd].
+type hunk struct {
+	aStart, aEnd int
+	bStart, bEnd int
+}
+
+// diffLines returns the hunks turning a into b, in order.
+func diffLines(a, b []string) []hunk {
+	// The common prefix and suffix don't need the expensive part
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	a, b = a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	hunks, ok := myers(a, b)
+	if !ok {
+		hunks = []hunk{{aEnd: len(a), bEnd: len(b)}}
+	}
+	for i := range hunks {
+		hunks[i].aStart += prefix
+		hunks[i].aEnd += prefix
+		hunks[i].bStart += prefix
+		hunks[i].bEnd += prefix
+	}
+	return hunks
+}
+
+// myers computes the shortest edit script between a and b, grouped in hunks.
+// ok is false when the script needs more than maxDiffCost operations.
+func myers(a, b []string) (hunks []hunk, ok bool) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		if n == 0 && m == 0 {
+			return nil, true
+		}
+		return []hunk{{aEnd: n, bEnd: m}}, true
+	}
+
+	// v[k+offset] is the furthest x reached on diagonal k = x - y,
+	// trace[d] keeps the diagonals [-d, d] of v after step d for the walk back.
+	maxD := min(n+m, maxDiffCost)
+	offset := maxD + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int
+	for d := 0; d <= maxD && !ok; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset] // Down, inserting b[y-1]
+			} else {
+				x = v[k-1+offset] + 1 // Right, deleting a[x-1]
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				ok = true
+				break
+			}
+		}
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+	}
+	if !ok {
+		return nil, false
+	}
+
+	// Walk back from the end, each step is a snake preceded by one insertion or deletion
+	type op struct {
+		insert bool
+		x, y   int // Position before the operation
+	}
+	var ops []op
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1]
+		at := func(k int) int { return prev[k+d-1] }
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		ops = append(ops, op{insert: prevK == k+1, x: prevX, y: prevY})
+		x, y = prevX, prevY
+	}
+
+	// Merge adjacent operations, ops are in reverse order
+	for i := len(ops) - 1; i >= 0; i-- {
+		o := ops[i]
+		if len(hunks) == 0 || hunks[len(hunks)-1].aEnd != o.x || hunks[len(hunks)-1].bEnd != o.y {
+			hunks = append(hunks, hunk{aStart: o.x, aEnd: o.x, bStart: o.y, bEnd: o.y})
+		}
+		h := &hunks[len(hunks)-1]
+		if o.insert {
+			h.bEnd++
+		} else {
+			h.aEnd++
+		}
+	}
+	return hunks, true
+}
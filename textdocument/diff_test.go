@@ -0,0 +1,153 @@
+package textdocument
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+func TestComputeEdits(t *testing.T) {
+	rng := func(sl, sc, el, ec uint) protocol.Range {
+		return protocol.Range{Start: protocol.Position{Line: sl, Character: sc}, End: protocol.Position{Line: el, Character: ec}}
+	}
+	tests := []struct {
+		name          string
+		before, after string
+		want          []protocol.TextEdit
+	}{
+		{
+			name:   "equal",
+			before: "a\nb\n",
+			after:  "a\nb\n",
+		},
+		{
+			name:   "inside a line",
+			before: "foo bar\nbaz\n",
+			after:  "foo qux\nbaz\n",
+			want:   []protocol.TextEdit{{Range: rng(0, 4, 0, 7), NewText: "qux"}},
+		},
+		{
+			name:   "inserted and deleted lines",
+			before: "a\nb\nc\nd\n",
+			after:  "a\nx\nc\n",
+			want: []protocol.TextEdit{
+				{Range: rng(1, 0, 1, 1), NewText: "x"},
+				{Range: rng(3, 0, 4, 0), NewText: ""},
+			},
+		},
+		{
+			// The edit can't end between "\r" and "\n"
+			name:   "crlf line replaced",
+			before: "one\r\ntwo\r\nthree\r\n",
+			after:  "one\r\n2\r\nthree\r\n",
+			want:   []protocol.TextEdit{{Range: rng(1, 0, 1, 3), NewText: "2"}},
+		},
+		{
+			name:   "crlf line joined",
+			before: "one\r\ntwo\r\n",
+			after:  "one two\r\n",
+			want:   []protocol.TextEdit{{Range: rng(0, 3, 1, 0), NewText: " "}},
+		},
+		{
+			// Both lines are one hunk, trimmed without splitting a "\r\n"
+			name:   "crlf to lf",
+			before: "a\r\nb\r\n",
+			after:  "a\nb\n",
+			want:   []protocol.TextEdit{{Range: rng(0, 1, 2, 0), NewText: "\nb\n"}},
+		},
+		{
+			// é and è share their first UTF-8 byte, the edit must not split them
+			name:   "multibyte prefix",
+			before: "café\n",
+			after:  "cafè\n",
+			want:   []protocol.TextEdit{{Range: rng(0, 3, 0, 4), NewText: "è"}},
+		},
+		{
+			// 😀 and 😁 share their first three bytes, 🙂 counts two UTF-16 units
+			name:   "multibyte suffix",
+			before: "😀🙂\n",
+			after:  "😁🙂\n",
+			want:   []protocol.TextEdit{{Range: rng(0, 0, 0, 2), NewText: "😁"}},
+		},
+		{
+			name:   "empty before",
+			before: "",
+			after:  "new\ntext",
+			want:   []protocol.TextEdit{{Range: rng(0, 0, 0, 0), NewText: "new\ntext"}},
+		},
+		{
+			name:   "empty after",
+			before: "old\ntext\n",
+			after:  "",
+			want:   []protocol.TextEdit{{Range: rng(0, 0, 2, 0), NewText: ""}},
+		},
+		{
+			name:   "trailing newline added",
+			before: "a\nb",
+			after:  "a\nb\n",
+			want:   []protocol.TextEdit{{Range: rng(1, 1, 1, 1), NewText: "\n"}},
+		},
+		{
+			name:   "trailing newline removed",
+			before: "a\nb\n",
+			after:  "a\nb",
+			want:   []protocol.TextEdit{{Range: rng(1, 1, 2, 0), NewText: ""}},
+		},
+		{
+			name:   "last line without newline changed",
+			before: "a\nbcd",
+			after:  "a\nbxd",
+			want:   []protocol.TextEdit{{Range: rng(1, 1, 1, 2), NewText: "x"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeEdits(tt.before, tt.after)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("got edits %+v, want %+v", got, tt.want)
+			}
+			applied, err := ApplyEdits(tt.before, got)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if applied != tt.after {
+				t.Errorf("applying the edits gives %q, want %q", applied, tt.after)
+			}
+		})
+	}
+}
+
+// TestComputeEditsPastMaxDiffCost checks a diff needing more than maxDiffCost operations
+// falls back to replacing the differing middle at once.
+func TestComputeEditsPastMaxDiffCost(t *testing.T) {
+	var before, after strings.Builder
+	before.WriteString("header\n")
+	after.WriteString("header\n")
+	for i := range maxDiffCost {
+		fmt.Fprintf(&before, "old %d\n", i)
+		fmt.Fprintf(&after, "new %d\n", i)
+	}
+	before.WriteString("footer\n")
+	after.WriteString("footer\n")
+
+	if _, ok := myers(splitLines(before.String()), splitLines(after.String())); ok {
+		t.Fatal("myers found a script past maxDiffCost")
+	}
+	edits := ComputeEdits(before.String(), after.String())
+	if len(edits) != 1 {
+		t.Fatalf("got %d edits, want the middle replaced at once", len(edits))
+	}
+	// Trimmed of the common lines, and of the common " <n>\n" end of the last changed one
+	if want := (protocol.Range{Start: protocol.Position{Line: 1}, End: protocol.Position{Line: maxDiffCost, Character: 3}}); edits[0].Range != want {
+		t.Errorf("got range %+v, want %+v", edits[0].Range, want)
+	}
+	applied, err := ApplyEdits(before.String(), edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != after.String() {
+		t.Error("applying the fallback edit doesn't give the new text")
+	}
+}
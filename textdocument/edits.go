@@ -0,0 +1,67 @@
+package textdocument
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ApplyEdits returns text with the edits applied. Edits refer to positions in the
+// original text and must not overlap, edits inserting at the same position are
+// applied in the order they are given, as clients do. The new text is inserted as is,
+// see LineEnding.NormalizeEdits to keep the line endings of text.
+func ApplyEdits(text string, edits []protocol.TextEdit) (string, error) {
+	if len(edits) == 0 {
+		return text, nil
+	}
+	m := NewMapper(text)
+
+	type offsetEdit struct {
+		start, end int
+		newText    string
+	}
+	resolved := make([]offsetEdit, len(edits))
+	for i, edit := range edits {
+		start, end, err := m.Offsets(edit.Range)
+		if err != nil {
+			return "", fmt.Errorf("edit %d: %w", i, err)
+		}
+		resolved[i] = offsetEdit{start: start, end: end, newText: edit.NewText}
+	}
+	sort.SliceStable(resolved, func(i, j int) bool {
+		return resolved[i].start < resolved[j].start
+	})
+
+	var sb strings.Builder
+	last := 0
+	for _, edit := range resolved {
+		if edit.start < last {
+			return "", fmt.Errorf("overlapping edits at offset %d", edit.start)
+		}
+		sb.WriteString(text[last:edit.start])
+		sb.WriteString(edit.newText)
+		last = edit.end
+	}
+	sb.WriteString(text[last:])
+	return sb.String(), nil
+}
+
+// ApplyContentChanges returns text with the changes of a textDocument/didChange notification
+// applied in order. A change without range replaces the whole text.
+func ApplyContentChanges(text string, changes []protocol.TextDocumentContentChangeEvent) (string, error) {
+	for i, change := range changes {
+		if change.Range == nil {
+			text = change.Text
+			continue
+		}
+		m := NewMapper(text)
+		start, end, err := m.Offsets(*change.Range)
+		if err != nil {
+			return "", fmt.Errorf("change %d: %w", i, err)
+		}
+		text = text[:start] + change.Text + text[end:]
+	}
+	return text, nil
+}
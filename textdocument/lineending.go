@@ -0,0 +1,72 @@
+package textdocument
+
+import (
+	"strings"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// LineEnding is the line terminator of a document.
+type LineEnding string
+
+const (
+	LF   LineEnding = "\n"
+	CRLF LineEnding = "\r\n"
+)
+
+// String returns the usual name of the line ending, "LF" or "CRLF".
+func (e LineEnding) String() string {
+	if e == CRLF {
+		return "CRLF"
+	}
+	return "LF"
+}
+
+// DetectLineEnding returns the line ending most lines of text end with, LF for a tie or a
+// text without line breaks. Texts mixing both, e.g. after pasting, are edited with the one
+// of the majority.
+func DetectLineEnding(text string) LineEnding {
+	lf, crlf := 0, 0
+	for i := 0; i < len(text); i++ {
+		if text[i] != '\n' {
+			continue
+		}
+		if i > 0 && text[i-1] == '\r' {
+			crlf++
+		} else {
+			lf++
+		}
+	}
+	if crlf > lf {
+		return CRLF
+	}
+	return LF
+}
+
+// Normalize returns text with its line terminators, "\n" or "\r\n", replaced by e. A lone
+// "\r" is not a line terminator for the protocol, it is kept.
+func (e LineEnding) Normalize(text string) string {
+	if !strings.Contains(text, "\n") {
+		return text
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if e == CRLF {
+		text = strings.ReplaceAll(text, "\n", "\r\n")
+	}
+	return text
+}
+
+// NormalizeEdits returns edits with the line terminators of their new text replaced by e.
+// Text generated with "\n", by a model, a template or a formatter, then keeps the line
+// endings of the document it is inserted in, both when the client applies the edits and
+// with ApplyEdits:
+//
+//	edits = textdocument.DetectLineEnding(text).NormalizeEdits(edits)
+func (e LineEnding) NormalizeEdits(edits []protocol.TextEdit) []protocol.TextEdit {
+	normalized := make([]protocol.TextEdit, len(edits))
+	for i, edit := range edits {
+		edit.NewText = e.Normalize(edit.NewText)
+		normalized[i] = edit
+	}
+	return normalized
+}
@@ -0,0 +1,91 @@
+package textdocument
+
+import (
+	"context"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// URILocks is a set of mutexes keyed by document URI, for handlers doing read-modify-write
+// work on a document (e.g. computing and applying an edit) without serializing the work
+// on other documents. The zero value is ready to use. Locks are not reentrant.
+// The URIs of a document encoded differently share its lock, see protocol.DocumentURI.Canonical.
+type URILocks struct {
+	mu    sync.Mutex
+	locks map[protocol.DocumentURI]*uriLock
+}
+
+// uriLock is a mutex usable with a context, a buffered channel holding a token when locked.
+type uriLock struct {
+	sem  chan struct{}
+	refs int // Holders and waiters, the lock is dropped from the map at 0
+}
+
+// acquire returns the lock of uri, counting the caller as a user.
+func (l *URILocks) acquire(uri protocol.DocumentURI) *uriLock {
+	uri = uri.Canonical()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[protocol.DocumentURI]*uriLock)
+	}
+	lock, ok := l.locks[uri]
+	if !ok {
+		lock = &uriLock{sem: make(chan struct{}, 1)}
+		l.locks[uri] = lock
+	}
+	lock.refs++
+	return lock
+}
+
+// release stops counting the caller as a user of the lock of uri.
+func (l *URILocks) release(uri protocol.DocumentURI, lock *uriLock) {
+	uri = uri.Canonical()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, uri)
+	}
+}
+
+// unlocker returns the function releasing a held lock, calling it more than once is a no-op.
+func (l *URILocks) unlocker(uri protocol.DocumentURI, lock *uriLock) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			<-lock.sem
+			l.release(uri, lock)
+		})
+	}
+}
+
+// Lock waits for the lock of uri and returns the function releasing it.
+// It returns the context error if ctx is done first, even when the lock is free.
+func (l *URILocks) Lock(ctx context.Context, uri protocol.DocumentURI) (unlock func(), err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err // The select below picks at random when both are ready
+	}
+	lock := l.acquire(uri)
+	select {
+	case lock.sem <- struct{}{}:
+		return l.unlocker(uri, lock), nil
+	case <-ctx.Done():
+		l.release(uri, lock)
+		return nil, ctx.Err()
+	}
+}
+
+// TryLock takes the lock of uri if it is free and returns the function releasing it,
+// ok is false when the lock is held.
+func (l *URILocks) TryLock(uri protocol.DocumentURI) (unlock func(), ok bool) {
+	lock := l.acquire(uri)
+	select {
+	case lock.sem <- struct{}{}:
+		return l.unlocker(uri, lock), true
+	default:
+		l.release(uri, lock)
+		return nil, false
+	}
+}
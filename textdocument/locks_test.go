@@ -0,0 +1,128 @@
+package textdocument
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// lockCount returns the number of locks in l, held or waited for.
+func lockCount(l *URILocks) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.locks)
+}
+
+func TestURILocksCancelledContext(t *testing.T) {
+	var l URILocks
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// Free lock, the done context still wins
+	for range 100 {
+		if _, err := l.Lock(ctx, "file:///a.go"); !errors.Is(err, context.Canceled) {
+			t.Fatalf("Lock with a cancelled context returned %v", err)
+		}
+	}
+	if n := lockCount(&l); n != 0 {
+		t.Errorf("%d locks left", n)
+	}
+}
+
+func TestURILocksCancelledWhileWaiting(t *testing.T) {
+	var l URILocks
+	unlock, err := l.Lock(context.Background(), "file:///a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := l.Lock(ctx, "file:///a.go"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Lock of a held lock returned %v", err)
+	}
+	unlock()
+	if n := lockCount(&l); n != 0 {
+		t.Errorf("%d locks left once the waiter gave up and the holder unlocked", n)
+	}
+}
+
+func TestURILocksTryLock(t *testing.T) {
+	var l URILocks
+	unlock, ok := l.TryLock("file:///a.go")
+	if !ok {
+		t.Fatal("TryLock of a free lock failed")
+	}
+	if _, ok := l.TryLock("file:///a.go"); ok {
+		t.Fatal("TryLock of a held lock succeeded")
+	}
+	// Other documents are not locked
+	unlockB, ok := l.TryLock("file:///b.go")
+	if !ok {
+		t.Fatal("TryLock of another document failed")
+	}
+	unlockB()
+	unlock()
+	unlock() // No-op
+	if n := lockCount(&l); n != 0 {
+		t.Errorf("%d locks left", n)
+	}
+	unlock, ok = l.TryLock("file:///a.go")
+	if !ok {
+		t.Fatal("TryLock once unlocked failed")
+	}
+	unlock()
+}
+
+func TestURILocksWaiterGetsLock(t *testing.T) {
+	var l URILocks
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	unlock, err := l.Lock(ctx, "file:///a.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan func())
+	go func() {
+		unlock, err := l.Lock(ctx, "file:///a.go")
+		if err != nil {
+			t.Error(err)
+		}
+		locked <- unlock
+	}()
+	for waiting := false; !waiting; time.Sleep(time.Millisecond) {
+		l.mu.Lock()
+		waiting = l.locks["file:///a.go"].refs == 2 // Holder and waiter
+		l.mu.Unlock()
+	}
+	unlock()
+	// The entry is kept for the waiter
+	select {
+	case unlock := <-locked:
+		if n := lockCount(&l); n != 1 {
+			t.Errorf("%d locks while held, want 1", n)
+		}
+		unlock()
+	case <-ctx.Done():
+		t.Fatal("waiter not given the lock")
+	}
+	if n := lockCount(&l); n != 0 {
+		t.Errorf("%d locks left", n)
+	}
+}
+
+func TestURILocksCanonical(t *testing.T) {
+	var l URILocks
+	unlock, ok := l.TryLock("file:///C%3A/a.go")
+	if !ok {
+		t.Fatal("TryLock failed")
+	}
+	if _, ok := l.TryLock(protocol.DocumentURI("file:///c:/a.go")); ok {
+		t.Error("differently encoded URI locked separately")
+	}
+	unlock()
+	if n := lockCount(&l); n != 0 {
+		t.Errorf("%d locks left", n)
+	}
+}
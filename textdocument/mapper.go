@@ -0,0 +1,190 @@
+// Package textdocument provides the text manipulations servers need on documents:
+// converting between byte offsets and LSP positions, applying text edits and
+// computing the edits turning a text into another.
+package textdocument
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Mapper converts between byte offsets in a text and LSP positions, whose characters
+// are counted in UTF-16 code units. Lines end with "\n" or "\r\n".
+// A Mapper is immutable and safe for concurrent use, create a new one when the text changes.
+type Mapper struct {
+	text   string
+	starts []int // Byte offset of each line start
+
+	utf16Once   sync.Once
+	utf16Starts []int // UTF-16 offset of each line start then of the end, see FromUTF16Offset
+}
+
+// NewMapper indexes the lines of text.
+func NewMapper(text string) *Mapper {
+	starts := []int{0}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &Mapper{text: text, starts: starts}
+}
+
+// Text returns the mapped text.
+func (m *Mapper) Text() string {
+	return m.text
+}
+
+// LineCount returns the number of lines, a text ending with a newline has an empty last line.
+func (m *Mapper) LineCount() int {
+	return len(m.starts)
+}
+
+// Line returns the text of a line, without its line terminator.
+func (m *Mapper) Line(line int) (string, error) {
+	if line < 0 || line >= len(m.starts) {
+		return "", fmt.Errorf("line %d out of bounds, the text has %d lines", line, len(m.starts))
+	}
+	return m.text[m.starts[line]:m.lineEnd(line)], nil
+}
+
+// lineEnd returns the byte offset of the end of a line, before its line terminator.
+func (m *Mapper) lineEnd(line int) int {
+	if line+1 >= len(m.starts) {
+		return len(m.text)
+	}
+	end := m.starts[line+1] - 1 // The '\n'
+	if end > m.starts[line] && m.text[end-1] == '\r' {
+		end--
+	}
+	return end
+}
+
+// Position returns the position of a byte offset. Offsets inside a multi-byte rune
+// map to the start of the rune.
+func (m *Mapper) Position(offset int) (protocol.Position, error) {
+	if offset < 0 || offset > len(m.text) {
+		return protocol.Position{}, fmt.Errorf("offset %d out of bounds [0, %d]", offset, len(m.text))
+	}
+	for offset > 0 && offset < len(m.text) && !utf8.RuneStart(m.text[offset]) {
+		offset--
+	}
+	line := sort.Search(len(m.starts), func(i int) bool { return m.starts[i] > offset }) - 1
+	end := min(offset, m.lineEnd(line))
+	character := 0
+	for _, r := range m.text[m.starts[line]:end] {
+		character += utf16.RuneLen(r)
+	}
+	return protocol.Position{Line: uint(line), Character: uint(character)}, nil
+}
+
+// Offset returns the byte offset of a position. As the protocol specifies, a character
+// past the end of the line maps to the end of the line. A line past the end of the text
+// is an error.
+func (m *Mapper) Offset(pos protocol.Position) (int, error) {
+	if int(pos.Line) >= len(m.starts) {
+		return 0, fmt.Errorf("line %d out of bounds, the text has %d lines", pos.Line, len(m.starts))
+	}
+	start, end := m.starts[pos.Line], m.lineEnd(int(pos.Line))
+	character := uint(0)
+	for i, r := range m.text[start:end] {
+		if character >= pos.Character {
+			return start + i, nil
+		}
+		character += uint(utf16.RuneLen(r))
+	}
+	return end, nil
+}
+
+// StrictOffset is like Offset but fails when the character is past the end of the line
+// or inside a surrogate pair, for callers validating positions sent by a peer.
+func (m *Mapper) StrictOffset(pos protocol.Position) (int, error) {
+	if int(pos.Line) >= len(m.starts) {
+		return 0, fmt.Errorf("line %d out of bounds, the text has %d lines", pos.Line, len(m.starts))
+	}
+	start, end := m.starts[pos.Line], m.lineEnd(int(pos.Line))
+	character := uint(0)
+	for i, r := range m.text[start:end] {
+		if character == pos.Character {
+			return start + i, nil
+		}
+		if character > pos.Character {
+			return 0, fmt.Errorf("character %d of line %d is inside a surrogate pair", pos.Character, pos.Line)
+		}
+		character += uint(utf16.RuneLen(r))
+	}
+	if character != pos.Character {
+		return 0, fmt.Errorf("character %d out of bounds, line %d has %d characters", pos.Character, pos.Line, character)
+	}
+	return end, nil
+}
+
+// FromUTF16Offset returns the byte offset of an offset counted in UTF-16 code units from the
+// start of the text, the way Java, JavaScript and C# index strings: services written in
+// them report such offsets. Offsets inside a surrogate pair map to the start of the rune.
+func (m *Mapper) FromUTF16Offset(offset int) (int, error) {
+	m.utf16Once.Do(func() {
+		m.utf16Starts = make([]int, len(m.starts)+1)
+		units := 0
+		for line, start := range m.starts {
+			m.utf16Starts[line] = units
+			end := len(m.text)
+			if line+1 < len(m.starts) {
+				end = m.starts[line+1]
+			}
+			for _, r := range m.text[start:end] {
+				units += utf16.RuneLen(r)
+			}
+		}
+		m.utf16Starts[len(m.starts)] = units
+	})
+	if total := m.utf16Starts[len(m.starts)]; offset < 0 || offset > total {
+		return 0, fmt.Errorf("UTF-16 offset %d out of bounds [0, %d]", offset, total)
+	}
+
+	line := sort.Search(len(m.starts), func(i int) bool { return m.utf16Starts[i] > offset }) - 1
+	units := m.utf16Starts[line]
+	for i, r := range m.text[m.starts[line]:] {
+		units += utf16.RuneLen(r)
+		if units > offset {
+			return m.starts[line] + i, nil
+		}
+	}
+	return len(m.text), nil
+}
+
+// Range returns the range between two byte offsets.
+func (m *Mapper) Range(start, end int) (protocol.Range, error) {
+	if start > end {
+		return protocol.Range{}, fmt.Errorf("invalid offsets: start %d after end %d", start, end)
+	}
+	startPos, err := m.Position(start)
+	if err != nil {
+		return protocol.Range{}, err
+	}
+	endPos, err := m.Position(end)
+	if err != nil {
+		return protocol.Range{}, err
+	}
+	return protocol.Range{Start: startPos, End: endPos}, nil
+}
+
+// Offsets returns the byte offsets of a range.
+func (m *Mapper) Offsets(rng protocol.Range) (start, end int, err error) {
+	if start, err = m.Offset(rng.Start); err != nil {
+		return 0, 0, err
+	}
+	if end, err = m.Offset(rng.End); err != nil {
+		return 0, 0, err
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("invalid range: start %d:%d after end %d:%d",
+			rng.Start.Line, rng.Start.Character, rng.End.Line, rng.End.Character)
+	}
+	return start, end, nil
+}
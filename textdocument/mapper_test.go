@@ -0,0 +1,111 @@
+package textdocument
+
+import (
+	"testing"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+func TestFromUTF16Offset(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		// UTF-16 offset to expected byte offset, -1 for an error
+		offsets map[int]int
+	}{
+		{
+			name:    "ascii",
+			text:    "hello",
+			offsets: map[int]int{0: 0, 3: 3, 5: 5, 6: -1, -1: -1},
+		},
+		{
+			// 😀 is U+1F600: 4 bytes, 2 UTF-16 code units (a surrogate pair)
+			name:    "surrogate pair",
+			text:    "a😀b",
+			offsets: map[int]int{0: 0, 1: 1, 3: 5, 4: 6, 5: -1},
+		},
+		{
+			name:    "mid surrogate",
+			text:    "a😀b",
+			offsets: map[int]int{2: 1}, // Inside the pair: start of the rune
+		},
+		{
+			name:    "consecutive surrogate pairs",
+			text:    "😀😀x",
+			offsets: map[int]int{0: 0, 1: 0, 2: 4, 3: 4, 4: 8, 5: 9},
+		},
+		{
+			// CJK characters are 3 bytes but a single code unit
+			name:    "cjk",
+			text:    "日本語です",
+			offsets: map[int]int{0: 0, 1: 3, 2: 6, 5: 15, 6: -1},
+		},
+		{
+			name:    "crlf",
+			text:    "ab\r\ncd\r\n😀x",
+			offsets: map[int]int{2: 2, 3: 3, 4: 4, 6: 6, 8: 8, 9: 8, 10: 12, 11: 13, 12: -1},
+		},
+		{
+			name:    "cjk and emoji on several lines",
+			text:    "日本\n😀 語\ré",
+			offsets: map[int]int{2: 6, 3: 7, 4: 7, 5: 11, 6: 12, 7: 15, 8: 16, 9: 18},
+		},
+		{
+			name:    "empty",
+			text:    "",
+			offsets: map[int]int{0: 0, 1: -1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMapper(tt.text)
+			for offset, want := range tt.offsets {
+				got, err := m.FromUTF16Offset(offset)
+				switch {
+				case want == -1 && err == nil:
+					t.Errorf("FromUTF16Offset(%d) = %d, want an error", offset, got)
+				case want != -1 && err != nil:
+					t.Errorf("FromUTF16Offset(%d): %v", offset, err)
+				case want != -1 && got != want:
+					t.Errorf("FromUTF16Offset(%d) = %d, want %d", offset, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestFromUTF16OffsetRange checks a match reported in UTF-16 offsets, as LanguageTool does,
+// lands on the right LSP range after emoji and CJK text.
+func TestFromUTF16OffsetRange(t *testing.T) {
+	text := "😀 日本 teh cat\r\nthe 😀 dgo"
+	m := NewMapper(text)
+	for _, tt := range []struct {
+		offset, length int
+		word           string
+		want           protocol.Range
+	}{
+		// 😀 (2 units) + space + 日本 (2 units) + space: "teh" starts at unit 6
+		{6, 3, "teh", protocol.Range{Start: protocol.Position{Line: 0, Character: 6}, End: protocol.Position{Line: 0, Character: 9}}},
+		// Line 1 starts at unit 15 after the CRLF, "dgo" at 15 + 7
+		{22, 3, "dgo", protocol.Range{Start: protocol.Position{Line: 1, Character: 7}, End: protocol.Position{Line: 1, Character: 10}}},
+	} {
+		start, err := m.FromUTF16Offset(tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		end, err := m.FromUTF16Offset(tt.offset + tt.length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := text[start:end]; got != tt.word {
+			t.Errorf("offset %d: got %q, want %q", tt.offset, got, tt.word)
+		}
+		rng, err := m.Range(start, end)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rng != tt.want {
+			t.Errorf("offset %d: got range %+v, want %+v", tt.offset, rng, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package textdocument
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Snapshot is the immutable state of an open document at a version.
+type Snapshot struct {
+	URI        protocol.DocumentURI
+	LanguageID protocol.LanguageID
+	Version    int
+	Text       string
+
+	mapperOnce sync.Once
+	mapper     *Mapper
+
+	lineEndingOnce sync.Once
+	lineEnding     LineEnding
+}
+
+// NewSnapshot creates a snapshot of a document.
+func NewSnapshot(uri protocol.DocumentURI, languageID protocol.LanguageID, version int, text string) *Snapshot {
+	return &Snapshot{URI: uri, LanguageID: languageID, Version: version, Text: text}
+}
+
+// Mapper returns the position mapper of the snapshot text, built on first use.
+func (s *Snapshot) Mapper() *Mapper {
+	s.mapperOnce.Do(func() {
+		s.mapper = NewMapper(s.Text)
+	})
+	return s.mapper
+}
+
+// LineEnding returns the line ending of the snapshot text, see DetectLineEnding. Handlers
+// producing text use it to keep the line endings of the document.
+func (s *Snapshot) LineEnding() LineEnding {
+	s.lineEndingOnce.Do(func() {
+		s.lineEnding = DetectLineEnding(s.Text)
+	})
+	return s.lineEnding
+}
+
+// Store keeps the snapshots of the open documents, updated from the text synchronization
+// notifications. It is safe for concurrent use, snapshots stay valid after later changes.
+//
+// Documents of any URI scheme are stored, e.g. untitled ones. They are keyed by the
+// canonical form of their URI (see protocol.DocumentURI.Canonical), so that Get finds a
+// document whatever the encoding of the URI, while snapshots keep the URI of the client.
+type Store struct {
+	mu   sync.RWMutex
+	docs map[protocol.DocumentURI]*Snapshot // By canonical URI
+
+	locks URILocks
+}
+
+// NewStore creates an empty store.
+func NewStore() *Store {
+	return &Store{docs: make(map[protocol.DocumentURI]*Snapshot)}
+}
+
+// Locks returns the per document locks of the store. The store itself does not take them,
+// they serialize the handlers editing the same document, e.g.
+//
+//	unlock, err := store.Locks().Lock(ctx, uri)
+//	if err != nil {
+//		return err
+//	}
+//	defer unlock()
+func (s *Store) Locks() *URILocks {
+	return &s.locks
+}
+
+// Open stores a document opened by the client, replacing any previous state.
+func (s *Store) Open(item protocol.TextDocumentItem) *Snapshot {
+	snapshot := NewSnapshot(item.URI, item.LanguageID, item.Version, item.Text)
+	s.mu.Lock()
+	s.docs[item.URI.Canonical()] = snapshot
+	s.mu.Unlock()
+	return snapshot
+}
+
+// Change applies the changes of a textDocument/didChange notification, both full and
+// incremental, and returns the new snapshot.
+func (s *Store) Change(params *protocol.DidChangeTextDocumentParams) (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uri := params.TextDocument.URI
+	previous, ok := s.docs[uri.Canonical()]
+	if !ok {
+		return nil, fmt.Errorf("change for document %s which is not open", uri)
+	}
+	text, err := ApplyContentChanges(previous.Text, params.ContentChanges)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply changes to %s: %w", uri, err)
+	}
+	snapshot := NewSnapshot(previous.URI, previous.LanguageID, params.TextDocument.Version, text)
+	s.docs[uri.Canonical()] = snapshot
+	return snapshot, nil
+}
+
+// Save updates a document from a textDocument/didSave notification carrying its text, sent
+// when the server asked for it with SaveOptions.IncludeText. The version is unchanged, a
+// save does not edit the document but the text resyncs the store if it drifted. It returns
+// the snapshot and whether the text changed.
+func (s *Store) Save(params *protocol.DidSaveTextDocumentParams) (*Snapshot, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uri := params.TextDocument.URI
+	previous, ok := s.docs[uri.Canonical()]
+	if !ok {
+		return nil, false, fmt.Errorf("save for document %s which is not open", uri)
+	}
+	if params.Text == nil || *params.Text == previous.Text {
+		return previous, false, nil
+	}
+	snapshot := NewSnapshot(previous.URI, previous.LanguageID, previous.Version, *params.Text)
+	s.docs[uri.Canonical()] = snapshot
+	return snapshot, true, nil
+}
+
+// Close forgets a document closed by the client.
+func (s *Store) Close(uri protocol.DocumentURI) {
+	s.mu.Lock()
+	delete(s.docs, uri.Canonical())
+	s.mu.Unlock()
+}
+
+// Get returns the current snapshot of an open document.
+func (s *Store) Get(uri protocol.DocumentURI) (*Snapshot, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	snapshot, ok := s.docs[uri.Canonical()]
+	return snapshot, ok
+}
+
+// Snapshots returns the current snapshots of all open documents, sorted by URI.
+func (s *Store) Snapshots() []*Snapshot {
+	s.mu.RLock()
+	snapshots := make([]*Snapshot, 0, len(s.docs))
+	for _, snapshot := range s.docs {
+		snapshots = append(snapshots, snapshot)
+	}
+	s.mu.RUnlock()
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].URI < snapshots[j].URI })
+	return snapshots
+}
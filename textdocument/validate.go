@@ -0,0 +1,111 @@
+package textdocument
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// ErrStaleVersion is returned when an edit targets another version than the open document.
+var ErrStaleVersion = errors.New("stale document version")
+
+// ValidateWorkspaceEdit checks a workspace edit against the open documents before it is
+// sent with workspace/applyEdit. Clients reject, sometimes silently, edits whose version
+// is not the current one, and edits outside the text or overlapping each other.
+// Documents which are not open, and resource operations, can't be checked and are accepted.
+func (s *Store) ValidateWorkspaceEdit(edit protocol.WorkspaceEdit) error {
+	for _, dc := range edit.DocumentChanges {
+		change := dc.TextDocumentEdit
+		if change == nil {
+			continue
+		}
+		uri := change.TextDocument.URI
+		snapshot, ok := s.Get(uri)
+		if !ok {
+			continue
+		}
+		if v := change.TextDocument.Version; v != nil && *v != snapshot.Version {
+			return fmt.Errorf("%w: edit for %s targets version %d, the document is at version %d",
+				ErrStaleVersion, uri, *v, snapshot.Version)
+		}
+		if err := ValidateEdits(snapshot.Mapper(), change.Edits); err != nil {
+			return fmt.Errorf("invalid edit for %s (version %d): %w", uri, snapshot.Version, err)
+		}
+	}
+
+	// Sorted for a deterministic error
+	uris := make([]protocol.DocumentURI, 0, len(edit.Changes))
+	for uri := range edit.Changes {
+		uris = append(uris, uri)
+	}
+	sort.Slice(uris, func(i, j int) bool { return uris[i] < uris[j] })
+	for _, uri := range uris {
+		snapshot, ok := s.Get(uri)
+		if !ok {
+			continue
+		}
+		if err := ValidateEdits(snapshot.Mapper(), edit.Changes[uri]); err != nil {
+			return fmt.Errorf("invalid edit for %s (version %d): %w", uri, snapshot.Version, err)
+		}
+	}
+	return nil
+}
+
+// ValidateEdits checks that the edits are inside the text of m, do not end before they
+// start and do not overlap.
+func ValidateEdits(m *Mapper, edits []protocol.TextEdit) error {
+	type span struct{ index, start, end int }
+	spans := make([]span, len(edits))
+	for i, edit := range edits {
+		start, err := m.StrictOffset(edit.Range.Start)
+		if err != nil {
+			return fmt.Errorf("edit %d start: %w", i, err)
+		}
+		end, err := m.StrictOffset(edit.Range.End)
+		if err != nil {
+			return fmt.Errorf("edit %d end: %w", i, err)
+		}
+		if start > end {
+			return fmt.Errorf("edit %d ends before it starts", i)
+		}
+		spans[i] = span{index: i, start: start, end: end}
+	}
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+	for i := 1; i < len(spans); i++ {
+		if spans[i].start < spans[i-1].end {
+			return fmt.Errorf("edits %d and %d overlap", spans[i-1].index, spans[i].index)
+		}
+	}
+	return nil
+}
+
+// ValidateCompletionItems checks the edits of completion items computed at pos, as the
+// spec requires: the TextEdit of an item is on a single line and contains pos, and its
+// additionalTextEdits overlap neither each other nor the TextEdit. Clients break silently,
+// e.g. inserting at the wrong place or dropping the item, on items violating them.
+func ValidateCompletionItems(m *Mapper, pos protocol.Position, items []protocol.CompletionItem) error {
+	for i, item := range items {
+		edits := item.AdditionalTextEdits
+		if item.TextEdit != nil {
+			rng := item.TextEdit.Range
+			if rng.Start.Line != rng.End.Line {
+				return fmt.Errorf("completion item %d %q: textEdit spans lines %d to %d, it must be on a single line",
+					i, item.Label, rng.Start.Line, rng.End.Line)
+			}
+			if pos.Line != rng.Start.Line || pos.Character < rng.Start.Character || pos.Character > rng.End.Character {
+				return fmt.Errorf("completion item %d %q: textEdit range %d:%d-%d:%d does not contain the position %d:%d",
+					i, item.Label, rng.Start.Line, rng.Start.Character, rng.End.Line, rng.End.Character, pos.Line, pos.Character)
+			}
+			edits = append([]protocol.TextEdit{*item.TextEdit}, edits...)
+		}
+		if err := ValidateEdits(m, edits); err != nil {
+			if item.TextEdit != nil {
+				return fmt.Errorf("completion item %d %q (edit 0 is the textEdit): %w", i, item.Label, err)
+			}
+			return fmt.Errorf("completion item %d %q: %w", i, item.Label, err)
+		}
+	}
+	return nil
+}
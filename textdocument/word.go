@@ -0,0 +1,109 @@
+package textdocument
+
+import (
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// WordChars reports whether a rune is part of a word, e.g. an identifier of the language.
+type WordChars func(r rune) bool
+
+// IdentifierChars are letters, digits and underscores, the identifiers of most languages.
+func IdentifierChars(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// identifierOr returns IdentifierChars extended with extra runes.
+func identifierOr(extra ...rune) WordChars {
+	return func(r rune) bool {
+		for _, e := range extra {
+			if r == e {
+				return true
+			}
+		}
+		return IdentifierChars(r)
+	}
+}
+
+var (
+	wordCharsMu sync.RWMutex
+	// wordChars are the word characters of the languages where identifiers differ.
+	wordChars = map[protocol.LanguageID]WordChars{
+		"css":         identifierOr('-'),
+		"scss":        identifierOr('-', '$'),
+		"less":        identifierOr('-', '@'),
+		"html":        identifierOr('-'),
+		"clojure":     identifierOr('-', '?', '!', '*', '+', '<', '>', '='),
+		"lisp":        identifierOr('-', '?', '!', '*', '+', '<', '>', '='),
+		"scheme":      identifierOr('-', '?', '!', '*', '+', '<', '>', '='),
+		"php":         identifierOr('$'),
+		"perl":        identifierOr('$', '@', '%'),
+		"shellscript": identifierOr('-'),
+		"ruby":        identifierOr('?', '!'),
+	}
+)
+
+// SetWordChars sets the word characters of a language, identified as in
+// TextDocumentItem.LanguageID. nil restores IdentifierChars.
+func SetWordChars(languageID protocol.LanguageID, chars WordChars) {
+	wordCharsMu.Lock()
+	defer wordCharsMu.Unlock()
+	if chars == nil {
+		delete(wordChars, languageID)
+		return
+	}
+	wordChars[languageID] = chars
+}
+
+// WordCharsFor returns the word characters of a language, IdentifierChars by default.
+func WordCharsFor(languageID protocol.LanguageID) WordChars {
+	wordCharsMu.RLock()
+	defer wordCharsMu.RUnlock()
+	if chars, ok := wordChars[languageID]; ok {
+		return chars
+	}
+	return IdentifierChars
+}
+
+// WordAt returns the word at a position and its range, for hover, highlight or rename
+// handlers. The position is between characters, the word touching it is returned, also when
+// the cursor is right after its last character. ok is false when the position touches no
+// word or is out of the text.
+func (m *Mapper) WordAt(pos protocol.Position, chars WordChars) (word string, rng protocol.Range, ok bool) {
+	offset, err := m.Offset(pos)
+	if err != nil {
+		return "", protocol.Range{}, false
+	}
+	start, end := offset, offset
+	for start > 0 {
+		r, size := utf8.DecodeLastRuneInString(m.text[:start])
+		if !chars(r) {
+			break
+		}
+		start -= size
+	}
+	for end < len(m.text) {
+		r, size := utf8.DecodeRuneInString(m.text[end:])
+		if !chars(r) {
+			break
+		}
+		end += size
+	}
+	if start == end {
+		return "", protocol.Range{}, false
+	}
+	rng, err = m.Range(start, end)
+	if err != nil {
+		return "", protocol.Range{}, false
+	}
+	return m.text[start:end], rng, true
+}
+
+// WordAt returns the word at a position with the word characters of the document language,
+// see Mapper.WordAt.
+func (s *Snapshot) WordAt(pos protocol.Position) (word string, rng protocol.Range, ok bool) {
+	return s.Mapper().WordAt(pos, WordCharsFor(s.LanguageID))
+}
@@ -0,0 +1,383 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/akhenakh/lspgo/protocol"
+	"github.com/akhenakh/lspgo/textdocument"
+)
+
+// Selector reports whether the file at path is indexed.
+type Selector func(path string) bool
+
+// SelectLanguages selects the files of languages, guessed from their names with
+// protocol.LanguageIDForPath.
+func SelectLanguages(ids ...protocol.LanguageID) Selector {
+	return func(path string) bool {
+		return slices.Contains(ids, protocol.LanguageIDForPath(path))
+	}
+}
+
+// IndexFunc processes a file of the workspace, e.g. extracting its symbols.
+// It is called concurrently for different files.
+type IndexFunc func(ctx context.Context, uri protocol.DocumentURI, text string) error
+
+// IndexProgress reports the progress of indexing, *server.Progress and
+// *server.ThrottledProgress implement it.
+type IndexProgress interface {
+	Report(ctx context.Context, message string, percentage *uint) error
+	End(ctx context.Context, message string) error
+	// Cancelled is closed when the user cancels the progress.
+	Cancelled() <-chan struct{}
+}
+
+// ErrIndexingCancelled is returned by Run when the user cancelled the indexing progress.
+var ErrIndexingCancelled = errors.New("indexing cancelled")
+
+// IndexStats describes an indexing run.
+type IndexStats struct {
+	Files  int // Files indexed
+	Failed int // Files whose IndexFunc failed, or which could not be read
+}
+
+// Indexer processes the files of the workspace in the background, and keeps them indexed
+// as they change on disk. It is safe for concurrent use.
+type Indexer struct {
+	// Select picks the files to index, it is required.
+	Select Selector
+	// Index processes each selected file, it is required.
+	Index IndexFunc
+	// Remove is called for indexed files deleted from the workspace, it may be nil.
+	Remove func(uri protocol.DocumentURI)
+	// Documents, when set, overlays the files on disk: open documents are indexed with
+	// their text in the editor, saved or not.
+	Documents *textdocument.Store
+	// Parallelism is the number of files processed at once. Defaults to runtime.NumCPU().
+	Parallelism int
+	// StartProgress, when set, starts the progress reported while indexing. Each file is
+	// reported, throttle them:
+	//
+	//	func(ctx context.Context, title string) (workspace.IndexProgress, error) {
+	//		p, err := s.StartProgress(ctx, nil, title, true)
+	//		if err != nil {
+	//			return nil, err
+	//		}
+	//		return server.NewThrottledProgress(p, server.DefaultProgressInterval, server.DefaultProgressMinDelta), nil
+	//	}
+	StartProgress func(ctx context.Context, title string) (IndexProgress, error)
+	// Logger logs the files failing to index. Defaults to discarding.
+	Logger *log.Logger
+
+	mu     sync.Mutex
+	cancel context.CancelFunc // Cancels the current Run
+
+	roots   map[string]*rootRun           // IndexRoot runs in progress, by root
+	indexed map[protocol.DocumentURI]bool // Files indexed, see RemoveRoot
+}
+
+// rootRun is an IndexRoot run in progress.
+type rootRun struct {
+	cancel func()
+}
+
+// NewIndexer creates an indexer processing the files matching selector with index.
+func NewIndexer(selector Selector, index IndexFunc) *Indexer {
+	return &Indexer{Select: selector, Index: index}
+}
+
+func (ix *Indexer) logf(format string, args ...any) {
+	if ix.Logger != nil {
+		ix.Logger.Printf(format, args...)
+	}
+}
+
+// Run indexes the selected files under roots, hidden directories (.git, ...) excluded.
+// A Run in progress is cancelled first, the index is rebuilt from scratch.
+// It stops when ctx is done or the user cancels the progress, returning ErrIndexingCancelled.
+func (ix *Indexer) Run(ctx context.Context, roots ...string) (IndexStats, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	ix.mu.Lock()
+	if ix.cancel != nil {
+		ix.cancel()
+	}
+	ix.cancel = func() { cancel(context.Canceled) }
+	ix.mu.Unlock()
+	return ix.run(ctx, cancel, "Indexing workspace", roots)
+}
+
+// IndexRoot indexes the selected files under root, e.g. a folder added to the workspace,
+// alongside the files already indexed: unlike Run, the other runs go on. An IndexRoot of
+// the same root in progress is cancelled first.
+func (ix *Indexer) IndexRoot(ctx context.Context, root string) (IndexStats, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	run := &rootRun{cancel: func() { cancel(context.Canceled) }}
+	ix.mu.Lock()
+	if previous, ok := ix.roots[root]; ok {
+		previous.cancel()
+	}
+	if ix.roots == nil {
+		ix.roots = make(map[string]*rootRun)
+	}
+	ix.roots[root] = run
+	ix.mu.Unlock()
+	defer func() {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+		if ix.roots[root] == run {
+			delete(ix.roots, root)
+		}
+	}()
+	return ix.run(ctx, cancel, "Indexing "+filepath.Base(root), []string{root})
+}
+
+// RemoveRoot stops indexing root and removes its indexed files, calling Remove for each,
+// e.g. for a folder removed from the workspace.
+func (ix *Indexer) RemoveRoot(root string) {
+	ix.mu.Lock()
+	if run, ok := ix.roots[root]; ok {
+		run.cancel()
+		delete(ix.roots, root)
+	}
+	var removed []protocol.DocumentURI
+	for uri := range ix.indexed {
+		path, err := uri.Path()
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(root, path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			delete(ix.indexed, uri)
+			removed = append(removed, uri)
+		}
+	}
+	ix.mu.Unlock()
+	if ix.Remove != nil {
+		for _, uri := range removed {
+			ix.Remove(uri)
+		}
+	}
+}
+
+// FoldersChanged indexes the folders added to the workspace and removes the files of the
+// removed ones, it can be added as a hook with server.OnWorkspaceFoldersChanged. Folders
+// which are not local directories are skipped.
+func (ix *Indexer) FoldersChanged(ctx context.Context, event protocol.WorkspaceFoldersChangeEvent) {
+	for _, folder := range event.Removed {
+		if root, err := protocol.DocumentURI(folder.URI).Path(); err == nil {
+			ix.RemoveRoot(root)
+		}
+	}
+	for _, folder := range event.Added {
+		root, err := protocol.DocumentURI(folder.URI).Path()
+		if err != nil {
+			continue
+		}
+		if _, err := ix.IndexRoot(ctx, root); err != nil {
+			ix.logf("Failed to index folder %s: %v", root, err)
+		}
+	}
+}
+
+// run indexes the selected files under roots, with a progress titled title. cancel
+// cancels ctx, with ErrIndexingCancelled when the user cancels the progress.
+func (ix *Indexer) run(ctx context.Context, cancel context.CancelCauseFunc, title string, roots []string) (IndexStats, error) {
+	var progress IndexProgress
+	if ix.StartProgress != nil {
+		p, err := ix.StartProgress(ctx, title)
+		if err != nil {
+			ix.logf("Indexing without progress: %v", err)
+		} else {
+			progress = p
+			go func() {
+				select {
+				case <-p.Cancelled():
+					cancel(ErrIndexingCancelled)
+				case <-ctx.Done():
+				}
+			}()
+		}
+	}
+
+	paths, err := ix.collect(ctx, roots)
+	var stats IndexStats
+	if err == nil {
+		stats, err = ix.process(ctx, paths, progress)
+	}
+	if errors.Is(err, context.Canceled) && errors.Is(context.Cause(ctx), ErrIndexingCancelled) {
+		err = ErrIndexingCancelled
+	}
+
+	if progress != nil {
+		message := fmt.Sprintf("Indexed %d files", stats.Files)
+		if err != nil {
+			message = fmt.Sprintf("Indexing stopped after %d files: %v", stats.Files, err)
+		}
+		// The run ctx may be cancelled, the client must still learn the progress ended
+		progress.End(context.WithoutCancel(ctx), message) //nolint:errcheck
+	}
+	return stats, err
+}
+
+// Cancel stops the current Run and IndexRoot runs, if any.
+func (ix *Indexer) Cancel() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.cancel != nil {
+		ix.cancel()
+	}
+	for _, run := range ix.roots {
+		run.cancel()
+	}
+}
+
+// collect lists the selected files under roots.
+func (ix *Indexer) collect(ctx context.Context, roots []string) ([]string, error) {
+	var paths []string
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				ix.logf("Skipping %s: %v", path, err)
+				return nil // Unreadable entries don't stop indexing
+			}
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && ix.Select(path) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
+
+// process indexes paths with bounded parallelism, reporting progress as files are done.
+func (ix *Indexer) process(ctx context.Context, paths []string, progress IndexProgress) (IndexStats, error) {
+	parallelism := ix.Parallelism
+	if parallelism <= 0 {
+		parallelism = runtime.NumCPU()
+	}
+
+	var done, failed atomic.Int64
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for range parallelism {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				if err := ix.indexFile(ctx, path); err != nil {
+					ix.logf("Failed to index %s: %v", path, err)
+					failed.Add(1)
+				}
+				n := done.Add(1)
+				if progress != nil {
+					percentage := uint(n * 100 / int64(len(paths)))
+					progress.Report(ctx, fmt.Sprintf("%d/%d files", n, len(paths)), &percentage) //nolint:errcheck
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for _, path := range paths {
+		select {
+		case jobs <- path:
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return IndexStats{Files: int(done.Load() - failed.Load()), Failed: int(failed.Load())}, err
+}
+
+// indexFile reads a file, from the open documents first, and indexes it.
+func (ix *Indexer) indexFile(ctx context.Context, path string) error {
+	uri := protocol.URIFromPath(path)
+	var text string
+	if snapshot, ok := ix.openDocument(uri); ok {
+		text = snapshot.Text
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if !utf8.Valid(data) {
+			return fmt.Errorf("not UTF-8 text")
+		}
+		text = string(data)
+	}
+	if err := ix.Index(ctx, uri, text); err != nil {
+		return err
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.indexed == nil {
+		ix.indexed = make(map[protocol.DocumentURI]bool)
+	}
+	ix.indexed[uri] = true
+	return nil
+}
+
+// openDocument returns the snapshot of a file open in the editor, when Documents is set.
+func (ix *Indexer) openDocument(uri protocol.DocumentURI) (*textdocument.Snapshot, bool) {
+	if ix.Documents == nil {
+		return nil, false
+	}
+	return ix.Documents.Get(uri)
+}
+
+// DidChangeWatchedFiles re-indexes the selected files created or changed on disk, and
+// removes the deleted ones. It can be called from a workspace/didChangeWatchedFiles handler.
+func (ix *Indexer) DidChangeWatchedFiles(ctx context.Context, params *protocol.DidChangeWatchedFilesParams) error {
+	ix.FilesChanged(ctx, params.Changes)
+	return nil
+}
+
+// FilesChanged is DidChangeWatchedFiles for a list of changes, it can be added as a hook
+// with server.OnFilesChanged.
+func (ix *Indexer) FilesChanged(ctx context.Context, changes []protocol.FileEvent) {
+	for _, change := range changes {
+		path, err := change.URI.Path()
+		if err != nil || !ix.Select(path) {
+			continue
+		}
+		if change.Type == protocol.FileChangeTypeDeleted {
+			ix.mu.Lock()
+			delete(ix.indexed, protocol.URIFromPath(path))
+			ix.mu.Unlock()
+			if ix.Remove != nil {
+				ix.Remove(change.URI)
+			}
+			continue
+		}
+		if err := ix.indexFile(ctx, path); err != nil {
+			ix.logf("Failed to re-index %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Package workspace provides reusable building blocks for workspace wide features.
+package workspace
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/akhenakh/lspgo/fuzzy"
+	"github.com/akhenakh/lspgo/protocol"
+)
+
+// Matcher scores candidate against query, ok is false when candidate doesn't match.
+// Higher scores rank first.
+type Matcher func(query, candidate string) (score int, ok bool)
+
+// Extractor returns the symbols defined in a document.
+type Extractor func(uri protocol.DocumentURI, text string) []protocol.SymbolInformation
+
+// SymbolIndex is an in-memory index of workspace symbols, suitable to answer workspace/symbol.
+// Symbols are stored per document and replaced as a whole on each update.
+// It is safe for concurrent use.
+type SymbolIndex struct {
+	// Extract computes the symbols of a document, it is required by the Did* helpers.
+	Extract Extractor
+	// Match scores symbol names against queries. Defaults to fuzzy.Match.
+	Match Matcher
+
+	mu    sync.RWMutex
+	byURI map[protocol.DocumentURI][]protocol.SymbolInformation
+}
+
+// NewSymbolIndex creates an index using extract to compute document symbols.
+// extract may be nil when symbols are always provided through Update.
+func NewSymbolIndex(extract Extractor) *SymbolIndex {
+	return &SymbolIndex{
+		Extract: extract,
+		Match:   fuzzy.Match,
+		byURI:   make(map[protocol.DocumentURI][]protocol.SymbolInformation),
+	}
+}
+
+// Update replaces the symbols of a document.
+func (idx *SymbolIndex) Update(uri protocol.DocumentURI, symbols []protocol.SymbolInformation) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if len(symbols) == 0 {
+		delete(idx.byURI, uri)
+		return
+	}
+	idx.byURI[uri] = symbols
+}
+
+// UpdateText extracts the symbols of text and replaces those of the document.
+func (idx *SymbolIndex) UpdateText(uri protocol.DocumentURI, text string) {
+	if idx.Extract == nil {
+		return
+	}
+	idx.Update(uri, idx.Extract(uri, text))
+}
+
+// Remove drops the symbols of a document, e.g. when the file is deleted.
+func (idx *SymbolIndex) Remove(uri protocol.DocumentURI) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	delete(idx.byURI, uri)
+}
+
+// Len returns the number of indexed symbols.
+func (idx *SymbolIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	n := 0
+	for _, symbols := range idx.byURI {
+		n += len(symbols)
+	}
+	return n
+}
+
+// DidOpen indexes an opened document. It can be called from a textDocument/didOpen handler.
+func (idx *SymbolIndex) DidOpen(ctx context.Context, params *protocol.DidOpenTextDocumentParams) error {
+	idx.UpdateText(params.TextDocument.URI, params.TextDocument.Text)
+	return nil
+}
+
+// DidChange re-indexes a changed document. It can be called from a textDocument/didChange handler.
+// Only full content changes can be indexed: incremental changes are ignored, use UpdateText
+// with the resulting text when the server syncs incrementally.
+func (idx *SymbolIndex) DidChange(ctx context.Context, params *protocol.DidChangeTextDocumentParams) error {
+	for i := len(params.ContentChanges) - 1; i >= 0; i-- {
+		if change := params.ContentChanges[i]; change.Range == nil {
+			idx.UpdateText(params.TextDocument.URI, change.Text)
+			return nil
+		}
+	}
+	return nil
+}
+
+// DidSave re-indexes a saved document when the client included its text.
+func (idx *SymbolIndex) DidSave(ctx context.Context, params *protocol.DidSaveTextDocumentParams) error {
+	if params.Text != nil {
+		idx.UpdateText(params.TextDocument.URI, *params.Text)
+	}
+	return nil
+}
+
+// Search returns the symbols matching query, best matches first.
+// An empty query matches every symbol. limit <= 0 means no limit.
+func (idx *SymbolIndex) Search(query string, limit int) []protocol.SymbolInformation {
+	page := idx.SearchPage(query, 0, limit)
+	return page.Symbols
+}
+
+// SymbolPage is a slice of search results.
+type SymbolPage struct {
+	// Symbols of the page, best matches first.
+	Symbols []protocol.SymbolInformation
+	// Total number of matching symbols.
+	Total int
+	// NextOffset is the offset of the next page, -1 on the last page.
+	NextOffset int
+}
+
+// SearchPage returns the matches of query from offset, at most limit of them (limit <= 0 means all).
+func (idx *SymbolIndex) SearchPage(query string, offset, limit int) SymbolPage {
+	type scored struct {
+		symbol protocol.SymbolInformation
+		score  int
+	}
+
+	idx.mu.RLock()
+	var matches []scored
+	for _, symbols := range idx.byURI {
+		for _, sym := range symbols {
+			score, ok := idx.Match(query, sym.Name)
+			if !ok {
+				continue
+			}
+			matches = append(matches, scored{symbol: sym, score: score})
+		}
+	}
+	idx.mu.RUnlock()
+
+	// Stable order: score, then shorter names, then name and location
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.symbol.Name) != len(b.symbol.Name) {
+			return len(a.symbol.Name) < len(b.symbol.Name)
+		}
+		if a.symbol.Name != b.symbol.Name {
+			return a.symbol.Name < b.symbol.Name
+		}
+		if a.symbol.Location.URI != b.symbol.Location.URI {
+			return a.symbol.Location.URI < b.symbol.Location.URI
+		}
+		return a.symbol.Location.Range.Start.Line < b.symbol.Location.Range.Start.Line
+	})
+
+	page := SymbolPage{Total: len(matches), NextOffset: -1, Symbols: []protocol.SymbolInformation{}}
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(matches) {
+		return page
+	}
+	end := len(matches)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+		page.NextOffset = end
+	}
+	for _, m := range matches[offset:end] {
+		page.Symbols = append(page.Symbols, m.symbol)
+	}
+	return page
+}
+
+// Pages splits symbols in batches of at most size symbols, e.g. to stream them as partial results.
+func Pages(symbols []protocol.SymbolInformation, size int) [][]protocol.SymbolInformation {
+	if size <= 0 || len(symbols) <= size {
+		return [][]protocol.SymbolInformation{symbols}
+	}
+	pages := make([][]protocol.SymbolInformation, 0, (len(symbols)+size-1)/size)
+	for start := 0; start < len(symbols); start += size {
+		end := min(start+size, len(symbols))
+		pages = append(pages, symbols[start:end])
+	}
+	return pages
+}